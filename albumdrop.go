@@ -0,0 +1,171 @@
+// Copyright 2016 Danko Miocevic. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Author: Danko Miocevic
+
+package main
+
+import (
+	"github.com/dankomiocevic/mulifs/musicmgr"
+	"github.com/dankomiocevic/mulifs/store"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"bazil.org/fuse"
+	"github.com/golang/glog"
+)
+
+// albumDrop holds the dropped files of an Album
+// until no more files of it are dropped.
+type albumDrop struct {
+	files   []File
+	headers []fuse.Header
+	timer   *time.Timer
+}
+
+// albumDrops keeps the Albums being dropped
+// indexed by their Artist and Album names.
+var albumDrops = struct {
+	sync.Mutex
+	m map[string]*albumDrop
+}{m: make(map[string]*albumDrop)}
+
+// dropHandler returns the function that files a
+// dropped file, with the album_drop option the
+// Songs are filed by Album.
+func dropHandler(header fuse.Header) func(File) error {
+	if config_params.album_drop {
+		return settleDrop(DelayedHandleAlbumDrop(header))
+	}
+	return settleDrop(DelayedHandleDrop(header))
+}
+
+// settleDrop returns the function that runs handle once
+// the dropped file was not modified for drop_settle seconds,
+// the files still being rewritten are pushed again to the
+// dispatcher so the successive writes are filed once.
+func settleDrop(handle func(File) error) func(File) error {
+	var settle func(File) error
+	settle = func(f File) error {
+		rootPoint := f.mPoint
+		if rootPoint[len(rootPoint)-1] != '/' {
+			rootPoint = rootPoint + "/"
+		}
+
+		path := rootPoint + "drop/" + f.dropName()
+		fi, err := os.Stat(path)
+		if err == nil && !flushing && time.Since(fi.ModTime()) < settleDelay() {
+			glog.Infof("The file %s was modified recently, waiting for it to settle.\n", path)
+			// This runs inside the dispatcher loop,
+			// pushing from it would block.
+			go PushFileItem(f, settle)
+			return nil
+		}
+		return handle(f)
+	}
+	return settle
+}
+
+// DelayedHandleAlbumDrop returns the function that adds a
+// dropped file to its Album, the Album is filed once no
+// more Songs of it are dropped for album_drop_delay seconds.
+// The files whose tags cannot be read are handled alone.
+func DelayedHandleAlbumDrop(header fuse.Header) func(File) error {
+	return func(f File) error {
+		rootPoint := f.mPoint
+		if rootPoint[len(rootPoint)-1] != '/' {
+			rootPoint = rootPoint + "/"
+		}
+
+		path := rootPoint + "drop/" + f.dropName()
+		err, tags := musicmgr.GetTags(path)
+		if err != nil || !musicmgr.IsMusicFile(path) {
+			return DelayedHandleDrop(header)(f)
+		}
+
+		key := store.GetCompatibleString(tags.Artist) + "/" + store.GetCompatibleString(tags.Album)
+		albumDrops.Lock()
+		defer albumDrops.Unlock()
+
+		a, ok := albumDrops.m[key]
+		if !ok {
+			a = &albumDrop{}
+			albumDrops.m[key] = a
+			a.timer = time.AfterFunc(time.Duration(config_params.album_drop_delay)*time.Second, func() {
+				fileAlbumDrop(key)
+			})
+		} else {
+			a.timer.Reset(time.Duration(config_params.album_drop_delay) * time.Second)
+		}
+
+		for _, other := range a.files {
+			if compareFiles(other, f) {
+				return nil
+			}
+		}
+		a.files = append(a.files, f)
+		a.headers = append(a.headers, header)
+		return nil
+	}
+}
+
+// fileAlbumDrop files all the Songs held for the Album,
+// the Album Directory cannot be read while they are filed.
+func fileAlbumDrop(key string) {
+	albumDrops.Lock()
+	a, ok := albumDrops.m[key]
+	delete(albumDrops.m, key)
+	albumDrops.Unlock()
+	if !ok {
+		return
+	}
+
+	items := strings.SplitN(key, "/", 2)
+	glog.Infof("Filing %d dropped Songs of %s\n", len(a.files), key)
+	unlock := store.LockAlbum(items[0], items[1])
+	defer unlock()
+
+	for i, f := range a.files {
+		DelayedHandleDrop(a.headers[i])(f)
+	}
+}
+
+// flushAlbumDrops files all the Albums being dropped
+// without waiting for more of their Songs.
+func flushAlbumDrops() {
+	albumDrops.Lock()
+	var keys []string
+	for key, a := range albumDrops.m {
+		if a.timer.Stop() {
+			keys = append(keys, key)
+		}
+	}
+	albumDrops.Unlock()
+
+	for _, key := range keys {
+		fileAlbumDrop(key)
+	}
+}
+
+// rlockAlbumDir waits until the Songs dropped in the
+// Album are filed, it returns the function that
+// unlocks the Album Directory.
+func (d *Dir) rlockAlbumDir() func() {
+	if !config_params.album_drop || !d.isAlbumDir() {
+		return func() {}
+	}
+	return store.RLockAlbum(d.artist, d.album)
+}
@@ -0,0 +1,91 @@
+// Copyright 2016 Danko Miocevic. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Author: Danko Miocevic
+
+package main
+
+import (
+	"fmt"
+	"github.com/dankomiocevic/mulifs/musicmgr"
+	"github.com/dankomiocevic/mulifs/store"
+	"github.com/golang/glog"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// trackReader is a cached reader of a track of a
+// FLAC album image and the modification time of
+// the image when it was created.
+type trackReader struct {
+	r       *musicmgr.FlacTrackReader
+	modTime time.Time
+}
+
+// trackReaders caches the readers of the tracks, finding
+// the frames of a track takes a few reads of the image.
+var trackReaders = struct {
+	sync.Mutex
+	m map[string]trackReader
+}{m: make(map[string]trackReader)}
+
+// isAlbumTrack returns true if the Song is a
+// track of a FLAC album image.
+func isAlbumTrack(artist, album, name string) bool {
+	if strings.ToLower(filepath.Ext(name)) != ".flac" {
+		return false
+	}
+	_, _, err := store.GetAlbumTrack(artist, album, name)
+	return err == nil
+}
+
+// albumTrack returns the reader of the File if it is a
+// track of a FLAC album image or nil if it is not.
+func (f *File) albumTrack() (*musicmgr.FlacTrackReader, error) {
+	if strings.ToLower(filepath.Ext(f.name)) != ".flac" || f.isDropped() || f.artist == "playlists" {
+		return nil, nil
+	}
+
+	path, track, err := store.GetAlbumTrack(f.artist, f.album, f.name)
+	if err != nil {
+		return nil, nil
+	}
+
+	fi, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+
+	key := fmt.Sprintf("%s/%d/%d", path, track.Start, track.End)
+	trackReaders.Lock()
+	cached, ok := trackReaders.m[key]
+	trackReaders.Unlock()
+	if ok && cached.modTime.Equal(fi.ModTime()) {
+		return cached.r, nil
+	}
+
+	r, err := musicmgr.NewFlacTrackReader(path, track)
+	if err != nil {
+		glog.Errorf("Cannot read the track %d of %s: %s\n", track.Number, path, err)
+		return nil, err
+	}
+
+	trackReaders.Lock()
+	trackReaders.m[key] = trackReader{r: r, modTime: fi.ModTime()}
+	trackReaders.Unlock()
+	return r, nil
+}
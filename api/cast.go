@@ -0,0 +1,117 @@
+// Copyright 2016 Danko Miocevic. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Author: Danko Miocevic
+
+package api
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"github.com/dankomiocevic/mulifs/cast"
+	"github.com/dankomiocevic/mulifs/store"
+	"net/url"
+	"strings"
+	"sync"
+)
+
+// CastArgs are the arguments of Cast, the Song
+// is only used when the Playlist is empty.
+type CastArgs struct {
+	Target   string
+	Playlist string
+	Song     store.SongRef
+}
+
+// streamToken is the secret part of the URLs where the cast
+// targets download the Songs, they cannot use the basic
+// authentication of the web interface.
+var streamToken struct {
+	sync.Once
+	value string
+}
+
+// getStreamToken returns the token of the stream
+// URLs, it is created the first time it is used.
+func getStreamToken() string {
+	streamToken.Do(func() {
+		b := make([]byte, 16)
+		rand.Read(b)
+		streamToken.value = hex.EncodeToString(b)
+	})
+	return streamToken.value
+}
+
+// Cast plays the playlist, or the Song if the playlist is
+// empty, on the target. The target downloads the Songs from
+// the web interface.
+func (l *Library) Cast(args CastArgs, reply *Empty) error {
+	target, ok := l.Targets[args.Target]
+	if !ok {
+		return errors.New("Unknown cast target.")
+	}
+	if len(l.CastURL) < 1 {
+		return errors.New("The web interface is not served.")
+	}
+
+	refs := []store.SongRef{args.Song}
+	if len(args.Playlist) > 0 {
+		files, err := store.GetPlaylistFiles(args.Playlist)
+		if err != nil {
+			return err
+		}
+
+		refs = nil
+		for _, f := range files {
+			refs = append(refs, store.SongRef{Artist: f.Artist, Album: f.Album, Song: f.Title})
+		}
+	}
+
+	var songs []cast.Media
+	for _, ref := range refs {
+		song, err := store.GetSong(ref.Artist, ref.Album, ref.Song)
+		if err != nil {
+			return err
+		}
+
+		songs = append(songs, cast.Media{
+			URL:         l.streamURL(ref),
+			ContentType: cast.ContentType(ref.Song),
+			Title:       song.SongName,
+			Artist:      ref.Artist,
+			Album:       ref.Album,
+		})
+	}
+	return cast.Play(target, songs)
+}
+
+// streamURL returns the URL where the
+// cast targets download the Song.
+func (l *Library) streamURL(ref store.SongRef) string {
+	return strings.TrimRight(l.CastURL, "/") + "/stream/" + getStreamToken() + "/" +
+		url.PathEscape(ref.Artist) + "/" + url.PathEscape(ref.Album) + "/" + url.PathEscape(ref.Song)
+}
+
+// songPath returns the Song of a stream path without
+// the /stream/ prefix, the token must be valid.
+func songPath(path string) (store.SongRef, bool) {
+	items := strings.Split(path, "/")
+	token := getStreamToken()
+	if len(items) != 4 || len(token) < 1 || subtle.ConstantTimeCompare([]byte(items[0]), []byte(token)) != 1 {
+		return store.SongRef{}, false
+	}
+	return store.SongRef{Artist: items[1], Album: items[2], Song: items[3]}, true
+}
@@ -0,0 +1,152 @@
+// Copyright 2016 Danko Miocevic. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Author: Danko Miocevic
+
+package api
+
+import (
+	"context"
+	"github.com/dankomiocevic/mulifs/playlistmgr"
+	"github.com/dankomiocevic/mulifs/store"
+	"net"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+)
+
+// Client calls the management API of a
+// running MuLi from other Go programs.
+type Client struct {
+	c *grpc.ClientConn
+}
+
+// Dial connects to the management API
+// listening on the Unix socket in path.
+func Dial(path string) (*Client, error) {
+	c, err := grpc.NewClient("passthrough:///"+path,
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithDefaultCallOptions(grpc.ForceCodec(jsonCodec{})),
+		grpc.WithContextDialer(func(ctx context.Context, addr string) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, "unix", path)
+		}))
+	if err != nil {
+		return nil, err
+	}
+	return &Client{c: c}, nil
+}
+
+// Close closes the connection.
+func (c *Client) Close() error {
+	return c.c.Close()
+}
+
+// call calls the method of the Library service.
+func (c *Client) call(method string, args, reply interface{}) error {
+	return c.c.Invoke(context.Background(), "/"+serviceName+"/"+method, args, reply)
+}
+
+// ListArtists returns the names of the Artist Directories.
+func (c *Client) ListArtists() ([]string, error) {
+	var reply []string
+	err := c.call("ListArtists", Empty{}, &reply)
+	return reply, err
+}
+
+// ListAlbums returns the names of the Album
+// Directories of the Artist.
+func (c *Client) ListAlbums(artist string) ([]string, error) {
+	var reply []string
+	err := c.call("ListAlbums", artist, &reply)
+	return reply, err
+}
+
+// Search returns the Songs that match the arguments.
+func (c *Client) Search(args SearchArgs) ([]store.SongNames, error) {
+	var reply []store.SongNames
+	err := c.call("Search", args, &reply)
+	return reply, err
+}
+
+// Retag changes the names of all the Songs that match the filter.
+func (c *Client) Retag(args RetagArgs) ([]RetagResult, error) {
+	var reply []RetagResult
+	err := c.call("Retag", args, &reply)
+	return reply, err
+}
+
+// ListPlaylists returns the names of the playlists.
+func (c *Client) ListPlaylists() ([]string, error) {
+	var reply []string
+	err := c.call("ListPlaylists", Empty{}, &reply)
+	return reply, err
+}
+
+// GetPlaylist returns the Songs of the playlist.
+func (c *Client) GetPlaylist(playlist string) ([]playlistmgr.PlaylistFile, error) {
+	var reply []playlistmgr.PlaylistFile
+	err := c.call("GetPlaylist", playlist, &reply)
+	return reply, err
+}
+
+// CreatePlaylist creates an empty playlist and
+// returns the name it is stored with.
+func (c *Client) CreatePlaylist(playlist string) (string, error) {
+	var reply string
+	err := c.call("CreatePlaylist", PlaylistArgs{Playlist: playlist}, &reply)
+	return reply, err
+}
+
+// DeletePlaylist removes the playlist.
+func (c *Client) DeletePlaylist(playlist string) error {
+	return c.call("DeletePlaylist", PlaylistArgs{Playlist: playlist}, &Empty{})
+}
+
+// AddToPlaylist adds the Song at the end of the playlist.
+func (c *Client) AddToPlaylist(playlist string, song store.SongRef) error {
+	return c.call("AddToPlaylist", PlaylistArgs{Playlist: playlist, Song: song}, &Empty{})
+}
+
+// GetDescription returns the description of the Artist
+// or the Album as a JSON object, the Album is empty
+// for the Artists.
+func (c *Client) GetDescription(artist, album string) (string, error) {
+	var reply string
+	err := c.call("GetDescription", DescriptionArgs{Artist: artist, Album: album}, &reply)
+	return reply, err
+}
+
+// UpdateDescription stores the description of the Artist or the Album.
+func (c *Client) UpdateDescription(artist, album, data string) error {
+	return c.call("UpdateDescription", DescriptionArgs{Artist: artist, Album: album, Data: data}, &Empty{})
+}
+
+// GetStatus returns the content of the status file.
+func (c *Client) GetStatus() (string, error) {
+	var reply string
+	err := c.call("GetStatus", Empty{}, &reply)
+	return reply, err
+}
+
+// Cast plays the playlist, or the Song if the
+// playlist is empty, on the cast target.
+func (c *Client) Cast(target, playlist string, song store.SongRef) error {
+	return c.call("Cast", CastArgs{Target: target, Playlist: playlist, Song: song}, &Empty{})
+}
+
+// Scan scans the source Directory again and adds the new files.
+func (c *Client) Scan() error {
+	return c.call("Scan", Empty{}, &Empty{})
+}
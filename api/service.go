@@ -0,0 +1,487 @@
+// Copyright 2016 Danko Miocevic. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Author: Danko Miocevic
+
+// Package api exposes the management of the Library to
+// other programs through a gRPC service listening on a
+// Unix socket, the Client type calls it from Go.
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/dankomiocevic/mulifs/cast"
+	"github.com/dankomiocevic/mulifs/playlistmgr"
+	"github.com/dankomiocevic/mulifs/store"
+	"github.com/dankomiocevic/mulifs/tools"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+
+	"bazil.org/fuse"
+	"github.com/golang/glog"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// serviceName is the name of the gRPC service, the
+// methods are called as /mulifs.Library/Search.
+const serviceName = "mulifs.Library"
+
+// jsonCodec encodes the messages of the service as
+// JSON, so the arguments and the results are the Go
+// types of the api and store packages.
+type jsonCodec struct{}
+
+func (jsonCodec) Marshal(v interface{}) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+func (jsonCodec) Unmarshal(data []byte, v interface{}) error {
+	return json.Unmarshal(data, v)
+}
+
+func (jsonCodec) Name() string {
+	return "json"
+}
+
+// Empty is used for the calls without
+// arguments or without result.
+type Empty struct{}
+
+// SearchArgs selects the Songs returned by Search, the
+// Query is found in the Artist, Album or Title ignoring
+// the case and the empty fields match every Song. The
+// Fields are the values of the custom fields of the
+// descriptions of the Album or its Artist.
+type SearchArgs struct {
+	Artist string
+	Album  string
+	Query  string
+	Fields map[string]string
+}
+
+// RetagArgs are the arguments of Retag,
+// they are the same of the retag command.
+type RetagArgs struct {
+	Filter  tools.RetagFilter
+	Changes tools.RetagChanges
+	DryRun  bool
+}
+
+// RetagResult is a Song changed by Retag,
+// Error is empty if the Song was changed.
+type RetagResult struct {
+	Song   store.SongNames
+	Artist string
+	Album  string
+	Title  string
+	Error  string
+}
+
+// PlaylistArgs are the arguments of the calls
+// that change a playlist, the Song is only
+// used to add a Song to the playlist.
+type PlaylistArgs struct {
+	Playlist string
+	Song     store.SongRef
+}
+
+// DescriptionArgs select the Artist or the Album of a
+// description, the Album is empty for the Artists. Data
+// is the new description when it is updated.
+type DescriptionArgs struct {
+	Artist string
+	Album  string
+	Data   string
+}
+
+// Library is the service exposed to the other programs,
+// Root is the source Directory of MuLi. Changed is
+// called with the operation and the paths inside MuLi
+// every time the Library is changed. Status returns the
+// content of the status file of MuLi. Targets are the
+// devices where the Songs are cast by name and CastURL
+// is the URL of the web interface used by the devices.
+type Library struct {
+	Root    string
+	Changed func(op string, paths ...string)
+	Status  func() []byte
+	Targets map[string]cast.Target
+	CastURL string
+
+	// scanning prevents running two scans at the same time.
+	scanning sync.Mutex
+}
+
+// changed calls Changed if it is set.
+func (l *Library) changed(op string, paths ...string) {
+	if l.Changed != nil {
+		l.Changed(op, paths...)
+	}
+}
+
+// dirNames returns the names of the Directories.
+func dirNames(entries []fuse.Dirent) []string {
+	var a []string
+	for _, e := range entries {
+		if e.Type == fuse.DT_Dir {
+			a = append(a, e.Name)
+		}
+	}
+	return a
+}
+
+// ListArtists returns the names of the Artist Directories.
+func (l *Library) ListArtists(args Empty, reply *[]string) error {
+	entries, err := store.ListArtists()
+	if err != nil {
+		return err
+	}
+	*reply = dirNames(entries)
+	return nil
+}
+
+// ListAlbums returns the names of the Album
+// Directories of the Artist.
+func (l *Library) ListAlbums(artist string, reply *[]string) error {
+	entries, err := store.ListAlbums(artist)
+	if err != nil {
+		return err
+	}
+	*reply = dirNames(entries)
+	return nil
+}
+
+// contains returns true if the query is
+// inside the name, ignoring the case.
+func contains(name, query string) bool {
+	return strings.Contains(strings.ToLower(name), query)
+}
+
+// Search returns the Songs that match the arguments.
+func (l *Library) Search(args SearchArgs, reply *[]store.SongNames) error {
+	songs, err := store.ListSongNames()
+	if err != nil {
+		return err
+	}
+
+	var values store.FieldValues
+	if len(args.Fields) > 0 {
+		values, err = store.ListFieldValues()
+		if err != nil {
+			return err
+		}
+	}
+
+	query := strings.ToLower(strings.TrimSpace(args.Query))
+	var a []store.SongNames
+	for _, s := range songs {
+		if len(args.Artist) > 0 && s.Artist != args.Artist {
+			continue
+		}
+		if len(args.Album) > 0 && s.Album != args.Album {
+			continue
+		}
+		if len(query) > 0 && !contains(s.ArtistName, query) && !contains(s.AlbumName, query) && !contains(s.Title, query) {
+			continue
+		}
+		if len(args.Fields) > 0 && !values.Match(s.SongRef, args.Fields) {
+			continue
+		}
+		a = append(a, s)
+	}
+	*reply = a
+	return nil
+}
+
+// Retag changes the names of all the Songs that match the
+// filter like the retag command, the Songs are moved to
+// their new Directories in the source Directory.
+func (l *Library) Retag(args RetagArgs, reply *[]RetagResult) error {
+	results, err := tools.RetagSongs(l.Root, args.Filter, args.Changes, args.DryRun)
+	if err != nil {
+		return err
+	}
+
+	var a []RetagResult
+	for _, r := range results {
+		result := RetagResult{Song: r.Song, Artist: r.Artist, Album: r.Album, Title: r.Title}
+		if r.Err != nil {
+			result.Error = r.Err.Error()
+		} else if !args.DryRun {
+			s := r.Song
+			l.changed("retag", s.Artist+"/"+s.Album+"/"+s.Song)
+		}
+		a = append(a, result)
+	}
+	*reply = a
+	return nil
+}
+
+// checkDescription returns an error if the Artist
+// or the Album of the description does not exist.
+func checkDescription(args DescriptionArgs) error {
+	if _, err := store.GetArtistPath(args.Artist); err != nil {
+		return err
+	}
+	if len(args.Album) > 0 {
+		_, err := store.GetAlbumPath(args.Artist, args.Album)
+		return err
+	}
+	return nil
+}
+
+// GetDescription returns the description of
+// the Artist or the Album as a JSON object.
+func (l *Library) GetDescription(args DescriptionArgs, reply *string) error {
+	if err := checkDescription(args); err != nil {
+		return err
+	}
+
+	data, err := store.GetDescription(args.Artist, args.Album, ".description")
+	if err != nil {
+		return err
+	}
+	*reply = data
+	return nil
+}
+
+// UpdateDescription stores the description of the Artist
+// or the Album, like writing its .description file.
+func (l *Library) UpdateDescription(args DescriptionArgs, reply *Empty) error {
+	if err := checkDescription(args); err != nil {
+		return err
+	}
+
+	err := store.UpdateDescription(args.Artist, args.Album, []byte(args.Data))
+	if err != nil {
+		return err
+	}
+
+	path := args.Artist
+	if len(args.Album) > 0 {
+		path = path + "/" + args.Album
+	}
+	l.changed("edit", path+"/.description")
+	return nil
+}
+
+// GetStatus returns the content of the status file, with
+// the progress of the scans and the files dropped.
+func (l *Library) GetStatus(args Empty, reply *string) error {
+	if l.Status == nil {
+		return errors.New("The status is not available.")
+	}
+	*reply = string(l.Status())
+	return nil
+}
+
+// ListPlaylists returns the names of the playlists.
+func (l *Library) ListPlaylists(args Empty, reply *[]string) error {
+	entries, err := store.ListPlaylists()
+	if err != nil {
+		return err
+	}
+	*reply = dirNames(entries)
+	return nil
+}
+
+// GetPlaylist returns the Songs of the playlist.
+func (l *Library) GetPlaylist(playlist string, reply *[]playlistmgr.PlaylistFile) error {
+	files, err := store.GetPlaylistFiles(playlist)
+	if err != nil {
+		return err
+	}
+	*reply = files
+	return nil
+}
+
+// CreatePlaylist creates an empty playlist and
+// returns the name it is stored with.
+func (l *Library) CreatePlaylist(args PlaylistArgs, reply *string) error {
+	name, err := store.CreatePlaylist(args.Playlist, l.Root)
+	if err != nil {
+		return err
+	}
+	*reply = name
+	l.changed("mkdir", "playlists/"+name)
+	return nil
+}
+
+// DeletePlaylist removes the playlist.
+func (l *Library) DeletePlaylist(args PlaylistArgs, reply *Empty) error {
+	err := store.DeletePlaylist(args.Playlist, l.Root)
+	if err != nil {
+		return err
+	}
+	l.changed("delete", "playlists/"+args.Playlist)
+	return nil
+}
+
+// AddToPlaylist adds the Song at the
+// end of the playlist.
+func (l *Library) AddToPlaylist(args PlaylistArgs, reply *Empty) error {
+	s := args.Song
+	path, err := store.GetFilePath(s.Artist, s.Album, s.Song)
+	if err != nil {
+		return err
+	}
+
+	file := playlistmgr.PlaylistFile{Title: s.Song, Artist: s.Artist, Album: s.Album, Path: path}
+	err = store.AddFileToPlaylist(file, args.Playlist)
+	if err != nil {
+		return err
+	}
+
+	err = store.RegeneratePlaylistFile(args.Playlist, l.Root)
+	if err != nil {
+		return err
+	}
+	l.changed("create", "playlists/"+args.Playlist+"/"+s.Song)
+	return nil
+}
+
+// Scan scans the source Directory again and adds the
+// new files, only one scan runs at the same time.
+func (l *Library) Scan(args Empty, reply *Empty) error {
+	l.scanning.Lock()
+	defer l.scanning.Unlock()
+	return tools.ScanFolder(l.Root)
+}
+
+// errorCodes are the gRPC codes returned
+// for the errors of the store.
+var errorCodes = map[error]codes.Code{
+	fuse.ENOENT: codes.NotFound,
+	fuse.EEXIST: codes.AlreadyExists,
+	fuse.EPERM:  codes.PermissionDenied,
+}
+
+// serviceDesc describes the methods of the Library that
+// look like Method(args T, reply *R) error as unary gRPC
+// methods, the arguments are decoded into a new T and
+// the reply is sent back.
+func serviceDesc() *grpc.ServiceDesc {
+	desc := &grpc.ServiceDesc{
+		ServiceName: serviceName,
+		HandlerType: (*interface{})(nil),
+	}
+
+	t := reflect.TypeOf(&Library{})
+	errorType := reflect.TypeOf((*error)(nil)).Elem()
+	for i := 0; i < t.NumMethod(); i++ {
+		m := t.Method(i)
+		mt := m.Type
+		if mt.NumIn() != 3 || mt.NumOut() != 1 || mt.In(2).Kind() != reflect.Ptr || mt.Out(0) != errorType {
+			continue
+		}
+
+		method := m
+		desc.Methods = append(desc.Methods, grpc.MethodDesc{
+			MethodName: method.Name,
+			Handler: func(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+				args := reflect.New(method.Type.In(1))
+				if err := dec(args.Interface()); err != nil {
+					return nil, err
+				}
+
+				call := func(ctx context.Context, req interface{}) (interface{}, error) {
+					reply := reflect.New(method.Type.In(2).Elem())
+					out := method.Func.Call([]reflect.Value{reflect.ValueOf(srv), reflect.ValueOf(req).Elem(), reply})
+					if err, _ := out[0].Interface().(error); err != nil {
+						if code, ok := errorCodes[err]; ok {
+							return nil, status.Error(code, err.Error())
+						}
+						return nil, err
+					}
+					return reply.Interface(), nil
+				}
+				if interceptor == nil {
+					return call(ctx, args.Interface())
+				}
+				info := &grpc.UnaryServerInfo{Server: srv, FullMethod: "/" + serviceName + "/" + method.Name}
+				return interceptor(ctx, args.Interface(), info, call)
+			},
+		})
+	}
+	return desc
+}
+
+// listen creates the Unix socket in path, the socket is
+// created inside a private Directory and moved to the path
+// so it is never usable by other users. An old socket left
+// by MuLi is replaced, any other file is kept.
+func listen(path string) (net.Listener, error) {
+	if fi, err := os.Lstat(path); err == nil {
+		if fi.Mode()&os.ModeSocket == 0 {
+			return nil, errors.New("The api path exists and it is not a socket.")
+		}
+		if conn, err := net.Dial("unix", path); err == nil {
+			conn.Close()
+			return nil, errors.New("The api socket is already in use.")
+		}
+	}
+
+	dir, err := ioutil.TempDir(filepath.Dir(path), ".muli-api-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+
+	tmp := filepath.Join(dir, "socket")
+	listener, err := net.Listen("unix", tmp)
+	if err != nil {
+		return nil, err
+	}
+	listener.(*net.UnixListener).SetUnlinkOnClose(false)
+
+	err = os.Chmod(tmp, 0600)
+	if err == nil {
+		err = os.Rename(tmp, path)
+	}
+	if err != nil {
+		listener.Close()
+		return nil, err
+	}
+	return listener, nil
+}
+
+// Serve listens on the Unix socket in path and serves the
+// Library until the listener fails. The socket can only be
+// used by the user running MuLi.
+func Serve(path string, l *Library) error {
+	if l == nil || len(l.Root) < 1 {
+		return errors.New("The source Directory is not set.")
+	}
+
+	listener, err := listen(path)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(path)
+
+	server := grpc.NewServer(grpc.ForceServerCodec(jsonCodec{}))
+	server.RegisterService(serviceDesc(), l)
+
+	glog.Infof("Serving the management API on %s\n", path)
+	return server.Serve(listener)
+}
@@ -0,0 +1,97 @@
+// Copyright 2016 Danko Miocevic. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Author: Danko Miocevic
+
+package api
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestListenKeepsOtherFiles(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "api.sock")
+	if err := ioutil.WriteFile(path, []byte("data"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := listen(path); err == nil {
+		t.Fatal("listen replaced a regular file")
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil || string(data) != "data" {
+		t.Fatalf("the file was changed: %q, %v", data, err)
+	}
+}
+
+func TestListenReplacesStaleSocket(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "api.sock")
+	l, err := listen(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := listen(path); err == nil {
+		t.Fatal("listen replaced a socket in use")
+	}
+	l.Close()
+
+	l, err = listen(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	fi, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fi.Mode()&os.ModeSocket == 0 || fi.Mode().Perm() != 0600 {
+		t.Errorf("wrong socket mode %s", fi.Mode())
+	}
+}
+
+func TestServeStatus(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "api.sock")
+	l := &Library{Root: t.TempDir(), Status: func() []byte { return []byte("idle") }}
+	go Serve(path, l)
+
+	for i := 0; ; i++ {
+		if _, err := os.Stat(path); err == nil {
+			break
+		}
+		if i > 100 {
+			t.Fatal("the socket was not created")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	c, err := Dial(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	status, err := c.GetStatus()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status != "idle" {
+		t.Errorf("GetStatus() = %q, want %q", status, "idle")
+	}
+}
@@ -0,0 +1,723 @@
+// Copyright 2016 Danko Miocevic. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Author: Danko Miocevic
+
+package api
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"github.com/dankomiocevic/mulifs/cast"
+	"github.com/dankomiocevic/mulifs/playlistmgr"
+	"github.com/dankomiocevic/mulifs/store"
+	"io/ioutil"
+	"mime"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+
+	"bazil.org/fuse"
+	"github.com/golang/glog"
+)
+
+// webHandler serves the web interface and the JSON calls
+// it makes, they are the same calls of the Library service.
+type webHandler struct {
+	l     *Library
+	auth  string
+	hosts []string
+	mux   *http.ServeMux
+}
+
+// ServeWeb serves the web interface of the Library on the
+// address until the listener fails. When auth is set as
+// user:password the requests must use that basic
+// authentication. The hosts are the names accepted in
+// the Host of the requests besides the one of the address.
+func ServeWeb(addr, auth string, hosts []string, l *Library) error {
+	if l == nil || len(l.Root) < 1 {
+		return errors.New("The source Directory is not set.")
+	}
+
+	if name, _, err := net.SplitHostPort(addr); err == nil && len(name) > 0 {
+		hosts = append(hosts, name)
+	}
+
+	h := &webHandler{l: l, auth: auth, hosts: hosts, mux: http.NewServeMux()}
+	h.mux.HandleFunc("/", h.page)
+	h.mux.HandleFunc("/api/artists", h.artists)
+	h.mux.HandleFunc("/api/albums", h.albums)
+	h.mux.HandleFunc("/api/search", h.search)
+	h.mux.HandleFunc("/api/retag", h.retag)
+	h.mux.HandleFunc("/api/description", h.description)
+	h.mux.HandleFunc("/api/playlists", h.playlists)
+	h.mux.HandleFunc("/api/playlist", h.playlist)
+	h.mux.HandleFunc("/api/playlist/add", h.addToPlaylist)
+	h.mux.HandleFunc("/api/status", h.status)
+	h.mux.HandleFunc("/api/scan", h.scan)
+	h.mux.HandleFunc("/api/cast", h.cast)
+	h.mux.HandleFunc("/api/targets", h.targets)
+
+	glog.Infof("Serving the web interface on http://%s/\n", addr)
+	return http.ListenAndServe(addr, h)
+}
+
+// ServeHTTP checks the host and the authentication and
+// serves the request, the Songs streamed to the cast
+// targets use their token.
+func (h *webHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if strings.HasPrefix(r.URL.Path, "/stream/") {
+		h.stream(w, r)
+		return
+	}
+
+	if !h.allowedHost(r.Host) {
+		http.Error(w, "Unknown host.", http.StatusForbidden)
+		return
+	}
+
+	if len(h.auth) > 0 {
+		user, password, ok := r.BasicAuth()
+		if !ok || subtle.ConstantTimeCompare([]byte(user+":"+password), []byte(h.auth)) != 1 {
+			w.Header().Set("WWW-Authenticate", `Basic realm="MuLi"`)
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+	}
+
+	if status, err := checkSameSite(r); err != nil {
+		http.Error(w, err.Error(), status)
+		return
+	}
+	h.mux.ServeHTTP(w, r)
+}
+
+// allowedHost returns true if the Host of the request is
+// the address of the interface, localhost, an IP address
+// or one of the hosts. Other names are rejected so the pages
+// of other sites cannot reach the interface by pointing
+// their names to this host (DNS rebinding).
+func (h *webHandler) allowedHost(host string) bool {
+	name, _, err := net.SplitHostPort(host)
+	if err != nil {
+		name = host
+	}
+
+	name = strings.ToLower(strings.Trim(name, "[]"))
+	if name == "localhost" || net.ParseIP(name) != nil {
+		return true
+	}
+
+	for _, allowed := range h.hosts {
+		if name == strings.ToLower(allowed) {
+			return true
+		}
+	}
+	return false
+}
+
+// checkSameSite returns an error and its status if the
+// request changes the Library from another site. The browsers
+// send the basic authentication to any page that posts to the
+// interface, so the Origin must be the host of the interface
+// and the POST requests must be JSON, the forms of other pages
+// cannot send it without a CORS preflight.
+func checkSameSite(r *http.Request) (int, error) {
+	if r.Method == http.MethodGet || r.Method == http.MethodHead {
+		return 0, nil
+	}
+
+	if origin := r.Header.Get("Origin"); len(origin) > 0 {
+		u, err := url.Parse(origin)
+		if err != nil || u.Host != r.Host {
+			return http.StatusForbidden, errors.New("Cross origin requests are not allowed.")
+		}
+	}
+
+	if r.Method == http.MethodPost {
+		mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+		if err != nil || mediaType != "application/json" {
+			return http.StatusUnsupportedMediaType, errors.New("The Content-Type must be application/json.")
+		}
+	}
+	return 0, nil
+}
+
+// reply writes the result of a call as JSON, the
+// errors are written as text with their status.
+func reply(w http.ResponseWriter, v interface{}, err error) {
+	if err != nil {
+		status := http.StatusBadRequest
+		if err == fuse.ENOENT {
+			status = http.StatusNotFound
+		}
+		http.Error(w, err.Error(), status)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
+
+// allow returns false and writes the error if
+// the request does not use the method.
+func allow(w http.ResponseWriter, r *http.Request, method string) bool {
+	if r.Method != method {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return false
+	}
+	return true
+}
+
+// readJSON decodes the body of the request into v.
+func readJSON(r *http.Request, v interface{}) error {
+	defer r.Body.Close()
+	return json.NewDecoder(r.Body).Decode(v)
+}
+
+// page serves the web interface.
+func (h *webHandler) page(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/" {
+		http.NotFound(w, r)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Write([]byte(webPage))
+}
+
+// artists lists the Artist Directories.
+func (h *webHandler) artists(w http.ResponseWriter, r *http.Request) {
+	var a []string
+	err := h.l.ListArtists(Empty{}, &a)
+	reply(w, a, err)
+}
+
+// albums lists the Album Directories of the artist.
+func (h *webHandler) albums(w http.ResponseWriter, r *http.Request) {
+	var a []string
+	err := h.l.ListAlbums(r.URL.Query().Get("artist"), &a)
+	reply(w, a, err)
+}
+
+// search returns the Songs that match the q, artist and
+// album, every field is a custom field written as NAME=VALUE.
+func (h *webHandler) search(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	args := SearchArgs{Artist: q.Get("artist"), Album: q.Get("album"), Query: q.Get("q")}
+	for _, field := range q["field"] {
+		items := strings.SplitN(field, "=", 2)
+		if len(items) == 2 && len(items[0]) > 0 {
+			if args.Fields == nil {
+				args.Fields = make(map[string]string)
+			}
+			args.Fields[items[0]] = items[1]
+		}
+	}
+
+	var a []store.SongNames
+	err := h.l.Search(args, &a)
+	reply(w, a, err)
+}
+
+// retag changes the names of the Songs, the
+// body has the RetagArgs in JSON.
+func (h *webHandler) retag(w http.ResponseWriter, r *http.Request) {
+	if !allow(w, r, http.MethodPost) {
+		return
+	}
+
+	var args RetagArgs
+	var a []RetagResult
+	err := readJSON(r, &args)
+	if err == nil {
+		err = h.l.Retag(args, &a)
+	}
+	reply(w, a, err)
+}
+
+// description returns the description of the artist and
+// album with GET and stores the body with PUT.
+func (h *webHandler) description(w http.ResponseWriter, r *http.Request) {
+	args := DescriptionArgs{Artist: r.URL.Query().Get("artist"), Album: r.URL.Query().Get("album")}
+	switch r.Method {
+	case http.MethodGet:
+		var data string
+		err := h.l.GetDescription(args, &data)
+		reply(w, data, err)
+	case http.MethodPut:
+		data, err := ioutil.ReadAll(r.Body)
+		r.Body.Close()
+		if err == nil {
+			args.Data = string(data)
+			err = h.l.UpdateDescription(args, &Empty{})
+		}
+		reply(w, Empty{}, err)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// playlists lists the playlists with GET and creates
+// the playlist in the PlaylistArgs body with POST.
+func (h *webHandler) playlists(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		var a []string
+		err := h.l.ListPlaylists(Empty{}, &a)
+		reply(w, a, err)
+	case http.MethodPost:
+		var args PlaylistArgs
+		var name string
+		err := readJSON(r, &args)
+		if err == nil {
+			err = h.l.CreatePlaylist(args, &name)
+		}
+		reply(w, name, err)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// playlist returns the Songs of the playlist in
+// name with GET and deletes it with DELETE.
+func (h *webHandler) playlist(w http.ResponseWriter, r *http.Request) {
+	args := PlaylistArgs{Playlist: r.URL.Query().Get("name")}
+	switch r.Method {
+	case http.MethodGet:
+		var files []playlistmgr.PlaylistFile
+		err := h.l.GetPlaylist(args.Playlist, &files)
+		reply(w, files, err)
+	case http.MethodDelete:
+		err := h.l.DeletePlaylist(args, &Empty{})
+		reply(w, Empty{}, err)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// addToPlaylist adds the Song to the playlist,
+// the body has the PlaylistArgs in JSON.
+func (h *webHandler) addToPlaylist(w http.ResponseWriter, r *http.Request) {
+	if !allow(w, r, http.MethodPost) {
+		return
+	}
+
+	var args PlaylistArgs
+	err := readJSON(r, &args)
+	if err == nil {
+		err = h.l.AddToPlaylist(args, &Empty{})
+	}
+	reply(w, Empty{}, err)
+}
+
+// status returns the content of the status file.
+func (h *webHandler) status(w http.ResponseWriter, r *http.Request) {
+	var data string
+	err := h.l.GetStatus(Empty{}, &data)
+	reply(w, data, err)
+}
+
+// scan starts a scan of the source Directory, it
+// does not wait for the scan to finish.
+func (h *webHandler) scan(w http.ResponseWriter, r *http.Request) {
+	if !allow(w, r, http.MethodPost) {
+		return
+	}
+
+	go func() {
+		err := h.l.Scan(Empty{}, &Empty{})
+		if err != nil {
+			glog.Errorf("Cannot scan the source Directory: %s\n", err)
+		}
+	}()
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// cast plays a playlist or a Song on a cast
+// target, the body has the CastArgs in JSON.
+func (h *webHandler) cast(w http.ResponseWriter, r *http.Request) {
+	if !allow(w, r, http.MethodPost) {
+		return
+	}
+
+	var args CastArgs
+	err := readJSON(r, &args)
+	if err == nil {
+		err = h.l.Cast(args, &Empty{})
+	}
+	reply(w, Empty{}, err)
+}
+
+// targets lists the names of the cast targets.
+func (h *webHandler) targets(w http.ResponseWriter, r *http.Request) {
+	a := []string{}
+	for name := range h.l.Targets {
+		a = append(a, name)
+	}
+	sort.Strings(a)
+	reply(w, a, nil)
+}
+
+// stream serves the file of a Song to the cast targets,
+// the path is /stream/TOKEN/ARTIST/ALBUM/SONG.
+func (h *webHandler) stream(w http.ResponseWriter, r *http.Request) {
+	ref, ok := songPath(strings.TrimPrefix(r.URL.Path, "/stream/"))
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+
+	path, err := store.GetFilePath(ref.Artist, ref.Album, ref.Song)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", cast.ContentType(ref.Song))
+	http.ServeContent(w, r, ref.Song, info.ModTime(), file)
+}
+
+// webPage is the web interface, it only uses the
+// JSON calls served next to it.
+const webPage = `<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>MuLi</title>
+<style>
+body { font-family: sans-serif; margin: 1em 2em; }
+nav a { margin-right: 1em; cursor: pointer; color: #06c; }
+section { display: none; margin-top: 1em; }
+section.active { display: block; }
+table { border-collapse: collapse; }
+td, th { padding: 2px 8px; text-align: left; }
+textarea { width: 100%; height: 20em; font-family: monospace; }
+pre { background: #f4f4f4; padding: 1em; }
+.error { color: #c00; }
+</style>
+</head>
+<body>
+<h1>MuLi</h1>
+<p>Cast to <select id="cast-target"></select></p>
+<nav>
+<a data-tab="search">Search</a>
+<a data-tab="retag">Retag</a>
+<a data-tab="playlists">Playlists</a>
+<a data-tab="description">Descriptions</a>
+<a data-tab="status">Status</a>
+</nav>
+<p id="error" class="error"></p>
+
+<section id="search">
+<form id="search-form">
+<input name="q" placeholder="Song">
+<input name="artist" placeholder="Artist">
+<input name="album" placeholder="Album">
+<input name="field" placeholder="Field=value">
+<button>Search</button>
+</form>
+<table id="results"></table>
+<p>
+<input id="playlist-target" placeholder="Playlist">
+<button id="add">Add selected to playlist</button>
+<button id="cast-song">Cast selected Song</button>
+</p>
+</section>
+
+<section id="retag">
+<form id="retag-form">
+<p>
+Songs with
+<input name="Artist" placeholder="Artist">
+<input name="Album" placeholder="Album">
+<input name="Title" placeholder="Title">
+<input name="Genre" placeholder="Genre">
+<input name="Year" placeholder="Year">
+</p>
+<p>
+Change to
+<input name="NewArtist" placeholder="New Artist">
+<input name="NewAlbum" placeholder="New Album">
+<input name="NewTitle" placeholder="New Title">
+</p>
+<button name="preview">Preview</button>
+<button name="apply">Apply</button>
+</form>
+<table id="retag-results"></table>
+</section>
+
+<section id="playlists">
+<form id="playlist-form">
+<input name="name" placeholder="New playlist">
+<button>Create</button>
+</form>
+<ul id="playlist-list"></ul>
+<table id="playlist-songs"></table>
+</section>
+
+<section id="description">
+<form id="description-form">
+<input name="artist" placeholder="Artist">
+<input name="album" placeholder="Album">
+<button>Load</button>
+</form>
+<textarea id="description-data"></textarea>
+<button id="description-save">Save</button>
+</section>
+
+<section id="status">
+<button id="scan">Scan the source Directory</button>
+<pre id="status-data"></pre>
+</section>
+
+<script>
+var results = [];
+
+function $(id) { return document.getElementById(id); }
+
+function call(method, url, body) {
+  $("error").textContent = "";
+  var opts = { method: method, headers: {} };
+  if (method === "POST") {
+    opts.headers["Content-Type"] = "application/json";
+  }
+  if (body !== undefined) {
+    opts.body = typeof body === "string" ? body : JSON.stringify(body);
+  }
+  return fetch(url, opts).then(function (r) {
+    if (!r.ok) {
+      return r.text().then(function (t) { throw new Error(t); });
+    }
+    var type = r.headers.get("Content-Type") || "";
+    return type.indexOf("json") >= 0 ? r.json() : null;
+  }).catch(function (e) {
+    $("error").textContent = e.message;
+    throw e;
+  });
+}
+
+function query(form) {
+  var q = [];
+  for (var i = 0; i < form.elements.length; i++) {
+    var e = form.elements[i];
+    if (e.name) {
+      q.push(e.name + "=" + encodeURIComponent(e.value));
+    }
+  }
+  return q.join("&");
+}
+
+function row(table, cells, header) {
+  var tr = document.createElement("tr");
+  cells.forEach(function (c) {
+    var td = document.createElement(header ? "th" : "td");
+    if (c instanceof Node) {
+      td.appendChild(c);
+    } else {
+      td.textContent = c;
+    }
+    tr.appendChild(td);
+  });
+  table.appendChild(tr);
+}
+
+function selected() {
+  var a = [];
+  document.querySelectorAll("#results input:checked").forEach(function (c) {
+    a.push(results[c.value]);
+  });
+  return a;
+}
+
+function show(tab) {
+  document.querySelectorAll("section").forEach(function (s) {
+    s.className = s.id === tab ? "active" : "";
+  });
+  if (tab === "playlists") { loadPlaylists(); }
+  if (tab === "status") { loadStatus(); }
+}
+
+$("search-form").onsubmit = function (ev) {
+  ev.preventDefault();
+  call("GET", "/api/search?" + query(this)).then(function (songs) {
+    results = songs || [];
+    var t = $("results");
+    t.innerHTML = "";
+    row(t, ["", "Artist", "Album", "Song"], true);
+    results.forEach(function (s, i) {
+      var c = document.createElement("input");
+      c.type = "checkbox";
+      c.value = i;
+      row(t, [c, s.ArtistName, s.AlbumName, s.Title]);
+    });
+  });
+};
+
+function retag(dryRun) {
+  var e = $("retag-form").elements;
+  call("POST", "/api/retag", {
+    Filter: {
+      Artist: e.Artist.value, Album: e.Album.value, Title: e.Title.value,
+      Genre: e.Genre.value, Year: e.Year.value
+    },
+    Changes: { Artist: e.NewArtist.value, Album: e.NewAlbum.value, Title: e.NewTitle.value },
+    DryRun: dryRun
+  }).then(function (res) {
+    var t = $("retag-results");
+    t.innerHTML = "";
+    row(t, ["Song", "Artist", "Album", "Title", "Error"], true);
+    (res || []).forEach(function (r) {
+      row(t, [r.Song.Title, r.Artist, r.Album, r.Title, r.Error]);
+    });
+  });
+}
+
+$("retag-form").onsubmit = function (ev) {
+  ev.preventDefault();
+  retag(!ev.submitter || ev.submitter.name !== "apply");
+};
+
+$("add").onclick = function () {
+  var name = $("playlist-target").value;
+  var songs = selected();
+  var next = Promise.resolve();
+  songs.forEach(function (s) {
+    next = next.then(function () {
+      return call("POST", "/api/playlist/add", {
+        Playlist: name, Song: { Artist: s.Artist, Album: s.Album, Song: s.Song }
+      });
+    });
+  });
+};
+
+$("cast-song").onclick = function () {
+  var songs = selected();
+  if (songs.length < 1) { return; }
+  var s = songs[0];
+  call("POST", "/api/cast", {
+    Target: $("cast-target").value,
+    Song: { Artist: s.Artist, Album: s.Album, Song: s.Song }
+  });
+};
+
+function loadTargets() {
+  call("GET", "/api/targets").then(function (names) {
+    var sel = $("cast-target");
+    sel.parentNode.style.display = names && names.length > 0 ? "" : "none";
+    (names || []).forEach(function (n) {
+      var o = document.createElement("option");
+      o.textContent = n;
+      sel.appendChild(o);
+    });
+  });
+}
+
+function loadPlaylists() {
+  call("GET", "/api/playlists").then(function (names) {
+    var ul = $("playlist-list");
+    ul.innerHTML = "";
+    (names || []).forEach(function (n) {
+      var li = document.createElement("li");
+      var a = document.createElement("a");
+      a.textContent = n;
+      a.href = "#";
+      a.onclick = function (ev) { ev.preventDefault(); loadPlaylist(n); };
+      var del = document.createElement("button");
+      del.textContent = "Delete";
+      del.onclick = function () {
+        call("DELETE", "/api/playlist?name=" + encodeURIComponent(n)).then(loadPlaylists);
+      };
+      var play = document.createElement("button");
+      play.textContent = "Cast";
+      play.onclick = function () {
+        call("POST", "/api/cast", { Target: $("cast-target").value, Playlist: n });
+      };
+      li.appendChild(a);
+      li.appendChild(document.createTextNode(" "));
+      li.appendChild(play);
+      li.appendChild(del);
+      ul.appendChild(li);
+    });
+  });
+}
+
+function loadPlaylist(name) {
+  call("GET", "/api/playlist?name=" + encodeURIComponent(name)).then(function (files) {
+    var t = $("playlist-songs");
+    t.innerHTML = "";
+    row(t, ["Artist", "Album", "Song"], true);
+    (files || []).forEach(function (f) {
+      row(t, [f.Artist, f.Album, f.Title]);
+    });
+  });
+}
+
+$("playlist-form").onsubmit = function (ev) {
+  ev.preventDefault();
+  call("POST", "/api/playlists", { Playlist: this.elements.name.value }).then(loadPlaylists);
+};
+
+$("description-form").onsubmit = function (ev) {
+  ev.preventDefault();
+  call("GET", "/api/description?" + query(this)).then(function (data) {
+    $("description-data").value = data || "";
+  });
+};
+
+$("description-save").onclick = function () {
+  var q = query($("description-form"));
+  call("PUT", "/api/description?" + q, $("description-data").value);
+};
+
+function loadStatus() {
+  call("GET", "/api/status").then(function (data) {
+    $("status-data").textContent = data || "";
+  });
+}
+
+$("scan").onclick = function () {
+  call("POST", "/api/scan").then(loadStatus);
+};
+
+setInterval(function () {
+  if ($("status").className === "active") { loadStatus(); }
+}, 5000);
+
+document.querySelectorAll("nav a").forEach(function (a) {
+  a.onclick = function () { show(a.getAttribute("data-tab")); };
+});
+show("search");
+loadTargets();
+</script>
+</body>
+</html>
+`
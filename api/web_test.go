@@ -0,0 +1,60 @@
+// Copyright 2016 Danko Miocevic. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Author: Danko Miocevic
+
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestCheckSameSite(t *testing.T) {
+	tests := []struct {
+		name        string
+		method      string
+		origin      string
+		contentType string
+		status      int
+	}{
+		{"get", http.MethodGet, "http://evil.example", "", 0},
+		{"head", http.MethodHead, "", "", 0},
+		{"same origin", http.MethodPost, "http://muli.example:8080", "application/json", 0},
+		{"no origin", http.MethodPost, "", "application/json; charset=utf-8", 0},
+		{"other origin", http.MethodPost, "http://evil.example", "application/json", http.StatusForbidden},
+		{"other port", http.MethodPost, "http://muli.example:9090", "application/json", http.StatusForbidden},
+		{"null origin", http.MethodPost, "null", "application/json", http.StatusForbidden},
+		{"form", http.MethodPost, "", "application/x-www-form-urlencoded", http.StatusUnsupportedMediaType},
+		{"text", http.MethodPost, "http://muli.example:8080", "text/plain", http.StatusUnsupportedMediaType},
+		{"no type", http.MethodPost, "", "", http.StatusUnsupportedMediaType},
+		{"delete", http.MethodDelete, "http://evil.example", "", http.StatusForbidden},
+	}
+
+	for _, test := range tests {
+		r := httptest.NewRequest(test.method, "http://muli.example:8080/api/songs", nil)
+		if len(test.origin) > 0 {
+			r.Header.Set("Origin", test.origin)
+		}
+		if len(test.contentType) > 0 {
+			r.Header.Set("Content-Type", test.contentType)
+		}
+
+		status, err := checkSameSite(r)
+		if status != test.status || (err != nil) != (test.status != 0) {
+			t.Errorf("checkSameSite(%s) = %d, %v, want %d", test.name, status, err, test.status)
+		}
+	}
+}
@@ -0,0 +1,126 @@
+// Copyright 2016 Danko Miocevic. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Author: Danko Miocevic
+
+package main
+
+import (
+	"github.com/dankomiocevic/mulifs/store"
+	"strings"
+
+	"bazil.org/fuse"
+	"bazil.org/fuse/fs"
+	"golang.org/x/net/context"
+)
+
+// artistsViewDir is the view with the Artists grouped
+// in Directories by the first letters of their names,
+// for the players with slow Directory listings.
+const artistsViewDir = "artists"
+
+// otherArtistsBucket is the Directory of the Artists
+// whose names do not start with a letter.
+const otherArtistsBucket = "#"
+
+// registerArtistsView adds the artists view to the
+// root Directory when the artist_index option is set.
+func registerArtistsView() {
+	if config_params.artist_index > 0 {
+		views[artistsViewDir] = view{list: listArtistsView, lookup: lookupArtistsView}
+	}
+}
+
+// artistBucket returns the Directory of an Artist in
+// the artists view: the first artist_index letters of
+// its name, the first one in upper case.
+func artistBucket(name string) string {
+	if len(name) < 1 || !strings.ContainsRune("abcdefghijklmnopqrstuvwxyz", rune(strings.ToLower(name)[0])) {
+		return otherArtistsBucket
+	}
+
+	if len(name) > config_params.artist_index {
+		name = name[:config_params.artist_index]
+	}
+	return strings.ToUpper(name[:1]) + strings.ToLower(name[1:])
+}
+
+// listArtistDirs returns the Artist Directories
+// of the Library, without the other entries.
+func listArtistDirs() ([]string, error) {
+	artists, err := store.ListArtists()
+	if err != nil {
+		return nil, err
+	}
+
+	var a []string
+	for _, artist := range artists {
+		if artist.Type == fuse.DT_Dir {
+			a = append(a, artist.Name)
+		}
+	}
+	return a, nil
+}
+
+// listArtistsView lists the Directories of the
+// first letters or the Artists inside one of them.
+func listArtistsView(ctx context.Context, d *Dir) ([]fuse.Dirent, error) {
+	artists, err := listArtistDirs()
+	if err != nil {
+		return nil, fuse.ENOENT
+	}
+
+	var a []fuse.Dirent
+	seen := make(map[string]bool)
+	for _, artist := range artists {
+		bucket := artistBucket(artist)
+		if len(d.album) < 1 {
+			if !seen[bucket] {
+				seen[bucket] = true
+				a = append(a, fuse.Dirent{Name: bucket, Type: fuse.DT_Dir})
+			}
+		} else if bucket == d.album {
+			a = append(a, fuse.Dirent{Name: artist, Type: fuse.DT_Dir})
+		}
+	}
+	return a, nil
+}
+
+// lookupArtistsView returns the Directories of the first
+// letters, the Artists inside them are the real Artist
+// Directories in the Library.
+func lookupArtistsView(ctx context.Context, d *Dir, name string) (fs.Node, error) {
+	if len(d.album) < 1 {
+		artists, err := listArtistDirs()
+		if err != nil {
+			return nil, fuse.ENOENT
+		}
+
+		for _, artist := range artists {
+			if artistBucket(artist) == name {
+				return &Dir{fs: d.fs, artist: d.artist, album: name, mPoint: d.mPoint}, nil
+			}
+		}
+		return nil, fuse.ENOENT
+	}
+
+	if artistBucket(name) != d.album {
+		return nil, fuse.ENOENT
+	}
+
+	if _, err := store.GetArtistPath(name); err != nil {
+		return nil, fuse.ENOENT
+	}
+	return &Dir{fs: d.fs, artist: name, mPoint: d.mPoint}, nil
+}
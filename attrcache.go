@@ -0,0 +1,144 @@
+// Copyright 2016 Danko Miocevic. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Author: Danko Miocevic
+
+package main
+
+import (
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dankomiocevic/mulifs/store"
+	"github.com/golang/glog"
+)
+
+// attrCacheTime is how long the attributes prefetched
+// when listing a Directory are used.
+const attrCacheTime = 10 * time.Second
+
+// cachedSong keeps the path and the status
+// of the file of a Song.
+type cachedSong struct {
+	path    string
+	info    os.FileInfo
+	track   bool
+	expires time.Time
+}
+
+// attrCache keeps the Songs of the playlists and Albums
+// listed recently, so the Lookup and Attr requests sent for
+// every entry after a listing do not read the database
+// and the disk again.
+var attrCache = struct {
+	sync.Mutex
+	m map[string]cachedSong
+}{m: make(map[string]cachedSong)}
+
+// attrKey returns the key of a Song in the cache.
+func attrKey(artist, album, name string) string {
+	return artist + "/" + album + "/" + name
+}
+
+// prefetchAttrs reads the Songs of the playlist or Album
+// Directory in one database transaction and keeps the
+// status of their files in the cache.
+func (d *Dir) prefetchAttrs() {
+	var files []store.SongFile
+	var err error
+	if d.artist == "playlists" && len(d.album) > 0 {
+		files, err = store.ListPlaylistSongFiles(d.album)
+	} else if d.isAlbumDir() {
+		files, err = store.ListAlbumSongFiles(d.artist, d.album)
+	} else {
+		return
+	}
+
+	if err != nil {
+		glog.Infof("Cannot prefetch the attributes of %s/%s: %s\n", d.artist, d.album, err)
+		return
+	}
+
+	songs := make(map[string]cachedSong, len(files))
+	for _, f := range files {
+		fi, err := os.Stat(f.Path)
+		if err != nil || fi.IsDir() {
+			continue
+		}
+		songs[attrKey(d.artist, d.album, f.Name)] = cachedSong{path: f.Path, info: fi, track: f.Track}
+	}
+
+	now := time.Now()
+	expires := now.Add(attrCacheTime)
+	attrCache.Lock()
+	defer attrCache.Unlock()
+	for k, v := range attrCache.m {
+		if now.After(v.expires) {
+			delete(attrCache.m, k)
+		}
+	}
+	for k, v := range songs {
+		v.expires = expires
+		attrCache.m[k] = v
+	}
+}
+
+// cachedAttrs returns the Song from the cache if
+// it was prefetched recently.
+func cachedAttrs(artist, album, name string) (cachedSong, bool) {
+	attrCache.Lock()
+	defer attrCache.Unlock()
+	s, ok := attrCache.m[attrKey(artist, album, name)]
+	if !ok || time.Now().After(s.expires) {
+		return cachedSong{}, false
+	}
+	return s, true
+}
+
+// forgetAttrs removes the Songs of a Directory from the
+// cache after they are changed.
+func forgetAttrs(artist, album string) {
+	prefix := attrKey(artist, album, "")
+	attrCache.Lock()
+	defer attrCache.Unlock()
+	for k := range attrCache.m {
+		if strings.HasPrefix(k, prefix) {
+			delete(attrCache.m, k)
+		}
+	}
+}
+
+// cachedAttr returns the prefetched status of the file of
+// the Song, the Songs being written are never cached.
+func (f *File) cachedAttr() (cachedSong, bool) {
+	if f.isDropped() {
+		return cachedSong{}, false
+	}
+
+	c, ok := cachedAttrs(f.artist, f.album, f.name)
+	if !ok {
+		return c, false
+	}
+
+	if _, ok := getWriteBuffer(c.path); ok {
+		return cachedSong{}, false
+	}
+
+	if f.artist == "playlists" {
+		PushFileItem(*f, nil)
+	}
+	return c, true
+}
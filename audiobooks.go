@@ -0,0 +1,281 @@
+// Copyright 2016 Danko Miocevic. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Author: Danko Miocevic
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/dankomiocevic/mulifs/musicmgr"
+	"github.com/dankomiocevic/mulifs/store"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"bazil.org/fuse"
+	"bazil.org/fuse/fs"
+	"github.com/golang/glog"
+	"golang.org/x/net/context"
+)
+
+// positionFileName is the read only file inside every
+// audiobook that shows how far it was listened.
+const positionFileName = ".position"
+
+// defaultAudiobookGenres are the genres of
+// the audiobooks by default.
+const defaultAudiobookGenres = "Audiobook;Audiobooks;Spoken Word;Speech"
+
+// registerAudiobooksView adds the audiobooks view
+// to the root Directory when it is enabled.
+func registerAudiobooksView() {
+	if config_params.audiobooks {
+		views["audiobooks"] = view{list: listAudiobooksView, lookup: lookupAudiobooksView}
+	}
+}
+
+// isAudiobookGenre returns true if the
+// genre is one of the audiobook genres.
+func isAudiobookGenre(genre string) bool {
+	return matchGenre(config_params.audiobook_genres, genre)
+}
+
+// naturalLess compares two names sorting the
+// numbers inside them by their value, so the
+// chapter 2 is before the chapter 10.
+func naturalLess(a, b string) bool {
+	for len(a) > 0 && len(b) > 0 {
+		if isDigit(a[0]) && isDigit(b[0]) {
+			na, nb := digitsLen(a), digitsLen(b)
+			x := strings.TrimLeft(a[:na], "0")
+			y := strings.TrimLeft(b[:nb], "0")
+			if len(x) != len(y) {
+				return len(x) < len(y)
+			}
+			if x != y {
+				return x < y
+			}
+			a, b = a[na:], b[nb:]
+			continue
+		}
+
+		if a[0] != b[0] {
+			return a[0] < b[0]
+		}
+		a, b = a[1:], b[1:]
+	}
+	return len(a) < len(b)
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+// digitsLen returns the amount of
+// digits at the start of the string.
+func digitsLen(s string) int {
+	n := 0
+	for n < len(s) && isDigit(s[n]) {
+		n++
+	}
+	return n
+}
+
+// chapterName returns the name of a chapter in the
+// audiobooks view, it starts with the chapter number.
+func chapterName(i int, song string) string {
+	return fmt.Sprintf("%03d - %s", i+1, song)
+}
+
+// listChapters returns the Songs of an audiobook
+// sorted by their chapter numbers.
+func listChapters(artist, album string) ([]string, error) {
+	a, err := store.ListSongs(artist, album)
+	if err != nil {
+		return nil, err
+	}
+
+	var chapters []string
+	for _, s := range a {
+		if s.Name[0] != '.' && musicmgr.IsMusicFile(s.Name) {
+			chapters = append(chapters, s.Name)
+		}
+	}
+	sort.Slice(chapters, func(i, j int) bool {
+		return naturalLess(chapters[i], chapters[j])
+	})
+	return chapters, nil
+}
+
+// isAudiobook returns true if the Album is an audiobook,
+// its first chapter has one of the audiobook genres.
+func isAudiobook(artist, album string) bool {
+	chapters, err := listChapters(artist, album)
+	if err != nil || len(chapters) < 1 {
+		return false
+	}
+
+	song, err := store.GetSong(artist, album, chapters[0])
+	if err != nil {
+		return false
+	}
+	return isAudiobookGenre(song.Genre)
+}
+
+// listAudiobooksView lists the audiobooks in the
+// Library or the chapters of one of them.
+func listAudiobooksView(ctx context.Context, d *Dir) ([]fuse.Dirent, error) {
+	if len(d.album) < 1 {
+		songs, err := store.ListSongInfo()
+		if err != nil {
+			return nil, fuse.EIO
+		}
+
+		var a []fuse.Dirent
+		seen := make(map[string]bool)
+		for _, s := range songs {
+			name := albumViewName(s.Artist, s.Album)
+			if seen[name] || !isAudiobookGenre(s.Genre) {
+				continue
+			}
+			seen[name] = true
+			a = append(a, fuse.Dirent{Name: name, Type: fuse.DT_Dir})
+		}
+		return a, nil
+	}
+
+	items := strings.SplitN(d.album, " - ", 2)
+	if len(items) != 2 {
+		return nil, fuse.ENOENT
+	}
+
+	chapters, err := listChapters(items[0], items[1])
+	if err != nil {
+		return nil, fuse.ENOENT
+	}
+
+	var a []fuse.Dirent
+	for i, song := range chapters {
+		a = append(a, fuse.Dirent{Name: chapterName(i, song), Type: fuse.DT_File})
+	}
+	a = append(a, fuse.Dirent{Name: positionFileName, Type: fuse.DT_File})
+	a = append(a, listSidecars(items[0], items[1])...)
+	return a, nil
+}
+
+// lookupAudiobooksView returns the audiobook Directories,
+// their chapters and their position files.
+func lookupAudiobooksView(ctx context.Context, d *Dir, name string) (fs.Node, error) {
+	if len(d.album) < 1 {
+		items := strings.SplitN(name, " - ", 2)
+		if len(items) != 2 || !isAudiobook(items[0], items[1]) {
+			return nil, fuse.ENOENT
+		}
+		return &Dir{fs: d.fs, artist: d.artist, album: name, mPoint: d.mPoint}, nil
+	}
+
+	items := strings.SplitN(d.album, " - ", 2)
+	if len(items) != 2 {
+		return nil, fuse.ENOENT
+	}
+
+	if name == positionFileName {
+		return &File{artist: items[0], album: items[1], song: name, name: name, mPoint: d.mPoint}, nil
+	}
+
+	if !musicmgr.IsMusicFile(name) {
+		return sidecarFile(d, items[0], items[1], name)
+	}
+
+	chapters, err := listChapters(items[0], items[1])
+	if err != nil {
+		return nil, fuse.ENOENT
+	}
+
+	for i, song := range chapters {
+		if chapterName(i, song) == name {
+			return songFile(d, items[0], items[1], song)
+		}
+	}
+	return nil, fuse.ENOENT
+}
+
+// isPositionFile returns true if the File is
+// the position file of an audiobook.
+func (f *File) isPositionFile() bool {
+	return f.name == positionFileName && len(f.album) > 0 && f.policy == policyNone
+}
+
+// bookPosition returns the contents of the position
+// file, with the chapter and the offset where the
+// audiobook was left and the progress of the book.
+func bookPosition(artist, album string) []byte {
+	position, err := store.GetBookPosition(artist, album)
+	if err != nil {
+		return []byte("Not started\n")
+	}
+
+	chapters, _ := listChapters(artist, album)
+	var read, total int64
+	chapter := position.Song
+	for i, song := range chapters {
+		var size int64
+		if path, err := store.GetFilePath(artist, album, song); err == nil {
+			if fi, err := os.Stat(path); err == nil {
+				size = fi.Size()
+			}
+		}
+
+		if song == position.Song {
+			chapter = chapterName(i, song)
+			read = total + position.Offset
+		}
+		total += size
+	}
+
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "Chapter: %s\n", chapter)
+	fmt.Fprintf(&b, "Offset: %d\n", position.Offset)
+	if total > 0 {
+		fmt.Fprintf(&b, "Progress: %d%%\n", read*100/total)
+	}
+	fmt.Fprintf(&b, "Updated: %s\n", position.Time.Format(time.RFC3339))
+	return b.Bytes()
+}
+
+// recordPosition stores the end of the data read from
+// the Song as the position of the audiobook.
+// It must be called before the handle is closed.
+func (fh *FileHandle) recordPosition() {
+	if !config_params.audiobooks {
+		return
+	}
+
+	fh.mu.Lock()
+	offset := fh.readEnd
+	dirty := fh.dirty
+	fh.mu.Unlock()
+	if offset < 1 || dirty || !isAudiobook(fh.f.artist, fh.f.album) {
+		return
+	}
+
+	position := store.BookPosition{Song: fh.f.name, Offset: offset, Time: time.Now()}
+	err := store.SetBookPosition(fh.f.artist, fh.f.album, position)
+	if err != nil {
+		glog.Errorf("Cannot store the position of %s: %s\n", fh.f.album, err)
+	}
+}
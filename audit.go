@@ -0,0 +1,102 @@
+// Copyright 2016 Danko Miocevic. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Author: Danko Miocevic
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/dankomiocevic/mulifs/store"
+	"strings"
+	"time"
+
+	"bazil.org/fuse"
+	"github.com/golang/glog"
+)
+
+// auditFileName is the read only file in the .mulifs
+// Directory with the operations that changed the Library.
+const auditFileName = "audit.log"
+
+// isAuditFile returns true if the File is the audit log.
+func (f *File) isAuditFile() bool {
+	return f.artist == mulifsDirName && len(f.album) < 1 && f.name == auditFileName
+}
+
+// auditLog returns the contents of the audit log, one
+// operation per line with the time, the user and the
+// paths, the renamed paths are separated by an arrow.
+func auditLog() []byte {
+	var b bytes.Buffer
+	entries, err := store.ListAudit()
+	if err != nil {
+		glog.Errorf("Cannot read the audit log: %s\n", err)
+		return b.Bytes()
+	}
+
+	for _, e := range entries {
+		fmt.Fprintf(&b, "%s uid=%d %s %s\n", e.Time.Format(time.RFC3339),
+			e.Uid, e.Op, strings.Join(e.Paths, " -> "))
+	}
+	return b.Bytes()
+}
+
+// audit records the operation made by the user of the
+// request in the audit log, notifies the webhooks and
+// updates the mirror Directory, the paths are relative
+// to the root of MuLi. The failed operations are not recorded.
+func audit(header fuse.Header, op string, err error, paths ...string) {
+	if err != nil {
+		return
+	}
+
+	scheduleMirror()
+	if !config_params.audit && len(config_params.webhooks) < 1 {
+		return
+	}
+
+	entry := store.AuditEntry{Time: time.Now(), Uid: header.Uid, Op: op}
+	for _, p := range paths {
+		if len(p) > 0 {
+			entry.Paths = append(entry.Paths, "/"+p)
+		}
+	}
+
+	notifyWebhooks(entry)
+	if !config_params.audit {
+		return
+	}
+
+	if err := store.AppendAudit(entry); err != nil {
+		glog.Errorf("Cannot write the audit log: %s\n", err)
+	}
+}
+
+// auditPath returns the path of the entry
+// inside the Directory used in the audit log.
+func (d *Dir) auditPath(name string) string {
+	return entryPath(d.artist, d.album, name)
+}
+
+// auditOp returns the operation recorded in the audit
+// log, the changes inside the playlists Directory are
+// recorded as playlist changes.
+func (d *Dir) auditOp(op string) string {
+	if d.artist == "playlists" {
+		return "playlist"
+	}
+	return op
+}
@@ -0,0 +1,183 @@
+// Copyright 2016 Danko Miocevic. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Author: Danko Miocevic
+
+package main
+
+import (
+	"github.com/dankomiocevic/mulifs/store"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/golang/glog"
+)
+
+// autoPlaylistsItem is the name of the dispatcher item
+// that regenerates the auto playlists, the changes to the
+// Library are grouped until it times out.
+const autoPlaylistsItem = ".auto-playlists"
+
+// genrePlaylistPrefix is the prefix of the playlists
+// generated for every genre.
+const genrePlaylistPrefix = store.AutoPlaylistPrefix + "genre-"
+
+// genrePlaylists groups the Songs by genre in
+// the auto-genre-<genre> playlists.
+func genrePlaylists(songs []store.SongInfo, playlists map[string][]store.SongInfo) {
+	for _, s := range songs {
+		genre := strings.TrimSpace(s.Genre)
+		if len(genre) < 1 {
+			continue
+		}
+
+		name := genrePlaylistPrefix + store.GetCompatibleString(genre)
+		playlists[name] = append(playlists[name], s)
+	}
+}
+
+// decadePlaylists groups the Songs by the decade
+// of their year in the auto-<decade>s playlists.
+func decadePlaylists(songs []store.SongInfo, playlists map[string][]store.SongInfo) {
+	for _, s := range songs {
+		// The year can be a full date, like 1985-04-12.
+		year := strings.TrimSpace(s.Year)
+		if len(year) < 4 {
+			continue
+		}
+
+		n, err := strconv.Atoi(year[:4])
+		if err != nil || n < 1 {
+			continue
+		}
+
+		name := store.AutoPlaylistPrefix + strconv.Itoa(n/10*10) + "s"
+		playlists[name] = append(playlists[name], s)
+	}
+}
+
+// mostPlayedPlaylist is the name of the playlist
+// with the most played Songs.
+const mostPlayedPlaylist = store.AutoPlaylistPrefix + "most-played"
+
+// mostPlayedRefresh is how often the most played playlist
+// is regenerated, so the old plays leave the window.
+const mostPlayedRefresh = time.Hour
+
+// mostPlayedPlaylists adds the most_played Songs with
+// more plays in the last most_played_days days to the
+// auto-most-played playlist.
+func mostPlayedPlaylists(songs []store.SongInfo, playlists map[string][]store.SongInfo) error {
+	var since time.Time
+	if config_params.most_played_days > 0 {
+		since = time.Now().AddDate(0, 0, -config_params.most_played_days)
+	}
+
+	plays, err := store.ListPlays(since)
+	if err != nil {
+		return err
+	}
+
+	counts := make(map[store.SongRef]int)
+	for _, p := range plays {
+		counts[p.SongRef]++
+	}
+
+	// Only the Songs still in the Library are added.
+	var played []store.SongInfo
+	for _, s := range songs {
+		if counts[s.SongRef] > 0 {
+			played = append(played, s)
+		}
+	}
+
+	sort.SliceStable(played, func(i, j int) bool {
+		return counts[played[i].SongRef] > counts[played[j].SongRef]
+	})
+
+	if len(played) > config_params.most_played {
+		played = played[:config_params.most_played]
+	}
+
+	if len(played) > 0 {
+		playlists[mostPlayedPlaylist] = played
+	}
+	return nil
+}
+
+// autoPlaylistsEnabled returns true if
+// any of the auto playlists is enabled.
+func autoPlaylistsEnabled() bool {
+	return config_params.genre_playlists || config_params.decade_playlists || config_params.most_played > 0
+}
+
+// regenerateAutoPlaylists generates all the enabled auto
+// playlists from the Songs in the Library. The auto playlists
+// that are disabled are deleted.
+func regenerateAutoPlaylists(mPoint string) error {
+	playlists := make(map[string][]store.SongInfo)
+	if autoPlaylistsEnabled() {
+		songs, err := store.ListSongInfo()
+		if err != nil {
+			glog.Errorf("Cannot list the Songs: %s\n", err)
+			return err
+		}
+
+		if config_params.genre_playlists {
+			genrePlaylists(songs, playlists)
+		}
+		if config_params.decade_playlists {
+			decadePlaylists(songs, playlists)
+		}
+		if config_params.most_played > 0 {
+			err = mostPlayedPlaylists(songs, playlists)
+			if err != nil {
+				glog.Errorf("Cannot read the play statistics: %s\n", err)
+				return err
+			}
+		}
+	}
+	return store.SyncAutoPlaylists(playlists, mPoint)
+}
+
+// scheduleAutoPlaylists regenerates the auto playlists
+// in background after the Library is modified.
+func scheduleAutoPlaylists(mPoint string) {
+	if !autoPlaylistsEnabled() {
+		return
+	}
+
+	// It runs in a goroutine because it can be called from
+	// the dispatcher loop, that would block on PushFileItem.
+	go PushFileItem(File{name: autoPlaylistsItem, mPoint: mPoint}, func(f File) error {
+		return regenerateAutoPlaylists(f.mPoint)
+	})
+}
+
+// startAutoPlaylistsTimer regenerates the auto playlists
+// periodically when the most played playlist uses a
+// rolling window.
+func startAutoPlaylistsTimer(mPoint string) {
+	if config_params.most_played < 1 || config_params.most_played_days < 1 {
+		return
+	}
+
+	go func() {
+		for range time.Tick(mostPlayedRefresh) {
+			scheduleAutoPlaylists(mPoint)
+		}
+	}()
+}
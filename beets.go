@@ -0,0 +1,59 @@
+// Copyright 2016 Danko Miocevic. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Author: Danko Miocevic
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"github.com/dankomiocevic/mulifs/store"
+	"github.com/dankomiocevic/mulifs/tools"
+	"log"
+	"os"
+)
+
+// runImportBeets runs the import-beets command, it stores
+// the Songs of a beets library with the tags, MusicBrainz
+// identifiers and cover images stored in its database.
+func runImportBeets(db_path string, args []string) {
+	flags := flag.NewFlagSet("import-beets", flag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage:\n  %s [global_options] import-beets BEETS_LIBRARY\n", progName)
+	}
+	flags.Parse(args)
+
+	if flags.NArg() != 1 {
+		flags.Usage()
+		os.Exit(2)
+	}
+
+	err := store.InitDB(db_path)
+	if err != nil {
+		log.Fatal(err)
+		os.Exit(5)
+	}
+
+	stats, err := tools.ImportBeetsLibrary(flags.Arg(0))
+	if err != nil {
+		log.Fatal(err)
+		os.Exit(20)
+	}
+
+	for _, path := range stats.Missing {
+		log.Printf("Song not imported: %s\n", path)
+	}
+	log.Printf("%d Songs and %d covers imported, %d not imported\n", stats.Songs, stats.Covers, len(stats.Missing))
+}
@@ -0,0 +1,102 @@
+// Copyright 2016 Danko Miocevic. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Author: Danko Miocevic
+package main
+
+import (
+	"runtime"
+	"sync"
+
+	"bazil.org/fuse"
+	"bazil.org/fuse/fs"
+	"github.com/golang/glog"
+)
+
+// fsServer is the server of the mounted filesystem,
+// it is used to invalidate the data cached by the kernel.
+var fsServer *fs.Server
+
+// openFlags returns the flags set on every opened file.
+// If the kernel_cache option is set the kernel keeps the
+// file data between opens, otherwise the data is not cached
+// on macOS.
+func openFlags() fuse.OpenResponseFlags {
+	if config_params.kernel_cache {
+		return fuse.OpenKeepCache
+	}
+	if runtime.GOOS == "darwin" {
+		return fuse.OpenDirectIO
+	}
+	return 0
+}
+
+// invalidateFile tells the kernel to drop the cached data
+// and attributes of a File after it is changed by MuLi,
+// for example when the tags are written.
+// The invalidation runs in background because the kernel
+// may wait for the current request to finish.
+func invalidateFile(f *File) {
+	if !config_params.kernel_cache || fsServer == nil {
+		return
+	}
+
+	go func() {
+		err := fsServer.InvalidateNodeData(f)
+		if err != nil && err != fuse.ErrNotCached {
+			glog.Errorf("Cannot invalidate the data of %s: %v\n", f.name, err)
+		}
+
+		err = fsServer.InvalidateNodeAttr(f)
+		if err != nil && err != fuse.ErrNotCached {
+			glog.Errorf("Cannot invalidate the attributes of %s: %v\n", f.name, err)
+		}
+	}()
+}
+
+// cachedFiles are the Files opened while the kernel_cache
+// option is set, indexed by the path of their Song. The
+// store tells which Songs are changed and their Files
+// are invalidated.
+var cachedFiles = struct {
+	sync.Mutex
+	files map[string]*File
+}{files: make(map[string]*File)}
+
+// keepCached remembers the File opened on the path of a Song.
+func keepCached(path string, f *File) {
+	if !config_params.kernel_cache {
+		return
+	}
+
+	cachedFiles.Lock()
+	cachedFiles.files[path] = f
+	cachedFiles.Unlock()
+}
+
+// invalidateSong invalidates the File opened on the path
+// of a Song, it is called by the store after the tags are
+// written or the Song is moved, from the Directories,
+// the .tracks files, the retag command or the APIs.
+// The File is opened again to be cached, it is forgotten.
+func invalidateSong(path string) {
+	cachedFiles.Lock()
+	f, ok := cachedFiles.files[path]
+	delete(cachedFiles.files, path)
+	cachedFiles.Unlock()
+
+	if ok {
+		invalidateFile(f)
+	}
+}
@@ -0,0 +1,71 @@
+// Copyright 2016 Danko Miocevic. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Author: Danko Miocevic
+
+package main
+
+import (
+	"errors"
+	"github.com/dankomiocevic/mulifs/api"
+	"github.com/dankomiocevic/mulifs/cast"
+	"github.com/dankomiocevic/mulifs/store"
+	"strings"
+)
+
+// castTargets maps the names of the devices where
+// the Songs are cast to their kind and address.
+var castTargets = map[string]cast.Target{}
+
+// setCastTargets sets the devices from the
+// NAME=KIND:HOST items of the cast_targets option.
+func setCastTargets() error {
+	for _, item := range config_params.cast_targets {
+		items := strings.SplitN(item, "=", 2)
+		if len(items) != 2 || len(strings.TrimSpace(items[0])) < 1 {
+			return errors.New("Error in cast_targets, it must be NAME=KIND:HOST")
+		}
+
+		target, err := cast.ParseTarget(items[1])
+		if err != nil {
+			return errors.New("Error in cast_targets, the kind must be chromecast or airplay")
+		}
+		castTargets[strings.TrimSpace(items[0])] = target
+	}
+	return nil
+}
+
+// castURL returns the URL of the web interface used by the
+// cast targets, by default it is the address of the web option.
+func castURL() string {
+	if len(config_params.cast_url) > 0 || len(config_params.web) < 1 {
+		return config_params.cast_url
+	}
+	return "http://" + config_params.web
+}
+
+// runCastCommand plays a playlist or a Song written
+// as Artist/Album/Song on the cast target.
+func runCastCommand(fields []string, mPoint string) error {
+	if len(fields) != 3 {
+		return errors.New("Wrong number of arguments.")
+	}
+
+	args := api.CastArgs{Target: fields[1], Playlist: fields[2]}
+	if items := strings.Split(fields[2], "/"); len(items) == 3 {
+		args.Playlist = ""
+		args.Song = store.SongRef{Artist: items[0], Album: items[1], Song: items[2]}
+	}
+	return newLibrary(mPoint).Cast(args, &api.Empty{})
+}
@@ -0,0 +1,57 @@
+// Copyright 2016 Danko Miocevic. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Author: Danko Miocevic
+
+package cast
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// airPlayPort is the default port of the AirPlay devices.
+const airPlayPort = "7000"
+
+// playAirPlay sends the Song to an AirPlay device with the
+// play request, it only plays one URL so the devices cannot
+// receive a list of Songs. The devices that require pairing
+// are not supported.
+func playAirPlay(addr string, songs []Media) error {
+	if len(songs) != 1 {
+		return errors.New("The AirPlay targets only play one Song.")
+	}
+
+	body := fmt.Sprintf("Content-Location: %s\nStart-Position: 0\n", songs[0].URL)
+	req, err := http.NewRequest("POST", "http://"+withPort(addr, airPlayPort)+"/play", strings.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "text/parameters")
+	req.Header.Set("User-Agent", "MediaControl/1.0")
+
+	client := http.Client{Timeout: timeout}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return errors.New("The AirPlay target answered " + resp.Status + ".")
+	}
+	return nil
+}
@@ -0,0 +1,117 @@
+// Copyright 2016 Danko Miocevic. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Author: Danko Miocevic
+
+// Package cast sends Songs served over HTTP to the
+// Chromecast and AirPlay devices of the network.
+package cast
+
+import (
+	"errors"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// The kinds of devices that can play the Songs.
+const (
+	// Chromecast is a Google Cast device, the Songs
+	// are played by its default media receiver.
+	Chromecast = "chromecast"
+	// AirPlay is an AirPlay device that accepts
+	// the URL of the media to play.
+	AirPlay = "airplay"
+)
+
+// timeout is the maximum time to wait
+// for the devices to answer.
+const timeout = 10 * time.Second
+
+// Target is a device that plays the Songs, Addr
+// is its host with an optional port.
+type Target struct {
+	Kind string
+	Addr string
+}
+
+// Media is a Song sent to a device, URL is where
+// the device downloads it from.
+type Media struct {
+	URL         string
+	ContentType string
+	Title       string
+	Artist      string
+	Album       string
+}
+
+// ParseTarget parses a target written as KIND:HOST[:PORT].
+func ParseTarget(s string) (Target, error) {
+	items := strings.SplitN(strings.TrimSpace(s), ":", 2)
+	if len(items) != 2 || len(items[1]) < 1 {
+		return Target{}, errors.New("The target must be KIND:HOST.")
+	}
+
+	kind := strings.ToLower(items[0])
+	if kind != Chromecast && kind != AirPlay {
+		return Target{}, errors.New("The kind of target must be chromecast or airplay.")
+	}
+	return Target{Kind: kind, Addr: items[1]}, nil
+}
+
+// Play sends the Songs to the target, they are played in
+// order replacing what the device was playing.
+func Play(t Target, songs []Media) error {
+	if len(songs) < 1 {
+		return errors.New("There are no Songs to play.")
+	}
+
+	switch t.Kind {
+	case Chromecast:
+		return playChromecast(t.Addr, songs)
+	case AirPlay:
+		return playAirPlay(t.Addr, songs)
+	}
+	return errors.New("Unknown kind of target.")
+}
+
+// ContentType returns the MIME type of the music file.
+func ContentType(name string) string {
+	switch strings.ToLower(filepath.Ext(name)) {
+	case ".mp3":
+		return "audio/mpeg"
+	case ".flac":
+		return "audio/flac"
+	case ".wav":
+		return "audio/wav"
+	case ".aif", ".aiff":
+		return "audio/aiff"
+	case ".wma":
+		return "audio/x-ms-wma"
+	case ".m4a":
+		return "audio/mp4"
+	case ".ogg":
+		return "audio/ogg"
+	}
+	return "application/octet-stream"
+}
+
+// withPort adds the port to the address
+// if it does not have one.
+func withPort(addr, port string) string {
+	if strings.LastIndex(addr, ":") > strings.LastIndex(addr, "]") {
+		return addr
+	}
+	return addr + ":" + port
+}
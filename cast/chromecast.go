@@ -0,0 +1,318 @@
+// Copyright 2016 Danko Miocevic. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Author: Danko Miocevic
+
+package cast
+
+import (
+	"crypto/tls"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"time"
+)
+
+// chromecastPort is the default port of the Chromecast devices.
+const chromecastPort = "8009"
+
+// defaultReceiver is the application of the
+// Chromecast devices that plays the media URLs.
+const defaultReceiver = "CC1AD845"
+
+// The namespaces of the messages sent to the devices.
+const (
+	nsConnection = "urn:x-cast:com.google.cast.tp.connection"
+	nsHeartbeat  = "urn:x-cast:com.google.cast.tp.heartbeat"
+	nsReceiver   = "urn:x-cast:com.google.cast.receiver"
+	nsMedia      = "urn:x-cast:com.google.cast.media"
+)
+
+// The identifiers of MuLi and the device.
+const (
+	senderID   = "sender-0"
+	receiverID = "receiver-0"
+)
+
+// maxMessageSize is the size of the biggest
+// message accepted from the devices.
+const maxMessageSize = 64 * 1024
+
+var errBadMessage = errors.New("Wrong message from the Chromecast target.")
+
+// castMessage is the CastMessage protocol buffer used by the
+// devices, the payload is always a JSON object.
+type castMessage struct {
+	source      string
+	destination string
+	namespace   string
+	payload     string
+}
+
+// castReply has the fields of the payloads
+// received that are used by MuLi.
+type castReply struct {
+	Type      string          `json:"type"`
+	RequestID int             `json:"requestId"`
+	Reason    string          `json:"reason"`
+	Status    json.RawMessage `json:"status"`
+}
+
+// receiverStatus is the status of the device, with
+// the applications that are running on it.
+type receiverStatus struct {
+	Applications []struct {
+		AppID       string `json:"appId"`
+		TransportID string `json:"transportId"`
+	} `json:"applications"`
+}
+
+// castConn is a connection to a Chromecast device.
+type castConn struct {
+	conn      net.Conn
+	requestID int
+}
+
+// playChromecast launches the default media receiver on the
+// Chromecast device and loads the Songs in its queue.
+func playChromecast(addr string, songs []Media) error {
+	// The devices use self signed certificates.
+	conn, err := tls.DialWithDialer(&net.Dialer{Timeout: timeout}, "tcp",
+		withPort(addr, chromecastPort), &tls.Config{InsecureSkipVerify: true})
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	c := &castConn{conn: conn}
+	err = c.send(receiverID, nsConnection, map[string]interface{}{"type": "CONNECT"})
+	if err != nil {
+		return err
+	}
+
+	id := c.nextID()
+	err = c.send(receiverID, nsReceiver, map[string]interface{}{
+		"type": "LAUNCH", "appId": defaultReceiver, "requestId": id,
+	})
+	if err != nil {
+		return err
+	}
+
+	reply, err := c.wait(id)
+	if err != nil {
+		return err
+	}
+
+	var status receiverStatus
+	json.Unmarshal(reply.Status, &status)
+	var transport string
+	for _, app := range status.Applications {
+		if app.AppID == defaultReceiver {
+			transport = app.TransportID
+		}
+	}
+	if len(transport) < 1 {
+		return errors.New("The Chromecast target did not launch the media receiver.")
+	}
+
+	err = c.send(transport, nsConnection, map[string]interface{}{"type": "CONNECT"})
+	if err != nil {
+		return err
+	}
+
+	var items []interface{}
+	for _, s := range songs {
+		items = append(items, map[string]interface{}{
+			"autoplay": true,
+			"media": map[string]interface{}{
+				"contentId":   s.URL,
+				"contentType": s.ContentType,
+				"streamType":  "BUFFERED",
+				"metadata": map[string]interface{}{
+					"metadataType": 3,
+					"title":        s.Title,
+					"artist":       s.Artist,
+					"albumName":    s.Album,
+				},
+			},
+		})
+	}
+
+	id = c.nextID()
+	err = c.send(transport, nsMedia, map[string]interface{}{
+		"type": "QUEUE_LOAD", "requestId": id, "items": items,
+		"startIndex": 0, "repeatMode": "REPEAT_OFF",
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = c.wait(id)
+	return err
+}
+
+// nextID returns the identifier of a new request.
+func (c *castConn) nextID() int {
+	c.requestID++
+	return c.requestID
+}
+
+// send sends the payload to the destination.
+func (c *castConn) send(destination, namespace string, payload interface{}) error {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	msg := castMessage{source: senderID, destination: destination, namespace: namespace, payload: string(data)}
+	b := msg.encode()
+	header := make([]byte, 4)
+	binary.BigEndian.PutUint32(header, uint32(len(b)))
+
+	c.conn.SetWriteDeadline(time.Now().Add(timeout))
+	_, err = c.conn.Write(append(header, b...))
+	return err
+}
+
+// receive reads the next message from the device.
+func (c *castConn) receive() (castMessage, error) {
+	c.conn.SetReadDeadline(time.Now().Add(timeout))
+	header := make([]byte, 4)
+	if _, err := io.ReadFull(c.conn, header); err != nil {
+		return castMessage{}, err
+	}
+
+	size := binary.BigEndian.Uint32(header)
+	if size > maxMessageSize {
+		return castMessage{}, errBadMessage
+	}
+
+	b := make([]byte, size)
+	if _, err := io.ReadFull(c.conn, b); err != nil {
+		return castMessage{}, err
+	}
+	return decodeMessage(b)
+}
+
+// wait reads the messages until the answer to the request
+// arrives, the heartbeats of the device are answered.
+func (c *castConn) wait(id int) (castReply, error) {
+	for {
+		msg, err := c.receive()
+		if err != nil {
+			return castReply{}, err
+		}
+
+		var reply castReply
+		if err := json.Unmarshal([]byte(msg.payload), &reply); err != nil {
+			continue
+		}
+
+		if msg.namespace == nsHeartbeat && reply.Type == "PING" {
+			err = c.send(msg.source, nsHeartbeat, map[string]interface{}{"type": "PONG"})
+			if err != nil {
+				return castReply{}, err
+			}
+			continue
+		}
+
+		if reply.RequestID != id {
+			continue
+		}
+
+		switch reply.Type {
+		case "LAUNCH_ERROR", "LOAD_FAILED", "LOAD_CANCELLED", "INVALID_REQUEST":
+			msg := "The Chromecast target answered " + reply.Type
+			if len(reply.Reason) > 0 {
+				msg += ": " + reply.Reason
+			}
+			return reply, errors.New(msg + ".")
+		}
+		return reply, nil
+	}
+}
+
+// encode returns the message as a protocol buffer, the
+// protocol version and the payload type are always 0.
+func (m castMessage) encode() []byte {
+	var b []byte
+	b = appendVarint(b, 1<<3)
+	b = appendVarint(b, 0)
+	b = appendString(b, 2, m.source)
+	b = appendString(b, 3, m.destination)
+	b = appendString(b, 4, m.namespace)
+	b = appendVarint(b, 5<<3)
+	b = appendVarint(b, 0)
+	b = appendString(b, 6, m.payload)
+	return b
+}
+
+// decodeMessage decodes a protocol buffer message,
+// the binary payloads are ignored.
+func decodeMessage(b []byte) (castMessage, error) {
+	var m castMessage
+	for len(b) > 0 {
+		key, n := binary.Uvarint(b)
+		if n <= 0 {
+			return m, errBadMessage
+		}
+		b = b[n:]
+
+		switch key & 7 {
+		case 0:
+			_, n = binary.Uvarint(b)
+			if n <= 0 {
+				return m, errBadMessage
+			}
+			b = b[n:]
+		case 2:
+			size, n := binary.Uvarint(b)
+			if n <= 0 || size > uint64(len(b)-n) {
+				return m, errBadMessage
+			}
+			value := string(b[n : n+int(size)])
+			b = b[n+int(size):]
+
+			switch key >> 3 {
+			case 2:
+				m.source = value
+			case 3:
+				m.destination = value
+			case 4:
+				m.namespace = value
+			case 6:
+				m.payload = value
+			}
+		default:
+			return m, errBadMessage
+		}
+	}
+	return m, nil
+}
+
+// appendVarint appends the value as a varint.
+func appendVarint(b []byte, v uint64) []byte {
+	tmp := make([]byte, binary.MaxVarintLen64)
+	n := binary.PutUvarint(tmp, v)
+	return append(b, tmp[:n]...)
+}
+
+// appendString appends the string field.
+func appendString(b []byte, field uint64, s string) []byte {
+	b = appendVarint(b, field<<3|2)
+	b = appendVarint(b, uint64(len(s)))
+	return append(b, s...)
+}
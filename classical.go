@@ -0,0 +1,142 @@
+// Copyright 2016 Danko Miocevic. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Author: Danko Miocevic
+
+package main
+
+import (
+	"github.com/dankomiocevic/mulifs/store"
+	"strings"
+
+	"bazil.org/fuse"
+	"bazil.org/fuse/fs"
+	"golang.org/x/net/context"
+)
+
+// defaultClassicalGenres are the genres shown
+// in the classical view by default.
+const defaultClassicalGenres = "Classical;Opera;Chamber Music"
+
+// registerClassicalView adds the classical view
+// to the root Directory when it is enabled.
+func registerClassicalView() {
+	if config_params.classical {
+		views["classical"] = view{list: listClassicalView, lookup: lookupClassicalView}
+	}
+}
+
+// classicalLevel returns the Composer, Work and Performer
+// of a Song in the classical view, the Work is the Album
+// if the Song does not have one.
+func classicalLevel(s store.SongInfo) []string {
+	composer := store.GetCompatibleString(s.Composer)
+	if len(composer) < 1 {
+		composer = "unknown"
+	}
+
+	work := store.GetCompatibleString(s.Work)
+	if len(work) < 1 {
+		work = s.Album
+	}
+	return []string{composer, work, s.Artist}
+}
+
+// classicalSongs returns the Songs with one of the
+// classical genres inside the Directory of the view.
+// The Directories inside the view are stored in the
+// album separated by slashes: Composer/Work/Performer.
+func classicalSongs(d *Dir) ([]store.SongInfo, []string, error) {
+	songs, err := store.ListSongInfo()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var path []string
+	if len(d.album) > 0 {
+		path = strings.Split(d.album, "/")
+	}
+
+	var a []store.SongInfo
+	for _, s := range songs {
+		if !matchGenre(config_params.classical_genres, s.Genre) {
+			continue
+		}
+
+		level := classicalLevel(s)
+		match := true
+		for i := range path {
+			if path[i] != level[i] {
+				match = false
+				break
+			}
+		}
+		if match {
+			a = append(a, s)
+		}
+	}
+	return a, path, nil
+}
+
+// listClassicalView lists the Composers, their Works,
+// the Performers of every Work or the movements.
+func listClassicalView(ctx context.Context, d *Dir) ([]fuse.Dirent, error) {
+	songs, path, err := classicalSongs(d)
+	if err != nil {
+		return nil, fuse.EIO
+	}
+
+	var a []fuse.Dirent
+	seen := make(map[string]bool)
+	for _, s := range songs {
+		if ctx.Err() != nil {
+			return nil, fuse.EINTR
+		}
+
+		if len(path) > 2 {
+			a = append(a, fuse.Dirent{Name: s.Song, Type: fuse.DT_File})
+			continue
+		}
+
+		name := classicalLevel(s)[len(path)]
+		if !seen[name] {
+			seen[name] = true
+			a = append(a, fuse.Dirent{Name: name, Type: fuse.DT_Dir})
+		}
+	}
+	return a, nil
+}
+
+// lookupClassicalView returns the Directories
+// and the movements in the classical view.
+func lookupClassicalView(ctx context.Context, d *Dir, name string) (fs.Node, error) {
+	songs, path, err := classicalSongs(d)
+	if err != nil {
+		return nil, fuse.EIO
+	}
+
+	for _, s := range songs {
+		if len(path) > 2 {
+			if s.Song == name {
+				return songFile(d, s.Artist, s.Album, s.Song)
+			}
+			continue
+		}
+
+		if classicalLevel(s)[len(path)] == name {
+			return &Dir{fs: d.fs, artist: d.artist, album: strings.Join(append(path, name), "/"), mPoint: d.mPoint}, nil
+		}
+	}
+	return nil, fuse.ENOENT
+}
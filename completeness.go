@@ -0,0 +1,259 @@
+// Copyright 2016 Danko Miocevic. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Author: Danko Miocevic
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/dankomiocevic/mulifs/metadata"
+	"github.com/dankomiocevic/mulifs/store"
+	"github.com/golang/glog"
+	"strings"
+	"sync"
+	"time"
+
+	"bazil.org/fuse"
+	"bazil.org/fuse/fs"
+	"golang.org/x/net/context"
+)
+
+// incompleteDirName is the view with the
+// Albums that have missing tracks.
+const incompleteDirName = "incomplete"
+
+// incompleteExt is the extension of the read only
+// files of the Albums in the incomplete view.
+const incompleteExt = ".txt"
+
+// completenessDelay is the time waited between the requests
+// to MusicBrainz, it allows one request per second.
+const completenessDelay = time.Second
+
+// completenessState is the progress of the
+// checks of the track lists of the Albums.
+type completenessState struct {
+	mu       sync.Mutex
+	running  bool
+	finished time.Time
+	checked  int
+	total    int
+}
+
+var completeness completenessState
+
+// completenessEnabled returns true if the
+// completeness of the Albums is checked.
+func completenessEnabled() bool {
+	return config_params.completeness_interval > 0
+}
+
+// registerIncompleteView adds the incomplete view to the
+// root Directory when the completeness is checked.
+func registerIncompleteView() {
+	if completenessEnabled() {
+		views[incompleteDirName] = view{list: listIncompleteView, lookup: lookupIncompleteView}
+	}
+}
+
+// isIncompleteFile returns true if the File is
+// an Album inside the incomplete view.
+func (f *File) isIncompleteFile() bool {
+	return f.artist == incompleteDirName && len(f.album) < 1
+}
+
+// incompleteName returns the name of the
+// file of an Album in the incomplete view.
+func incompleteName(ref store.AlbumRef) string {
+	return ref.Artist + " - " + ref.Album + incompleteExt
+}
+
+// findIncomplete returns the incomplete Album
+// with the file name in the incomplete view.
+func findIncomplete(name string) (store.IncompleteAlbum, error) {
+	albums, err := store.ListIncompleteAlbums()
+	if err != nil {
+		return store.IncompleteAlbum{}, err
+	}
+
+	for _, a := range albums {
+		if incompleteName(a.AlbumRef) == name {
+			return a, nil
+		}
+	}
+	return store.IncompleteAlbum{}, fuse.ENOENT
+}
+
+// listIncompleteView lists the Albums with missing tracks.
+func listIncompleteView(ctx context.Context, d *Dir) ([]fuse.Dirent, error) {
+	albums, err := store.ListIncompleteAlbums()
+	if err != nil {
+		return nil, fuse.EIO
+	}
+
+	var a []fuse.Dirent
+	for _, album := range albums {
+		a = append(a, fuse.Dirent{Name: incompleteName(album.AlbumRef), Type: fuse.DT_File})
+	}
+	return a, nil
+}
+
+// lookupIncompleteView returns the file of an Album.
+func lookupIncompleteView(ctx context.Context, d *Dir, name string) (fs.Node, error) {
+	if len(d.album) > 0 || !strings.HasSuffix(name, incompleteExt) {
+		return nil, fuse.ENOENT
+	}
+
+	if _, err := findIncomplete(name); err != nil {
+		return nil, err
+	}
+	return &File{artist: d.artist, name: name, mPoint: d.mPoint}, nil
+}
+
+// trackLength returns the duration of
+// a track in minutes and seconds.
+func trackLength(seconds int) string {
+	if seconds < 1 {
+		return ""
+	}
+	return fmt.Sprintf(" (%d:%02d)", seconds/60, seconds%60)
+}
+
+// incompleteContent returns the release of the
+// Album and the tracks missing, one per line.
+func incompleteContent(name string) []byte {
+	album, err := findIncomplete(name)
+	if err != nil {
+		return nil
+	}
+
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "Artist: %s\n", album.Artist)
+	fmt.Fprintf(&b, "Album: %s\n", album.Album)
+	fmt.Fprintf(&b, "Release: https://musicbrainz.org/release/%s\n", album.ReleaseID)
+	fmt.Fprintf(&b, "Tracks: %d of %d\n", album.Total-len(album.Missing), album.Total)
+	fmt.Fprintf(&b, "Missing:\n")
+	for _, t := range album.Missing {
+		fmt.Fprintf(&b, "  %d-%02d %s%s\n", t.Disc, t.Position, t.Title, trackLength(t.Duration))
+	}
+	return b.Bytes()
+}
+
+// completenessCounts returns the amount of Albums
+// with missing tracks and of tracks missing.
+func completenessCounts() (int, int, error) {
+	albums, err := store.ListIncompleteAlbums()
+	if err != nil {
+		return 0, 0, err
+	}
+
+	var missing int
+	for _, a := range albums {
+		missing += len(a.Missing)
+	}
+	return len(albums), missing, nil
+}
+
+// completenessStatus returns the state of the
+// checks of the track lists for the status file.
+func completenessStatus() []byte {
+	completeness.mu.Lock()
+	defer completeness.mu.Unlock()
+
+	var b bytes.Buffer
+	switch {
+	case completeness.running:
+		fmt.Fprintf(&b, "Completeness: running, %d of %d Albums checked\n", completeness.checked, completeness.total)
+	case completeness.finished.IsZero():
+		fmt.Fprintf(&b, "Completeness: not started\n")
+	default:
+		fmt.Fprintf(&b, "Completeness: finished at %s, %d Albums checked\n",
+			completeness.finished.Format(time.RFC3339), completeness.checked)
+	}
+
+	if albums, missing, err := completenessCounts(); err == nil {
+		fmt.Fprintf(&b, "Incomplete Albums: %d, %d tracks missing\n", albums, missing)
+	}
+	return b.Bytes()
+}
+
+// runCompleteness obtains from MusicBrainz the track list
+// of the releases of the Albums not checked in the last
+// completeness_interval hours. Only the Albums with the
+// MusicBrainz identifier of their release are checked.
+func runCompleteness() {
+	releases, err := store.ListAlbumReleases()
+	if err != nil {
+		glog.Errorf("Completeness: cannot list the Albums: %s\n", err)
+		return
+	}
+
+	interval := time.Duration(config_params.completeness_interval) * time.Hour
+	var pending []store.AlbumRelease
+	for _, r := range releases {
+		if time.Since(r.Checked) >= interval {
+			pending = append(pending, r)
+		}
+	}
+
+	completeness.mu.Lock()
+	completeness.running = true
+	completeness.checked = 0
+	completeness.total = len(pending)
+	completeness.mu.Unlock()
+
+	for _, r := range pending {
+		if isStopping() {
+			break
+		}
+
+		ctx, cancel := context.WithTimeout(stopCtx, time.Minute)
+		tracks, err := metadata.ReleaseTracks(ctx, r.ReleaseID)
+		cancel()
+		if err != nil {
+			glog.Infof("Completeness: cannot fetch the tracks of %s: %s\n", r.Album, err)
+		} else if err := store.SetAlbumTracks(r, tracks); err != nil {
+			glog.Errorf("Completeness: cannot store the tracks of %s: %s\n", r.Album, err)
+		}
+
+		completeness.mu.Lock()
+		completeness.checked++
+		completeness.mu.Unlock()
+		time.Sleep(completenessDelay)
+	}
+
+	completeness.mu.Lock()
+	completeness.running = false
+	completeness.finished = time.Now()
+	glog.Infof("Completeness: %d Albums checked\n", completeness.checked)
+	completeness.mu.Unlock()
+}
+
+// startCompleteness checks the track lists of the
+// Albums in background every completeness_interval hours.
+func startCompleteness() {
+	if !completenessEnabled() {
+		return
+	}
+
+	go func() {
+		time.Sleep(scrubStart)
+		for !isStopping() {
+			runCompleteness()
+			time.Sleep(time.Duration(config_params.completeness_interval) * time.Hour)
+		}
+	}()
+}
@@ -0,0 +1,161 @@
+// Copyright 2016 Danko Miocevic. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Author: Danko Miocevic
+
+package main
+
+import (
+	"github.com/dankomiocevic/mulifs/store"
+	"sort"
+
+	"bazil.org/fuse"
+	"bazil.org/fuse/fs"
+	"golang.org/x/net/context"
+)
+
+// indexViews are the views of the indexes
+// of the Songs, by the view name.
+var indexViews = map[string]string{
+	"composers":  store.ComposersIndex,
+	"conductors": store.ConductorsIndex,
+	"bpm":        store.BPMIndex,
+	"keys":       store.KeysIndex,
+	"quality":    store.QualityIndex,
+	"ratings":    store.RatingsIndex,
+}
+
+// registerComposersView adds the composers and conductors
+// views to the root Directory when they are enabled.
+func registerComposersView() {
+	if config_params.composers {
+		views["composers"] = view{list: listIndexView, lookup: lookupIndexView}
+		views["conductors"] = view{list: listIndexView, lookup: lookupIndexView}
+	}
+}
+
+// registerBPMView adds the bpm view to the
+// root Directory when it is enabled.
+func registerBPMView() {
+	if config_params.bpm {
+		views["bpm"] = view{list: listIndexView, lookup: lookupIndexView}
+	}
+}
+
+// registerKeysView adds the keys view to the
+// root Directory when it is enabled.
+func registerKeysView() {
+	if config_params.keys {
+		views["keys"] = view{list: listIndexView, lookup: lookupIndexView}
+	}
+}
+
+// registerQualityView adds the quality view to
+// the root Directory when it is enabled.
+func registerQualityView() {
+	if config_params.quality {
+		views["quality"] = view{list: listIndexView, lookup: lookupIndexView}
+	}
+}
+
+// registerRatingsView adds the ratings view to
+// the root Directory when it is enabled.
+func registerRatingsView() {
+	if config_params.ratings {
+		views["ratings"] = view{list: listIndexView, lookup: lookupIndexView}
+	}
+}
+
+// indexSongNames returns the Songs of a name in an
+// index by the name used in the view, the Artist
+// and the Song, adding the Album when it is repeated.
+func indexSongNames(index, name string) (map[string]store.SongRef, error) {
+	songs, err := store.ListIndexSongs(index, name)
+	if err != nil {
+		return nil, err
+	}
+
+	seen := make(map[string]int)
+	for _, s := range songs {
+		seen[s.Artist+" - "+s.Song]++
+	}
+
+	a := make(map[string]store.SongRef)
+	for _, s := range songs {
+		viewName := s.Artist + " - " + s.Song
+		if seen[viewName] > 1 {
+			viewName = s.Artist + " - " + s.Album + " - " + s.Song
+		}
+		a[viewName] = s
+	}
+	return a, nil
+}
+
+// listIndexView lists the Composers, Conductors, BPM ranges,
+// keys, quality tiers or ratings or the Songs of one of them.
+// The names are sorted by their numbers, so the keys
+// follow the Camelot wheel (1A, 1B, 2A...).
+func listIndexView(ctx context.Context, d *Dir) ([]fuse.Dirent, error) {
+	index := indexViews[d.artist]
+	if len(d.album) < 1 {
+		names, err := store.ListIndexNames(index)
+		if err != nil {
+			return nil, fuse.EIO
+		}
+		sort.Slice(names, func(i, j int) bool {
+			return naturalLess(names[i], names[j])
+		})
+
+		var a []fuse.Dirent
+		for _, name := range names {
+			a = append(a, fuse.Dirent{Name: name, Type: fuse.DT_Dir})
+		}
+		return a, nil
+	}
+
+	songs, err := indexSongNames(index, d.album)
+	if err != nil {
+		return nil, fuse.ENOENT
+	}
+
+	var a []fuse.Dirent
+	for name := range songs {
+		a = append(a, fuse.Dirent{Name: name, Type: fuse.DT_File})
+	}
+	return a, nil
+}
+
+// lookupIndexView returns the Directories of the Composers, Conductors,
+// BPM ranges, keys, quality tiers or ratings and their Songs.
+func lookupIndexView(ctx context.Context, d *Dir, name string) (fs.Node, error) {
+	index := indexViews[d.artist]
+	if len(d.album) < 1 {
+		_, err := store.ListIndexSongs(index, name)
+		if err != nil {
+			return nil, fuse.ENOENT
+		}
+		return &Dir{fs: d.fs, artist: d.artist, album: name, mPoint: d.mPoint}, nil
+	}
+
+	songs, err := indexSongNames(index, d.album)
+	if err != nil {
+		return nil, fuse.ENOENT
+	}
+
+	s, ok := songs[name]
+	if !ok {
+		return nil, fuse.ENOENT
+	}
+	return songFile(d, s.Artist, s.Album, s.Song)
+}
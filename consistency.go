@@ -0,0 +1,93 @@
+// Copyright 2016 Danko Miocevic. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Author: Danko Miocevic
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"github.com/dankomiocevic/mulifs/store"
+	"io"
+	"log"
+	"os"
+
+	"github.com/golang/glog"
+)
+
+// probeSample is the amount of Songs whose
+// files are looked for before mounting.
+const probeSample = 20
+
+// checkConsistency looks quickly at the database and the
+// source Directory before scanning and mounting them, it
+// returns an error if mounting would show an empty or
+// broken Library, like when the disk of the source
+// Directory is not mounted. The doubtful results are
+// only logged. The force option skips the check.
+func checkConsistency(root string) error {
+	if config_params.force {
+		glog.Info("The consistency check is skipped.")
+		return nil
+	}
+
+	p, err := store.ProbeDB(probeSample)
+	if err != nil {
+		return fmt.Errorf("Cannot read the database: %s", err)
+	}
+	if p.Version > store.SchemaVersion {
+		return fmt.Errorf("The database has the version %d, this MuLi reads up to the version %d", p.Version, store.SchemaVersion)
+	}
+
+	info, err := os.Stat(root)
+	if err != nil {
+		return fmt.Errorf("Cannot reach the source Directory: %s", err)
+	}
+	if !info.IsDir() {
+		return errors.New("The source is not a Directory")
+	}
+
+	dir, err := os.Open(root)
+	if err != nil {
+		return fmt.Errorf("Cannot read the source Directory: %s", err)
+	}
+	names, err := dir.Readdirnames(1)
+	dir.Close()
+	if err != nil && err != io.EOF {
+		return fmt.Errorf("Cannot read the source Directory: %s", err)
+	}
+	if len(names) < 1 && p.Songs > 0 {
+		return fmt.Errorf("The source Directory is empty but the database has %d Songs", p.Songs)
+	}
+
+	missing := 0
+	for _, path := range p.Sample {
+		if _, err := os.Stat(path); os.IsNotExist(err) {
+			missing++
+		}
+	}
+	if len(p.Sample) > 0 && missing == len(p.Sample) {
+		return fmt.Errorf("None of the %d Songs looked for are in the source Directory", missing)
+	}
+	if missing > 0 {
+		log.Printf("%d of the %d Songs looked for are missing in the source Directory\n", missing, len(p.Sample))
+	}
+
+	if p.Albums > 0 && p.Songs < 1 {
+		log.Printf("The database has %d Albums but no Songs\n", p.Albums)
+	}
+	glog.Infof("Consistency check: %d Artists, %d Albums and %d Songs.\n", p.Artists, p.Albums, p.Songs)
+	return nil
+}
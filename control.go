@@ -0,0 +1,151 @@
+// Copyright 2016 Danko Miocevic. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Author: Danko Miocevic
+
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"github.com/dankomiocevic/mulifs/store"
+	"sync"
+	"time"
+)
+
+// controlFileName is the write only file in the .mulifs
+// Directory that receives the commands for the whole
+// Library, one per line:
+//
+//	undo
+//	compact
+//	restore
+//	purge
+//	cast <target> <playlist or Artist/Album/Song>
+const controlFileName = "control"
+
+// undoFileName is the read only file in the .mulifs Directory
+// with the bulk operation reversed by the undo command and
+// the result of the last undo.
+const undoFileName = "undo"
+
+// isLibraryControl returns true if the File is
+// the control file of the .mulifs Directory.
+func (f *File) isLibraryControl() bool {
+	return f.artist == mulifsDirName && len(f.album) < 1 && f.name == controlFileName
+}
+
+// isControl returns true if the File is one of the
+// write only files that receive commands.
+func (f *File) isControl() bool {
+	return f.isPlaylistControl() || f.isLibraryControl()
+}
+
+// isUndoFile returns true if the File is the undo file.
+func (f *File) isUndoFile() bool {
+	return f.artist == mulifsDirName && len(f.album) < 1 && f.name == undoFileName
+}
+
+// lastCompaction is the result of the
+// last compaction of the database.
+var lastCompaction struct {
+	sync.Mutex
+	time   time.Time
+	before int64
+	after  int64
+}
+
+// dbStatus returns the size of the database and the
+// result of the last compaction for the status file.
+func dbStatus() []byte {
+	var b bytes.Buffer
+	if size, err := store.DBSize(); err == nil {
+		fmt.Fprintf(&b, "Database: %d KB\n", size/1024)
+	}
+
+	lastCompaction.Lock()
+	defer lastCompaction.Unlock()
+	if !lastCompaction.time.IsZero() {
+		fmt.Fprintf(&b, "Compacted: %s, from %d KB to %d KB\n", lastCompaction.time.Format(time.RFC3339),
+			lastCompaction.before/1024, lastCompaction.after/1024)
+	}
+	return b.Bytes()
+}
+
+// compactDB compacts the database and
+// keeps the result for the status file.
+func compactDB() error {
+	before, after, err := store.CompactDB()
+	if err != nil {
+		return err
+	}
+
+	lastCompaction.Lock()
+	lastCompaction.time = time.Now()
+	lastCompaction.before = before
+	lastCompaction.after = after
+	lastCompaction.Unlock()
+	return nil
+}
+
+// undoContent returns the bulk operation that the undo command
+// reverses and the result of the last undo with the changes
+// that could not be reversed.
+func undoContent() []byte {
+	var b bytes.Buffer
+	if record, err := store.GetUndo(); err == nil {
+		fmt.Fprintf(&b, "pending %s %s %s\n", record.Time.Format(time.RFC3339), record.Op, record.Name)
+	}
+
+	if result, err := store.GetUndoResult(); err == nil {
+		fmt.Fprintf(&b, "undone %s %s %s restored=%d\n", result.Time.Format(time.RFC3339),
+			result.Op, result.Name, result.Restored)
+		for _, p := range result.Problems {
+			fmt.Fprintf(&b, "not restored %s: %s\n", p.Path, p.Reason)
+		}
+	}
+	return b.Bytes()
+}
+
+// runLibraryCommand runs a command written to
+// the control file of the .mulifs Directory.
+func runLibraryCommand(fields []string, mPoint string) error {
+	if fields[0] == "cast" {
+		return runCastCommand(fields, mPoint)
+	}
+
+	if len(fields) != 1 {
+		return errors.New("Wrong number of arguments.")
+	}
+	if config_params.read_only {
+		return errors.New("The database is read only.")
+	}
+
+	switch fields[0] {
+	case "undo":
+		_, err := store.UndoLast(mPoint)
+		scheduleAutoPlaylists(mPoint)
+		return err
+	case "compact":
+		return compactDB()
+	case "restore":
+		_, err := store.RestoreTombstones(mPoint)
+		scheduleAutoPlaylists(mPoint)
+		return err
+	case "purge":
+		return store.PurgeTombstones()
+	}
+	return errors.New("Unknown command.")
+}
@@ -0,0 +1,301 @@
+// Copyright 2016 Danko Miocevic. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Author: Danko Miocevic
+
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"github.com/dankomiocevic/mulifs/store"
+	"path/filepath"
+	"strings"
+
+	"bazil.org/fuse"
+	"bazil.org/fuse/fs"
+	"github.com/golang/glog"
+	"golang.org/x/net/context"
+)
+
+// cratesDirName is the Directory with the crates, the
+// working sets of Songs from anywhere in the Library.
+// The crates are stored in the database and the files
+// of the Songs are never modified through them.
+const cratesDirName = "crates"
+
+// crateFileName is the name of the editable file inside
+// every crate that lists its Songs in order, one per line:
+//
+//	<Artist>/<Album>/<Song>	<cue notes>
+//
+// The fields are separated by tabs, the lines starting
+// with # are comments. Saving the file reorders, adds
+// and removes the Songs and changes their cue notes.
+const crateFileName = "crate.txt"
+
+// crateM3uName is the name of the read only playlist
+// inside every crate with its Songs in order.
+const crateM3uName = "crate.m3u"
+
+// registerCratesView adds the crates Directory to the
+// root Directory when the crates option is set.
+func registerCratesView() {
+	if config_params.crates {
+		views[cratesDirName] = view{list: listCratesView, lookup: lookupCratesView}
+	}
+}
+
+// isCrateFile returns true if the File is
+// the crate.txt file of a crate.
+func (f *File) isCrateFile() bool {
+	return f.artist == cratesDirName && len(f.album) > 0 && f.name == crateFileName
+}
+
+// isCrateM3u returns true if the File is
+// the crate.m3u file of a crate.
+func (f *File) isCrateM3u() bool {
+	return f.artist == cratesDirName && len(f.album) > 0 && f.name == crateM3uName
+}
+
+// crateSongName returns the name of a Song in the crate
+// Directory, with its position so they are listed in order.
+func crateSongName(i int, e store.CrateEntry) string {
+	return fmt.Sprintf("%02d - %s - %s", i+1, e.Artist, e.Song)
+}
+
+// listCratesView lists the crates or
+// the Songs of one of them.
+func listCratesView(ctx context.Context, d *Dir) ([]fuse.Dirent, error) {
+	var a []fuse.Dirent
+	if len(d.album) < 1 {
+		names, err := store.ListCrates()
+		if err != nil {
+			return nil, fuse.EIO
+		}
+
+		for _, name := range names {
+			a = append(a, fuse.Dirent{Name: name, Type: fuse.DT_Dir})
+		}
+		return a, nil
+	}
+
+	entries, err := store.GetCrate(d.album)
+	if err != nil {
+		return nil, fuse.ENOENT
+	}
+
+	for i, e := range entries {
+		a = append(a, fuse.Dirent{Name: crateSongName(i, e), Type: fuse.DT_File})
+	}
+	a = append(a, fuse.Dirent{Name: crateFileName, Type: fuse.DT_File})
+	a = append(a, fuse.Dirent{Name: crateM3uName, Type: fuse.DT_File})
+	return a, nil
+}
+
+// lookupCratesView returns the crate Directories, their
+// files and their Songs, that are read only.
+func lookupCratesView(ctx context.Context, d *Dir, name string) (fs.Node, error) {
+	if len(d.album) < 1 {
+		if _, err := store.GetCrate(name); err != nil {
+			return nil, fuse.ENOENT
+		}
+		return &Dir{fs: d.fs, artist: d.artist, album: name, mPoint: d.mPoint}, nil
+	}
+
+	entries, err := store.GetCrate(d.album)
+	if err != nil {
+		return nil, fuse.ENOENT
+	}
+
+	if name == crateFileName || name == crateM3uName {
+		return &File{artist: d.artist, album: d.album, song: name, name: name, mPoint: d.mPoint}, nil
+	}
+
+	for i, e := range entries {
+		if crateSongName(i, e) == name {
+			return crateSongFile(d, e.SongRef), nil
+		}
+	}
+	return nil, fuse.ENOENT
+}
+
+// crateSongFile returns the read only File of
+// a Song of the Library inside a crate.
+func crateSongFile(d *Dir, ref store.SongRef) *File {
+	songName := strings.TrimSuffix(ref.Song, filepath.Ext(ref.Song))
+	return &File{artist: ref.Artist, album: ref.Album, song: songName, name: ref.Song, mPoint: d.mPoint, policy: policyCrate}
+}
+
+// crateContent returns the contents of
+// the crate.txt file of a crate.
+func crateContent(name string) ([]byte, error) {
+	entries, err := store.GetCrate(name)
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString("# song\tnotes\n")
+	for _, e := range entries {
+		fmt.Fprintf(&buf, "%s/%s/%s\t%s\n", e.Artist, e.Album, e.Song, e.Notes)
+	}
+	return buf.Bytes(), nil
+}
+
+// parseCrate parses the contents of a crate.txt file.
+func parseCrate(data []byte) ([]store.CrateEntry, error) {
+	var entries []store.CrateEntry
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimRight(line, "\r")
+		if len(strings.TrimSpace(line)) < 1 || line[0] == '#' {
+			continue
+		}
+
+		fields := strings.SplitN(line, "\t", 2)
+		path := strings.Split(strings.Trim(strings.TrimSpace(fields[0]), "/"), "/")
+		if len(path) != 3 {
+			return nil, errors.New("Wrong Song " + fields[0] + ", it must be Artist/Album/Song.")
+		}
+
+		e := store.CrateEntry{SongRef: store.SongRef{Artist: path[0], Album: path[1], Song: path[2]}}
+		if len(fields) > 1 {
+			e.Notes = strings.TrimSpace(fields[1])
+		}
+		entries = append(entries, e)
+	}
+	return entries, nil
+}
+
+// saveCrate stores the content written
+// to the crate.txt file of a crate.
+func (fh *FileHandle) saveCrate(header fuse.Header, data []byte, changed bool) error {
+	entries, err := parseCrate(data)
+	if err == nil {
+		err = store.SetCrate(fh.f.album, entries)
+	}
+	if changed {
+		audit(header, "edit", err, entryPath(fh.f.artist, fh.f.album, fh.f.name))
+	}
+	if err != nil {
+		glog.Errorf("Cannot save the crate %s: %s\n", fh.f.album, err)
+		return fuse.EIO
+	}
+
+	current, err := crateContent(fh.f.album)
+	if err != nil {
+		return nil
+	}
+
+	descriptionEdits.Lock()
+	fh.edit.data = current
+	descriptionEdits.Unlock()
+	return nil
+}
+
+// crateM3u returns the contents of the crate.m3u file,
+// the Songs in order with their absolute paths in the
+// mounted filesystem and their cue notes as comments.
+func crateM3u(name string) []byte {
+	entries, err := store.GetCrate(name)
+	if err != nil {
+		return nil
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString("#EXTM3U\n")
+	for _, e := range entries {
+		if len(e.Notes) > 0 {
+			fmt.Fprintf(&buf, "# %s\n", e.Notes)
+		}
+		fmt.Fprintf(&buf, "%s/%s/%s/%s\n", config_params.mountpoint, e.Artist, e.Album, e.Song)
+	}
+	return buf.Bytes()
+}
+
+// mkdirCrate creates a crate inside the crates Directory.
+func (d *Dir) mkdirCrate(name string) (fs.Node, error) {
+	if len(d.album) > 0 {
+		return nil, fuse.EPERM
+	}
+
+	ret, err := store.CreateCrate(name)
+	if err != nil {
+		glog.Infof("Cannot create the crate %s: %s\n", name, err)
+		return nil, err
+	}
+	return &Dir{fs: d.fs, artist: d.artist, album: ret, mPoint: d.mPoint}, nil
+}
+
+// removeCrateEntry removes a crate or a Song from a
+// crate, the files of the Songs are never removed.
+func (d *Dir) removeCrateEntry(name string, dir bool) error {
+	if len(d.album) < 1 {
+		if !dir {
+			return fuse.EPERM
+		}
+		return store.DeleteCrate(name)
+	}
+
+	entries, err := store.GetCrate(d.album)
+	if err != nil {
+		return fuse.ENOENT
+	}
+
+	for i, e := range entries {
+		if crateSongName(i, e) == name {
+			return store.SetCrate(d.album, append(entries[:i], entries[i+1:]...))
+		}
+	}
+	return fuse.EPERM
+}
+
+var _ = fs.NodeLinker(&Dir{})
+
+// Link adds a Song of the Library at the end of a crate,
+// the crates are the only Directories where the Songs
+// can be linked.
+func (d *Dir) Link(ctx context.Context, req *fuse.LinkRequest, old fs.Node) (fs.Node, error) {
+	ref, err := d.link(req, old)
+	audit(req.Header, d.auditOp("link"), err, d.auditPath(req.NewName))
+	if err != nil {
+		return nil, fsError("link", d.auditPath(req.NewName), err)
+	}
+	return crateSongFile(d, ref), nil
+}
+
+// link adds the linked Song to the crate.
+func (d *Dir) link(req *fuse.LinkRequest, old fs.Node) (store.SongRef, error) {
+	var ref store.SongRef
+	if err := checkWritable(req.Header); err != nil {
+		return ref, err
+	}
+
+	f, ok := old.(*File)
+	if d.artist != cratesDirName || len(d.album) < 1 || !ok {
+		return ref, fuse.EPERM
+	}
+
+	if (f.policy != policyNone && f.policy != policyCrate) || f.isDropped() || f.artist == "playlists" {
+		return ref, fuse.EPERM
+	}
+
+	if _, err := store.GetFilePath(f.artist, f.album, f.name); err != nil {
+		return ref, fuse.EPERM
+	}
+
+	ref = store.SongRef{Artist: f.artist, Album: f.album, Song: f.name}
+	return ref, store.AddToCrate(d.album, ref)
+}
@@ -0,0 +1,104 @@
+// Copyright 2016 Danko Miocevic. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Author: Danko Miocevic
+package main
+
+import (
+	"os"
+	"os/exec"
+	"syscall"
+	"time"
+
+	"bazil.org/fuse"
+	"github.com/golang/glog"
+)
+
+// daemonEnv is the environment variable used to
+// know that the process is already running as a daemon.
+const daemonEnv = "MULI_DAEMON"
+
+// daemonize starts a new copy of the process detached
+// from the terminal and returns true in the parent
+// process, that should exit after that.
+// In the daemon process it returns false.
+// When started by systemd the process does not fork,
+// systemd already keeps it in background.
+func daemonize() (bool, error) {
+	if os.Getenv(daemonEnv) == "1" || underSystemd() {
+		return false, nil
+	}
+
+	devNull, err := os.OpenFile(os.DevNull, os.O_RDWR, 0)
+	if err != nil {
+		return false, err
+	}
+	defer devNull.Close()
+
+	cmd := exec.Command(os.Args[0], os.Args[1:]...)
+	cmd.Env = append(os.Environ(), daemonEnv+"=1")
+	cmd.Stdin = devNull
+	cmd.Stdout = devNull
+	cmd.Stderr = devNull
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setsid: true}
+
+	err = cmd.Start()
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// superviseMount mounts the filesystem and keeps it
+// mounted. If the mount fails it is retried with an
+// increasing delay up to mount_retries times, and if the
+// FUSE connection is aborted the filesystem is mounted again.
+// It returns when the filesystem is unmounted by the user
+// or MuLi is stopped.
+func superviseMount(path, mountpoint string) error {
+	retries := 0
+	for {
+		start := time.Now()
+		err := mount(path, mountpoint)
+		if isStopping() {
+			return err
+		}
+
+		// A stale mount is left when the FUSE connection is
+		// aborted, if it can be unmounted the filesystem needs
+		// to be mounted again. Otherwise it was unmounted by
+		// the user and MuLi should finish.
+		stale := fuse.Unmount(mountpoint) == nil
+		if err == nil && !stale {
+			return nil
+		}
+
+		// Reset the retries if the mount was working for a while.
+		if time.Since(start) > time.Minute {
+			retries = 0
+		}
+
+		if retries >= config_params.mount_retries {
+			return err
+		}
+
+		delay := time.Second << uint(retries)
+		retries++
+		glog.Errorf("Mount finished with error: %v, retrying in %s (%d/%d)\n", err, delay, retries, config_params.mount_retries)
+		time.Sleep(delay)
+		if isStopping() {
+			return err
+		}
+	}
+}
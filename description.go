@@ -0,0 +1,345 @@
+// Copyright 2016 Danko Miocevic. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Author: Danko Miocevic
+
+package main
+
+import (
+	"github.com/dankomiocevic/mulifs/metadata"
+	"github.com/dankomiocevic/mulifs/musicmgr"
+	"github.com/dankomiocevic/mulifs/store"
+	"io/ioutil"
+	"os"
+	"sync"
+
+	"bazil.org/fuse"
+	"github.com/golang/glog"
+	"golang.org/x/net/context"
+)
+
+// descriptionEdit holds the new content of a .description
+// or .tracks file while it is open for writing, the content
+// is stored when the file is flushed. The changed content
+// is recorded in the audit log when it is stored.
+type descriptionEdit struct {
+	data    []byte
+	open    int
+	changed bool
+}
+
+// descriptionEdits maps the Artist, Album and name of
+// the files being edited to their content.
+var descriptionEdits = struct {
+	sync.Mutex
+	m map[string]*descriptionEdit
+}{m: make(map[string]*descriptionEdit)}
+
+// metadataProviders are the providers used to complete the
+// descriptions and identify the dropped Songs, in order.
+var metadataProviders metadata.Chain
+
+// setMetadataProviders creates the providers of the
+// metadata_providers option. By default Discogs is asked
+// first when the token is configured, then MusicBrainz.
+func setMetadataProviders() error {
+	names := config_params.metadata_providers
+	if len(names) < 1 {
+		names = []string{"musicbrainz"}
+		if len(config_params.discogs_token) > 0 {
+			names = []string{"discogs", "musicbrainz"}
+		}
+	}
+
+	settings := metadata.Settings{"discogs_token": config_params.discogs_token}
+	chain, err := metadata.NewChain(names, settings)
+	if err != nil {
+		return err
+	}
+	metadataProviders = chain
+	return nil
+}
+
+// setDescriptionFields sets the custom fields of the
+// descriptions from the description_fields option.
+func setDescriptionFields() error {
+	var fields []store.DescriptionField
+	for _, item := range config_params.description_fields {
+		field, err := store.ParseDescriptionField(item)
+		if err != nil {
+			return err
+		}
+		fields = append(fields, field)
+	}
+	store.SetDescriptionFields(fields)
+	return nil
+}
+
+// descriptionProvider returns the providers used to complete
+// the descriptions or nil if fetching is disabled.
+func descriptionProvider() metadata.Chain {
+	if !config_params.fetch_descriptions || len(metadataProviders) < 1 {
+		return nil
+	}
+	return metadataProviders
+}
+
+// editKey returns the key of the file
+// in the descriptionEdits map.
+func (f *File) editKey() string {
+	return f.artist + "/" + f.album + "/" + f.name
+}
+
+// editContent returns the stored content
+// of the file being edited.
+func (f *File) editContent() ([]byte, error) {
+	if f.isTracksFile() {
+		return albumTracks(f.artist, f.album)
+	}
+	if f.isPlaylistInfo() {
+		return store.GetPlaylistInfo(f.album)
+	}
+	if f.isCrateFile() {
+		return crateContent(f.album)
+	}
+
+	current, err := store.GetDescription(f.artist, f.album, f.name)
+	return []byte(current), err
+}
+
+// getDescriptionEdit returns the content being written
+// to the .description file, if any.
+func (f *File) getDescriptionEdit() ([]byte, bool) {
+	descriptionEdits.Lock()
+	defer descriptionEdits.Unlock()
+	edit, ok := descriptionEdits.m[f.editKey()]
+	if !ok {
+		return nil, false
+	}
+	return edit.data, true
+}
+
+// startDescriptionEdit starts editing the .description file
+// with its current content. If the file is already being
+// edited the same content is shared.
+func (f *File) startDescriptionEdit(open bool) (*descriptionEdit, error) {
+	descriptionEdits.Lock()
+	defer descriptionEdits.Unlock()
+	edit, ok := descriptionEdits.m[f.editKey()]
+	if !ok {
+		current, err := f.editContent()
+		if err != nil {
+			return nil, err
+		}
+		edit = &descriptionEdit{data: current}
+		descriptionEdits.m[f.editKey()] = edit
+	}
+
+	if open {
+		edit.open++
+	}
+	return edit, nil
+}
+
+// truncateDescription changes the size of the
+// .description file being edited.
+func (f *File) truncateDescription(size int64) error {
+	edit, err := f.startDescriptionEdit(false)
+	if err != nil {
+		return err
+	}
+
+	descriptionEdits.Lock()
+	defer descriptionEdits.Unlock()
+	if size < int64(len(edit.data)) {
+		edit.data = edit.data[:size]
+	} else {
+		edit.data = append(edit.data, make([]byte, size-int64(len(edit.data)))...)
+	}
+	edit.changed = true
+	return nil
+}
+
+// writeDescription writes the data into the
+// .description file being edited.
+func (fh *FileHandle) writeDescription(offset int64, data []byte) (int, error) {
+	if fh.edit == nil {
+		return 0, fuse.EPERM
+	}
+
+	descriptionEdits.Lock()
+	defer descriptionEdits.Unlock()
+	end := offset + int64(len(data))
+	if end > int64(len(fh.edit.data)) {
+		fh.edit.data = append(fh.edit.data, make([]byte, end-int64(len(fh.edit.data)))...)
+	}
+	copy(fh.edit.data[offset:], data)
+	fh.edit.changed = true
+	return len(data), nil
+}
+
+// saveDescription stores the content written to the
+// .description file in the database, or applies the
+// changes written to the .tracks file.
+func (fh *FileHandle) saveDescription(ctx context.Context, header fuse.Header) error {
+	if fh.edit == nil {
+		return nil
+	}
+
+	descriptionEdits.Lock()
+	data := append([]byte(nil), fh.edit.data...)
+	changed := fh.edit.changed
+	fh.edit.changed = false
+	descriptionEdits.Unlock()
+
+	if fh.f.isPlaylistInfo() {
+		return fh.savePlaylistInfo(header, data, changed)
+	}
+	if fh.f.isCrateFile() {
+		return fh.saveCrate(header, data, changed)
+	}
+
+	path := entryPath(fh.f.artist, fh.f.album, fh.f.name)
+	if fh.f.isTracksFile() {
+		err := fh.saveTracks(ctx, data)
+		forgetAttrs(fh.f.artist, fh.f.album)
+		if changed {
+			audit(header, "retag", err, path)
+		}
+		return err
+	}
+
+	// The error is returned as EIO and kept in the errors file.
+	err := store.UpdateDescription(fh.f.artist, fh.f.album, data)
+	if err != nil {
+		glog.Error(err)
+		return err
+	}
+	if changed {
+		audit(header, "edit", nil, path)
+	}
+	return nil
+}
+
+// endDescriptionEdit stops editing the .description
+// file once all the handles are released.
+func (fh *FileHandle) endDescriptionEdit() {
+	if fh.edit == nil {
+		return
+	}
+
+	descriptionEdits.Lock()
+	defer descriptionEdits.Unlock()
+	fh.edit.open--
+	if fh.edit.open < 1 {
+		delete(descriptionEdits.m, fh.f.editKey())
+	}
+	fh.edit = nil
+}
+
+// fetchDescription completes the .description file with
+// the information from the metadata provider the first
+// time it is read.
+func (f *File) fetchDescription(ctx context.Context) {
+	// The descriptions do not change by reading them
+	// when the stable_files option is used.
+	provider := descriptionProvider()
+	if provider == nil || len(f.artist) < 1 || config_params.stable_files {
+		return
+	}
+
+	fetched, err := store.DescriptionFetched(f.artist, f.album)
+	if err != nil || fetched {
+		return
+	}
+
+	artistName, albumName, err := store.GetDescriptionNames(f.artist, f.album)
+	if err != nil {
+		return
+	}
+
+	// The MusicBrainz identifier read from the tags
+	// is more precise than the names, if it is known.
+	id, _ := store.GetMusicBrainzID(f.artist, f.album)
+
+	// The description is marked as fetched even if the provider
+	// does not find it, to avoid asking again on every read.
+	if len(f.album) < 1 {
+		artistInfo, err := provider.ArtistWithID(ctx, id, artistName)
+		if err != nil {
+			glog.Infof("Cannot fetch the description of %s: %s\n", artistName, err)
+		}
+		if ctx.Err() != nil {
+			return
+		}
+		err = store.SetArtistInfo(f.artist, artistInfo)
+		if err != nil {
+			glog.Error(err)
+		}
+		return
+	}
+
+	albumInfo, err := provider.AlbumWithID(ctx, id, artistName, albumName)
+	if err != nil {
+		glog.Infof("Cannot fetch the description of %s: %s\n", albumName, err)
+	}
+	if ctx.Err() != nil {
+		return
+	}
+	err = store.SetAlbumInfo(f.artist, f.album, albumInfo)
+	if err != nil {
+		glog.Error(err)
+	}
+	f.fetchCover(ctx, id, artistName, albumName)
+}
+
+// fetchCover downloads the front cover of an Album without
+// one from the Cover Art Archive by its MusicBrainz identifier,
+// it is stored as cover.jpg next to the Songs. The source is
+// not modified with the library_only option.
+func (f *File) fetchCover(ctx context.Context, id, artistName, albumName string) {
+	if len(id) < 1 || config_params.library_only {
+		return
+	}
+	if _, err := store.GetAlbumCover(f.artist, f.album); err == nil {
+		return
+	}
+
+	image, err := metadata.CoverArt(ctx, id)
+	if err != nil {
+		glog.Infof("Cannot fetch the cover of %s: %s\n", albumName, err)
+		return
+	}
+
+	d := Dir{artist: f.artist, album: f.album, mPoint: f.mPoint}
+	path := d.sourcePath("cover.jpg")
+	if _, err := os.Stat(path); err == nil {
+		return
+	}
+	err = ioutil.WriteFile(path, image, 0666)
+	if err != nil {
+		glog.Errorf("Cannot store the cover of %s: %s\n", albumName, err)
+		return
+	}
+
+	tags := musicmgr.FileTags{Artist: artistName, Album: albumName}
+	err = store.StoreArtwork(&tags, path)
+	if err == nil {
+		err = store.SetAlbumCover(&tags, path)
+	}
+	if err != nil {
+		glog.Error(err)
+	}
+	forgetAttrs(f.artist, f.album)
+}
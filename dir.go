@@ -17,26 +17,30 @@
 package main
 
 import (
+	"github.com/dankomiocevic/mulifs/musicmgr"
 	"github.com/dankomiocevic/mulifs/store"
-	"io/ioutil"
 	"os"
+	"path"
 	"path/filepath"
-	"runtime"
 
 	"bazil.org/fuse"
 	"bazil.org/fuse/fs"
 	"github.com/golang/glog"
 	"golang.org/x/net/context"
+	"golang.org/x/text/unicode/norm"
 )
 
 // Dir struct specifies a Directory in the
 // filesystem, the Directories can be Artist or Albums.
 // The root Directory that contains all the Artists
 // is also a Directory.
+// The playlists and the playlist folders inside the
+// playlists Directory keep the path of their folder.
 type Dir struct {
 	fs     *FS
 	artist string
 	album  string
+	folder string
 	mPoint string
 }
 
@@ -52,22 +56,224 @@ func (d *Dir) Attr(ctx context.Context, a *fuse.Attr) error {
 		a.Gid = uint32(config_params.gid)
 	}
 	a.Size = 4096
+	a.Nlink = 2
+	if d.isArtistDir() || d.isAlbumDir() {
+		if fi, err := os.Stat(d.sourcePath("")); err == nil {
+			setFileTimes(a, fi)
+		}
+	}
+	d.setCounts(a)
 	return nil
 }
 
+// setCounts reports the links and the size of the root, Artist
+// and Album Directories from their entries: every Directory
+// inside links to it and the size is the amount of entries,
+// or the total size of the Songs with the dir_sizes option.
+func (d *Dir) setCounts(a *fuse.Attr) {
+	var dirs, files int
+	var err error
+	if len(d.artist) < 1 {
+		dirs, files, err = store.CountEntries("", "")
+		for _, e := range rootEntries() {
+			if e.Type == fuse.DT_Dir {
+				dirs++
+			} else {
+				files++
+			}
+		}
+	} else if d.isArtistDir() {
+		dirs, files, err = store.CountEntries(d.artist, "")
+		// The Directory with all the Songs of the Artist.
+		dirs++
+		files += len(d.nfoEntries())
+	} else if d.isAlbumDir() {
+		dirs, files, err = store.CountEntries(d.artist, d.album)
+		// The album.m3u and .tracks files.
+		files += 2 + len(d.nfoEntries())
+	} else {
+		return
+	}
+
+	if err != nil {
+		return
+	}
+
+	a.Nlink = uint32(2 + dirs)
+	a.Size = uint64(dirs + files)
+	if config_params.dir_sizes && len(d.artist) > 0 {
+		a.Size = d.songsSize()
+	}
+}
+
+// songsSize returns the total size of the files of
+// the Songs inside the Artist or Album Directory.
+// The tracks of an Album image share the same file.
+func (d *Dir) songsSize() uint64 {
+	paths, err := store.ListSongPaths(d.artist, d.album)
+	if err != nil {
+		return 0
+	}
+
+	var size uint64
+	seen := make(map[string]bool)
+	for _, p := range paths {
+		if seen[p] {
+			continue
+		}
+		seen[p] = true
+		if fi, err := os.Stat(p); err == nil {
+			size += uint64(fi.Size())
+		}
+	}
+	return size
+}
+
+// allSongsDir is the name of the virtual Directory inside
+// every Artist that lists the Songs from all the Albums.
+// It has a space, so no Album name can be the same.
+const allSongsDir = "_All Songs"
+
 var dirDirs = []fuse.Dirent{
 	{Name: "drop", Type: fuse.DT_Dir},
 	{Name: "playlists", Type: fuse.DT_Dir},
 }
 
-var _ = fs.NodeStringLookuper(&Dir{})
+// normalizeName converts the name to the Unicode NFC form.
+// Some clients (like macOS) send the names decomposed (NFD)
+// while the names in the database are always composed.
+func normalizeName(name string) string {
+	return norm.NFC.String(name)
+}
+
+// resolveName returns the real name of an entry in the
+// Directory when the case insensitive option is enabled.
+// If there is no entry matching the name it is returned
+// without changes. The entries are read from an index of
+// the Directory kept for a few seconds.
+func (d *Dir) resolveName(ctx context.Context, name string) string {
+	if !config_params.case_insensitive {
+		return name
+	}
+
+	realName, ok := d.cachedName(name, func() ([]fuse.Dirent, error) {
+		entries, err := d.readDirAll(ctx)
+		if err == nil && ctx.Err() != nil {
+			err = ctx.Err()
+		}
+		return entries, err
+	})
+	if !ok {
+		return name
+	}
+	return realName
+}
+
+var _ = fs.NodeRequestLookuper(&Dir{})
 
-func (d *Dir) Lookup(ctx context.Context, name string) (fs.Node, error) {
+func (d *Dir) Lookup(ctx context.Context, req *fuse.LookupRequest, resp *fuse.LookupResponse) (fs.Node, error) {
+	name := normalizeName(req.Name)
+	if profiles != nil {
+		// Other users may see a different
+		// Directory, the entry is not cached.
+		resp.EntryValid = 0
+		if err := checkHidden(req.Header, entryPath(d.artist, d.album, name)); err != nil {
+			return nil, err
+		}
+	}
+
+	n, err := d.lookup(ctx, name)
+	if err != nil && config_params.case_insensitive && ctx.Err() == nil {
+		realName := d.resolveName(ctx, name)
+		if realName != name {
+			glog.Infof("Case insensitive Lookup: %s resolved as %s.\n", name, realName)
+			n, err = d.lookup(ctx, realName)
+		}
+	}
+	return n, fsError("lookup", d.auditPath(name), err)
+}
+
+// lookup returns the node for the specified name
+// inside the Directory.
+func (d *Dir) lookup(ctx context.Context, name string) (fs.Node, error) {
 	glog.Infof("Entering Lookup with artist: %s, album: %s and name: %s.\n", d.artist, d.album, name)
+	defer d.rlockAlbumDir()()
+	if d.isView() {
+		if name[0] == '.' && name != positionFileName {
+			return nil, fuse.ENOENT
+		}
+		return views[d.artist].lookup(ctx, d, name)
+	}
+
 	if name == ".description" {
 		return &File{artist: d.artist, album: d.album, song: name, name: name, mPoint: d.mPoint}, nil
 	}
 
+	if name == tracksFileName && d.isAlbumDir() {
+		return &File{artist: d.artist, album: d.album, song: name, name: name, mPoint: d.mPoint}, nil
+	}
+
+	if config_params.nfo && ((name == albumNfoName && d.isAlbumDir()) || (name == artistNfoName && d.isArtistDir())) {
+		return &File{artist: d.artist, album: d.album, song: name, name: name, mPoint: d.mPoint}, nil
+	}
+
+	if _, ok := metadataSong(name); ok && d.isAlbumDir() {
+		return songMetadataFile(d, name)
+	}
+
+	if len(d.artist) < 1 && name == statusFileName {
+		return &File{song: name, name: name, mPoint: d.mPoint}, nil
+	}
+
+	if len(d.artist) < 1 && name == reportFileName {
+		return &File{song: name, name: name, mPoint: d.mPoint}, nil
+	}
+
+	if d.artist == "playlists" && len(d.album) < 1 && name == playlistControlName {
+		return &File{artist: d.artist, song: name, name: name, mPoint: d.mPoint}, nil
+	}
+
+	if d.artist == "playlists" && len(d.album) > 0 && name == playlistInfoName {
+		if _, err := store.GetPlaylistPath(d.album); err != nil {
+			return nil, err
+		}
+		return &File{artist: d.artist, album: d.album, song: name, name: name, mPoint: d.mPoint}, nil
+	}
+
+	if d.isAlbumDir() && !musicmgr.IsMusicFile(name) {
+		if n, err := sidecarFile(d, d.artist, d.album, name); err == nil {
+			return n, nil
+		}
+	}
+
+	if d.isArtistDir() {
+		if n, err := artistImageFile(d, name); err == nil {
+			return n, nil
+		}
+	}
+
+	switch d.entryPolicy(name) {
+	case policyAbsorb:
+		return nil, fuse.ENOENT
+	case policyPassthrough:
+		if d.isAlbumDir() {
+			raw := d.sourceName(name)
+			src, err := os.Stat(d.sourcePath(raw))
+			if err == nil && !src.IsDir() {
+				return &File{artist: d.artist, album: d.album, song: raw, name: raw, mPoint: d.mPoint, policy: policyPassthrough}, nil
+			}
+		}
+		return nil, fuse.ENOENT
+	}
+
+	if d.artist == "drop" && len(d.album) < 1 && name == store.QuarantineDir {
+		return &Dir{fs: d.fs, artist: "drop", album: name, mPoint: d.mPoint}, nil
+	}
+
+	if len(d.artist) < 1 && name == mulifsDirName {
+		return &Dir{fs: d.fs, artist: name, album: "", mPoint: d.mPoint}, nil
+	}
+
 	if name[0] == '.' {
 		return nil, fuse.EIO
 	}
@@ -79,6 +285,12 @@ func (d *Dir) Lookup(ctx context.Context, name string) (fs.Node, error) {
 		if name == "playlists" {
 			return &Dir{fs: d.fs, artist: "playlists", album: "", mPoint: d.mPoint}, nil
 		}
+		if _, ok := views[name]; ok {
+			return &Dir{fs: d.fs, artist: name, album: "", mPoint: d.mPoint}, nil
+		}
+		if _, ok := dropTargets[name]; ok {
+			return &Dir{fs: d.fs, artist: name, album: "", mPoint: d.mPoint}, nil
+		}
 
 		_, err := store.GetArtistPath(name)
 		if err != nil {
@@ -88,7 +300,15 @@ func (d *Dir) Lookup(ctx context.Context, name string) (fs.Node, error) {
 		return &Dir{fs: d.fs, artist: name, album: "", mPoint: d.mPoint}, nil
 	}
 
+	if d.isDropTarget() {
+		return d.lookupDropTarget(name)
+	}
+
 	if len(d.album) < 1 && d.artist != "drop" && d.artist != "playlists" {
+		if name == allSongsDir {
+			return &Dir{fs: d.fs, artist: d.artist, album: name, mPoint: d.mPoint}, nil
+		}
+
 		_, err := store.GetAlbumPath(d.artist, name)
 		if err != nil {
 			glog.Info(err)
@@ -97,33 +317,57 @@ func (d *Dir) Lookup(ctx context.Context, name string) (fs.Node, error) {
 		return &Dir{fs: d.fs, artist: d.artist, album: name, mPoint: d.mPoint}, nil
 	}
 
+	if d.album == allSongsDir && d.artist != "drop" && d.artist != "playlists" {
+		songs, err := store.ListArtistSongs(d.artist)
+		if err != nil {
+			glog.Info(err)
+			return nil, err
+		}
+
+		for _, s := range songs {
+			if s.Name == name {
+				extension := filepath.Ext(s.Song)
+				songName := s.Song[:len(s.Song)-len(extension)]
+				return &File{artist: d.artist, album: s.Album, song: songName, name: s.Song, mPoint: d.mPoint}, nil
+			}
+		}
+		return nil, fuse.ENOENT
+	}
+
 	var err error
-	if d.artist == "drop" {
+	if d.isQuarantine() {
+		_, err = store.GetQuarantineFilePath(name, d.mPoint)
+		if err != nil {
+			glog.Info(err)
+			return nil, err
+		}
+	} else if d.artist == "drop" {
 		_, err = store.GetDropFilePath(name, d.mPoint)
 		if err != nil {
 			glog.Info(err)
-			return nil, fuse.ENOENT
+			return nil, err
 		}
 	} else if d.artist == "playlists" {
-		if len(d.album) < 1 {
-			_, err = store.GetPlaylistPath(name)
-			if err != nil {
-				glog.Info(err)
-				return nil, fuse.ENOENT
-			}
-			return &Dir{fs: d.fs, artist: d.artist, album: name, mPoint: d.mPoint}, nil
-		} else {
+		if folder, ok := d.playlistFolderPath(); ok {
+			return d.lookupPlaylistFolder(folder, name)
+		} else if _, ok := cachedAttrs(d.artist, d.album, name); !ok {
 			_, err = store.GetPlaylistFilePath(d.album, name, d.mPoint)
 			if err != nil {
 				glog.Info(err)
-				return nil, fuse.ENOENT
+				return nil, err
 			}
 		}
 	} else {
-		_, err = store.GetFilePath(d.artist, d.album, name)
-		if err != nil {
-			glog.Info(err)
-			return nil, err
+		if name == albumPlaylistName {
+			return &File{artist: d.artist, album: d.album, song: name, name: name, mPoint: d.mPoint}, nil
+		}
+
+		if _, ok := cachedAttrs(d.artist, d.album, name); !ok {
+			_, err = store.GetFilePath(d.artist, d.album, name)
+			if err != nil {
+				glog.Info(err)
+				return nil, err
+			}
 		}
 	}
 	extension := filepath.Ext(name)
@@ -134,20 +378,32 @@ func (d *Dir) Lookup(ctx context.Context, name string) (fs.Node, error) {
 var _ = fs.HandleReadDirAller(&Dir{})
 
 func (d *Dir) ReadDirAll(ctx context.Context) ([]fuse.Dirent, error) {
+	a, err := d.readDirAll(ctx)
+	return a, fsError("readdir", d.auditPath(""), err)
+}
+
+// readDirAll lists the entries of the Directory.
+func (d *Dir) readDirAll(ctx context.Context) ([]fuse.Dirent, error) {
 	glog.Infof("Entering ReadDirAll\n")
+	defer d.rlockAlbumDir()()
 	if len(d.artist) < 1 {
 		a, err := store.ListArtists()
 		if err != nil {
-			return nil, fuse.ENOENT
-		}
-		for _, v := range dirDirs {
-			a = append(a, v)
+			return nil, err
 		}
-		return a, nil
+		return append(a, rootEntries()...), nil
+	}
+
+	if d.isView() {
+		return views[d.artist].list(ctx, d)
+	}
+
+	if d.isDropTarget() {
+		return d.listDropTarget(), nil
 	}
 
 	if d.artist == "drop" {
-		if len(d.album) > 0 {
+		if len(d.album) > 0 && !d.isQuarantine() {
 			return nil, fuse.ENOENT
 		}
 
@@ -157,6 +413,10 @@ func (d *Dir) ReadDirAll(ctx context.Context) ([]fuse.Dirent, error) {
 		}
 
 		path := rootPoint + "drop"
+		if d.isQuarantine() {
+			return listDropDir(path + "/" + store.QuarantineDir), nil
+		}
+
 		// Check if the drop directory exists
 		src, err := os.Stat(path)
 		if err != nil {
@@ -168,54 +428,103 @@ func (d *Dir) ReadDirAll(ctx context.Context) ([]fuse.Dirent, error) {
 			return nil, nil
 		}
 
-		var a []fuse.Dirent
-		files, _ := ioutil.ReadDir(path)
-		for _, f := range files {
-			var node fuse.Dirent
-			node.Name = f.Name()
-			node.Type = fuse.DT_File
-			a = append(a, node)
+		a := listDropDir(path)
+		src, err = os.Stat(path + "/" + store.QuarantineDir)
+		if err == nil && src.IsDir() {
+			a = append(a, fuse.Dirent{Name: store.QuarantineDir, Type: fuse.DT_Dir})
 		}
 		return a, nil
 	}
 
 	if d.artist == "playlists" {
-		if len(d.album) < 1 {
-			a, err := store.ListPlaylists()
-			if err != nil {
-				return nil, fuse.ENOENT
-			}
-			return a, nil
+		if folder, ok := d.playlistFolderPath(); ok {
+			return store.ListPlaylistFolder(folder)
 		}
 
 		a, err := store.ListPlaylistSongs(d.album, d.mPoint)
 		if err != nil {
-			return nil, fuse.ENOENT
+			return nil, err
 		}
 
-		return a, nil
+		return append(a, fuse.Dirent{Name: playlistInfoName, Type: fuse.DT_File}), nil
 	}
 
 	if len(d.album) < 1 {
 		a, err := store.ListAlbums(d.artist)
 		if err != nil {
-			return nil, fuse.ENOENT
+			return nil, err
+		}
+		a = append(a, fuse.Dirent{Name: allSongsDir, Type: fuse.DT_Dir})
+		if imageName, _, err := store.GetArtistImage(d.artist); err == nil {
+			a = append(a, fuse.Dirent{Name: imageName, Type: fuse.DT_File})
+		}
+		return append(a, d.nfoEntries()...), nil
+	}
+
+	if d.album == allSongsDir {
+		songs, err := store.ListArtistSongs(d.artist)
+		if err != nil {
+			return nil, err
+		}
+
+		var a []fuse.Dirent
+		for _, s := range songs {
+			a = append(a, fuse.Dirent{Name: s.Name, Type: fuse.DT_File})
 		}
 		return a, nil
 	}
 
 	a, err := store.ListSongs(d.artist, d.album)
 	if err != nil {
-		return nil, fuse.ENOENT
+		return nil, err
 	}
 
-	return a, nil
+	a = withoutHidden(a, hiddenVersions(d.artist, d.album))
+	return append(a, d.albumEntries()...), nil
+}
+
+// rootEntries returns the entries listed in the root
+// Directory after the Artists.
+func rootEntries() []fuse.Dirent {
+	var a []fuse.Dirent
+	for _, v := range dirDirs {
+		a = append(a, v)
+	}
+	a = append(a, viewDirents()...)
+	a = append(a, dropTargetEntries()...)
+	a = append(a, fuse.Dirent{Name: statusFileName, Type: fuse.DT_File})
+	a = append(a, fuse.Dirent{Name: reportFileName, Type: fuse.DT_File})
+	return a
+}
+
+// albumEntries returns the entries listed in an
+// Album Directory after the Songs.
+func (d *Dir) albumEntries() []fuse.Dirent {
+	var a []fuse.Dirent
+	a = append(a, fuse.Dirent{Name: albumPlaylistName, Type: fuse.DT_File})
+	a = append(a, fuse.Dirent{Name: tracksFileName, Type: fuse.DT_File})
+	a = append(a, d.listPassthroughFiles()...)
+	a = append(a, listSidecars(d.artist, d.album)...)
+	return append(a, d.nfoEntries()...)
 }
 
 var _ = fs.NodeMkdirer(&Dir{})
 
 func (d *Dir) Mkdir(ctx context.Context, req *fuse.MkdirRequest) (fs.Node, error) {
-	name := req.Name
+	defer forgetNames()
+	n, err := d.mkdir(ctx, req)
+	audit(req.Header, d.auditOp("mkdir"), err, d.auditPath(req.Name))
+	return n, fsError("mkdir", d.auditPath(req.Name), err)
+}
+
+// mkdir creates the Artist, Album or
+// playlist Directory inside the Directory.
+func (d *Dir) mkdir(ctx context.Context, req *fuse.MkdirRequest) (fs.Node, error) {
+	if err := checkWritable(req.Header); err != nil {
+		return nil, err
+	}
+
+	name := normalizeName(req.Name)
 	glog.Infof("Entering mkdir with name: %s.\n", name)
 	// Do not allow creating directories starting with dot
 	if name[0] == '.' {
@@ -226,7 +535,22 @@ func (d *Dir) Mkdir(ctx context.Context, req *fuse.MkdirRequest) (fs.Node, error
 	if d.mPoint[len(d.mPoint)-1] != '/' {
 		d.mPoint = d.mPoint + "/"
 	}
+	if d.artist == cratesDirName && d.isView() {
+		return d.mkdirCrate(name)
+	}
+
+	if d.isView() {
+		return nil, fuse.EPERM
+	}
+
 	if len(d.artist) < 1 {
+		if _, ok := views[name]; ok {
+			return nil, fuse.EEXIST
+		}
+		if isDropName(name) {
+			return nil, fuse.EEXIST
+		}
+
 		glog.Info("Creating an Artist.")
 		ret, err := store.CreateArtist(name)
 		if err != nil {
@@ -247,25 +571,22 @@ func (d *Dir) Mkdir(ctx context.Context, req *fuse.MkdirRequest) (fs.Node, error
 		return nil, fuse.EIO
 	}
 
-	if d.artist == "playlists" {
-		if len(d.album) < 1 {
-			ret, err := store.CreatePlaylist(name, d.mPoint)
-			if err != nil {
-				glog.Infof("Error creating playlist: %s\n", err)
-				return nil, err
-			}
+	if d.isDropTarget() {
+		return d.mkdirDropTarget(name)
+	}
 
-			err = store.RegeneratePlaylistFile(ret, d.mPoint)
-			if err != nil {
-				glog.Infof("Error regenerating playlist: %s\n", err)
-				return nil, err
-			}
-			return &Dir{fs: d.fs, artist: "playlists", album: ret, mPoint: d.mPoint}, nil
+	if d.artist == "playlists" {
+		if folder, ok := d.playlistFolderPath(); ok {
+			return d.mkdirPlaylist(folder, name)
 		}
-		return nil, fuse.EPERM
+		return d.mkdirPlaylistFolder(name)
 	}
 
 	if len(d.album) < 1 {
+		if name == allSongsDir {
+			return nil, fuse.EEXIST
+		}
+
 		glog.Infof("Creating album: %s in artist: %s.\n", d.artist, name)
 		ret, err := store.CreateAlbum(d.artist, name)
 		if err != nil {
@@ -286,7 +607,26 @@ func (d *Dir) Mkdir(ctx context.Context, req *fuse.MkdirRequest) (fs.Node, error
 var _ = fs.NodeCreater(&Dir{})
 
 func (d *Dir) Create(ctx context.Context, req *fuse.CreateRequest, resp *fuse.CreateResponse) (fs.Node, fs.Handle, error) {
+	defer forgetNames()
+	n, h, err := d.create(ctx, req, resp)
+	forgetAttrs(d.artist, d.album)
+	if err == nil && h != nil {
+		countHandle(1)
+	}
+
+	// The dropped files are audited once they are filed.
+	if !isDropName(d.artist) {
+		audit(req.Header, d.auditOp("create"), err, d.auditPath(req.Name))
+	}
+	return n, h, fsError("create", d.auditPath(req.Name), err)
+}
+
+// create creates a file inside the Directory.
+func (d *Dir) create(ctx context.Context, req *fuse.CreateRequest, resp *fuse.CreateResponse) (fs.Node, fs.Handle, error) {
 	glog.Infof("Entered Create Dir\n")
+	if err := checkWritable(req.Header); err != nil {
+		return nil, nil, err
+	}
 
 	if req.Flags.IsReadOnly() {
 		glog.Info("Create: File requested is read only.\n")
@@ -298,27 +638,55 @@ func (d *Dir) Create(ctx context.Context, req *fuse.CreateRequest, resp *fuse.Cr
 		glog.Info("Create: File requested is write only.\n")
 	}
 
-	if runtime.GOOS == "darwin" {
-		resp.Flags |= fuse.OpenDirectIO
+	resp.Flags |= openFlags()
+
+	if d.isView() {
+		return nil, nil, fuse.EPERM
 	}
 
-	if d.artist == "drop" {
-		if len(d.album) > 0 {
-			glog.Info("Subdirectories are not allowed in drop folder.")
-			return nil, nil, fuse.EIO
+	switch getFilePolicy(normalizeName(req.Name)) {
+	case policyAbsorb:
+		glog.Infof("Absorbing file: %s\n", req.Name)
+		name := normalizeName(req.Name)
+		f := &File{artist: d.artist, album: d.album, song: name, name: name, mPoint: d.mPoint, policy: policyAbsorb}
+		return f, &FileHandle{r: nil, f: f}, nil
+	case policyPassthrough:
+		if d.isAlbumDir() {
+			name := d.sourceName(normalizeName(req.Name))
+			err := os.MkdirAll(d.sourcePath(""), 0777)
+			if err != nil {
+				glog.Info("Cannot create folder.")
+				return nil, nil, err
+			}
+
+			fi, err := os.Create(d.sourcePath(name))
+			if err != nil {
+				glog.Infof("Cannot create file: %s\n", err)
+				return nil, nil, err
+			}
+
+			f := &File{artist: d.artist, album: d.album, song: name, name: name, mPoint: d.mPoint, policy: policyPassthrough}
+			return f, &FileHandle{r: fi, f: f}, nil
 		}
+	}
 
-		rootPoint := d.mPoint
-		if rootPoint[len(rootPoint)-1] != '/' {
-			rootPoint = rootPoint + "/"
+	if isDropName(d.artist) {
+		// The files of the extra drop Directories are
+		// dropped inside their subdirectories.
+		if (len(d.album) > 0) != d.isDropTarget() {
+			glog.Info("Subdirectories are not allowed in drop folder.")
+			return nil, nil, fuse.EIO
 		}
 
-		name := req.Name
-		path := rootPoint + "drop/"
+		name := normalizeName(req.Name)
+		path := d.dropPath()
 		extension := filepath.Ext(name)
 
-		if extension != ".mp3" {
-			glog.Info("Only mp3 files are allowed.")
+		// The extra files are accepted to move them to the
+		// quarantine Directory instead of losing them.
+		isExtra := config_params.extras != extrasIgnore && matchPatterns(config_params.extra_files, name)
+		if !musicmgr.IsMusicFile(name) && !isExtra {
+			glog.Info("Only music files are allowed.")
 			return nil, nil, fuse.EIO
 		}
 
@@ -347,29 +715,32 @@ func (d *Dir) Create(ctx context.Context, req *fuse.CreateRequest, resp *fuse.Cr
 			mPoint: d.mPoint,
 		}
 
-		if fi != nil {
-			glog.Infof("Returning file handle for: %s.\n", fi.Name())
-		}
-		return f, &FileHandle{r: fi, f: f}, nil
+		glog.Infof("Returning file handle for: %s.\n", fi.Name())
+		beginUpload(path+name, 0)
+		return f, &FileHandle{r: fi, f: f, upload: path + name}, nil
 	}
 
 	if d.artist == "playlists" {
-		if len(d.album) < 1 {
+		if len(d.album) < 1 || d.isPlaylistFolder() {
 			glog.Info("Files are not allowed outside playlists.")
 			return nil, nil, fuse.EIO
 		}
 
+		if store.IsAutoPlaylist(d.album) {
+			return nil, nil, fuse.EPERM
+		}
+
 		rootPoint := d.mPoint
 		if rootPoint[len(rootPoint)-1] != '/' {
 			rootPoint = rootPoint + "/"
 		}
 
-		name := req.Name
+		name := normalizeName(req.Name)
 		path := rootPoint + "playlists/" + d.album
 		extension := filepath.Ext(name)
 
-		if extension != ".mp3" {
-			glog.Info("Only mp3 files are allowed.")
+		if !musicmgr.IsMusicFile(name) {
+			glog.Info("Only music files are allowed.")
 			return nil, nil, fuse.EIO
 		}
 
@@ -408,7 +779,7 @@ func (d *Dir) Create(ctx context.Context, req *fuse.CreateRequest, resp *fuse.Cr
 		return nil, nil, fuse.EPERM
 	}
 
-	nameRaw := req.Name
+	nameRaw := normalizeName(req.Name)
 	if nameRaw[0] == '.' {
 		glog.Info("Cannot create files starting with dot.")
 		return nil, nil, fuse.EPERM
@@ -448,6 +819,18 @@ func (d *Dir) Create(ctx context.Context, req *fuse.CreateRequest, resp *fuse.Cr
 		mPoint: d.mPoint,
 	}
 
+	// The new Song is written to a temporary file and
+	// stored in the Album once it is complete.
+	if f.useWriteBuffer() {
+		fi.Close()
+		tmp, err := openWriteBuffer(path+name, fuse.OpenTruncate)
+		if err != nil {
+			glog.Infof("Cannot create file: %s\n", err)
+			return nil, nil, err
+		}
+		return f, &FileHandle{r: tmp, f: f, songPath: path + name, created: true}, nil
+	}
+
 	if fi != nil {
 		glog.Infof("Returning file handle for: %s.\n", fi.Name())
 	}
@@ -457,25 +840,82 @@ func (d *Dir) Create(ctx context.Context, req *fuse.CreateRequest, resp *fuse.Cr
 var _ = fs.NodeRemover(&Dir{})
 
 func (d *Dir) Remove(ctx context.Context, req *fuse.RemoveRequest) error {
-	//TODO: Correct this function to work with drop folder.
-	name := req.Name
+	defer forgetNames()
+	err := d.remove(ctx, req)
+	forgetAttrs(d.artist, d.album)
+	audit(req.Header, d.auditOp("delete"), err, d.auditPath(req.Name))
+	return fsError("remove", d.auditPath(req.Name), err)
+}
+
+// remove removes a file or a Directory
+// inside the Directory.
+func (d *Dir) remove(ctx context.Context, req *fuse.RemoveRequest) error {
+	if err := checkWritable(req.Header); err != nil {
+		return err
+	}
+
+	name := d.resolveName(ctx, normalizeName(req.Name))
 	glog.Infof("Entered Remove function with Artist: %s, Album: %s and Name: %s.\n", d.artist, d.album, name)
 
 	if name == ".description" {
 		return nil
 	}
 
+	if !req.Dir {
+		switch getFilePolicy(name) {
+		case policyAbsorb:
+			return nil
+		case policyPassthrough:
+			if d.isAlbumDir() {
+				if config_params.library_only {
+					return fuse.EPERM
+				}
+				return os.Remove(d.sourcePath(d.sourceName(name)))
+			}
+		}
+	}
+
 	if name[0] == '.' {
 		return fuse.EIO
 	}
 
+	if d.artist == missingDirName && d.isView() {
+		return purgeMissing(name)
+	}
+
+	if d.artist == cratesDirName && d.isView() {
+		return d.removeCrateEntry(name, req.Dir)
+	}
+
+	if d.isView() {
+		return fuse.EPERM
+	}
+
+	if d.isQuarantine() && !req.Dir {
+		return store.DeleteQuarantined(name, d.mPoint)
+	}
+
+	if d.isDropTarget() {
+		return d.removeDropTarget(name, req.Dir)
+	}
+
+	// The incomplete files can be removed from the drop
+	// Directory instead of resuming their copy.
+	if d.artist == "drop" && len(d.album) < 1 && !req.Dir {
+		path, err := store.GetDropFilePath(name, d.mPoint)
+		if err != nil {
+			return err
+		}
+		return os.Remove(path)
+	}
+
 	if req.Dir {
 		if len(name) < 1 {
 			return fuse.EIO
 		}
 
 		if len(d.artist) < 1 {
-			if name == "drop" {
+			if isDropName(name) {
 				return fuse.EIO
 			}
 
@@ -483,35 +923,91 @@ func (d *Dir) Remove(ctx context.Context, req *fuse.RemoveRequest) error {
 				return fuse.EIO
 			}
 
-			err := store.DeleteArtist(name, d.mPoint)
+			if _, ok := views[name]; ok {
+				return fuse.EIO
+			}
+
+			if err := d.checkRmdir(name); err != nil {
+				return err
+			}
+
+			err := store.DeleteArtist(name, d.mPoint, deleteMode())
 			if err != nil {
 				return fuse.EIO
 			}
 
+			scheduleAutoPlaylists(d.mPoint)
 			return nil
 		}
 
 		if d.artist == "playlists" {
+			folder, ok := d.playlistFolderPath()
+			if ok && store.IsPlaylistFolder(path.Join(folder, name)) {
+				return store.DeletePlaylistFolder(folder, name, d.mPoint)
+			}
+
+			if store.IsAutoPlaylist(name) {
+				return fuse.EPERM
+			}
+
 			store.DeletePlaylist(name, d.mPoint)
 			return nil
 		}
 
-		err := store.DeleteAlbum(d.artist, name, d.mPoint)
+		if name == allSongsDir {
+			return fuse.EPERM
+		}
+
+		if err := d.checkRmdir(name); err != nil {
+			return err
+		}
+
+		err := store.DeleteAlbum(d.artist, name, d.mPoint, deleteMode())
 		if err != nil {
 			return fuse.EIO
 		}
 
+		scheduleAutoPlaylists(d.mPoint)
 		return nil
 	} else {
 		if len(d.artist) < 1 || len(d.album) < 1 {
 			return fuse.EIO
 		}
 
+		if name == albumPlaylistName && d.artist != "playlists" {
+			return fuse.EPERM
+		}
+
+		if name == albumNfoName && config_params.nfo && d.isAlbumDir() {
+			return fuse.EPERM
+		}
+
+		if d.artist == "playlists" && store.IsAutoPlaylist(d.album) {
+			return fuse.EPERM
+		}
+
+		if d.artist == "playlists" && store.IsQueue(d.album) {
+			err := store.PopQueueSong(name, d.mPoint)
+			if err != nil {
+				return fuse.EIO
+			}
+			return nil
+		}
+
+		if d.album == allSongsDir && d.artist != "playlists" {
+			return fuse.EPERM
+		}
+
 		fullPath, err := store.GetFilePath(d.artist, d.album, name)
 		if err != nil {
 			return fuse.EIO
 		}
 
+		// The tracks share the file of the album image.
+		if d.artist != "playlists" && isAlbumTrack(d.artist, d.album, name) {
+			return fuse.EPERM
+		}
+
 		if d.artist == "playlists" {
 			err := store.DeletePlaylistSong(d.album, name, false)
 			if err != nil {
@@ -519,19 +1015,28 @@ func (d *Dir) Remove(ctx context.Context, req *fuse.RemoveRequest) error {
 			}
 		}
 
+		unlock := store.LockSong(d.artist, d.album, name)
 		err = store.DeleteSong(d.artist, d.album, name, d.mPoint)
+		unlock()
 		if err != nil {
 			return fuse.EIO
 		}
+		scheduleAutoPlaylists(d.mPoint)
 
 		//TODO: Check if there are no more files in the folder
 		//      and delete the folder.
 
+		// The source files are never deleted with library_only.
+		if config_params.library_only {
+			return nil
+		}
+
 		err = os.Remove(fullPath)
 		if err != nil {
 			return err
 		}
 
+		musicmgr.RemoveTagSidecar(fullPath)
 		return nil
 	}
 }
@@ -539,9 +1044,28 @@ func (d *Dir) Remove(ctx context.Context, req *fuse.RemoveRequest) error {
 var _ = fs.NodeRenamer(&Dir{})
 
 func (d *Dir) Rename(ctx context.Context, r *fuse.RenameRequest, newDir fs.Node) error {
+	defer forgetNames()
+	err := d.rename(ctx, r, newDir)
+	forgetAttrs(d.artist, d.album)
+	if newD, ok := newDir.(*Dir); ok {
+		forgetAttrs(newD.artist, newD.album)
+		audit(r.Header, d.auditOp("rename"), err, d.auditPath(r.OldName), newD.auditPath(r.NewName))
+	}
+	return fsError("rename", d.auditPath(r.OldName), err)
+}
+
+// rename moves a file or a Directory inside
+// the Directory to the new Directory.
+func (d *Dir) rename(ctx context.Context, r *fuse.RenameRequest, newDir fs.Node) error {
+	if err := checkWritable(r.Header); err != nil {
+		return err
+	}
+
 	var newD *Dir
 
 	newD = newDir.(*Dir)
+	r.OldName = d.resolveName(ctx, normalizeName(r.OldName))
+	r.NewName = normalizeName(r.NewName)
 	glog.Infof("Renaming: OldName: %s, NewName: %s, newDir: %s/%s\n", r.OldName, r.NewName, newD.artist, newD.album)
 
 	if d.mPoint[len(d.mPoint)-1] != '/' {
@@ -553,28 +1077,95 @@ func (d *Dir) Rename(ctx context.Context, r *fuse.RenameRequest, newDir fs.Node)
 		return fuse.EPERM
 	}
 
+	if r.OldName == tracksFileName || r.NewName == tracksFileName {
+		return fuse.EPERM
+	}
+
+	// The Artist and Album Directories are renamed
+	// whatever their names are.
+	oldPolicy, newPolicy := policyNone, policyNone
+	if !d.isDirEntry(r.OldName) {
+		oldPolicy = getFilePolicy(r.OldName)
+		newPolicy = getFilePolicy(r.NewName)
+	}
+	if oldPolicy == policyAbsorb || newPolicy == policyAbsorb {
+		if oldPolicy == newPolicy {
+			return nil
+		}
+		return fuse.EPERM
+	}
+
+	if oldPolicy == policyPassthrough || newPolicy == policyPassthrough {
+		if oldPolicy != newPolicy || !d.isAlbumDir() || !newD.isAlbumDir() {
+			return fuse.EPERM
+		}
+		return os.Rename(d.sourcePath(d.sourceName(r.OldName)), newD.sourcePath(r.NewName))
+	}
+
 	if r.NewName[0] == '.' || r.OldName[0] == '.' {
 		glog.Info("Names starting with dot are not allowed.")
 		return fuse.EPERM
 	}
 
+	if d.artist == genresViewDir && newD.artist == genresViewDir && config_params.genres {
+		return d.moveGenreSong(r.OldName, newD, r.NewName)
+	}
+
+	if d.isView() || newD.isView() {
+		glog.Info("Views are read only.")
+		return fuse.EPERM
+	}
+
 	if len(d.artist) < 1 {
 		glog.Info("Changing artist name.")
 		if len(newD.artist) > 0 {
 			return fuse.EPERM
 		}
 
-		err := store.MoveArtist(r.OldName, r.NewName, d.mPoint)
+		err := renameDir(r.OldName, r.NewName, func(progress store.RenameProgress) error {
+			return store.MoveArtist(ctx, r.OldName, r.NewName, d.mPoint, progress)
+		})
+		if err == nil {
+			scheduleAutoPlaylists(d.mPoint)
+		}
 		return err
 	}
 
-	if d.artist == "drop" {
+	// The quarantined files can be moved back to
+	// the drop folder to be processed again.
+	if d.isQuarantine() && newD.artist == "drop" && len(newD.album) < 1 {
+		err := store.RedropQuarantined(r.OldName, r.NewName, d.mPoint)
+		if err != nil {
+			return err
+		}
+		PushFileItem(File{artist: "drop", name: r.NewName, mPoint: d.mPoint}, dropHandler(r.Header))
+		return nil
+	}
+
+	if isDropName(d.artist) || newD.isDropTarget() {
 		glog.Info("Cannot rename inside drop folder.")
 		return fuse.EPERM
 	}
 
 	if d.artist == "playlists" {
 		glog.Info("Rename inside playlists folder.")
+		// The auto playlists are read only.
+		if store.IsAutoPlaylist(d.album) || store.IsAutoPlaylist(newD.album) {
+			return fuse.EPERM
+		}
+		if len(d.album) < 1 && store.IsAutoPlaylist(r.OldName) {
+			return fuse.EPERM
+		}
+
+		if folder, ok := d.playlistFolderPath(); ok {
+			if newFolder, ok := newD.playlistFolderPath(); ok {
+				return d.renamePlaylistEntry(folder, r.OldName, newFolder, r.NewName)
+			}
+			if len(d.album) > 0 {
+				return fuse.EPERM
+			}
+		}
+
 		var err error
 		if len(d.album) < 1 {
 			glog.Info("Rename playlist name.")
@@ -594,7 +1185,7 @@ func (d *Dir) Rename(ctx context.Context, r *fuse.RenameRequest, newDir fs.Node)
 			return nil
 		}
 
-		_, err = store.RenamePlaylistSong(d.album, r.OldName, r.NewName, d.mPoint)
+		_, err = store.RenamePlaylistSong(ctx, d.album, r.OldName, r.NewName, d.mPoint)
 		if err != nil {
 			return fuse.EIO
 		}
@@ -607,19 +1198,43 @@ func (d *Dir) Rename(ctx context.Context, r *fuse.RenameRequest, newDir fs.Node)
 		return nil
 	}
 
+	if r.OldName == albumPlaylistName || r.NewName == albumPlaylistName {
+		glog.Info("Cannot rename the album playlist.")
+		return fuse.EPERM
+	}
+
+	if d.album == allSongsDir || newD.album == allSongsDir || r.OldName == allSongsDir || r.NewName == allSongsDir {
+		glog.Info("Cannot rename inside the all songs folder.")
+		return fuse.EPERM
+	}
+
 	if len(d.album) < 1 {
 		glog.Info("Moving album")
 		if len(newD.album) > 0 {
 			return fuse.EPERM
 		}
 
-		err := store.MoveAlbum(d.artist, r.OldName, newD.artist, r.NewName, d.mPoint)
+		err := renameDir(d.artist+"/"+r.OldName, newD.artist+"/"+r.NewName, func(progress store.RenameProgress) error {
+			return store.MoveAlbum(ctx, d.artist, r.OldName, newD.artist, r.NewName, d.mPoint, progress)
+		})
+		if err == nil {
+			scheduleAutoPlaylists(d.mPoint)
+		}
 		return err
 	}
 
-	_, err := store.MoveSongs(d.artist, d.album, r.OldName, newD.artist, newD.album, r.NewName, path, d.mPoint)
+	if isAlbumTrack(d.artist, d.album, r.OldName) {
+		glog.Info("The tracks of the album images are read only.")
+		return fuse.EPERM
+	}
+
+	_, err := store.MoveSongs(ctx, d.artist, d.album, r.OldName, newD.artist, newD.album, r.NewName, path, d.mPoint)
 	if err != nil {
+		if ctx.Err() != nil {
+			return fuse.EINTR
+		}
 		return fuse.EIO
 	}
+	scheduleAutoPlaylists(d.mPoint)
 	return nil
 }
@@ -0,0 +1,63 @@
+// Copyright 2016 Danko Miocevic. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Author: Danko Miocevic
+
+package main
+
+import (
+	"testing"
+
+	"bazil.org/fuse"
+	"golang.org/x/net/context"
+)
+
+func hasEntry(entries []fuse.Dirent, name string) bool {
+	for _, e := range entries {
+		if e.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+func TestAllSongsDirKeepsAlbums(t *testing.T) {
+	// The Album tag " all" is stored as _all.
+	root := testLibrary(t, "Artist/_all/One.wav", "Artist/Other/Two.wav")
+	d := &Dir{artist: "Artist", album: "", mPoint: root}
+
+	album, err := d.lookup(context.Background(), "_all")
+	if err != nil {
+		t.Fatal(err)
+	}
+	entries, err := album.(*Dir).ReadDirAll(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !hasEntry(entries, "One.wav") || hasEntry(entries, "Two.wav") {
+		t.Errorf("the _all Album lists %v", entries)
+	}
+
+	all, err := d.lookup(context.Background(), allSongsDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	entries, err = all.(*Dir).ReadDirAll(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !hasEntry(entries, "One.wav") || !hasEntry(entries, "Two.wav") {
+		t.Errorf("the all songs Directory lists %v", entries)
+	}
+}
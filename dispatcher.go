@@ -34,6 +34,11 @@ type FileItem struct {
 
 var fileItems []FileItem
 var fChannel chan FileItem
+var flushChannel chan chan bool
+
+// flushing is set while the pending items are
+// flushed, they cannot wait any longer then.
+var flushing bool
 
 /** InitDispatcher initializes the
  *  lists and channels to connect to the
@@ -42,6 +47,7 @@ var fChannel chan FileItem
 func InitDispatcher() {
 	fileItems = make([]FileItem, 0, 20)
 	fChannel = make(chan FileItem, 10)
+	flushChannel = make(chan chan bool)
 
 	go processMsgs()
 }
@@ -78,7 +84,7 @@ func addFile(f FileItem) {
  *  from the list.
  */
 func cleanLists() {
-	timeout := time.Now().Add(time.Second * -3)
+	timeout := time.Now().Add(-settleDelay())
 	for i := len(fileItems) - 1; i >= 0; i-- {
 		item := fileItems[i]
 		if item.Touched.Before(timeout) {
@@ -90,17 +96,53 @@ func cleanLists() {
 	}
 }
 
+/** flushLists runs the action over all the
+ *  pending file elements without waiting
+ *  for them to time out, including the ones
+ *  still waiting in the channel.
+ */
+func flushLists() {
+	for len(fChannel) > 0 {
+		addFile(<-fChannel)
+	}
+
+	flushing = true
+	defer func() { flushing = false }()
+
+	for _, item := range fileItems {
+		if item.Fn != nil {
+			item.Fn(item.FileObject)
+		}
+	}
+	fileItems = fileItems[:0]
+}
+
+/** settleDelay returns the time a file must
+ *  not be touched before its action runs,
+ *  it is set with the drop_settle option.
+ */
+func settleDelay() time.Duration {
+	if config_params.drop_settle < 0 {
+		return 0
+	}
+	return time.Duration(config_params.drop_settle) * time.Second
+}
+
 /** processMsgs receives all the messages
  *  from the channels and process them.
  *  This is the main loop of the dispatcher.
  */
 func processMsgs() {
+	tick := time.NewTicker(time.Second)
 	for {
 		select {
 		case res := <-fChannel:
 			addFile(res)
-		case <-time.After(time.Second * 3):
+		case <-tick.C:
 			cleanLists()
+		case done := <-flushChannel:
+			flushLists()
+			close(done)
 		}
 	}
 }
@@ -119,3 +161,18 @@ func PushFileItem(f File, fn func(File) error) {
 	}
 	fChannel <- fileItem
 }
+
+/** FlushDispatcher processes all the pending
+ *  events and returns once they are finished.
+ *  It is used to stop MuLi without leaving
+ *  half processed files.
+ */
+func FlushDispatcher() {
+	if flushChannel == nil {
+		return
+	}
+
+	done := make(chan bool)
+	flushChannel <- done
+	<-done
+}
@@ -0,0 +1,231 @@
+// Copyright 2016 Danko Miocevic. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Author: Danko Miocevic
+
+package main
+
+import (
+	"errors"
+	"github.com/dankomiocevic/mulifs/playlistmgr"
+	"github.com/dankomiocevic/mulifs/store"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"bazil.org/fuse"
+	"bazil.org/fuse/fs"
+	"github.com/golang/glog"
+)
+
+// The actions applied to the Songs filed
+// from the extra drop Directories.
+const (
+	// dropToPlaylist adds the Songs to the playlist
+	// named like the subdirectory.
+	dropToPlaylist = "playlist"
+	// dropToGenre writes the name of the
+	// subdirectory as the genre of the Songs.
+	dropToGenre = "genre"
+)
+
+// dropTargets maps the names of the extra drop
+// Directories shown in the root to their actions.
+var dropTargets = map[string]string{}
+
+// setDropTargets sets the extra drop Directories
+// from the NAME=ACTION items of the drop_targets option.
+func setDropTargets() error {
+	for _, item := range config_params.drop_targets {
+		items := strings.SplitN(item, "=", 2)
+		if len(items) != 2 {
+			return errors.New("Error in drop_targets, it must be NAME=ACTION")
+		}
+
+		name := strings.TrimSpace(items[0])
+		action := strings.TrimSpace(items[1])
+		if action != dropToPlaylist && action != dropToGenre {
+			return errors.New("Error in drop_targets, the action must be playlist or genre")
+		}
+
+		_, isView := views[name]
+		if len(name) < 1 || name[0] == '.' || strings.Contains(name, "/") || isView ||
+			isDropName(name) || name == "playlists" || name == store.QuarantineDir ||
+			name == mulifsDirName || name == statusFileName || name == reportFileName {
+			return errors.New("Error in drop_targets, the name " + name + " is reserved")
+		}
+		dropTargets[name] = action
+	}
+	return nil
+}
+
+// isDropName returns true if the name is the drop
+// Directory or one of the extra drop Directories.
+func isDropName(name string) bool {
+	if name == "drop" {
+		return true
+	}
+	_, ok := dropTargets[name]
+	return ok
+}
+
+// isDropTarget returns true if the Directory is one
+// of the extra drop Directories or is inside one.
+func (d *Dir) isDropTarget() bool {
+	_, ok := dropTargets[d.artist]
+	return ok
+}
+
+// isDropped returns true if the File is inside the drop
+// Directory or inside one of the extra drop Directories.
+func (f *File) isDropped() bool {
+	return isDropName(f.artist)
+}
+
+// dropName returns the path of a dropped File
+// relative to the drop folder in the source.
+func (f *File) dropName() string {
+	if _, ok := dropTargets[f.artist]; ok {
+		return f.artist + "/" + f.album + "/" + f.name
+	}
+	return f.name
+}
+
+// dropPath returns the path in the source where the
+// files created inside the drop Directory are stored.
+func (d *Dir) dropPath() string {
+	rootPoint := d.mPoint
+	if rootPoint[len(rootPoint)-1] != '/' {
+		rootPoint = rootPoint + "/"
+	}
+
+	if d.isDropTarget() {
+		if len(d.album) < 1 {
+			return rootPoint + "drop/" + d.artist + "/"
+		}
+		return rootPoint + "drop/" + d.artist + "/" + d.album + "/"
+	}
+	return rootPoint + "drop/"
+}
+
+// dropTargetEntries returns the extra drop
+// Directories listed in the root Directory.
+func dropTargetEntries() []fuse.Dirent {
+	var a []fuse.Dirent
+	for name := range dropTargets {
+		a = append(a, fuse.Dirent{Name: name, Type: fuse.DT_Dir})
+	}
+	return a
+}
+
+// lookupDropTarget returns the subdirectory of an extra
+// drop Directory or the file dropped inside it.
+func (d *Dir) lookupDropTarget(name string) (fs.Node, error) {
+	src, err := os.Stat(d.dropPath() + name)
+	if err != nil {
+		return nil, fuse.ENOENT
+	}
+
+	if len(d.album) < 1 {
+		if !src.IsDir() {
+			return nil, fuse.ENOENT
+		}
+		return &Dir{fs: d.fs, artist: d.artist, album: name, mPoint: d.mPoint}, nil
+	}
+
+	if src.IsDir() {
+		return nil, fuse.ENOENT
+	}
+	return &File{artist: d.artist, album: d.album, song: name, name: name, mPoint: d.mPoint}, nil
+}
+
+// listDropTarget lists the subdirectories of an extra drop
+// Directory or the files waiting inside a subdirectory.
+func (d *Dir) listDropTarget() []fuse.Dirent {
+	if len(d.album) > 0 {
+		return listDropDir(d.dropPath())
+	}
+
+	var a []fuse.Dirent
+	files, _ := ioutil.ReadDir(d.dropPath())
+	for _, f := range files {
+		if f.IsDir() {
+			a = append(a, fuse.Dirent{Name: f.Name(), Type: fuse.DT_Dir})
+		}
+	}
+	return a
+}
+
+// mkdirDropTarget creates a subdirectory inside an extra
+// drop Directory, its name is the playlist or the genre.
+func (d *Dir) mkdirDropTarget(name string) (fs.Node, error) {
+	if len(d.album) > 0 {
+		return nil, fuse.EPERM
+	}
+
+	err := os.MkdirAll(d.dropPath()+name, 0777)
+	if err != nil {
+		glog.Infof("Cannot create dir: %s\n", err)
+		return nil, fuse.EIO
+	}
+	return &Dir{fs: d.fs, artist: d.artist, album: name, mPoint: d.mPoint}, nil
+}
+
+// removeDropTarget removes an empty subdirectory of an
+// extra drop Directory or a file waiting inside it.
+func (d *Dir) removeDropTarget(name string, dir bool) error {
+	if dir != (len(d.album) < 1) {
+		return fuse.EPERM
+	}
+	return os.Remove(d.dropPath() + name)
+}
+
+// applyDropTarget applies the action of the extra drop
+// Directory to the Song filed from the dropped File,
+// the song is the path returned by store.HandleDrop.
+func applyDropTarget(f File, song string) error {
+	action, ok := dropTargets[f.artist]
+	items := strings.SplitN(song, "/", 3)
+	if !ok || len(items) != 3 {
+		return nil
+	}
+
+	switch action {
+	case dropToPlaylist:
+		playlist, err := store.CreatePlaylist(f.album, f.mPoint)
+		if err != nil {
+			return err
+		}
+
+		path, err := store.GetFilePath(items[0], items[1], items[2])
+		if err != nil {
+			return err
+		}
+
+		err = store.AddFileToPlaylist(playlistmgr.PlaylistFile{Title: items[2],
+			Artist: items[0], Album: items[1], Path: path}, playlist)
+		if err != nil {
+			return err
+		}
+
+		err = store.RegeneratePlaylistFile(playlist, f.mPoint)
+		if err != nil {
+			return err
+		}
+		return autoDedup(playlist, f.mPoint)
+	case dropToGenre:
+		return store.SetSongGenre(store.SongRef{Artist: items[0], Album: items[1], Song: items[2]}, f.album)
+	}
+	return nil
+}
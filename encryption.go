@@ -0,0 +1,83 @@
+// Copyright 2016 Danko Miocevic. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Author: Danko Miocevic
+
+package main
+
+import (
+	"bytes"
+	"errors"
+	"github.com/dankomiocevic/mulifs/store"
+	"io/ioutil"
+	"log"
+	"os"
+	"time"
+
+	"github.com/golang/glog"
+)
+
+// passphraseEnv is the environment variable with
+// the passphrase used to encrypt the database.
+const passphraseEnv = "MULIFS_PASSPHRASE"
+
+// dbFlushInterval is the time between the saves
+// of the encrypted database while it is mounted.
+const dbFlushInterval = time.Minute
+
+// setDBEncryption enables the encryption of the database
+// when a key file or a passphrase are provided.
+func setDBEncryption() error {
+	var secret []byte
+	if len(config_params.db_keyfile) > 0 {
+		data, err := ioutil.ReadFile(config_params.db_keyfile)
+		if err != nil {
+			return err
+		}
+		secret = bytes.TrimRight(data, "\r\n")
+	} else {
+		secret = []byte(os.Getenv(passphraseEnv))
+	}
+
+	if len(config_params.db_keyfile) > 0 && len(secret) < 1 {
+		return errors.New("The database key file is empty.")
+	}
+
+	if len(secret) > 0 {
+		store.SetEncryptionSecret(secret)
+	}
+	return nil
+}
+
+// closeDB saves the encrypted database before
+// exiting, the commands must call it.
+func closeDB() {
+	err := store.CloseDB()
+	if err != nil {
+		log.Printf("Cannot save the encrypted database: %s\n", err)
+	}
+}
+
+// startDBFlusher saves the changes of the
+// encrypted database every dbFlushInterval.
+func startDBFlusher() {
+	go func() {
+		for range time.Tick(dbFlushInterval) {
+			err := store.FlushDB()
+			if err != nil {
+				glog.Errorf("Cannot save the encrypted database: %s\n", err)
+			}
+		}
+	}()
+}
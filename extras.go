@@ -0,0 +1,150 @@
+// Copyright 2016 Danko Miocevic. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Author: Danko Miocevic
+
+package main
+
+import (
+	"github.com/dankomiocevic/mulifs/store"
+	"strings"
+
+	"bazil.org/fuse"
+	"bazil.org/fuse/fs"
+	"golang.org/x/net/context"
+)
+
+// The modes to show the extra files (cue sheets, logs,
+// scans, etc.) found next to the music files.
+const (
+	// extrasIgnore does not show the extra files.
+	extrasIgnore = "ignore"
+	// extrasPassthrough shows them inside the Album Directory.
+	extrasPassthrough = "passthrough"
+	// extrasCollect shows them in the extras view.
+	extrasCollect = "collect"
+)
+
+// defaultExtraFiles are the files considered extras by default.
+const defaultExtraFiles = "*.cue;*.log;*.pdf;*.txt;*.jpg;*.png"
+
+// registerExtrasView adds the extras view to the
+// root Directory when the extras are collected.
+func registerExtrasView() {
+	if config_params.extras == extrasCollect {
+		views["extras"] = view{list: listExtrasView, lookup: lookupExtrasView}
+	}
+}
+
+// extraFile returns the read only File node for
+// an extra file of an Album.
+func extraFile(d *Dir, artist, album, name string) (fs.Node, error) {
+	_, err := store.GetExtraPath(artist, album, name)
+	if err != nil {
+		return nil, fuse.ENOENT
+	}
+	return &File{artist: artist, album: album, song: name, name: name, mPoint: d.mPoint, policy: policyExtra}, nil
+}
+
+// artworkFile returns the read only File node for
+// a cover image of an Album.
+func artworkFile(d *Dir, artist, album, name string) (fs.Node, error) {
+	_, err := store.GetArtworkPath(artist, album, name)
+	if err != nil {
+		return nil, fuse.ENOENT
+	}
+	return &File{artist: artist, album: album, song: name, name: name, mPoint: d.mPoint, policy: policyArtwork}, nil
+}
+
+// artistImageFile returns the read only File node
+// for the image of an Artist.
+func artistImageFile(d *Dir, name string) (fs.Node, error) {
+	imageName, _, err := store.GetArtistImage(d.artist)
+	if err != nil || imageName != name {
+		return nil, fuse.ENOENT
+	}
+	return &File{artist: d.artist, song: name, name: name, mPoint: d.mPoint, policy: policyArtistImage}, nil
+}
+
+// sidecarFile returns the cover image or the extra
+// file of an Album shown inside the Album Directories.
+func sidecarFile(d *Dir, artist, album, name string) (fs.Node, error) {
+	n, err := artworkFile(d, artist, album, name)
+	if err == nil || config_params.extras != extrasPassthrough {
+		return n, err
+	}
+	return extraFile(d, artist, album, name)
+}
+
+// listSidecars returns the cover images and the extra
+// files of an Album shown inside the Album Directories.
+func listSidecars(artist, album string) []fuse.Dirent {
+	a, _ := store.ListArtwork(artist, album)
+	if config_params.extras == extrasPassthrough {
+		extras, _ := store.ListExtras(artist, album)
+		a = append(a, extras...)
+	}
+	return a
+}
+
+// listExtrasView lists the Albums with extra files
+// or the extra files inside one of them.
+func listExtrasView(ctx context.Context, d *Dir) ([]fuse.Dirent, error) {
+	if len(d.album) < 1 {
+		albums, err := store.ListExtraAlbums()
+		if err != nil {
+			return nil, fuse.ENOENT
+		}
+
+		var a []fuse.Dirent
+		for _, album := range albums {
+			a = append(a, fuse.Dirent{Name: albumViewName(album.Artist, album.Album), Type: fuse.DT_Dir})
+		}
+		return a, nil
+	}
+
+	items := strings.SplitN(d.album, " - ", 2)
+	if len(items) != 2 {
+		return nil, fuse.ENOENT
+	}
+
+	a, err := store.ListExtras(items[0], items[1])
+	if err != nil {
+		return nil, fuse.ENOENT
+	}
+	return a, nil
+}
+
+// lookupExtrasView returns the Album Directories
+// and the extra files in the extras view.
+func lookupExtrasView(ctx context.Context, d *Dir, name string) (fs.Node, error) {
+	if len(d.album) < 1 {
+		items := strings.SplitN(name, " - ", 2)
+		if len(items) != 2 {
+			return nil, fuse.ENOENT
+		}
+
+		a, err := store.ListExtras(items[0], items[1])
+		if err != nil || len(a) < 1 {
+			return nil, fuse.ENOENT
+		}
+		return &Dir{fs: d.fs, artist: d.artist, album: name, mPoint: d.mPoint}, nil
+	}
+
+	items := strings.SplitN(d.album, " - ", 2)
+	if len(items) != 2 {
+		return nil, fuse.ENOENT
+	}
+	return extraFile(d, items[0], items[1], name)
+}
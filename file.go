@@ -26,8 +26,9 @@ import (
 	"io"
 	"os"
 	"path/filepath"
-	"runtime"
 	"strings"
+	"sync"
+	"time"
 
 	"bazil.org/fuse"
 	"bazil.org/fuse/fs"
@@ -45,6 +46,62 @@ type File struct {
 	song   string
 	name   string
 	mPoint string
+	policy filePolicy
+}
+
+// albumPlaylistName is the name of the virtual
+// playlist file generated inside every Album.
+const albumPlaylistName = "album.m3u"
+
+// isAlbumPlaylist returns true if the File is the
+// virtual playlist inside an Album Directory.
+func (f *File) isAlbumPlaylist() bool {
+	return f.name == albumPlaylistName && len(f.album) > 0 && !f.isDropped() && f.artist != "playlists"
+}
+
+// albumPlaylist returns the contents of the virtual
+// playlist file for the File's Album.
+func (f *File) albumPlaylist() (string, error) {
+	prefix := ""
+	if config_params.album_m3u_absolute {
+		prefix = config_params.mountpoint + "/" + f.artist + "/" + f.album + "/"
+	}
+	return store.GetAlbumPlaylist(f.artist, f.album, prefix)
+}
+
+// sliceRead returns the part of the data requested
+// by a read operation on a virtual file.
+func sliceRead(data []byte, offset int64, size int) []byte {
+	if offset >= int64(len(data)) {
+		return []byte{}
+	}
+	end := offset + int64(size)
+	if end > int64(len(data)) {
+		end = int64(len(data))
+	}
+	return data[offset:end]
+}
+
+// setFileTimes reports the times of the file in the source
+// Directory, so they do not change when MuLi is mounted again.
+func setFileTimes(a *fuse.Attr, fi os.FileInfo) {
+	a.Mtime = fi.ModTime()
+	a.Ctime = fi.ModTime()
+	a.Atime = fi.ModTime()
+}
+
+// setVirtualTimes reports the times of the source Directory
+// of the Album or Artist for the files generated by MuLi
+// when the stable_files option is used.
+func (f *File) setVirtualTimes(a *fuse.Attr) {
+	if !config_params.stable_files {
+		return
+	}
+
+	d := Dir{artist: f.artist, album: f.album, mPoint: f.mPoint}
+	if fi, err := os.Stat(d.sourcePath("")); err == nil {
+		setFileTimes(a, fi)
+	}
 }
 
 /** This function is used to do nothing to the file
@@ -55,16 +112,163 @@ func DelayedVoid(f File) error {
 }
 
 func (f *File) Attr(ctx context.Context, a *fuse.Attr) error {
+	return fsError("getattr", entryPath(f.artist, f.album, f.name), f.attr(ctx, a))
+}
+
+// attr sets the attributes of the File.
+func (f *File) attr(ctx context.Context, a *fuse.Attr) error {
 	glog.Infof("Entering file Attr with name: %s, Artist: %s and Album: %s.\n", f.name, f.artist, f.album)
+	if f.isControl() {
+		a.Size = 0
+		a.Mode = 0222
+		if config_params.uid != 0 {
+			a.Uid = uint32(config_params.uid)
+		}
+		if config_params.gid != 0 {
+			a.Gid = uint32(config_params.gid)
+		}
+		return nil
+	}
+
+	if f.policy == policyAbsorb || f.policy == policyPassthrough || f.isSidecar() {
+		a.Size = 0
+		a.Mode = 0666
+		if f.policy == policyPassthrough || f.isSidecar() {
+			path, err := f.backingPath()
+			if err != nil {
+				return err
+			}
+
+			src, err := os.Stat(path)
+			if err != nil {
+				return err
+			}
+			a.Size = uint64(src.Size())
+			setFileTimes(a, src)
+		}
+
+		if f.isSidecar() {
+			a.Mode = 0444
+		}
+		if config_params.uid != 0 {
+			a.Uid = uint32(config_params.uid)
+		}
+		if config_params.gid != 0 {
+			a.Gid = uint32(config_params.gid)
+		}
+		return nil
+	}
+
+	if f.isStatusFile() || f.isPositionFile() || f.isReportFile() || f.isAuditFile() || f.isMetricsFile() ||
+		f.isSongMetadataFile() || f.isNfoFile() || f.isUndoFile() || f.isMissingFile() || f.isCrateM3u() || f.isErrorsFile() ||
+		f.isIncompleteFile() {
+		if f.isStatusFile() {
+			a.Size = uint64(len(statusContent()))
+		} else if f.isReportFile() {
+			a.Size = uint64(len(scanReport()))
+		} else if f.isAuditFile() {
+			a.Size = uint64(len(auditLog()))
+		} else if f.isMetricsFile() {
+			a.Size = uint64(len(metricsContent()))
+		} else if f.isUndoFile() {
+			a.Size = uint64(len(undoContent()))
+		} else if f.isErrorsFile() {
+			a.Size = uint64(len(errorsContent()))
+		} else if f.isMissingFile() {
+			a.Size = uint64(len(missingContent(f.name)))
+		} else if f.isIncompleteFile() {
+			a.Size = uint64(len(incompleteContent(f.name)))
+		} else if f.isCrateM3u() {
+			a.Size = uint64(len(crateM3u(f.album)))
+		} else if f.isSongMetadataFile() {
+			a.Size = uint64(len(songMetadataContent(f.artist, f.album, f.name)))
+		} else if f.isNfoFile() {
+			a.Size = uint64(len(f.nfoContent()))
+		} else {
+			a.Size = uint64(len(bookPosition(f.artist, f.album)))
+		}
+		a.Mode = 0444
+		if config_params.uid != 0 {
+			a.Uid = uint32(config_params.uid)
+		}
+		if config_params.gid != 0 {
+			a.Gid = uint32(config_params.gid)
+		}
+		return nil
+	}
+
+	if f.isCrateFile() {
+		data, ok := f.getDescriptionEdit()
+		if !ok {
+			var err error
+			data, err = f.editContent()
+			if err != nil {
+				return err
+			}
+		}
+
+		a.Size = uint64(len(data))
+		a.Mode = 0644
+		if config_params.uid != 0 {
+			a.Uid = uint32(config_params.uid)
+		}
+		if config_params.gid != 0 {
+			a.Gid = uint32(config_params.gid)
+		}
+		return nil
+	}
+
+	if f.isAlbumPlaylist() {
+		playlist, err := f.albumPlaylist()
+		if err != nil {
+			return err
+		}
+
+		a.Size = uint64(len(playlist))
+		a.Mode = 0444
+		f.setVirtualTimes(a)
+		if config_params.uid != 0 {
+			a.Uid = uint32(config_params.uid)
+		}
+		if config_params.gid != 0 {
+			a.Gid = uint32(config_params.gid)
+		}
+		return nil
+	}
+
 	if f.name[0] == '.' {
 		if f.name == ".description" {
+			f.fetchDescription(ctx)
 			descriptionJson, err := store.GetDescription(f.artist, f.album, f.name)
 			if err != nil {
 				return err
 			}
 
 			a.Size = uint64(len(descriptionJson))
-			a.Mode = 0444
+			if data, ok := f.getDescriptionEdit(); ok {
+				a.Size = uint64(len(data))
+			}
+			a.Mode = 0644
+			f.setVirtualTimes(a)
+			if config_params.uid != 0 {
+				a.Uid = uint32(config_params.uid)
+			}
+			if config_params.gid != 0 {
+				a.Gid = uint32(config_params.gid)
+			}
+		} else if f.isTracksFile() || f.isPlaylistInfo() {
+			data, ok := f.getDescriptionEdit()
+			if !ok {
+				var err error
+				data, err = f.editContent()
+				if err != nil {
+					return err
+				}
+			}
+
+			a.Size = uint64(len(data))
+			a.Mode = 0644
+			f.setVirtualTimes(a)
 			if config_params.uid != 0 {
 				a.Uid = uint32(config_params.uid)
 			}
@@ -74,17 +278,37 @@ func (f *File) Attr(ctx context.Context, a *fuse.Attr) error {
 		} else {
 			return fuse.EPERM
 		}
+	} else if c, ok := f.cachedAttr(); ok {
+		a.Size = uint64(c.info.Size())
+		a.Mode = 0777
+		setFileTimes(a, c.info)
+		if c.track {
+			track, err := f.albumTrack()
+			if err != nil {
+				return err
+			}
+			if track != nil {
+				a.Size = uint64(track.Size())
+				a.Mode = 0444
+			}
+		}
+		if config_params.uid != 0 {
+			a.Uid = uint32(config_params.uid)
+		}
+		if config_params.gid != 0 {
+			a.Gid = uint32(config_params.gid)
+		}
 	} else {
 		var songPath string
 		var err error
-		if f.artist == "drop" {
-			songPath, err = store.GetDropFilePath(f.name, f.mPoint)
+		if f.isDropped() {
+			songPath, err = f.dropFilePath()
 			PushFileItem(*f, nil)
 		} else if f.artist == "playlists" {
 			songPath, err = store.GetPlaylistFilePath(f.album, f.name, f.mPoint)
 			PushFileItem(*f, nil)
 		} else {
-			songPath, err = store.GetFilePath(f.artist, f.album, f.name)
+			songPath, err = f.songFilePath()
 		}
 
 		if err != nil {
@@ -92,14 +316,25 @@ func (f *File) Attr(ctx context.Context, a *fuse.Attr) error {
 			return err
 		}
 
-		r, err := os.Open(songPath)
-		if err != nil {
-			glog.Infof("Error opening file: %s\n", err)
-			return err
+		// Report the size of the new content while the Song
+		// or the dropped file is being written, from the state
+		// kept by the handle instead of the file itself.
+		if size, modTime, ok := writtenAttr(songPath); ok {
+			a.Size = uint64(size)
+			a.Mode = 0777
+			a.Mtime = modTime
+			a.Ctime = modTime
+			a.Atime = modTime
+			if config_params.uid != 0 {
+				a.Uid = uint32(config_params.uid)
+			}
+			if config_params.gid != 0 {
+				a.Gid = uint32(config_params.gid)
+			}
+			return nil
 		}
-		defer r.Close()
 
-		fi, err := r.Stat()
+		fi, err := statSource(songPath)
 		if err != nil {
 			glog.Infof("Error getting file status: %s\n", err)
 			return err
@@ -107,6 +342,17 @@ func (f *File) Attr(ctx context.Context, a *fuse.Attr) error {
 
 		a.Size = uint64(fi.Size())
 		a.Mode = 0777
+		setFileTimes(a, fi)
+
+		// The tracks of the album images are read only.
+		track, err := f.albumTrack()
+		if err != nil {
+			return err
+		}
+		if track != nil {
+			a.Size = uint64(track.Size())
+			a.Mode = 0444
+		}
 		if config_params.uid != 0 {
 			a.Uid = uint32(config_params.uid)
 		}
@@ -117,23 +363,180 @@ func (f *File) Attr(ctx context.Context, a *fuse.Attr) error {
 	return nil
 }
 
+// backingFlags returns the flags used to open the real
+// file from the flags requested by the client.
+// The access mode, O_APPEND, O_TRUNC and O_SYNC are kept,
+// the files are never created here, that is done by Create.
+func backingFlags(flags fuse.OpenFlags) int {
+	keep := fuse.OpenAccessModeMask | fuse.OpenAppend | fuse.OpenTruncate | fuse.OpenSync
+	return int(flags & keep)
+}
+
+// backingPath returns the path of the real file
+// for a Song, a dropped file or a playlist file.
+func (f *File) backingPath() (string, error) {
+	if f.policy == policyPassthrough {
+		return f.sourcePath(), nil
+	}
+
+	if f.policy == policyExtra {
+		return store.GetExtraPath(f.artist, f.album, f.name)
+	}
+
+	if f.policy == policyArtwork {
+		return store.GetArtworkPath(f.artist, f.album, f.name)
+	}
+
+	if f.policy == policyArtistImage {
+		_, path, err := store.GetArtistImage(f.artist)
+		return path, err
+	}
+
+	if f.policy == policyEpisode {
+		return store.GetEpisodePath(f.artist, f.name)
+	}
+
+	if f.policy == policySnapshot {
+		return snapshotFilePath(f.album, f.name)
+	}
+
+	if f.isDropped() {
+		return f.dropFilePath()
+	}
+
+	if f.artist == "playlists" {
+		return store.GetPlaylistFilePath(f.album, f.name, f.mPoint)
+	}
+	return f.songFilePath()
+}
+
+// songFilePath returns the path of the file of a Song,
+// if the file was moved inside the source Directory
+// outside MuLi it is found and its new path is stored.
+// If it cannot be found the tombstone of the Song is kept.
+func (f *File) songFilePath() (string, error) {
+	path, err := store.GetFilePath(f.artist, f.album, f.name)
+	if err != nil {
+		return path, err
+	}
+
+	// The Songs being written are never looked for.
+	if _, ok := getWriteBuffer(path); ok {
+		return path, nil
+	}
+
+	if _, err := statSource(path); !os.IsNotExist(err) {
+		return path, nil
+	}
+
+	path, err = store.RelocateSong(f.artist, f.album, f.name, f.mPoint)
+	if err == fuse.ENOENT {
+		buryMissing(f.artist, f.album, f.name, f.mPoint)
+	}
+	return path, err
+}
+
 var _ = fs.NodeOpener(&File{})
 
 func (f *File) Open(ctx context.Context, req *fuse.OpenRequest, resp *fuse.OpenResponse) (fs.Handle, error) {
+	h, err := f.open(ctx, req, resp)
+	if err == nil && h != nil {
+		countHandle(1)
+	}
+	return h, fsError("open", entryPath(f.artist, f.album, f.name), err)
+}
+
+// open opens the File and returns its handle.
+func (f *File) open(ctx context.Context, req *fuse.OpenRequest, resp *fuse.OpenResponse) (fs.Handle, error) {
 	glog.Infof("Entered Open with file name: %s.\n", f.name)
+	if err := checkHidden(req.Header, entryPath(f.artist, f.album, f.name)); err != nil {
+		return nil, err
+	}
+	if !req.Flags.IsReadOnly() {
+		if err := checkWritable(req.Header); err != nil {
+			return nil, err
+		}
+	}
 
-	if f.name == ".description" {
+	if f.isControl() {
+		if req.Flags.IsReadOnly() {
+			return nil, fuse.EPERM
+		}
 		return &FileHandle{r: nil, f: f}, nil
 	}
 
+	// The status, the position, the scan report, the audit log, the metrics, the
+	// undo, the errors, the tombstones, the incomplete Albums, the crate playlists,
+	// the metadata of the Songs and the nfo files change while they are read, the
+	// kernel must not cache their size or content.
+	if f.isStatusFile() || f.isPositionFile() || f.isReportFile() || f.isAuditFile() || f.isMetricsFile() ||
+		f.isSongMetadataFile() || f.isNfoFile() || f.isUndoFile() || f.isMissingFile() || f.isCrateM3u() || f.isErrorsFile() ||
+		f.isIncompleteFile() {
+		if !req.Flags.IsReadOnly() {
+			return nil, fuse.EPERM
+		}
+		resp.Flags |= fuse.OpenDirectIO
+		return &FileHandle{r: nil, f: f}, nil
+	}
+
+	// The .tracks file changes when the Songs are renamed,
+	// the kernel must not cache its size or content.
+	if f.isTracksFile() {
+		resp.Flags |= fuse.OpenDirectIO
+	}
+
+	if (f.name == ".description" || f.isTracksFile() || f.isPlaylistInfo() || f.isCrateFile()) && !req.Flags.IsReadOnly() {
+		edit, err := f.startDescriptionEdit(true)
+		if err != nil {
+			return nil, err
+		}
+		return &FileHandle{r: nil, f: f, edit: edit}, nil
+	}
+
+	if f.isTracksFile() || f.isPlaylistInfo() || f.isCrateFile() {
+		return &FileHandle{r: nil, f: f}, nil
+	}
+
+	if f.name == ".description" || f.isAlbumPlaylist() || f.policy == policyAbsorb {
+		return &FileHandle{r: nil, f: f}, nil
+	}
+
+	if f.isSidecar() {
+		if !req.Flags.IsReadOnly() {
+			return nil, fuse.EPERM
+		}
+
+		path, err := f.backingPath()
+		if err != nil {
+			return nil, err
+		}
+
+		r, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		return &FileHandle{r: r, f: f}, nil
+	}
+
+	if f.policy == policyPassthrough {
+		r, err := os.OpenFile(f.sourcePath(), backingFlags(req.Flags), 0666)
+		if err != nil {
+			return nil, err
+		}
+		return &FileHandle{r: r, f: f}, nil
+	}
+
 	if f.name[0] == '.' {
 		return nil, fuse.EPERM
 	}
 
-	if runtime.GOOS == "darwin" {
-		resp.Flags |= fuse.OpenDirectIO
+	// The quarantined files are read only.
+	if f.isQuarantined() && !req.Flags.IsReadOnly() {
+		return nil, fuse.EPERM
 	}
 
+	resp.Flags |= openFlags()
+
 	if req.Flags.IsReadOnly() {
 		glog.Info("Open: File requested is read only.\n")
 	}
@@ -146,30 +549,94 @@ func (f *File) Open(ctx context.Context, req *fuse.OpenRequest, resp *fuse.OpenR
 
 	var err error
 	var songPath string
-	if f.artist == "drop" {
-		songPath, err = store.GetDropFilePath(f.name, f.mPoint)
-		PushFileItem(*f, DelayedVoid)
+	if f.isDropped() {
+		songPath, err = f.dropFilePath()
+		// The readers only delay the filing.
+		if req.Flags.IsReadOnly() {
+			PushFileItem(*f, nil)
+		} else {
+			PushFileItem(*f, DelayedVoid)
+		}
 	} else if f.artist == "playlists" {
 		songPath, err = store.GetPlaylistFilePath(f.album, f.name, f.mPoint)
 		PushFileItem(*f, DelayedVoid)
 	} else {
-		songPath, err = store.GetFilePath(f.artist, f.album, f.name)
+		songPath, err = f.songFilePath()
 	}
 	if err != nil {
 		glog.Error(err)
 		return nil, err
 	}
+	keepCached(songPath, f)
 
-	r, err := os.OpenFile(songPath, int(req.Flags), 0666)
+	track, err := f.albumTrack()
 	if err != nil {
 		return nil, err
 	}
+	if track != nil {
+		if !req.Flags.IsReadOnly() {
+			return nil, fuse.EPERM
+		}
+		r, err := os.Open(songPath)
+		if err != nil {
+			return nil, err
+		}
+		return &FileHandle{r: r, f: f, track: track}, nil
+	}
+
+	if !req.Flags.IsReadOnly() && f.useWriteBuffer() {
+		r, err := openWriteBuffer(songPath, req.Flags)
+		if err != nil {
+			glog.Error(err)
+			return nil, err
+		}
+		return &FileHandle{r: r, f: f, songPath: songPath}, nil
+	}
+
+	r, err := openSource(songPath, backingFlags(req.Flags))
+	if err != nil {
+		return nil, err
+	}
+
+	// The interrupted copies into the drop
+	// Directory are resumed with O_APPEND.
+	if f.isDropped() && !f.isQuarantined() && !req.Flags.IsReadOnly() {
+		var size int64
+		if fi, err := r.Stat(); err == nil {
+			size = fi.Size()
+		}
+		beginUpload(songPath, size)
+		return &FileHandle{r: r, f: f, upload: songPath}, nil
+	}
 	return &FileHandle{r: r, f: f}, nil
 }
 
+// FileHandle is the open file returned by Open.
+// The buffer holds the data read ahead from bufOffset.
+// When the writes are buffered, songPath is the Song that
+// is replaced on Release and r is the temporary file.
+// The upload is the path of the dropped file written.
+// The stats are the statistics of the reads of the Song.
 type FileHandle struct {
 	r *os.File
 	f *File
+
+	mu        sync.Mutex
+	buf       []byte
+	bufOffset int64
+	readEnd   int64
+
+	songPath string
+	dirty    bool
+	created  bool
+	upload   string
+
+	stats readStats
+
+	edit    *descriptionEdit
+	control []byte
+
+	track *musicmgr.FlacTrackReader
 }
 
 var _ fs.Handle = (*FileHandle)(nil)
@@ -186,9 +653,9 @@ func DelayedHandlePlaylistSong(f File) error {
 	path := rootPoint + "playlists/" + f.album + "/" + f.name
 
 	extension := filepath.Ext(f.name)
-	if extension != ".mp3" {
+	if !musicmgr.IsMusicFile(f.name) {
 		os.Remove(path)
-		return errors.New("File is not an mp3.")
+		return errors.New("File is not a music file.")
 	}
 
 	src, err := os.Stat(path)
@@ -196,7 +663,7 @@ func DelayedHandlePlaylistSong(f File) error {
 		return errors.New("File not found.")
 	}
 
-	err, tags := musicmgr.GetMp3Tags(path)
+	err, tags := musicmgr.GetTags(path)
 	if err != nil {
 		os.Remove(path)
 		return err
@@ -205,10 +672,10 @@ func DelayedHandlePlaylistSong(f File) error {
 	artist := store.GetCompatibleString(tags.Artist)
 	album := store.GetCompatibleString(tags.Album)
 	title := tags.Title
-	if strings.HasSuffix(title, ".mp3") {
-		title = title[:len(title)-len(".mp3")]
+	if strings.HasSuffix(title, extension) {
+		title = title[:len(title)-len(extension)]
 	}
-	title = store.GetCompatibleString(title) + ".mp3"
+	title = store.GetCompatibleString(title) + extension
 
 	newPath, err := store.GetFilePath(artist, album, title)
 	if err == nil {
@@ -219,8 +686,9 @@ func DelayedHandlePlaylistSong(f File) error {
 		playlistFile.Path = newPath
 		err = store.AddFileToPlaylist(playlistFile, f.album)
 	} else {
-		err = store.HandleDrop(path, rootPoint)
+		_, err = store.HandleDrop(stopCtx, path, rootPoint)
 		if err == nil {
+			forgetNames()
 			newPath, err = store.GetFilePath(artist, album, title)
 			if err == nil {
 				var playlistFile playlistmgr.PlaylistFile
@@ -237,35 +705,81 @@ func DelayedHandlePlaylistSong(f File) error {
 	if err == nil {
 		err = store.RegeneratePlaylistFile(f.album, rootPoint)
 	}
+	if err == nil {
+		err = autoDedup(f.album, rootPoint)
+	}
 	return err
 }
 
-// DelayedHandleDrop handles a dropped file
-// but is called by the background dispatcher
-// after some time has passed.
-func DelayedHandleDrop(f File) error {
-	// Get the dropped file path.
-	rootPoint := f.mPoint
-	if rootPoint[len(rootPoint)-1] != '/' {
-		rootPoint = rootPoint + "/"
-	}
+// DelayedHandleDrop returns the function that handles
+// a dropped file but is called by the background
+// dispatcher after some time has passed. The drop is
+// audited as made by the user of the request.
+func DelayedHandleDrop(header fuse.Header) func(File) error {
+	return func(f File) error {
+		// Get the dropped file path.
+		rootPoint := f.mPoint
+		if rootPoint[len(rootPoint)-1] != '/' {
+			rootPoint = rootPoint + "/"
+		}
 
-	path := rootPoint + "drop/" + f.name
-	err := store.HandleDrop(path, rootPoint)
-	fmt.Printf("DelayedHandleDrop: %s\n", path)
-	if err != nil {
-		glog.Error(err)
-		return err
+		path := rootPoint + "drop/" + f.dropName()
+		if uploading(path) {
+			glog.Infof("The file %s is being written again.\n", path)
+			return nil
+		}
+
+		song, err := store.HandleDrop(stopCtx, path, rootPoint)
+		fmt.Printf("DelayedHandleDrop: %s\n", path)
+		audit(header, "drop", err, "drop/"+f.dropName(), song)
+		notifyDrop(err == nil)
+		if err != nil {
+			glog.Error(err)
+			return err
+		}
+
+		err = applyDropTarget(f, song)
+		if err != nil {
+			glog.Errorf("Cannot apply the drop action of %s: %s\n", f.artist, err)
+		}
+
+		forgetNames()
+		scheduleAutoPlaylists(f.mPoint)
+		return nil
 	}
-	return nil
 }
 
 var _ fs.HandleReleaser = (*FileHandle)(nil)
 
 func (fh *FileHandle) Release(ctx context.Context, req *fuse.ReleaseRequest) error {
+	countHandle(-1)
+	if fh.r != nil {
+		fh.logReadStats()
+	}
+	return fsError("release", fh.errorPath(), fh.release(ctx, req))
+}
+
+// release closes the handle and finishes the
+// changes made to the File while it was open.
+func (fh *FileHandle) release(ctx context.Context, req *fuse.ReleaseRequest) error {
 	if fh.r == nil {
-		if fh.f.name == ".description" {
-			glog.Infof("Entered Release: .description file\n")
+		if fh.f.isControl() {
+			return nil
+		}
+
+		if fh.f.name == ".description" || fh.f.isTracksFile() || fh.f.isPlaylistInfo() || fh.f.isCrateFile() {
+			glog.Infof("Entered Release: %s file\n", fh.f.name)
+			fh.endDescriptionEdit()
+			return nil
+		}
+
+		if fh.f.isAlbumPlaylist() || fh.f.policy == policyAbsorb {
+			return nil
+		}
+
+		if fh.f.isStatusFile() || fh.f.isPositionFile() || fh.f.isReportFile() || fh.f.isAuditFile() || fh.f.isMetricsFile() ||
+			fh.f.isSongMetadataFile() || fh.f.isNfoFile() || fh.f.isUndoFile() || fh.f.isMissingFile() || fh.f.isCrateM3u() ||
+			fh.f.isErrorsFile() || fh.f.isIncompleteFile() {
 			return nil
 		}
 
@@ -280,16 +794,36 @@ func (fh *FileHandle) Release(ctx context.Context, req *fuse.ReleaseRequest) err
 	}
 	glog.Infof("Releasing the file: %s\n", fh.r.Name())
 
-	if fh.f != nil && fh.f.artist == "drop" {
+	if fh.f != nil && fh.f.policy == policyEpisode {
+		fh.markListened()
+		return fh.r.Close()
+	}
+
+	if fh.f != nil && (fh.f.policy == policyPassthrough || fh.f.isSidecar()) {
+		return fh.r.Close()
+	}
+
+	if fh.f != nil && fh.f.isQuarantined() {
+		return fh.r.Close()
+	}
+
+	if fh.f != nil && fh.f.isDropped() {
 		glog.Infof("Entered Release dropping the song: %s\n", fh.f.name)
 		ret_val := fh.r.Close()
 
-		PushFileItem(*fh.f, DelayedHandleDrop)
+		fh.releaseUpload(req.Header)
 		return ret_val
 	}
 
 	if fh.f != nil && fh.f.artist == "playlists" {
 		glog.Infof("Entered Release with playlist song: %s\n", fh.f.name)
+		// The Songs in the queue are removed once played.
+		if store.IsQueue(fh.f.album) && fh.fullyRead() {
+			err := store.PopQueueSong(fh.f.name, fh.f.mPoint)
+			if err != nil {
+				glog.Errorf("Cannot remove %s from the queue: %s\n", fh.f.name, err)
+			}
+		}
 		ret_val := fh.r.Close()
 
 		PushFileItem(*fh.f, DelayedHandlePlaylistSong)
@@ -303,16 +837,43 @@ func (fh *FileHandle) Release(ctx context.Context, req *fuse.ReleaseRequest) err
 	}
 
 	glog.Infof("Entered Release: Artist: %s, Album: %s, Song: %s\n", fh.f.artist, fh.f.album, fh.f.name)
+	fh.recordPlay()
+	fh.recordPosition()
 	ret_val := fh.r.Close()
-	extension := filepath.Ext(fh.f.name)
+
+	// The Song is locked while it is replaced and
+	// retagged, the reads wait until it is finished.
+	unlock := store.LockSong(fh.f.artist, fh.f.album, fh.f.name)
+	defer unlock()
+
+	fh.mu.Lock()
+	dirty := fh.dirty
+	fh.mu.Unlock()
+	if len(fh.songPath) > 0 {
+		err := fh.commitWriteBuffer()
+		if err != nil {
+			glog.Error(err)
+			return err
+		}
+	}
+
 	songPath, err := store.GetFilePath(fh.f.artist, fh.f.album, fh.f.name)
 	if err != nil {
 		return err
 	}
 
-	if extension == ".mp3" {
+	// The tags are written only if the Song was modified,
+	// reading it must not change the file.
+	if dirty && musicmgr.IsMusicFile(fh.f.name) {
 		//TODO: Use the correct artist and album
-		musicmgr.SetMp3Tags(fh.f.artist, fh.f.album, fh.f.song, songPath)
+		store.SetSongTags(fh.f.artist, fh.f.album, fh.f.song, songPath)
+	}
+
+	// The new content of the Song may have different tags.
+	if dirty {
+		forgetAttrs(fh.f.artist, fh.f.album)
+		store.RefreshSongInfo(fh.f.artist, fh.f.album, fh.f.name, songPath)
+		scheduleAutoPlaylists(fh.f.mPoint)
 	}
 	return ret_val
 }
@@ -320,9 +881,74 @@ func (fh *FileHandle) Release(ctx context.Context, req *fuse.ReleaseRequest) err
 var _ = fs.HandleReader(&FileHandle{})
 
 func (fh *FileHandle) Read(ctx context.Context, req *fuse.ReadRequest, resp *fuse.ReadResponse) error {
+	return fsError("read", fh.errorPath(), fh.read(ctx, req, resp))
+}
+
+// read reads the content of the File.
+func (fh *FileHandle) read(ctx context.Context, req *fuse.ReadRequest, resp *fuse.ReadResponse) error {
 	glog.Infof("Entered Read.\n")
 	//TODO: Check if we need to add something here for playlists and drop directories.
 	if fh.r == nil {
+		if fh.f.isStatusFile() {
+			resp.Data = sliceRead(statusContent(), req.Offset, req.Size)
+			return nil
+		}
+
+		if fh.f.isReportFile() {
+			resp.Data = sliceRead(scanReport(), req.Offset, req.Size)
+			return nil
+		}
+
+		if fh.f.isAuditFile() {
+			resp.Data = sliceRead(auditLog(), req.Offset, req.Size)
+			return nil
+		}
+
+		if fh.f.isMetricsFile() {
+			resp.Data = sliceRead(metricsContent(), req.Offset, req.Size)
+			return nil
+		}
+
+		if fh.f.isUndoFile() {
+			resp.Data = sliceRead(undoContent(), req.Offset, req.Size)
+			return nil
+		}
+
+		if fh.f.isMissingFile() {
+			resp.Data = sliceRead(missingContent(fh.f.name), req.Offset, req.Size)
+			return nil
+		}
+
+		if fh.f.isErrorsFile() {
+			resp.Data = sliceRead(errorsContent(), req.Offset, req.Size)
+			return nil
+		}
+
+		if fh.f.isIncompleteFile() {
+			resp.Data = sliceRead(incompleteContent(fh.f.name), req.Offset, req.Size)
+			return nil
+		}
+
+		if fh.f.isCrateM3u() {
+			resp.Data = sliceRead(crateM3u(fh.f.album), req.Offset, req.Size)
+			return nil
+		}
+
+		if fh.f.isSongMetadataFile() {
+			resp.Data = sliceRead(songMetadataContent(fh.f.artist, fh.f.album, fh.f.name), req.Offset, req.Size)
+			return nil
+		}
+
+		if fh.f.isNfoFile() {
+			resp.Data = sliceRead(fh.f.nfoContent(), req.Offset, req.Size)
+			return nil
+		}
+
+		if fh.f.isPositionFile() {
+			resp.Data = sliceRead(bookPosition(fh.f.artist, fh.f.album), req.Offset, req.Size)
+			return nil
+		}
+
 		if fh.f.name == ".description" {
 			glog.Info("Reading description file\n")
 			if len(fh.f.artist) < 1 {
@@ -347,55 +973,157 @@ func (fh *FileHandle) Read(ctx context.Context, req *fuse.ReadRequest, resp *fus
 			return nil
 		}
 
+		if fh.f.isTracksFile() || fh.f.isPlaylistInfo() || fh.f.isCrateFile() {
+			data, ok := fh.f.getDescriptionEdit()
+			if !ok {
+				var err error
+				data, err = fh.f.editContent()
+				if err != nil {
+					return err
+				}
+			}
+			resp.Data = sliceRead(data, req.Offset, req.Size)
+			return nil
+		}
+
+		if fh.f.policy == policyAbsorb {
+			resp.Data = []byte{}
+			return nil
+		}
+
+		if fh.f.isAlbumPlaylist() {
+			playlist, err := fh.f.albumPlaylist()
+			if err != nil {
+				return err
+			}
+			resp.Data = sliceRead([]byte(playlist), req.Offset, req.Size)
+			return nil
+		}
+
 		glog.Info("There is no file handler.\n")
 		return fuse.EIO
 	}
 
+	// The request may be interrupted while it waits to be
+	// served, there is no need to read the file then.
+	if ctx.Err() != nil {
+		return fuse.EINTR
+	}
+
 	glog.Infof("Reading file: %s.\n", fh.r.Name())
-	if _, err := fh.r.Seek(req.Offset, 0); err != nil {
+	start := time.Now()
+	unlock := store.RLockSong(fh.f.artist, fh.f.album, fh.f.name)
+	defer unlock()
+	locked := time.Now()
+
+	if fh.track != nil {
+		buf := make([]byte, req.Size)
+		n, err := fh.track.ReadAt(fh.r, buf, req.Offset)
+		resp.Data = buf[:n]
+		if err != nil && err != io.EOF {
+			glog.Error(err)
+			return err
+		}
+		fh.recordRead(req.Offset, n, locked.Sub(start), time.Since(locked))
+		fh.trackRead(req.Offset, n)
+		return nil
+	}
+
+	if config_params.read_ahead > 0 {
+		data, err := fh.readAhead(req.Offset, req.Size)
+		resp.Data = data
+		if err != nil {
+			glog.Error(err)
+		}
+		fh.recordRead(req.Offset, len(data), locked.Sub(start), time.Since(locked))
+		fh.trackRead(req.Offset, len(data))
 		return err
 	}
-	buf := make([]byte, req.Size)
-	n, err := fh.r.Read(buf)
-	resp.Data = buf[:n]
-	if err != nil && err != io.EOF {
+
+	data, err := readSource(fh.r, req.Offset, req.Size)
+	resp.Data = data
+	if err != nil {
 		glog.Error(err)
 		return err
 	}
+	fh.recordRead(req.Offset, len(data), locked.Sub(start), time.Since(locked))
+	fh.trackRead(req.Offset, len(data))
 	return nil
 }
 
 var _ = fs.HandleWriter(&FileHandle{})
 
 func (fh *FileHandle) Write(ctx context.Context, req *fuse.WriteRequest, resp *fuse.WriteResponse) error {
+	return fsError("write", fh.errorPath(), fh.write(ctx, req, resp))
+}
+
+// write writes the data into the File.
+func (fh *FileHandle) write(ctx context.Context, req *fuse.WriteRequest, resp *fuse.WriteResponse) error {
 	glog.Infof("Entered Write\n")
 	//TODO: Check if we need to add something here for playlists and drop directories.
 	if fh.r == nil {
-		if fh.f.name == ".description" {
-			glog.Errorf("Not allowed to write description file.\n")
-			//TODO: Allow to write description
+		if fh.f.isControl() {
+			resp.Size = fh.writeControl(req.Offset, req.Data)
+			return nil
+		}
+
+		if fh.f.name == ".description" || fh.f.isTracksFile() || fh.f.isPlaylistInfo() || fh.f.isCrateFile() {
+			n, err := fh.writeDescription(req.Offset, req.Data)
+			resp.Size = n
+			return err
+		}
+
+		if fh.f.isAlbumPlaylist() {
+			return fuse.EPERM
+		}
+
+		if fh.f.policy == policyAbsorb {
+			resp.Size = len(req.Data)
 			return nil
 		}
 		return fuse.EIO
 	}
 
 	glog.Infof("Writing file: %s.\n", fh.r.Name())
+	fh.dropReadAhead()
+	fh.mu.Lock()
+	fh.dirty = true
+	fh.mu.Unlock()
 	if _, err := fh.r.Seek(req.Offset, 0); err != nil {
 		return err
 	}
 	n, err := fh.r.Write(req.Data)
 	resp.Size = n
+	if err == nil {
+		fh.recordWrite()
+	}
 	return err
 }
 
 var _ = fs.HandleFlusher(&FileHandle{})
 
 func (fh *FileHandle) Flush(ctx context.Context, req *fuse.FlushRequest) error {
+	return fsError("flush", fh.errorPath(), fh.flush(ctx, req))
+}
+
+// flush stores the changes written to the File.
+func (fh *FileHandle) flush(ctx context.Context, req *fuse.FlushRequest) error {
 	if fh.f != nil {
 		glog.Infof("Entered Flush with Song: %s, Artist: %s and Album: %s\n", fh.f.name, fh.f.artist, fh.f.album)
 	}
 
 	if fh.r == nil {
+		if fh.f != nil && (fh.f.name == ".description" || fh.f.isTracksFile() || fh.f.isPlaylistInfo() || fh.f.isCrateFile()) {
+			return fh.saveDescription(ctx, req.Header)
+		}
+
+		if fh.f != nil && fh.f.isControl() {
+			return fh.runControl(req.Header)
+		}
+
+		if fh.f != nil && (fh.f.isAlbumPlaylist() || fh.f.policy == policyAbsorb) {
+			return nil
+		}
 		glog.Infof("There is no file handler.\n")
 		return fuse.EIO
 	}
@@ -403,16 +1131,77 @@ func (fh *FileHandle) Flush(ctx context.Context, req *fuse.FlushRequest) error {
 	glog.Infof("Entered Flush with path: %s\n", fh.r.Name())
 
 	fh.r.Sync()
+
+	// Report the invalid files to the client when they are
+	// closed, they will be discarded on Release.
+	fh.mu.Lock()
+	dirty := fh.dirty
+	fh.mu.Unlock()
+	if len(fh.songPath) > 0 && dirty && !musicmgr.IsCompleteMusicContent(fh.r.Name(), fh.songPath) {
+		glog.Errorf("The file %s is not a complete music file.\n", fh.f.name)
+		return fuse.EIO
+	}
 	return nil
 }
 
 var _ = fs.NodeSetattrer(&File{})
 
 func (f *File) Setattr(ctx context.Context, req *fuse.SetattrRequest, resp *fuse.SetattrResponse) error {
+	return fsError("setattr", entryPath(f.artist, f.album, f.name), f.setattr(ctx, req, resp))
+}
+
+// setattr changes the size of the File.
+func (f *File) setattr(ctx context.Context, req *fuse.SetattrRequest, resp *fuse.SetattrResponse) error {
 	glog.Infof("Entered SetAttr with Song: %s, Artist: %s and Album: %s\n", f.name, f.artist, f.album)
+	if err := checkWritable(req.Header); err != nil {
+		return err
+	}
+	forgetAttrs(f.artist, f.album)
 
 	if req.Valid.Size() {
 		glog.Infof("New size: %d\n", int(req.Size))
+		if f.isControl() {
+			return nil
+		}
+
+		if f.name == ".description" || f.isTracksFile() || f.isPlaylistInfo() || f.isCrateFile() {
+			err := f.truncateDescription(int64(req.Size))
+			if err != nil {
+				return err
+			}
+			return f.attr(ctx, &resp.Attr)
+		}
+
+		if f.isAlbumPlaylist() || f.isSidecar() || isAlbumTrack(f.artist, f.album, f.name) {
+			return fuse.EPERM
+		}
+
+		if f.policy == policyAbsorb {
+			return nil
+		}
+
+		// The file is truncated by the kernel with Setattr
+		// when it is opened with O_TRUNC.
+		path, err := f.backingPath()
+		if err != nil {
+			return err
+		}
+
+		if ok, err := truncateWriteBuffer(path, int64(req.Size)); ok {
+			if err != nil {
+				glog.Error(err)
+				return err
+			}
+			return f.attr(ctx, &resp.Attr)
+		}
+
+		err = os.Truncate(path, int64(req.Size))
+		if err != nil {
+			glog.Error(err)
+			return err
+		}
+		resizeUpload(path, int64(req.Size), true)
+		return f.attr(ctx, &resp.Attr)
 	}
 	return nil
 }
@@ -17,6 +17,8 @@
 package main
 
 import (
+	"encoding/binary"
+	"hash/fnv"
 	"os"
 	"syscall"
 
@@ -35,6 +37,10 @@ type FS struct {
 var _ = fs.FS(&FS{})
 
 func (f *FS) Root() (fs.Node, error) {
+	if len(config_params.subtree) > 0 {
+		return subtreeRoot(f), nil
+	}
+
 	n := &Dir{
 		fs:     f,
 		artist: "",
@@ -44,6 +50,23 @@ func (f *FS) Root() (fs.Node, error) {
 	return n, nil
 }
 
+var _ = fs.FSInodeGenerator(&FS{})
+
+// GenerateInode returns the inode of a node from the inode
+// of its parent and its name, so every path has always the
+// same inode, even after mounting MuLi again.
+func (f *FS) GenerateInode(parentInode uint64, name string) uint64 {
+	h := fnv.New64a()
+	binary.Write(h, binary.LittleEndian, parentInode)
+	h.Write([]byte(name))
+	inode := h.Sum64()
+	if inode < 2 {
+		// The inode 1 is used by the root Directory.
+		inode += 2
+	}
+	return inode
+}
+
 func (f *FS) Statfs(ctx context.Context, req *fuse.StatfsRequest, resp *fuse.StatfsResponse) error {
 	var stat syscall.Statfs_t
 	wd, err := os.Getwd()
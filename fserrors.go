@@ -0,0 +1,159 @@
+// Copyright 2016 Danko Miocevic. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Author: Danko Miocevic
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/dankomiocevic/mulifs/store"
+	"os"
+	"sync"
+	"syscall"
+	"time"
+
+	"bazil.org/fuse"
+	"golang.org/x/net/context"
+)
+
+// errorsFileName is the read only file in the .mulifs
+// Directory with the last errors returned by MuLi.
+const errorsFileName = "errors"
+
+// errorEntry is an error returned to an operation.
+type errorEntry struct {
+	time  time.Time
+	op    string
+	path  string
+	errno fuse.Errno
+	err   string
+}
+
+// errorLog keeps the last errors returned,
+// next is the position of the oldest one.
+var errorLog struct {
+	sync.Mutex
+	entries []errorEntry
+	next    int
+}
+
+// isErrorsFile returns true if the File is the errors file.
+func (f *File) isErrorsFile() bool {
+	return f.artist == mulifsDirName && len(f.album) < 1 && f.name == errorsFileName
+}
+
+// toErrno returns the errno returned to the kernel for the
+// error, internal is false if the error was already an errno.
+// The errors of the source Directory keep their errno and
+// the errors without one are returned as EIO.
+func toErrno(err error) (errno fuse.Errno, internal bool) {
+	switch e := err.(type) {
+	case fuse.ErrorNumber:
+		return e.Errno(), false
+	case syscall.Errno:
+		return fuse.Errno(e), false
+	case *os.PathError:
+		err = e.Err
+	case *os.LinkError:
+		err = e.Err
+	case *os.SyscallError:
+		err = e.Err
+	}
+
+	if e, ok := err.(syscall.Errno); ok {
+		return fuse.Errno(e), true
+	}
+
+	switch {
+	case err == context.Canceled || err == context.DeadlineExceeded:
+		return fuse.EINTR, true
+	case store.IsReadOnlyError(err):
+		return fuse.Errno(syscall.EROFS), true
+	case os.IsNotExist(err):
+		return fuse.ENOENT, true
+	case os.IsExist(err):
+		return fuse.EEXIST, true
+	case os.IsPermission(err):
+		return fuse.EPERM, true
+	}
+	return fuse.EIO, true
+}
+
+// fsError returns the errno of the error of an operation over
+// the path inside MuLi. The errors are recorded in the errors
+// file, except the interrupted operations and the errnos
+// expected by the programs, like a file that does not exist,
+// when they are returned as they are.
+func fsError(op, path string, err error) error {
+	if err == nil {
+		return nil
+	}
+
+	errno, internal := toErrno(err)
+	if errno == fuse.EINTR || (!internal && (errno == fuse.ENOENT || errno == fuse.EEXIST ||
+		errno == fuse.Errno(syscall.ENODATA))) {
+		return errno
+	}
+
+	recordError(errorEntry{time: time.Now(), op: op, path: "/" + path, errno: errno, err: err.Error()})
+	return errno
+}
+
+// errorPath returns the path of the File
+// of the handle shown in the errors file.
+func (fh *FileHandle) errorPath() string {
+	if fh.f == nil {
+		return ""
+	}
+	return entryPath(fh.f.artist, fh.f.album, fh.f.name)
+}
+
+// recordError adds the error to the errors file, the
+// oldest error is replaced once the file is full.
+func recordError(e errorEntry) {
+	if config_params.error_log_size < 1 {
+		return
+	}
+
+	errorLog.Lock()
+	defer errorLog.Unlock()
+	if len(errorLog.entries) < config_params.error_log_size {
+		errorLog.entries = append(errorLog.entries, e)
+		return
+	}
+	errorLog.entries[errorLog.next] = e
+	errorLog.next = (errorLog.next + 1) % len(errorLog.entries)
+}
+
+// errorsContent returns the errors file, one error per line
+// from the oldest with the time, the operation, the path,
+// the errno returned and the error that caused it.
+func errorsContent() []byte {
+	errorLog.Lock()
+	defer errorLog.Unlock()
+
+	var b bytes.Buffer
+	n := len(errorLog.entries)
+	for i := 0; i < n; i++ {
+		e := errorLog.entries[(errorLog.next+i)%n]
+		fmt.Fprintf(&b, "%s %s %s: %s", e.time.Format(time.RFC3339), e.op, e.path, e.errno)
+		if e.err != e.errno.Error() {
+			fmt.Fprintf(&b, ": %s", e.err)
+		}
+		b.WriteString("\n")
+	}
+	return b.Bytes()
+}
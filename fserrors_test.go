@@ -0,0 +1,57 @@
+// Copyright 2016 Danko Miocevic. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Author: Danko Miocevic
+
+package main
+
+import (
+	"errors"
+	"os"
+	"syscall"
+	"testing"
+
+	"bazil.org/fuse"
+	"github.com/boltdb/bolt"
+	"golang.org/x/net/context"
+)
+
+func TestToErrno(t *testing.T) {
+	tests := []struct {
+		name     string
+		err      error
+		errno    fuse.Errno
+		internal bool
+	}{
+		{"fuse errno", fuse.ENOENT, fuse.ENOENT, false},
+		{"errno", syscall.ENOSPC, fuse.Errno(syscall.ENOSPC), false},
+		{"path error", &os.PathError{Op: "open", Path: "song.mp3", Err: syscall.EACCES}, fuse.Errno(syscall.EACCES), true},
+		{"link error", &os.LinkError{Op: "rename", Old: "a", New: "b", Err: syscall.EXDEV}, fuse.Errno(syscall.EXDEV), true},
+		{"syscall error", os.NewSyscallError("flock", syscall.EAGAIN), fuse.Errno(syscall.EAGAIN), true},
+		{"cancelled", context.Canceled, fuse.EINTR, true},
+		{"deadline", context.DeadlineExceeded, fuse.EINTR, true},
+		{"read only", bolt.ErrDatabaseReadOnly, fuse.Errno(syscall.EROFS), true},
+		{"not exist", os.ErrNotExist, fuse.ENOENT, true},
+		{"exist", os.ErrExist, fuse.EEXIST, true},
+		{"permission", os.ErrPermission, fuse.EPERM, true},
+		{"other", errors.New("Something failed."), fuse.EIO, true},
+	}
+
+	for _, test := range tests {
+		errno, internal := toErrno(test.err)
+		if errno != test.errno || internal != test.internal {
+			t.Errorf("toErrno(%s) = %v, %v, want %v, %v", test.name, errno, internal, test.errno, test.internal)
+		}
+	}
+}
@@ -0,0 +1,188 @@
+// Copyright 2016 Danko Miocevic. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Author: Danko Miocevic
+
+package main
+
+import (
+	"github.com/dankomiocevic/mulifs/metadata"
+	"github.com/dankomiocevic/mulifs/store"
+	"strings"
+
+	"bazil.org/fuse"
+	"bazil.org/fuse/fs"
+	"github.com/golang/glog"
+	"golang.org/x/net/context"
+)
+
+// genresViewDir is the view with the Songs grouped
+// by genre, the Songs moved between its Directories
+// change their genre.
+const genresViewDir = "genres"
+
+// The sources of the genre of the dropped
+// Songs without one.
+const (
+	// genreInferenceNone keeps the Songs without genre.
+	genreInferenceNone = "none"
+	// genreInferenceArtist uses the most common genre
+	// of the other Songs of the Artist.
+	genreInferenceArtist = "artist"
+	// genreInferenceLastFM also asks Last.fm when
+	// the Artist has no genre.
+	genreInferenceLastFM = "lastfm"
+)
+
+// setGenreInference enables the inference of the
+// genres selected with the genre_inference option.
+func setGenreInference() {
+	switch config_params.genre_inference {
+	case genreInferenceArtist:
+		store.SetGenreInference(nil)
+	case genreInferenceLastFM:
+		store.SetGenreInference(metadata.LastFM{Key: config_params.lastfm_key})
+	}
+}
+
+// registerGenresView adds the genres view to the
+// root Directory when it is enabled.
+func registerGenresView() {
+	if config_params.genres {
+		views[genresViewDir] = view{list: listGenresView, lookup: lookupGenresView}
+	}
+}
+
+// listGenres returns the genres of the Library by the
+// name of their Directories, with the genre as it is
+// written in the tags of the first Song found.
+func listGenres(songs []store.SongInfo) map[string]string {
+	genres := make(map[string]string)
+	for _, s := range songs {
+		genre := strings.TrimSpace(s.Genre)
+		name := store.GetCompatibleString(genre)
+		if len(name) < 1 {
+			continue
+		}
+		if _, ok := genres[name]; !ok {
+			genres[name] = genre
+		}
+	}
+	return genres
+}
+
+// genreSongNames returns the Songs of a genre by the name
+// used in the view, the Artist and the Song, adding the
+// Album when it is repeated.
+func genreSongNames(songs []store.SongInfo, name string) map[string]store.SongRef {
+	var refs []store.SongRef
+	seen := make(map[string]int)
+	for _, s := range songs {
+		if store.GetCompatibleString(strings.TrimSpace(s.Genre)) == name {
+			refs = append(refs, s.SongRef)
+			seen[s.Artist+" - "+s.Song]++
+		}
+	}
+
+	a := make(map[string]store.SongRef)
+	for _, s := range refs {
+		viewName := s.Artist + " - " + s.Song
+		if seen[viewName] > 1 {
+			viewName = s.Artist + " - " + s.Album + " - " + s.Song
+		}
+		a[viewName] = s
+	}
+	return a
+}
+
+// listGenresView lists the genres or
+// the Songs of one of them.
+func listGenresView(ctx context.Context, d *Dir) ([]fuse.Dirent, error) {
+	songs, err := store.ListSongInfo()
+	if err != nil {
+		return nil, fuse.EIO
+	}
+
+	var a []fuse.Dirent
+	if len(d.album) < 1 {
+		for name := range listGenres(songs) {
+			a = append(a, fuse.Dirent{Name: name, Type: fuse.DT_Dir})
+		}
+		return a, nil
+	}
+
+	for name := range genreSongNames(songs, d.album) {
+		a = append(a, fuse.Dirent{Name: name, Type: fuse.DT_File})
+	}
+	return a, nil
+}
+
+// lookupGenresView returns the Directories
+// of the genres and their Songs.
+func lookupGenresView(ctx context.Context, d *Dir, name string) (fs.Node, error) {
+	songs, err := store.ListSongInfo()
+	if err != nil {
+		return nil, fuse.EIO
+	}
+
+	if len(d.album) < 1 {
+		if _, ok := listGenres(songs)[name]; !ok {
+			return nil, fuse.ENOENT
+		}
+		return &Dir{fs: d.fs, artist: d.artist, album: name, mPoint: d.mPoint}, nil
+	}
+
+	s, ok := genreSongNames(songs, d.album)[name]
+	if !ok {
+		return nil, fuse.ENOENT
+	}
+	return songFile(d, s.Artist, s.Album, s.Song)
+}
+
+// moveGenreSong changes the genre of a Song moved from
+// the genre Directory d to the genre Directory newD,
+// the genre is written as it is in the other Songs of
+// newD. The Songs cannot be renamed inside the view.
+func (d *Dir) moveGenreSong(oldName string, newD *Dir, newName string) error {
+	if len(d.album) < 1 || len(newD.album) < 1 || oldName != newName {
+		return fuse.EPERM
+	}
+	if d.album == newD.album {
+		return nil
+	}
+
+	songs, err := store.ListSongInfo()
+	if err != nil {
+		return fuse.EIO
+	}
+
+	genre, ok := listGenres(songs)[newD.album]
+	if !ok {
+		return fuse.ENOENT
+	}
+
+	s, ok := genreSongNames(songs, d.album)[oldName]
+	if !ok {
+		return fuse.ENOENT
+	}
+
+	err = store.SetSongGenre(s, genre)
+	if err != nil {
+		glog.Errorf("Cannot change the genre of %s: %s\n", oldName, err)
+		return fuse.EIO
+	}
+
+	scheduleAutoPlaylists(d.mPoint)
+	return nil
+}
@@ -19,6 +19,9 @@ package main
 import (
 	"flag"
 	"fmt"
+	"github.com/dankomiocevic/mulifs/metadata"
+	"github.com/dankomiocevic/mulifs/musicmgr"
+	"github.com/dankomiocevic/mulifs/playlistmgr"
 	"github.com/dankomiocevic/mulifs/store"
 	"github.com/dankomiocevic/mulifs/tools"
 	"log"
@@ -32,10 +35,117 @@ import (
 )
 
 type fs_config struct {
-	uid         uint
-	gid         uint
-	allow_users bool
-	allow_root  bool
+	uid                   uint
+	gid                   uint
+	allow_users           bool
+	allow_root            bool
+	album_m3u_absolute    bool
+	songs_artist_names    bool
+	case_insensitive      bool
+	absorb_files          []string
+	passthrough_files     []string
+	daemon                bool
+	mount_retries         int
+	read_ahead            int
+	kernel_cache          bool
+	extras                string
+	extra_files           []string
+	artwork_files         []string
+	artist_files          []string
+	fetch_descriptions    bool
+	discogs_token         string
+	lastfm_key            string
+	genre_playlists       bool
+	decade_playlists      bool
+	most_played           int
+	most_played_days      int
+	recently_played       int
+	shuffle               int
+	queue                 bool
+	playlist_dedup        bool
+	playlist_paths        string
+	playlist_rewrite      string
+	import_playlists      string
+	stable_files          bool
+	scrub_interval        int
+	scrub_rate            int
+	audiobooks            bool
+	audiobook_genres      []string
+	db_keyfile            string
+	normalize             []string
+	junk_patterns         []string
+	path_patterns         []string
+	classical             bool
+	classical_genres      []string
+	composers             bool
+	bpm                   bool
+	bpm_command           []string
+	keys                  bool
+	gapless_safe          bool
+	quality               bool
+	check_mp3             bool
+	repair_mp3            bool
+	rmdir                 string
+	library_only          bool
+	audit                 bool
+	webhooks              []string
+	api                   string
+	metadata_providers    []string
+	tag_writers           []string
+	hooks                 store.Hooks
+	background_rate       int
+	background_ops        int
+	pprof_port            int
+	dir_sizes             bool
+	mirror_dir            string
+	mirror_template       string
+	nfo                   bool
+	media_view            bool
+	ratings               bool
+	podcast_feeds         []string
+	drop_targets          []string
+	album_drop            bool
+	album_drop_delay      int
+	drop_settle           int
+	io_timeout            int
+	io_retries            int
+	slow_read             int
+	album_artist          bool
+	versions              string
+	subtree               string
+	in_memory             bool
+	read_only             bool
+	genres                bool
+	genre_inference       string
+	playlist_names        string
+	ignore_files          []string
+	music_extensions      []string
+	min_size              int
+	snapshots             int
+	notify                []string
+	smtp_server           string
+	smtp_from             string
+	maintenance_window    string
+	tombstones            bool
+	artist_index          int
+	crates                bool
+	web                   string
+	web_auth              string
+	web_hosts             []string
+	cast_targets          []string
+	cast_url              string
+	description_fields    []string
+	force                 bool
+	error_log_size        int
+	completeness_interval int
+	tag_sidecars          bool
+	watch_dirs            []string
+	profiles              string
+	guest                 bool
+	guest_hidden          []string
+	podcast_interval      int
+	podcast_episodes      int
+	mountpoint            string
 }
 
 var config_params fs_config
@@ -50,6 +160,19 @@ func usage() {
 	fmt.Fprintf(os.Stderr, "  %s %s\n", progName, progVer)
 	fmt.Fprintf(os.Stderr, "\nSynopsis:\n")
 	fmt.Fprintf(os.Stderr, "  %s [global_options] MUSIC_SOURCE MOUNTPOINT \n", progName)
+	fmt.Fprintf(os.Stderr, "  %s [global_options] sync [sync_options] TARGET\n", progName)
+	fmt.Fprintf(os.Stderr, "  %s [global_options] sync-library [sync_options] MUSIC_SOURCE PEER_DB PEER_SOURCE\n", progName)
+	fmt.Fprintf(os.Stderr, "  %s [global_options] verify\n", progName)
+	fmt.Fprintf(os.Stderr, "  %s [global_options] dedupe [-dry_run] MUSIC_SOURCE\n", progName)
+	fmt.Fprintf(os.Stderr, "  %s [global_options] normalize-preview MUSIC_SOURCE\n", progName)
+	fmt.Fprintf(os.Stderr, "  %s [global_options] scan-report\n", progName)
+	fmt.Fprintf(os.Stderr, "  %s [global_options] retag [filters] [-dry_run] -set field=value MUSIC_SOURCE\n", progName)
+	fmt.Fprintf(os.Stderr, "  %s [global_options] import-scrobbles [import_options] SCROBBLER_LOG\n", progName)
+	fmt.Fprintf(os.Stderr, "  %s [global_options] import-ratings LIBRARY_EXPORT\n", progName)
+	fmt.Fprintf(os.Stderr, "  %s [global_options] import-beets BEETS_LIBRARY\n", progName)
+	fmt.Fprintf(os.Stderr, "  %s [global_options] repair-playlists [-prune] MUSIC_SOURCE\n", progName)
+	fmt.Fprintf(os.Stderr, "  %s [global_options] export-playlist PLAYLIST [FILE]\n", progName)
+	fmt.Fprintf(os.Stderr, "  %s [global_options] import-playlist [-name NAME] MUSIC_SOURCE FILE\n", progName)
 	fmt.Fprintf(os.Stderr, "\nDescription:\n")
 	fmt.Fprintf(os.Stderr, "  Mounts a filesystem in MOUNTPOINT with the music files obtained\n")
 	fmt.Fprintf(os.Stderr, "  from MUSIC_SOURCE ordered in folders by Artist and Album.\n")
@@ -58,6 +181,7 @@ func usage() {
 	fmt.Fprintf(os.Stderr, "\nParams:\n")
 	fmt.Fprintf(os.Stderr, "  MUSIC_SOURCE: The path of the folder containing the music files.\n")
 	fmt.Fprintf(os.Stderr, "  MOUNTPOINT: The path where MuLi should be mounted.\n")
+	fmt.Fprintf(os.Stderr, "  TARGET: The Directory where the Songs are synchronized.\n")
 	fmt.Fprintf(os.Stderr, "\nGlobal Options:\n")
 	flag.PrintDefaults()
 	fmt.Fprintf(os.Stderr, "\n")
@@ -82,6 +206,115 @@ func main() {
 	gid_conf := flag.Uint("gid", 0, "Group owner of the files.")
 	allow_other := flag.Bool("allow_other", false, "Allow other users to access the filesystem.")
 	allow_root := flag.Bool("allow_root", false, "Allow root to access the filesystem.")
+	album_m3u_absolute := flag.Bool("album_m3u_absolute", false, "Use absolute paths in the album.m3u files.")
+	songs_artist_names := flag.Bool("songs_artist_names", false, "Name the files in the songs view as Artist - Song.")
+	case_insensitive := flag.Bool("case_insensitive", false, "Ignore the case of the names when looking up files.")
+	absorb_files := flag.String("absorb_files", defaultAbsorbFiles, "Semicolon separated patterns of files that are accepted and discarded.")
+	passthrough_files := flag.String("passthrough_files", "", "Semicolon separated patterns of non music files stored as they are in the Albums.")
+	daemon := flag.Bool("daemon", false, "Run in background and mount again the filesystem if it fails.")
+	mount_retries := flag.Int("mount_retries", 5, "Times to retry the mount in daemon mode.")
+	extras := flag.String("extras", extrasIgnore, "How to show the extra files found with the music: ignore, passthrough or collect.")
+	extra_files := flag.String("extra_files", defaultExtraFiles, "Semicolon separated patterns of the extra files.")
+	artwork_files := flag.String("artwork_files", defaultArtworkFiles, "Semicolon separated patterns of the cover images shown in the Albums.")
+	artist_files := flag.String("artist_files", defaultArtistFiles, "Semicolon separated patterns of the Artist images.")
+	fetch_descriptions := flag.Bool("fetch_descriptions", false, "Complete the descriptions with the information from MusicBrainz.")
+	discogs_token := flag.String("discogs_token", "", "Discogs personal access token used to identify the dropped Songs and complete the descriptions.")
+	lastfm_key := flag.String("lastfm_key", "", "Last.fm API key used to show the similar Artists view.")
+	genre_playlists := flag.Bool("genre_playlists", false, "Generate a playlist for every genre in the Library.")
+	decade_playlists := flag.Bool("decade_playlists", false, "Generate a playlist for every decade in the Library.")
+	most_played := flag.Int("most_played", 0, "Number of Songs in the most played playlist, 0 disables it.")
+	most_played_days := flag.Int("most_played_days", 30, "Days of plays used for the most played playlist, 0 uses all of them.")
+	recently_played := flag.Int("recently_played", 0, "Number of Songs in the recently-played view, 0 disables it.")
+	shuffle := flag.Int("shuffle", 0, "Number of random Songs in the shuffle view, 0 disables it.")
+	queue := flag.Bool("queue", false, "Handle the queue playlist as a listening queue.")
+	playlist_dedup := flag.Bool("playlist_dedup", false, "Remove the duplicated Songs when they are added to a playlist.")
+	playlist_paths := flag.String("playlist_paths", playlistmgr.PathSource, "Paths of the Songs in the playlist files: source, mount or relative.")
+	playlist_rewrite := flag.String("playlist_rewrite", "", "Replace a prefix of the paths in the playlist files, in the OLD:NEW format.")
+	import_playlists := flag.String("import_playlists", "", "Directory with M3U and PLS playlists imported when mounting.")
+	stable_files := flag.Bool("stable_files", false, "Keep the files unchanged when they are only read, for incremental backups.")
+	scrub_interval := flag.Int("scrub_interval", 0, "Hours between the checks of the Songs checksums in background, 0 disables it.")
+	scrub_rate := flag.Int("scrub_rate", 1024, "Speed in KB per second used to read the Songs when checking them in background.")
+	audiobooks := flag.Bool("audiobooks", false, "Show the audiobooks view in the root Directory.")
+	audiobook_genres := flag.String("audiobook_genres", defaultAudiobookGenres, "Semicolon separated genres of the audiobooks.")
+	profiles := flag.String("profiles", "", "File with the access profiles of the users.")
+	guest := flag.Bool("guest", false, "Only allow the owner of the files to modify the Library and see the guest_hidden files.")
+	guest_hidden := flag.String("guest_hidden", "", "Semicolon separated patterns of the paths hidden in guest mode.")
+	db_keyfile := flag.String("db_keyfile", "", "File with the key or passphrase used to encrypt the database.")
+	normalize := flag.String("normalize", "", "Semicolon separated rules applied to the tags: whitespace, junk, titlecase and swap.")
+	junk_patterns := flag.String("junk_patterns", musicmgr.DefaultJunkPatterns, "Semicolon separated regular expressions removed by the junk rule.")
+	path_patterns := flag.String("path_patterns", "", "Semicolon separated patterns used to read the missing tags from the paths.")
+	classical := flag.Bool("classical", false, "Show the classical view in the root Directory.")
+	classical_genres := flag.String("classical_genres", defaultClassicalGenres, "Semicolon separated genres shown in the classical view.")
+	composers := flag.Bool("composers", false, "Show the composers and conductors views in the root Directory.")
+	bpm := flag.Bool("bpm", false, "Show the bpm view in the root Directory.")
+	bpm_command := flag.String("bpm_command", "", "Command that prints the BPM of the music file passed as the last argument.")
+	keys := flag.Bool("keys", false, "Show the keys view in the root Directory.")
+	gapless_safe := flag.Bool("gapless_safe", false, "Do not rewrite the tags of the MP3 files whose gapless information cannot be preserved.")
+	quality := flag.Bool("quality", false, "Show the quality view in the root Directory.")
+	check_mp3 := flag.Bool("check_mp3", false, "Check the MP3 files for corrupt frames while scanning.")
+	repair_mp3 := flag.Bool("repair_mp3", false, "Remove the garbage before the first frame of the corrupt MP3 files while scanning.")
+	rmdir := flag.String("rmdir", rmdirDelete, "What happens with the Songs when an Artist or Album Directory is removed: refuse, virtual, delete or trash.")
+	library_only := flag.Bool("library_only", false, "Never delete the files in the source Directory, the removed Songs are only removed from MuLi.")
+	audit := flag.Bool("audit", false, "Record the operations that change the Library in the audit log.")
+	webhooks := flag.String("webhooks", "", "Semicolon separated URLs that receive the JSON events of the changes in the Library.")
+	metadata_providers := flag.String("metadata_providers", "", "Semicolon separated metadata providers asked in order: "+strings.Join(metadata.Names(), ", ")+".")
+	tag_writers := flag.String("tag_writers", "", "Semicolon separated external commands that write the tags, like .flac=COMMAND.")
+	pre_drop_hook := flag.String("pre_drop_hook", "", "Command run before a dropped Song is added, the drop fails if the command fails.")
+	post_drop_hook := flag.String("post_drop_hook", "", "Command run after a dropped Song is added.")
+	pre_retag_hook := flag.String("pre_retag_hook", "", "Command run before a Song is retagged, the retag fails if the command fails.")
+	post_retag_hook := flag.String("post_retag_hook", "", "Command run after a Song is retagged.")
+	background_rate := flag.Int("background_rate", 0, "Speed in MB per second used by the background work like the scans and the scrubber, 0 is unlimited.")
+	background_ops := flag.Int("background_ops", 0, "Files per second handled by the background work like the scans and the scrubber, 0 is unlimited.")
+	pprof_port := flag.Int("pprof_port", 0, "Local port where the net/http/pprof profiles are served, 0 does not serve them.")
+	dir_sizes := flag.Bool("dir_sizes", false, "Report the total size of the Songs as the size of the Artist and Album Directories.")
+	mirror_dir := flag.String("mirror_dir", "", "Directory kept with a symbolic link to every Song, for the devices that cannot mount MuLi.")
+	mirror_template := flag.String("mirror_template", tools.DefaultSyncTemplate, "Path of the links in the mirror Directory.")
+	nfo := flag.Bool("nfo", false, "Show the read only artist.nfo and album.nfo files for the media centers.")
+	media_view := flag.Bool("media_view", false, "Show the media view with the Library named following the Plex and Jellyfin conventions.")
+	ratings := flag.Bool("ratings", false, "Show the ratings view in the root Directory.")
+	album_drop := flag.Bool("album_drop", false, "Hold the dropped Songs and file every Album at once when no more of its Songs are dropped.")
+	album_drop_delay := flag.Int("album_drop_delay", 10, "Seconds without new Songs of an Album before it is filed with album_drop.")
+	drop_settle := flag.Int("drop_settle", 3, "Seconds without writes to a dropped file before it is filed.")
+	io_timeout := flag.Int("io_timeout", 0, "Seconds before the accesses to the source Directory are considered failed, 0 disables it.")
+	io_retries := flag.Int("io_retries", 0, "Times to retry the accesses to the source Directory that fail because of network problems.")
+	slow_read := flag.Int("slow_read", 500, "Milliseconds after which the reads of the Songs are logged as slow, 0 disables it.")
+	album_artist := flag.Bool("album_artist", false, "Group the Songs by their album artist tag instead of by their Artist.")
+	versions := flag.String("versions", versionsAll, "Versions of the Songs stored in a lossless and a lossy format shown in the Albums: all, original or transcoded.")
+	subtree := flag.String("subtree", "", "Only mount an Artist, a genre or a playlist read only, as artist:NAME, genre:NAME or playlist:NAME.")
+	in_memory := flag.Bool("in_memory", false, "Keep the database in memory and mount read only, for the mounts that are thrown away.")
+	read_only := flag.Bool("read_only", false, "Mount read only sharing the database with the MuLi that modifies it.")
+	genres := flag.Bool("genres", false, "Show the genres view in the root Directory, the Songs moved between its Directories change their genre.")
+	genre_inference := flag.String("genre_inference", genreInferenceNone, "Source of the genre of the dropped Songs without one: none, artist or lastfm.")
+	playlist_names := flag.String("playlist_names", store.PlaylistNamesCompatible, "Names of the playlist Directories: compatible like the Artists and Albums, or keep.")
+	music_extensions := flag.String("music_extensions", defaultMusicExtensions, "Semicolon separated extensions of the files treated as music files.")
+	min_size := flag.Int("min_size", 0, "Kilobytes under which the music files are skipped when scanning and dropping, 0 disables it.")
+	snapshots := flag.Int("snapshots", 0, "Number of snapshots of the index kept after the scans and shown in .snapshots, 0 disables them.")
+	notify := flag.String("notify", "", "Semicolon separated targets of the notifications: ntfy:URL, gotify:URL or mailto:ADDRESS.")
+	smtp_server := flag.String("smtp_server", "", "Mail server of the mailto notifications: [user:password@]host:port.")
+	smtp_from := flag.String("smtp_from", "", "Sender of the mailto notifications.")
+	maintenance_window := flag.String("maintenance_window", "", "Time of the day when the scrubber and the podcast downloads run: HH:MM-HH:MM, empty runs them at any time.")
+	tombstones := flag.Bool("tombstones", false, "Keep the Songs whose files are missing in the missing Directory until they are restored or purged.")
+	artist_index := flag.Int("artist_index", 0, "Number of letters of the Directories that group the Artists in the artists view, 0 disables it.")
+	crates := flag.Bool("crates", false, "Show the crates Directory with the working sets of Songs.")
+	web := flag.String("web", "", "Address as host:port where the web interface is served, empty does not serve it.")
+	web_auth := flag.String("web_auth", "", "User and password as user:password required by the web interface.")
+	web_hosts := flag.String("web_hosts", "", "Semicolon separated host names accepted by the web interface besides the one of the web address.")
+	cast_targets := flag.String("cast_targets", "", "Semicolon separated NAME=KIND:HOST devices where the Songs are cast, the kinds are chromecast and airplay.")
+	cast_url := flag.String("cast_url", "", "URL of the web interface used by the cast targets, by default http:// and the web address.")
+	error_log_size := flag.Int("error_log_size", 100, "Amount of errors kept in the errors file of the .mulifs Directory, 0 disables it.")
+	force := flag.Bool("force", false, "Mount without checking the database and the source Directory first.")
+	description_fields := flag.String("description_fields", "", "Semicolon separated NAME:TYPE custom fields of the descriptions, the types are text, bool and number.")
+	completeness_interval := flag.Int("completeness_interval", 0, "Hours between the checks of the Albums track lists in MusicBrainz, 0 disables it.")
+	tag_sidecars := flag.Bool("tag_sidecars", false, "Store the tag changes of the formats MuLi cannot write in .tags.json files next to them.")
+	watch_dirs := flag.String("watch_dirs", "", "Semicolon separated Directories outside the music source whose new music files are moved to the drop Directory.")
+	ignore_files := flag.String("ignore_files", "", "Semicolon separated patterns of the files and Directories ignored in the source Directory, ** matches any number of Directories.")
+	drop_targets := flag.String("drop_targets", "", "Semicolon separated NAME=ACTION extra drop Directories, the actions are playlist and genre.")
+	api := flag.String("api", "", "Unix socket where the management API is served.")
+	podcast_feeds := flag.String("podcast_feeds", "", "Semicolon separated URLs of the RSS feeds of the podcasts.")
+	podcast_interval := flag.Int("podcast_interval", 6, "Hours between the downloads of the new podcast episodes.")
+	podcast_episodes := flag.Int("podcast_episodes", 5, "Number of the latest episodes downloaded from every podcast.")
+	kernel_cache := flag.Bool("kernel_cache", false, "Allow the kernel to cache the file data between opens.")
+	read_ahead := flag.Int("read_ahead", 0, "Size in KB of the read ahead buffer of the open files, 0 disables it.")
 
 	flag.Parse()
 		
@@ -106,6 +339,339 @@ func main() {
 				allow_root = newTrue()
 			} else if strings.Compare(token, "allow_other") == 0 {
 				allow_other = newTrue()
+			} else if strings.Compare(token, "album_m3u_absolute") == 0 {
+				album_m3u_absolute = newTrue()
+			} else if strings.Compare(token, "songs_artist_names") == 0 {
+				songs_artist_names = newTrue()
+			} else if strings.Compare(token, "case_insensitive") == 0 {
+				case_insensitive = newTrue()
+			} else if strings.HasPrefix(token, "absorb_files=") {
+				*absorb_files = token[len("absorb_files="):]
+			} else if strings.HasPrefix(token, "passthrough_files=") {
+				*passthrough_files = token[len("passthrough_files="):]
+			} else if strings.Compare(token, "daemon") == 0 {
+				daemon = newTrue()
+			} else if strings.HasPrefix(token, "mount_retries=") {
+				parsed_retries, err := strconv.Atoi(token[len("mount_retries="):])
+				if err != nil {
+					log.Fatal(err)
+					os.Exit(1)
+				}
+				*mount_retries = parsed_retries
+			} else if strings.HasPrefix(token, "rmdir=") {
+				*rmdir = token[len("rmdir="):]
+			} else if strings.HasPrefix(token, "extras=") {
+				*extras = token[len("extras="):]
+			} else if strings.HasPrefix(token, "extra_files=") {
+				*extra_files = token[len("extra_files="):]
+			} else if strings.HasPrefix(token, "artwork_files=") {
+				*artwork_files = token[len("artwork_files="):]
+			} else if strings.HasPrefix(token, "artist_files=") {
+				*artist_files = token[len("artist_files="):]
+			} else if strings.Compare(token, "kernel_cache") == 0 {
+				kernel_cache = newTrue()
+			} else if strings.Compare(token, "genre_playlists") == 0 {
+				genre_playlists = newTrue()
+			} else if strings.Compare(token, "decade_playlists") == 0 {
+				decade_playlists = newTrue()
+			} else if strings.Compare(token, "playlist_dedup") == 0 {
+				playlist_dedup = newTrue()
+			} else if strings.HasPrefix(token, "playlist_paths=") {
+				*playlist_paths = token[len("playlist_paths="):]
+			} else if strings.HasPrefix(token, "playlist_rewrite=") {
+				*playlist_rewrite = token[len("playlist_rewrite="):]
+			} else if strings.HasPrefix(token, "import_playlists=") {
+				*import_playlists = token[len("import_playlists="):]
+			} else if strings.Compare(token, "stable_files") == 0 {
+				stable_files = newTrue()
+			} else if strings.Compare(token, "queue") == 0 {
+				queue = newTrue()
+			} else if strings.Compare(token, "fetch_descriptions") == 0 {
+				fetch_descriptions = newTrue()
+			} else if strings.HasPrefix(token, "discogs_token=") {
+				*discogs_token = token[len("discogs_token="):]
+			} else if strings.HasPrefix(token, "lastfm_key=") {
+				*lastfm_key = token[len("lastfm_key="):]
+			} else if strings.HasPrefix(token, "most_played=") {
+				parsed_most_played, err := strconv.Atoi(token[len("most_played="):])
+				if err != nil {
+					log.Fatal(err)
+					os.Exit(1)
+				}
+				*most_played = parsed_most_played
+			} else if strings.HasPrefix(token, "most_played_days=") {
+				parsed_most_played_days, err := strconv.Atoi(token[len("most_played_days="):])
+				if err != nil {
+					log.Fatal(err)
+					os.Exit(1)
+				}
+				*most_played_days = parsed_most_played_days
+			} else if strings.HasPrefix(token, "recently_played=") {
+				parsed_recently_played, err := strconv.Atoi(token[len("recently_played="):])
+				if err != nil {
+					log.Fatal(err)
+					os.Exit(1)
+				}
+				*recently_played = parsed_recently_played
+			} else if strings.HasPrefix(token, "shuffle=") {
+				parsed_shuffle, err := strconv.Atoi(token[len("shuffle="):])
+				if err != nil {
+					log.Fatal(err)
+					os.Exit(1)
+				}
+				*shuffle = parsed_shuffle
+			} else if strings.HasPrefix(token, "scrub_interval=") {
+				parsed_scrub_interval, err := strconv.Atoi(token[len("scrub_interval="):])
+				if err != nil {
+					log.Fatal(err)
+					os.Exit(1)
+				}
+				*scrub_interval = parsed_scrub_interval
+			} else if strings.HasPrefix(token, "scrub_rate=") {
+				parsed_scrub_rate, err := strconv.Atoi(token[len("scrub_rate="):])
+				if err != nil {
+					log.Fatal(err)
+					os.Exit(1)
+				}
+				*scrub_rate = parsed_scrub_rate
+			} else if strings.Compare(token, "audiobooks") == 0 {
+				audiobooks = newTrue()
+			} else if strings.HasPrefix(token, "audiobook_genres=") {
+				*audiobook_genres = token[len("audiobook_genres="):]
+			} else if strings.HasPrefix(token, "profiles=") {
+				*profiles = token[len("profiles="):]
+			} else if strings.Compare(token, "guest") == 0 {
+				guest = newTrue()
+			} else if strings.HasPrefix(token, "guest_hidden=") {
+				*guest_hidden = token[len("guest_hidden="):]
+			} else if strings.HasPrefix(token, "db_keyfile=") {
+				*db_keyfile = token[len("db_keyfile="):]
+			} else if strings.HasPrefix(token, "normalize=") {
+				*normalize = token[len("normalize="):]
+			} else if strings.HasPrefix(token, "junk_patterns=") {
+				*junk_patterns = token[len("junk_patterns="):]
+			} else if strings.HasPrefix(token, "path_patterns=") {
+				*path_patterns = token[len("path_patterns="):]
+			} else if strings.Compare(token, "classical") == 0 {
+				classical = newTrue()
+			} else if strings.HasPrefix(token, "classical_genres=") {
+				*classical_genres = token[len("classical_genres="):]
+			} else if strings.Compare(token, "composers") == 0 {
+				composers = newTrue()
+			} else if strings.Compare(token, "bpm") == 0 {
+				bpm = newTrue()
+			} else if strings.Compare(token, "gapless_safe") == 0 {
+				gapless_safe = newTrue()
+			} else if strings.Compare(token, "library_only") == 0 {
+				library_only = newTrue()
+			} else if strings.Compare(token, "audit") == 0 {
+				audit = newTrue()
+			} else if strings.Compare(token, "check_mp3") == 0 {
+				check_mp3 = newTrue()
+			} else if strings.Compare(token, "repair_mp3") == 0 {
+				repair_mp3 = newTrue()
+			} else if strings.Compare(token, "quality") == 0 {
+				quality = newTrue()
+			} else if strings.Compare(token, "keys") == 0 {
+				keys = newTrue()
+			} else if strings.HasPrefix(token, "bpm_command=") {
+				*bpm_command = token[len("bpm_command="):]
+			} else if strings.HasPrefix(token, "webhooks=") {
+				*webhooks = token[len("webhooks="):]
+			} else if strings.HasPrefix(token, "metadata_providers=") {
+				*metadata_providers = token[len("metadata_providers="):]
+			} else if strings.HasPrefix(token, "tag_writers=") {
+				*tag_writers = token[len("tag_writers="):]
+			} else if strings.HasPrefix(token, "pre_drop_hook=") {
+				*pre_drop_hook = token[len("pre_drop_hook="):]
+			} else if strings.HasPrefix(token, "post_drop_hook=") {
+				*post_drop_hook = token[len("post_drop_hook="):]
+			} else if strings.HasPrefix(token, "pre_retag_hook=") {
+				*pre_retag_hook = token[len("pre_retag_hook="):]
+			} else if strings.HasPrefix(token, "post_retag_hook=") {
+				*post_retag_hook = token[len("post_retag_hook="):]
+			} else if strings.HasPrefix(token, "background_rate=") {
+				parsed_background_rate, err := strconv.Atoi(token[len("background_rate="):])
+				if err != nil {
+					log.Fatal(err)
+					os.Exit(1)
+				}
+				*background_rate = parsed_background_rate
+			} else if strings.HasPrefix(token, "background_ops=") {
+				parsed_background_ops, err := strconv.Atoi(token[len("background_ops="):])
+				if err != nil {
+					log.Fatal(err)
+					os.Exit(1)
+				}
+				*background_ops = parsed_background_ops
+			} else if strings.HasPrefix(token, "pprof_port=") {
+				parsed_pprof_port, err := strconv.Atoi(token[len("pprof_port="):])
+				if err != nil {
+					log.Fatal(err)
+					os.Exit(1)
+				}
+				*pprof_port = parsed_pprof_port
+			} else if strings.Compare(token, "dir_sizes") == 0 {
+				dir_sizes = newTrue()
+			} else if strings.HasPrefix(token, "mirror_dir=") {
+				*mirror_dir = token[len("mirror_dir="):]
+			} else if strings.HasPrefix(token, "mirror_template=") {
+				*mirror_template = token[len("mirror_template="):]
+			} else if strings.Compare(token, "nfo") == 0 {
+				nfo = newTrue()
+			} else if strings.Compare(token, "media_view") == 0 {
+				media_view = newTrue()
+			} else if strings.Compare(token, "ratings") == 0 {
+				ratings = newTrue()
+			} else if strings.HasPrefix(token, "drop_targets=") {
+				*drop_targets = token[len("drop_targets="):]
+			} else if strings.Compare(token, "album_drop") == 0 {
+				album_drop = newTrue()
+			} else if strings.HasPrefix(token, "album_drop_delay=") {
+				parsed_album_drop_delay, err := strconv.Atoi(token[len("album_drop_delay="):])
+				if err != nil {
+					log.Fatal(err)
+					os.Exit(1)
+				}
+				*album_drop_delay = parsed_album_drop_delay
+			} else if strings.HasPrefix(token, "drop_settle=") {
+				parsed_drop_settle, err := strconv.Atoi(token[len("drop_settle="):])
+				if err != nil {
+					log.Fatal(err)
+					os.Exit(1)
+				}
+				*drop_settle = parsed_drop_settle
+			} else if strings.HasPrefix(token, "io_timeout=") {
+				parsed_io_timeout, err := strconv.Atoi(token[len("io_timeout="):])
+				if err != nil {
+					log.Fatal(err)
+					os.Exit(1)
+				}
+				*io_timeout = parsed_io_timeout
+			} else if strings.HasPrefix(token, "io_retries=") {
+				parsed_io_retries, err := strconv.Atoi(token[len("io_retries="):])
+				if err != nil {
+					log.Fatal(err)
+					os.Exit(1)
+				}
+				*io_retries = parsed_io_retries
+			} else if strings.HasPrefix(token, "slow_read=") {
+				parsed_slow_read, err := strconv.Atoi(token[len("slow_read="):])
+				if err != nil {
+					log.Fatal(err)
+					os.Exit(1)
+				}
+				*slow_read = parsed_slow_read
+			} else if strings.Compare(token, "album_artist") == 0 {
+				album_artist = newTrue()
+			} else if strings.HasPrefix(token, "versions=") {
+				*versions = token[len("versions="):]
+			} else if strings.HasPrefix(token, "subtree=") {
+				*subtree = token[len("subtree="):]
+			} else if strings.Compare(token, "in_memory") == 0 {
+				in_memory = newTrue()
+			} else if strings.Compare(token, "read_only") == 0 {
+				read_only = newTrue()
+			} else if strings.Compare(token, "genres") == 0 {
+				genres = newTrue()
+			} else if strings.HasPrefix(token, "genre_inference=") {
+				*genre_inference = token[len("genre_inference="):]
+			} else if strings.HasPrefix(token, "playlist_names=") {
+				*playlist_names = token[len("playlist_names="):]
+			} else if strings.HasPrefix(token, "ignore_files=") {
+				*ignore_files = token[len("ignore_files="):]
+			} else if strings.HasPrefix(token, "music_extensions=") {
+				*music_extensions = token[len("music_extensions="):]
+			} else if strings.HasPrefix(token, "min_size=") {
+				parsed_min_size, err := strconv.Atoi(token[len("min_size="):])
+				if err != nil {
+					log.Fatal(err)
+					os.Exit(1)
+				}
+				*min_size = parsed_min_size
+			} else if strings.HasPrefix(token, "snapshots=") {
+				parsed_snapshots, err := strconv.Atoi(token[len("snapshots="):])
+				if err != nil {
+					log.Fatal(err)
+					os.Exit(1)
+				}
+				*snapshots = parsed_snapshots
+			} else if strings.HasPrefix(token, "notify=") {
+				*notify = token[len("notify="):]
+			} else if strings.HasPrefix(token, "smtp_server=") {
+				*smtp_server = token[len("smtp_server="):]
+			} else if strings.HasPrefix(token, "smtp_from=") {
+				*smtp_from = token[len("smtp_from="):]
+			} else if strings.HasPrefix(token, "maintenance_window=") {
+				*maintenance_window = token[len("maintenance_window="):]
+			} else if strings.Compare(token, "tombstones") == 0 {
+				tombstones = newTrue()
+			} else if strings.HasPrefix(token, "artist_index=") {
+				parsed_artist_index, err := strconv.Atoi(token[len("artist_index="):])
+				if err != nil {
+					log.Fatal(err)
+					os.Exit(1)
+				}
+				*artist_index = parsed_artist_index
+			} else if strings.Compare(token, "crates") == 0 {
+				crates = newTrue()
+			} else if strings.HasPrefix(token, "web=") {
+				*web = token[len("web="):]
+			} else if strings.HasPrefix(token, "web_auth=") {
+				*web_auth = token[len("web_auth="):]
+			} else if strings.HasPrefix(token, "web_hosts=") {
+				*web_hosts = token[len("web_hosts="):]
+			} else if strings.HasPrefix(token, "cast_targets=") {
+				*cast_targets = token[len("cast_targets="):]
+			} else if strings.HasPrefix(token, "cast_url=") {
+				*cast_url = token[len("cast_url="):]
+			} else if strings.HasPrefix(token, "description_fields=") {
+				*description_fields = token[len("description_fields="):]
+			} else if strings.Compare(token, "force") == 0 {
+				force = newTrue()
+			} else if strings.HasPrefix(token, "error_log_size=") {
+				parsed_error_log_size, err := strconv.Atoi(token[len("error_log_size="):])
+				if err != nil {
+					log.Fatal(err)
+					os.Exit(1)
+				}
+				*error_log_size = parsed_error_log_size
+			} else if strings.HasPrefix(token, "completeness_interval=") {
+				parsed_completeness_interval, err := strconv.Atoi(token[len("completeness_interval="):])
+				if err != nil {
+					log.Fatal(err)
+					os.Exit(1)
+				}
+				*completeness_interval = parsed_completeness_interval
+			} else if strings.Compare(token, "tag_sidecars") == 0 {
+				tag_sidecars = newTrue()
+			} else if strings.HasPrefix(token, "watch_dirs=") {
+				*watch_dirs = token[len("watch_dirs="):]
+			} else if strings.HasPrefix(token, "api=") {
+				*api = token[len("api="):]
+			} else if strings.HasPrefix(token, "podcast_feeds=") {
+				*podcast_feeds = token[len("podcast_feeds="):]
+			} else if strings.HasPrefix(token, "podcast_interval=") {
+				parsed_podcast_interval, err := strconv.Atoi(token[len("podcast_interval="):])
+				if err != nil {
+					log.Fatal(err)
+					os.Exit(1)
+				}
+				*podcast_interval = parsed_podcast_interval
+			} else if strings.HasPrefix(token, "podcast_episodes=") {
+				parsed_podcast_episodes, err := strconv.Atoi(token[len("podcast_episodes="):])
+				if err != nil {
+					log.Fatal(err)
+					os.Exit(1)
+				}
+				*podcast_episodes = parsed_podcast_episodes
+			} else if strings.HasPrefix(token, "read_ahead=") {
+				parsed_read_ahead, err := strconv.Atoi(token[len("read_ahead="):])
+				if err != nil {
+					log.Fatal(err)
+					os.Exit(1)
+				}
+				*read_ahead = parsed_read_ahead
 			} else if strings.HasPrefix(token, "uid=") {
 				parsed_uid, err := strconv.ParseUint(token[len("uid="):], 10, 32)
 				if err != nil {
@@ -136,6 +702,291 @@ func main() {
 
 	config_params = fs_config{
 		uid: *uid_conf, gid: *gid_conf, allow_users: *allow_other, allow_root: *allow_root,
+		album_m3u_absolute: *album_m3u_absolute, songs_artist_names: *songs_artist_names,
+		case_insensitive: *case_insensitive,
+		absorb_files:     parsePatterns(*absorb_files), passthrough_files: parsePatterns(*passthrough_files),
+		daemon: *daemon, mount_retries: *mount_retries, read_ahead: *read_ahead,
+		kernel_cache: *kernel_cache,
+		extras:       *extras, extra_files: parsePatterns(*extra_files),
+		artwork_files: parsePatterns(*artwork_files), artist_files: parsePatterns(*artist_files),
+		fetch_descriptions: *fetch_descriptions, discogs_token: *discogs_token,
+		lastfm_key: *lastfm_key, genre_playlists: *genre_playlists,
+		decade_playlists: *decade_playlists,
+		most_played:      *most_played, most_played_days: *most_played_days,
+		recently_played: *recently_played, shuffle: *shuffle, queue: *queue,
+		playlist_dedup: *playlist_dedup,
+		playlist_paths: *playlist_paths, playlist_rewrite: *playlist_rewrite,
+		import_playlists: *import_playlists, stable_files: *stable_files,
+		scrub_interval: *scrub_interval, scrub_rate: *scrub_rate,
+		audiobooks: *audiobooks, audiobook_genres: parsePatterns(*audiobook_genres),
+		profiles: *profiles, guest: *guest, guest_hidden: parsePatterns(*guest_hidden),
+		podcast_feeds: parsePatterns(*podcast_feeds), podcast_interval: *podcast_interval,
+		podcast_episodes: *podcast_episodes, db_keyfile: *db_keyfile,
+		normalize: parsePatterns(*normalize), junk_patterns: parsePatterns(*junk_patterns),
+		path_patterns: parsePatterns(*path_patterns),
+		classical:     *classical, classical_genres: parsePatterns(*classical_genres),
+		composers: *composers, bpm: *bpm, bpm_command: strings.Fields(*bpm_command),
+		keys:               *keys,
+		gapless_safe:       *gapless_safe,
+		quality:            *quality,
+		check_mp3:          *check_mp3,
+		repair_mp3:         *repair_mp3,
+		rmdir:              *rmdir,
+		library_only:       *library_only,
+		audit:              *audit,
+		webhooks:           parsePatterns(*webhooks),
+		api:                *api,
+		metadata_providers: parsePatterns(*metadata_providers),
+		tag_writers:        parsePatterns(*tag_writers),
+		hooks: store.Hooks{
+			PreDrop: strings.Fields(*pre_drop_hook), PostDrop: strings.Fields(*post_drop_hook),
+			PreRetag: strings.Fields(*pre_retag_hook), PostRetag: strings.Fields(*post_retag_hook),
+		},
+		background_rate:       *background_rate,
+		background_ops:        *background_ops,
+		pprof_port:            *pprof_port,
+		dir_sizes:             *dir_sizes,
+		mirror_dir:            *mirror_dir,
+		mirror_template:       *mirror_template,
+		nfo:                   *nfo,
+		media_view:            *media_view,
+		ratings:               *ratings,
+		drop_targets:          parsePatterns(*drop_targets),
+		album_drop:            *album_drop,
+		album_drop_delay:      *album_drop_delay,
+		drop_settle:           *drop_settle,
+		io_timeout:            *io_timeout,
+		io_retries:            *io_retries,
+		slow_read:             *slow_read,
+		album_artist:          *album_artist,
+		versions:              *versions,
+		subtree:               *subtree,
+		in_memory:             *in_memory,
+		read_only:             *read_only,
+		genres:                *genres,
+		genre_inference:       *genre_inference,
+		playlist_names:        *playlist_names,
+		ignore_files:          parsePatterns(*ignore_files),
+		music_extensions:      parsePatterns(*music_extensions),
+		min_size:              *min_size,
+		snapshots:             *snapshots,
+		notify:                parsePatterns(*notify),
+		smtp_server:           *smtp_server,
+		smtp_from:             *smtp_from,
+		maintenance_window:    *maintenance_window,
+		tombstones:            *tombstones,
+		artist_index:          *artist_index,
+		crates:                *crates,
+		web:                   *web,
+		web_auth:              *web_auth,
+		web_hosts:             parsePatterns(*web_hosts),
+		cast_targets:          parsePatterns(*cast_targets),
+		cast_url:              *cast_url,
+		description_fields:    parsePatterns(*description_fields),
+		force:                 *force,
+		error_log_size:        *error_log_size,
+		completeness_interval: *completeness_interval,
+		tag_sidecars:          *tag_sidecars,
+		watch_dirs:            parsePatterns(*watch_dirs),
+	}
+
+	if *extras != extrasIgnore && *extras != extrasPassthrough && *extras != extrasCollect {
+		log.Fatal("Error in extras, it must be ignore, passthrough or collect")
+		os.Exit(1)
+	}
+	if *rmdir != rmdirRefuse && *rmdir != rmdirVirtual && *rmdir != rmdirDelete && *rmdir != rmdirTrash {
+		log.Fatal("Error in rmdir, it must be refuse, virtual, delete or trash")
+		os.Exit(1)
+	}
+	if *versions != versionsAll && *versions != versionsOriginal && *versions != versionsTranscoded {
+		log.Fatal("Error in versions, it must be all, original or transcoded")
+		os.Exit(1)
+	}
+	if len(*subtree) > 0 {
+		kind, _, err := parseSubtree(*subtree)
+		if err != nil {
+			log.Fatal(err)
+			os.Exit(1)
+		}
+		// The genres are mounted from their auto playlists.
+		if kind == subtreeGenre {
+			config_params.genre_playlists = true
+		}
+	}
+	if *genre_inference != genreInferenceNone && *genre_inference != genreInferenceArtist && *genre_inference != genreInferenceLastFM {
+		log.Fatal("Error in genre_inference, it must be none, artist or lastfm")
+		os.Exit(1)
+	}
+	if *genre_inference == genreInferenceLastFM && len(*lastfm_key) < 1 {
+		log.Fatal("Error in genre_inference, lastfm requires the lastfm_key option")
+		os.Exit(1)
+	}
+	if *playlist_names != store.PlaylistNamesCompatible && *playlist_names != store.PlaylistNamesKeep {
+		log.Fatal("Error in playlist_names, it must be compatible or keep")
+		os.Exit(1)
+	}
+	if err := checkNotifyTargets(config_params.notify, config_params.smtp_server); err != nil {
+		log.Fatal("Error in notify, ", err)
+		os.Exit(1)
+	}
+	if len(*maintenance_window) > 0 {
+		maintenance, err = parseMaintenanceWindow(*maintenance_window)
+		if err != nil {
+			log.Fatal("Error in maintenance_window, ", err)
+			os.Exit(1)
+		}
+	}
+	if len(config_params.playlist_rewrite) > 0 && !strings.Contains(config_params.playlist_rewrite, ":") {
+		log.Fatal("Error in playlist_rewrite, it must be OLD:NEW")
+		os.Exit(1)
+	}
+	err = setDBEncryption()
+	if err != nil {
+		log.Fatal(err)
+		os.Exit(5)
+	}
+	if config_params.in_memory {
+		store.SetMemoryDB()
+	} else if config_params.read_only {
+		store.SetReadOnlyDB()
+	}
+	err = setNormalizeRules()
+	if err != nil {
+		log.Fatal(err)
+		os.Exit(1)
+	}
+	err = setMetadataProviders()
+	if err != nil {
+		log.Fatal(err)
+		os.Exit(1)
+	}
+	err = setDescriptionFields()
+	if err != nil {
+		log.Fatal(err)
+		os.Exit(1)
+	}
+	writers, err := musicmgr.ParseTagWriters(config_params.tag_writers)
+	if err != nil {
+		log.Fatal(err)
+		os.Exit(1)
+	}
+	musicmgr.SetTagWriters(writers)
+	musicmgr.SetTagSidecars(config_params.tag_sidecars)
+	musicmgr.SetAlbumArtistGrouping(config_params.album_artist)
+	musicmgr.SetMusicExtensions(config_params.music_extensions)
+	musicmgr.SetMinMusicSize(int64(config_params.min_size) * 1024)
+	store.SetHooks(config_params.hooks)
+	store.SetBackgroundLimits(config_params.background_rate*1024*1024, config_params.background_ops)
+
+	if flag.NArg() > 0 && flag.Arg(0) == "sync" {
+		runSync(db_path, flag.Args()[1:])
+		closeDB()
+		os.Exit(0)
+	}
+
+	if flag.NArg() > 0 && flag.Arg(0) == "sync-library" {
+		runLibrarySync(db_path, flag.Args()[1:])
+		closeDB()
+		os.Exit(0)
+	}
+
+	if flag.NArg() > 0 && flag.Arg(0) == "verify" {
+		runVerify(db_path, flag.Args()[1:])
+		closeDB()
+		os.Exit(0)
+	}
+
+	if flag.NArg() > 0 && flag.Arg(0) == "normalize-preview" {
+		runNormalizePreview(flag.Args()[1:])
+		os.Exit(0)
+	}
+
+	if flag.NArg() > 0 && flag.Arg(0) == "scan-report" {
+		runScanReport(db_path, flag.Args()[1:])
+		closeDB()
+		os.Exit(0)
+	}
+
+	if flag.NArg() > 0 && flag.Arg(0) == "retag" {
+		runRetag(db_path, flag.Args()[1:])
+		closeDB()
+		os.Exit(0)
+	}
+
+	if flag.NArg() > 0 && flag.Arg(0) == "dedupe" {
+		runDedupe(db_path, flag.Args()[1:])
+		closeDB()
+		os.Exit(0)
+	}
+
+	if flag.NArg() > 0 && flag.Arg(0) == "import-scrobbles" {
+		runImportScrobbles(db_path, flag.Args()[1:])
+		closeDB()
+		os.Exit(0)
+	}
+
+	if flag.NArg() > 0 && flag.Arg(0) == "import-ratings" {
+		runImportRatings(db_path, flag.Args()[1:])
+		closeDB()
+		os.Exit(0)
+	}
+
+	if flag.NArg() > 0 && flag.Arg(0) == "import-beets" {
+		runImportBeets(db_path, flag.Args()[1:])
+		closeDB()
+		os.Exit(0)
+	}
+
+	if flag.NArg() > 0 && flag.Arg(0) == "repair-playlists" {
+		runRepairPlaylists(db_path, flag.Args()[1:])
+		closeDB()
+		os.Exit(0)
+	}
+
+	if flag.NArg() > 0 && flag.Arg(0) == "export-playlist" {
+		runExportPlaylist(db_path, flag.Args()[1:])
+		closeDB()
+		os.Exit(0)
+	}
+
+	if flag.NArg() > 0 && flag.Arg(0) == "import-playlist" {
+		runImportPlaylist(db_path, flag.Args()[1:])
+		closeDB()
+		os.Exit(0)
+	}
+
+	registerExtrasView()
+	registerMulifsView()
+	registerSimilarView()
+	registerRecentView()
+	registerShuffleView()
+	registerPodcastsView()
+	registerAudiobooksView()
+	registerClassicalView()
+	registerMediaView()
+	registerComposersView()
+	registerBPMView()
+	registerKeysView()
+	registerQualityView()
+	registerRatingsView()
+	registerVersionsView()
+	registerGenresView()
+	registerSnapshotsView()
+	registerMissingView()
+	registerIncompleteView()
+	registerArtistsView()
+	registerCratesView()
+
+	err = setDropTargets()
+	if err != nil {
+		log.Fatal(err)
+		os.Exit(1)
+	}
+
+	err = setCastTargets()
+	if err != nil {
+		log.Fatal(err)
+		os.Exit(1)
 	}
 
 	if flag.NArg() < 2 {
@@ -155,35 +1006,202 @@ func main() {
 		os.Exit(4)
 	}
 
+	config_params.mountpoint, err = filepath.Abs(mountpoint)
+	if err != nil {
+		log.Fatal(err)
+		os.Exit(4)
+	}
+
+	if config_params.daemon {
+		parent, err := daemonize()
+		if err != nil {
+			log.Fatal(err)
+			os.Exit(10)
+		}
+		if parent {
+			os.Exit(0)
+		}
+	}
+
 	err = store.InitDB(db_path)
 	if err != nil {
 		log.Fatal(err)
 		os.Exit(5)
 	}
 
+	if identifier := metadataProviders.Identifier(); identifier != nil {
+		store.SetReleaseIdentifier(identifier)
+	}
+	setGenreInference()
+
 	path, err = filepath.Abs(path)
 	if err != nil {
 		log.Fatal(err)
 		os.Exit(6)
 	}
 
-	err = tools.ScanFolder(path)
+	// The Library is not scanned nor mounted if it
+	// looks broken, like without the source disk.
+	err = checkConsistency(path)
+	if err != nil {
+		log.Fatalf("%s. Use the force option to mount it anyway.", err)
+		os.Exit(23)
+	}
+
+	// The links inside the source Directory
+	// would be scanned as new Songs.
+	if len(config_params.mirror_dir) > 0 {
+		config_params.mirror_dir, err = filepath.Abs(config_params.mirror_dir)
+		if err != nil || strings.HasPrefix(config_params.mirror_dir+"/", path+"/") {
+			log.Fatal("The mirror Directory cannot be inside the music source.")
+			os.Exit(6)
+		}
+	}
+
+	// The files of the watch Directories are moved
+	// away, they cannot contain the source Directory.
+	for i, dir := range config_params.watch_dirs {
+		dir, err = filepath.Abs(dir)
+		if err != nil || strings.HasPrefix(dir+"/", path+"/") || strings.HasPrefix(path+"/", dir+"/") {
+			log.Fatal("The watch Directories cannot be inside the music source or contain it.")
+			os.Exit(6)
+		}
+		config_params.watch_dirs[i] = dir
+	}
+
+	store.SetBPMCommand(config_params.bpm_command)
+	store.SetPlaylistNames(config_params.playlist_names)
+	musicmgr.SetGaplessSafe(config_params.gapless_safe)
+	err = musicmgr.SetPathPatterns(path, config_params.path_patterns)
 	if err != nil {
 		log.Fatal(err)
-		os.Exit(7)
+		os.Exit(1)
+	}
+
+	// The shared mounts use the Library as the
+	// MuLi that modifies the database left it.
+	if !config_params.read_only {
+		err = store.ReplayJournal(path)
+		if err != nil {
+			log.Fatal(err)
+			os.Exit(11)
+		}
+	}
+
+	if config_params.extras != extrasIgnore {
+		tools.SetExtraFiles(config_params.extra_files)
+	}
+	tools.SetArtworkFiles(config_params.artwork_files)
+	tools.SetArtistFiles(config_params.artist_files)
+	store.SetIgnorePatterns(config_params.ignore_files)
+
+	if len(config_params.profiles) > 0 {
+		err = loadProfiles(config_params.profiles)
+		if err != nil {
+			log.Fatal(err)
+			os.Exit(1)
+		}
+	}
+
+	if config_params.guest {
+		owner := uint32(os.Getuid())
+		if config_params.uid != 0 {
+			owner = uint32(config_params.uid)
+		}
+		setGuestProfiles(owner, config_params.guest_hidden)
 	}
 
-	err = tools.ScanPlaylistFolder(path)
+	sdNotify("STATUS=Scanning the Music Library")
+	tools.SetCheckMp3(config_params.check_mp3, config_params.repair_mp3)
+	tools.SetSnapshots(config_params.snapshots)
+	tools.SetTombstones(config_params.tombstones)
+	if !config_params.read_only {
+		err = tools.ScanFolder(path)
+		if err != nil {
+			log.Fatal(err)
+			os.Exit(7)
+		}
+		notifyScan()
+	}
+
+	err = playlistmgr.SetPathStyle(config_params.playlist_paths, config_params.mountpoint)
 	if err != nil {
 		log.Fatal(err)
-		os.Exit(8)
+		os.Exit(1)
+	}
+	if len(config_params.playlist_rewrite) > 0 {
+		rewrite := strings.SplitN(config_params.playlist_rewrite, ":", 2)
+		playlistmgr.SetPathRewrite(rewrite[0], rewrite[1])
+	}
+
+	if !config_params.read_only {
+		err = tools.ScanPlaylistFolder(path)
+		if err != nil {
+			log.Fatal(err)
+			os.Exit(8)
+		}
+
+		if len(config_params.import_playlists) > 0 {
+			unresolved, err := tools.ImportPlaylistFolder(config_params.import_playlists, path)
+			if err != nil {
+				log.Fatal(err)
+				os.Exit(13)
+			}
+			for _, entry := range unresolved {
+				log.Printf("Cannot import %s\n", entry)
+			}
+		}
+
+		if config_params.queue {
+			err = store.EnableQueue(path)
+			if err != nil {
+				log.Fatal(err)
+				os.Exit(12)
+			}
+		}
+
+		err = regenerateAutoPlaylists(path)
+		if err != nil {
+			log.Printf("Cannot generate the auto playlists: %s\n", err)
+		}
+	}
+
+	if len(config_params.subtree) > 0 {
+		err = checkSubtree()
+		if err != nil {
+			log.Fatal(err)
+			os.Exit(22)
+		}
 	}
 
 	// Init the dispatcher system to process
 	// delayed events.
 	InitDispatcher()
+	handleSignals(mountpoint)
+	if !config_params.read_only {
+		startAutoPlaylistsTimer(path)
+		startScrubber(path)
+		startCompleteness()
+		startPodcasts(path)
+		startWatch(path)
+	}
+	startDBFlusher()
+	startWebhooks()
+	startNotifications()
+	startAPI(path)
+	startWeb(path)
+	startPprof()
+	startMirror()
 
-	if err = mount(path, mountpoint); err != nil {
+	if config_params.daemon {
+		err = superviseMount(path, mountpoint)
+	} else {
+		err = mount(path, mountpoint)
+	}
+
+	sdNotify("STOPPING=1")
+	shutdown()
+	if err != nil {
 		log.Fatal(err)
 		os.Exit(9)
 	}
@@ -200,6 +1218,9 @@ func mount(path, mountpoint string) error {
 		fuse.LocalVolume(),
 		fuse.VolumeName("Music Library"),
 	}
+	if len(config_params.subtree) > 0 || config_params.in_memory || config_params.read_only {
+		mountOptions = append(mountOptions, fuse.ReadOnly())
+	}
 
 	if config_params.allow_users {
 		mountOptions = append(mountOptions, fuse.AllowOther())
@@ -221,7 +1242,18 @@ func mount(path, mountpoint string) error {
 		mPoint: path,
 	}
 
-	if err := fs.Serve(c, filesys); err != nil {
+	// Tell systemd that the filesystem is ready
+	// once the mount is completed.
+	go func() {
+		<-c.Ready
+		if c.MountError == nil {
+			sdNotify("READY=1\nSTATUS=Serving " + mountpoint)
+		}
+	}()
+
+	fsServer = fs.New(c, nil)
+	store.SetChangeHandler(invalidateSong)
+	if err := fsServer.Serve(filesys); err != nil {
 		return err
 	}
 
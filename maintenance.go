@@ -0,0 +1,106 @@
+// Copyright 2016 Danko Miocevic. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Author: Danko Miocevic
+
+package main
+
+import (
+	"errors"
+	"strings"
+	"time"
+)
+
+// maintenanceWindow is the time of the day when the heavy
+// background work runs, start and end are the times since
+// midnight. The window ends the next day when end is
+// before start.
+type maintenanceWindow struct {
+	start time.Duration
+	end   time.Duration
+}
+
+// maintenance is the window set with the maintenance_window
+// option, the background work runs at any time without it.
+var maintenance *maintenanceWindow
+
+// maintenanceCheck is the longest time waited before
+// checking again if MuLi is stopping.
+const maintenanceCheck = time.Minute
+
+// parseMaintenanceWindow parses a window written as HH:MM-HH:MM.
+func parseMaintenanceWindow(value string) (*maintenanceWindow, error) {
+	items := strings.Split(value, "-")
+	if len(items) != 2 {
+		return nil, errors.New("The maintenance window must be HH:MM-HH:MM.")
+	}
+
+	var times [2]time.Duration
+	for i, item := range items {
+		t, err := time.Parse("15:04", strings.TrimSpace(item))
+		if err != nil {
+			return nil, errors.New("The maintenance window must be HH:MM-HH:MM.")
+		}
+		times[i] = time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute
+	}
+
+	if times[0] == times[1] {
+		return nil, errors.New("The maintenance window cannot be empty.")
+	}
+	return &maintenanceWindow{start: times[0], end: times[1]}, nil
+}
+
+// sinceMidnight returns the time passed since the
+// midnight of the day of t in its location.
+func sinceMidnight(t time.Time) time.Duration {
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute +
+		time.Duration(t.Second())*time.Second
+}
+
+// contains returns true if t is inside the window.
+func (w *maintenanceWindow) contains(t time.Time) bool {
+	now := sinceMidnight(t)
+	if w.start < w.end {
+		return now >= w.start && now < w.end
+	}
+	return now >= w.start || now < w.end
+}
+
+// untilOpen returns the time left until the window opens.
+func (w *maintenanceWindow) untilOpen(t time.Time) time.Duration {
+	left := w.start - sinceMidnight(t)
+	if left < 0 {
+		left += 24 * time.Hour
+	}
+	return left
+}
+
+// waitMaintenance blocks the heavy background work until the
+// maintenance window opens, it returns false if MuLi stops
+// while waiting. It returns at once without a window.
+func waitMaintenance() bool {
+	for !isStopping() {
+		now := time.Now()
+		if maintenance == nil || maintenance.contains(now) {
+			return true
+		}
+
+		wait := maintenance.untilOpen(now)
+		if wait > maintenanceCheck {
+			wait = maintenanceCheck
+		}
+		time.Sleep(wait)
+	}
+	return false
+}
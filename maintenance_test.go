@@ -0,0 +1,69 @@
+// Copyright 2016 Danko Miocevic. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Author: Danko Miocevic
+
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseMaintenanceWindow(t *testing.T) {
+	w, err := parseMaintenanceWindow("01:30 - 05:00")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if w.start != 90*time.Minute || w.end != 5*time.Hour {
+		t.Errorf("wrong window %v-%v", w.start, w.end)
+	}
+
+	for _, value := range []string{"", "01:30", "1-2", "01:30-25:00", "01:30-05:00-06:00", "03:00-03:00"} {
+		if _, err := parseMaintenanceWindow(value); err == nil {
+			t.Errorf("parseMaintenanceWindow(%q) accepted", value)
+		}
+	}
+}
+
+func TestMaintenanceWindowContains(t *testing.T) {
+	day := time.Date(2016, 5, 1, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		window string
+		at     time.Duration
+		want   bool
+		wait   time.Duration
+	}{
+		{"01:00-05:00", 3 * time.Hour, true, 22 * time.Hour},
+		{"01:00-05:00", 5 * time.Hour, false, 20 * time.Hour},
+		{"01:00-05:00", 30 * time.Minute, false, 30 * time.Minute},
+		{"23:00-02:00", 23*time.Hour + 30*time.Minute, true, 23*time.Hour + 30*time.Minute},
+		{"23:00-02:00", time.Hour, true, 22 * time.Hour},
+		{"23:00-02:00", 12 * time.Hour, false, 11 * time.Hour},
+	}
+
+	for _, test := range tests {
+		w, err := parseMaintenanceWindow(test.window)
+		if err != nil {
+			t.Fatal(err)
+		}
+		at := day.Add(test.at)
+		if got := w.contains(at); got != test.want {
+			t.Errorf("%s contains %s = %v, want %v", test.window, at.Format("15:04"), got, test.want)
+		}
+		if got := w.untilOpen(at); got != test.wait {
+			t.Errorf("%s opens in %s at %s, want %s", test.window, got, at.Format("15:04"), test.wait)
+		}
+	}
+}
@@ -0,0 +1,73 @@
+// Copyright 2016 Danko Miocevic. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Author: Danko Miocevic
+
+package main
+
+import (
+	"github.com/dankomiocevic/mulifs/api"
+	"os"
+
+	"bazil.org/fuse"
+	"github.com/golang/glog"
+)
+
+// startAPI serves the management API on the Unix socket
+// set in the api option, the changes made through it are
+// audited as made by the user running MuLi.
+func startAPI(mPoint string) {
+	if len(config_params.api) < 1 {
+		return
+	}
+
+	library := newLibrary(mPoint)
+	go func() {
+		err := api.Serve(config_params.api, library)
+		if err != nil {
+			glog.Errorf("Cannot serve the management API: %s\n", err)
+		}
+	}()
+}
+
+// startWeb serves the web interface on the address set
+// in the web option, like the management API the changes
+// are audited as made by the user running MuLi.
+func startWeb(mPoint string) {
+	if len(config_params.web) < 1 {
+		return
+	}
+
+	library := newLibrary(mPoint)
+	go func() {
+		err := api.ServeWeb(config_params.web, config_params.web_auth, config_params.web_hosts, library)
+		if err != nil {
+			glog.Errorf("Cannot serve the web interface: %s\n", err)
+		}
+	}()
+}
+
+// newLibrary returns the Library served by
+// the management API and the web interface.
+func newLibrary(mPoint string) *api.Library {
+	return &api.Library{
+		Root: mPoint,
+		Changed: func(op string, paths ...string) {
+			audit(fuse.Header{Uid: uint32(os.Getuid())}, op, nil, paths...)
+		},
+		Status:  statusContent,
+		Targets: castTargets,
+		CastURL: castURL(),
+	}
+}
@@ -0,0 +1,163 @@
+// Copyright 2016 Danko Miocevic. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Author: Danko Miocevic
+
+package main
+
+import (
+	"fmt"
+	"github.com/dankomiocevic/mulifs/store"
+	"path/filepath"
+	"strings"
+
+	"bazil.org/fuse"
+	"bazil.org/fuse/fs"
+	"golang.org/x/net/context"
+)
+
+// mediaViewDir is the view with the Library organized
+// following the conventions of Plex and Jellyfin.
+const mediaViewDir = "media"
+
+// registerMediaView adds the media view to the
+// root Directory when it is enabled.
+func registerMediaView() {
+	if config_params.media_view {
+		views[mediaViewDir] = view{list: listMediaView, lookup: lookupMediaView}
+	}
+}
+
+// mediaName replaces the characters that cannot be used
+// in the names of the media view, the real names of the
+// Artists, Albums and Songs are used with their spaces.
+func mediaName(name string) string {
+	name = strings.TrimSpace(strings.Replace(name, "/", "_", -1))
+	if len(name) < 1 {
+		return "unknown"
+	}
+	if name[0] == '.' {
+		name = "_" + name[1:]
+	}
+	return name
+}
+
+// mediaLevel returns the Artist, the Album and the Song
+// names of a Song in the media view:
+//
+//	Artist Name/Album Name (Year)/01 - Title.mp3
+func mediaLevel(s store.SongNames) []string {
+	album := mediaName(s.AlbumName)
+	if year := s.Year; len(year) >= 4 {
+		album = fmt.Sprintf("%s (%s)", album, year[:4])
+	}
+
+	song := mediaName(s.Title) + filepath.Ext(s.Song)
+	if track := trackNumber(strings.Split(s.Track, "/")[0]); track > 0 {
+		song = fmt.Sprintf("%02d - %s", track, song)
+	}
+	return []string{mediaName(s.ArtistName), album, song}
+}
+
+// mediaSongs returns the Songs inside the Directory of the
+// media view with their names, the Directories inside the
+// view are stored in the album separated by slashes.
+func mediaSongs(d *Dir) ([]store.SongNames, [][]string, []string, error) {
+	songs, err := store.ListSongNames()
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	var path []string
+	if len(d.album) > 0 {
+		path = strings.Split(d.album, "/")
+	}
+
+	var a []store.SongNames
+	var levels [][]string
+	for _, s := range songs {
+		level := mediaLevel(s)
+		match := true
+		for i := range path {
+			if path[i] != level[i] {
+				match = false
+				break
+			}
+		}
+		if match {
+			a = append(a, s)
+			levels = append(levels, level)
+		}
+	}
+	return a, levels, path, nil
+}
+
+// listMediaView lists the Artists, their Albums
+// or the Songs of an Album.
+func listMediaView(ctx context.Context, d *Dir) ([]fuse.Dirent, error) {
+	songs, levels, path, err := mediaSongs(d)
+	if err != nil {
+		return nil, fuse.EIO
+	}
+
+	var a []fuse.Dirent
+	seen := make(map[string]bool)
+	for i := range songs {
+		if ctx.Err() != nil {
+			return nil, fuse.EINTR
+		}
+
+		if len(path) > 2 {
+			break
+		}
+
+		name := levels[i][len(path)]
+		if seen[name] {
+			continue
+		}
+		seen[name] = true
+
+		if len(path) > 1 {
+			a = append(a, fuse.Dirent{Name: name, Type: fuse.DT_File})
+		} else {
+			a = append(a, fuse.Dirent{Name: name, Type: fuse.DT_Dir})
+		}
+	}
+	return a, nil
+}
+
+// lookupMediaView returns the Directories
+// and the Songs in the media view.
+func lookupMediaView(ctx context.Context, d *Dir, name string) (fs.Node, error) {
+	songs, levels, path, err := mediaSongs(d)
+	if err != nil {
+		return nil, fuse.EIO
+	}
+
+	if len(path) > 2 {
+		return nil, fuse.ENOENT
+	}
+
+	for i, s := range songs {
+		if levels[i][len(path)] != name {
+			continue
+		}
+
+		if len(path) > 1 {
+			return songFile(d, s.Artist, s.Album, s.Song)
+		}
+		return &Dir{fs: d.fs, artist: d.artist, album: strings.Join(append(path, name), "/"), mPoint: d.mPoint}, nil
+	}
+	return nil, fuse.ENOENT
+}
@@ -0,0 +1,173 @@
+// Copyright 2016 Danko Miocevic. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Author: Danko Miocevic
+
+package metadata
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"golang.org/x/net/context"
+)
+
+// ReleaseIdentifier finds the Album that
+// contains a Song by the Artist and title.
+type ReleaseIdentifier interface {
+	Release(ctx context.Context, artist, title string) (string, error)
+}
+
+// Discogs obtains the information from the Discogs
+// API, it requires a personal access token.
+type Discogs struct {
+	Token string
+}
+
+// discogsURL is the base URL of the Discogs API.
+const discogsURL = "https://api.discogs.com/"
+
+// discogsResult is a result of the Discogs search.
+type discogsResult struct {
+	ID    int    `json:"id"`
+	Title string `json:"title"`
+}
+
+// get requests a path of the Discogs API
+// authenticated with the token.
+func (d Discogs) get(ctx context.Context, path string, query url.Values, v interface{}) error {
+	header := http.Header{}
+	header.Set("Authorization", "Discogs token="+d.Token)
+	u := discogsURL + path
+	if query != nil {
+		u = u + "?" + query.Encode()
+	}
+	return getJSON(ctx, u, header, v)
+}
+
+// search returns the first result of the Discogs search.
+func (d Discogs) search(ctx context.Context, query url.Values) (discogsResult, error) {
+	var result struct {
+		Results []discogsResult `json:"results"`
+	}
+
+	query.Set("per_page", "1")
+	err := d.get(ctx, "database/search", query, &result)
+	if err != nil {
+		return discogsResult{}, err
+	}
+
+	if len(result.Results) < 1 {
+		return discogsResult{}, errors.New("Not found in Discogs.")
+	}
+	return result.Results[0], nil
+}
+
+// Artist returns the profile of the best match
+// for the Artist name in Discogs.
+func (d Discogs) Artist(ctx context.Context, artist string) (ArtistInfo, error) {
+	query := url.Values{}
+	query.Set("type", "artist")
+	query.Set("q", artist)
+	found, err := d.search(ctx, query)
+	if err != nil {
+		return ArtistInfo{}, err
+	}
+
+	var result struct {
+		Profile string `json:"profile"`
+	}
+	err = d.get(ctx, "artists/"+strconv.Itoa(found.ID), nil, &result)
+	if err != nil {
+		return ArtistInfo{}, err
+	}
+	return ArtistInfo{Bio: result.Profile}, nil
+}
+
+// Album returns the release information and the
+// credits of the best match for the Album and Artist
+// names in Discogs.
+func (d Discogs) Album(ctx context.Context, artist, album string) (AlbumInfo, error) {
+	query := url.Values{}
+	query.Set("type", "release")
+	query.Set("artist", artist)
+	query.Set("release_title", album)
+	found, err := d.search(ctx, query)
+	if err != nil {
+		return AlbumInfo{}, err
+	}
+
+	var result struct {
+		Released string `json:"released"`
+		Country  string `json:"country"`
+		Labels   []struct {
+			Name  string `json:"name"`
+			Catno string `json:"catno"`
+		} `json:"labels"`
+		Identifiers []struct {
+			Type  string `json:"type"`
+			Value string `json:"value"`
+		} `json:"identifiers"`
+		ExtraArtists []struct {
+			Name string `json:"name"`
+			Role string `json:"role"`
+		} `json:"extraartists"`
+	}
+	err = d.get(ctx, "releases/"+strconv.Itoa(found.ID), nil, &result)
+	if err != nil {
+		return AlbumInfo{}, err
+	}
+
+	info := AlbumInfo{ReleaseDate: result.Released, Country: result.Country}
+	if len(result.Labels) > 0 {
+		info.Label = result.Labels[0].Name
+		info.CatalogNumber = result.Labels[0].Catno
+	}
+
+	for _, i := range result.Identifiers {
+		if i.Type == "Barcode" {
+			info.Barcode = i.Value
+			break
+		}
+	}
+
+	for _, a := range result.ExtraArtists {
+		info.Credits = append(info.Credits, a.Role+": "+a.Name)
+	}
+	return info, nil
+}
+
+// Release returns the name of the Album that contains
+// the best match for the Song in Discogs.
+func (d Discogs) Release(ctx context.Context, artist, title string) (string, error) {
+	query := url.Values{}
+	query.Set("type", "release")
+	query.Set("artist", artist)
+	query.Set("track", title)
+	found, err := d.search(ctx, query)
+	if err != nil {
+		return "", err
+	}
+
+	// The titles of the results are "Artist - Album".
+	items := strings.SplitN(found.Title, " - ", 2)
+	album := items[len(items)-1]
+	if len(album) < 1 {
+		return "", errors.New("Not found in Discogs.")
+	}
+	return album, nil
+}
@@ -0,0 +1,252 @@
+// Copyright 2016 Danko Miocevic. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Author: Danko Miocevic
+
+package metadata
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+// LastFM obtains the information from the
+// Last.fm API, it requires an API key.
+// The Secret and the Session key of the user
+// are only needed to send the scrobbles.
+type LastFM struct {
+	Key     string
+	Secret  string
+	Session string
+}
+
+// GenreClassifier finds the genre of a
+// Song by the Artist and title.
+type GenreClassifier interface {
+	Genre(ctx context.Context, artist, title string) (string, error)
+}
+
+// Scrobble is a Song listened at some time.
+type Scrobble struct {
+	Artist   string
+	Album    string
+	Track    string
+	Duration int
+	Time     time.Time
+}
+
+// scrobbleBatch is the maximum amount of
+// scrobbles sent in every request.
+const scrobbleBatch = 50
+
+// lastFMURL is the base URL of the Last.fm API.
+const lastFMURL = "https://ws.audioscrobbler.com/2.0/"
+
+// SimilarArtists returns the names of the Artists
+// similar to the specified one according to Last.fm.
+func (l LastFM) SimilarArtists(ctx context.Context, artist string) ([]string, error) {
+	var result struct {
+		SimilarArtists struct {
+			Artist []struct {
+				Name string `json:"name"`
+			} `json:"artist"`
+		} `json:"similarartists"`
+	}
+
+	query := url.Values{}
+	query.Set("method", "artist.getsimilar")
+	query.Set("artist", artist)
+	query.Set("api_key", l.Key)
+	query.Set("autocorrect", "1")
+	query.Set("limit", "250")
+	query.Set("format", "json")
+	err := getJSON(ctx, lastFMURL+"?"+query.Encode(), nil, &result)
+	if err != nil {
+		return nil, err
+	}
+
+	var names []string
+	for _, a := range result.SimilarArtists.Artist {
+		names = append(names, a.Name)
+	}
+	return names, nil
+}
+
+// topTag returns the most used tag of a track, or of
+// the Artist when the title is empty, ignoring the
+// tags that are the name of the Artist.
+func (l LastFM) topTag(ctx context.Context, artist, title string) (string, error) {
+	var result struct {
+		TopTags struct {
+			Tag []struct {
+				Name  string `json:"name"`
+				Count int    `json:"count"`
+			} `json:"tag"`
+		} `json:"toptags"`
+	}
+
+	query := url.Values{}
+	query.Set("method", "artist.gettoptags")
+	query.Set("artist", artist)
+	if len(title) > 0 {
+		query.Set("method", "track.gettoptags")
+		query.Set("track", title)
+	}
+	query.Set("api_key", l.Key)
+	query.Set("autocorrect", "1")
+	query.Set("format", "json")
+	err := getJSON(ctx, lastFMURL+"?"+query.Encode(), nil, &result)
+	if err != nil {
+		return "", err
+	}
+
+	for _, t := range result.TopTags.Tag {
+		name := strings.TrimSpace(t.Name)
+		if t.Count > 0 && len(name) > 0 && !strings.EqualFold(name, artist) {
+			return strings.Title(strings.ToLower(name)), nil
+		}
+	}
+	return "", nil
+}
+
+// Genre returns the most used tag of the track in
+// Last.fm as its genre, or the one of the Artist
+// when the track has no tags.
+func (l LastFM) Genre(ctx context.Context, artist, title string) (string, error) {
+	genre, err := l.topTag(ctx, artist, title)
+	if err != nil || len(genre) > 0 {
+		return genre, err
+	}
+
+	genre, err = l.topTag(ctx, artist, "")
+	if err == nil && len(genre) < 1 {
+		err = errors.New("Genre not found.")
+	}
+	return genre, err
+}
+
+// sign adds the signature of the parameters
+// required by the write methods of the API.
+func (l LastFM) sign(params url.Values) {
+	keys := make([]string, 0, len(params))
+	for k := range params {
+		if k != "format" {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+
+	var sig strings.Builder
+	for _, k := range keys {
+		sig.WriteString(k)
+		sig.WriteString(params.Get(k))
+	}
+	sig.WriteString(l.Secret)
+	sum := md5.Sum([]byte(sig.String()))
+	params.Set("api_sig", hex.EncodeToString(sum[:]))
+}
+
+// post sends a signed request to the API.
+func (l LastFM) post(ctx context.Context, params url.Values, v interface{}) error {
+	params.Set("api_key", l.Key)
+	params.Set("sk", l.Session)
+	l.sign(params)
+	params.Set("format", "json")
+
+	req, err := http.NewRequest("POST", lastFMURL, strings.NewReader(params.Encode()))
+	if err != nil {
+		return err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("User-Agent", userAgent)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	var result struct {
+		Error   int    `json:"error"`
+		Message string `json:"message"`
+	}
+	body := json.NewDecoder(resp.Body)
+	var raw json.RawMessage
+	if err := body.Decode(&raw); err != nil {
+		return errors.New("Wrong response from Last.fm: " + resp.Status)
+	}
+	if err := json.Unmarshal(raw, &result); err == nil && result.Error != 0 {
+		return errors.New("Last.fm error: " + result.Message)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return errors.New("Wrong response from Last.fm: " + resp.Status)
+	}
+	return json.Unmarshal(raw, v)
+}
+
+// Scrobble sends the Songs listened to the profile
+// of the user, they are sent in batches of 50.
+// It returns the number of scrobbles accepted.
+func (l LastFM) Scrobble(ctx context.Context, scrobbles []Scrobble) (int, error) {
+	if len(l.Secret) < 1 || len(l.Session) < 1 {
+		return 0, errors.New("The Last.fm secret and session key are required.")
+	}
+
+	accepted := 0
+	for start := 0; start < len(scrobbles); start += scrobbleBatch {
+		end := start + scrobbleBatch
+		if end > len(scrobbles) {
+			end = len(scrobbles)
+		}
+
+		params := url.Values{}
+		params.Set("method", "track.scrobble")
+		for i, s := range scrobbles[start:end] {
+			n := "[" + strconv.Itoa(i) + "]"
+			params.Set("artist"+n, s.Artist)
+			params.Set("track"+n, s.Track)
+			params.Set("timestamp"+n, strconv.FormatInt(s.Time.Unix(), 10))
+			if len(s.Album) > 0 {
+				params.Set("album"+n, s.Album)
+			}
+			if s.Duration > 0 {
+				params.Set("duration"+n, strconv.Itoa(s.Duration))
+			}
+		}
+
+		var result struct {
+			Scrobbles struct {
+				Attr struct {
+					Accepted int `json:"accepted"`
+				} `json:"@attr"`
+			} `json:"scrobbles"`
+		}
+		if err := l.post(ctx, params, &result); err != nil {
+			return accepted, err
+		}
+		accepted += result.Scrobbles.Attr.Accepted
+	}
+	return accepted, nil
+}
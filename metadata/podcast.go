@@ -0,0 +1,170 @@
+// Copyright 2016 Danko Miocevic. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Author: Danko Miocevic
+
+package metadata
+
+import (
+	"encoding/xml"
+	"errors"
+	"io"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+// Episode is an episode of a podcast
+// found in its RSS feed.
+type Episode struct {
+	GUID      string
+	Title     string
+	URL       string
+	Published time.Time
+}
+
+// Podcast is a podcast read from its RSS feed,
+// the episodes are sorted from the newest.
+type Podcast struct {
+	Title    string
+	Episodes []Episode
+}
+
+// downloadClient is the HTTP client used to download the
+// episodes, the requests are stopped by their context.
+var downloadClient = &http.Client{}
+
+// pubDateFormats are the date formats found
+// in the pubDate of the RSS feeds.
+var pubDateFormats = []string{time.RFC1123Z, time.RFC1123, "Mon, 2 Jan 2006 15:04:05 -0700", "Mon, 2 Jan 2006 15:04:05 MST"}
+
+// ParsePodcast reads a podcast from an RSS feed.
+func ParsePodcast(r io.Reader) (*Podcast, error) {
+	var rss struct {
+		Channel struct {
+			Title string `xml:"title"`
+			Items []struct {
+				Title     string `xml:"title"`
+				GUID      string `xml:"guid"`
+				PubDate   string `xml:"pubDate"`
+				Enclosure struct {
+					URL string `xml:"url,attr"`
+				} `xml:"enclosure"`
+			} `xml:"item"`
+		} `xml:"channel"`
+	}
+
+	err := xml.NewDecoder(r).Decode(&rss)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(rss.Channel.Title) < 1 {
+		return nil, errors.New("Not a podcast feed.")
+	}
+
+	podcast := &Podcast{Title: strings.TrimSpace(rss.Channel.Title)}
+	for _, item := range rss.Channel.Items {
+		if len(item.Enclosure.URL) < 1 {
+			continue
+		}
+
+		episode := Episode{
+			GUID:  strings.TrimSpace(item.GUID),
+			Title: strings.TrimSpace(item.Title),
+			URL:   strings.TrimSpace(item.Enclosure.URL),
+		}
+		if len(episode.GUID) < 1 {
+			episode.GUID = episode.URL
+		}
+
+		for _, format := range pubDateFormats {
+			t, err := time.Parse(format, strings.TrimSpace(item.PubDate))
+			if err == nil {
+				episode.Published = t
+				break
+			}
+		}
+		podcast.Episodes = append(podcast.Episodes, episode)
+	}
+
+	sort.SliceStable(podcast.Episodes, func(i, j int) bool {
+		return podcast.Episodes[i].Published.After(podcast.Episodes[j].Published)
+	})
+	return podcast, nil
+}
+
+// FetchPodcast requests and reads the RSS feed of a podcast.
+func FetchPodcast(ctx context.Context, u string) (*Podcast, error) {
+	req, err := http.NewRequest("GET", u, nil)
+	if err != nil {
+		return nil, err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("User-Agent", userAgent)
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, errors.New("Wrong response from the feed: " + resp.Status)
+	}
+	return ParsePodcast(resp.Body)
+}
+
+// DownloadEpisode downloads an episode to the path, the file
+// is written with a temporary name until it is complete.
+func DownloadEpisode(ctx context.Context, episode Episode, path string) error {
+	req, err := http.NewRequest("GET", episode.URL, nil)
+	if err != nil {
+		return err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("User-Agent", userAgent)
+
+	resp, err := downloadClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return errors.New("Wrong response downloading the episode: " + resp.Status)
+	}
+
+	tmp := path + ".part"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+
+	_, err = io.Copy(f, resp.Body)
+	if err == nil {
+		err = f.Close()
+	} else {
+		f.Close()
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return os.Rename(tmp, path)
+}
@@ -0,0 +1,282 @@
+// Copyright 2016 Danko Miocevic. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Author: Danko Miocevic
+
+// Package metadata obtains information about Artists
+// and Albums from online providers to complete the
+// description files.
+package metadata
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+// ArtistInfo is the information obtained for an Artist.
+type ArtistInfo struct {
+	Bio     string
+	Country string
+	Formed  string
+	Type    string
+}
+
+// AlbumInfo is the information obtained for an Album.
+type AlbumInfo struct {
+	ReleaseDate   string
+	Country       string
+	Label         string
+	CatalogNumber string
+	Barcode       string
+	Credits       []string
+}
+
+// Provider obtains the information of Artists and
+// Albums by name from an online service.
+type Provider interface {
+	Artist(ctx context.Context, artist string) (ArtistInfo, error)
+	Album(ctx context.Context, artist, album string) (AlbumInfo, error)
+}
+
+// IDProvider is implemented by the providers that obtain
+// the information of the Artists and Albums by their
+// MusicBrainz identifiers, they are used instead of the
+// names when the identifiers are known.
+type IDProvider interface {
+	ArtistByID(ctx context.Context, id string) (ArtistInfo, error)
+	AlbumByID(ctx context.Context, id string) (AlbumInfo, error)
+}
+
+// userAgent identifies MuLi on the online services.
+const userAgent = "MuLi/1.0 ( https://github.com/dankomiocevic/mulifs )"
+
+// client is the HTTP client used by the providers.
+var client = &http.Client{Timeout: 10 * time.Second}
+
+// getJSON requests the URL and decodes the JSON response.
+func getJSON(ctx context.Context, u string, header http.Header, v interface{}) error {
+	req, err := http.NewRequest("GET", u, nil)
+	if err != nil {
+		return err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("User-Agent", userAgent)
+	for k, values := range header {
+		for _, value := range values {
+			req.Header.Add(k, value)
+		}
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return errors.New("Wrong response from the provider: " + resp.Status)
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+// MusicBrainz obtains the information from the
+// MusicBrainz web service.
+type MusicBrainz struct{}
+
+// musicBrainzURL is the base URL of the MusicBrainz web service.
+const musicBrainzURL = "https://musicbrainz.org/ws/2/"
+
+// Artist returns the information of the best
+// match for the Artist name in MusicBrainz.
+func (m MusicBrainz) Artist(ctx context.Context, artist string) (ArtistInfo, error) {
+	var result struct {
+		Artists []musicBrainzArtist `json:"artists"`
+	}
+
+	query := url.Values{}
+	query.Set("query", "artist:\""+artist+"\"")
+	query.Set("limit", "1")
+	query.Set("fmt", "json")
+	err := getJSON(ctx, musicBrainzURL+"artist/?"+query.Encode(), nil, &result)
+	if err != nil {
+		return ArtistInfo{}, err
+	}
+
+	if len(result.Artists) < 1 {
+		return ArtistInfo{}, errors.New("Artist not found.")
+	}
+	return result.Artists[0].info(), nil
+}
+
+// musicBrainzArtist is an Artist in the
+// responses of the MusicBrainz web service.
+type musicBrainzArtist struct {
+	Type           string `json:"type"`
+	Country        string `json:"country"`
+	Disambiguation string `json:"disambiguation"`
+	LifeSpan       struct {
+		Begin string `json:"begin"`
+	} `json:"life-span"`
+}
+
+// info returns the information of the Artist.
+func (a musicBrainzArtist) info() ArtistInfo {
+	return ArtistInfo{Bio: a.Disambiguation, Country: a.Country, Formed: a.LifeSpan.Begin, Type: a.Type}
+}
+
+// ArtistByID returns the information of the
+// Artist with the MusicBrainz identifier.
+func (m MusicBrainz) ArtistByID(ctx context.Context, id string) (ArtistInfo, error) {
+	var a musicBrainzArtist
+	err := getJSON(ctx, musicBrainzURL+"artist/"+url.PathEscape(id)+"?fmt=json", nil, &a)
+	if err != nil {
+		return ArtistInfo{}, err
+	}
+	return a.info(), nil
+}
+
+// musicBrainzRelease is a release in the
+// responses of the MusicBrainz web service.
+type musicBrainzRelease struct {
+	Date      string `json:"date"`
+	Country   string `json:"country"`
+	Barcode   string `json:"barcode"`
+	LabelInfo []struct {
+		CatalogNumber string `json:"catalog-number"`
+		Label         struct {
+			Name string `json:"name"`
+		} `json:"label"`
+	} `json:"label-info"`
+}
+
+// info returns the information of the release.
+func (r musicBrainzRelease) info() AlbumInfo {
+	info := AlbumInfo{ReleaseDate: r.Date, Country: r.Country, Barcode: r.Barcode}
+	if len(r.LabelInfo) > 0 {
+		info.Label = r.LabelInfo[0].Label.Name
+		info.CatalogNumber = r.LabelInfo[0].CatalogNumber
+	}
+	return info
+}
+
+// AlbumByID returns the information of the release
+// with the MusicBrainz identifier.
+func (m MusicBrainz) AlbumByID(ctx context.Context, id string) (AlbumInfo, error) {
+	var r musicBrainzRelease
+	err := getJSON(ctx, musicBrainzURL+"release/"+url.PathEscape(id)+"?inc=labels&fmt=json", nil, &r)
+	if err != nil {
+		return AlbumInfo{}, err
+	}
+	return r.info(), nil
+}
+
+// ReleaseTrack is a track of a release, the Duration
+// is in seconds.
+type ReleaseTrack struct {
+	Disc        int
+	Position    int
+	Title       string
+	RecordingID string `json:",omitempty"`
+	Duration    int    `json:",omitempty"`
+}
+
+// ReleaseTracks returns the canonical track list of the
+// release with the MusicBrainz identifier, every disc
+// of the release in order.
+func ReleaseTracks(ctx context.Context, id string) ([]ReleaseTrack, error) {
+	var r struct {
+		Media []struct {
+			Position int `json:"position"`
+			Tracks   []struct {
+				Position  int    `json:"position"`
+				Title     string `json:"title"`
+				Length    int    `json:"length"`
+				Recording struct {
+					ID string `json:"id"`
+				} `json:"recording"`
+			} `json:"tracks"`
+		} `json:"media"`
+	}
+
+	err := getJSON(ctx, musicBrainzURL+"release/"+url.PathEscape(id)+"?inc=recordings&fmt=json", nil, &r)
+	if err != nil {
+		return nil, err
+	}
+
+	var tracks []ReleaseTrack
+	for _, m := range r.Media {
+		for _, t := range m.Tracks {
+			tracks = append(tracks, ReleaseTrack{Disc: m.Position, Position: t.Position, Title: t.Title,
+				RecordingID: t.Recording.ID, Duration: t.Length / 1000})
+		}
+	}
+
+	if len(tracks) < 1 {
+		return nil, errors.New("The release has no tracks.")
+	}
+	return tracks, nil
+}
+
+// coverArtURL is the base URL of the Cover Art Archive.
+const coverArtURL = "https://coverartarchive.org/release/"
+
+// CoverArt returns the front cover image of the release
+// with the MusicBrainz identifier from the Cover Art Archive.
+func CoverArt(ctx context.Context, id string) ([]byte, error) {
+	req, err := http.NewRequest("GET", coverArtURL+url.PathEscape(id)+"/front-500", nil)
+	if err != nil {
+		return nil, err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("User-Agent", userAgent)
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, errors.New("Wrong response from the Cover Art Archive: " + resp.Status)
+	}
+	return ioutil.ReadAll(resp.Body)
+}
+
+// Album returns the information of the best match
+// for the Album and Artist names in MusicBrainz.
+func (m MusicBrainz) Album(ctx context.Context, artist, album string) (AlbumInfo, error) {
+	var result struct {
+		Releases []musicBrainzRelease `json:"releases"`
+	}
+
+	query := url.Values{}
+	query.Set("query", "release:\""+album+"\" AND artist:\""+artist+"\"")
+	query.Set("limit", "1")
+	query.Set("fmt", "json")
+	err := getJSON(ctx, musicBrainzURL+"release/?"+query.Encode(), nil, &result)
+	if err != nil {
+		return AlbumInfo{}, err
+	}
+
+	if len(result.Releases) < 1 {
+		return AlbumInfo{}, errors.New("Album not found.")
+	}
+	return result.Releases[0].info(), nil
+}
@@ -0,0 +1,210 @@
+// Copyright 2016 Danko Miocevic. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Author: Danko Miocevic
+
+package metadata
+
+import (
+	"errors"
+	"sort"
+	"sync"
+
+	"golang.org/x/net/context"
+)
+
+// Settings are the settings of the providers
+// configured by the user, like the tokens of
+// the services, indexed by the option name.
+type Settings map[string]string
+
+// Factory creates a provider from the settings, it returns
+// an error if a required setting is missing. The providers
+// that also implement ReleaseIdentifier are used to
+// identify the dropped Songs.
+type Factory func(settings Settings) (Provider, error)
+
+// factories contains the registered providers
+// indexed by their name.
+var factories = struct {
+	sync.Mutex
+	m map[string]Factory
+}{m: make(map[string]Factory)}
+
+// Register makes a provider available by name, it is
+// called from the init function of the providers.
+// Registering the same name twice panics.
+func Register(name string, factory Factory) {
+	factories.Lock()
+	defer factories.Unlock()
+	if _, ok := factories.m[name]; ok {
+		panic("metadata: provider registered twice: " + name)
+	}
+	factories.m[name] = factory
+}
+
+// Names returns the names of the registered providers.
+func Names() []string {
+	factories.Lock()
+	defer factories.Unlock()
+	var names []string
+	for name := range factories.m {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func init() {
+	Register("musicbrainz", func(settings Settings) (Provider, error) {
+		return MusicBrainz{}, nil
+	})
+	Register("discogs", func(settings Settings) (Provider, error) {
+		token := settings["discogs_token"]
+		if len(token) < 1 {
+			return nil, errors.New("Discogs requires the discogs_token option.")
+		}
+		return Discogs{Token: token}, nil
+	})
+}
+
+// Chain asks the providers in order and falls back to the
+// next one when a provider fails or finds nothing.
+type Chain []Provider
+
+// NewChain creates the registered providers in order.
+func NewChain(names []string, settings Settings) (Chain, error) {
+	var chain Chain
+	for _, name := range names {
+		factories.Lock()
+		factory, ok := factories.m[name]
+		factories.Unlock()
+		if !ok {
+			return nil, errors.New("Unknown metadata provider: " + name)
+		}
+
+		provider, err := factory(settings)
+		if err != nil {
+			return nil, err
+		}
+		chain = append(chain, provider)
+	}
+	return chain, nil
+}
+
+// Artist returns the first information found
+// for the Artist in the providers.
+func (c Chain) Artist(ctx context.Context, artist string) (ArtistInfo, error) {
+	return c.ArtistWithID(ctx, "", artist)
+}
+
+// ArtistWithID returns the first information found for
+// the Artist in the providers, the IDProviders use the
+// MusicBrainz identifier instead of the name if it is known.
+func (c Chain) ArtistWithID(ctx context.Context, id, artist string) (ArtistInfo, error) {
+	err := errors.New("There are no metadata providers.")
+	for _, p := range c {
+		var info ArtistInfo
+		if ip, ok := p.(IDProvider); ok && len(id) > 0 {
+			info, err = ip.ArtistByID(ctx, id)
+		} else {
+			info, err = p.Artist(ctx, artist)
+		}
+		if err == nil && info != (ArtistInfo{}) {
+			return info, nil
+		}
+		if ctx.Err() != nil {
+			return info, ctx.Err()
+		}
+	}
+	if err == nil {
+		err = errors.New("Artist not found.")
+	}
+	return ArtistInfo{}, err
+}
+
+// emptyAlbum returns true if the provider found
+// nothing for the Album.
+func emptyAlbum(info AlbumInfo) bool {
+	return len(info.ReleaseDate) < 1 && len(info.Country) < 1 && len(info.Label) < 1 &&
+		len(info.CatalogNumber) < 1 && len(info.Barcode) < 1 && len(info.Credits) < 1
+}
+
+// Album returns the first information found
+// for the Album in the providers.
+func (c Chain) Album(ctx context.Context, artist, album string) (AlbumInfo, error) {
+	return c.AlbumWithID(ctx, "", artist, album)
+}
+
+// AlbumWithID returns the first information found for
+// the Album in the providers, the IDProviders use the
+// MusicBrainz identifier instead of the names if it is known.
+func (c Chain) AlbumWithID(ctx context.Context, id, artist, album string) (AlbumInfo, error) {
+	err := errors.New("There are no metadata providers.")
+	for _, p := range c {
+		var info AlbumInfo
+		if ip, ok := p.(IDProvider); ok && len(id) > 0 {
+			info, err = ip.AlbumByID(ctx, id)
+		} else {
+			info, err = p.Album(ctx, artist, album)
+		}
+		if err == nil && !emptyAlbum(info) {
+			return info, nil
+		}
+		if ctx.Err() != nil {
+			return info, ctx.Err()
+		}
+	}
+	if err == nil {
+		err = errors.New("Album not found.")
+	}
+	return AlbumInfo{}, err
+}
+
+// Identifier returns the providers of the chain that
+// identify the releases, or nil if there are none.
+func (c Chain) Identifier() ReleaseIdentifier {
+	var ids identifiers
+	for _, p := range c {
+		if id, ok := p.(ReleaseIdentifier); ok {
+			ids = append(ids, id)
+		}
+	}
+	if len(ids) < 1 {
+		return nil
+	}
+	return ids
+}
+
+// identifiers asks the ReleaseIdentifiers in order.
+type identifiers []ReleaseIdentifier
+
+// Release returns the first Album found for the Song.
+func (ids identifiers) Release(ctx context.Context, artist, title string) (string, error) {
+	var err error
+	for _, id := range ids {
+		var album string
+		album, err = id.Release(ctx, artist, title)
+		if err == nil && len(album) > 0 {
+			return album, nil
+		}
+		if ctx.Err() != nil {
+			return "", ctx.Err()
+		}
+	}
+	if err == nil {
+		err = errors.New("Release not found.")
+	}
+	return "", err
+}
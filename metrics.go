@@ -0,0 +1,86 @@
+// Copyright 2016 Danko Miocevic. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Author: Danko Miocevic
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/dankomiocevic/mulifs/store"
+	"runtime"
+	"sync/atomic"
+	"time"
+)
+
+// metricsFileName is the read only file in the .mulifs
+// Directory with the counters of the running MuLi.
+const metricsFileName = "metrics"
+
+// startTime is the time MuLi started.
+var startTime = time.Now()
+
+// openHandles is the number of open File handles.
+var openHandles int64
+
+// countHandle adds n to the open File handles.
+func countHandle(n int64) {
+	atomic.AddInt64(&openHandles, n)
+}
+
+// isMetricsFile returns true if the File is the metrics file.
+func (f *File) isMetricsFile() bool {
+	return f.artist == mulifsDirName && len(f.album) < 1 && f.name == metricsFileName
+}
+
+// metricsContent returns the current value of the
+// counters, one per line with the name and the value.
+func metricsContent() []byte {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "uptime_seconds %d\n", int64(time.Since(startTime).Seconds()))
+	fmt.Fprintf(&b, "open_handles %d\n", atomic.LoadInt64(&openHandles))
+	fmt.Fprintf(&b, "song_reads %d\n", atomic.LoadInt64(&songReads))
+	fmt.Fprintf(&b, "song_read_bytes %d\n", atomic.LoadInt64(&songReadBytes))
+	fmt.Fprintf(&b, "song_read_seconds %.3f\n", time.Duration(atomic.LoadInt64(&songReadNanos)).Seconds())
+	fmt.Fprintf(&b, "song_slow_reads %d\n", atomic.LoadInt64(&songSlowReads))
+
+	writeBuffers.Lock()
+	fmt.Fprintf(&b, "write_buffers %d\n", len(writeBuffers.m))
+	writeBuffers.Unlock()
+
+	descriptionEdits.Lock()
+	fmt.Fprintf(&b, "description_edits %d\n", len(descriptionEdits.m))
+	descriptionEdits.Unlock()
+
+	if size, err := store.DBSize(); err == nil {
+		fmt.Fprintf(&b, "db_size_bytes %d\n", size)
+	}
+
+	if completenessEnabled() {
+		if albums, missing, err := completenessCounts(); err == nil {
+			fmt.Fprintf(&b, "incomplete_albums %d\n", albums)
+			fmt.Fprintf(&b, "missing_tracks %d\n", missing)
+		}
+	}
+
+	var m runtime.MemStats
+	runtime.ReadMemStats(&m)
+	fmt.Fprintf(&b, "goroutines %d\n", runtime.NumGoroutine())
+	fmt.Fprintf(&b, "memory_alloc_bytes %d\n", m.Alloc)
+	fmt.Fprintf(&b, "memory_sys_bytes %d\n", m.Sys)
+	fmt.Fprintf(&b, "heap_objects %d\n", m.HeapObjects)
+	fmt.Fprintf(&b, "gc_runs %d\n", m.NumGC)
+	return b.Bytes()
+}
@@ -0,0 +1,76 @@
+// Copyright 2016 Danko Miocevic. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Author: Danko Miocevic
+
+package main
+
+import (
+	"github.com/dankomiocevic/mulifs/tools"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+)
+
+// mirrorDelay is the time waited after a change in the
+// Library before the mirror Directory is updated, so
+// a burst of changes updates it only once.
+const mirrorDelay = 5 * time.Second
+
+// mirrorTimer is the pending update of the mirror.
+var mirrorTimer struct {
+	sync.Mutex
+	t       *time.Timer
+	started bool
+}
+
+// updateMirror updates the links of the mirror Directory.
+func updateMirror() {
+	linked, err := tools.UpdateMirror(config_params.mirror_dir, config_params.mirror_template)
+	if err != nil {
+		glog.Errorf("Cannot update the mirror Directory: %s\n", err)
+		return
+	}
+	glog.Infof("%d links updated in the mirror Directory\n", linked)
+}
+
+// scheduleMirror updates the mirror Directory once
+// there are no changes in the Library for mirrorDelay.
+func scheduleMirror() {
+	mirrorTimer.Lock()
+	defer mirrorTimer.Unlock()
+
+	if !mirrorTimer.started {
+		return
+	}
+
+	if mirrorTimer.t != nil {
+		mirrorTimer.t.Stop()
+	}
+	mirrorTimer.t = time.AfterFunc(mirrorDelay, updateMirror)
+}
+
+// startMirror creates the mirror Directory when the mirror_dir
+// option is set, it is updated every time the Library changes.
+func startMirror() {
+	if len(config_params.mirror_dir) < 1 {
+		return
+	}
+
+	mirrorTimer.Lock()
+	mirrorTimer.started = true
+	mirrorTimer.Unlock()
+	go updateMirror()
+}
@@ -0,0 +1,134 @@
+// Copyright 2016 Danko Miocevic. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Author: Danko Miocevic
+
+package main
+
+import (
+	"encoding/json"
+	"github.com/dankomiocevic/mulifs/store"
+	"github.com/golang/glog"
+	"strings"
+	"time"
+
+	"bazil.org/fuse"
+	"bazil.org/fuse/fs"
+	"golang.org/x/net/context"
+)
+
+// missingDirName is the view with the tombstones
+// of the Songs whose files are missing.
+const missingDirName = "missing"
+
+// missingExt is the extension of the read only
+// files of the tombstones in the missing view.
+const missingExt = ".json"
+
+// missingMetadata is the content of the file of a
+// tombstone, the metadata of the Song and the time
+// when its file was found missing.
+type missingMetadata struct {
+	songMetadata
+	Missing time.Time `json:"missing"`
+}
+
+// registerMissingView adds the missing view to the
+// root Directory when the tombstones are kept.
+func registerMissingView() {
+	if config_params.tombstones {
+		views[missingDirName] = view{list: listMissingView, lookup: lookupMissingView}
+	}
+}
+
+// isMissingFile returns true if the File is
+// a tombstone inside the missing view.
+func (f *File) isMissingFile() bool {
+	return f.artist == missingDirName && len(f.album) < 1
+}
+
+// listMissingView lists the tombstones.
+func listMissingView(ctx context.Context, d *Dir) ([]fuse.Dirent, error) {
+	tombstones, err := store.ListTombstones()
+	if err != nil {
+		return nil, fuse.EIO
+	}
+
+	var a []fuse.Dirent
+	for _, t := range tombstones {
+		a = append(a, fuse.Dirent{Name: store.TombstoneName(t.SongRef) + missingExt, Type: fuse.DT_File})
+	}
+	return a, nil
+}
+
+// lookupMissingView returns the file of a tombstone.
+func lookupMissingView(ctx context.Context, d *Dir, name string) (fs.Node, error) {
+	if len(d.album) > 0 || !strings.HasSuffix(name, missingExt) {
+		return nil, fuse.ENOENT
+	}
+
+	if _, err := store.GetTombstone(strings.TrimSuffix(name, missingExt)); err != nil {
+		return nil, fuse.ENOENT
+	}
+	return &File{artist: d.artist, name: name, mPoint: d.mPoint}, nil
+}
+
+// missingContent returns the metadata of the
+// tombstone encoded as JSON.
+func missingContent(name string) []byte {
+	t, err := store.GetTombstone(strings.TrimSuffix(name, missingExt))
+	if err != nil {
+		return nil
+	}
+
+	s := t.Metadata
+	m := missingMetadata{Missing: t.Time}
+	m.songMetadata = songMetadata{Artist: t.Artist, Album: t.Album, Title: s.SongName, Track: s.Track,
+		Genre: s.Genre, Year: s.Year, Composer: s.Composer, Work: s.Work,
+		Conductor: s.Conductor, BPM: s.BPM, Key: s.Key, Duration: s.Duration,
+		Codec: s.Codec, Bitrate: s.Bitrate, Checksum: s.Checksum,
+		Path: s.SongFullPath, Playlists: s.Playlists, Rating: s.Rating,
+		MBID: s.MusicBrainzID, TrackArtist: s.TrackArtist}
+
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return nil
+	}
+	return append(data, '\n')
+}
+
+// purgeMissing removes the tombstone of a file
+// removed from the missing view.
+func purgeMissing(name string) error {
+	if !strings.HasSuffix(name, missingExt) {
+		return fuse.ENOENT
+	}
+	return store.PurgeTombstone(strings.TrimSuffix(name, missingExt))
+}
+
+// buryMissing keeps the tombstone of a Song whose
+// file is missing when the tombstones are enabled.
+func buryMissing(artist, album, song, mPoint string) {
+	if !config_params.tombstones || config_params.read_only {
+		return
+	}
+
+	err := store.BurySong(store.SongRef{Artist: artist, Album: album, Song: song}, mPoint)
+	if err != nil {
+		glog.Errorf("Cannot keep the tombstone of %s: %s\n", song, err)
+		return
+	}
+	forgetAttrs(artist, album)
+	scheduleAutoPlaylists(mPoint)
+}
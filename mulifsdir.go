@@ -0,0 +1,69 @@
+// Copyright 2016 Danko Miocevic. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Author: Danko Miocevic
+
+package main
+
+import (
+	"bazil.org/fuse"
+	"bazil.org/fuse/fs"
+	"golang.org/x/net/context"
+)
+
+// mulifsDirName is the Directory in the root of MuLi
+// with the read only files about MuLi itself.
+const mulifsDirName = ".mulifs"
+
+// registerMulifsView adds the .mulifs
+// Directory to the root Directory.
+func registerMulifsView() {
+	views[mulifsDirName] = view{list: listMulifsView, lookup: lookupMulifsView}
+}
+
+// listMulifsView lists the metrics, the control and
+// undo files, the errors file unless error_log_size is 0
+// and the audit log when the audit option is used.
+func listMulifsView(ctx context.Context, d *Dir) ([]fuse.Dirent, error) {
+	if len(d.album) > 0 {
+		return nil, fuse.ENOENT
+	}
+
+	a := []fuse.Dirent{
+		{Name: metricsFileName, Type: fuse.DT_File},
+		{Name: controlFileName, Type: fuse.DT_File},
+		{Name: undoFileName, Type: fuse.DT_File},
+	}
+	if config_params.error_log_size > 0 {
+		a = append(a, fuse.Dirent{Name: errorsFileName, Type: fuse.DT_File})
+	}
+	if config_params.audit {
+		a = append(a, fuse.Dirent{Name: auditFileName, Type: fuse.DT_File})
+	}
+	return a, nil
+}
+
+// lookupMulifsView returns the files
+// inside the .mulifs Directory.
+func lookupMulifsView(ctx context.Context, d *Dir, name string) (fs.Node, error) {
+	if len(d.album) > 0 {
+		return nil, fuse.ENOENT
+	}
+
+	if name == metricsFileName || name == controlFileName || name == undoFileName ||
+		(name == errorsFileName && config_params.error_log_size > 0) || (name == auditFileName && config_params.audit) {
+		return &File{artist: mulifsDirName, song: name, name: name, mPoint: d.mPoint}, nil
+	}
+	return nil, fuse.ENOENT
+}
@@ -0,0 +1,107 @@
+// Copyright 2016 Danko Miocevic. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Author: Danko Miocevic
+
+package musicmgr
+
+import (
+	"errors"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+)
+
+// albumArtistGrouping groups the Songs by their
+// album artist instead of by their Artist.
+var albumArtistGrouping bool
+
+// SetAlbumArtistGrouping defines if the Songs with an album
+// artist tag are grouped by it, so the Albums with a few
+// guest artists are kept in a single Artist Directory.
+func SetAlbumArtistGrouping(enabled bool) {
+	albumArtistGrouping = enabled
+}
+
+// groupedByAlbumArtist returns true if the
+// Songs are grouped by the album artist of the tags.
+func groupedByAlbumArtist(tags FileTags) bool {
+	return albumArtistGrouping && len(tags.AlbumArtist) > 0
+}
+
+// groupByAlbumArtist returns the tags with the album artist
+// as the Artist and the Artist as the TrackArtist, when the
+// Songs are grouped by their album artist.
+func groupByAlbumArtist(tags FileTags) FileTags {
+	if groupedByAlbumArtist(tags) && tags.AlbumArtist != tags.Artist {
+		tags.TrackArtist = tags.Artist
+		tags.Artist = tags.AlbumArtist
+	}
+	return tags
+}
+
+// SetAlbumArtist updates the album artist tag in the
+// music file, the tag writer is chosen based on the
+// file extension.
+func SetAlbumArtist(albumArtist string, songPath string) error {
+	err, tags := GetRawTags(songPath)
+	if err == nil && tags.AlbumArtist == albumArtist {
+		return nil
+	}
+
+	if useTagSidecar(songPath) {
+		return writeTagSidecar(songPath, map[string]string{"albumartist": albumArtist})
+	}
+
+	err = breakHardlink(songPath)
+	if err != nil {
+		return err
+	}
+
+	if command, ok := tagWriter(songPath); ok {
+		tags.AlbumArtist = albumArtist
+		return runTagWriter(command, tags, songPath)
+	}
+
+	switch strings.ToLower(filepath.Ext(songPath)) {
+	case ".wav":
+		return setChunkFrame(wavFormat, "TPE2", albumArtist, songPath)
+	case ".aif", ".aiff":
+		return setChunkFrame(aiffFormat, "TPE2", albumArtist, songPath)
+	case ".mp3":
+		return SetMp3AlbumArtist(albumArtist, songPath)
+	case ".wma":
+		return errors.New("WMA files are read only.")
+	case ".flac":
+		return errors.New("FLAC files are read only.")
+	}
+	return errors.New("Wrong file format.")
+}
+
+// SetMp3AlbumArtist updates the album artist
+// tag (TPE2) in the song MP3 file.
+func SetMp3AlbumArtist(albumArtist string, songPath string) error {
+	data, err := ioutil.ReadFile(songPath)
+	if err != nil {
+		return err
+	}
+
+	header, _ := gaplessHeader(data)
+	if header != nil {
+		return setGaplessMp3Tags(songPath, data, func(path string) error {
+			return writeMp3Frame("TPE2", albumArtist, path)
+		})
+	}
+	return writeMp3Frame("TPE2", albumArtist, songPath)
+}
@@ -0,0 +1,205 @@
+// Copyright 2016 Danko Miocevic. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Author: Danko Miocevic
+
+// Package musicmgr controls the tags in the music files.
+// The tools include tools to read the different Tags in the
+// music files.
+package musicmgr
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"unicode/utf16"
+)
+
+// ASF object GUIDs as they are stored in the file.
+var (
+	asfHeaderGUID = []byte{0x30, 0x26, 0xb2, 0x75, 0x8e, 0x66, 0xcf, 0x11,
+		0xa6, 0xd9, 0x00, 0xaa, 0x00, 0x62, 0xce, 0x6c}
+	asfContentDescriptionGUID = []byte{0x33, 0x26, 0xb2, 0x75, 0x8e, 0x66, 0xcf, 0x11,
+		0xa6, 0xd9, 0x00, 0xaa, 0x00, 0x62, 0xce, 0x6c}
+	asfExtendedContentGUID = []byte{0x40, 0xa4, 0xd0, 0xd2, 0x07, 0xe3, 0xd2, 0x11,
+		0x97, 0xf0, 0x00, 0xa0, 0xc9, 0x5e, 0xa8, 0x50}
+	asfFilePropertiesGUID = []byte{0xa1, 0xdc, 0xab, 0x8c, 0x47, 0xa9, 0xcf, 0x11,
+		0x8e, 0xe4, 0x00, 0xc0, 0x0c, 0x20, 0x53, 0x65}
+)
+
+// maxAsfHeaderSize limits the memory used to
+// read the ASF header object.
+const maxAsfHeaderSize = 16 * 1024 * 1024
+
+// asfString decodes an UTF-16LE null terminated string.
+func asfString(b []byte) string {
+	units := make([]uint16, len(b)/2)
+	for i := range units {
+		units[i] = binary.LittleEndian.Uint16(b[2*i:])
+	}
+	for len(units) > 0 && units[len(units)-1] == 0 {
+		units = units[:len(units)-1]
+	}
+	return string(utf16.Decode(units))
+}
+
+// readAsfObjects calls fn with the GUID and the
+// data of every object in the header of an ASF file.
+func readAsfObjects(path string, fn func(guid, obj []byte)) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	header := make([]byte, 30)
+	if _, err := io.ReadFull(f, header); err != nil {
+		return err
+	}
+
+	if !bytes.Equal(header[:16], asfHeaderGUID) {
+		return errors.New("Wrong file format.")
+	}
+
+	size := binary.LittleEndian.Uint64(header[16:24])
+	if size < 30 || size > maxAsfHeaderSize {
+		return errors.New("Wrong ASF header size.")
+	}
+
+	data := make([]byte, size-30)
+	if _, err := io.ReadFull(f, data); err != nil {
+		return err
+	}
+
+	for pos := 0; pos+24 <= len(data); {
+		guid := data[pos : pos+16]
+		objSize := int(binary.LittleEndian.Uint64(data[pos+16 : pos+24]))
+		if objSize < 24 || pos+objSize > len(data) {
+			break
+		}
+		fn(guid, data[pos+24:pos+objSize])
+		pos += objSize
+	}
+	return nil
+}
+
+// readAsfHeader returns the tags stored in the Content
+// Description and the Extended Content Description objects
+// of an ASF (WMA) file.
+func readAsfHeader(path string) (map[string]string, error) {
+	tags := make(map[string]string)
+	err := readAsfObjects(path, func(guid, obj []byte) {
+		if bytes.Equal(guid, asfContentDescriptionGUID) && len(obj) >= 10 {
+			lengths := make([]int, 5)
+			for i := range lengths {
+				lengths[i] = int(binary.LittleEndian.Uint16(obj[2*i:]))
+			}
+			names := []string{"Title", "Author", "Copyright", "Description", "Rating"}
+			offset := 10
+			for i, l := range lengths {
+				if offset+l > len(obj) {
+					break
+				}
+				tags[names[i]] = asfString(obj[offset : offset+l])
+				offset += l
+			}
+		}
+
+		if bytes.Equal(guid, asfExtendedContentGUID) && len(obj) >= 2 {
+			count := int(binary.LittleEndian.Uint16(obj))
+			offset := 2
+			for i := 0; i < count && offset+2 <= len(obj); i++ {
+				nameLen := int(binary.LittleEndian.Uint16(obj[offset:]))
+				offset += 2
+				if offset+nameLen+4 > len(obj) {
+					break
+				}
+				name := asfString(obj[offset : offset+nameLen])
+				offset += nameLen
+				valueType := binary.LittleEndian.Uint16(obj[offset:])
+				valueLen := int(binary.LittleEndian.Uint16(obj[offset+2:]))
+				offset += 4
+				if offset+valueLen > len(obj) {
+					break
+				}
+				// Only the string values are used.
+				if valueType == 0 {
+					tags[name] = asfString(obj[offset : offset+valueLen])
+				}
+				offset += valueLen
+			}
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	return tags, nil
+}
+
+// asfBitrate returns the maximum bitrate in kbps
+// stored in the File Properties object of an ASF file.
+func asfBitrate(path string) (int, error) {
+	bitrate := 0
+	err := readAsfObjects(path, func(guid, obj []byte) {
+		if bytes.Equal(guid, asfFilePropertiesGUID) && len(obj) >= 80 {
+			bitrate = int(binary.LittleEndian.Uint32(obj[76:]) / 1000)
+		}
+	})
+	return bitrate, err
+}
+
+// GetAsfTags returns a FileTags struct with
+// all the information obtained from the tags in the
+// WMA file.
+// The WMA files are read only, the default values
+// for the missing tags are not stored on the file.
+func GetAsfTags(path string) (error, FileTags) {
+	_, file := filepath.Split(path)
+	extension := filepath.Ext(file)
+	defaultTitle := file[0 : len(file)-len(extension)]
+
+	tags, err := readAsfHeader(path)
+	if err != nil {
+		return err, FileTags{Title: defaultTitle, Artist: "unknown", Album: "unknown"}
+	}
+
+	title := tags["Title"]
+	if title == "" || title == "unknown" {
+		title = defaultTitle
+	}
+
+	artist := tags["Author"]
+	if artist == "" {
+		artist = tags["WM/AlbumArtist"]
+	}
+	if artist == "" {
+		artist = "unknown"
+	}
+
+	album := tags["WM/AlbumTitle"]
+	if album == "" {
+		album = "unknown"
+	}
+
+	return nil, FileTags{Title: title, Artist: artist, Album: album, Genre: normalizeGenre(tags["WM/Genre"]),
+		Year: tags["WM/Year"], Composer: tags["WM/Composer"], Work: tags["WM/ContentGroupDescription"],
+		Conductor: tags["WM/Conductor"], BPM: ParseBPM(tags["WM/BeatsPerMinute"]),
+		Key: ParseKey(tags["WM/InitialKey"]), Track: ParseTrack(tags["WM/TrackNumber"]),
+		AlbumArtist:      tags["WM/AlbumArtist"],
+		MusicBrainzTrack: tags["MusicBrainz/Track Id"], MusicBrainzAlbum: tags["MusicBrainz/Album Id"],
+		MusicBrainzArtist: firstID(tags["MusicBrainz/Artist Id"])}
+}
@@ -0,0 +1,125 @@
+// Copyright 2016 Danko Miocevic. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Author: Danko Miocevic
+
+package musicmgr
+
+import (
+	"encoding/binary"
+	"testing"
+	"unicode/utf16"
+)
+
+// asfText encodes an UTF-16LE null terminated string.
+func asfText(s string) []byte {
+	var b []byte
+	for _, u := range append(utf16.Encode([]rune(s)), 0) {
+		b = binary.LittleEndian.AppendUint16(b, u)
+	}
+	return b
+}
+
+// asfObject returns an ASF object with the GUID and the data.
+func asfObject(guid, data []byte) []byte {
+	obj := append([]byte{}, guid...)
+	obj = binary.LittleEndian.AppendUint64(obj, uint64(24+len(data)))
+	return append(obj, data...)
+}
+
+// testAsf returns the header of an ASF file with the title
+// and author and the extended content with the attributes.
+func testAsf(title, author string, attributes map[string]string) []byte {
+	t, a := asfText(title), asfText(author)
+	description := binary.LittleEndian.AppendUint16(nil, uint16(len(t)))
+	description = binary.LittleEndian.AppendUint16(description, uint16(len(a)))
+	description = append(description, 0, 0, 0, 0, 0, 0)
+	description = append(append(description, t...), a...)
+
+	extended := binary.LittleEndian.AppendUint16(nil, uint16(len(attributes)+1))
+	for name, value := range attributes {
+		n, v := asfText(name), asfText(value)
+		extended = binary.LittleEndian.AppendUint16(extended, uint16(len(n)))
+		extended = append(extended, n...)
+		extended = binary.LittleEndian.AppendUint16(extended, 0)
+		extended = binary.LittleEndian.AppendUint16(extended, uint16(len(v)))
+		extended = append(extended, v...)
+	}
+	// A DWORD value is not used.
+	n := asfText("WM/TrackNumber")
+	extended = binary.LittleEndian.AppendUint16(extended, uint16(len(n)))
+	extended = append(extended, n...)
+	extended = binary.LittleEndian.AppendUint16(extended, 3)
+	extended = binary.LittleEndian.AppendUint16(extended, 4)
+	extended = binary.LittleEndian.AppendUint32(extended, 7)
+
+	properties := make([]byte, 80)
+	binary.LittleEndian.PutUint32(properties[76:], 192000)
+
+	objects := append(asfObject(asfContentDescriptionGUID, description), asfObject(asfExtendedContentGUID, extended)...)
+	objects = append(objects, asfObject(asfFilePropertiesGUID, properties)...)
+	header := append([]byte{}, asfHeaderGUID...)
+	header = binary.LittleEndian.AppendUint64(header, uint64(30+len(objects)))
+	header = append(header, 0, 0, 0, 0, 1, 2)
+	return append(header, objects...)
+}
+
+func TestGetAsfTags(t *testing.T) {
+	data := testAsf("Título", "Some Artist", map[string]string{
+		"WM/AlbumTitle": "Some Album",
+		"WM/Genre":      "Rock",
+		"WM/Year":       "1999",
+	})
+	path := writeTestFile(t, "song.wma", append(data, make([]byte, 100)...))
+
+	err, tags := GetAsfTags(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tags.Title != "Título" || tags.Artist != "Some Artist" || tags.Album != "Some Album" || tags.Year != "1999" {
+		t.Errorf("wrong tags %+v", tags)
+	}
+	if len(tags.Track) > 0 {
+		t.Errorf("the DWORD track number was read as %q", tags.Track)
+	}
+
+	bitrate, err := asfBitrate(path)
+	if err != nil || bitrate != 192 {
+		t.Errorf("asfBitrate() = %d, %v, want 192", bitrate, err)
+	}
+}
+
+func TestGetAsfTagsDefaults(t *testing.T) {
+	path := writeTestFile(t, "Some Song.wma", testAsf("", "", nil))
+	err, tags := GetAsfTags(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tags.Title != "Some Song" || tags.Artist != "unknown" || tags.Album != "unknown" {
+		t.Errorf("wrong default tags %+v", tags)
+	}
+
+	// The header bigger than the file is an error.
+	data := testAsf("Title", "Artist", nil)
+	binary.LittleEndian.PutUint64(data[16:], uint64(len(data)+10))
+	path = writeTestFile(t, "cut.wma", data)
+	if err, _ := GetAsfTags(path); err == nil {
+		t.Error("a cut header was accepted")
+	}
+
+	path = writeTestFile(t, "song.mp3.wma", []byte("ID3 not an ASF file at all......"))
+	if err, _ := GetAsfTags(path); err == nil {
+		t.Error("a file that is not ASF was accepted")
+	}
+}
@@ -0,0 +1,70 @@
+// Copyright 2016 Danko Miocevic. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Author: Danko Miocevic
+
+package musicmgr
+
+import (
+	"errors"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var (
+	bpmNumber = regexp.MustCompile(`\d+(\.\d+)?`)
+	bpmSuffix = regexp.MustCompile(`(?i)(\d+(\.\d+)?)\s*bpm`)
+)
+
+// ParseBPM returns the BPM of a tag rounded to an
+// integer or an empty string if it is not valid.
+func ParseBPM(bpm string) string {
+	f, err := strconv.ParseFloat(strings.TrimSpace(bpm), 64)
+	if err != nil || f < 1 || f > 999 {
+		return ""
+	}
+	return strconv.Itoa(int(f + 0.5))
+}
+
+// ComputeBPM runs the command with the path of the music
+// file as the last argument and returns the BPM printed,
+// the number followed by "BPM" or the last number.
+func ComputeBPM(command []string, path string) (string, error) {
+	if len(command) < 1 {
+		return "", errors.New("There is no BPM command.")
+	}
+
+	args := append(append([]string{}, command[1:]...), path)
+	out, err := exec.Command(command[0], args...).Output()
+	if err != nil {
+		return "", err
+	}
+
+	var number string
+	if m := bpmSuffix.FindStringSubmatch(string(out)); m != nil {
+		number = m[1]
+	} else if numbers := bpmNumber.FindAllString(string(out), -1); len(numbers) > 0 {
+		number = numbers[len(numbers)-1]
+	} else {
+		return "", errors.New("The BPM command did not return a number.")
+	}
+
+	bpm := ParseBPM(number)
+	if len(bpm) < 1 {
+		return "", errors.New("The BPM command returned an invalid number.")
+	}
+	return bpm, nil
+}
@@ -0,0 +1,253 @@
+// Copyright 2016 Danko Miocevic. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Author: Danko Miocevic
+
+package musicmgr
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+)
+
+// mp3Trailers are the tags that can be
+// found after the last MPEG frame.
+var mp3Trailers = [][]byte{[]byte("TAG"), []byte("APETAGEX"), []byte("LYRICSBEGIN")}
+
+// mp3TailSize is the size of the end of the MP3
+// files read to check that the last MPEG frame
+// is complete.
+const mp3TailSize = 64 * 1024
+
+// validId3v2Header returns false if the data starts
+// with an ID3v2 header that cannot be read.
+func validId3v2Header(data []byte) bool {
+	return validId3v2Prefix(data, int64(len(data)))
+}
+
+// validId3v2Prefix checks the ID3v2 header at the
+// start of a file of the size, only the first ten
+// bytes of the file are needed.
+func validId3v2Prefix(data []byte, size int64) bool {
+	if !bytes.HasPrefix(data, []byte("ID3")) {
+		return true
+	}
+	if len(data) < 10 || data[3] < 2 || data[3] > 4 || data[4] == 0xff {
+		return false
+	}
+	for _, b := range data[6:10] {
+		if b&0x80 != 0 {
+			return false
+		}
+	}
+	return int64(id3v2Size(data)) <= size
+}
+
+// firstMpegFrame returns the offset of the first
+// MPEG frame found after the offset, the frame
+// must be followed by another frame or by the
+// end of the file to not match random data.
+// It returns -1 if there is no frame.
+func firstMpegFrame(data []byte, offset int) int {
+	for i := offset; i+4 <= len(data); i++ {
+		frame, ok := parseMpegFrame(data[i:])
+		if !ok {
+			continue
+		}
+
+		next := i + frame.Size
+		if next >= len(data) || isMp3Trailer(data[next:]) {
+			return i
+		}
+		if _, ok := parseMpegFrame(data[next:]); ok {
+			return i
+		}
+	}
+	return -1
+}
+
+// isMp3Trailer returns true if the data
+// starts with a tag found after the frames.
+func isMp3Trailer(data []byte) bool {
+	for _, t := range mp3Trailers {
+		if bytes.HasPrefix(data, t) {
+			return true
+		}
+	}
+	return false
+}
+
+// mp3Complete returns false if the data ends in the
+// middle of the ID3v2 tag, of an MPEG frame or of
+// the ID3v1 tag, like the files cut while copied.
+func mp3Complete(data []byte) bool {
+	if !validId3v2Header(data) {
+		return false
+	}
+
+	pos := firstMpegFrame(data, id3v2Size(data))
+	if pos < 0 {
+		return false
+	}
+	return mp3FramesComplete(data, pos)
+}
+
+// mp3FileComplete checks the file like mp3Complete
+// reading only its ID3v2 header and its end, the
+// whole file is read only when no MPEG frame is
+// found at the end, like after a big APE tag.
+func mp3FileComplete(path string) bool {
+	f, err := os.Open(path)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return false
+	}
+
+	head := make([]byte, 10)
+	if _, err := io.ReadFull(f, head); err != nil {
+		return false
+	}
+	if !validId3v2Prefix(head, info.Size()) {
+		return false
+	}
+
+	offset := info.Size() - mp3TailSize
+	if offset > int64(id3v2Size(head)) {
+		tail := make([]byte, mp3TailSize)
+		if _, err := f.ReadAt(tail, offset); err != nil {
+			return false
+		}
+		if pos := firstMpegFrame(tail, 0); pos >= 0 {
+			return mp3FramesComplete(tail, pos)
+		}
+	}
+
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return false
+	}
+	data, err := ioutil.ReadAll(f)
+	if err != nil {
+		return false
+	}
+	return mp3Complete(data)
+}
+
+// mp3FramesComplete returns false if the MPEG
+// frames that start at the position are cut
+// before the end of the data.
+func mp3FramesComplete(data []byte, pos int) bool {
+	for pos < len(data) && !isMp3Trailer(data[pos:]) {
+		frame, ok := parseMpegFrame(data[pos:])
+		if !ok {
+			// The corrupt frames are reported by CheckMp3.
+			return len(data)-pos >= 4
+		}
+		if pos+frame.Size > len(data) {
+			return false
+		}
+		pos += frame.Size
+	}
+
+	if bytes.HasPrefix(data[pos:], []byte("TAG")) {
+		return len(data)-pos >= 128
+	}
+	return true
+}
+
+// CheckMp3 reads all the MPEG frames of an MP3 file
+// and returns the problems found, like a broken ID3v2
+// header, garbage bytes before the first frame or
+// corrupt and truncated frames.
+func CheckMp3(path string) ([]string, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var problems []string
+	start := 0
+	if !validId3v2Header(data) {
+		problems = append(problems, "Broken ID3v2 header.")
+	} else {
+		start = id3v2Size(data)
+	}
+
+	pos := firstMpegFrame(data, start)
+	if pos < 0 {
+		return append(problems, "MPEG frame not found."), nil
+	}
+	if pos > start {
+		problems = append(problems, fmt.Sprintf("%d garbage bytes before the first MPEG frame.", pos-start))
+	}
+
+	for pos < len(data) && !isMp3Trailer(data[pos:]) {
+		frame, ok := parseMpegFrame(data[pos:])
+		if !ok {
+			problems = append(problems, fmt.Sprintf("Corrupt MPEG frame at offset %d.", pos))
+			break
+		}
+		if pos+frame.Size > len(data) {
+			problems = append(problems, "Truncated last MPEG frame.")
+			break
+		}
+		pos += frame.Size
+	}
+	return problems, nil
+}
+
+// RepairMp3 removes the garbage bytes found before
+// the first MPEG frame of an MP3 file keeping its
+// ID3v2 tag, it returns the amount of bytes removed.
+// The files with a broken ID3v2 header are not repaired.
+func RepairMp3(path string) (int, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return 0, err
+	}
+
+	if !validId3v2Header(data) {
+		return 0, errors.New("The ID3v2 header is broken.")
+	}
+
+	start := id3v2Size(data)
+	pos := firstMpegFrame(data, start)
+	if pos < 0 {
+		return 0, errors.New("MPEG frame not found.")
+	}
+	if pos == start {
+		return 0, nil
+	}
+
+	fi, err := os.Stat(path)
+	if err != nil {
+		return 0, err
+	}
+
+	tmp := path + ".repair"
+	err = ioutil.WriteFile(tmp, append(data[:start:start], data[pos:]...), fi.Mode())
+	if err != nil {
+		os.Remove(tmp)
+		return 0, err
+	}
+	return pos - start, os.Rename(tmp, path)
+}
@@ -0,0 +1,99 @@
+// Copyright 2016 Danko Miocevic. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Author: Danko Miocevic
+
+package musicmgr
+
+import (
+	"bytes"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+// testMp3 returns an MP3 file with an ID3v2 tag
+// and the number of MPEG 1 Layer III frames of
+// 128 kbps at 44100 Hz, 417 bytes each.
+func testMp3(frames int) []byte {
+	data := []byte{'I', 'D', '3', 3, 0, 0, 0, 0, 0, 10}
+	data = append(data, make([]byte, 10)...)
+	frame := make([]byte, 417)
+	copy(frame, []byte{0xff, 0xfb, 0x90, 0x00})
+	for i := 0; i < frames; i++ {
+		data = append(data, frame...)
+	}
+	return data
+}
+
+func writeTestFile(t *testing.T, name string, data []byte) string {
+	path := filepath.Join(t.TempDir(), name)
+	if err := ioutil.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestMp3Complete(t *testing.T) {
+	full := testMp3(400)
+	tests := []struct {
+		name string
+		data []byte
+		want bool
+	}{
+		{"complete", full, true},
+		{"small", testMp3(3), true},
+		{"cut frame", full[:len(full)-100], false},
+		{"cut small", testMp3(3)[:600], false},
+		{"id3v1", append(append([]byte{}, full...), append([]byte("TAG"), make([]byte, 125)...)...), true},
+		{"cut id3v1", append(append([]byte{}, full...), []byte("TAG")...), false},
+		{"cut id3v2", full[:15], false},
+	}
+
+	for _, test := range tests {
+		if got := mp3Complete(test.data); got != test.want {
+			t.Errorf("mp3Complete(%s) = %v, want %v", test.name, got, test.want)
+		}
+		path := writeTestFile(t, "song.mp3", test.data)
+		if got := mp3FileComplete(path); got != test.want {
+			t.Errorf("mp3FileComplete(%s) = %v, want %v", test.name, got, test.want)
+		}
+	}
+}
+
+func TestMp3FileCompleteBigTrailer(t *testing.T) {
+	// The APE tag hides the frames from the end.
+	data := append(testMp3(400), []byte("APETAGEX")...)
+	data = append(data, bytes.Repeat([]byte{0}, mp3TailSize)...)
+	path := writeTestFile(t, "song.mp3", data)
+	if !mp3FileComplete(path) {
+		t.Error("mp3FileComplete returned false for a big APE tag")
+	}
+}
+
+func TestIsCompleteMusicContent(t *testing.T) {
+	full := testMp3(400)
+	path := writeTestFile(t, ".muli-song", full)
+	if !IsCompleteMusicContent(path, "song.mp3") {
+		t.Error("complete temporary file rejected")
+	}
+	if IsCompleteMusicContent(path, "song.wav") {
+		t.Error("MP3 content accepted as WAV")
+	}
+
+	cut := writeTestFile(t, ".muli-cut", full[:len(full)-1])
+	if IsCompleteMusicContent(cut, "song.mp3") {
+		t.Error("cut temporary file accepted")
+	}
+}
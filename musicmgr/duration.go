@@ -0,0 +1,192 @@
+// Copyright 2016 Danko Miocevic. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Author: Danko Miocevic
+
+package musicmgr
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// GetDuration returns the duration in seconds of a music
+// file read from the headers of its audio, it returns 0
+// if the duration cannot be read.
+func GetDuration(path string) int {
+	var seconds float64
+	var err error
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".flac":
+		seconds, err = flacDuration(path)
+	case ".wav":
+		seconds, err = wavFormat.duration(path)
+	case ".aif", ".aiff":
+		seconds, err = aiffFormat.duration(path)
+	case ".wma":
+		seconds, err = asfDuration(path)
+	default:
+		seconds, err = mp3Duration(path)
+	}
+
+	if err != nil || seconds < 0 {
+		return 0
+	}
+	return int(seconds + 0.5)
+}
+
+// TrackDuration returns the duration in seconds
+// of a track of a FLAC album image.
+func TrackDuration(path string, track FlacTrack) int {
+	info, err := readFlacInfo(path)
+	if err != nil || info.sampleRate() < 1 || track.End < track.Start {
+		return 0
+	}
+	return int((track.End - track.Start + info.sampleRate()/2) / info.sampleRate())
+}
+
+// flacDuration returns the duration from the amount of
+// samples in the STREAMINFO block of a FLAC file.
+func flacDuration(path string) (float64, error) {
+	info, err := readFlacInfo(path)
+	if err != nil {
+		return 0, err
+	}
+
+	if info.sampleRate() < 1 {
+		return 0, errors.New("Wrong sample rate.")
+	}
+	return float64(info.totalSamples()) / float64(info.sampleRate()), nil
+}
+
+// mp3Duration returns the duration of an MP3 file from the
+// amount of frames in the Xing/Info header, the files without
+// it have a constant bitrate and the size of the audio is used.
+func mp3Duration(path string) (float64, error) {
+	data, size, err := readMp3Head(path)
+	if err != nil {
+		return 0, err
+	}
+
+	start, frame, err := mp3AudioFrame(data)
+	if err != nil {
+		return 0, err
+	}
+
+	if frames := xingFrames(data[start:], frame); frames > 0 {
+		return float64(frames*int64(frame.Samples)) / float64(frame.SampleRate), nil
+	}
+	return float64(size-int64(start)) * 8 / float64(frame.Bitrate*1000), nil
+}
+
+// asfDuration returns the play duration stored in the
+// File Properties object of an ASF file, without the
+// preroll time.
+func asfDuration(path string) (float64, error) {
+	var seconds float64
+	err := readAsfObjects(path, func(guid, obj []byte) {
+		if bytes.Equal(guid, asfFilePropertiesGUID) && len(obj) >= 64 {
+			// The play duration is in 100 nanoseconds
+			// units and the preroll in milliseconds.
+			duration := binary.LittleEndian.Uint64(obj[40:])
+			preroll := binary.LittleEndian.Uint64(obj[56:])
+			seconds = float64(duration)/1e7 - float64(preroll)/1e3
+		}
+	})
+	return seconds, err
+}
+
+// duration returns the duration of a WAV or AIFF file, from
+// the size of the data chunk and the byte rate of the fmt
+// chunk in WAV or from the COMM chunk in AIFF.
+func (c chunkFile) duration(path string) (float64, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	header := make([]byte, 12)
+	if _, err := io.ReadFull(f, header); err != nil {
+		return 0, err
+	}
+
+	if !c.validHeader(header) {
+		return 0, errors.New("Wrong file format.")
+	}
+
+	var byteRate uint32
+	var dataSize int64
+	offset := int64(12)
+	chunkHeader := make([]byte, 8)
+	for {
+		if _, err := f.ReadAt(chunkHeader, offset); err != nil {
+			break
+		}
+
+		id := string(chunkHeader[:4])
+		size := int64(c.order.Uint32(chunkHeader[4:8]))
+		switch id {
+		case "fmt ":
+			data := make([]byte, 12)
+			if _, err := f.ReadAt(data, offset+8); err != nil {
+				return 0, err
+			}
+			byteRate = c.order.Uint32(data[8:12])
+		case "data":
+			dataSize = size
+		case "COMM":
+			data := make([]byte, 18)
+			if _, err := f.ReadAt(data, offset+8); err != nil {
+				return 0, err
+			}
+			frames := c.order.Uint32(data[2:6])
+			rate := extendedFloat(data[8:18])
+			if rate <= 0 {
+				return 0, errors.New("Wrong sample rate.")
+			}
+			return float64(frames) / rate, nil
+		}
+
+		// Chunks are padded to an even size
+		offset += 8 + size + size%2
+	}
+
+	if byteRate < 1 || dataSize < 1 {
+		return 0, errors.New("The audio format is missing.")
+	}
+	return float64(dataSize) / float64(byteRate), nil
+}
+
+// extendedFloat decodes the 80 bits IEEE 754 extended
+// precision number used by the sample rate of AIFF.
+func extendedFloat(data []byte) float64 {
+	exponent := int(binary.BigEndian.Uint16(data[0:2]) & 0x7fff)
+	mantissa := binary.BigEndian.Uint64(data[2:10])
+	if exponent == 0 && mantissa == 0 {
+		return 0
+	}
+	value := math.Ldexp(float64(mantissa), exponent-16383-63)
+	if data[0]&0x80 != 0 {
+		return -value
+	}
+	return value
+}
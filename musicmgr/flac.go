@@ -0,0 +1,327 @@
+// Copyright 2016 Danko Miocevic. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Author: Danko Miocevic
+
+package musicmgr
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// The types of the FLAC metadata blocks.
+const (
+	flacStreamInfo    = 0
+	flacVorbisComment = 4
+	flacCueSheet      = 5
+)
+
+// maxFlacBlockSize limits the memory used to
+// read the FLAC metadata blocks.
+const maxFlacBlockSize = 16 * 1024 * 1024
+
+// flacInfo is the information read from
+// the metadata blocks of a FLAC file.
+type flacInfo struct {
+	streamInfo []byte
+	comments   map[string]string
+	cueSheet   []byte
+	// audioStart is the offset of the first frame.
+	audioStart int64
+}
+
+// sampleRate returns the sample rate in the STREAMINFO block.
+func (i flacInfo) sampleRate() uint64 {
+	return binary.BigEndian.Uint64(i.streamInfo[10:18]) >> 44
+}
+
+// totalSamples returns the amount of samples
+// per channel in the STREAMINFO block.
+func (i flacInfo) totalSamples() uint64 {
+	return binary.BigEndian.Uint64(i.streamInfo[10:18]) & 0xfffffffff
+}
+
+// blockSize returns the block size of the frames, it
+// is only used when all the frames have the same size.
+func (i flacInfo) blockSize() uint64 {
+	return uint64(binary.BigEndian.Uint16(i.streamInfo[0:2]))
+}
+
+// readFlacInfo reads the metadata blocks of a FLAC file.
+func readFlacInfo(path string) (flacInfo, error) {
+	var info flacInfo
+	f, err := os.Open(path)
+	if err != nil {
+		return info, err
+	}
+	defer f.Close()
+
+	r := bufio.NewReader(f)
+	marker := make([]byte, 4)
+	if _, err := io.ReadFull(r, marker); err != nil {
+		return info, err
+	}
+	if !bytes.Equal(marker, []byte("fLaC")) {
+		return info, errors.New("Wrong file format.")
+	}
+
+	info.audioStart = 4
+	info.comments = make(map[string]string)
+	for last := false; !last; {
+		header := make([]byte, 4)
+		if _, err := io.ReadFull(r, header); err != nil {
+			return info, err
+		}
+
+		last = header[0]&0x80 != 0
+		size := int(header[1])<<16 | int(header[2])<<8 | int(header[3])
+		if size > maxFlacBlockSize {
+			return info, errors.New("Wrong FLAC block size.")
+		}
+
+		data := make([]byte, size)
+		if _, err := io.ReadFull(r, data); err != nil {
+			return info, err
+		}
+		info.audioStart += int64(4 + size)
+
+		switch header[0] & 0x7f {
+		case flacStreamInfo:
+			info.streamInfo = data
+		case flacVorbisComment:
+			readVorbisComments(data, info.comments)
+		case flacCueSheet:
+			info.cueSheet = data
+		}
+	}
+
+	if len(info.streamInfo) < 34 {
+		return info, errors.New("The STREAMINFO block is missing.")
+	}
+	return info, nil
+}
+
+// readVorbisComments adds the comments of a VORBIS_COMMENT
+// block to the map, the names are stored in upper case.
+func readVorbisComments(data []byte, comments map[string]string) {
+	if len(data) < 4 {
+		return
+	}
+	pos := 4 + int(binary.LittleEndian.Uint32(data))
+	if pos+4 > len(data) {
+		return
+	}
+
+	count := int(binary.LittleEndian.Uint32(data[pos:]))
+	pos += 4
+	for i := 0; i < count && pos+4 <= len(data); i++ {
+		size := int(binary.LittleEndian.Uint32(data[pos:]))
+		pos += 4
+		if size < 0 || pos+size > len(data) {
+			return
+		}
+
+		comment := string(data[pos : pos+size])
+		pos += size
+		if eq := strings.Index(comment, "="); eq > 0 {
+			name := strings.ToUpper(comment[:eq])
+			// The repeated names keep the first value.
+			if _, ok := comments[name]; !ok {
+				comments[name] = comment[eq+1:]
+			}
+		}
+	}
+}
+
+// GetFlacTags returns a FileTags struct with
+// all the information obtained from the Vorbis
+// comments in the FLAC file.
+// The FLAC files are read only, the default values
+// for the missing tags are not stored on the file.
+func GetFlacTags(path string) (error, FileTags) {
+	_, file := filepath.Split(path)
+	extension := filepath.Ext(file)
+	defaultTitle := file[0 : len(file)-len(extension)]
+
+	info, err := readFlacInfo(path)
+	if err != nil {
+		return err, FileTags{Title: defaultTitle, Artist: "unknown", Album: "unknown"}
+	}
+
+	c := info.comments
+	title := c["TITLE"]
+	if title == "" || title == "unknown" {
+		title = defaultTitle
+	}
+
+	artist := c["ARTIST"]
+	if artist == "" {
+		artist = c["ALBUMARTIST"]
+	}
+	if artist == "" {
+		artist = "unknown"
+	}
+
+	album := c["ALBUM"]
+	if album == "" {
+		album = "unknown"
+	}
+
+	key := c["INITIALKEY"]
+	if key == "" {
+		key = c["KEY"]
+	}
+
+	return nil, FileTags{Title: title, Artist: artist, Album: album, Genre: normalizeGenre(c["GENRE"]),
+		Year: c["DATE"], Composer: c["COMPOSER"], Work: c["WORK"], Conductor: c["CONDUCTOR"],
+		BPM: ParseBPM(c["BPM"]), Key: ParseKey(key), Track: ParseTrack(c["TRACKNUMBER"]),
+		AlbumArtist:      c["ALBUMARTIST"],
+		MusicBrainzTrack: c["MUSICBRAINZ_TRACKID"], MusicBrainzAlbum: c["MUSICBRAINZ_ALBUMID"],
+		MusicBrainzArtist: firstID(c["MUSICBRAINZ_ARTISTID"])}
+}
+
+// FlacTrack is a track of a FLAC album image,
+// the Start and the End are sample numbers.
+type FlacTrack struct {
+	Number    int
+	Title     string
+	Performer string
+	Start     uint64
+	End       uint64
+}
+
+// GetFlacTracks returns the tracks of the cue sheet
+// embedded in a FLAC file, read from the CUESHEET
+// comment or from the CUESHEET block.
+// It returns no tracks if there is no cue sheet.
+func GetFlacTracks(path string) ([]FlacTrack, error) {
+	info, err := readFlacInfo(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var tracks []FlacTrack
+	if sheet, ok := info.comments["CUESHEET"]; ok {
+		tracks = parseCueSheet(sheet, info.sampleRate())
+	} else if info.cueSheet != nil {
+		tracks = parseCueSheetBlock(info.cueSheet)
+	}
+
+	// Every track ends where the next one
+	// starts, the last one at the end.
+	for i := range tracks {
+		if i+1 < len(tracks) {
+			tracks[i].End = tracks[i+1].Start
+		} else {
+			tracks[i].End = info.totalSamples()
+		}
+		if len(tracks[i].Title) < 1 {
+			tracks[i].Title = fmt.Sprintf("Track %02d", tracks[i].Number)
+		}
+	}
+	return tracks, nil
+}
+
+// parseCueSheet reads the tracks of a cue sheet
+// written as text, the INDEX 01 is the start of
+// every track.
+func parseCueSheet(sheet string, sampleRate uint64) []FlacTrack {
+	var tracks []FlacTrack
+	for _, line := range strings.Split(sheet, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 2 {
+			continue
+		}
+
+		value := strings.Trim(strings.TrimSpace(line[strings.Index(line, fields[0])+len(fields[0]):]), "\"")
+		switch strings.ToUpper(fields[0]) {
+		case "TRACK":
+			n, _ := strconv.Atoi(fields[1])
+			tracks = append(tracks, FlacTrack{Number: n})
+		case "TITLE":
+			if len(tracks) > 0 {
+				tracks[len(tracks)-1].Title = value
+			}
+		case "PERFORMER":
+			if len(tracks) > 0 {
+				tracks[len(tracks)-1].Performer = value
+			}
+		case "INDEX":
+			if len(tracks) > 0 && fields[1] == "01" && len(fields) > 2 {
+				tracks[len(tracks)-1].Start = cueTime(fields[2], sampleRate)
+			}
+		}
+	}
+	return tracks
+}
+
+// cueTime returns the sample number of a cue
+// sheet time written as minutes:seconds:frames,
+// there are 75 frames per second.
+func cueTime(t string, sampleRate uint64) uint64 {
+	parts := strings.Split(t, ":")
+	if len(parts) != 3 {
+		return 0
+	}
+
+	var n [3]uint64
+	for i, p := range parts {
+		n[i], _ = strconv.ParseUint(p, 10, 64)
+	}
+	return ((n[0]*60+n[1])*75 + n[2]) * sampleRate / 75
+}
+
+// parseCueSheetBlock reads the tracks of a CUESHEET
+// block, the lead-out track is not included.
+func parseCueSheetBlock(data []byte) []FlacTrack {
+	// The catalog, the lead-in and the reserved bytes.
+	pos := 128 + 8 + 259
+	if pos+1 > len(data) {
+		return nil
+	}
+	count := int(data[pos])
+	pos++
+
+	var tracks []FlacTrack
+	for i := 0; i < count && pos+36 <= len(data); i++ {
+		offset := binary.BigEndian.Uint64(data[pos:])
+		number := int(data[pos+8])
+		indexes := int(data[pos+35])
+		pos += 36
+
+		start := offset
+		for j := 0; j < indexes && pos+12 <= len(data); j++ {
+			if data[pos+8] == 1 {
+				start = offset + binary.BigEndian.Uint64(data[pos:])
+			}
+			pos += 12
+		}
+
+		// The lead-out track is 170 for the CDs and 255 for the rest.
+		if number == 170 || number == 255 {
+			break
+		}
+		tracks = append(tracks, FlacTrack{Number: number, Start: start})
+	}
+	return tracks
+}
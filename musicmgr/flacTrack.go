@@ -0,0 +1,287 @@
+// Copyright 2016 Danko Miocevic. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Author: Danko Miocevic
+
+package musicmgr
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"os"
+)
+
+// flacSearchSize is the amount of bytes read to
+// find the next frame after an offset.
+const flacSearchSize = 64 * 1024
+
+// crc8 calculates the CRC-8 used in the
+// headers of the FLAC frames.
+func crc8(data []byte) byte {
+	var crc byte
+	for _, b := range data {
+		crc ^= b
+		for i := 0; i < 8; i++ {
+			if crc&0x80 != 0 {
+				crc = crc<<1 ^ 0x07
+			} else {
+				crc <<= 1
+			}
+		}
+	}
+	return crc
+}
+
+// parseFlacFrame parses the header of the FLAC frame at
+// the start of the data and returns the number of its
+// first sample, the second return value is false if it
+// is not a valid frame header.
+func parseFlacFrame(data []byte, blockSize uint64) (uint64, bool) {
+	if len(data) < 6 || data[0] != 0xff || data[1]&0xfe != 0xf8 {
+		return 0, false
+	}
+
+	sizeCode := data[2] >> 4
+	rateCode := data[2] & 0x0f
+	if sizeCode == 0 || rateCode == 15 || data[3]>>4 > 10 || (data[3]>>1)&7 == 3 || data[3]&1 != 0 {
+		return 0, false
+	}
+
+	// The frame or sample number is coded like UTF-8.
+	pos := 4
+	n := uint64(data[pos])
+	extra := 0
+	switch {
+	case n < 0x80:
+	case n&0xe0 == 0xc0:
+		n, extra = n&0x1f, 1
+	case n&0xf0 == 0xe0:
+		n, extra = n&0x0f, 2
+	case n&0xf8 == 0xf0:
+		n, extra = n&0x07, 3
+	case n&0xfc == 0xf8:
+		n, extra = n&0x03, 4
+	case n&0xfe == 0xfc:
+		n, extra = n&0x01, 5
+	case n == 0xfe:
+		n, extra = 0, 6
+	default:
+		return 0, false
+	}
+	pos++
+	for i := 0; i < extra; i++ {
+		if pos >= len(data) || data[pos]&0xc0 != 0x80 {
+			return 0, false
+		}
+		n = n<<6 | uint64(data[pos]&0x3f)
+		pos++
+	}
+
+	switch sizeCode {
+	case 6:
+		pos++
+	case 7:
+		pos += 2
+	}
+	switch rateCode {
+	case 12:
+		pos++
+	case 13, 14:
+		pos += 2
+	}
+
+	if pos >= len(data) || crc8(data[:pos]) != data[pos] {
+		return 0, false
+	}
+
+	// The frames with a fixed block size store
+	// the frame number instead of the sample.
+	if data[1]&1 == 0 {
+		n *= blockSize
+	}
+	return n, true
+}
+
+// flacStream is the information of the frames
+// of a FLAC file used to find them.
+type flacStream struct {
+	blockSize uint64
+	total     uint64
+}
+
+// nextFlacFrame returns the offset and the first sample
+// of the first frame found from the offset, the offset
+// is -1 if there are no frames.
+// The frames after the last sample are ignored, they
+// are random data that looks like a frame header.
+func nextFlacFrame(f io.ReaderAt, offset, end int64, stream flacStream) (int64, uint64, error) {
+	buf := make([]byte, flacSearchSize)
+	for offset < end {
+		n, err := f.ReadAt(buf, offset)
+		if err != nil && err != io.EOF {
+			return -1, 0, err
+		}
+		if n < 1 {
+			break
+		}
+
+		for i := 0; i < n; i++ {
+			if sample, ok := parseFlacFrame(buf[i:n], stream.blockSize); ok && (stream.total == 0 || sample < stream.total) {
+				return offset + int64(i), sample, nil
+			}
+		}
+
+		// The header can start at the end of the buffer.
+		if n < 16 {
+			break
+		}
+		offset += int64(n - 16)
+	}
+	return -1, 0, nil
+}
+
+// findFlacSample returns the offset of the first frame
+// that starts at the sample or after it, the frames are
+// searched with a binary search over the file.
+func findFlacSample(f io.ReaderAt, start, end int64, stream flacStream, sample uint64) (int64, error) {
+	low, high := start, end
+	for high-low > flacSearchSize {
+		mid := low + (high-low)/2
+		offset, s, err := nextFlacFrame(f, mid, end, stream)
+		if err != nil {
+			return -1, err
+		}
+		if offset < 0 || s >= sample {
+			high = mid
+		} else {
+			low = offset + 1
+		}
+	}
+
+	for offset := low; offset >= 0 && offset < end; offset++ {
+		next, s, err := nextFlacFrame(f, offset, end, stream)
+		if err != nil || next < 0 {
+			return end, err
+		}
+		if s >= sample {
+			return next, nil
+		}
+		offset = next
+	}
+	return end, nil
+}
+
+// FlacTrackReader reads a track of a FLAC album
+// image as a FLAC file of its own, with a new
+// STREAMINFO block followed by the frames of the
+// track read from the image.
+type FlacTrackReader struct {
+	header []byte
+	start  int64
+	end    int64
+}
+
+// NewFlacTrackReader finds the frames of the track
+// in the FLAC file and creates its header.
+func NewFlacTrackReader(path string, track FlacTrack) (*FlacTrackReader, error) {
+	info, err := readFlacInfo(path)
+	if err != nil {
+		return nil, err
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	fi, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	stream := flacStream{blockSize: info.blockSize(), total: info.totalSamples()}
+	start, err := findFlacSample(f, info.audioStart, fi.Size(), stream, track.Start)
+	if err != nil {
+		return nil, err
+	}
+
+	end := fi.Size()
+	if track.End > 0 && track.End < info.totalSamples() {
+		end, err = findFlacSample(f, start, fi.Size(), stream, track.End)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if end <= start {
+		return nil, errors.New("The track has no frames.")
+	}
+
+	// The STREAMINFO of the track has its amount of
+	// samples, or 0 if it is unknown, and no MD5
+	// signature of the audio.
+	var samples uint64
+	if track.End > track.Start {
+		samples = track.End - track.Start
+	}
+	streamInfo := make([]byte, 34)
+	copy(streamInfo, info.streamInfo)
+	fields := binary.BigEndian.Uint64(streamInfo[10:18])
+	fields = fields&^0xfffffffff | samples&0xfffffffff
+	binary.BigEndian.PutUint64(streamInfo[10:18], fields)
+	for i := 18; i < 34; i++ {
+		streamInfo[i] = 0
+	}
+
+	header := append([]byte("fLaC"), 0x80|flacStreamInfo, 0, 0, 34)
+	header = append(header, streamInfo...)
+	return &FlacTrackReader{header: header, start: start, end: end}, nil
+}
+
+// Size returns the size of the track file.
+func (t *FlacTrackReader) Size() int64 {
+	return int64(len(t.header)) + t.end - t.start
+}
+
+// ReadAt reads the track file from the offset,
+// the frames are read from the image in f.
+func (t *FlacTrackReader) ReadAt(f io.ReaderAt, p []byte, off int64) (int, error) {
+	n := 0
+	if off < int64(len(t.header)) {
+		n = copy(p, t.header[off:])
+	}
+
+	if n < len(p) {
+		pos := t.start + off + int64(n) - int64(len(t.header))
+		if pos >= t.end {
+			return n, io.EOF
+		}
+
+		buf := p[n:]
+		if rest := t.end - pos; int64(len(buf)) > rest {
+			buf = buf[:rest]
+		}
+		read, err := f.ReadAt(buf, pos)
+		n += read
+		if err != nil {
+			return n, err
+		}
+	}
+
+	if off+int64(n) >= t.Size() {
+		return n, io.EOF
+	}
+	return n, nil
+}
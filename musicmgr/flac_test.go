@@ -0,0 +1,142 @@
+// Copyright 2016 Danko Miocevic. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Author: Danko Miocevic
+
+package musicmgr
+
+import (
+	"encoding/binary"
+	"reflect"
+	"testing"
+)
+
+const testCueSheet = `PERFORMER "Some Artist"
+TITLE "Some Album"
+FILE "album.flac" WAVE
+  TRACK 01 AUDIO
+    TITLE "First"
+    PERFORMER "Other Artist"
+    INDEX 01 00:00:00
+  TRACK 02 AUDIO
+    INDEX 00 02:59:00
+    INDEX 01 03:00:00
+`
+
+// testFlac returns a FLAC file with a STREAMINFO block of
+// 44100 Hz and the comments in a VORBIS_COMMENT block.
+func testFlac(seconds uint64, comments ...string) []byte {
+	info := make([]byte, 34)
+	binary.BigEndian.PutUint64(info[10:], 44100<<44|seconds*44100)
+
+	vorbis := binary.LittleEndian.AppendUint32(nil, 6)
+	vorbis = append(vorbis, "vendor"...)
+	vorbis = binary.LittleEndian.AppendUint32(vorbis, uint32(len(comments)))
+	for _, c := range comments {
+		vorbis = binary.LittleEndian.AppendUint32(vorbis, uint32(len(c)))
+		vorbis = append(vorbis, c...)
+	}
+
+	data := []byte("fLaC")
+	data = append(data, flacStreamInfo, 0, 0, byte(len(info)))
+	data = append(data, info...)
+	data = append(data, 0x80|flacVorbisComment, byte(len(vorbis)>>16), byte(len(vorbis)>>8), byte(len(vorbis)))
+	return append(data, vorbis...)
+}
+
+func TestCueTime(t *testing.T) {
+	tests := []struct {
+		t    string
+		want uint64
+	}{
+		{"00:00:00", 0},
+		{"00:01:00", 44100},
+		{"03:00:00", 180 * 44100},
+		{"00:00:75", 44100},
+		{"01:00", 0},
+	}
+	for _, test := range tests {
+		if got := cueTime(test.t, 44100); got != test.want {
+			t.Errorf("cueTime(%s) = %d, want %d", test.t, got, test.want)
+		}
+	}
+}
+
+func TestParseCueSheet(t *testing.T) {
+	tracks := parseCueSheet(testCueSheet, 44100)
+	want := []FlacTrack{
+		{Number: 1, Title: "First", Performer: "Other Artist", Start: 0},
+		{Number: 2, Start: 180 * 44100},
+	}
+	if !reflect.DeepEqual(tracks, want) {
+		t.Errorf("parseCueSheet() = %+v, want %+v", tracks, want)
+	}
+}
+
+func TestParseCueSheetBlock(t *testing.T) {
+	data := make([]byte, 128+8+259)
+	data = append(data, 3)
+	track := func(offset uint64, number byte, index uint64) []byte {
+		b := binary.BigEndian.AppendUint64(nil, offset)
+		b = append(b, number)
+		b = append(b, make([]byte, 26)...)
+		if index == 0 {
+			return append(b, 0)
+		}
+		b = append(b, 1)
+		b = binary.BigEndian.AppendUint64(b, index)
+		return append(b, 1, 0, 0, 0)
+	}
+	data = append(data, track(0, 1, 588)...)
+	data = append(data, track(44100, 2, 588)...)
+	data = append(data, track(88200, 170, 0)...)
+
+	tracks := parseCueSheetBlock(data)
+	want := []FlacTrack{{Number: 1, Start: 588}, {Number: 2, Start: 44100 + 588}}
+	if !reflect.DeepEqual(tracks, want) {
+		t.Errorf("parseCueSheetBlock() = %+v, want %+v", tracks, want)
+	}
+
+	if tracks := parseCueSheetBlock(data[:100]); tracks != nil {
+		t.Errorf("a cut block returned %+v", tracks)
+	}
+}
+
+func TestGetFlacTracks(t *testing.T) {
+	path := writeTestFile(t, "album.flac", testFlac(300, "ARTIST=Some Artist", "cuesheet="+testCueSheet))
+
+	err, tags := GetFlacTags(path)
+	if err != nil || tags.Artist != "Some Artist" || tags.Title != "album" {
+		t.Errorf("GetFlacTags() = %v, %+v", err, tags)
+	}
+
+	tracks, err := GetFlacTracks(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tracks) != 2 {
+		t.Fatalf("got %d tracks, want 2", len(tracks))
+	}
+	if tracks[0].End != tracks[1].Start || tracks[1].End != 300*44100 {
+		t.Errorf("wrong track ends %+v", tracks)
+	}
+	if tracks[1].Title != "Track 02" {
+		t.Errorf("the track without title is named %q", tracks[1].Title)
+	}
+
+	path = writeTestFile(t, "cut.flac", testFlac(300)[:20])
+	if _, err := GetFlacTracks(path); err == nil {
+		t.Error("a cut FLAC file was accepted")
+	}
+}
@@ -0,0 +1,167 @@
+// Copyright 2016 Danko Miocevic. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Author: Danko Miocevic
+
+package musicmgr
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+)
+
+// gaplessHeaderSize is the size of the start of the
+// first MPEG frame that holds the Xing/Info header and
+// the LAME header with the encoder delay and padding.
+const gaplessHeaderSize = 192
+
+// gaplessSafe skips the rewriting of the files whose
+// gapless information cannot be preserved.
+var gaplessSafe bool
+
+// ErrGaplessSkipped is returned when the tags are not
+// written to keep the gapless information of the file.
+var ErrGaplessSkipped = errors.New("The tags are not written to keep the gapless information.")
+
+// SetGaplessSafe defines if the MP3 files whose
+// LAME/Info header cannot be preserved are left
+// without rewriting their tags.
+func SetGaplessSafe(safe bool) {
+	gaplessSafe = safe
+}
+
+// id3v2Size returns the size of the ID3v2 tag
+// at the start of the data or 0 if there is no tag.
+func id3v2Size(data []byte) int {
+	if len(data) < 10 || !bytes.HasPrefix(data, []byte("ID3")) {
+		return 0
+	}
+
+	size := 10 + (int(data[6]&0x7f)<<21 | int(data[7]&0x7f)<<14 |
+		int(data[8]&0x7f)<<7 | int(data[9]&0x7f))
+	// The footer of the tag.
+	if data[5]&0x10 != 0 {
+		size += 10
+	}
+	return size
+}
+
+// mp3AudioStart returns the offset of the first
+// MPEG frame of the file, after the ID3v2 tag.
+// It returns -1 if there is no frame.
+func mp3AudioStart(data []byte) int {
+	for i := id3v2Size(data); i+1 < len(data); i++ {
+		if data[i] == 0xff && data[i+1]&0xe0 == 0xe0 {
+			return i
+		}
+	}
+	return -1
+}
+
+// gaplessHeader returns the start of the first
+// MPEG frame if it is a Xing/Info frame and its
+// offset in the file.
+// The header is nil if the file does not have it.
+func gaplessHeader(data []byte) ([]byte, int) {
+	start := mp3AudioStart(data)
+	if start < 0 {
+		return nil, start
+	}
+
+	end := start + gaplessHeaderSize
+	if end > len(data) {
+		end = len(data)
+	}
+	frame := data[start:end]
+	if !bytes.Contains(frame, []byte("Xing")) && !bytes.Contains(frame, []byte("Info")) {
+		return nil, start
+	}
+	return frame, start
+}
+
+// copyFile copies the file in src to dst
+// with the given permissions.
+func copyFile(src, dst string, mode os.FileMode) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, mode)
+	if err != nil {
+		return err
+	}
+
+	_, err = io.Copy(out, in)
+	if err == nil {
+		err = out.Close()
+	} else {
+		out.Close()
+	}
+	if err != nil {
+		os.Remove(dst)
+	}
+	return err
+}
+
+// setGaplessMp3Tags writes the tags of an MP3 file
+// that has a Xing/Info header in a copy of the file.
+// If the rewrite changed the header the original
+// MPEG frames are restored after the new tag, and
+// the file is only replaced if the header is kept.
+// The write function writes the tags in the copy.
+func setGaplessMp3Tags(songPath string, original []byte, write func(path string) error) error {
+	header, start := gaplessHeader(original)
+
+	fi, err := os.Stat(songPath)
+	if err != nil {
+		return err
+	}
+
+	tmp := songPath + ".gapless"
+	err = copyFile(songPath, tmp, fi.Mode())
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp)
+
+	err = write(tmp)
+	if err != nil {
+		return err
+	}
+
+	data, err := ioutil.ReadFile(tmp)
+	if err != nil {
+		return err
+	}
+
+	newHeader, newStart := gaplessHeader(data)
+	if !bytes.Equal(header, newHeader) && newStart >= 0 {
+		data = append(data[:newStart:newStart], original[start:]...)
+		err = ioutil.WriteFile(tmp, data, fi.Mode())
+		if err != nil {
+			return err
+		}
+		newHeader, _ = gaplessHeader(data)
+	}
+
+	if !bytes.Equal(header, newHeader) && gaplessSafe {
+		return ErrGaplessSkipped
+	}
+	return os.Rename(tmp, songPath)
+}
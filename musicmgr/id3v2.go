@@ -0,0 +1,271 @@
+// Copyright 2016 Danko Miocevic. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Author: Danko Miocevic
+
+// Package musicmgr controls the tags in the music files.
+// The tools include tools to read the different Tags in the
+// music files.
+package musicmgr
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// id3Frame is a raw ID3v2 frame, the data
+// contains the frame body without the header.
+type id3Frame struct {
+	id   string
+	data []byte
+}
+
+// syncsafe decodes a 28 bits syncsafe integer
+// as used in the ID3v2 headers.
+func syncsafe(b []byte) int {
+	return int(b[0]&0x7f)<<21 | int(b[1]&0x7f)<<14 | int(b[2]&0x7f)<<7 | int(b[3]&0x7f)
+}
+
+// putSyncsafe encodes a 28 bits syncsafe integer.
+func putSyncsafe(b []byte, n int) {
+	b[0] = byte(n>>21) & 0x7f
+	b[1] = byte(n>>14) & 0x7f
+	b[2] = byte(n>>7) & 0x7f
+	b[3] = byte(n) & 0x7f
+}
+
+// parseID3v2 reads all the frames from an ID3v2.3 or
+// ID3v2.4 tag stored in a byte slice.
+// The slice must start with the "ID3" header.
+func parseID3v2(b []byte) ([]id3Frame, error) {
+	if len(b) < 10 || string(b[:3]) != "ID3" {
+		return nil, errors.New("Not an ID3v2 tag.")
+	}
+
+	version := b[3]
+	if version != 3 && version != 4 {
+		return nil, errors.New("Unsupported ID3v2 version.")
+	}
+
+	flags := b[5]
+	end := 10 + syncsafe(b[6:10])
+	if end > len(b) {
+		end = len(b)
+	}
+
+	pos := 10
+	// Skip the extended header if present
+	if flags&0x40 != 0 && pos+4 <= end {
+		if version == 4 {
+			pos += syncsafe(b[pos : pos+4])
+		} else {
+			extSize := int(b[pos])<<24 | int(b[pos+1])<<16 | int(b[pos+2])<<8 | int(b[pos+3])
+			pos += 4 + extSize
+		}
+	}
+
+	var frames []id3Frame
+	for pos+10 <= end {
+		// Padding reached
+		if b[pos] == 0 {
+			break
+		}
+
+		id := string(b[pos : pos+4])
+		var size int
+		if version == 4 {
+			size = syncsafe(b[pos+4 : pos+8])
+		} else {
+			size = int(b[pos+4])<<24 | int(b[pos+5])<<16 | int(b[pos+6])<<8 | int(b[pos+7])
+		}
+
+		pos += 10
+		if size < 0 || pos+size > end {
+			return frames, errors.New("Corrupt ID3v2 frame.")
+		}
+
+		data := make([]byte, size)
+		copy(data, b[pos:pos+size])
+		frames = append(frames, id3Frame{id: id, data: data})
+		pos += size
+	}
+
+	return frames, nil
+}
+
+// encodeID3v2 generates an ID3v2.4 tag with the given frames.
+// If the minSize is bigger than the generated tag, the
+// tag is padded with zeros to match it.
+func encodeID3v2(frames []id3Frame, minSize int) []byte {
+	var body bytes.Buffer
+	for _, f := range frames {
+		header := make([]byte, 10)
+		copy(header, f.id)
+		putSyncsafe(header[4:8], len(f.data))
+		body.Write(header)
+		body.Write(f.data)
+	}
+
+	for body.Len()+10 < minSize {
+		body.WriteByte(0)
+	}
+
+	header := []byte{'I', 'D', '3', 4, 0, 0, 0, 0, 0, 0}
+	putSyncsafe(header[6:10], body.Len())
+	return append(header, body.Bytes()...)
+}
+
+// textFrameValue decodes the text stored in an ID3v2
+// text frame body honoring the encoding byte.
+func textFrameValue(data []byte) string {
+	if len(data) < 1 {
+		return ""
+	}
+
+	text := data[1:]
+	var value string
+	switch data[0] {
+	case 0:
+		runes := make([]rune, len(text))
+		for i, c := range text {
+			runes[i] = rune(c)
+		}
+		value = string(runes)
+	case 1, 2:
+		bigEndian := data[0] == 2
+		if len(text) >= 2 {
+			if text[0] == 0xff && text[1] == 0xfe {
+				bigEndian = false
+				text = text[2:]
+			} else if text[0] == 0xfe && text[1] == 0xff {
+				bigEndian = true
+				text = text[2:]
+			}
+		}
+		units := make([]uint16, len(text)/2)
+		for i := range units {
+			if bigEndian {
+				units[i] = uint16(text[2*i])<<8 | uint16(text[2*i+1])
+			} else {
+				units[i] = uint16(text[2*i+1])<<8 | uint16(text[2*i])
+			}
+		}
+		value = string(utf16.Decode(units))
+	default:
+		if utf8.Valid(text) {
+			value = string(text)
+		}
+	}
+
+	// Multiple values are separated by null characters,
+	// only the first one is used.
+	if i := bytes.IndexByte([]byte(value), 0); i >= 0 {
+		value = value[:i]
+	}
+	return value
+}
+
+// userTextFrame returns the description and the
+// value stored in the body of a TXXX frame.
+func userTextFrame(data []byte) (string, string) {
+	if len(data) < 1 {
+		return "", ""
+	}
+
+	// The description ends with a null character
+	// in the encoding of the frame.
+	term := []byte{0}
+	if data[0] == 1 || data[0] == 2 {
+		term = []byte{0, 0}
+	}
+	body := data[1:]
+	for i := 0; i+len(term) <= len(body); i += len(term) {
+		if bytes.Equal(body[i:i+len(term)], term) {
+			desc := textFrameValue(append([]byte{data[0]}, body[:i]...))
+			value := textFrameValue(append([]byte{data[0]}, body[i+len(term):]...))
+			return desc, value
+		}
+	}
+	return textFrameValue(data), ""
+}
+
+// musicBrainzOwner is the owner of the UFID frame
+// that stores the MusicBrainz recording identifier.
+const musicBrainzOwner = "http://musicbrainz.org"
+
+// firstID returns the first identifier of a
+// list like the ones of the multiple Artists.
+func firstID(value string) string {
+	ids := strings.FieldsFunc(value, func(r rune) bool {
+		return r == '/' || r == ';' || r == ' '
+	})
+	if len(ids) < 1 {
+		return ""
+	}
+	return ids[0]
+}
+
+// readMusicBrainzIDs sets the MusicBrainz identifiers
+// stored in the UFID and TXXX frames as written by
+// MusicBrainz Picard.
+func readMusicBrainzIDs(tags *FileTags, frames []id3Frame) {
+	for _, f := range frames {
+		switch f.id {
+		case "UFID":
+			i := bytes.IndexByte(f.data, 0)
+			if i >= 0 && string(f.data[:i]) == musicBrainzOwner {
+				tags.MusicBrainzTrack = string(f.data[i+1:])
+			}
+		case "TXXX":
+			desc, value := userTextFrame(f.data)
+			switch strings.ToLower(desc) {
+			case "musicbrainz album id":
+				tags.MusicBrainzAlbum = firstID(value)
+			case "musicbrainz artist id":
+				tags.MusicBrainzArtist = firstID(value)
+			}
+		}
+	}
+}
+
+// newTextFrame creates a UTF-8 encoded text frame.
+func newTextFrame(id, text string) id3Frame {
+	return id3Frame{id: id, data: append([]byte{3}, text...)}
+}
+
+// getFrameText returns the text for the first frame
+// with the specified id or an empty string.
+func getFrameText(frames []id3Frame, id string) string {
+	for _, f := range frames {
+		if f.id == id {
+			return textFrameValue(f.data)
+		}
+	}
+	return ""
+}
+
+// setFrameText replaces the frame with the specified id
+// or appends it if it does not exist yet.
+func setFrameText(frames []id3Frame, id, text string) []id3Frame {
+	for i, f := range frames {
+		if f.id == id {
+			frames[i] = newTextFrame(id, text)
+			return frames
+		}
+	}
+	return append(frames, newTextFrame(id, text))
+}
@@ -0,0 +1,103 @@
+// Copyright 2016 Danko Miocevic. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Author: Danko Miocevic
+
+package musicmgr
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestID3v2RoundTrip(t *testing.T) {
+	frames := []id3Frame{newTextFrame("TIT2", "Title"), newTextFrame("TPE1", "Artist")}
+	tag := encodeID3v2(frames, 100)
+	if len(tag) != 100 {
+		t.Errorf("the tag has %d bytes, want the 100 of the padding", len(tag))
+	}
+
+	parsed, err := parseID3v2(tag)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(parsed, frames) {
+		t.Errorf("parseID3v2() = %v, want %v", parsed, frames)
+	}
+
+	frames = setFrameText(parsed, "TIT2", "Other")
+	frames = setFrameText(frames, "TALB", "Album")
+	if getFrameText(frames, "TIT2") != "Other" || getFrameText(frames, "TALB") != "Album" || len(frames) != 3 {
+		t.Errorf("wrong frames after setFrameText: %v", frames)
+	}
+}
+
+func TestParseID3v23(t *testing.T) {
+	// ID3v2.3 frame sizes are not syncsafe.
+	body := make([]byte, 200)
+	tag := []byte{'I', 'D', '3', 3, 0, 0, 0, 0, 1, 0x53}
+	frame := append([]byte{'T', 'I', 'T', '2', 0, 0, 0, 201, 0, 0, 0}, body...)
+	parsed, err := parseID3v2(append(tag, frame...))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(parsed) != 1 || len(parsed[0].data) != 201 {
+		t.Errorf("wrong frames %v", parsed)
+	}
+
+	if _, err := parseID3v2([]byte{'I', 'D', '3', 2, 0, 0, 0, 0, 0, 0}); err == nil {
+		t.Error("an ID3v2.2 tag was accepted")
+	}
+	cut := append([]byte{'I', 'D', '3', 4, 0, 0, 0, 0, 0, 20}, []byte{'T', 'I', 'T', '2', 0, 0, 1, 0, 0, 0}...)
+	if _, err := parseID3v2(cut); err == nil {
+		t.Error("a frame bigger than the tag was accepted")
+	}
+}
+
+func TestTextFrameValue(t *testing.T) {
+	tests := []struct {
+		data []byte
+		want string
+	}{
+		{[]byte{0, 'c', 'a', 'f', 0xe9}, "café"},
+		{[]byte{1, 0xff, 0xfe, 'h', 0, 'i', 0}, "hi"},
+		{[]byte{1, 0xfe, 0xff, 0, 'h', 0, 'i'}, "hi"},
+		{[]byte{2, 0, 'h', 0, 'i'}, "hi"},
+		{append([]byte{3}, "ñandú"...), "ñandú"},
+		{[]byte{3, 'a', 0, 'b'}, "a"},
+		{[]byte{3, 0xff}, ""},
+		{nil, ""},
+	}
+	for _, test := range tests {
+		if got := textFrameValue(test.data); got != test.want {
+			t.Errorf("textFrameValue(%v) = %q, want %q", test.data, got, test.want)
+		}
+	}
+}
+
+func TestReadMusicBrainzIDs(t *testing.T) {
+	frames := []id3Frame{
+		{id: "UFID", data: append([]byte(musicBrainzOwner+"\x00"), "track-id"...)},
+		{id: "TXXX", data: append([]byte{3}, "MusicBrainz Album Id\x00album-id"...)},
+		{id: "TXXX", data: []byte{1, 0xff, 0xfe, 'M', 0, 'u', 0, 's', 0, 'i', 0, 'c', 0, 'B', 0, 'r', 0, 'a', 0, 'i', 0, 'n', 0,
+			'z', 0, ' ', 0, 'A', 0, 'r', 0, 't', 0, 'i', 0, 's', 0, 't', 0, ' ', 0, 'I', 0, 'd', 0, 0, 0,
+			0xff, 0xfe, 'a', 0, '1', 0, '/', 0, 'a', 0, '2', 0}},
+	}
+
+	var tags FileTags
+	readMusicBrainzIDs(&tags, frames)
+	if tags.MusicBrainzTrack != "track-id" || tags.MusicBrainzAlbum != "album-id" || tags.MusicBrainzArtist != "a1" {
+		t.Errorf("wrong identifiers %+v", tags)
+	}
+}
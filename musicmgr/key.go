@@ -0,0 +1,87 @@
+// Copyright 2016 Danko Miocevic. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Author: Danko Miocevic
+
+package musicmgr
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var (
+	camelotKey = regexp.MustCompile(`^(\d{1,2})([AB])$`)
+	openKey    = regexp.MustCompile(`^(\d{1,2})([dm])$`)
+	musicalKey = regexp.MustCompile(`^([A-G])([#b]?)\s*(m|min|minor|maj|major)?$`)
+)
+
+// pitchClasses are the pitch classes of the notes.
+var pitchClasses = map[string]int{
+	"C": 0, "D": 2, "E": 4, "F": 5, "G": 7, "A": 9, "B": 11,
+}
+
+// ParseKey returns the Camelot code (like 8A) of the
+// musical key in a tag, written as a key like "Am",
+// "C# minor" or "Eb", in Camelot or in Open Key notation.
+// It returns an empty string if the key is not valid.
+func ParseKey(key string) string {
+	key = strings.TrimSpace(key)
+	key = strings.NewReplacer("♯", "#", "♭", "b").Replace(key)
+
+	if m := camelotKey.FindStringSubmatch(strings.ToUpper(key)); m != nil {
+		n, _ := strconv.Atoi(m[1])
+		if n < 1 || n > 12 {
+			return ""
+		}
+		return strconv.Itoa(n) + m[2]
+	}
+
+	// The Open Key 1d is the Camelot 8B.
+	if m := openKey.FindStringSubmatch(strings.ToLower(key)); m != nil {
+		n, _ := strconv.Atoi(m[1])
+		if n < 1 || n > 12 {
+			return ""
+		}
+		letter := "B"
+		if m[2] == "m" {
+			letter = "A"
+		}
+		return strconv.Itoa((n+6)%12+1) + letter
+	}
+
+	m := musicalKey.FindStringSubmatch(key)
+	if m == nil {
+		return ""
+	}
+
+	pc := pitchClasses[m[1]]
+	switch m[2] {
+	case "#":
+		pc++
+	case "b":
+		pc--
+	}
+
+	// The minor keys have the code of
+	// their relative major key.
+	letter := "B"
+	if m[3] == "m" || m[3] == "min" || m[3] == "minor" {
+		pc += 3
+		letter = "A"
+	}
+	pc = (pc + 12) % 12
+	return strconv.Itoa((pc*7+7)%12+1) + letter
+}
@@ -20,9 +20,12 @@
 package musicmgr
 
 import (
+	"io/ioutil"
 	"path/filepath"
+	"strings"
 
 	id3 "github.com/mikkyang/id3-go"
+	v2 "github.com/mikkyang/id3-go/v2"
 )
 
 // GetMp3Tags returns a FileTags struct with
@@ -40,7 +43,7 @@ func GetMp3Tags(path string) (error, FileTags) {
 		_, file := filepath.Split(path)
 		extension := filepath.Ext(file)
 		songTitle := file[0 : len(file)-len(extension)]
-		return err, FileTags{songTitle, "unknown", "unknown"}
+		return err, FileTags{Title: songTitle, Artist: "unknown", Album: "unknown"}
 	}
 
 	defer mp3File.Close()
@@ -65,13 +68,54 @@ func GetMp3Tags(path string) (error, FileTags) {
 		mp3File.SetAlbum(album)
 	}
 
-	ft := FileTags{title, artist, album}
+	ft := FileTags{Title: title, Artist: artist, Album: album, Genre: normalizeGenre(mp3File.Genre()),
+		Year: mp3File.Year(), Composer: mp3FrameText(mp3File, "TCOM"), Work: mp3FrameText(mp3File, "TIT1"),
+		Conductor: mp3FrameText(mp3File, "TPE3"), BPM: ParseBPM(mp3FrameText(mp3File, "TBPM")),
+		Key: ParseKey(mp3FrameText(mp3File, "TKEY")), Track: ParseTrack(mp3FrameText(mp3File, "TRCK")),
+		AlbumArtist: mp3FrameText(mp3File, "TPE2")}
+
+	var frames []id3Frame
+	for _, id := range []string{"UFID", "TXXX"} {
+		for _, frame := range mp3File.Frames(id) {
+			frames = append(frames, id3Frame{id: id, data: frame.Bytes()})
+		}
+	}
+	readMusicBrainzIDs(&ft, frames)
 	return nil, ft
 }
 
+// mp3FrameText returns the text of a frame of the
+// MP3 file tags or an empty string if it is missing.
+func mp3FrameText(mp3File *id3.File, id string) string {
+	frame := mp3File.Frame(id)
+	if frame == nil {
+		return ""
+	}
+	return strings.TrimRight(frame.String(), "\x00")
+}
+
 // SetMp3Tags updates the Artist, Album and Title
 // tags with new values in the song MP3 file.
+// The LAME/Info header with the gapless information
+// of the file is kept when the tags are rewritten.
 func SetMp3Tags(artist string, album string, title string, songPath string) error {
+	data, err := ioutil.ReadFile(songPath)
+	if err != nil {
+		return err
+	}
+
+	header, _ := gaplessHeader(data)
+	if header != nil {
+		return setGaplessMp3Tags(songPath, data, func(path string) error {
+			return writeMp3Tags(artist, album, title, path)
+		})
+	}
+	return writeMp3Tags(artist, album, title, songPath)
+}
+
+// writeMp3Tags writes the Artist, Album and
+// Title tags in the song MP3 file.
+func writeMp3Tags(artist string, album string, title string, songPath string) error {
 	mp3File, err := id3.Open(songPath)
 	if err != nil {
 		return err
@@ -84,3 +128,59 @@ func SetMp3Tags(artist string, album string, title string, songPath string) erro
 
 	return nil
 }
+
+// SetMp3Track updates the track number tag in the
+// song MP3 file keeping the gapless information.
+func SetMp3Track(track string, songPath string) error {
+	data, err := ioutil.ReadFile(songPath)
+	if err != nil {
+		return err
+	}
+
+	header, _ := gaplessHeader(data)
+	if header != nil {
+		return setGaplessMp3Tags(songPath, data, func(path string) error {
+			return writeMp3Track(track, path)
+		})
+	}
+	return writeMp3Track(track, songPath)
+}
+
+// writeMp3Track writes the track number
+// tag in the song MP3 file.
+func writeMp3Track(track string, songPath string) error {
+	return writeMp3Frame("TRCK", track, songPath)
+}
+
+// SetMp3Genre updates the genre tag in the song
+// MP3 file keeping the gapless information.
+func SetMp3Genre(genre string, songPath string) error {
+	data, err := ioutil.ReadFile(songPath)
+	if err != nil {
+		return err
+	}
+
+	header, _ := gaplessHeader(data)
+	if header != nil {
+		return setGaplessMp3Tags(songPath, data, func(path string) error {
+			return writeMp3Frame("TCON", genre, path)
+		})
+	}
+	return writeMp3Frame("TCON", genre, songPath)
+}
+
+// writeMp3Frame writes a text frame in the song
+// MP3 file, an empty text removes the frame.
+func writeMp3Frame(id, text, songPath string) error {
+	mp3File, err := id3.Open(songPath)
+	if err != nil {
+		return err
+	}
+	defer mp3File.Close()
+
+	mp3File.DeleteFrames(id)
+	if len(text) > 0 {
+		mp3File.AddFrames(v2.NewTextFrame(v2.V23FrameTypeMap[id], text))
+	}
+	return nil
+}
@@ -19,9 +19,376 @@
 // music files.
 package musicmgr
 
+import (
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
 // FileTags defines the tags found in a specific music file.
+// The Genre, Year, Composer, Work, Conductor, BPM,
+// Key and Track are empty if the file does not have
+// them, the Key is stored as its Camelot code.
 type FileTags struct {
-	Title  string
-	Artist string
-	Album  string
+	Title     string
+	Artist    string
+	Album     string
+	Genre     string
+	Year      string
+	Composer  string
+	Work      string
+	Conductor string
+	BPM       string
+	Key       string
+	Track     string
+
+	// The album artist tag, and the Artist of the track
+	// when the Songs are grouped by their album artist.
+	AlbumArtist string
+	TrackArtist string
+
+	// The MusicBrainz identifiers of the
+	// recording, the release and the artist.
+	MusicBrainzTrack  string
+	MusicBrainzAlbum  string
+	MusicBrainzArtist string
+}
+
+// musicExtensions lists all the file extensions
+// that are recognized as music files.
+var musicExtensions = []string{".mp3", ".wav", ".aif", ".aiff", ".wma", ".flac"}
+
+// minMusicSize is the size in bytes under which the music
+// files are not stored in the Music Library, they are
+// usually left by failed downloads.
+var minMusicSize int64
+
+// SetMusicExtensions sets the file extensions that are
+// recognized as music files, the leading dot is optional.
+// The tags of the extensions without a tag reader are read
+// as MP3 tags or taken from the path of the file.
+func SetMusicExtensions(extensions []string) {
+	musicExtensions = nil
+	for _, e := range extensions {
+		e = strings.ToLower(strings.TrimSpace(e))
+		if len(e) > 0 && e[0] != '.' {
+			e = "." + e
+		}
+		if len(e) > 1 {
+			musicExtensions = append(musicExtensions, e)
+		}
+	}
+}
+
+// SetMinMusicSize sets the size in bytes under which
+// the music files are not stored in the Music Library.
+func SetMinMusicSize(size int64) {
+	minMusicSize = size
+}
+
+// CheckMusicSize returns an error if the music file in
+// the specified path is smaller than the minimum size.
+func CheckMusicSize(path string) error {
+	if minMusicSize < 1 {
+		return nil
+	}
+
+	fi, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+
+	if fi.Size() < minMusicSize {
+		return errors.New("The file is smaller than " + strconv.FormatInt(minMusicSize, 10) + " bytes.")
+	}
+	return nil
+}
+
+// IsMusicFile returns true if the file in the
+// specified path has a supported music extension.
+func IsMusicFile(path string) bool {
+	extension := strings.ToLower(filepath.Ext(path))
+	for _, e := range musicExtensions {
+		if e == extension {
+			return true
+		}
+	}
+	return false
+}
+
+// IsValidMusicFile returns true if the header of the file
+// matches the format expected for its extension.
+// It is used to check that a file was completely written
+// before storing it in the Music Library.
+func IsValidMusicFile(path string) bool {
+	return IsValidMusicContent(path, path)
+}
+
+// IsValidMusicContent checks the header of the file in path
+// with the format expected for the extension of name, it is
+// used for the temporary files that replace the Songs.
+func IsValidMusicContent(path, name string) bool {
+	f, err := os.Open(path)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+
+	header := make([]byte, 16)
+	if _, err := io.ReadFull(f, header); err != nil {
+		return false
+	}
+
+	switch strings.ToLower(filepath.Ext(name)) {
+	case ".mp3":
+		// ID3 tag or MPEG frame sync.
+		return bytes.Equal(header[:3], []byte("ID3")) ||
+			(header[0] == 0xFF && header[1]&0xE0 == 0xE0)
+	case ".wav":
+		return wavFormat.validHeader(header)
+	case ".aif", ".aiff":
+		return aiffFormat.validHeader(header)
+	case ".wma":
+		return bytes.Equal(header, asfHeaderGUID)
+	case ".flac":
+		return bytes.Equal(header[:4], []byte("fLaC"))
+	}
+	// The headers of the extra extensions are not checked.
+	return IsMusicFile(name)
+}
+
+// IsCompleteMusicFile returns true if the file is a valid
+// music file that was not cut while it was copied. The size
+// declared by the WAV and AIFF files is checked and the
+// last MPEG frame of the MP3 files must be complete.
+func IsCompleteMusicFile(path string) bool {
+	return IsCompleteMusicContent(path, path)
+}
+
+// IsCompleteMusicContent checks the file in path like
+// IsCompleteMusicFile with the format expected for the
+// extension of name, it is used for the temporary files
+// that replace the Songs. Only the end of the MP3 files
+// is read.
+func IsCompleteMusicContent(path, name string) bool {
+	if !IsValidMusicContent(path, name) {
+		return false
+	}
+
+	switch strings.ToLower(filepath.Ext(name)) {
+	case ".mp3":
+		return mp3FileComplete(path)
+	case ".wav":
+		return wavFormat.complete(path)
+	case ".aif", ".aiff":
+		return aiffFormat.complete(path)
+	}
+	return true
+}
+
+// GetTags returns a FileTags struct with the
+// information obtained from the music file tags,
+// the missing tags are read from the path with the
+// patterns set in SetPathPatterns and all of them
+// are normalized with the rules set in SetNormalizeRules.
+// The Artist is the album artist when the Songs are
+// grouped by it, see SetAlbumArtistGrouping.
+func GetTags(path string) (error, FileTags) {
+	err, tags := GetRawTags(path)
+	return err, normalizeRules.Normalize(groupByAlbumArtist(tagsFromPath(path, tags)))
+}
+
+// GetRawTags returns a FileTags struct with the
+// information obtained from the music file tags, they
+// are read again only if the file changed since the
+// last time they were read. The tags stored in the
+// sidecar of the file replace the ones in the file.
+func GetRawTags(path string) (error, FileTags) {
+	err, tags := cachedRawTags(path)
+	return err, applyTagSidecar(path, tags)
+}
+
+// readRawTags reads the tags of the music file,
+// the tag reader is chosen based on the file extension.
+func readRawTags(path string) (error, FileTags) {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".wav":
+		return GetWavTags(path)
+	case ".aif", ".aiff":
+		return GetAiffTags(path)
+	case ".wma":
+		return GetAsfTags(path)
+	case ".flac":
+		return GetFlacTags(path)
+	}
+	return GetMp3Tags(path)
+}
+
+// ParseTrack returns the number of a track tag without
+// the total of tracks and the leading zeros, or an
+// empty string if it is not valid.
+func ParseTrack(track string) string {
+	track = strings.TrimSpace(strings.SplitN(track, "/", 2)[0])
+	n, err := strconv.Atoi(track)
+	if err != nil || n < 1 {
+		return ""
+	}
+	return strconv.Itoa(n)
+}
+
+// breakHardlink replaces a file that has other hard links
+// with a copy, so the tags written in it do not change
+// the other files sharing its content.
+func breakHardlink(path string) error {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+
+	st, ok := fi.Sys().(*syscall.Stat_t)
+	if !ok || uint64(st.Nlink) < 2 {
+		return nil
+	}
+
+	tmp := path + ".unlink"
+	err = copyFile(path, tmp, fi.Mode())
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// SetTags updates the Artist, Album and Title
+// tags in the music file, the tag writer is chosen
+// based on the file extension.
+// The file is not modified if it already has the tags.
+// When the Songs are grouped by their album artist the
+// artist is written in the album artist tag, the Artist
+// tag is only changed if it was the same.
+func SetTags(artist string, album string, title string, songPath string) error {
+	err, tags := GetRawTags(songPath)
+	if err == nil && groupedByAlbumArtist(tags) {
+		trackArtist := tags.Artist
+		if trackArtist == tags.AlbumArtist {
+			trackArtist = artist
+		}
+
+		err = SetAlbumArtist(artist, songPath)
+		if err != nil {
+			return err
+		}
+		tags.AlbumArtist = artist
+		artist = trackArtist
+	}
+
+	if err == nil && tags.Artist == artist && tags.Album == album && tags.Title == title {
+		return nil
+	}
+
+	if useTagSidecar(songPath) {
+		return writeTagSidecar(songPath, map[string]string{"artist": artist, "album": album, "title": title})
+	}
+
+	err = breakHardlink(songPath)
+	if err != nil {
+		return err
+	}
+
+	if command, ok := tagWriter(songPath); ok {
+		tags.Artist, tags.Album, tags.Title = artist, album, title
+		return runTagWriter(command, tags, songPath)
+	}
+
+	switch strings.ToLower(filepath.Ext(songPath)) {
+	case ".wav":
+		return SetWavTags(artist, album, title, songPath)
+	case ".aif", ".aiff":
+		return SetAiffTags(artist, album, title, songPath)
+	case ".mp3":
+		return SetMp3Tags(artist, album, title, songPath)
+	case ".wma":
+		return errors.New("WMA files are read only.")
+	case ".flac":
+		return errors.New("FLAC files are read only.")
+	}
+	return errors.New("Wrong file format.")
+}
+
+// SetTrack updates the track number tag in the
+// music file, an empty track removes it.
+func SetTrack(track string, songPath string) error {
+	err, tags := GetRawTags(songPath)
+	if err == nil && tags.Track == track {
+		return nil
+	}
+
+	if useTagSidecar(songPath) {
+		return writeTagSidecar(songPath, map[string]string{"track": track})
+	}
+
+	err = breakHardlink(songPath)
+	if err != nil {
+		return err
+	}
+
+	if command, ok := tagWriter(songPath); ok {
+		tags.Track = track
+		return runTagWriter(command, tags, songPath)
+	}
+
+	switch strings.ToLower(filepath.Ext(songPath)) {
+	case ".wav":
+		return setChunkTrack(wavFormat, track, songPath)
+	case ".aif", ".aiff":
+		return setChunkTrack(aiffFormat, track, songPath)
+	case ".mp3":
+		return SetMp3Track(track, songPath)
+	case ".wma":
+		return errors.New("WMA files are read only.")
+	case ".flac":
+		return errors.New("FLAC files are read only.")
+	}
+	return errors.New("Wrong file format.")
+}
+
+// SetGenre updates the genre tag in the
+// music file, an empty genre removes it.
+func SetGenre(genre string, songPath string) error {
+	err, tags := GetRawTags(songPath)
+	if err == nil && tags.Genre == genre {
+		return nil
+	}
+
+	if useTagSidecar(songPath) {
+		return writeTagSidecar(songPath, map[string]string{"genre": genre})
+	}
+
+	err = breakHardlink(songPath)
+	if err != nil {
+		return err
+	}
+
+	if command, ok := tagWriter(songPath); ok {
+		tags.Genre = genre
+		return runTagWriter(command, tags, songPath)
+	}
+
+	switch strings.ToLower(filepath.Ext(songPath)) {
+	case ".wav":
+		return setChunkFrame(wavFormat, "TCON", genre, songPath)
+	case ".aif", ".aiff":
+		return setChunkFrame(aiffFormat, "TCON", genre, songPath)
+	case ".mp3":
+		return SetMp3Genre(genre, songPath)
+	case ".wma":
+		return errors.New("WMA files are read only.")
+	case ".flac":
+		return errors.New("FLAC files are read only.")
+	}
+	return errors.New("Wrong file format.")
 }
@@ -0,0 +1,185 @@
+// Copyright 2016 Danko Miocevic. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Author: Danko Miocevic
+
+package musicmgr
+
+import (
+	"errors"
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// The normalization rules applied to the tags.
+const (
+	// RuleWhitespace trims and collapses the whitespace.
+	RuleWhitespace = "whitespace"
+	// RuleJunk removes the junk matching the junk patterns,
+	// like "(Official Video)" or "[320kbps]".
+	RuleJunk = "junk"
+	// RuleTitleCase capitalizes the lower case words.
+	RuleTitleCase = "titlecase"
+	// RuleSwap fixes the titles with the "Artist - Title"
+	// format and the fields swapped.
+	RuleSwap = "swap"
+)
+
+// DefaultJunkPatterns are the regular expressions of the
+// junk removed from the tags by default.
+const DefaultJunkPatterns = `(?i)\s*[\(\[](official\s+)?(music\s+)?(video|audio|lyrics?|visualizer)[\)\]];` +
+	`(?i)\s*[\(\[](hd|hq|explicit|\d+\s*kbps)[\)\]]`
+
+// NormalizeRules are the rules applied to the tags read
+// from the music files, the empty rules do nothing.
+type NormalizeRules struct {
+	Rules []string
+	Junk  []*regexp.Regexp
+}
+
+// normalizeRules are the rules applied by GetTags.
+var normalizeRules NormalizeRules
+
+// smallWords are not capitalized by the title case
+// rule unless they are the first word.
+var smallWords = map[string]bool{
+	"a": true, "an": true, "and": true, "as": true, "at": true, "but": true,
+	"by": true, "for": true, "in": true, "of": true, "on": true, "or": true,
+	"the": true, "to": true, "vs": true,
+}
+
+var spaces = regexp.MustCompile(`\s+`)
+
+// NewNormalizeRules returns the rules with the specified
+// names and the junk regular expressions.
+func NewNormalizeRules(rules []string, junk []string) (NormalizeRules, error) {
+	n := NormalizeRules{Rules: rules}
+	for _, rule := range rules {
+		if rule != RuleWhitespace && rule != RuleJunk && rule != RuleTitleCase && rule != RuleSwap {
+			return n, errors.New("Unknown normalization rule " + rule + ".")
+		}
+	}
+
+	for _, p := range junk {
+		re, err := regexp.Compile(p)
+		if err != nil {
+			return n, err
+		}
+		n.Junk = append(n.Junk, re)
+	}
+	return n, nil
+}
+
+// SetNormalizeRules sets the rules applied to the
+// tags when they are read with GetTags.
+func SetNormalizeRules(rules NormalizeRules) {
+	normalizeRules = rules
+}
+
+func (n NormalizeRules) has(rule string) bool {
+	for _, r := range n.Rules {
+		if r == rule {
+			return true
+		}
+	}
+	return false
+}
+
+// Normalize returns the tags after applying the rules,
+// in the order junk, swap, title case and whitespace.
+func (n NormalizeRules) Normalize(tags FileTags) FileTags {
+	if len(n.Rules) < 1 {
+		return tags
+	}
+
+	original := tags
+	fields := []*string{&tags.Title, &tags.Artist, &tags.Album}
+	if n.has(RuleJunk) {
+		for _, f := range fields {
+			for _, re := range n.Junk {
+				*f = re.ReplaceAllString(*f, "")
+			}
+		}
+	}
+
+	if n.has(RuleWhitespace) || n.has(RuleSwap) {
+		for _, f := range fields {
+			*f = strings.TrimSpace(spaces.ReplaceAllString(*f, " "))
+		}
+	}
+
+	if n.has(RuleSwap) {
+		tags = swapFields(tags)
+	}
+
+	// The unknown Artist or Album are not changed,
+	// other parts of MuLi look for them.
+	if n.has(RuleTitleCase) {
+		for _, f := range fields {
+			if *f != "unknown" {
+				*f = titleCase(*f)
+			}
+		}
+	}
+
+	// The fields that were only junk are kept.
+	originals := []string{original.Title, original.Artist, original.Album}
+	for i, f := range fields {
+		if len(*f) < 1 {
+			*f = originals[i]
+		}
+	}
+	return tags
+}
+
+// swapFields fixes the titles with the "Artist - Title"
+// format, with the Artist repeated, missing or swapped
+// with the title.
+func swapFields(tags FileTags) FileTags {
+	items := strings.SplitN(tags.Title, " - ", 2)
+	if len(items) != 2 || len(items[0]) < 1 || len(items[1]) < 1 {
+		return tags
+	}
+
+	switch {
+	case strings.EqualFold(items[0], tags.Artist):
+		tags.Title = items[1]
+	case strings.EqualFold(items[1], tags.Artist):
+		tags.Title = items[0]
+	case tags.Artist == "unknown" || len(tags.Artist) < 1:
+		tags.Artist = items[0]
+		tags.Title = items[1]
+	}
+	return tags
+}
+
+// titleCase capitalizes the words that are
+// all lower case, the others are not changed.
+func titleCase(s string) string {
+	words := strings.Split(s, " ")
+	for i, w := range words {
+		if len(w) < 1 || w != strings.ToLower(w) {
+			continue
+		}
+		if i > 0 && smallWords[w] {
+			continue
+		}
+
+		r, size := utf8.DecodeRuneInString(w)
+		words[i] = string(unicode.ToUpper(r)) + w[size:]
+	}
+	return strings.Join(words, " ")
+}
@@ -0,0 +1,135 @@
+// Copyright 2016 Danko Miocevic. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Author: Danko Miocevic
+
+package musicmgr
+
+import (
+	"errors"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// pathFields are the fields that can be used in the
+// path patterns and the expressions they match.
+var pathFields = map[string]string{
+	"artist": `[^/]+?`,
+	"album":  `[^/]+?`,
+	"title":  `[^/]+?`,
+	"track":  `\d+`,
+	"year":   `\d{4}`,
+}
+
+var pathField = regexp.MustCompile(`\{[a-z]*\}`)
+
+// pathPatterns are the patterns used to read the
+// tags from the path of the files without them,
+// relative to the pathRoot.
+var (
+	pathPatterns []*regexp.Regexp
+	pathRoot     string
+)
+
+// compilePathPattern converts a pattern like
+// "{artist}/{album}/{track} - {title}" to a regular
+// expression matching the end of a path.
+func compilePathPattern(pattern string) (*regexp.Regexp, error) {
+	var expr string
+	last := 0
+	for _, loc := range pathField.FindAllStringIndex(pattern, -1) {
+		name := pattern[loc[0]+1 : loc[1]-1]
+		field, ok := pathFields[name]
+		if !ok {
+			return nil, errors.New("Unknown field {" + name + "} in the path pattern " + pattern + ".")
+		}
+
+		expr += regexp.QuoteMeta(pattern[last:loc[0]]) + "(?P<" + name + ">" + field + ")"
+		last = loc[1]
+	}
+	expr += regexp.QuoteMeta(pattern[last:])
+	return regexp.Compile(`(?:^|/)` + expr + `$`)
+}
+
+// SetPathPatterns sets the patterns used to read the
+// tags from the paths, relative to the source Directory,
+// of the files without tags.
+func SetPathPatterns(root string, patterns []string) error {
+	var compiled []*regexp.Regexp
+	for _, p := range patterns {
+		re, err := compilePathPattern(p)
+		if err != nil {
+			return err
+		}
+		compiled = append(compiled, re)
+	}
+
+	pathPatterns = compiled
+	pathRoot = root
+	return nil
+}
+
+// relativePath returns the path of the file without the
+// extension and relative to the source Directory.
+// Only the name is used for the files dropped in
+// the drop or playlists Directories.
+func relativePath(path string) string {
+	path = strings.TrimSuffix(path, filepath.Ext(path))
+	rel, err := filepath.Rel(pathRoot, path)
+	if err != nil || strings.HasPrefix(rel, "..") ||
+		strings.HasPrefix(rel, "drop/") || strings.HasPrefix(rel, "playlists/") {
+		return filepath.Base(path)
+	}
+	return filepath.ToSlash(rel)
+}
+
+// tagsFromPath fills the tags missing in the file with
+// the fields of the first path pattern that matches.
+// The title is missing when it is the name of the file.
+func tagsFromPath(path string, tags FileTags) FileTags {
+	name := strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	missingTitle := tags.Title == name
+	if len(pathPatterns) < 1 || (!missingTitle && tags.Artist != "unknown" && tags.Album != "unknown") {
+		return tags
+	}
+
+	rel := relativePath(path)
+	for _, re := range pathPatterns {
+		match := re.FindStringSubmatch(rel)
+		if match == nil {
+			continue
+		}
+
+		for i, field := range re.SubexpNames() {
+			value := strings.TrimSpace(match[i])
+			if len(value) < 1 {
+				continue
+			}
+
+			switch {
+			case field == "title" && missingTitle:
+				tags.Title = value
+			case field == "artist" && tags.Artist == "unknown":
+				tags.Artist = value
+			case field == "album" && tags.Album == "unknown":
+				tags.Album = value
+			case field == "year" && len(tags.Year) < 1:
+				tags.Year = value
+			}
+		}
+		return tags
+	}
+	return tags
+}
@@ -0,0 +1,244 @@
+// Copyright 2016 Danko Miocevic. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Author: Danko Miocevic
+
+package musicmgr
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// mp3HeadSize is the amount of bytes read after
+// the ID3v2 tag to find the first MPEG frame.
+const mp3HeadSize = 8192
+
+// mpegBitrates are the bitrates in kbps of the MPEG
+// frames by version (1 or 2/2.5), layer and index.
+var mpegBitrates = [2][3][15]int{
+	{
+		{0, 32, 64, 96, 128, 160, 192, 224, 256, 288, 320, 352, 384, 416, 448},
+		{0, 32, 48, 56, 64, 80, 96, 112, 128, 160, 192, 224, 256, 320, 384},
+		{0, 32, 40, 48, 56, 64, 80, 96, 112, 128, 160, 192, 224, 256, 320},
+	},
+	{
+		{0, 32, 48, 56, 64, 80, 96, 112, 128, 144, 160, 176, 192, 224, 256},
+		{0, 8, 16, 24, 32, 40, 48, 56, 64, 80, 96, 112, 128, 144, 160},
+		{0, 8, 16, 24, 32, 40, 48, 56, 64, 80, 96, 112, 128, 144, 160},
+	},
+}
+
+// mpegSampleRates are the sample rates of the
+// MPEG 1, 2 and 2.5 frames by index.
+var mpegSampleRates = [3][3]int{
+	{44100, 48000, 32000},
+	{22050, 24000, 16000},
+	{11025, 12000, 8000},
+}
+
+// mpegFrame is the information in the
+// header of an MPEG audio frame.
+type mpegFrame struct {
+	Bitrate    int
+	SampleRate int
+	Samples    int
+	Size       int
+}
+
+// parseMpegFrame parses the header of the MPEG
+// frame at the start of the data, the second
+// return value is false if it is not valid.
+func parseMpegFrame(data []byte) (mpegFrame, bool) {
+	if len(data) < 4 || data[0] != 0xff || data[1]&0xe0 != 0xe0 {
+		return mpegFrame{}, false
+	}
+
+	version := (data[1] >> 3) & 3
+	layer := (data[1] >> 1) & 3
+	bitrateIndex := data[2] >> 4
+	rateIndex := (data[2] >> 2) & 3
+	if version == 1 || layer == 0 || bitrateIndex == 0 || bitrateIndex == 15 || rateIndex == 3 {
+		return mpegFrame{}, false
+	}
+
+	// The version 3 is MPEG 1, 2 is MPEG 2 and 0 is MPEG 2.5.
+	v := 0
+	rates := mpegSampleRates[0]
+	if version == 2 {
+		v = 1
+		rates = mpegSampleRates[1]
+	} else if version == 0 {
+		v = 1
+		rates = mpegSampleRates[2]
+	}
+
+	// The layer 3 is Layer I and 1 is Layer III.
+	l := 3 - int(layer)
+	frame := mpegFrame{Bitrate: mpegBitrates[v][l][bitrateIndex], SampleRate: rates[rateIndex]}
+	padding := int(data[2]>>1) & 1
+
+	switch {
+	case l == 0:
+		frame.Samples = 384
+		frame.Size = (12*frame.Bitrate*1000/frame.SampleRate + padding) * 4
+	case l == 2 && v == 1:
+		frame.Samples = 576
+		frame.Size = 72*frame.Bitrate*1000/frame.SampleRate + padding
+	default:
+		frame.Samples = 1152
+		frame.Size = 144*frame.Bitrate*1000/frame.SampleRate + padding
+	}
+	return frame, true
+}
+
+// readMp3Head reads the start of an MP3 file,
+// with the ID3v2 tag and the first MPEG frames.
+// It also returns the size of the file.
+func readMp3Head(path string) ([]byte, int64, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer f.Close()
+
+	fi, err := f.Stat()
+	if err != nil {
+		return nil, 0, err
+	}
+
+	head := make([]byte, 10)
+	n, err := io.ReadFull(f, head)
+	if err != nil && err != io.ErrUnexpectedEOF {
+		return nil, 0, err
+	}
+	head = head[:n]
+
+	data := make([]byte, id3v2Size(head)+mp3HeadSize)
+	copy(data, head)
+	n, err = io.ReadFull(f, data[len(head):])
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return nil, 0, err
+	}
+	return data[:len(head)+n], fi.Size(), nil
+}
+
+// mp3Bitrate returns the bitrate in kbps of an MP3 file,
+// the average bitrate is calculated with the amount of
+// frames in the Xing/Info header for the VBR files.
+func mp3Bitrate(path string) (int, error) {
+	data, size, err := readMp3Head(path)
+	if err != nil {
+		return 0, err
+	}
+
+	start, frame, err := mp3AudioFrame(data)
+	if err != nil {
+		return 0, err
+	}
+	return xingBitrate(data[start:], frame, size-int64(start)), nil
+}
+
+// mp3AudioFrame returns the position and the header
+// of the first valid MPEG frame after the ID3v2 tag.
+func mp3AudioFrame(data []byte) (int, mpegFrame, error) {
+	start := mp3AudioStart(data)
+	for start >= 0 {
+		frame, ok := parseMpegFrame(data[start:])
+		if ok {
+			return start, frame, nil
+		}
+		next := mp3AudioStart(data[start+1:])
+		if next < 0 {
+			break
+		}
+		start += next + 1
+	}
+	return 0, mpegFrame{}, errors.New("MPEG frame not found.")
+}
+
+// xingFrames returns the amount of frames stored in the
+// Xing/Info header of the frame, or 0 if there is none.
+func xingFrames(data []byte, frame mpegFrame) int64 {
+	end := frame.Size
+	if end > len(data) {
+		end = len(data)
+	}
+
+	pos := bytes.Index(data[:end], []byte("Xing"))
+	if pos < 0 {
+		pos = bytes.Index(data[:end], []byte("Info"))
+	}
+	if pos < 0 || pos+12 > len(data) {
+		return 0
+	}
+
+	flags := binary.BigEndian.Uint32(data[pos+4:])
+	if flags&1 == 0 {
+		return 0
+	}
+	return int64(binary.BigEndian.Uint32(data[pos+8:]))
+}
+
+// xingBitrate returns the average bitrate of the file
+// if the frame has a Xing/Info header with the amount
+// of frames, otherwise the bitrate of the frame.
+func xingBitrate(data []byte, frame mpegFrame, audioSize int64) int {
+	frames := xingFrames(data, frame)
+	if frames < 1 {
+		return frame.Bitrate
+	}
+
+	// The bits of the audio divided by its duration.
+	return int(audioSize * 8 * int64(frame.SampleRate) / (frames * int64(frame.Samples) * 1000))
+}
+
+// IsLosslessCodec returns true if the codec
+// stores the audio without losing quality.
+func IsLosslessCodec(codec string) bool {
+	return codec == "pcm" || codec == "flac"
+}
+
+// GetQuality returns the codec and the bitrate in
+// kbps of a music file, the bitrate is empty if it
+// cannot be read or it is not relevant for the codec.
+func GetQuality(path string) (string, string) {
+	var bitrate int
+	var err error
+	var codec string
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".wav", ".aif", ".aiff":
+		return "pcm", ""
+	case ".flac":
+		return "flac", ""
+	case ".wma":
+		codec = "wma"
+		bitrate, err = asfBitrate(path)
+	default:
+		codec = "mp3"
+		bitrate, err = mp3Bitrate(path)
+	}
+
+	if err != nil || bitrate < 1 {
+		return codec, ""
+	}
+	return codec, strconv.Itoa(bitrate)
+}
@@ -0,0 +1,346 @@
+// Copyright 2016 Danko Miocevic. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Author: Danko Miocevic
+
+// Package musicmgr controls the tags in the music files.
+// The tools include tools to read the different Tags in the
+// music files.
+package musicmgr
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// chunkFile describes the container format used by
+// WAV (RIFF) and AIFF (FORM) files.
+// Both formats store the ID3 tag inside a chunk.
+type chunkFile struct {
+	magic string
+	order binary.ByteOrder
+	forms []string
+}
+
+var wavFormat = chunkFile{magic: "RIFF", order: binary.LittleEndian, forms: []string{"WAVE"}}
+var aiffFormat = chunkFile{magic: "FORM", order: binary.BigEndian, forms: []string{"AIFF", "AIFC"}}
+
+// maxID3ChunkSize limits the memory used
+// to read the ID3 chunk.
+const maxID3ChunkSize = 16 * 1024 * 1024
+
+// id3Chunk holds the position of the ID3 chunk
+// inside the container file.
+type id3Chunk struct {
+	offset int64
+	size   int64
+}
+
+// validHeader returns true if the first 12 bytes of
+// the file match the container magic and form type.
+func (c chunkFile) validHeader(header []byte) bool {
+	if len(header) < 12 || string(header[:4]) != c.magic {
+		return false
+	}
+
+	for _, form := range c.forms {
+		if string(header[8:12]) == form {
+			return true
+		}
+	}
+	return false
+}
+
+// complete returns true if the file is as long
+// as the size declared in its header.
+func (c chunkFile) complete(path string) bool {
+	f, err := os.Open(path)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+
+	header := make([]byte, 12)
+	if _, err := io.ReadFull(f, header); err != nil || !c.validHeader(header) {
+		return false
+	}
+
+	info, err := f.Stat()
+	if err != nil {
+		return false
+	}
+	return info.Size() >= int64(c.order.Uint32(header[4:8]))+8
+}
+
+// findID3Chunk walks the chunks in the file and returns the
+// position of the ID3 chunk, the offset will be -1 if the
+// file has no ID3 chunk. The chunks that do not fit in the
+// file or are too big are rejected.
+func (c chunkFile) findID3Chunk(f *os.File) (id3Chunk, error) {
+	info, err := f.Stat()
+	if err != nil {
+		return id3Chunk{}, err
+	}
+
+	header := make([]byte, 12)
+	if _, err := io.ReadFull(f, header); err != nil {
+		return id3Chunk{}, err
+	}
+
+	if !c.validHeader(header) {
+		return id3Chunk{}, errors.New("Wrong file format.")
+	}
+
+	offset := int64(12)
+	chunkHeader := make([]byte, 8)
+	for {
+		if _, err := f.ReadAt(chunkHeader, offset); err != nil {
+			if err == io.EOF {
+				return id3Chunk{offset: -1}, nil
+			}
+			return id3Chunk{}, err
+		}
+
+		id := string(chunkHeader[:4])
+		size := int64(c.order.Uint32(chunkHeader[4:8]))
+		if id == "id3 " || id == "ID3 " {
+			if size > maxID3ChunkSize || offset+8+size > info.Size() {
+				return id3Chunk{}, errors.New("Wrong ID3 chunk size.")
+			}
+			return id3Chunk{offset: offset, size: size}, nil
+		}
+
+		// Chunks are padded to an even size
+		offset += 8 + size + size%2
+	}
+}
+
+// readFrames returns the ID3 frames stored in the file.
+func (c chunkFile) readFrames(path string) ([]id3Frame, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	chunk, err := c.findID3Chunk(f)
+	if err != nil {
+		return nil, err
+	}
+
+	if chunk.offset < 0 {
+		return nil, nil
+	}
+
+	data := make([]byte, chunk.size)
+	if _, err := f.ReadAt(data, chunk.offset+8); err != nil {
+		return nil, err
+	}
+	return parseID3v2(data)
+}
+
+// writeFrames stores the ID3 frames in the file.
+// If the new tag fits inside the existing chunk it is written
+// in place, if the chunk is the last one in the file it is
+// replaced, otherwise the old chunk is marked as JUNK and a
+// new chunk is appended to the file.
+func (c chunkFile) writeFrames(path string, frames []id3Frame) error {
+	f, err := os.OpenFile(path, os.O_RDWR, 0666)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	chunk, err := c.findID3Chunk(f)
+	if err != nil {
+		return err
+	}
+
+	fi, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	end := fi.Size()
+
+	if chunk.offset >= 0 {
+		tag := encodeID3v2(frames, int(chunk.size))
+		if int64(len(tag)) == chunk.size {
+			_, err = f.WriteAt(tag, chunk.offset+8)
+			return err
+		}
+
+		if chunk.offset+8+chunk.size+chunk.size%2 >= end {
+			end = chunk.offset
+		} else {
+			_, err = f.WriteAt([]byte("JUNK"), chunk.offset)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	tag := encodeID3v2(frames, 0)
+	if len(tag)%2 != 0 {
+		tag = append(tag, 0)
+	}
+
+	chunkData := make([]byte, 8, 8+len(tag))
+	if c.magic == "RIFF" {
+		copy(chunkData, "id3 ")
+	} else {
+		copy(chunkData, "ID3 ")
+	}
+	c.order.PutUint32(chunkData[4:8], uint32(len(tag)))
+	chunkData = append(chunkData, tag...)
+
+	if err = f.Truncate(end); err != nil {
+		return err
+	}
+
+	if _, err = f.WriteAt(chunkData, end); err != nil {
+		return err
+	}
+
+	// Update the container size
+	size := make([]byte, 4)
+	c.order.PutUint32(size, uint32(end+int64(len(chunkData))-8))
+	_, err = f.WriteAt(size, 4)
+	return err
+}
+
+// getChunkTags returns a FileTags struct with the information
+// in the ID3 chunk of a WAV or AIFF file.
+// Missing values are completed with the default values
+// and stored on the file, as it happens with MP3 files.
+func getChunkTags(c chunkFile, path string) (error, FileTags) {
+	_, file := filepath.Split(path)
+	extension := filepath.Ext(file)
+	defaultTitle := file[0 : len(file)-len(extension)]
+
+	frames, err := c.readFrames(path)
+	if err != nil {
+		return err, FileTags{Title: defaultTitle, Artist: "unknown", Album: "unknown"}
+	}
+
+	changed := false
+	title := getFrameText(frames, "TIT2")
+	if title == "" || title == "unknown" {
+		title = defaultTitle
+		frames = setFrameText(frames, "TIT2", title)
+		changed = true
+	}
+
+	artist := getFrameText(frames, "TPE1")
+	if artist == "" {
+		artist = "unknown"
+		frames = setFrameText(frames, "TPE1", artist)
+		changed = true
+	}
+
+	album := getFrameText(frames, "TALB")
+	if album == "" {
+		album = "unknown"
+		frames = setFrameText(frames, "TALB", album)
+		changed = true
+	}
+
+	if changed {
+		c.writeFrames(path, frames)
+	}
+
+	genre := normalizeGenre(getFrameText(frames, "TCON"))
+	// ID3v2.4 stores the year in the recording time.
+	year := getFrameText(frames, "TYER")
+	if year == "" {
+		year = getFrameText(frames, "TDRC")
+	}
+	tags := FileTags{Title: title, Artist: artist, Album: album, Genre: genre, Year: year,
+		Composer: getFrameText(frames, "TCOM"), Work: getFrameText(frames, "TIT1"),
+		Conductor: getFrameText(frames, "TPE3"), BPM: ParseBPM(getFrameText(frames, "TBPM")),
+		Key: ParseKey(getFrameText(frames, "TKEY")), Track: ParseTrack(getFrameText(frames, "TRCK")),
+		AlbumArtist: getFrameText(frames, "TPE2")}
+	readMusicBrainzIDs(&tags, frames)
+	return nil, tags
+}
+
+// setChunkTags updates the Artist, Album and Title
+// tags in the ID3 chunk of a WAV or AIFF file.
+func setChunkTags(c chunkFile, artist, album, title, songPath string) error {
+	frames, err := c.readFrames(songPath)
+	if err != nil {
+		return err
+	}
+
+	frames = setFrameText(frames, "TIT2", title)
+	frames = setFrameText(frames, "TPE1", artist)
+	frames = setFrameText(frames, "TALB", album)
+	return c.writeFrames(songPath, frames)
+}
+
+// setChunkTrack updates the track number tag in
+// the ID3 chunk of a WAV or AIFF file.
+func setChunkTrack(c chunkFile, track, songPath string) error {
+	return setChunkFrame(c, "TRCK", track, songPath)
+}
+
+// setChunkFrame updates a text frame in the ID3 chunk of
+// a WAV or AIFF file, an empty text removes the frame.
+func setChunkFrame(c chunkFile, id, text, songPath string) error {
+	frames, err := c.readFrames(songPath)
+	if err != nil {
+		return err
+	}
+
+	if len(text) > 0 {
+		frames = setFrameText(frames, id, text)
+		return c.writeFrames(songPath, frames)
+	}
+
+	var kept []id3Frame
+	for _, f := range frames {
+		if f.id != id {
+			kept = append(kept, f)
+		}
+	}
+	return c.writeFrames(songPath, kept)
+}
+
+// GetWavTags returns a FileTags struct with
+// all the information obtained from the ID3 chunk
+// in the WAV file.
+func GetWavTags(path string) (error, FileTags) {
+	return getChunkTags(wavFormat, path)
+}
+
+// SetWavTags updates the Artist, Album and Title
+// tags with new values in the song WAV file.
+func SetWavTags(artist string, album string, title string, songPath string) error {
+	return setChunkTags(wavFormat, artist, album, title, songPath)
+}
+
+// GetAiffTags returns a FileTags struct with
+// all the information obtained from the ID3 chunk
+// in the AIFF file.
+func GetAiffTags(path string) (error, FileTags) {
+	return getChunkTags(aiffFormat, path)
+}
+
+// SetAiffTags updates the Artist, Album and Title
+// tags with new values in the song AIFF file.
+func SetAiffTags(artist string, album string, title string, songPath string) error {
+	return setChunkTags(aiffFormat, artist, album, title, songPath)
+}
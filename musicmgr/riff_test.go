@@ -0,0 +1,146 @@
+// Copyright 2016 Danko Miocevic. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Author: Danko Miocevic
+
+package musicmgr
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+// testChunks returns a container file with the chunks,
+// every chunk is its id followed by its data.
+func testChunks(c chunkFile, chunks ...string) []byte {
+	var body bytes.Buffer
+	body.WriteString(c.forms[0])
+	for _, chunk := range chunks {
+		body.WriteString(chunk[:4])
+		size := make([]byte, 4)
+		c.order.PutUint32(size, uint32(len(chunk)-4))
+		body.Write(size)
+		body.WriteString(chunk[4:])
+		if len(chunk)%2 != 0 {
+			body.WriteByte(0)
+		}
+	}
+
+	header := []byte(c.magic + "    ")
+	c.order.PutUint32(header[4:8], uint32(body.Len()))
+	return append(header, body.Bytes()...)
+}
+
+// checkContainerSize fails if the size in the header
+// of the container does not match the file.
+func checkContainerSize(t *testing.T, c chunkFile, path string) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if int(c.order.Uint32(data[4:8]))+8 != len(data) {
+		t.Errorf("the container size is %d, the file has %d bytes", c.order.Uint32(data[4:8]), len(data))
+	}
+	if !c.complete(path) {
+		t.Error("the file is not complete")
+	}
+}
+
+func TestChunkTagsRoundTrip(t *testing.T) {
+	for _, test := range []struct {
+		name   string
+		format chunkFile
+	}{{"song.wav", wavFormat}, {"song.aiff", aiffFormat}} {
+		path := writeTestFile(t, test.name, testChunks(test.format, "fmt 0123456789abcdef", "dataaudio"))
+
+		// The missing tags are written with the default values.
+		err, tags := getChunkTags(test.format, path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if tags.Title != "song" || tags.Artist != "unknown" || tags.Album != "unknown" {
+			t.Errorf("%s: wrong default tags %+v", test.name, tags)
+		}
+
+		if err := setChunkTags(test.format, "Some Artist", "Some Album", "Ñandú", path); err != nil {
+			t.Fatal(err)
+		}
+		if err := setChunkTrack(test.format, "3/10", path); err != nil {
+			t.Fatal(err)
+		}
+		err, tags = getChunkTags(test.format, path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if tags.Title != "Ñandú" || tags.Artist != "Some Artist" || tags.Album != "Some Album" || tags.Track != "3" {
+			t.Errorf("%s: wrong tags %+v", test.name, tags)
+		}
+		checkContainerSize(t, test.format, path)
+	}
+}
+
+func TestChunkTagsGrowInTheMiddle(t *testing.T) {
+	tag := encodeID3v2([]id3Frame{newTextFrame("TIT2", "Old")}, 0)
+	path := writeTestFile(t, "song.wav", testChunks(wavFormat, "fmt 0123456789abcdef", "id3 "+string(tag), "dataaudio"))
+
+	long := string(bytes.Repeat([]byte("x"), 200))
+	if err := setChunkFrame(wavFormat, "TIT2", long, path); err != nil {
+		t.Fatal(err)
+	}
+
+	data, _ := ioutil.ReadFile(path)
+	if !bytes.Contains(data, []byte("JUNK")) || !bytes.Contains(data, []byte("data\x05\x00\x00\x00audio")) {
+		t.Error("the old chunk was not kept as JUNK before the audio")
+	}
+	frames, err := wavFormat.readFrames(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if getFrameText(frames, "TIT2") != long {
+		t.Errorf("the title is %q", getFrameText(frames, "TIT2"))
+	}
+	checkContainerSize(t, wavFormat, path)
+
+	// An empty text removes the frame.
+	if err := setChunkFrame(wavFormat, "TIT2", "", path); err != nil {
+		t.Fatal(err)
+	}
+	frames, _ = wavFormat.readFrames(path)
+	if len(frames) != 0 {
+		t.Errorf("the frame was not removed: %v", frames)
+	}
+}
+
+func TestFindID3ChunkRejectsWrongSize(t *testing.T) {
+	data := testChunks(wavFormat, "fmt 0123456789abcdef", "id3 short")
+	// The chunk says it is bigger than the file.
+	binary.LittleEndian.PutUint32(data[len(data)-10:], 1000)
+	path := writeTestFile(t, "song.wav", data)
+
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if _, err := wavFormat.findID3Chunk(f); err == nil {
+		t.Error("the ID3 chunk bigger than the file was accepted")
+	}
+
+	if wavFormat.validHeader(testChunks(aiffFormat)) {
+		t.Error("an AIFF header was accepted as WAV")
+	}
+}
@@ -0,0 +1,110 @@
+// Copyright 2016 Danko Miocevic. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Author: Danko Miocevic
+
+package musicmgr
+
+import (
+	"errors"
+	"os"
+	"sync"
+)
+
+// CachedTags are the tags read from a music file with
+// the modification time (in nanoseconds) and the size
+// the file had, Err is set if they could not be read.
+type CachedTags struct {
+	ModTime int64
+	Size    int64
+	Tags    FileTags
+	Err     string `json:",omitempty"`
+}
+
+// tagCache keeps the tags read from the music files by
+// their path, so the files that did not change since
+// they were read are not parsed again. The used paths
+// are the ones read since the cache was last saved.
+var tagCache = struct {
+	sync.Mutex
+	m    map[string]CachedTags
+	used map[string]bool
+}{m: make(map[string]CachedTags), used: make(map[string]bool)}
+
+// LoadTagCache adds the tags read before, usually
+// stored in the database by the last scan.
+func LoadTagCache(entries map[string]CachedTags) {
+	tagCache.Lock()
+	defer tagCache.Unlock()
+	for path, c := range entries {
+		if _, ok := tagCache.m[path]; !ok {
+			tagCache.m[path] = c
+		}
+	}
+}
+
+// UsedTagCache returns the tags read from the files
+// since the last call, the rest of the cache is dropped
+// so the files that are gone are forgotten.
+func UsedTagCache() map[string]CachedTags {
+	tagCache.Lock()
+	defer tagCache.Unlock()
+
+	used := make(map[string]CachedTags)
+	for path := range tagCache.used {
+		if c, ok := tagCache.m[path]; ok {
+			used[path] = c
+		}
+	}
+	tagCache.m = used
+	tagCache.used = make(map[string]bool)
+
+	entries := make(map[string]CachedTags)
+	for path, c := range used {
+		entries[path] = c
+	}
+	return entries
+}
+
+// cachedRawTags returns the tags of the file from the
+// cache if its modification time and size did not change,
+// otherwise they are read with the reader of its format.
+func cachedRawTags(path string) (error, FileTags) {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return readRawTags(path)
+	}
+
+	tagCache.Lock()
+	c, ok := tagCache.m[path]
+	tagCache.used[path] = true
+	tagCache.Unlock()
+	if ok && c.ModTime == fi.ModTime().UnixNano() && c.Size == fi.Size() {
+		if len(c.Err) > 0 {
+			return errors.New(c.Err), c.Tags
+		}
+		return nil, c.Tags
+	}
+
+	err, tags := readRawTags(path)
+	c = CachedTags{ModTime: fi.ModTime().UnixNano(), Size: fi.Size(), Tags: tags}
+	if err != nil {
+		c.Err = err.Error()
+	}
+
+	tagCache.Lock()
+	tagCache.m[path] = c
+	tagCache.Unlock()
+	return err, tags
+}
@@ -0,0 +1,146 @@
+// Copyright 2016 Danko Miocevic. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Author: Danko Miocevic
+
+package musicmgr
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// tagSidecarExt is the extension added to the path of a
+// music file to get the path of its tags sidecar.
+const tagSidecarExt = ".tags.json"
+
+// tagSidecars is true if the tag changes of the formats
+// MuLi cannot write are stored in sidecar files.
+var tagSidecars bool
+
+// SetTagSidecars sets if the tag changes of the formats
+// that MuLi cannot write and have no tag writer are stored
+// in a sidecar file next to the music file, the tags in
+// the sidecar replace the ones read from the file.
+func SetTagSidecars(enabled bool) {
+	tagSidecars = enabled
+}
+
+// IsTagSidecar returns true if the file in the
+// specified path is the tags sidecar of a music file.
+func IsTagSidecar(path string) bool {
+	return strings.HasSuffix(strings.ToLower(path), tagSidecarExt)
+}
+
+// TagSidecarPath returns the path of the
+// tags sidecar of a music file.
+func TagSidecarPath(songPath string) string {
+	return songPath + tagSidecarExt
+}
+
+// useTagSidecar returns true if the tag changes
+// of the music file go to its sidecar.
+func useTagSidecar(songPath string) bool {
+	if !tagSidecars {
+		return false
+	}
+	if _, ok := tagWriter(songPath); ok {
+		return false
+	}
+
+	switch strings.ToLower(filepath.Ext(songPath)) {
+	case ".mp3", ".wav", ".aif", ".aiff":
+		return false
+	}
+	return true
+}
+
+// readTagSidecar returns the tags stored in the
+// sidecar of a music file by their name.
+func readTagSidecar(songPath string) (map[string]string, error) {
+	data, err := ioutil.ReadFile(TagSidecarPath(songPath))
+	if err != nil {
+		return nil, err
+	}
+
+	tags := make(map[string]string)
+	err = json.Unmarshal(data, &tags)
+	return tags, err
+}
+
+// writeTagSidecar adds the tag changes to the sidecar of
+// a music file, the names are the ones used by the tag
+// writers. The file is replaced once it is written.
+func writeTagSidecar(songPath string, changes map[string]string) error {
+	tags, err := readTagSidecar(songPath)
+	if err != nil {
+		tags = make(map[string]string)
+	}
+	for name, value := range changes {
+		tags[name] = value
+	}
+
+	data, err := json.MarshalIndent(tags, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	path := TagSidecarPath(songPath)
+	err = ioutil.WriteFile(path+".tmp", append(data, '\n'), 0666)
+	if err != nil {
+		return err
+	}
+	return os.Rename(path+".tmp", path)
+}
+
+// applyTagSidecar replaces the tags read from the
+// music file with the ones stored in its sidecar.
+func applyTagSidecar(songPath string, tags FileTags) FileTags {
+	if !tagSidecars {
+		return tags
+	}
+
+	stored, err := readTagSidecar(songPath)
+	if err != nil {
+		return tags
+	}
+
+	fields := map[string]*string{"artist": &tags.Artist, "albumartist": &tags.AlbumArtist,
+		"album": &tags.Album, "title": &tags.Title, "track": &tags.Track, "genre": &tags.Genre}
+	for name, value := range stored {
+		if field, ok := fields[name]; ok {
+			*field = value
+		}
+	}
+	return tags
+}
+
+// MoveTagSidecar moves the sidecar of a music file
+// moved to the new path, if it has one.
+func MoveTagSidecar(oldPath, newPath string) error {
+	err := os.Rename(TagSidecarPath(oldPath), TagSidecarPath(newPath))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
+
+// RemoveTagSidecar removes the sidecar of a
+// removed music file, if it has one.
+func RemoveTagSidecar(songPath string) {
+	os.Remove(TagSidecarPath(songPath))
+}
@@ -0,0 +1,106 @@
+// Copyright 2016 Danko Miocevic. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Author: Danko Miocevic
+
+package musicmgr
+
+import (
+	"errors"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// tagWriters are the external commands that write the
+// tags of the music files indexed by the extension.
+var tagWriters map[string][]string
+
+// ParseTagWriters reads the tag writers, every item is an
+// extension and the command separated by an equal sign,
+// like ".flac=metaflac --set-tag=TITLE={title} {path}".
+func ParseTagWriters(items []string) (map[string][]string, error) {
+	writers := make(map[string][]string)
+	for _, item := range items {
+		eq := strings.Index(item, "=")
+		if eq < 1 {
+			return nil, errors.New("The tag writer must be EXTENSION=COMMAND: " + item)
+		}
+
+		ext := strings.ToLower(strings.TrimSpace(item[:eq]))
+		if ext[0] != '.' {
+			ext = "." + ext
+		}
+
+		command := strings.Fields(item[eq+1:])
+		if len(command) < 1 {
+			return nil, errors.New("There is no command for the tag writer of " + ext)
+		}
+		writers[ext] = command
+	}
+	return writers, nil
+}
+
+// SetTagWriters sets the external commands used to write
+// the tags instead of MuLi for their extensions.
+func SetTagWriters(writers map[string][]string) {
+	tagWriters = writers
+}
+
+// tagWriter returns the external command that writes
+// the tags of the music file, if there is one.
+func tagWriter(songPath string) ([]string, bool) {
+	command, ok := tagWriters[strings.ToLower(filepath.Ext(songPath))]
+	return command, ok
+}
+
+// runTagWriter runs the external command to write the tags.
+// The {artist}, {albumartist}, {album}, {title}, {track}, {genre} and
+// {path} arguments are replaced, the path is the last argument if it
+// is not used. An argument that becomes an option after the
+// replacement, like a title starting with a dash, is rejected.
+func runTagWriter(command []string, tags FileTags, songPath string) error {
+	replacer := strings.NewReplacer("{artist}", tags.Artist, "{albumartist}", tags.AlbumArtist,
+		"{album}", tags.Album, "{title}", tags.Title, "{track}", tags.Track, "{genre}", tags.Genre,
+		"{path}", songPath)
+
+	var args []string
+	hasPath := false
+	for _, arg := range command[1:] {
+		if strings.Contains(arg, "{path}") {
+			hasPath = true
+		}
+		value := replacer.Replace(arg)
+		if strings.HasPrefix(value, "-") && !strings.HasPrefix(arg, "-") {
+			return errors.New("The tag writer argument cannot start with a dash: " + value)
+		}
+		args = append(args, value)
+	}
+	if !hasPath {
+		if strings.HasPrefix(songPath, "-") {
+			return errors.New("The tag writer argument cannot start with a dash: " + songPath)
+		}
+		args = append(args, songPath)
+	}
+
+	out, err := exec.Command(command[0], args...).CombinedOutput()
+	if err != nil {
+		message := "The tag writer failed: " + err.Error()
+		if output := strings.TrimSpace(string(out)); len(output) > 0 {
+			message += ": " + output
+		}
+		return errors.New(message)
+	}
+	return nil
+}
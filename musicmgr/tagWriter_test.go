@@ -0,0 +1,64 @@
+// Copyright 2016 Danko Miocevic. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Author: Danko Miocevic
+
+package musicmgr
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseTagWriters(t *testing.T) {
+	writers, err := ParseTagWriters([]string{"FLAC=metaflac --set-tag=TITLE={title} {path}", ".ogg = vorbiscomment -w"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string][]string{
+		".flac": {"metaflac", "--set-tag=TITLE={title}", "{path}"},
+		".ogg":  {"vorbiscomment", "-w"},
+	}
+	if !reflect.DeepEqual(writers, want) {
+		t.Errorf("ParseTagWriters() = %v, want %v", writers, want)
+	}
+
+	for _, item := range []string{"metaflac", "=metaflac", ".flac=", ".flac=  "} {
+		if _, err := ParseTagWriters([]string{item}); err == nil {
+			t.Errorf("ParseTagWriters(%q) accepted a wrong tag writer", item)
+		}
+	}
+}
+
+func TestRunTagWriter(t *testing.T) {
+	out := filepath.Join(t.TempDir(), "out")
+	command := []string{"sh", "-c", `printf "%s|%s" "$1" "$2" > ` + out, "sh", "{title}", "--artist={artist}"}
+
+	err := runTagWriter(command, FileTags{Title: "Song", Artist: "-Dash"}, "/song.flac")
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, _ := ioutil.ReadFile(out)
+	if string(data) != "Song|--artist=-Dash" {
+		t.Errorf("the tag writer got %q", data)
+	}
+
+	err = runTagWriter(command, FileTags{Title: "--help", Artist: "Some"}, "/song.flac")
+	if err == nil || !strings.Contains(err.Error(), "dash") {
+		t.Errorf("a title starting with a dash was passed as an option: %v", err)
+	}
+}
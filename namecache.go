@@ -0,0 +1,98 @@
+// Copyright 2016 Danko Miocevic. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Author: Danko Miocevic
+
+package main
+
+import (
+	"strings"
+	"sync"
+	"time"
+
+	"bazil.org/fuse"
+)
+
+// nameCacheTime is how long the names of a Directory
+// are used to resolve the case insensitive lookups.
+const nameCacheTime = 10 * time.Second
+
+// cachedNames keeps the names of the entries of a
+// Directory indexed by their exact and lowercase names.
+type cachedNames struct {
+	exact   map[string]bool
+	lower   map[string]string
+	expires time.Time
+}
+
+// nameCache keeps the entries of the Directories listed
+// by the case insensitive lookups, so the names missed
+// do not read the whole Directory every time.
+var nameCache = struct {
+	sync.Mutex
+	m map[string]cachedNames
+}{m: make(map[string]cachedNames)}
+
+// cachedName returns the real name of the entry matching
+// the name without case, the index of the Directory is
+// read with the list function when it is not cached.
+func (d *Dir) cachedName(name string, list func() ([]fuse.Dirent, error)) (string, bool) {
+	key := d.artist + "/" + d.album + "/" + d.folder
+	now := time.Now()
+	nameCache.Lock()
+	c, ok := nameCache.m[key]
+	nameCache.Unlock()
+
+	if !ok || now.After(c.expires) {
+		entries, err := list()
+		if err != nil {
+			return "", false
+		}
+
+		// The first entry wins like in the listing.
+		c = cachedNames{
+			exact:   make(map[string]bool, len(entries)),
+			lower:   make(map[string]string, len(entries)),
+			expires: now.Add(nameCacheTime),
+		}
+		for i := len(entries) - 1; i >= 0; i-- {
+			c.exact[entries[i].Name] = true
+			c.lower[strings.ToLower(entries[i].Name)] = entries[i].Name
+		}
+
+		nameCache.Lock()
+		for k, v := range nameCache.m {
+			if now.After(v.expires) {
+				delete(nameCache.m, k)
+			}
+		}
+		nameCache.m[key] = c
+		nameCache.Unlock()
+	}
+
+	if c.exact[name] {
+		return name, true
+	}
+	realName, ok := c.lower[strings.ToLower(name)]
+	return realName, ok
+}
+
+// forgetNames removes the names of all the Directories
+// from the cache after an entry is created, removed,
+// renamed or filed from the drop Directory.
+func forgetNames() {
+	nameCache.Lock()
+	defer nameCache.Unlock()
+	nameCache.m = make(map[string]cachedNames)
+}
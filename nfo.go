@@ -0,0 +1,192 @@
+// Copyright 2016 Danko Miocevic. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Author: Danko Miocevic
+
+package main
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"github.com/dankomiocevic/mulifs/store"
+	"sort"
+
+	"bazil.org/fuse"
+)
+
+// The read only files shown with the nfo option, the media
+// centers like Kodi and Jellyfin read them when scraping.
+const (
+	artistNfoName = "artist.nfo"
+	albumNfoName  = "album.nfo"
+)
+
+// nfoArtist is the content of the artist.nfo file.
+type nfoArtist struct {
+	XMLName   xml.Name         `xml:"artist"`
+	Name      string           `xml:"name"`
+	MBID      string           `xml:"musicbrainzartistid,omitempty"`
+	Type      string           `xml:"type,omitempty"`
+	Formed    string           `xml:"formed,omitempty"`
+	Biography string           `xml:"biography,omitempty"`
+	Albums    []nfoArtistAlbum `xml:"album"`
+}
+
+// nfoArtistAlbum is an Album in the artist.nfo file.
+type nfoArtistAlbum struct {
+	Title string `xml:"title"`
+}
+
+// nfoAlbum is the content of the album.nfo file.
+type nfoAlbum struct {
+	XMLName     xml.Name   `xml:"album"`
+	Title       string     `xml:"title"`
+	MBID        string     `xml:"musicbrainzalbumid,omitempty"`
+	Artist      string     `xml:"artist"`
+	AlbumArtist string     `xml:"albumartist"`
+	Genres      []string   `xml:"genre"`
+	Year        string     `xml:"year,omitempty"`
+	ReleaseDate string     `xml:"releasedate,omitempty"`
+	Label       string     `xml:"label,omitempty"`
+	Review      string     `xml:"review,omitempty"`
+	Tracks      []nfoTrack `xml:"track"`
+}
+
+// nfoTrack is a Song in the album.nfo file,
+// the duration is written as minutes:seconds.
+type nfoTrack struct {
+	Position int    `xml:"position,omitempty"`
+	Title    string `xml:"title"`
+	Duration string `xml:"duration,omitempty"`
+}
+
+// isNfoFile returns true if the File is the artist.nfo
+// of an Artist or the album.nfo of an Album.
+func (f *File) isNfoFile() bool {
+	if !config_params.nfo || len(f.artist) < 1 || f.isDropped() || f.artist == "playlists" {
+		return false
+	}
+
+	if len(f.album) < 1 {
+		return f.name == artistNfoName
+	}
+	return f.name == albumNfoName && f.album != allSongsDir
+}
+
+// nfoEntries returns the nfo file listed in
+// the Artist or Album Directory.
+func (d *Dir) nfoEntries() []fuse.Dirent {
+	if !config_params.nfo {
+		return nil
+	}
+
+	if d.isAlbumDir() {
+		return []fuse.Dirent{{Name: albumNfoName, Type: fuse.DT_File}}
+	}
+	return []fuse.Dirent{{Name: artistNfoName, Type: fuse.DT_File}}
+}
+
+// nfoContent returns the content of the nfo file.
+func (f *File) nfoContent() []byte {
+	var v interface{}
+	var err error
+	if len(f.album) < 1 {
+		v, err = artistNfo(f.artist)
+	} else {
+		v, err = albumNfo(f.artist, f.album)
+	}
+	if err != nil {
+		return nil
+	}
+
+	data, err := xml.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return nil
+	}
+	return append(append([]byte(xml.Header), data...), '\n')
+}
+
+// artistNfo returns the artist.nfo of an Artist
+// from its description and its Albums.
+func artistNfo(artist string) (nfoArtist, error) {
+	var a store.ArtistStore
+	description, err := store.GetDescription(artist, "", ".description")
+	if err != nil {
+		return nfoArtist{}, err
+	}
+	json.Unmarshal([]byte(description), &a)
+
+	nfo := nfoArtist{Name: a.ArtistName, MBID: a.MusicBrainzID, Type: a.Type, Formed: a.Formed, Biography: a.Bio}
+	albums, err := store.ListAlbums(artist)
+	if err != nil {
+		return nfoArtist{}, err
+	}
+
+	for _, album := range albums {
+		if album.Type != fuse.DT_Dir {
+			continue
+		}
+		_, name, err := store.GetDescriptionNames(artist, album.Name)
+		if err != nil || len(name) < 1 {
+			name = album.Name
+		}
+		nfo.Albums = append(nfo.Albums, nfoArtistAlbum{Title: name})
+	}
+	return nfo, nil
+}
+
+// albumNfo returns the album.nfo of an Album from
+// its description and its Songs sorted by track.
+func albumNfo(artist, album string) (nfoAlbum, error) {
+	var a store.AlbumStore
+	description, err := store.GetDescription(artist, album, ".description")
+	if err != nil {
+		return nfoAlbum{}, err
+	}
+	json.Unmarshal([]byte(description), &a)
+
+	songs, err := store.ListAlbumSongNames(artist, album)
+	if err != nil {
+		return nfoAlbum{}, err
+	}
+
+	sort.SliceStable(songs, func(i, j int) bool {
+		return trackNumber(songs[i].Track) < trackNumber(songs[j].Track)
+	})
+
+	nfo := nfoAlbum{Title: a.AlbumName, MBID: a.MusicBrainzID, ReleaseDate: a.ReleaseDate, Label: a.Label, Review: a.Notes}
+	if name, _, err := store.GetDescriptionNames(artist, ""); err == nil {
+		nfo.Artist = name
+		nfo.AlbumArtist = name
+	}
+
+	genres := make(map[string]bool)
+	for _, s := range songs {
+		if len(nfo.Year) < 1 {
+			nfo.Year = s.Year
+		}
+		if len(s.Genre) > 0 && !genres[s.Genre] {
+			genres[s.Genre] = true
+			nfo.Genres = append(nfo.Genres, s.Genre)
+		}
+
+		t := nfoTrack{Position: trackNumber(s.Track), Title: s.Title}
+		if s.Duration > 0 {
+			t.Duration = fmt.Sprintf("%d:%02d", s.Duration/60, s.Duration%60)
+		}
+		nfo.Tracks = append(nfo.Tracks, t)
+	}
+	return nfo, nil
+}
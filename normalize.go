@@ -0,0 +1,78 @@
+// Copyright 2016 Danko Miocevic. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Author: Danko Miocevic
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"github.com/dankomiocevic/mulifs/musicmgr"
+	"github.com/dankomiocevic/mulifs/tools"
+	"log"
+	"os"
+	"path/filepath"
+)
+
+// setNormalizeRules sets the rules applied
+// to the tags of the music files.
+func setNormalizeRules() error {
+	rules, err := musicmgr.NewNormalizeRules(config_params.normalize, config_params.junk_patterns)
+	if err != nil {
+		return err
+	}
+	musicmgr.SetNormalizeRules(rules)
+	return nil
+}
+
+// runNormalizePreview runs the normalize-preview command,
+// it reports the tags changed by the normalization rules.
+func runNormalizePreview(args []string) {
+	flags := flag.NewFlagSet("normalize-preview", flag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage:\n  %s [global_options] normalize-preview MUSIC_SOURCE\n", progName)
+	}
+	flags.Parse(args)
+
+	if flags.NArg() != 1 {
+		flags.Usage()
+		os.Exit(2)
+	}
+
+	root, err := filepath.Abs(flags.Arg(0))
+	if err != nil {
+		log.Fatal(err)
+		os.Exit(6)
+	}
+
+	err = musicmgr.SetPathPatterns(root, config_params.path_patterns)
+	if err != nil {
+		log.Fatal(err)
+		os.Exit(1)
+	}
+
+	changes, err := tools.NormalizeReport(root)
+	if err != nil {
+		log.Fatal(err)
+		os.Exit(6)
+	}
+
+	for _, c := range changes {
+		fmt.Printf("%s\n", c.Path)
+		fmt.Printf("  %s / %s / %s\n", c.Before.Artist, c.Before.Album, c.Before.Title)
+		fmt.Printf("  %s / %s / %s\n", c.After.Artist, c.After.Album, c.After.Title)
+	}
+	log.Printf("%d files changed by the path patterns and the normalization rules\n", len(changes))
+}
@@ -0,0 +1,255 @@
+// Copyright 2016 Danko Miocevic. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Author: Danko Miocevic
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/dankomiocevic/mulifs/store"
+	"net/http"
+	"net/smtp"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+)
+
+// The prefixes of the notification targets, the ntfy and
+// Gotify targets are the URLs where the messages are
+// posted and the mail targets the recipients.
+const (
+	notifyNtfy   = "ntfy:"
+	notifyGotify = "gotify:"
+	notifyMail   = "mailto:"
+)
+
+// notification is a message sent to the notification
+// targets about the imports and the errors found.
+type notification struct {
+	Title   string
+	Message string
+}
+
+// notifyQueueSize is the number of notifications waiting
+// to be sent, the new ones are discarded when it is full.
+const notifyQueueSize = 64
+
+// notifications are the messages waiting to be sent.
+var notifications = make(chan notification, notifyQueueSize)
+
+// notifyDropDelay is the time without new drops after
+// which the summary of the drops is sent.
+const notifyDropDelay = time.Minute
+
+// dropSummary counts the files dropped since
+// the last summary was sent.
+var dropSummary struct {
+	sync.Mutex
+	filed       int
+	quarantined int
+	timer       *time.Timer
+}
+
+// checkNotifyTargets returns an error if a notification
+// target does not have a known prefix or if the mail
+// targets are used without the smtp_server option.
+func checkNotifyTargets(targets []string, smtpServer string) error {
+	for _, t := range targets {
+		switch {
+		case strings.HasPrefix(t, notifyNtfy), strings.HasPrefix(t, notifyGotify):
+		case strings.HasPrefix(t, notifyMail):
+			if len(smtpServer) < 1 {
+				return errors.New("The mail notifications need the smtp_server option.")
+			}
+		default:
+			return errors.New("Unknown notification target: " + t)
+		}
+	}
+	return nil
+}
+
+// notify queues a notification to be sent to the targets.
+func notify(title, format string, args ...interface{}) {
+	if len(config_params.notify) < 1 {
+		return
+	}
+
+	n := notification{Title: title, Message: fmt.Sprintf(format, args...)}
+	select {
+	case notifications <- n:
+	default:
+		glog.Errorf("Too many notifications, %q discarded.\n", n.Title)
+	}
+}
+
+// notifyDrop counts a dropped file, the summary is sent
+// once no files are dropped for notifyDropDelay.
+func notifyDrop(filed bool) {
+	if len(config_params.notify) < 1 {
+		return
+	}
+
+	dropSummary.Lock()
+	defer dropSummary.Unlock()
+	if filed {
+		dropSummary.filed++
+	} else {
+		dropSummary.quarantined++
+	}
+
+	if dropSummary.timer == nil {
+		dropSummary.timer = time.AfterFunc(notifyDropDelay, sendDropSummary)
+	} else {
+		dropSummary.timer.Reset(notifyDropDelay)
+	}
+}
+
+// sendDropSummary notifies the files filed
+// and quarantined since the last summary.
+func sendDropSummary() {
+	dropSummary.Lock()
+	filed, quarantined := dropSummary.filed, dropSummary.quarantined
+	dropSummary.filed = 0
+	dropSummary.quarantined = 0
+	dropSummary.timer = nil
+	dropSummary.Unlock()
+
+	if quarantined > 0 {
+		notify("Import finished with errors", "%d Songs filed, %d files quarantined in drop/%s.",
+			filed, quarantined, store.QuarantineDir)
+		return
+	}
+	notify("Import finished", "%d Songs filed.", filed)
+}
+
+// notifyScan notifies the end of a scan with the
+// Songs in the Library and the files skipped.
+func notifyScan() {
+	if len(config_params.notify) < 1 {
+		return
+	}
+
+	songs, _ := store.ListSongInfo()
+	report, _ := store.GetScanReport()
+	if len(report.Entries) > 0 {
+		notify("Scan finished with errors", "%d Songs in the Library, %d files skipped, see the %s file.",
+			len(songs), len(report.Entries), reportFileName)
+		return
+	}
+	notify("Scan finished", "%d Songs in the Library.", len(songs))
+}
+
+// sendNotification sends the notification to every
+// target, the errors are logged and not retried.
+func sendNotification(n notification) {
+	for _, t := range config_params.notify {
+		var err error
+		switch {
+		case strings.HasPrefix(t, notifyNtfy):
+			err = sendNtfy(t[len(notifyNtfy):], n)
+		case strings.HasPrefix(t, notifyGotify):
+			err = sendGotify(t[len(notifyGotify):], n)
+		case strings.HasPrefix(t, notifyMail):
+			err = sendMail(t[len(notifyMail):], n)
+		}
+		if err != nil {
+			glog.Errorf("Cannot send the notification %q to %s: %s\n", n.Title, t, err)
+		}
+	}
+}
+
+// postNotification posts the body to the URL of a target.
+func postNotification(req *http.Request) error {
+	resp, err := webhookClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return errors.New("Wrong response from the server: " + resp.Status)
+	}
+	return nil
+}
+
+// sendNtfy publishes the notification in the ntfy topic URL.
+func sendNtfy(topic string, n notification) error {
+	req, err := http.NewRequest("POST", topic, strings.NewReader(n.Message))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Title", n.Title)
+	return postNotification(req)
+}
+
+// sendGotify sends the notification to the message URL
+// of a Gotify server, including the application token.
+func sendGotify(messageURL string, n notification) error {
+	body, err := json.Marshal(map[string]interface{}{"title": n.Title, "message": n.Message, "priority": 5})
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest("POST", messageURL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	return postNotification(req)
+}
+
+// sendMail sends the notification by mail through the
+// smtp_server option, written as [user:password@]host:port.
+func sendMail(to string, n notification) error {
+	server, err := url.Parse("smtp://" + config_params.smtp_server)
+	if err != nil {
+		return err
+	}
+
+	var auth smtp.Auth
+	if server.User != nil {
+		password, _ := server.User.Password()
+		auth = smtp.PlainAuth("", server.User.Username(), password, server.Hostname())
+	}
+
+	from := config_params.smtp_from
+	if len(from) < 1 {
+		from = "mulifs@" + server.Hostname()
+	}
+
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "From: %s\r\nTo: %s\r\nSubject: MuLi: %s\r\n\r\n%s\r\n", from, to, n.Title, n.Message)
+	return smtp.SendMail(server.Host, auth, from, []string{to}, b.Bytes())
+}
+
+// startNotifications sends the queued notifications
+// to the targets in the order they happened.
+func startNotifications() {
+	if len(config_params.notify) < 1 {
+		return
+	}
+
+	go func() {
+		for n := range notifications {
+			sendNotification(n)
+		}
+	}()
+}
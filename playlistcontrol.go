@@ -0,0 +1,144 @@
+// Copyright 2016 Danko Miocevic. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Author: Danko Miocevic
+
+package main
+
+import (
+	"errors"
+	"github.com/dankomiocevic/mulifs/store"
+	"strings"
+
+	"bazil.org/fuse"
+	"github.com/golang/glog"
+)
+
+// playlistControlName is the name of the write only file
+// in the playlists Directory that receives the commands
+// to modify the playlists, one per line:
+//
+//	merge <source> <destination>
+//	copy <source> <new playlist>
+//	dedup <playlist>
+//	folder <folder>
+//	repair
+//	prune
+const playlistControlName = ".control"
+
+// isPlaylistControl returns true if the File is the
+// control file of the playlists Directory.
+func (f *File) isPlaylistControl() bool {
+	return f.artist == "playlists" && len(f.album) < 1 && f.name == playlistControlName
+}
+
+// writeControl writes the data into the
+// commands written to a control file.
+func (fh *FileHandle) writeControl(offset int64, data []byte) int {
+	fh.mu.Lock()
+	defer fh.mu.Unlock()
+	end := offset + int64(len(data))
+	if end > int64(len(fh.control)) {
+		fh.control = append(fh.control, make([]byte, end-int64(len(fh.control)))...)
+	}
+	copy(fh.control[offset:], data)
+	return len(data)
+}
+
+// runControl runs the commands written to the control
+// files, they are discarded once they are run.
+func (fh *FileHandle) runControl(header fuse.Header) error {
+	fh.mu.Lock()
+	commands := string(fh.control)
+	fh.control = nil
+	fh.mu.Unlock()
+
+	for _, line := range strings.Split(commands, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 1 {
+			continue
+		}
+
+		if fh.f.isLibraryControl() {
+			err := runLibraryCommand(fields, fh.f.mPoint)
+			if err != nil {
+				glog.Errorf("Command %q failed: %s\n", line, err)
+				return fuse.EIO
+			}
+			audit(header, fields[0], nil)
+			continue
+		}
+
+		err := runPlaylistCommand(fields, fh.f.mPoint)
+		if err != nil {
+			glog.Errorf("Playlist command %q failed: %s\n", line, err)
+			return fuse.EIO
+		}
+
+		var paths []string
+		for _, name := range fields[1:] {
+			paths = append(paths, "playlists/"+name)
+		}
+		audit(header, "playlist "+fields[0], nil, paths...)
+	}
+	return nil
+}
+
+// runPlaylistCommand runs a command over the playlists.
+func runPlaylistCommand(fields []string, mPoint string) error {
+	switch {
+	case fields[0] == "dedup" && len(fields) == 2:
+		_, err := store.DedupPlaylist(fields[1], mPoint)
+		return err
+	case fields[0] == "folder" && len(fields) == 2:
+		return createPlaylistFolders(fields[1], mPoint)
+	case fields[0] == "repair" && len(fields) == 1:
+		return repairPlaylists(mPoint, false)
+	case fields[0] == "prune" && len(fields) == 1:
+		return repairPlaylists(mPoint, true)
+	case len(fields) != 3:
+		return errors.New("Wrong number of arguments.")
+	}
+
+	src := fields[1]
+	dst := fields[2]
+	switch fields[0] {
+	case "merge":
+		if store.IsAutoPlaylist(dst) {
+			return errors.New("The auto playlists are read only.")
+		}
+
+		err := store.MergePlaylists(src, dst, mPoint)
+		if err != nil {
+			return err
+		}
+		return autoDedup(dst, mPoint)
+	case "copy":
+		_, err := store.CopyPlaylist(src, dst, mPoint)
+		return err
+	}
+	return errors.New("Unknown command.")
+}
+
+// autoDedup removes the duplicated entries of the playlist
+// when the playlist_dedup option is set. The queue can
+// contain the same Song many times and it is not modified.
+func autoDedup(playlist, mPoint string) error {
+	if !config_params.playlist_dedup || store.IsQueue(playlist) {
+		return nil
+	}
+
+	_, err := store.DedupPlaylist(playlist, mPoint)
+	return err
+}
@@ -0,0 +1,185 @@
+// Copyright 2016 Danko Miocevic. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Author: Danko Miocevic
+
+package main
+
+import (
+	"errors"
+	"github.com/dankomiocevic/mulifs/store"
+	"path"
+	"strings"
+
+	"bazil.org/fuse"
+	"bazil.org/fuse/fs"
+	"github.com/golang/glog"
+)
+
+// isPlaylistFolder returns true if the Directory is
+// a folder inside the playlists Directory.
+func (d *Dir) isPlaylistFolder() bool {
+	return d.artist == "playlists" && len(d.album) > 0 && store.IsPlaylistFolder(path.Join(d.folder, d.album))
+}
+
+// playlistFolderPath returns the path of the folder and
+// true if the Directory is the playlists Directory or a
+// folder inside it, the path of the playlists Directory
+// is empty.
+func (d *Dir) playlistFolderPath() (string, bool) {
+	if d.artist != "playlists" {
+		return "", false
+	}
+	if len(d.album) < 1 {
+		return "", true
+	}
+	return path.Join(d.folder, d.album), d.isPlaylistFolder()
+}
+
+// lookupPlaylistFolder returns the sub folder or the
+// playlist with the name inside the folder.
+func (d *Dir) lookupPlaylistFolder(folder, name string) (fs.Node, error) {
+	if !store.IsPlaylistFolder(path.Join(folder, name)) {
+		_, err := store.GetPlaylistPath(name)
+		if err != nil {
+			glog.Info(err)
+			return nil, err
+		}
+		if store.GetPlaylistFolder(name) != folder {
+			return nil, fuse.ENOENT
+		}
+	}
+	return &Dir{fs: d.fs, artist: "playlists", album: name, folder: folder, mPoint: d.mPoint}, nil
+}
+
+// mkdirPlaylist creates a playlist inside the folder, the
+// names of the playlists are unique in every folder and
+// they cannot be the names of the folders.
+func (d *Dir) mkdirPlaylist(folder, name string) (fs.Node, error) {
+	name = store.PlaylistName(name)
+	if _, err := store.GetPlaylistPath(name); err == nil {
+		return nil, fuse.EEXIST
+	}
+	if store.IsPlaylistFolder(name) || store.IsPlaylistFolder(path.Join(folder, name)) {
+		return nil, fuse.EEXIST
+	}
+
+	ret, err := store.CreatePlaylist(name, d.mPoint)
+	if err != nil {
+		glog.Infof("Error creating playlist: %s\n", err)
+		return nil, err
+	}
+
+	if len(folder) > 0 {
+		err = store.MovePlaylist(ret, folder, d.mPoint)
+		if err != nil {
+			glog.Infof("Error moving playlist to %s: %s\n", folder, err)
+			return nil, err
+		}
+	}
+
+	err = store.RegeneratePlaylistFile(ret, d.mPoint)
+	if err != nil {
+		glog.Infof("Error regenerating playlist: %s\n", err)
+		return nil, err
+	}
+	return &Dir{fs: d.fs, artist: "playlists", album: ret, folder: folder, mPoint: d.mPoint}, nil
+}
+
+// mkdirPlaylistFolder turns the empty playlist into a
+// folder and creates a playlist inside it, so the
+// folders are created with mkdir -p.
+func (d *Dir) mkdirPlaylistFolder(name string) (fs.Node, error) {
+	if store.IsAutoPlaylist(d.album) || store.IsQueue(d.album) {
+		return nil, fuse.EPERM
+	}
+
+	files, err := store.GetPlaylistFiles(d.album)
+	if err != nil {
+		return nil, err
+	}
+	if len(files) > 0 || len(store.ListPlaylistDropFiles(d.album, d.mPoint)) > 0 {
+		glog.Infof("The playlist %s is not empty.\n", d.album)
+		return nil, fuse.EPERM
+	}
+
+	folder := path.Join(store.GetPlaylistFolder(d.album), d.album)
+	err = store.DeletePlaylist(d.album, d.mPoint)
+	if err != nil {
+		return nil, err
+	}
+
+	err = createPlaylistFolders(folder, d.mPoint)
+	if err != nil {
+		glog.Infof("Error creating playlist folder: %s\n", err)
+		return nil, err
+	}
+	return d.mkdirPlaylist(folder, name)
+}
+
+// createPlaylistFolders creates the playlist folder
+// and its parent folders that do not exist.
+func createPlaylistFolders(folder, mPoint string) error {
+	folder = store.PlaylistFolderPath(folder)
+	if len(folder) < 1 {
+		return errors.New("Wrong folder name.")
+	}
+
+	var parent string
+	for _, name := range strings.Split(folder, "/") {
+		if !store.IsPlaylistFolder(path.Join(parent, name)) {
+			_, err := store.CreatePlaylistFolder(parent, name, mPoint)
+			if err != nil {
+				return err
+			}
+		}
+		parent = path.Join(parent, name)
+	}
+	return nil
+}
+
+// renamePlaylistEntry moves the playlist or the sub folder
+// with the old name inside the folder to the new folder.
+func (d *Dir) renamePlaylistEntry(folder, oldName, newFolder, newName string) error {
+	if store.IsPlaylistFolder(path.Join(folder, oldName)) {
+		_, err := store.RenamePlaylistFolder(folder, oldName, newFolder, newName, d.mPoint)
+		return err
+	}
+
+	if store.IsPlaylistFolder(path.Join(newFolder, store.PlaylistName(newName))) {
+		return fuse.EEXIST
+	}
+
+	name := oldName
+	if oldName != newName {
+		var err error
+		name, err = store.RenamePlaylist(oldName, newName, d.mPoint)
+		if err != nil {
+			return fuse.EIO
+		}
+	}
+
+	if folder != newFolder {
+		err := store.MovePlaylist(name, newFolder, d.mPoint)
+		if err != nil {
+			return err
+		}
+	}
+
+	err := store.RegeneratePlaylistFile(name, d.mPoint)
+	if err != nil {
+		return fuse.EIO
+	}
+	return nil
+}
@@ -0,0 +1,51 @@
+// Copyright 2016 Danko Miocevic. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Author: Danko Miocevic
+
+package main
+
+import (
+	"github.com/dankomiocevic/mulifs/store"
+
+	"bazil.org/fuse"
+	"github.com/golang/glog"
+)
+
+// playlistInfoName is the name of the editable file inside
+// every playlist Directory with its display name,
+// description and cover image in JSON:
+//
+//	{"Name":"Rock & Roll","Description":"Saturday night","Cover":"/music/covers/rock.jpg"}
+const playlistInfoName = ".playlist.json"
+
+// isPlaylistInfo returns true if the File is the
+// .playlist.json file of a playlist Directory.
+func (f *File) isPlaylistInfo() bool {
+	return f.name == playlistInfoName && f.artist == "playlists" && len(f.album) > 0
+}
+
+// savePlaylistInfo stores the content written
+// to the .playlist.json file of a playlist.
+func (fh *FileHandle) savePlaylistInfo(header fuse.Header, data []byte, changed bool) error {
+	err := store.UpdatePlaylistInfo(fh.f.album, data)
+	if err != nil {
+		glog.Error(err)
+		return fuse.EIO
+	}
+	if changed {
+		audit(header, "edit", nil, entryPath(fh.f.artist, fh.f.album, fh.f.name))
+	}
+	return nil
+}
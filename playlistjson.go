@@ -0,0 +1,119 @@
+// Copyright 2016 Danko Miocevic. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Author: Danko Miocevic
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"github.com/dankomiocevic/mulifs/store"
+	"github.com/dankomiocevic/mulifs/tools"
+	"log"
+	"os"
+	"path/filepath"
+)
+
+// runExportPlaylist runs the export-playlist command, it
+// writes a playlist as JSON identifying its Songs without
+// their paths, to the file or the standard output.
+func runExportPlaylist(db_path string, args []string) {
+	flags := flag.NewFlagSet("export-playlist", flag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage:\n  %s [global_options] export-playlist PLAYLIST [FILE]\n", progName)
+	}
+	flags.Parse(args)
+
+	if flags.NArg() < 1 || flags.NArg() > 2 {
+		flags.Usage()
+		os.Exit(2)
+	}
+
+	err := store.InitDB(db_path)
+	if err != nil {
+		log.Fatal(err)
+		os.Exit(5)
+	}
+
+	playlist, err := tools.ExportPlaylist(flags.Arg(0))
+	if err != nil {
+		log.Fatal(err)
+		os.Exit(24)
+	}
+
+	out := os.Stdout
+	if flags.NArg() > 1 {
+		out, err = os.Create(flags.Arg(1))
+		if err != nil {
+			log.Fatal(err)
+			os.Exit(24)
+		}
+		defer out.Close()
+	}
+
+	err = tools.WritePortablePlaylist(out, playlist)
+	if err != nil {
+		log.Fatal(err)
+		os.Exit(24)
+	}
+	log.Printf("%d Songs exported\n", len(playlist.Entries))
+}
+
+// runImportPlaylist runs the import-playlist command, it creates
+// a playlist from a file written by export-playlist matching its
+// Songs with the ones in the Library.
+func runImportPlaylist(db_path string, args []string) {
+	flags := flag.NewFlagSet("import-playlist", flag.ExitOnError)
+	name := flags.String("name", "", "Name of the playlist, by default the one stored in the file.")
+	flags.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage:\n  %s [global_options] import-playlist [-name NAME] MUSIC_SOURCE FILE\n", progName)
+	}
+	flags.Parse(args)
+
+	if flags.NArg() != 2 {
+		flags.Usage()
+		os.Exit(2)
+	}
+
+	root, err := filepath.Abs(flags.Arg(0))
+	if err != nil {
+		log.Fatal(err)
+		os.Exit(6)
+	}
+
+	f, err := os.Open(flags.Arg(1))
+	if err != nil {
+		log.Fatal(err)
+		os.Exit(25)
+	}
+	defer f.Close()
+
+	err = store.InitDB(db_path)
+	if err != nil {
+		log.Fatal(err)
+		os.Exit(5)
+	}
+
+	playlist, unresolved, err := tools.ImportPlaylist(f, *name, root+"/")
+	if err != nil {
+		log.Fatal(err)
+		os.Exit(25)
+	}
+
+	for _, entry := range unresolved {
+		log.Printf("Song not found: %s\n", entry)
+	}
+	log.Printf("Playlist %s imported, %d Songs not found\n", playlist, len(unresolved))
+}
@@ -0,0 +1,159 @@
+// Copyright 2016 Danko Miocevic. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Author: Danko Miocevic
+
+package playlistmgr
+
+import (
+	"bufio"
+	"errors"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// ExternalEntry is an entry read from a playlist
+// file that was not generated by MuLi.
+// The Artist and Title are only set when the
+// playlist contains them.
+type ExternalEntry struct {
+	Path   string
+	Artist string
+	Title  string
+}
+
+// IsExternalPlaylist returns true if the file
+// is a playlist that can be imported.
+func IsExternalPlaylist(name string) bool {
+	ext := strings.ToLower(filepath.Ext(name))
+	return ext == ".m3u" || ext == ".m3u8" || ext == ".pls"
+}
+
+// ReadExternalPlaylist reads the entries of a M3U or PLS
+// playlist, the relative paths are resolved from the
+// Directory of the playlist.
+func ReadExternalPlaylist(path string) ([]ExternalEntry, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, errors.New("Cannot open playlist file.")
+	}
+	defer file.Close()
+
+	var a []ExternalEntry
+	if strings.ToLower(filepath.Ext(path)) == ".pls" {
+		a, err = readPLS(file)
+	} else {
+		a, err = readM3U(file)
+	}
+
+	dir := filepath.Dir(path)
+	for i := range a {
+		a[i].Path = filepath.FromSlash(strings.Replace(a[i].Path, "\\", "/", -1))
+		if !filepath.IsAbs(a[i].Path) {
+			a[i].Path = filepath.Join(dir, a[i].Path)
+		}
+	}
+	return a, err
+}
+
+// readM3U reads the entries of a M3U playlist, the
+// #EXTINF lines are used to get the Artist and Title.
+func readM3U(file *os.File) ([]ExternalEntry, error) {
+	var a []ExternalEntry
+	var entry ExternalEntry
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(strings.TrimPrefix(scanner.Text(), "\ufeff"))
+		if strings.HasPrefix(line, "#EXTINF:") {
+			info := line[len("#EXTINF:"):]
+			if i := strings.Index(info, ","); i >= 0 {
+				entry.Artist, entry.Title = splitArtistTitle(info[i+1:])
+			}
+			continue
+		}
+
+		if len(line) < 1 || line[0] == '#' {
+			continue
+		}
+
+		entry.Path = line
+		a = append(a, entry)
+		entry = ExternalEntry{}
+	}
+	return a, scanner.Err()
+}
+
+// readPLS reads the entries of a PLS playlist.
+func readPLS(file *os.File) ([]ExternalEntry, error) {
+	entries := make(map[int]*ExternalEntry)
+	var order []int
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		i := strings.Index(line, "=")
+		if i < 0 {
+			continue
+		}
+
+		key := strings.ToLower(line[:i])
+		value := line[i+1:]
+		var field string
+		switch {
+		case strings.HasPrefix(key, "file"):
+			field = "file"
+		case strings.HasPrefix(key, "title"):
+			field = "title"
+		default:
+			continue
+		}
+
+		n, err := strconv.Atoi(key[len(field):])
+		if err != nil {
+			continue
+		}
+
+		entry, ok := entries[n]
+		if !ok {
+			entry = &ExternalEntry{}
+			entries[n] = entry
+			order = append(order, n)
+		}
+
+		if field == "file" {
+			entry.Path = value
+		} else {
+			entry.Artist, entry.Title = splitArtistTitle(value)
+		}
+	}
+
+	var a []ExternalEntry
+	for _, n := range order {
+		if len(entries[n].Path) > 0 {
+			a = append(a, *entries[n])
+		}
+	}
+	return a, scanner.Err()
+}
+
+// splitArtistTitle splits a name in the
+// "Artist - Title" format.
+func splitArtistTitle(name string) (string, string) {
+	items := strings.SplitN(name, " - ", 2)
+	if len(items) < 2 {
+		return "", strings.TrimSpace(name)
+	}
+	return strings.TrimSpace(items[0]), strings.TrimSpace(items[1])
+}
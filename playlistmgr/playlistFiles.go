@@ -24,15 +24,83 @@ import (
 	"fmt"
 	"github.com/golang/glog"
 	"os"
+	"path/filepath"
 	"strings"
 )
 
-// FileTags defines the tags found in a specific music file.
+// The path styles used to write the Songs
+// in the playlist files.
+const (
+	// PathSource uses the absolute path of the
+	// Songs in the source Directory.
+	PathSource = "source"
+	// PathMount uses the absolute path of the
+	// Songs in the mounted filesystem.
+	PathMount = "mount"
+	// PathRelative uses the path of the Songs relative
+	// to the Directory of the playlist file.
+	PathRelative = "relative"
+)
+
+var pathConfig struct {
+	Style      string
+	Mountpoint string
+	RewriteOld string
+	RewriteNew string
+}
+
+// SetPathStyle sets how the paths of the Songs are written
+// in the playlist files, the mountpoint is used by the
+// mount style.
+func SetPathStyle(style, mountpoint string) error {
+	if style != PathSource && style != PathMount && style != PathRelative {
+		return errors.New("Unknown path style " + style + ".")
+	}
+
+	pathConfig.Style = style
+	pathConfig.Mountpoint = mountpoint
+	return nil
+}
+
+// SetPathRewrite replaces the old prefix of the paths written
+// in the playlist files with the new one, so the playlists
+// work on devices that see the Library at a different root.
+func SetPathRewrite(oldPrefix, newPrefix string) {
+	pathConfig.RewriteOld = oldPrefix
+	pathConfig.RewriteNew = newPrefix
+}
+
+// playlistPath returns the path written in the playlist
+// file stored in dir for a Song stored in the source Directory.
+func playlistPath(path, dir, mPoint string) string {
+	switch pathConfig.Style {
+	case PathMount:
+		if strings.HasPrefix(path, mPoint) {
+			path = filepath.Join(pathConfig.Mountpoint, path[len(mPoint):])
+		}
+	case PathRelative:
+		rel, err := filepath.Rel(dir, path)
+		if err == nil {
+			path = rel
+		}
+	}
+
+	if len(pathConfig.RewriteOld) > 0 && strings.HasPrefix(path, pathConfig.RewriteOld) {
+		path = pathConfig.RewriteNew + path[len(pathConfig.RewriteOld):]
+	}
+	return path
+}
+
+// PlaylistFile defines a Song inside a playlist, the Song is
+// referenced by its Artist, Album and name in MuLi and by its
+// MusicBrainz identifier when it is known. The Path is the
+// path of the file when the entry was resolved.
 type PlaylistFile struct {
-	Title  string
-	Artist string
-	Album  string
-	Path   string
+	Title         string
+	Artist        string
+	Album         string
+	Path          string
+	MusicBrainzID string `json:",omitempty"`
 }
 
 // CheckPlaylistFile opens a Playlist file and checks that
@@ -97,18 +165,22 @@ func ProcessPlaylist(path string) ([]PlaylistFile, error) {
 }
 
 // DeletePlaylist deletes a playlist from the filesystem.
+// The playlist is the name of its file relative to the
+// playlists Directory, with its folder if it has one.
 func DeletePlaylist(playlist, mPoint string) error {
 	if mPoint[len(mPoint)-1] != '/' {
 		mPoint = mPoint + "/"
 	}
 
-	path := mPoint + "playlists/" + playlist
+	// The temporary drop Directory is named
+	// after the playlist in every folder.
+	path := mPoint + "playlists/" + filepath.Base(playlist)
 	src, err := os.Stat(path)
 	if err == nil && src.IsDir() {
 		os.Remove(path)
 	}
 
-	path = path + ".m3u"
+	path = mPoint + "playlists/" + playlist + ".m3u"
 	_, err = os.Stat(path)
 	if err == nil {
 		os.Remove(path)
@@ -118,20 +190,21 @@ func DeletePlaylist(playlist, mPoint string) error {
 }
 
 // RegeneratePlaylistFile creates the playlist file from the
-// information in the database.
+// information in the database, the playlist is the name of
+// the file relative to the playlists Directory.
 func RegeneratePlaylistFile(songs []PlaylistFile, playlist, mPoint string) error {
 	glog.Infof("Regenerating playlist file for playlist: %s\n", playlist)
 	if mPoint[len(mPoint)-1] != '/' {
 		mPoint = mPoint + "/"
 	}
 
-	_, err := os.Stat(mPoint + "playlists")
+	path := mPoint + "playlists/" + playlist + ".m3u"
+	dir := filepath.Dir(path)
+	_, err := os.Stat(dir)
 	if err != nil {
-		os.Mkdir(mPoint+"playlists/", 0777)
+		os.MkdirAll(dir, 0777)
 	}
 
-	path := mPoint + "playlists/" + playlist + ".m3u"
-
 	_, err = os.Stat(path)
 	if err == nil {
 		os.Remove(path)
@@ -179,7 +252,7 @@ func RegeneratePlaylistFile(songs []PlaylistFile, playlist, mPoint string) error
 		if err != nil {
 			glog.Infof("Cannot write on file.")
 		}
-		_, err = f.WriteString(s.Path)
+		_, err = f.WriteString(playlistPath(s.Path, dir, mPoint))
 		if err != nil {
 			glog.Infof("Cannot write on file.")
 		}
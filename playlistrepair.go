@@ -0,0 +1,140 @@
+// Copyright 2016 Danko Miocevic. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Author: Danko Miocevic
+
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"github.com/dankomiocevic/mulifs/store"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// repairState is the result of the last repair of the
+// playlists, it is shown in the status file.
+type repairState struct {
+	mu       sync.Mutex
+	finished time.Time
+	reports  []store.PlaylistRepair
+	err      error
+}
+
+var repairer repairState
+
+// repairReport returns the lines that describe
+// the entries fixed and missing in the playlists.
+func repairReport(reports []store.PlaylistRepair) []byte {
+	var b bytes.Buffer
+	for _, r := range reports {
+		if len(r.Fixed) < 1 && len(r.Missing) < 1 {
+			continue
+		}
+
+		removed := ""
+		if r.Removed && len(r.Missing) > 0 {
+			removed = " (removed)"
+		}
+		fmt.Fprintf(&b, "Playlist %s: %d fixed, %d missing%s\n", r.Playlist, len(r.Fixed), len(r.Missing), removed)
+		for _, f := range r.Fixed {
+			fmt.Fprintf(&b, "  fixed %s\n", f)
+		}
+		for _, m := range r.Missing {
+			fmt.Fprintf(&b, "  missing %s\n", m)
+		}
+	}
+	return b.Bytes()
+}
+
+// repairStatus returns the lines of the status file
+// about the last repair of the playlists, if any.
+func repairStatus() []byte {
+	repairer.mu.Lock()
+	defer repairer.mu.Unlock()
+
+	var b bytes.Buffer
+	switch {
+	case repairer.finished.IsZero():
+		return nil
+	case repairer.err != nil:
+		fmt.Fprintf(&b, "Playlist repair: failed at %s: %s\n", repairer.finished.Format(time.RFC3339), repairer.err)
+	default:
+		fmt.Fprintf(&b, "Playlist repair: finished at %s, %d playlists repaired\n",
+			repairer.finished.Format(time.RFC3339), len(repairer.reports))
+	}
+	b.Write(repairReport(repairer.reports))
+	return b.Bytes()
+}
+
+// repairPlaylists repairs every playlist and keeps
+// the result to show it in the status file.
+func repairPlaylists(mPoint string, prune bool) error {
+	reports, err := store.RepairPlaylists(mPoint, prune)
+
+	repairer.mu.Lock()
+	repairer.finished = time.Now()
+	repairer.reports = reports
+	repairer.err = err
+	repairer.mu.Unlock()
+	return err
+}
+
+// runRepairPlaylists runs the repair-playlists command, it
+// resolves the entries of every playlist again, writes the
+// playlist files and reports the entries fixed and missing.
+func runRepairPlaylists(db_path string, args []string) {
+	flags := flag.NewFlagSet("repair-playlists", flag.ExitOnError)
+	prune := flags.Bool("prune", false, "Remove the entries whose Songs do not exist.")
+	flags.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage:\n  %s [global_options] repair-playlists [-prune] MUSIC_SOURCE\n", progName)
+	}
+	flags.Parse(args)
+
+	if flags.NArg() != 1 {
+		flags.Usage()
+		os.Exit(2)
+	}
+
+	root, err := filepath.Abs(flags.Arg(0))
+	if err != nil {
+		log.Fatal(err)
+		os.Exit(6)
+	}
+
+	err = store.InitDB(db_path)
+	if err != nil {
+		log.Fatal(err)
+		os.Exit(5)
+	}
+
+	reports, err := store.RepairPlaylists(root+"/", *prune)
+	os.Stdout.Write(repairReport(reports))
+	if err != nil {
+		log.Fatal(err)
+		os.Exit(21)
+	}
+
+	var fixed, missing int
+	for _, r := range reports {
+		fixed += len(r.Fixed)
+		missing += len(r.Missing)
+	}
+	log.Printf("%d playlists repaired, %d entries fixed and %d missing\n", len(reports), fixed, missing)
+}
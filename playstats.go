@@ -0,0 +1,71 @@
+// Copyright 2016 Danko Miocevic. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Author: Danko Miocevic
+
+package main
+
+import (
+	"github.com/dankomiocevic/mulifs/store"
+
+	"github.com/golang/glog"
+)
+
+// trackRead records the end of the data read from
+// the Song to know if it was played completely.
+func (fh *FileHandle) trackRead(offset int64, n int) {
+	fh.mu.Lock()
+	if end := offset + int64(n); end > fh.readEnd {
+		fh.readEnd = end
+	}
+	fh.mu.Unlock()
+}
+
+// fullyRead returns true if the whole Song was read
+// through the handle and it was not modified.
+func (fh *FileHandle) fullyRead() bool {
+	info, err := fh.r.Stat()
+	if err != nil || info.Size() < 1 {
+		return false
+	}
+
+	size := info.Size()
+	if fh.track != nil {
+		size = fh.track.Size()
+	}
+
+	fh.mu.Lock()
+	defer fh.mu.Unlock()
+	return !fh.dirty && fh.readEnd >= size
+}
+
+// recordPlay stores a play of the Song in the
+// statistics if it was read completely.
+// It must be called before the handle is closed.
+func (fh *FileHandle) recordPlay() {
+	if !fh.fullyRead() {
+		return
+	}
+
+	song := store.SongRef{Artist: fh.f.artist, Album: fh.f.album, Song: fh.f.name}
+	err := store.RecordPlay(song)
+	if err != nil {
+		glog.Errorf("Cannot record the play of %s: %s\n", fh.f.name, err)
+		return
+	}
+
+	if config_params.most_played > 0 {
+		scheduleAutoPlaylists(fh.f.mPoint)
+	}
+}
@@ -0,0 +1,246 @@
+// Copyright 2016 Danko Miocevic. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Author: Danko Miocevic
+
+package main
+
+import (
+	"fmt"
+	"github.com/dankomiocevic/mulifs/metadata"
+	"github.com/dankomiocevic/mulifs/store"
+	"hash/fnv"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"bazil.org/fuse"
+	"bazil.org/fuse/fs"
+	"github.com/golang/glog"
+	"golang.org/x/net/context"
+)
+
+// podcastsDir is the name of the podcasts view and of
+// the Directory where the episodes are downloaded.
+const podcastsDir = "podcasts"
+
+// unplayedDir is the Directory in the podcasts
+// view with the episodes not listened yet.
+const unplayedDir = "_unplayed"
+
+// podcastDownloadTimeout limits the time
+// used to download every podcast.
+const podcastDownloadTimeout = time.Hour
+
+// registerPodcastsView adds the podcasts view to the
+// root Directory when there are podcast feeds.
+func registerPodcastsView() {
+	if len(config_params.podcast_feeds) > 0 {
+		views[podcastsDir] = view{list: listPodcastsView, lookup: lookupPodcastsView}
+	}
+}
+
+// episodeFile returns the read only File
+// node for an episode of a podcast.
+func episodeFile(d *Dir, podcast, name string) (fs.Node, error) {
+	_, err := store.GetEpisodePath(podcast, name)
+	if err != nil {
+		return nil, fuse.ENOENT
+	}
+	return &File{artist: podcast, song: name, name: name, mPoint: d.mPoint, policy: policyEpisode}, nil
+}
+
+// listPodcastsView lists the podcasts, the episodes
+// of one of them or the episodes not listened.
+func listPodcastsView(ctx context.Context, d *Dir) ([]fuse.Dirent, error) {
+	if len(d.album) < 1 {
+		a, err := store.ListPodcasts()
+		if err != nil {
+			return nil, fuse.EIO
+		}
+		return append(a, fuse.Dirent{Name: unplayedDir, Type: fuse.DT_Dir}), nil
+	}
+
+	if d.album != unplayedDir {
+		a, err := store.ListEpisodes(d.album, false)
+		if err != nil {
+			return nil, fuse.ENOENT
+		}
+		return a, nil
+	}
+
+	podcasts, err := store.ListPodcasts()
+	if err != nil {
+		return nil, fuse.EIO
+	}
+
+	var a []fuse.Dirent
+	for _, p := range podcasts {
+		episodes, _ := store.ListEpisodes(p.Name, true)
+		for _, e := range episodes {
+			a = append(a, fuse.Dirent{Name: p.Name + " - " + e.Name, Type: fuse.DT_File})
+		}
+	}
+	return a, nil
+}
+
+// lookupPodcastsView returns the podcast Directories
+// and the episodes in the podcasts view.
+func lookupPodcastsView(ctx context.Context, d *Dir, name string) (fs.Node, error) {
+	if len(d.album) < 1 {
+		if name != unplayedDir {
+			if _, err := store.ListEpisodes(name, false); err != nil {
+				return nil, fuse.ENOENT
+			}
+		}
+		return &Dir{fs: d.fs, artist: d.artist, album: name, mPoint: d.mPoint}, nil
+	}
+
+	if d.album != unplayedDir {
+		return episodeFile(d, d.album, name)
+	}
+
+	items := strings.SplitN(name, " - ", 2)
+	if len(items) != 2 {
+		return nil, fuse.ENOENT
+	}
+	return episodeFile(d, items[0], items[1])
+}
+
+// markListened marks the episode as listened
+// if it was read completely.
+// It must be called before the handle is closed.
+func (fh *FileHandle) markListened() {
+	if !fh.fullyRead() {
+		return
+	}
+
+	err := store.SetEpisodeListened(fh.f.artist, fh.f.name)
+	if err != nil {
+		glog.Errorf("Cannot mark %s as listened: %s\n", fh.f.name, err)
+	}
+}
+
+// episodeName returns the name of the file of an
+// episode, the date first to sort them in order.
+// The hash of the GUID is added to the title, so the
+// episodes published the same day with the same title
+// do not replace each other.
+func episodeName(episode metadata.Episode) string {
+	ext := ".mp3"
+	if u, err := url.Parse(episode.URL); err == nil {
+		e := strings.ToLower(filepath.Ext(u.Path))
+		if len(e) > 1 && len(e) < 6 {
+			ext = e
+		}
+	}
+
+	h := fnv.New32a()
+	h.Write([]byte(episode.GUID))
+	name := fmt.Sprintf("%s_%08x", store.GetCompatibleString(episode.Title), h.Sum32())
+	if !episode.Published.IsZero() {
+		name = episode.Published.Format("2006-01-02") + "_" + name
+	}
+	return name + ext
+}
+
+// fetchPodcast downloads the latest episodes of a
+// podcast that were not downloaded before.
+// An episode that cannot be downloaded is tried again
+// the next time, the other episodes are downloaded.
+func fetchPodcast(feed, mPoint string) error {
+	ctx, cancel := context.WithTimeout(stopCtx, podcastDownloadTimeout)
+	defer cancel()
+
+	podcast, err := metadata.FetchPodcast(ctx, feed)
+	if err != nil {
+		return err
+	}
+
+	name, err := store.StorePodcast(podcast.Title, feed)
+	if err != nil {
+		return err
+	}
+
+	dir := filepath.Join(mPoint, podcastsDir, name)
+	err = os.MkdirAll(dir, 0777)
+	if err != nil {
+		return err
+	}
+
+	episodes := podcast.Episodes
+	if len(episodes) > config_params.podcast_episodes {
+		episodes = episodes[:config_params.podcast_episodes]
+	}
+
+	failed := 0
+	for _, episode := range episodes {
+		if store.HasEpisode(name, episode.GUID) {
+			continue
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		fileName := episodeName(episode)
+		path := filepath.Join(dir, fileName)
+		glog.Infof("Downloading %s to %s\n", episode.URL, path)
+		err = metadata.DownloadEpisode(ctx, episode, path)
+		if err != nil {
+			glog.Errorf("Cannot download the episode %s: %s\n", episode.URL, err)
+			failed++
+			continue
+		}
+
+		err = store.StoreEpisode(name, fileName, store.EpisodeStore{
+			Title:     episode.Title,
+			GUID:      episode.GUID,
+			URL:       episode.URL,
+			Published: episode.Published,
+			Path:      path,
+		})
+		if err != nil {
+			glog.Errorf("Cannot store the episode %s: %s\n", episode.URL, err)
+			failed++
+		}
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("%d episodes cannot be downloaded.", failed)
+	}
+	return nil
+}
+
+// startPodcasts downloads the new episodes of the
+// podcasts in background every podcast_interval hours,
+// inside the maintenance window.
+func startPodcasts(mPoint string) {
+	if len(config_params.podcast_feeds) < 1 {
+		return
+	}
+
+	go func() {
+		for waitMaintenance() {
+			for _, feed := range config_params.podcast_feeds {
+				err := fetchPodcast(feed, mPoint)
+				if err != nil {
+					glog.Errorf("Cannot fetch the podcast %s: %s\n", feed, err)
+				}
+			}
+			time.Sleep(time.Duration(config_params.podcast_interval) * time.Hour)
+		}
+	}()
+}
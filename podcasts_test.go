@@ -0,0 +1,82 @@
+// Copyright 2016 Danko Miocevic. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Author: Danko Miocevic
+
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/dankomiocevic/mulifs/metadata"
+	"github.com/dankomiocevic/mulifs/store"
+)
+
+func TestEpisodeNameKeepsSameTitles(t *testing.T) {
+	published := time.Date(2016, 5, 2, 10, 0, 0, 0, time.UTC)
+	a := episodeName(metadata.Episode{GUID: "1", Title: "News", URL: "http://example.com/a.ogg", Published: published})
+	b := episodeName(metadata.Episode{GUID: "2", Title: "News", URL: "http://example.com/b.ogg", Published: published})
+	if a == b {
+		t.Fatalf("two episodes are named %s", a)
+	}
+	if filepath.Ext(a) != ".ogg" || a[:11] != "2016-05-02_" {
+		t.Errorf("wrong episode name %s", a)
+	}
+}
+
+func TestFetchPodcastSkipsFailedEpisodes(t *testing.T) {
+	root := testLibrary(t)
+	old := config_params.podcast_episodes
+	config_params.podcast_episodes = 5
+	defer func() { config_params.podcast_episodes = old }()
+
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/feed.xml":
+			fmt.Fprintf(w, `<rss><channel><title>Show</title>
+<item><title>Broken</title><guid>1</guid><pubDate>Tue, 03 May 2016 10:00:00 +0000</pubDate><enclosure url="%s/broken.mp3"/></item>
+<item><title>Good</title><guid>2</guid><pubDate>Mon, 02 May 2016 10:00:00 +0000</pubDate><enclosure url="%s/good.mp3"/></item>
+</channel></rss>`, server.URL, server.URL)
+		case "/good.mp3":
+			w.Write([]byte("episode"))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	if err := fetchPodcast(server.URL+"/feed.xml", root); err == nil {
+		t.Error("the failed episode was not reported")
+	}
+
+	name := store.GetCompatibleString("Show")
+	if !store.HasEpisode(name, "2") {
+		t.Error("the episode after the failed one was not downloaded")
+	}
+	if store.HasEpisode(name, "1") {
+		t.Error("the failed episode was stored")
+	}
+
+	files, _ := ioutil.ReadDir(filepath.Join(root, podcastsDir, name))
+	if len(files) != 1 {
+		t.Errorf("%d files downloaded, want 1", len(files))
+	}
+}
@@ -0,0 +1,303 @@
+// Copyright 2016 Danko Miocevic. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Author: Danko Miocevic
+
+package main
+
+import (
+	"github.com/dankomiocevic/mulifs/musicmgr"
+	"github.com/dankomiocevic/mulifs/store"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"syscall"
+
+	"bazil.org/fuse"
+)
+
+// filePolicy defines what happens with the files that
+// are not music files when they are created in MuLi.
+type filePolicy int
+
+const (
+	// policyNone is used for the regular files.
+	policyNone filePolicy = iota
+	// policyReject does not allow to create the file.
+	policyReject
+	// policyAbsorb accepts the file but discards it.
+	policyAbsorb
+	// policyPassthrough stores the file as it is in the
+	// source Directory of the Album.
+	policyPassthrough
+	// policyExtra is used for the read only extra files
+	// found next to the music files when scanning.
+	policyExtra
+	// policyArtwork is used for the read only cover
+	// images found next to the music files when scanning.
+	policyArtwork
+	// policyArtistImage is used for the read only
+	// image shown in the Artist Directories.
+	policyArtistImage
+	// policyEpisode is used for the read only
+	// episodes of the podcasts.
+	policyEpisode
+	// policySnapshot is used for the read only
+	// Songs inside the snapshots of the index.
+	policySnapshot
+	// policyCrate is used for the read only
+	// Songs inside the crates.
+	policyCrate
+)
+
+// defaultArtworkFiles are the cover images shown
+// inside the Album Directories by default.
+const defaultArtworkFiles = "folder.jpg;folder.png;cover.jpg;cover.png;front.jpg;front.png"
+
+// defaultArtistFiles are the Artist images
+// found when scanning by default.
+const defaultArtistFiles = "artist.jpg;artist.png"
+
+// defaultMusicExtensions are the extensions of
+// the music files recognized by default.
+const defaultMusicExtensions = "mp3;wav;aif;aiff;wma;flac"
+
+// defaultAbsorbFiles are the files silently discarded by
+// default, they are created by macOS clients.
+const defaultAbsorbFiles = ".DS_Store;._*"
+
+// The modes to remove the Artist and Album Directories.
+const (
+	// rmdirRefuse only removes the empty Directories.
+	rmdirRefuse = "refuse"
+	// rmdirVirtual removes the Songs from MuLi
+	// but keeps their files.
+	rmdirVirtual = "virtual"
+	// rmdirDelete also removes the files of the Songs.
+	rmdirDelete = "delete"
+	// rmdirTrash moves the files of the Songs
+	// to the trash Directory.
+	rmdirTrash = "trash"
+)
+
+// deleteMode returns what happens with the files of
+// the Songs inside the Directories removed, with the
+// library_only option the files are always kept.
+func deleteMode() store.DeleteMode {
+	if config_params.library_only {
+		return store.DeleteVirtual
+	}
+
+	switch config_params.rmdir {
+	case rmdirDelete:
+		return store.DeleteFiles
+	case rmdirTrash:
+		return store.DeleteTrash
+	}
+	return store.DeleteVirtual
+}
+
+// checkRmdir returns an error if the Artist or Album
+// Directory inside d cannot be removed, with the refuse
+// mode only the empty Directories are removed.
+func (d *Dir) checkRmdir(name string) error {
+	if config_params.rmdir != rmdirRefuse {
+		return nil
+	}
+
+	empty := fuse.Errno(syscall.ENOTEMPTY)
+	if len(d.artist) > 0 {
+		songs, err := store.ListAlbumSongNames(d.artist, name)
+		if err == nil && len(songs) > 0 {
+			return empty
+		}
+		return nil
+	}
+
+	if _, err := store.GetArtistPath(name); err != nil {
+		return nil
+	}
+
+	albums, _ := store.ListAlbums(name)
+	for _, a := range albums {
+		if a.Type == fuse.DT_Dir {
+			return empty
+		}
+	}
+	return nil
+}
+
+// parsePatterns splits a list of glob patterns
+// separated by semicolons.
+func parsePatterns(list string) []string {
+	var patterns []string
+	for _, p := range strings.Split(list, ";") {
+		p = strings.TrimSpace(p)
+		if len(p) > 0 {
+			patterns = append(patterns, p)
+		}
+	}
+	return patterns
+}
+
+// matchPatterns returns true if the name matches
+// any of the glob patterns.
+func matchPatterns(patterns []string, name string) bool {
+	for _, p := range patterns {
+		if ok, _ := filepath.Match(p, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// getFilePolicy returns the policy to apply to a
+// file name based on the configured patterns.
+// The special MuLi files are never affected.
+func getFilePolicy(name string) filePolicy {
+	if name == ".description" || name == albumPlaylistName || name == tracksFileName {
+		return policyNone
+	}
+
+	if matchPatterns(config_params.absorb_files, name) {
+		return policyAbsorb
+	}
+
+	if musicmgr.IsMusicFile(name) {
+		return policyNone
+	}
+
+	if matchPatterns(config_params.passthrough_files, name) {
+		return policyPassthrough
+	}
+	return policyReject
+}
+
+// entryPolicy returns the policy of a name inside the
+// Directory. The Artists, the Albums and the playlists
+// are not files, the patterns do not apply to them.
+func (d *Dir) entryPolicy(name string) filePolicy {
+	policy := getFilePolicy(name)
+	if (policy == policyAbsorb || policy == policyPassthrough) && d.isDirEntry(name) {
+		return policyNone
+	}
+	return policy
+}
+
+// isDirEntry returns true if the name is an Artist, an
+// Album, a playlist or a playlist folder inside the Directory.
+func (d *Dir) isDirEntry(name string) bool {
+	if d.isView() || isDropName(d.artist) {
+		return false
+	}
+	if folder, ok := d.playlistFolderPath(); ok {
+		if store.IsPlaylistFolder(path.Join(folder, name)) {
+			return true
+		}
+		_, err := store.GetPlaylistPath(name)
+		return err == nil
+	}
+	if d.artist == "playlists" {
+		return false
+	}
+
+	var err error
+	if len(d.artist) < 1 {
+		_, err = store.GetArtistPath(name)
+	} else if len(d.album) < 1 {
+		_, err = store.GetAlbumPath(d.artist, name)
+	} else {
+		return false
+	}
+	return err == nil
+}
+
+// isSidecar returns true if the File is a read only
+// file found next to the music files when scanning
+// or a podcast episode or a Song in a snapshot or a crate.
+func (f *File) isSidecar() bool {
+	return f.policy == policyExtra || f.policy == policyArtwork || f.policy == policyArtistImage || f.policy == policyEpisode ||
+		f.policy == policySnapshot || f.policy == policyCrate
+}
+
+// isArtistDir returns true if the Directory is a
+// real Artist Directory.
+func (d *Dir) isArtistDir() bool {
+	if len(d.artist) < 1 || len(d.album) > 0 || d.isView() {
+		return false
+	}
+	return !isDropName(d.artist) && d.artist != "playlists"
+}
+
+// isAlbumDir returns true if the Directory is a
+// real Album Directory.
+func (d *Dir) isAlbumDir() bool {
+	if len(d.artist) < 1 || len(d.album) < 1 || d.isView() {
+		return false
+	}
+	return !isDropName(d.artist) && d.artist != "playlists" && d.album != allSongsDir
+}
+
+// sourcePath returns the path in the source Directory
+// for a file inside an Album Directory.
+func (d *Dir) sourcePath(name string) string {
+	rootPoint := d.mPoint
+	if rootPoint[len(rootPoint)-1] != '/' {
+		rootPoint = rootPoint + "/"
+	}
+	return rootPoint + d.artist + "/" + d.album + "/" + name
+}
+
+// sourceName returns the name in the source Directory of
+// the passthrough file whose NFC name is name, the files
+// copied from macOS keep their decomposed names on disk.
+func (d *Dir) sourceName(name string) string {
+	if _, err := os.Lstat(d.sourcePath(name)); err == nil {
+		return name
+	}
+
+	files, _ := ioutil.ReadDir(d.sourcePath(""))
+	for _, f := range files {
+		if normalizeName(f.Name()) == name {
+			return f.Name()
+		}
+	}
+	return name
+}
+
+// sourcePath returns the path of a passthrough
+// file in the source Directory.
+func (f *File) sourcePath() string {
+	d := Dir{artist: f.artist, album: f.album, mPoint: f.mPoint}
+	return d.sourcePath(f.name)
+}
+
+// listPassthroughFiles returns the passthrough files
+// stored in the source Directory of an Album.
+func (d *Dir) listPassthroughFiles() []fuse.Dirent {
+	var a []fuse.Dirent
+	if len(config_params.passthrough_files) < 1 {
+		return a
+	}
+
+	files, _ := ioutil.ReadDir(d.sourcePath(""))
+	for _, f := range files {
+		if !f.IsDir() && getFilePolicy(f.Name()) == policyPassthrough {
+			a = append(a, fuse.Dirent{Name: f.Name(), Type: fuse.DT_File})
+		}
+	}
+	return a
+}
@@ -0,0 +1,58 @@
+// Copyright 2016 Danko Miocevic. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Author: Danko Miocevic
+
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"golang.org/x/net/context"
+)
+
+func TestPolicyKeepsDirectories(t *testing.T) {
+	root := testLibrary(t, "Live_Desktop/Best_Desktop/Song.wav")
+	old := config_params.absorb_files
+	config_params.absorb_files = []string{"*Desktop*"}
+	defer func() { config_params.absorb_files = old }()
+
+	d := &Dir{artist: "", album: "", mPoint: root}
+	artist, err := d.lookup(context.Background(), "Live_Desktop")
+	if err != nil {
+		t.Fatalf("the Artist was absorbed: %s", err)
+	}
+	album, err := artist.(*Dir).lookup(context.Background(), "Best_Desktop")
+	if err != nil {
+		t.Fatalf("the Album was absorbed: %s", err)
+	}
+
+	if _, err := album.(*Dir).lookup(context.Background(), "Desktop.ini"); err == nil {
+		t.Error("the absorbed file was found")
+	}
+	if _, err := d.lookup(context.Background(), "Desktop.ini"); err == nil {
+		t.Error("the absorbed file was found in the root")
+	}
+}
+
+func TestParsePatterns(t *testing.T) {
+	got := parsePatterns(" *.jpg ;;Thumbs.db; ")
+	if want := []string{"*.jpg", "Thumbs.db"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("parsePatterns() = %q, want %q", got, want)
+	}
+	if got := parsePatterns(""); len(got) > 0 {
+		t.Errorf("parsePatterns(\"\") = %q", got)
+	}
+}
@@ -0,0 +1,44 @@
+// Copyright 2016 Danko Miocevic. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Author: Danko Miocevic
+
+package main
+
+import (
+	"net"
+	"net/http"
+	_ "net/http/pprof"
+	"strconv"
+
+	"github.com/golang/glog"
+)
+
+// startPprof serves the CPU, heap and goroutine profiles
+// of net/http/pprof on the pprof_port of the loopback
+// interface, so they are only reachable from the host.
+func startPprof() {
+	if config_params.pprof_port < 1 {
+		return
+	}
+
+	addr := net.JoinHostPort("127.0.0.1", strconv.Itoa(config_params.pprof_port))
+	go func() {
+		glog.Infof("Serving the profiles on http://%s/debug/pprof/\n", addr)
+		err := http.ListenAndServe(addr, nil)
+		if err != nil {
+			glog.Errorf("Cannot serve the profiles: %s\n", err)
+		}
+	}()
+}
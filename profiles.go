@@ -0,0 +1,224 @@
+// Copyright 2016 Danko Miocevic. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Author: Danko Miocevic
+
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"bazil.org/fuse"
+	"bazil.org/fuse/fs"
+	"github.com/golang/glog"
+	"golang.org/x/net/context"
+)
+
+// The access allowed by the profiles.
+const (
+	// accessFull allows to read and modify the Library.
+	accessFull = "full"
+	// accessReadOnly only allows to read the Library.
+	accessReadOnly = "readonly"
+)
+
+// defaultProfile is the UID used in the profiles
+// file for the users that are not listed.
+const defaultProfile = "*"
+
+// profile is the access to the filesystem
+// allowed to the users with a UID.
+// The hidden patterns are matched against the paths
+// relative to the mountpoint and their parents.
+type profile struct {
+	readOnly bool
+	hidden   []string
+}
+
+// profiles contains the profiles indexed by UID,
+// it is nil when the profiles are not used.
+var profiles map[string]profile
+
+// loadProfiles reads the profiles file, every line
+// has the UID, the access and optionally the
+// semicolon separated hidden patterns:
+//
+//	1001 readonly playlists/Private*;Some_Artist
+func loadProfiles(path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	loaded := make(map[string]profile)
+	scanner := bufio.NewScanner(file)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if len(line) < 1 || line[0] == '#' {
+			continue
+		}
+
+		fields := strings.Fields(line)
+		if len(fields) < 2 || len(fields) > 3 {
+			return fmt.Errorf("%s:%d: Expected UID, access and hidden patterns.", path, n)
+		}
+
+		if _, err := strconv.ParseUint(fields[0], 10, 32); err != nil && fields[0] != defaultProfile {
+			return fmt.Errorf("%s:%d: Invalid UID %s.", path, n, fields[0])
+		}
+
+		if fields[1] != accessFull && fields[1] != accessReadOnly {
+			return fmt.Errorf("%s:%d: Invalid access %s.", path, n, fields[1])
+		}
+
+		p := profile{readOnly: fields[1] == accessReadOnly}
+		if len(fields) > 2 {
+			p.hidden = parsePatterns(fields[2])
+		}
+		loaded[fields[0]] = p
+	}
+
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	profiles = loaded
+	return nil
+}
+
+// setGuestProfiles makes the filesystem read only and hides
+// the patterns to every user except the owner of the files.
+// The users listed in the profiles file are not changed.
+func setGuestProfiles(owner uint32, hidden []string) {
+	if profiles == nil {
+		profiles = make(map[string]profile)
+	}
+
+	uid := strconv.FormatUint(uint64(owner), 10)
+	if _, ok := profiles[uid]; !ok {
+		profiles[uid] = profile{}
+	}
+	if _, ok := profiles[defaultProfile]; !ok {
+		profiles[defaultProfile] = profile{readOnly: true, hidden: hidden}
+	}
+}
+
+// getProfile returns the profile of the UID,
+// users without a profile have full access.
+func getProfile(uid uint32) profile {
+	if p, ok := profiles[strconv.FormatUint(uint64(uid), 10)]; ok {
+		return p
+	}
+	return profiles[defaultProfile]
+}
+
+// isHidden returns true if the path or
+// any of its parents is hidden.
+func (p profile) isHidden(path string) bool {
+	if len(p.hidden) < 1 {
+		return false
+	}
+
+	items := strings.Split(path, "/")
+	for i := range items {
+		if matchPatterns(p.hidden, strings.Join(items[:i+1], "/")) {
+			return true
+		}
+	}
+	return false
+}
+
+// entryPath returns the path of an entry relative
+// to the mountpoint, the empty parts are skipped.
+func entryPath(items ...string) string {
+	var a []string
+	for _, item := range items {
+		if len(item) > 0 {
+			a = append(a, item)
+		}
+	}
+	return filepath.Join(a...)
+}
+
+// checkHidden returns ENOENT if the path is
+// hidden to the user making the request.
+func checkHidden(header fuse.Header, path string) error {
+	if profiles != nil && getProfile(header.Uid).isHidden(path) {
+		glog.Infof("%s is hidden to the UID %d.\n", path, header.Uid)
+		return fuse.ENOENT
+	}
+	return nil
+}
+
+// checkWritable returns EPERM if the user making
+// the request cannot modify the Library.
+func checkWritable(header fuse.Header) error {
+	if profiles != nil && getProfile(header.Uid).readOnly {
+		glog.Infof("The UID %d cannot modify the Library.\n", header.Uid)
+		return fuse.EPERM
+	}
+	return nil
+}
+
+// dirHandle is an open Directory, it lists
+// the entries visible to the user that opened it.
+type dirHandle struct {
+	d   *Dir
+	uid uint32
+}
+
+var _ = fs.NodeOpener(&Dir{})
+
+// Open returns a streamed handle for the root, playlist, Album
+// and songs view Directories, a handle that filters the entries when
+// the profiles are used, otherwise the Directory itself.
+func (d *Dir) Open(ctx context.Context, req *fuse.OpenRequest, resp *fuse.OpenResponse) (fs.Handle, error) {
+	if profiles != nil {
+		if err := checkHidden(req.Header, entryPath(d.artist, d.album)); err != nil {
+			return nil, err
+		}
+	}
+
+	if h := newDirStream(d, req.Header.Uid); h != nil {
+		return h, nil
+	}
+
+	if profiles == nil {
+		return d, nil
+	}
+	return &dirHandle{d: d, uid: req.Header.Uid}, nil
+}
+
+var _ = fs.HandleReadDirAller(&dirHandle{})
+
+func (h *dirHandle) ReadDirAll(ctx context.Context) ([]fuse.Dirent, error) {
+	entries, err := h.d.ReadDirAll(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	p := getProfile(h.uid)
+	var a []fuse.Dirent
+	for _, e := range entries {
+		if !p.isHidden(entryPath(h.d.artist, h.d.album, e.Name)) {
+			a = append(a, e)
+		}
+	}
+	return a, nil
+}
@@ -0,0 +1,59 @@
+// Copyright 2016 Danko Miocevic. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Author: Danko Miocevic
+
+package main
+
+import (
+	"github.com/dankomiocevic/mulifs/store"
+	"io/ioutil"
+
+	"bazil.org/fuse"
+)
+
+// isQuarantine returns true if the Directory is the
+// quarantine Directory inside the drop folder.
+func (d *Dir) isQuarantine() bool {
+	return d.artist == "drop" && d.album == store.QuarantineDir
+}
+
+// isQuarantined returns true if the File is inside the
+// quarantine Directory of the drop folder.
+func (f *File) isQuarantined() bool {
+	return f.artist == "drop" && f.album == store.QuarantineDir
+}
+
+// dropFilePath returns the path of a file in the drop
+// folder, in its quarantine Directory or in one of
+// the extra drop Directories.
+func (f *File) dropFilePath() (string, error) {
+	if f.isQuarantined() {
+		return store.GetQuarantineFilePath(f.name, f.mPoint)
+	}
+	return store.GetDropFilePath(f.dropName(), f.mPoint)
+}
+
+// listDropDir lists the files in a Directory of the
+// drop folder, the subdirectories are not listed.
+func listDropDir(path string) []fuse.Dirent {
+	var a []fuse.Dirent
+	files, _ := ioutil.ReadDir(path)
+	for _, f := range files {
+		if !f.IsDir() {
+			a = append(a, fuse.Dirent{Name: f.Name(), Type: fuse.DT_File})
+		}
+	}
+	return a
+}
@@ -0,0 +1,59 @@
+// Copyright 2016 Danko Miocevic. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Author: Danko Miocevic
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"github.com/dankomiocevic/mulifs/store"
+	"github.com/dankomiocevic/mulifs/tools"
+	"log"
+	"os"
+)
+
+// runImportRatings runs the import-ratings command, it stores
+// the ratings and play counts of the Songs exported from iTunes
+// or MediaMonkey.
+func runImportRatings(db_path string, args []string) {
+	flags := flag.NewFlagSet("import-ratings", flag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage:\n  %s [global_options] import-ratings LIBRARY_EXPORT\n", progName)
+	}
+	flags.Parse(args)
+
+	if flags.NArg() != 1 {
+		flags.Usage()
+		os.Exit(2)
+	}
+
+	err := store.InitDB(db_path)
+	if err != nil {
+		log.Fatal(err)
+		os.Exit(5)
+	}
+
+	stats, err := tools.ImportRatings(flags.Arg(0))
+	if err != nil {
+		log.Fatal(err)
+		os.Exit(19)
+	}
+
+	for _, entry := range stats.Unresolved {
+		log.Printf("Song not found: %s\n", entry)
+	}
+	log.Printf("%d Songs updated, %d not found\n", stats.Updated, len(stats.Unresolved))
+}
@@ -0,0 +1,61 @@
+// Copyright 2016 Danko Miocevic. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Author: Danko Miocevic
+package main
+
+// readAhead reads the requested data from the file using
+// a buffer of read_ahead KB, so sequential reads of small
+// blocks are served from memory instead of the disk.
+// The buffer is dropped when the file is written.
+func (fh *FileHandle) readAhead(offset int64, size int) ([]byte, error) {
+	fh.mu.Lock()
+	defer fh.mu.Unlock()
+
+	end := fh.bufOffset + int64(len(fh.buf))
+	if fh.buf == nil || offset < fh.bufOffset || offset+int64(size) > end {
+		bufSize := config_params.read_ahead * 1024
+		if bufSize < size {
+			bufSize = size
+		}
+
+		buf, err := readSource(fh.r, offset, bufSize)
+		if err != nil {
+			fh.buf = nil
+			return nil, err
+		}
+		fh.buf = buf
+		fh.bufOffset = offset
+	}
+
+	start := int(offset - fh.bufOffset)
+	if start > len(fh.buf) {
+		start = len(fh.buf)
+	}
+	stop := start + size
+	if stop > len(fh.buf) {
+		stop = len(fh.buf)
+	}
+
+	data := make([]byte, stop-start)
+	copy(data, fh.buf[start:stop])
+	return data, nil
+}
+
+// dropReadAhead discards the read ahead buffer.
+func (fh *FileHandle) dropReadAhead() {
+	fh.mu.Lock()
+	fh.buf = nil
+	fh.mu.Unlock()
+}
@@ -0,0 +1,253 @@
+// Copyright 2016 Danko Miocevic. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Author: Danko Miocevic
+
+package main
+
+import (
+	"encoding/binary"
+	"sync"
+
+	"github.com/dankomiocevic/mulifs/store"
+
+	"bazil.org/fuse"
+	"bazil.org/fuse/fs"
+	"golang.org/x/net/context"
+)
+
+// dirPageSize is the amount of entries read from the
+// database at once when streaming a Directory.
+const dirPageSize = 256
+
+// direntOffset is the position of the offset field
+// inside the entries encoded by fuse.AppendDirent.
+const direntOffset = 8
+
+// dirPager returns up to limit entries stored
+// after the specified name.
+type dirPager func(after string, limit int) ([]fuse.Dirent, error)
+
+// dirStream is an open Directory that reads its entries from
+// the database in pages while the kernel asks for them, so the
+// huge playlists and Albums are never loaded in memory at once.
+// The offset of every entry is its position in the listing.
+type dirStream struct {
+	d     *Dir
+	uid   uint32
+	inode uint64
+	page  dirPager
+	extra func() []fuse.Dirent
+	// hidden are the versions of the Songs not listed.
+	hidden map[string]bool
+
+	mu sync.Mutex
+	// next is the position of the first pending entry and
+	// last is the name of the last entry read from the database.
+	next    uint64
+	last    string
+	pending []fuse.Dirent
+	stored  bool
+	done    bool
+}
+
+// streamPager returns the function that reads the entries of
+// the Directory from the database and the function that returns
+// the entries listed after them, or false if the Directory
+// is not streamed.
+func (d *Dir) streamPager() (dirPager, func() []fuse.Dirent, bool) {
+	if len(d.artist) < 1 {
+		return store.ListArtistsPage, rootEntries, true
+	}
+
+	if d.artist == "songs" && len(d.album) < 1 {
+		return songsViewPager(), func() []fuse.Dirent { return nil }, true
+	}
+
+	if d.artist == "playlists" && len(d.album) > 0 && !d.isPlaylistFolder() {
+		playlist := d.album
+		page := func(after string, limit int) ([]fuse.Dirent, error) {
+			return store.ListPlaylistSongsPage(playlist, after, limit)
+		}
+		extra := func() []fuse.Dirent {
+			a := store.ListPlaylistDropFiles(playlist, d.mPoint)
+			return append(a, fuse.Dirent{Name: playlistInfoName, Type: fuse.DT_File})
+		}
+		return page, extra, true
+	}
+
+	if d.isAlbumDir() {
+		page := func(after string, limit int) ([]fuse.Dirent, error) {
+			return store.ListAlbumSongsPage(d.artist, d.album, after, limit)
+		}
+		return page, d.albumEntries, true
+	}
+	return nil, nil, false
+}
+
+// newDirStream returns a streamed handle for the Directory
+// or nil if its entries are always listed at once.
+func newDirStream(d *Dir, uid uint32) *dirStream {
+	page, extra, ok := d.streamPager()
+	if !ok {
+		return nil
+	}
+
+	inode := uint64(1)
+	for _, name := range []string{d.artist, d.album} {
+		if len(name) > 0 {
+			inode = d.fs.GenerateInode(inode, name)
+		}
+	}
+	h := &dirStream{d: d, uid: uid, inode: inode, page: page, extra: extra}
+	if d.isAlbumDir() {
+		h.hidden = hiddenVersions(d.artist, d.album)
+	}
+	return h
+}
+
+// rewind starts reading the Directory again
+// from the first entry.
+func (h *dirStream) rewind() {
+	h.next = 0
+	h.last = ""
+	h.pending = nil
+	h.stored = false
+	h.done = false
+}
+
+// fill reads the next entries when there are no
+// pending entries, it returns false at the end
+// of the Directory.
+func (h *dirStream) fill() (bool, error) {
+	for len(h.pending) < 1 {
+		if h.done {
+			return false, nil
+		}
+
+		var entries []fuse.Dirent
+		if !h.stored {
+			page, err := h.page(h.last, dirPageSize)
+			if err != nil {
+				return false, err
+			}
+			if len(page) > 0 {
+				h.last = page[len(page)-1].Name
+			}
+			h.stored = len(page) < dirPageSize
+			entries = page
+		} else {
+			entries = h.extra()
+			h.done = true
+		}
+
+		h.pending = h.visible(entries)
+	}
+	return true, nil
+}
+
+// visible removes the entries hidden to the user
+// that opened the Directory and the versions of
+// the Songs that are not listed.
+func (h *dirStream) visible(entries []fuse.Dirent) []fuse.Dirent {
+	entries = withoutHidden(entries, h.hidden)
+	if profiles == nil {
+		return entries
+	}
+
+	p := getProfile(h.uid)
+	a := entries[:0]
+	for _, e := range entries {
+		if !p.isHidden(entryPath(h.d.artist, h.d.album, e.Name)) {
+			a = append(a, e)
+		}
+	}
+	return a
+}
+
+// seek moves the stream to the entry in the offset, the
+// sequential reads continue where the last one stopped
+// while the other offsets read the Directory again.
+func (h *dirStream) seek(offset uint64) error {
+	if offset == h.next {
+		return nil
+	}
+
+	h.rewind()
+	for h.next < offset {
+		ok, err := h.fill()
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return nil
+		}
+
+		skip := offset - h.next
+		if skip > uint64(len(h.pending)) {
+			skip = uint64(len(h.pending))
+		}
+		h.pending = h.pending[skip:]
+		h.next += skip
+	}
+	return nil
+}
+
+var _ = fs.HandleReader(&dirStream{})
+
+func (h *dirStream) Read(ctx context.Context, req *fuse.ReadRequest, resp *fuse.ReadResponse) error {
+	if !req.Dir {
+		return fuse.EPERM
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	// The attributes of the Songs are read with the
+	// listing, they are asked next for every entry.
+	if req.Offset == 0 {
+		h.d.prefetchAttrs()
+	}
+
+	// The pages that cannot be read are I/O errors,
+	// the Directory itself exists.
+	if err := h.seek(uint64(req.Offset)); err != nil {
+		return fuse.EIO
+	}
+
+	for {
+		ok, err := h.fill()
+		if err != nil {
+			return fuse.EIO
+		}
+		if !ok {
+			return nil
+		}
+
+		e := h.pending[0]
+		e.Inode = h.d.fs.GenerateInode(h.inode, e.Name)
+		start := len(resp.Data)
+		data := fuse.AppendDirent(resp.Data, e)
+		if len(data) > req.Size {
+			return nil
+		}
+
+		// The entries keep the position of the next one as
+		// their offset instead of the position in the buffer.
+		binary.LittleEndian.PutUint64(data[start+direntOffset:], h.next+1)
+		resp.Data = data
+		h.pending = h.pending[1:]
+		h.next++
+	}
+}
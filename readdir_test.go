@@ -0,0 +1,90 @@
+// Copyright 2016 Danko Miocevic. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Author: Danko Miocevic
+
+package main
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"testing"
+
+	"bazil.org/fuse"
+	"golang.org/x/net/context"
+)
+
+// readDirents returns the names and the offsets
+// of the entries encoded in the buffer.
+func readDirents(data []byte) ([]string, []uint64) {
+	var names []string
+	var offsets []uint64
+	for len(data) > 0 {
+		offsets = append(offsets, binary.LittleEndian.Uint64(data[8:]))
+		size := int(binary.LittleEndian.Uint32(data[16:]))
+		names = append(names, string(data[24:24+size]))
+		data = data[(24+size+7)&^7:]
+	}
+	return names, offsets
+}
+
+func TestDirStreamOffsets(t *testing.T) {
+	var songs []string
+	for i := 0; i < 5; i++ {
+		songs = append(songs, fmt.Sprintf("Artist_%d/Album/Song_%d.wav", i, i))
+	}
+	root := testLibrary(t, songs...)
+	h := newDirStream(&Dir{fs: &FS{}, artist: "songs", mPoint: root}, 0)
+
+	var names []string
+	offset := int64(0)
+	for {
+		req := &fuse.ReadRequest{Dir: true, Offset: offset, Size: 100}
+		resp := &fuse.ReadResponse{}
+		if err := h.Read(context.Background(), req, resp); err != nil {
+			t.Fatal(err)
+		}
+		if len(resp.Data) < 1 {
+			break
+		}
+
+		read, offsets := readDirents(resp.Data)
+		for i := range offsets {
+			if offsets[i] != uint64(len(names)+i+1) {
+				t.Fatalf("the offset of %s is %d, want %d", read[i], offsets[i], len(names)+i+1)
+			}
+		}
+		names = append(names, read...)
+		offset = int64(offsets[len(offsets)-1])
+	}
+
+	if len(names) != 5 {
+		t.Errorf("got %v, want 5 Songs", names)
+	}
+}
+
+func TestDirStreamPageError(t *testing.T) {
+	root := testLibrary(t)
+	h := &dirStream{
+		d:     &Dir{fs: &FS{}, artist: "songs", mPoint: root},
+		page:  func(after string, limit int) ([]fuse.Dirent, error) { return nil, errors.New("Broken page.") },
+		extra: func() []fuse.Dirent { return nil },
+	}
+
+	req := &fuse.ReadRequest{Dir: true, Size: 4096}
+	if err := h.Read(context.Background(), req, &fuse.ReadResponse{}); err != fuse.EIO {
+		t.Errorf("Read() = %v, want EIO", err)
+	}
+}
@@ -0,0 +1,95 @@
+// Copyright 2016 Danko Miocevic. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Author: Danko Miocevic
+
+package main
+
+import (
+	"sync/atomic"
+	"time"
+
+	"github.com/golang/glog"
+)
+
+// readStats are the statistics of the reads
+// of a Song made through a handle.
+type readStats struct {
+	reads int64
+	bytes int64
+	wait  time.Duration
+	read  time.Duration
+	max   time.Duration
+	slow  int64
+}
+
+// The counters of the reads of every Song
+// shown in the metrics file.
+var (
+	songReads     int64
+	songReadBytes int64
+	songReadNanos int64
+	songSlowReads int64
+)
+
+// recordRead adds a read of n bytes to the statistics of
+// the handle, wait is the time spent waiting for the lock
+// of the Song and read the time spent reading the file.
+// The reads that take longer than slow_read milliseconds
+// are logged, so the stutters caused by MuLi can be told
+// apart from the ones caused by the storage.
+func (fh *FileHandle) recordRead(offset int64, n int, wait, read time.Duration) {
+	total := wait + read
+	slow := config_params.slow_read > 0 && total > time.Duration(config_params.slow_read)*time.Millisecond
+
+	atomic.AddInt64(&songReads, 1)
+	atomic.AddInt64(&songReadBytes, int64(n))
+	atomic.AddInt64(&songReadNanos, int64(read))
+	if slow {
+		atomic.AddInt64(&songSlowReads, 1)
+		glog.Warningf("Slow read of %d bytes at %d from %s: %s waiting for the Song, %s reading the file\n",
+			n, offset, fh.r.Name(), wait, read)
+	}
+
+	fh.mu.Lock()
+	defer fh.mu.Unlock()
+	fh.stats.reads++
+	fh.stats.bytes += int64(n)
+	fh.stats.wait += wait
+	fh.stats.read += read
+	if total > fh.stats.max {
+		fh.stats.max = total
+	}
+	if slow {
+		fh.stats.slow++
+	}
+}
+
+// logReadStats logs the statistics of the
+// reads made through the handle, if any.
+func (fh *FileHandle) logReadStats() {
+	fh.mu.Lock()
+	s := fh.stats
+	fh.mu.Unlock()
+	if s.reads < 1 {
+		return
+	}
+
+	var rate int64
+	if s.read > 0 {
+		rate = s.bytes * int64(time.Second) / int64(s.read) / 1024
+	}
+	glog.Infof("Read %d bytes from %s in %d reads: %d KB/s, %s average latency, %s maximum latency, %s waiting for the Song, %d slow reads\n",
+		s.bytes, fh.r.Name(), s.reads, rate, (s.wait+s.read)/time.Duration(s.reads), s.max, s.wait, s.slow)
+}
@@ -0,0 +1,91 @@
+// Copyright 2016 Danko Miocevic. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Author: Danko Miocevic
+
+package main
+
+import (
+	"github.com/dankomiocevic/mulifs/store"
+	"time"
+
+	"bazil.org/fuse"
+	"bazil.org/fuse/fs"
+	"golang.org/x/net/context"
+)
+
+// recentTimeFormat is the format of the time of the
+// play used in the names of the recently-played view.
+// It is sortable and does not use colons.
+const recentTimeFormat = "2006-01-02 15.04.05"
+
+// registerRecentView adds the recently-played view
+// to the root Directory when it is enabled.
+func registerRecentView() {
+	if config_params.recently_played > 0 {
+		views["recently-played"] = view{list: listRecentView, lookup: lookupRecentView}
+	}
+}
+
+// recentViewName returns the name used for a
+// play in the recently-played view.
+func recentViewName(play store.PlayRecord) string {
+	return play.Time.Local().Format(recentTimeFormat) + " - " + play.Artist + " - " + play.Song
+}
+
+// listRecentView lists the last recently_played Songs
+// that were read completely, the most recent first.
+func listRecentView(ctx context.Context, d *Dir) ([]fuse.Dirent, error) {
+	if len(d.album) > 0 {
+		return nil, fuse.ENOENT
+	}
+
+	plays, err := store.ListRecentPlays(config_params.recently_played)
+	if err != nil {
+		return nil, fuse.EIO
+	}
+
+	var a []fuse.Dirent
+	for _, play := range plays {
+		a = append(a, fuse.Dirent{Name: recentViewName(play), Type: fuse.DT_File})
+	}
+	return a, nil
+}
+
+// lookupRecentView returns the Songs in
+// the recently-played view.
+func lookupRecentView(ctx context.Context, d *Dir, name string) (fs.Node, error) {
+	if len(d.album) > 0 || len(name) <= len(recentTimeFormat) {
+		return nil, fuse.ENOENT
+	}
+
+	// The names that do not start with a time are
+	// rejected without reading the database.
+	_, err := time.ParseInLocation(recentTimeFormat, name[:len(recentTimeFormat)], time.Local)
+	if err != nil {
+		return nil, fuse.ENOENT
+	}
+
+	plays, err := store.ListRecentPlays(config_params.recently_played)
+	if err != nil {
+		return nil, fuse.EIO
+	}
+
+	for _, play := range plays {
+		if recentViewName(play) == name {
+			return songFile(d, play.Artist, play.Album, play.Song)
+		}
+	}
+	return nil, fuse.ENOENT
+}
@@ -0,0 +1,104 @@
+// Copyright 2016 Danko Miocevic. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Author: Danko Miocevic
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/dankomiocevic/mulifs/store"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+)
+
+// renameState is the progress of the last Artist or
+// Album Directory renamed, it is shown in the status
+// file while the Songs are retagged and moved.
+type renameState struct {
+	mu       sync.Mutex
+	running  bool
+	name     string
+	started  time.Time
+	finished time.Time
+	moved    int
+	total    int
+	err      error
+}
+
+var renamer renameState
+
+// renameLock allows a single Directory
+// to be renamed at the same time.
+var renameLock sync.Mutex
+
+// renameStatus returns the lines of the
+// status file about the last rename.
+func renameStatus() []byte {
+	renamer.mu.Lock()
+	defer renamer.mu.Unlock()
+
+	var b bytes.Buffer
+	switch {
+	case renamer.started.IsZero():
+		fmt.Fprintf(&b, "Rename: not started\n")
+	case renamer.running:
+		fmt.Fprintf(&b, "Rename: %s running since %s, %d of %d Songs moved\n", renamer.name,
+			renamer.started.Format(time.RFC3339), renamer.moved, renamer.total)
+	case renamer.err != nil:
+		fmt.Fprintf(&b, "Rename: %s failed at %s, the Songs were moved back: %s\n", renamer.name,
+			renamer.finished.Format(time.RFC3339), renamer.err)
+	default:
+		fmt.Fprintf(&b, "Rename: %s finished at %s, %d Songs moved\n", renamer.name,
+			renamer.finished.Format(time.RFC3339), renamer.moved)
+	}
+	return b.Bytes()
+}
+
+// renameDir runs the move of an Artist or Album Directory
+// showing its progress in the status file.
+func renameDir(oldName, newName string, move func(progress store.RenameProgress) error) error {
+	renameLock.Lock()
+	defer renameLock.Unlock()
+
+	renamer.mu.Lock()
+	renamer.running = true
+	renamer.name = oldName + " -> " + newName
+	renamer.started = time.Now()
+	renamer.moved = 0
+	renamer.total = 0
+	renamer.err = nil
+	renamer.mu.Unlock()
+
+	err := move(func(done, total int) {
+		renamer.mu.Lock()
+		renamer.moved = done
+		renamer.total = total
+		renamer.mu.Unlock()
+	})
+
+	renamer.mu.Lock()
+	renamer.running = false
+	renamer.finished = time.Now()
+	renamer.err = err
+	if err != nil {
+		renamer.moved = 0
+	}
+	glog.Infof("Rename: %s, %d Songs moved\n", renamer.name, renamer.moved)
+	renamer.mu.Unlock()
+	return err
+}
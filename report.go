@@ -0,0 +1,73 @@
+// Copyright 2016 Danko Miocevic. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Author: Danko Miocevic
+
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"github.com/dankomiocevic/mulifs/store"
+	"log"
+	"os"
+	"time"
+)
+
+// reportFileName is the read only file in the root
+// Directory that shows the report of the last scan.
+const reportFileName = ".scan_report"
+
+// isReportFile returns true if the File is
+// the scan report in the root Directory.
+func (f *File) isReportFile() bool {
+	return len(f.artist) < 1 && f.name == reportFileName
+}
+
+// scanReport returns the contents of the scan report
+// with the files skipped or failed in the last scan.
+func scanReport() []byte {
+	var b bytes.Buffer
+	report, err := store.GetScanReport()
+	if err != nil {
+		fmt.Fprintf(&b, "Scan: not finished\n")
+		return b.Bytes()
+	}
+
+	fmt.Fprintf(&b, "Scan: finished at %s, %d files skipped or failed\n",
+		report.Time.Format(time.RFC3339), len(report.Entries))
+	for _, e := range report.Entries {
+		fmt.Fprintf(&b, "%s: %s\n", e.Path, e.Reason)
+	}
+	return b.Bytes()
+}
+
+// runScanReport runs the scan-report command, it shows
+// the files skipped or failed in the last scan.
+func runScanReport(db_path string, args []string) {
+	flags := flag.NewFlagSet("scan-report", flag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage:\n  %s [global_options] scan-report\n", progName)
+	}
+	flags.Parse(args)
+
+	err := store.InitDB(db_path)
+	if err != nil {
+		log.Fatal(err)
+		os.Exit(5)
+	}
+
+	os.Stdout.Write(scanReport())
+}
@@ -0,0 +1,147 @@
+// Copyright 2016 Danko Miocevic. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Author: Danko Miocevic
+
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/dankomiocevic/mulifs/store"
+	"github.com/dankomiocevic/mulifs/tools"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// retagSets are the field=value changes of
+// the retag command, the flag can be repeated.
+type retagSets []string
+
+func (s *retagSets) String() string {
+	return strings.Join(*s, ",")
+}
+
+func (s *retagSets) Set(value string) error {
+	*s = append(*s, value)
+	return nil
+}
+
+// retagChanges parses the changes of the retag command,
+// the fields that can be changed are artist, album and title.
+func retagChanges(sets retagSets) (tools.RetagChanges, error) {
+	var changes tools.RetagChanges
+	for _, s := range sets {
+		eq := strings.Index(s, "=")
+		if eq < 1 {
+			return changes, fmt.Errorf("Wrong change %s, it must be field=value.", s)
+		}
+
+		value := strings.Trim(strings.TrimSpace(s[eq+1:]), "\"")
+		if len(value) < 1 {
+			return changes, fmt.Errorf("The %s cannot be empty.", s[:eq])
+		}
+
+		switch strings.ToLower(strings.TrimSpace(s[:eq])) {
+		case "artist":
+			changes.Artist = value
+		case "album":
+			changes.Album = value
+		case "title":
+			changes.Title = value
+		default:
+			return changes, fmt.Errorf("The field %s cannot be changed.", s[:eq])
+		}
+	}
+
+	if changes == (tools.RetagChanges{}) {
+		return changes, errors.New("There are no changes.")
+	}
+	return changes, nil
+}
+
+// runRetag runs the retag command, it changes the
+// Artist, Album or Title of all the Songs that match
+// the filters and moves their files.
+func runRetag(db_path string, args []string) {
+	var sets retagSets
+	var filter tools.RetagFilter
+	flags := flag.NewFlagSet("retag", flag.ExitOnError)
+	flags.StringVar(&filter.Artist, "artist", "", "Only change the Songs of this Artist.")
+	flags.StringVar(&filter.Album, "album", "", "Only change the Songs of this Album.")
+	flags.StringVar(&filter.Title, "title", "", "Only change the Songs with this title.")
+	flags.StringVar(&filter.Genre, "genre", "", "Only change the Songs of this genre.")
+	flags.StringVar(&filter.Year, "year", "", "Only change the Songs of this year.")
+	flags.Var(&sets, "set", "The change to make, like album=\"New Album\", the fields are artist, album and title.")
+	dryRun := flags.Bool("dry_run", false, "Only report the changes.")
+	flags.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage:\n  %s [global_options] retag [filters] [-dry_run] -set field=value MUSIC_SOURCE\n", progName)
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+
+	if flags.NArg() != 1 {
+		flags.Usage()
+		os.Exit(2)
+	}
+
+	changes, err := retagChanges(sets)
+	if err != nil {
+		log.Fatal(err)
+		os.Exit(2)
+	}
+
+	root, err := filepath.Abs(flags.Arg(0))
+	if err != nil {
+		log.Fatal(err)
+		os.Exit(6)
+	}
+
+	err = store.InitDB(db_path)
+	if err != nil {
+		log.Fatal(err)
+		os.Exit(5)
+	}
+
+	results, err := tools.RetagSongs(root, filter, changes, *dryRun)
+	if err != nil {
+		log.Fatal(err)
+		os.Exit(17)
+	}
+
+	failed := 0
+	for _, r := range results {
+		if r.Err != nil {
+			failed++
+			log.Printf("Cannot retag %s - %s - %s: %s\n", r.Song.ArtistName, r.Song.AlbumName, r.Song.Title, r.Err)
+			continue
+		}
+		log.Printf("%s - %s - %s: %s - %s - %s\n", r.Song.ArtistName, r.Song.AlbumName, r.Song.Title,
+			r.Artist, r.Album, r.Title)
+	}
+
+	if *dryRun {
+		log.Printf("%d Songs would be retagged\n", len(results))
+		return
+	}
+
+	log.Printf("%d Songs retagged, %d failed\n", len(results)-failed, failed)
+	if failed > 0 {
+		closeDB()
+		os.Exit(17)
+	}
+}
@@ -0,0 +1,46 @@
+// Copyright 2016 Danko Miocevic. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Author: Danko Miocevic
+
+package main
+
+import (
+	"testing"
+
+	"github.com/dankomiocevic/mulifs/tools"
+)
+
+func TestRetagChanges(t *testing.T) {
+	changes, err := retagChanges(retagSets{"Album=\"New Album\"", " artist = Some Artist"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := (tools.RetagChanges{Artist: "Some Artist", Album: "New Album"}); changes != want {
+		t.Errorf("retagChanges() = %+v, want %+v", changes, want)
+	}
+
+	wrong := []retagSets{
+		nil,
+		{"album"},
+		{"=New Album"},
+		{"album=\"\""},
+		{"genre=Rock"},
+	}
+	for _, sets := range wrong {
+		if _, err := retagChanges(sets); err == nil {
+			t.Errorf("retagChanges(%q) accepted", sets)
+		}
+	}
+}
@@ -0,0 +1,80 @@
+// Copyright 2016 Danko Miocevic. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Author: Danko Miocevic
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"github.com/dankomiocevic/mulifs/metadata"
+	"github.com/dankomiocevic/mulifs/store"
+	"github.com/dankomiocevic/mulifs/tools"
+	"log"
+	"os"
+
+	"golang.org/x/net/context"
+)
+
+// runImportScrobbles runs the import-scrobbles command, it
+// stores the plays of the scrobbler logs of portable players
+// in the statistics and optionally sends them to Last.fm.
+func runImportScrobbles(db_path string, args []string) {
+	flags := flag.NewFlagSet("import-scrobbles", flag.ExitOnError)
+	skipped := flags.Bool("skipped", false, "Also import the Songs skipped in the player.")
+	secret := flags.String("lastfm_secret", "", "Last.fm API secret, the plays are sent to Last.fm when it is set.")
+	session := flags.String("lastfm_session", "", "Last.fm session key of the user the plays are sent to.")
+	flags.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage:\n  %s [global_options] import-scrobbles [import_options] SCROBBLER_LOG\n", progName)
+		fmt.Fprintf(os.Stderr, "\nImport Options:\n")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+
+	if flags.NArg() != 1 {
+		flags.Usage()
+		os.Exit(2)
+	}
+
+	err := store.InitDB(db_path)
+	if err != nil {
+		log.Fatal(err)
+		os.Exit(5)
+	}
+
+	stats, scrobbles, err := tools.ImportScrobblerLog(flags.Arg(0), *skipped)
+	if err != nil {
+		log.Fatal(err)
+		os.Exit(18)
+	}
+
+	for _, entry := range stats.Unresolved {
+		log.Printf("Song not found: %s\n", entry)
+	}
+	log.Printf("%d plays imported, %d already imported, %d not found\n",
+		stats.Imported, stats.Duplicated, len(stats.Unresolved))
+
+	if len(*secret) < 1 {
+		return
+	}
+
+	lastfm := metadata.LastFM{Key: config_params.lastfm_key, Secret: *secret, Session: *session}
+	accepted, err := lastfm.Scrobble(context.Background(), scrobbles)
+	if err != nil {
+		log.Fatal(err)
+		os.Exit(18)
+	}
+	log.Printf("%d plays sent to Last.fm\n", accepted)
+}
@@ -0,0 +1,186 @@
+// Copyright 2016 Danko Miocevic. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Author: Danko Miocevic
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/dankomiocevic/mulifs/store"
+	"github.com/golang/glog"
+	"sync"
+	"time"
+)
+
+// statusFileName is the read only file in the root
+// Directory that shows the state of the scrubber and
+// of the last Directory renamed.
+const statusFileName = ".status"
+
+// scrubStart is the time waited after mounting
+// before the first pass of the scrubber.
+const scrubStart = time.Minute
+
+// scrubState is the progress of the scrubber, the
+// failures are the ones found in the last pass.
+type scrubState struct {
+	mu       sync.Mutex
+	running  bool
+	started  time.Time
+	finished time.Time
+	checked  int
+	total    int
+	failures []string
+}
+
+var scrubber scrubState
+
+// isStatusFile returns true if the File is
+// the status file in the root Directory.
+func (f *File) isStatusFile() bool {
+	return len(f.artist) < 1 && f.name == statusFileName
+}
+
+// scrubEnabled returns true if the scrubber is used.
+func scrubEnabled() bool {
+	return config_params.scrub_interval > 0
+}
+
+// scrubStatus returns the state of the scrubber.
+func scrubStatus() []byte {
+	scrubber.mu.Lock()
+	defer scrubber.mu.Unlock()
+
+	var b bytes.Buffer
+	switch {
+	case scrubber.running && maintenance != nil && !maintenance.contains(time.Now()):
+		fmt.Fprintf(&b, "Scrub: paused until the maintenance window, %d of %d Songs checked\n",
+			scrubber.checked, scrubber.total)
+	case scrubber.running:
+		fmt.Fprintf(&b, "Scrub: running since %s, %d of %d Songs checked\n",
+			scrubber.started.Format(time.RFC3339), scrubber.checked, scrubber.total)
+	case scrubber.finished.IsZero():
+		fmt.Fprintf(&b, "Scrub: not started\n")
+	default:
+		fmt.Fprintf(&b, "Scrub: finished at %s, %d Songs checked\n",
+			scrubber.finished.Format(time.RFC3339), scrubber.checked)
+	}
+
+	fmt.Fprintf(&b, "Failures: %d\n", len(scrubber.failures))
+	for _, f := range scrubber.failures {
+		fmt.Fprintf(&b, "%s\n", f)
+	}
+	return b.Bytes()
+}
+
+// statusContent returns the contents of the status file,
+// the state of the scrubber and of the completeness checks
+// are shown when they are used, the last repair of the
+// playlists once one was run and the size of the database.
+func statusContent() []byte {
+	var b bytes.Buffer
+	if scrubEnabled() {
+		b.Write(scrubStatus())
+	}
+	b.Write(renameStatus())
+	b.Write(repairStatus())
+	if completenessEnabled() {
+		b.Write(completenessStatus())
+	}
+	b.Write(dbStatus())
+	return b.Bytes()
+}
+
+// scrubFailure records a Song that failed the
+// verification in the status file and the logs.
+func scrubFailure(format string, args ...interface{}) {
+	msg := fmt.Sprintf(format, args...)
+	glog.Errorf("Scrub: %s\n", msg)
+
+	scrubber.mu.Lock()
+	scrubber.failures = append(scrubber.failures, msg)
+	scrubber.mu.Unlock()
+}
+
+// runScrub verifies the checksums of all the Songs
+// reading them slowly, so the scrubber does not
+// slow down the rest of the filesystem. It only
+// runs inside the maintenance window. The tombstones
+// of the Songs whose files are missing are kept.
+func runScrub(mPoint string) {
+	songs, err := store.ListSongInfo()
+	if err != nil {
+		glog.Errorf("Scrub: cannot list the Songs: %s\n", err)
+		return
+	}
+
+	scrubber.mu.Lock()
+	scrubber.running = true
+	scrubber.started = time.Now()
+	scrubber.checked = 0
+	scrubber.total = len(songs)
+	scrubber.failures = nil
+	scrubber.mu.Unlock()
+
+	for _, s := range songs {
+		// The pass is paused outside the maintenance window.
+		if !waitMaintenance() {
+			break
+		}
+
+		store.ThrottleOp()
+		status, err := store.VerifySong(s.SongRef, config_params.scrub_rate*1024)
+		switch {
+		case err != nil:
+			scrubFailure("error %s: %s", s.Path, err)
+		case status == store.VerifyMissing:
+			scrubFailure("missing %s", s.Path)
+			buryMissing(s.Artist, s.Album, s.Song, mPoint)
+		case status == store.VerifyCorrupted:
+			scrubFailure("corrupted %s", s.Path)
+		}
+
+		scrubber.mu.Lock()
+		scrubber.checked++
+		scrubber.mu.Unlock()
+	}
+
+	scrubber.mu.Lock()
+	scrubber.running = false
+	scrubber.finished = time.Now()
+	glog.Infof("Scrub: %d Songs checked, %d failures\n", scrubber.checked, len(scrubber.failures))
+	if len(scrubber.failures) > 0 {
+		notify("Scrub found errors", "%d of %d Songs failed the verification, see the .status file.",
+			len(scrubber.failures), scrubber.checked)
+	}
+	scrubber.mu.Unlock()
+}
+
+// startScrubber verifies the Library in background
+// every scrub_interval hours.
+func startScrubber(mPoint string) {
+	if !scrubEnabled() {
+		return
+	}
+
+	go func() {
+		time.Sleep(scrubStart)
+		for !isStopping() {
+			runScrub(mPoint)
+			time.Sleep(time.Duration(config_params.scrub_interval) * time.Hour)
+		}
+	}()
+}
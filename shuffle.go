@@ -0,0 +1,106 @@
+// Copyright 2016 Danko Miocevic. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Author: Danko Miocevic
+
+package main
+
+import (
+	"github.com/dankomiocevic/mulifs/store"
+	"math/rand"
+	"strings"
+	"time"
+
+	"bazil.org/fuse"
+	"bazil.org/fuse/fs"
+	"golang.org/x/net/context"
+)
+
+// registerShuffleView adds the shuffle view to the
+// root Directory when it is enabled.
+func registerShuffleView() {
+	if config_params.shuffle > 0 {
+		views["shuffle"] = view{list: listShuffleView, lookup: lookupShuffleView}
+	}
+}
+
+// shuffleViewName returns the name used for a Song in the
+// shuffle view, it contains the keys to find it again.
+func shuffleViewName(song store.SongRef) string {
+	return song.Artist + " - " + song.Album + " - " + song.Song
+}
+
+// listShuffleView lists a different random sample of
+// shuffle Songs from the Library every time.
+// The Songs are read in pages and sampled with a
+// reservoir, so the whole Library is not kept in memory.
+func listShuffleView(ctx context.Context, d *Dir) ([]fuse.Dirent, error) {
+	if len(d.album) > 0 {
+		return nil, fuse.ENOENT
+	}
+
+	r := rand.New(rand.NewSource(time.Now().UnixNano()))
+	var sample []store.SongRef
+	seen := 0
+	var last store.SongRef
+	for {
+		songs, err := store.ListSongsPage(last, songsPageSize)
+		if err != nil {
+			return nil, fuse.EIO
+		}
+
+		for _, song := range songs {
+			seen++
+			if len(sample) < config_params.shuffle {
+				sample = append(sample, song)
+			} else if i := r.Intn(seen); i < len(sample) {
+				sample[i] = song
+			}
+		}
+
+		if len(songs) < songsPageSize {
+			break
+		}
+		last = songs[len(songs)-1]
+
+		if ctx.Err() != nil {
+			return nil, fuse.EINTR
+		}
+	}
+
+	r.Shuffle(len(sample), func(i, j int) {
+		sample[i], sample[j] = sample[j], sample[i]
+	})
+
+	var a []fuse.Dirent
+	for _, song := range sample {
+		a = append(a, fuse.Dirent{Name: shuffleViewName(song), Type: fuse.DT_File})
+	}
+	return a, nil
+}
+
+// lookupShuffleView returns the Songs in the shuffle view,
+// any Song in the Library can be found by its name even
+// if it is not in the last sample.
+func lookupShuffleView(ctx context.Context, d *Dir, name string) (fs.Node, error) {
+	if len(d.album) > 0 {
+		return nil, fuse.ENOENT
+	}
+
+	items := strings.SplitN(name, " - ", 3)
+	if len(items) != 3 {
+		return nil, fuse.ENOENT
+	}
+	return songFile(d, items[0], items[1], items[2])
+}
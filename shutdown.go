@@ -0,0 +1,85 @@
+// Copyright 2016 Danko Miocevic. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Author: Danko Miocevic
+package main
+
+import (
+	"github.com/dankomiocevic/mulifs/store"
+	"os"
+	"os/signal"
+	"sync/atomic"
+	"syscall"
+
+	"bazil.org/fuse"
+	"github.com/golang/glog"
+	"golang.org/x/net/context"
+)
+
+// stopping is set to 1 when MuLi receives
+// a termination signal.
+var stopping int32
+
+// stopCtx is cancelled when MuLi receives a termination
+// signal. The work done in the background after the
+// requests, like the drops and the metadata lookups, uses
+// it so the pending events are processed without waiting
+// for the network.
+var stopCtx, cancelStop = context.WithCancel(context.Background())
+
+// isStopping returns true if MuLi is being stopped.
+func isStopping() bool {
+	return atomic.LoadInt32(&stopping) == 1
+}
+
+// handleSignals unmounts the filesystem when SIGTERM or
+// SIGINT are received, the pending operations finish and
+// the mount function returns.
+// If the filesystem is busy and cannot be unmounted, a
+// second signal stops MuLi after processing the pending events.
+func handleSignals(mountpoint string) {
+	sigs := make(chan os.Signal, 2)
+	signal.Notify(sigs, syscall.SIGTERM, syscall.SIGINT)
+
+	go func() {
+		for sig := range sigs {
+			glog.Infof("Received %v, stopping MuLi\n", sig)
+			if atomic.SwapInt32(&stopping, 1) == 1 {
+				shutdown()
+				os.Exit(1)
+			}
+			cancelStop()
+
+			sdNotify("STOPPING=1")
+			err := fuse.Unmount(mountpoint)
+			if err != nil {
+				glog.Errorf("Cannot unmount %s: %v, send the signal again to force the exit\n", mountpoint, err)
+			}
+		}
+	}()
+}
+
+// shutdown processes the pending drops and tag
+// changes and flushes the logs.
+// The database is opened on every operation, once the
+// pending events are processed it is closed.
+func shutdown() {
+	FlushDispatcher()
+	flushAlbumDrops()
+	err := store.CloseDB()
+	if err != nil {
+		glog.Errorf("Cannot save the encrypted database: %s\n", err)
+	}
+	glog.Flush()
+}
@@ -0,0 +1,153 @@
+// Copyright 2016 Danko Miocevic. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Author: Danko Miocevic
+
+package main
+
+import (
+	"github.com/dankomiocevic/mulifs/metadata"
+	"github.com/dankomiocevic/mulifs/store"
+	"strings"
+	"sync"
+
+	"bazil.org/fuse"
+	"bazil.org/fuse/fs"
+	"github.com/golang/glog"
+	"golang.org/x/net/context"
+)
+
+// similarCache keeps the similar Artists obtained from
+// Last.fm for every Artist while the filesystem is mounted.
+var similarCache = struct {
+	sync.Mutex
+	m map[string][]string
+}{m: make(map[string][]string)}
+
+// registerSimilarView adds the similar view to the root
+// Directory when the Last.fm API key is configured.
+func registerSimilarView() {
+	if len(config_params.lastfm_key) > 0 {
+		views["similar"] = view{list: listSimilarView, lookup: lookupSimilarView}
+	}
+}
+
+// similarArtists returns the Artists in the Library that
+// are similar to the specified one according to Last.fm.
+func similarArtists(ctx context.Context, artist string) ([]string, error) {
+	similarCache.Lock()
+	similar, ok := similarCache.m[artist]
+	similarCache.Unlock()
+	if ok {
+		return similar, nil
+	}
+
+	artistName, _, err := store.GetDescriptionNames(artist, "")
+	if err != nil {
+		return nil, fuse.ENOENT
+	}
+
+	lastfm := metadata.LastFM{Key: config_params.lastfm_key}
+	names, err := lastfm.SimilarArtists(ctx, artistName)
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, fuse.EINTR
+		}
+		glog.Infof("Cannot get the similar Artists of %s: %s\n", artistName, err)
+		return nil, fuse.EIO
+	}
+
+	artists, err := store.ListArtists()
+	if err != nil {
+		return nil, fuse.EIO
+	}
+
+	// The Artists are matched by their Directory
+	// name ignoring the case.
+	library := make(map[string]string)
+	for _, a := range artists {
+		if a.Type == fuse.DT_Dir {
+			library[strings.ToLower(a.Name)] = a.Name
+		}
+	}
+
+	similar = []string{}
+	for _, name := range names {
+		path, ok := library[strings.ToLower(store.GetCompatibleString(name))]
+		if ok && path != artist {
+			similar = append(similar, path)
+		}
+	}
+
+	similarCache.Lock()
+	similarCache.m[artist] = similar
+	similarCache.Unlock()
+	return similar, nil
+}
+
+// listSimilarView lists all the Artists in the Library or
+// the similar Artists in the Library for one of them.
+func listSimilarView(ctx context.Context, d *Dir) ([]fuse.Dirent, error) {
+	if len(d.album) < 1 {
+		artists, err := store.ListArtists()
+		if err != nil {
+			return nil, fuse.ENOENT
+		}
+
+		var a []fuse.Dirent
+		for _, artist := range artists {
+			if artist.Type == fuse.DT_Dir {
+				a = append(a, artist)
+			}
+		}
+		return a, nil
+	}
+
+	similar, err := similarArtists(ctx, d.album)
+	if err != nil {
+		return nil, err
+	}
+
+	var a []fuse.Dirent
+	for _, artist := range similar {
+		a = append(a, fuse.Dirent{Name: artist, Type: fuse.DT_Dir})
+	}
+	return a, nil
+}
+
+// lookupSimilarView returns the Artist Directories in the
+// similar view, the similar Artists are the real Artist
+// Directories in the Library.
+func lookupSimilarView(ctx context.Context, d *Dir, name string) (fs.Node, error) {
+	_, err := store.GetArtistPath(name)
+	if err != nil {
+		return nil, fuse.ENOENT
+	}
+
+	if len(d.album) < 1 {
+		return &Dir{fs: d.fs, artist: d.artist, album: name, mPoint: d.mPoint}, nil
+	}
+
+	similar, err := similarArtists(ctx, d.album)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, artist := range similar {
+		if artist == name {
+			return &Dir{fs: d.fs, artist: name, mPoint: d.mPoint}, nil
+		}
+	}
+	return nil, fuse.ENOENT
+}
@@ -0,0 +1,202 @@
+// Copyright 2016 Danko Miocevic. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Author: Danko Miocevic
+
+package main
+
+import (
+	"github.com/dankomiocevic/mulifs/store"
+	"os"
+	"strings"
+	"sync"
+
+	"bazil.org/fuse"
+	"bazil.org/fuse/fs"
+	"golang.org/x/net/context"
+)
+
+// snapshotsDirName is the view with the read only
+// snapshots of the index taken after the scans.
+const snapshotsDirName = ".snapshots"
+
+// lastSnapshot keeps the Songs of the last snapshot
+// read, the snapshots never change once stored.
+var lastSnapshot struct {
+	sync.Mutex
+	name  string
+	songs []store.SnapshotSong
+}
+
+// registerSnapshotsView adds the snapshots view to
+// the root Directory when the snapshots are kept.
+func registerSnapshotsView() {
+	if config_params.snapshots > 0 {
+		views[snapshotsDirName] = view{list: listSnapshotsView, lookup: lookupSnapshotsView}
+	}
+}
+
+// snapshotSongs returns the Songs of a snapshot.
+func snapshotSongs(name string) ([]store.SnapshotSong, error) {
+	lastSnapshot.Lock()
+	defer lastSnapshot.Unlock()
+	if lastSnapshot.name == name {
+		return lastSnapshot.songs, nil
+	}
+
+	songs, err := store.GetSnapshot(name)
+	if err != nil {
+		return nil, err
+	}
+	lastSnapshot.name = name
+	lastSnapshot.songs = songs
+	return songs, nil
+}
+
+// snapshotLevel returns the Directories of a Song in a
+// snapshot: the Artist, the Album and the Song itself.
+func snapshotLevel(s store.SnapshotSong) []string {
+	return []string{s.Artist, s.Album, s.Song}
+}
+
+// snapshotDir returns the Songs of the Directory inside
+// the snapshots view and its path. The Directories are
+// stored in the album separated by slashes:
+// Snapshot/Artist/Album.
+func snapshotDir(d *Dir) ([]store.SnapshotSong, []string, error) {
+	path := strings.Split(d.album, "/")
+	songs, err := snapshotSongs(path[0])
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var a []store.SnapshotSong
+	for _, s := range songs {
+		level := snapshotLevel(s)
+		match := true
+		for i := range path[1:] {
+			if path[i+1] != level[i] {
+				match = false
+				break
+			}
+		}
+		if match {
+			a = append(a, s)
+		}
+	}
+	return a, path[1:], nil
+}
+
+// listSnapshotsView lists the snapshots, the Artists
+// and Albums inside them or the Songs of an Album.
+func listSnapshotsView(ctx context.Context, d *Dir) ([]fuse.Dirent, error) {
+	var a []fuse.Dirent
+	if len(d.album) < 1 {
+		names, err := store.ListSnapshots()
+		if err != nil {
+			return nil, fuse.EIO
+		}
+
+		for _, name := range names {
+			a = append(a, fuse.Dirent{Name: name, Type: fuse.DT_Dir})
+		}
+		return a, nil
+	}
+
+	songs, path, err := snapshotDir(d)
+	if err != nil {
+		return nil, err
+	}
+
+	seen := make(map[string]bool)
+	for _, s := range songs {
+		name := snapshotLevel(s)[len(path)]
+		if seen[name] {
+			continue
+		}
+		seen[name] = true
+
+		if len(path) > 1 {
+			a = append(a, fuse.Dirent{Name: name, Type: fuse.DT_File})
+		} else {
+			a = append(a, fuse.Dirent{Name: name, Type: fuse.DT_Dir})
+		}
+	}
+	return a, nil
+}
+
+// lookupSnapshotsView returns the Directories and
+// the read only Songs in the snapshots view.
+func lookupSnapshotsView(ctx context.Context, d *Dir, name string) (fs.Node, error) {
+	if len(d.album) < 1 {
+		if _, err := snapshotSongs(name); err != nil {
+			return nil, fuse.ENOENT
+		}
+		return &Dir{fs: d.fs, artist: d.artist, album: name, mPoint: d.mPoint}, nil
+	}
+
+	songs, path, err := snapshotDir(d)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, s := range songs {
+		if snapshotLevel(s)[len(path)] != name {
+			continue
+		}
+
+		if len(path) > 1 {
+			return &File{artist: d.artist, album: d.album, name: name, mPoint: d.mPoint, policy: policySnapshot}, nil
+		}
+		return &Dir{fs: d.fs, artist: d.artist, album: d.album + "/" + name, mPoint: d.mPoint}, nil
+	}
+	return nil, fuse.ENOENT
+}
+
+// snapshotFilePath returns the path of the file of a Song
+// in a snapshot: the path it had when the snapshot was
+// taken or the path of the Song with the same checksum.
+// The Songs whose files no longer exist are shown empty.
+func snapshotFilePath(album, name string) (string, error) {
+	d := Dir{album: album}
+	songs, path, err := snapshotDir(&d)
+	if err != nil || len(path) != 2 {
+		return "", fuse.ENOENT
+	}
+
+	for _, s := range songs {
+		if s.Song != name {
+			continue
+		}
+
+		if _, err := os.Stat(s.Path); err == nil {
+			return s.Path, nil
+		}
+
+		if len(s.Checksum) > 0 {
+			current, err := store.ListSongInfo()
+			if err != nil {
+				return "", err
+			}
+
+			for _, c := range current {
+				if c.Checksum == s.Checksum {
+					return c.Path, nil
+				}
+			}
+		}
+		return os.DevNull, nil
+	}
+	return "", fuse.ENOENT
+}
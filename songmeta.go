@@ -0,0 +1,124 @@
+// Copyright 2016 Danko Miocevic. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Author: Danko Miocevic
+
+package main
+
+import (
+	"encoding/json"
+	"github.com/dankomiocevic/mulifs/musicmgr"
+	"github.com/dankomiocevic/mulifs/store"
+	"strings"
+	"time"
+)
+
+// songMetadataExt is the extension of the hidden read only
+// files with the metadata of every Song, the file of the
+// Song.mp3 is named .Song.mp3.json.
+const songMetadataExt = ".json"
+
+// songMetadata is the content of the metadata file of
+// a Song, with the information stored in the database.
+type songMetadata struct {
+	Artist      string     `json:"artist"`
+	TrackArtist string     `json:"track_artist,omitempty"`
+	Album       string     `json:"album"`
+	Title       string     `json:"title"`
+	Track       string     `json:"track,omitempty"`
+	Genre       string     `json:"genre,omitempty"`
+	Year        string     `json:"year,omitempty"`
+	Composer    string     `json:"composer,omitempty"`
+	Work        string     `json:"work,omitempty"`
+	Conductor   string     `json:"conductor,omitempty"`
+	BPM         string     `json:"bpm,omitempty"`
+	Key         string     `json:"key,omitempty"`
+	Duration    int        `json:"duration,omitempty"`
+	Codec       string     `json:"codec,omitempty"`
+	Bitrate     string     `json:"bitrate,omitempty"`
+	Checksum    string     `json:"checksum,omitempty"`
+	Path        string     `json:"path"`
+	Playlists   []string   `json:"playlists,omitempty"`
+	Rating      int        `json:"rating,omitempty"`
+	MBID        string     `json:"musicbrainz_id,omitempty"`
+	Plays       int        `json:"plays"`
+	LastPlayed  *time.Time `json:"last_played,omitempty"`
+}
+
+// metadataSong returns the name of the Song of a
+// metadata file name, or false if it is not one.
+func metadataSong(name string) (string, bool) {
+	if len(name) <= len(songMetadataExt)+1 || name[0] != '.' || !strings.HasSuffix(name, songMetadataExt) {
+		return "", false
+	}
+
+	song := name[1 : len(name)-len(songMetadataExt)]
+	return song, musicmgr.IsMusicFile(song)
+}
+
+// isSongMetadataFile returns true if the File is the
+// metadata file of a Song in an Album Directory.
+func (f *File) isSongMetadataFile() bool {
+	if _, ok := metadataSong(f.name); !ok {
+		return false
+	}
+	return len(f.album) > 0 && !f.isDropped() && f.artist != "playlists" && f.album != allSongsDir
+}
+
+// songMetadataFile returns the metadata file of
+// a Song inside the Album Directory.
+func songMetadataFile(d *Dir, name string) (*File, error) {
+	song, _ := metadataSong(name)
+	if _, err := store.GetFilePath(d.artist, d.album, song); err != nil {
+		return nil, err
+	}
+	return &File{artist: d.artist, album: d.album, song: name, name: name, mPoint: d.mPoint}, nil
+}
+
+// songMetadataContent returns the metadata of the Song
+// encoded as JSON, the play count changes while it is read.
+func songMetadataContent(artist, album, name string) []byte {
+	song, _ := metadataSong(name)
+	s, err := store.GetSong(artist, album, song)
+	if err != nil {
+		return nil
+	}
+
+	m := songMetadata{Artist: artist, Album: album, Title: s.SongName, Track: s.Track,
+		Genre: s.Genre, Year: s.Year, Composer: s.Composer, Work: s.Work,
+		Conductor: s.Conductor, BPM: s.BPM, Key: s.Key, Duration: s.Duration,
+		Codec: s.Codec, Bitrate: s.Bitrate, Checksum: s.Checksum,
+		Path: s.SongFullPath, Playlists: s.Playlists, Rating: s.Rating,
+		MBID: s.MusicBrainzID, TrackArtist: s.TrackArtist}
+	if artistName, albumName, err := store.GetDescriptionNames(artist, album); err == nil {
+		if len(artistName) > 0 {
+			m.Artist = artistName
+		}
+		if len(albumName) > 0 {
+			m.Album = albumName
+		}
+	}
+
+	plays, last, err := store.CountPlays(store.SongRef{Artist: artist, Album: album, Song: song})
+	if err == nil && plays > 0 {
+		m.Plays = plays
+		m.LastPlayed = &last
+	}
+
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return nil
+	}
+	return append(data, '\n')
+}
@@ -0,0 +1,160 @@
+// Copyright 2016 Danko Miocevic. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Author: Danko Miocevic
+
+package main
+
+import (
+	"io"
+	"os"
+	"syscall"
+	"time"
+
+	"bazil.org/fuse"
+	"github.com/golang/glog"
+)
+
+// sourceRetryDelay is the time to wait before
+// the first retry, it doubles on every retry.
+const sourceRetryDelay = 200 * time.Millisecond
+
+// transientErrors are the errors returned by the network
+// filesystems (NFS, SMB) during short network problems,
+// they usually go away when the operation is repeated.
+var transientErrors = []syscall.Errno{
+	syscall.EIO, syscall.EAGAIN, syscall.EINTR, syscall.ETIMEDOUT,
+	syscall.ESTALE, syscall.EHOSTDOWN, syscall.EHOSTUNREACH,
+	syscall.ENETDOWN, syscall.ENETUNREACH, syscall.ECONNRESET,
+}
+
+// isTransient returns true if the error
+// may go away when the operation is repeated.
+func isTransient(err error) bool {
+	switch e := err.(type) {
+	case *os.PathError:
+		err = e.Err
+	case *os.SyscallError:
+		err = e.Err
+	case *os.LinkError:
+		err = e.Err
+	case fuse.Errno:
+		err = syscall.Errno(e)
+	}
+
+	errno, ok := err.(syscall.Errno)
+	if !ok {
+		return false
+	}
+	for _, t := range transientErrors {
+		if errno == t {
+			return true
+		}
+	}
+	return false
+}
+
+// sourceIO runs an operation over the files of the source
+// Directory. The operations that fail with a transient error
+// or take longer than io_timeout seconds are repeated up to
+// io_retries times, waiting twice as long before every retry.
+// The operations that time out keep running in background
+// (a blocked system call cannot be cancelled), so op must be
+// safe to run more than once at the same time and return
+// its result instead of setting it, the results that are
+// closers are closed when they arrive too late.
+func sourceIO(name string, op func() (interface{}, error)) (interface{}, error) {
+	delay := sourceRetryDelay
+	for retry := 0; ; retry++ {
+		v, err := sourceIOOnce(op)
+		if err == nil || !isTransient(err) || retry >= config_params.io_retries {
+			return v, err
+		}
+
+		glog.Errorf("Error accessing %s: %s, retrying in %s (%d/%d)\n", name, err, delay, retry+1, config_params.io_retries)
+		time.Sleep(delay)
+		delay *= 2
+	}
+}
+
+// sourceIOOnce runs the operation once,
+// limited to io_timeout seconds if set.
+func sourceIOOnce(op func() (interface{}, error)) (interface{}, error) {
+	if config_params.io_timeout < 1 {
+		return op()
+	}
+
+	type result struct {
+		v   interface{}
+		err error
+	}
+	done := make(chan result, 1)
+	go func() {
+		v, err := op()
+		done <- result{v, err}
+	}()
+
+	select {
+	case r := <-done:
+		return r.v, r.err
+	case <-time.After(time.Duration(config_params.io_timeout) * time.Second):
+		go func() {
+			r := <-done
+			if c, ok := r.v.(io.Closer); ok && r.err == nil {
+				c.Close()
+			}
+		}()
+		return nil, fuse.Errno(syscall.ETIMEDOUT)
+	}
+}
+
+// openSource opens a file of the source Directory.
+func openSource(path string, flags int) (*os.File, error) {
+	v, err := sourceIO(path, func() (interface{}, error) {
+		return os.OpenFile(path, flags, 0666)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return v.(*os.File), nil
+}
+
+// statSource returns the information
+// of a file of the source Directory.
+func statSource(path string) (os.FileInfo, error) {
+	v, err := sourceIO(path, func() (interface{}, error) {
+		return os.Stat(path)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return v.(os.FileInfo), nil
+}
+
+// readSource reads up to size bytes at offset from a file
+// of the source Directory, io.EOF is not an error.
+func readSource(r *os.File, offset int64, size int) ([]byte, error) {
+	v, err := sourceIO(r.Name(), func() (interface{}, error) {
+		buf := make([]byte, size)
+		n, err := r.ReadAt(buf, offset)
+		if err == io.EOF {
+			err = nil
+		}
+		return buf[:n], err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return v.([]byte), nil
+}
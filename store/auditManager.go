@@ -0,0 +1,89 @@
+// Copyright 2016 Danko Miocevic. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Author: Danko Miocevic
+
+package store
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/boltdb/bolt"
+)
+
+// AuditEntry is an operation that changed the library,
+// Paths are the paths inside MuLi affected by it.
+type AuditEntry struct {
+	Time  time.Time
+	Uid   uint32
+	Op    string
+	Paths []string
+}
+
+// AppendAudit adds the entry at the end of the audit log,
+// the entries are never modified nor removed.
+func AppendAudit(entry AuditEntry) error {
+	db, err := openDB()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	return db.Update(func(tx *bolt.Tx) error {
+		root, err := tx.CreateBucketIfNotExists([]byte("Audit"))
+		if err != nil {
+			return err
+		}
+
+		id, err := root.NextSequence()
+		if err != nil {
+			return err
+		}
+
+		encoded, err := json.Marshal(entry)
+		if err != nil {
+			return err
+		}
+		return root.Put(journalKey(id), encoded)
+	})
+}
+
+// ListAudit returns the entries of the audit log
+// in the order they were added.
+func ListAudit() ([]AuditEntry, error) {
+	var a []AuditEntry
+	db, err := openDB()
+	if err != nil {
+		return a, err
+	}
+	defer db.Close()
+
+	err = db.View(func(tx *bolt.Tx) error {
+		root := tx.Bucket([]byte("Audit"))
+		if root == nil {
+			return nil
+		}
+
+		return root.ForEach(func(k, v []byte) error {
+			var entry AuditEntry
+			if err := json.Unmarshal(v, &entry); err != nil {
+				return err
+			}
+			a = append(a, entry)
+			return nil
+		})
+	})
+	return a, err
+}
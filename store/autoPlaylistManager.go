@@ -0,0 +1,287 @@
+// Copyright 2016 Danko Miocevic. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Author: Danko Miocevic
+
+package store
+
+import (
+	"encoding/json"
+	"github.com/dankomiocevic/mulifs/musicmgr"
+	"github.com/dankomiocevic/mulifs/playlistmgr"
+	"strings"
+
+	"bazil.org/fuse"
+	"github.com/boltdb/bolt"
+	"github.com/golang/glog"
+)
+
+// AutoPlaylistPrefix is the prefix of the playlists
+// generated by MuLi from the Music Library, they are
+// read only and regenerated when the Library changes.
+const AutoPlaylistPrefix = "auto-"
+
+// IsAutoPlaylist returns true if the playlist
+// is generated by MuLi.
+func IsAutoPlaylist(name string) bool {
+	return strings.HasPrefix(name, AutoPlaylistPrefix)
+}
+
+// SongInfo is the information of a Song used
+// to generate the auto playlists.
+type SongInfo struct {
+	SongRef
+	Path          string
+	Genre         string
+	Year          string
+	Composer      string
+	Work          string
+	Conductor     string
+	BPM           string
+	Key           string
+	Codec         string
+	Bitrate       string
+	Checksum      string
+	Duration      int
+	MusicBrainzID string
+}
+
+// ListSongInfo returns the information of
+// every Song in the Music Library.
+func ListSongInfo() ([]SongInfo, error) {
+	db, err := openDB()
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	var a []SongInfo
+	err = db.View(func(tx *bolt.Tx) error {
+		root := tx.Bucket([]byte("Artists"))
+		return root.ForEach(func(artist, v []byte) error {
+			if v != nil {
+				return nil
+			}
+
+			artistBucket := root.Bucket(artist)
+			return artistBucket.ForEach(func(album, w []byte) error {
+				if w != nil {
+					return nil
+				}
+
+				albumBucket := artistBucket.Bucket(album)
+				return albumBucket.ForEach(func(song, x []byte) error {
+					if x == nil || song[0] == '.' {
+						return nil
+					}
+
+					var songStore SongStore
+					if err := json.Unmarshal(x, &songStore); err != nil {
+						return nil
+					}
+
+					a = append(a, SongInfo{
+						SongRef:       SongRef{Artist: string(artist), Album: string(album), Song: string(song)},
+						Path:          songStore.SongFullPath,
+						Genre:         songStore.Genre,
+						Year:          songStore.Year,
+						Composer:      songStore.Composer,
+						Work:          songStore.Work,
+						Conductor:     songStore.Conductor,
+						BPM:           songStore.BPM,
+						Key:           songStore.Key,
+						Codec:         songStore.Codec,
+						Bitrate:       songStore.Bitrate,
+						Checksum:      songStore.Checksum,
+						Duration:      songStore.Duration,
+						MusicBrainzID: songStore.MusicBrainzID,
+					})
+					return nil
+				})
+			})
+		})
+	})
+
+	if err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+// RefreshSongInfo reads the tags of a Song that was
+// added or modified and stores them in the database
+// with its new checksum.
+func RefreshSongInfo(artist, album, song, path string) error {
+	err, tags := musicmgr.GetTags(path)
+	if err != nil {
+		return err
+	}
+	old, _ := GetSong(artist, album, song)
+	checksum, checksumTime := updateChecksum(old, path)
+	if len(tags.BPM) < 1 {
+		tags.BPM = songBPM(old, path)
+	}
+	codec, bitrate := musicmgr.GetQuality(path)
+	duration := musicmgr.GetDuration(path)
+
+	db, err := openDB()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	return db.Update(func(tx *bolt.Tx) error {
+		root := tx.Bucket([]byte("Artists"))
+		artistBucket := root.Bucket([]byte(artist))
+		if artistBucket == nil {
+			return fuse.ENOENT
+		}
+
+		albumBucket := artistBucket.Bucket([]byte(album))
+		if albumBucket == nil {
+			return fuse.ENOENT
+		}
+
+		songJson := albumBucket.Get([]byte(song))
+		if songJson == nil {
+			return fuse.ENOENT
+		}
+
+		var songStore SongStore
+		err := json.Unmarshal(songJson, &songStore)
+		if err != nil {
+			return err
+		}
+
+		songStore.Genre = tags.Genre
+		songStore.Year = tags.Year
+		songStore.Composer = tags.Composer
+		songStore.Work = tags.Work
+		songStore.Conductor = tags.Conductor
+		songStore.BPM = tags.BPM
+		songStore.Key = tags.Key
+		songStore.Track = tags.Track
+		songStore.TrackArtist = tags.TrackArtist
+		songStore.Codec = codec
+		songStore.Bitrate = bitrate
+		songStore.Checksum = checksum
+		songStore.ChecksumTime = checksumTime
+		songStore.Duration = duration
+		if len(tags.MusicBrainzTrack) > 0 {
+			songStore.MusicBrainzID = tags.MusicBrainzTrack
+		}
+		encoded, err := json.Marshal(songStore)
+		if err != nil {
+			return err
+		}
+
+		err = albumBucket.Put([]byte(song), encoded)
+		if err != nil {
+			return err
+		}
+
+		ref := SongRef{Artist: artist, Album: album, Song: song}
+		err = putMusicBrainzIDs(tx, ref, MusicBrainzIDs{Artist: tags.MusicBrainzArtist, Album: tags.MusicBrainzAlbum})
+		if err != nil {
+			return err
+		}
+		return indexSongTags(tx, old, songStore, ref)
+	})
+}
+
+// SyncAutoPlaylists replaces the content of the auto
+// playlists with the specified Songs, the auto playlists
+// that are not specified are deleted.
+// The playlist files are regenerated in the playlists
+// Directory of the mount point.
+func SyncAutoPlaylists(playlists map[string][]SongInfo, mPoint string) error {
+	db, err := openDB()
+	if err != nil {
+		return err
+	}
+
+	var deleted []string
+	err = db.Update(func(tx *bolt.Tx) error {
+		root, err := tx.CreateBucketIfNotExists([]byte("Playlists"))
+		if err != nil {
+			return err
+		}
+
+		c := root.Cursor()
+		for k, v := c.First(); k != nil; k, v = c.Next() {
+			if v == nil && IsAutoPlaylist(string(k)) {
+				if _, ok := playlists[string(k)]; !ok {
+					deleted = append(deleted, string(k))
+				}
+			}
+		}
+
+		for _, name := range deleted {
+			if err := root.DeleteBucket([]byte(name)); err != nil {
+				return err
+			}
+		}
+
+		for name, songs := range playlists {
+			if root.Bucket([]byte(name)) != nil {
+				if err := root.DeleteBucket([]byte(name)); err != nil {
+					return err
+				}
+			}
+
+			b, err := root.CreateBucket([]byte(name))
+			if err != nil {
+				return err
+			}
+
+			// The Songs are stored by name as the other
+			// playlists, only the first one with every
+			// name is added.
+			for _, s := range songs {
+				if b.Get([]byte(s.Song)) != nil {
+					continue
+				}
+
+				encoded, err := json.Marshal(playlistmgr.PlaylistFile{
+					Title:  s.Song,
+					Artist: s.Artist,
+					Album:  s.Album,
+					Path:   s.Path,
+				})
+				if err != nil {
+					return err
+				}
+				b.Put([]byte(s.Song), encoded)
+			}
+		}
+		return nil
+	})
+	db.Close()
+
+	if err != nil {
+		return err
+	}
+
+	for _, name := range deleted {
+		playlistmgr.DeletePlaylist(name, mPoint)
+	}
+
+	for name := range playlists {
+		err = RegeneratePlaylistFile(name, mPoint)
+		if err != nil {
+			glog.Errorf("Cannot regenerate the playlist %s: %s\n", name, err)
+		}
+	}
+	return nil
+}
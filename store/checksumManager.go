@@ -0,0 +1,201 @@
+// Copyright 2016 Danko Miocevic. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Author: Danko Miocevic
+
+package store
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"os"
+	"time"
+
+	"bazil.org/fuse"
+	"github.com/boltdb/bolt"
+	"github.com/golang/glog"
+)
+
+// VerifyStatus is the result of
+// verifying the checksum of a Song.
+type VerifyStatus int
+
+const (
+	// VerifyOK means that the Song was not modified.
+	VerifyOK VerifyStatus = iota
+	// VerifyAdded means that the Song had no checksum,
+	// it was calculated and stored.
+	VerifyAdded
+	// VerifyChanged means that the Song was modified after
+	// the checksum was stored, the checksum was updated.
+	VerifyChanged
+	// VerifyMissing means that the file of the Song
+	// is not in the source Directory.
+	VerifyMissing
+	// VerifyCorrupted means that the content of the Song
+	// changed without changing its modification time.
+	VerifyCorrupted
+)
+
+// throttledReader limits the speed of
+// the reads to rate bytes per second.
+type throttledReader struct {
+	r     io.Reader
+	rate  int
+	start time.Time
+	read  int64
+}
+
+func (t *throttledReader) Read(p []byte) (int, error) {
+	if len(p) > t.rate {
+		p = p[:t.rate]
+	}
+
+	n, err := t.r.Read(p)
+	t.read += int64(n)
+	expected := time.Duration(t.read * int64(time.Second) / int64(t.rate))
+	if wait := expected - time.Since(t.start); wait > 0 {
+		time.Sleep(wait)
+	}
+	return n, err
+}
+
+// fileChecksum returns the SHA-256 of the file and its
+// modification time, the file is read at rate bytes per
+// second or as fast as possible if rate is 0. The slow
+// reads are background work and also follow its limits.
+func fileChecksum(path string, rate int) (string, int64, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", 0, err
+	}
+	defer f.Close()
+
+	fi, err := f.Stat()
+	if err != nil {
+		return "", 0, err
+	}
+
+	var r io.Reader = f
+	if rate > 0 {
+		r = backgroundReader{r: &throttledReader{r: f, rate: rate, start: time.Now()}}
+	}
+
+	h := sha256.New()
+	_, err = io.Copy(h, r)
+	if err != nil {
+		return "", 0, err
+	}
+	return hex.EncodeToString(h.Sum(nil)), fi.ModTime().UnixNano(), nil
+}
+
+// updateChecksum returns the checksum to store for a Song,
+// the old one is kept if the file was not modified since
+// it was calculated so a corrupted file is not accepted.
+func updateChecksum(old SongStore, path string) (string, int64) {
+	if len(old.Checksum) > 0 && old.SongFullPath == path {
+		fi, err := os.Stat(path)
+		if err == nil && fi.ModTime().UnixNano() == old.ChecksumTime {
+			return old.Checksum, old.ChecksumTime
+		}
+	}
+
+	sum, modTime, err := fileChecksum(path, 0)
+	if err != nil {
+		glog.Infof("Cannot calculate the checksum of %s: %s\n", path, err)
+		return "", 0
+	}
+	return sum, modTime
+}
+
+// setChecksum stores the checksum of a Song.
+func setChecksum(ref SongRef, sum string, modTime int64) error {
+	db, err := openDB()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	return db.Update(func(tx *bolt.Tx) error {
+		artistBucket := tx.Bucket([]byte("Artists")).Bucket([]byte(ref.Artist))
+		if artistBucket == nil {
+			return fuse.ENOENT
+		}
+
+		albumBucket := artistBucket.Bucket([]byte(ref.Album))
+		if albumBucket == nil {
+			return fuse.ENOENT
+		}
+
+		songJson := albumBucket.Get([]byte(ref.Song))
+		if songJson == nil {
+			return fuse.ENOENT
+		}
+
+		var songStore SongStore
+		err := json.Unmarshal(songJson, &songStore)
+		if err != nil {
+			return err
+		}
+
+		songStore.Checksum = sum
+		songStore.ChecksumTime = modTime
+		encoded, err := json.Marshal(songStore)
+		if err != nil {
+			return err
+		}
+		return albumBucket.Put([]byte(ref.Song), encoded)
+	})
+}
+
+// VerifySong calculates the checksum of a Song again and
+// compares it with the stored one. If the file was modified
+// since the checksum was stored, the new one is stored.
+// The corrupted Songs keep the old checksum.
+// The file is read at rate bytes per second, 0 reads
+// it as fast as possible.
+func VerifySong(ref SongRef, rate int) (VerifyStatus, error) {
+	song, err := GetSong(ref.Artist, ref.Album, ref.Song)
+	if err != nil {
+		return VerifyOK, err
+	}
+
+	sum, modTime, err := fileChecksum(song.SongFullPath, rate)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return VerifyMissing, nil
+		}
+		return VerifyOK, err
+	}
+
+	switch {
+	case len(song.Checksum) < 1:
+		return VerifyAdded, setChecksum(ref, sum, modTime)
+	case modTime != song.ChecksumTime:
+		return VerifyChanged, setChecksum(ref, sum, modTime)
+	case sum != song.Checksum:
+		glog.Errorf("The checksum of %s does not match\n", song.SongFullPath)
+		return VerifyCorrupted, nil
+	}
+	return VerifyOK, nil
+}
+
+// FileChecksum returns the checksum of a file
+// calculated the same way as the Songs checksums.
+func FileChecksum(path string) (string, error) {
+	sum, _, err := fileChecksum(path, 0)
+	return sum, err
+}
@@ -0,0 +1,152 @@
+// Copyright 2016 Danko Miocevic. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Author: Danko Miocevic
+
+package store
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/boltdb/bolt"
+	"github.com/golang/glog"
+)
+
+// dbSwap stops the operations from opening the database
+// while it is replaced by the compacted copy, so they do
+// not wait for the lock of the old file.
+var dbSwap sync.RWMutex
+
+// openDB opens the database of the Library, the
+// database is opened again by every operation.
+func openDB() (*bolt.DB, error) {
+	dbSwap.RLock()
+	defer dbSwap.RUnlock()
+	return bolt.Open(config.DbPath, 0600, config.Options)
+}
+
+// CompactDB copies the database to a new file without the
+// free pages and replaces the database with it, it returns
+// the sizes before and after.
+// The database is kept open while it is compacted, so
+// the other operations wait until it is done. The copy is
+// renamed over the database while its lock is held, so a
+// crash leaves the old or the new database.
+func CompactDB() (int64, int64, error) {
+	if readOnlyDB() {
+		return 0, 0, errors.New("The database is read only.")
+	}
+
+	dbSwap.Lock()
+	defer dbSwap.Unlock()
+
+	db, err := bolt.Open(config.DbPath, 0600, config.Options)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer db.Close()
+
+	fi, err := os.Stat(config.DbPath)
+	if err != nil {
+		return 0, 0, err
+	}
+	before := fi.Size()
+
+	tmpPath := config.DbPath + ".compact"
+	os.Remove(tmpPath)
+
+	dst, err := bolt.Open(tmpPath, 0600, nil)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	err = db.View(func(tx *bolt.Tx) error {
+		return dst.Update(func(dstTx *bolt.Tx) error {
+			return tx.ForEach(func(name []byte, b *bolt.Bucket) error {
+				dstBucket, err := dstTx.CreateBucket(name)
+				if err != nil {
+					return err
+				}
+				return compactBucket(b, dstBucket)
+			})
+		})
+	})
+	dst.Close()
+	if err != nil {
+		os.Remove(tmpPath)
+		return 0, 0, err
+	}
+
+	after, err := replaceCompacted(tmpPath, config.DbPath)
+	if err != nil {
+		os.Remove(tmpPath)
+		return 0, 0, err
+	}
+	glog.Infof("Compacted the database from %d to %d bytes.\n", before, after)
+	return before, after, nil
+}
+
+// compactBucket copies the keys, the nested buckets and
+// the sequence of the bucket src into the bucket dst.
+func compactBucket(src, dst *bolt.Bucket) error {
+	err := src.ForEach(func(k, v []byte) error {
+		if v != nil {
+			return dst.Put(k, v)
+		}
+
+		nested, err := dst.CreateBucket(k)
+		if err != nil {
+			return err
+		}
+		return compactBucket(src.Bucket(k), nested)
+	})
+	if err != nil {
+		return err
+	}
+	return dst.SetSequence(src.Sequence())
+}
+
+// replaceCompacted syncs the compacted database and
+// renames it over the database file, the Directory is
+// synced so the rename is kept. It returns the new size.
+func replaceCompacted(src, dst string) (int64, error) {
+	f, err := os.Open(src)
+	if err != nil {
+		return 0, err
+	}
+	err = f.Sync()
+	fi, statErr := f.Stat()
+	f.Close()
+	if err != nil {
+		return 0, err
+	}
+	if statErr != nil {
+		return 0, statErr
+	}
+
+	err = os.Rename(src, dst)
+	if err != nil {
+		return 0, err
+	}
+
+	dir, err := os.Open(filepath.Dir(dst))
+	if err != nil {
+		return 0, err
+	}
+	defer dir.Close()
+	return fi.Size(), dir.Sync()
+}
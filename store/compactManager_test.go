@@ -0,0 +1,117 @@
+// Copyright 2016 Danko Miocevic. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Author: Danko Miocevic
+
+package store
+
+import (
+	"fmt"
+	"os"
+	"sync"
+	"testing"
+
+	"github.com/boltdb/bolt"
+)
+
+func TestCompactDB(t *testing.T) {
+	path := testDB(t)
+
+	db, err := openDB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		b, err := tx.CreateBucketIfNotExists([]byte("Compact"))
+		if err != nil {
+			return err
+		}
+		for i := 0; i < 2000; i++ {
+			if err := b.Put([]byte(fmt.Sprintf("key%04d", i)), make([]byte, 512)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err == nil {
+		err = db.Update(func(tx *bolt.Tx) error {
+			b := tx.Bucket([]byte("Compact"))
+			for i := 0; i < 1990; i++ {
+				if err := b.Delete([]byte(fmt.Sprintf("key%04d", i))); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+	}
+	db.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	old, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The operations started during the compaction
+	// must see the compacted database.
+	var wg sync.WaitGroup
+	errs := make(chan error, 10)
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			db, err := openDB()
+			if err != nil {
+				errs <- err
+				return
+			}
+			defer db.Close()
+			errs <- db.View(func(tx *bolt.Tx) error {
+				if tx.Bucket([]byte("Compact")).Get([]byte("key1995")) == nil {
+					return fmt.Errorf("key1995 not found")
+				}
+				return nil
+			})
+		}()
+	}
+
+	before, after, err := CompactDB()
+	wg.Wait()
+	close(errs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for err := range errs {
+		if err != nil {
+			t.Error(err)
+		}
+	}
+
+	if before != old.Size() || after >= before {
+		t.Errorf("CompactDB() = %d, %d, the database had %d bytes", before, after, old.Size())
+	}
+	if _, err := os.Stat(path + ".compact"); !os.IsNotExist(err) {
+		t.Error("the compacted copy was left behind")
+	}
+
+	cur, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if os.SameFile(old, cur) || cur.Size() != after {
+		t.Error("the database was not replaced by the compacted copy")
+	}
+}
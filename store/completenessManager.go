@@ -0,0 +1,249 @@
+// Copyright 2016 Danko Miocevic. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Author: Danko Miocevic
+
+package store
+
+import (
+	"encoding/json"
+	"github.com/dankomiocevic/mulifs/metadata"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/boltdb/bolt"
+)
+
+// AlbumRelease is an Album with the MusicBrainz identifier
+// of its release and the time when its track list was
+// checked, Checked is zero if it was never checked.
+type AlbumRelease struct {
+	AlbumRef
+	ReleaseID string
+	Checked   time.Time
+}
+
+// IncompleteAlbum is an Album that does not have every
+// track of its release, Total is the number of tracks
+// of the release.
+type IncompleteAlbum struct {
+	AlbumRef
+	ReleaseID string
+	Total     int
+	Missing   []metadata.ReleaseTrack
+}
+
+// albumTracks is the canonical track list of an
+// Album stored in the Completeness bucket.
+type albumTracks struct {
+	AlbumRef
+	ReleaseID string
+	Tracks    []metadata.ReleaseTrack
+	Checked   time.Time
+}
+
+// completenessKey returns the key of an Album
+// in the Completeness bucket.
+func completenessKey(ref AlbumRef) []byte {
+	return []byte(ref.Artist + "/" + ref.Album)
+}
+
+// ListAlbumReleases returns the Albums with the MusicBrainz
+// identifier of their release, with the time their track
+// list was checked for the same release.
+func ListAlbumReleases() ([]AlbumRelease, error) {
+	db, err := openDB()
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	var a []AlbumRelease
+	err = db.View(func(tx *bolt.Tx) error {
+		completeness := tx.Bucket([]byte("Completeness"))
+		root := tx.Bucket([]byte("Artists"))
+		return root.ForEach(func(artist, v []byte) error {
+			if v != nil {
+				return nil
+			}
+
+			artistBucket := root.Bucket(artist)
+			return artistBucket.ForEach(func(album, w []byte) error {
+				if w != nil {
+					return nil
+				}
+
+				var albumStore AlbumStore
+				json.Unmarshal(artistBucket.Bucket(album).Get([]byte(".description")), &albumStore)
+				if len(albumStore.MusicBrainzID) < 1 {
+					return nil
+				}
+
+				release := AlbumRelease{AlbumRef: AlbumRef{Artist: string(artist), Album: string(album)},
+					ReleaseID: albumStore.MusicBrainzID}
+				if completeness != nil {
+					var tracks albumTracks
+					value := completeness.Get(completenessKey(release.AlbumRef))
+					if value != nil && json.Unmarshal(value, &tracks) == nil && tracks.ReleaseID == release.ReleaseID {
+						release.Checked = tracks.Checked
+					}
+				}
+				a = append(a, release)
+				return nil
+			})
+		})
+	})
+
+	if err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+// SetAlbumTracks stores the canonical track list of the
+// release of an Album, obtained from MusicBrainz.
+func SetAlbumTracks(release AlbumRelease, tracks []metadata.ReleaseTrack) error {
+	db, err := openDB()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	return db.Update(func(tx *bolt.Tx) error {
+		root, err := tx.CreateBucketIfNotExists([]byte("Completeness"))
+		if err != nil {
+			return err
+		}
+
+		encoded, err := json.Marshal(albumTracks{AlbumRef: release.AlbumRef, ReleaseID: release.ReleaseID,
+			Tracks: tracks, Checked: time.Now()})
+		if err != nil {
+			return err
+		}
+		return root.Put(completenessKey(release.AlbumRef), encoded)
+	})
+}
+
+// ListIncompleteAlbums returns the Albums that do not have
+// every track of their release. The Albums removed or whose
+// release changed since their track list was stored are
+// not included.
+func ListIncompleteAlbums() ([]IncompleteAlbum, error) {
+	db, err := openDB()
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	var a []IncompleteAlbum
+	err = db.View(func(tx *bolt.Tx) error {
+		completeness := tx.Bucket([]byte("Completeness"))
+		if completeness == nil {
+			return nil
+		}
+
+		return completeness.ForEach(func(k, v []byte) error {
+			var tracks albumTracks
+			if json.Unmarshal(v, &tracks) != nil {
+				return nil
+			}
+
+			b, err := descriptionBucket(tx, tracks.Artist, tracks.Album)
+			if err != nil {
+				return nil
+			}
+
+			var albumStore AlbumStore
+			json.Unmarshal(b.Get([]byte(".description")), &albumStore)
+			if albumStore.MusicBrainzID != tracks.ReleaseID {
+				return nil
+			}
+
+			missing := missingTracks(b, tracks.Tracks)
+			if len(missing) > 0 {
+				a = append(a, IncompleteAlbum{AlbumRef: tracks.AlbumRef, ReleaseID: tracks.ReleaseID,
+					Total: len(tracks.Tracks), Missing: missing})
+			}
+			return nil
+		})
+	})
+
+	if err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+// simpleTitle simplifies a title to compare it with others
+// ignoring the case and every character that is not a
+// letter or a number.
+func simpleTitle(title string) string {
+	return strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			return unicode.ToLower(r)
+		}
+		return -1
+	}, title)
+}
+
+// missingTracks returns the tracks of the release that are
+// not found in the Album. The tracks are matched with the
+// Songs by their MusicBrainz recording identifier, then by
+// their title and, for the releases of a single disc, by
+// their track number.
+func missingTracks(albumBucket *bolt.Bucket, tracks []metadata.ReleaseTrack) []metadata.ReleaseTrack {
+	ids := make(map[string]bool)
+	titles := make(map[string]bool)
+	numbers := make(map[int]bool)
+	albumBucket.ForEach(func(song, v []byte) error {
+		if v == nil || song[0] == '.' {
+			return nil
+		}
+
+		var songStore SongStore
+		if json.Unmarshal(v, &songStore) != nil {
+			return nil
+		}
+
+		ids[songStore.MusicBrainzID] = true
+		titles[simpleTitle(songStore.SongName)] = true
+		number := songStore.TrackNumber
+		if number < 1 {
+			number, _ = strconv.Atoi(strings.SplitN(songStore.Track, "/", 2)[0])
+		}
+		numbers[number] = true
+		return nil
+	})
+
+	singleDisc := true
+	for _, t := range tracks {
+		if t.Disc != tracks[0].Disc {
+			singleDisc = false
+		}
+	}
+
+	var missing []metadata.ReleaseTrack
+	for _, t := range tracks {
+		switch {
+		case len(t.RecordingID) > 0 && ids[t.RecordingID]:
+		case titles[simpleTitle(t.Title)]:
+		case singleDisc && t.Position > 0 && numbers[t.Position]:
+		default:
+			missing = append(missing, t)
+		}
+	}
+	return missing
+}
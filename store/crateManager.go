@@ -0,0 +1,182 @@
+// Copyright 2016 Danko Miocevic. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Author: Danko Miocevic
+
+package store
+
+import (
+	"encoding/json"
+	"errors"
+
+	"bazil.org/fuse"
+	"github.com/boltdb/bolt"
+)
+
+// CrateEntry is a Song in a crate with the cue notes
+// written for it, the crates never modify the Songs.
+type CrateEntry struct {
+	SongRef
+	Notes string `json:",omitempty"`
+}
+
+// ListCrates returns the names of the crates.
+func ListCrates() ([]string, error) {
+	db, err := openDB()
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	var a []string
+	err = db.View(func(tx *bolt.Tx) error {
+		crates := tx.Bucket([]byte("Crates"))
+		if crates == nil {
+			return nil
+		}
+
+		return crates.ForEach(func(k, v []byte) error {
+			a = append(a, string(k))
+			return nil
+		})
+	})
+	return a, err
+}
+
+// CreateCrate creates an empty crate, the name
+// is converted to a compatible name and returned.
+func CreateCrate(name string) (string, error) {
+	name = GetCompatibleString(name)
+	if len(name) < 1 {
+		return name, errors.New("The name of the crate is empty.")
+	}
+
+	db, err := openDB()
+	if err != nil {
+		return name, err
+	}
+	defer db.Close()
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		crates, err := tx.CreateBucketIfNotExists([]byte("Crates"))
+		if err != nil {
+			return err
+		}
+
+		if crates.Get([]byte(name)) != nil {
+			return fuse.EEXIST
+		}
+		return crates.Put([]byte(name), []byte("[]"))
+	})
+	return name, err
+}
+
+// DeleteCrate removes a crate, the Songs
+// in it are not modified.
+func DeleteCrate(name string) error {
+	db, err := openDB()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	return db.Update(func(tx *bolt.Tx) error {
+		crates := tx.Bucket([]byte("Crates"))
+		if crates == nil || crates.Get([]byte(name)) == nil {
+			return fuse.ENOENT
+		}
+		return crates.Delete([]byte(name))
+	})
+}
+
+// GetCrate returns the Songs of a crate in
+// order or fuse.ENOENT if there is none.
+func GetCrate(name string) ([]CrateEntry, error) {
+	db, err := openDB()
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	var entries []CrateEntry
+	err = db.View(func(tx *bolt.Tx) error {
+		crates := tx.Bucket([]byte("Crates"))
+		if crates == nil {
+			return fuse.ENOENT
+		}
+
+		v := crates.Get([]byte(name))
+		if v == nil {
+			return fuse.ENOENT
+		}
+		return json.Unmarshal(v, &entries)
+	})
+	return entries, err
+}
+
+// SetCrate replaces the Songs of a crate, the
+// Songs must be in the Music Library.
+func SetCrate(name string, entries []CrateEntry) error {
+	db, err := openDB()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	return db.Update(func(tx *bolt.Tx) error {
+		crates := tx.Bucket([]byte("Crates"))
+		if crates == nil || crates.Get([]byte(name)) == nil {
+			return fuse.ENOENT
+		}
+
+		for _, e := range entries {
+			if findSongJson(tx, e.SongRef) == nil {
+				return errors.New("Song " + e.Artist + "/" + e.Album + "/" + e.Song + " not found.")
+			}
+		}
+
+		if entries == nil {
+			entries = []CrateEntry{}
+		}
+		encoded, err := json.Marshal(entries)
+		if err != nil {
+			return err
+		}
+		return crates.Put([]byte(name), encoded)
+	})
+}
+
+// AddToCrate adds a Song at the end of a crate.
+func AddToCrate(name string, ref SongRef) error {
+	entries, err := GetCrate(name)
+	if err != nil {
+		return err
+	}
+	return SetCrate(name, append(entries, CrateEntry{SongRef: ref}))
+}
+
+// findSongJson returns the stored information of a
+// Song or nil if it is not in the Music Library.
+func findSongJson(tx *bolt.Tx, ref SongRef) []byte {
+	artistBucket := tx.Bucket([]byte("Artists")).Bucket([]byte(ref.Artist))
+	if artistBucket == nil {
+		return nil
+	}
+
+	albumBucket := artistBucket.Bucket([]byte(ref.Album))
+	if albumBucket == nil {
+		return nil
+	}
+	return albumBucket.Get([]byte(ref.Song))
+}
@@ -0,0 +1,38 @@
+// Copyright 2016 Danko Miocevic. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Author: Danko Miocevic
+
+package store
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+// testDB creates an empty database in a temporary
+// Directory and returns its path, it is closed
+// when the test ends.
+func testDB(t *testing.T) string {
+	path := filepath.Join(t.TempDir(), "muli.db")
+	if err := InitDB(path); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		if err := CloseDB(); err != nil {
+			t.Error(err)
+		}
+	})
+	return path
+}
@@ -0,0 +1,388 @@
+// Copyright 2016 Danko Miocevic. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Author: Danko Miocevic
+
+package store
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/dankomiocevic/mulifs/metadata"
+
+	"bazil.org/fuse"
+	"github.com/boltdb/bolt"
+	"github.com/golang/glog"
+)
+
+// descriptionBucket returns the Bucket that contains the
+// description of the Artist or the Album if it is specified.
+func descriptionBucket(tx *bolt.Tx, artist, album string) (*bolt.Bucket, error) {
+	root := tx.Bucket([]byte("Artists"))
+	b := root.Bucket([]byte(artist))
+	if b == nil {
+		return nil, fuse.ENOENT
+	}
+
+	if len(album) > 0 {
+		b = b.Bucket([]byte(album))
+		if b == nil {
+			return nil, fuse.ENOENT
+		}
+	}
+	return b, nil
+}
+
+// DescriptionFetched returns true if the information for
+// the Artist or the Album was already requested to the
+// metadata provider.
+func DescriptionFetched(artist, album string) (bool, error) {
+	db, err := openDB()
+	if err != nil {
+		return false, err
+	}
+	defer db.Close()
+
+	var fetched bool
+	err = db.View(func(tx *bolt.Tx) error {
+		b, err := descriptionBucket(tx, artist, album)
+		if err != nil {
+			return err
+		}
+
+		var desc struct{ Fetched bool }
+		descValue := b.Get([]byte(".description"))
+		if descValue == nil {
+			return fuse.ENOENT
+		}
+		json.Unmarshal(descValue, &desc)
+		fetched = desc.Fetched
+		return nil
+	})
+	return fetched, err
+}
+
+// SetArtistInfo completes the description of the Artist
+// with the information obtained from a metadata provider.
+// The fields already set are not modified.
+func SetArtistInfo(artist string, info metadata.ArtistInfo) error {
+	db, err := openDB()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	return db.Update(func(tx *bolt.Tx) error {
+		b, err := descriptionBucket(tx, artist, "")
+		if err != nil {
+			return err
+		}
+
+		var artistStore ArtistStore
+		descValue := b.Get([]byte(".description"))
+		if descValue == nil {
+			return fuse.ENOENT
+		}
+		err = json.Unmarshal(descValue, &artistStore)
+		if err != nil {
+			return err
+		}
+
+		fillField(&artistStore.Bio, info.Bio)
+		fillField(&artistStore.Country, info.Country)
+		fillField(&artistStore.Formed, info.Formed)
+		fillField(&artistStore.Type, info.Type)
+		artistStore.Fetched = true
+
+		encoded, err := json.Marshal(artistStore)
+		if err != nil {
+			return err
+		}
+		return b.Put([]byte(".description"), encoded)
+	})
+}
+
+// SetAlbumInfo completes the description of the Album
+// with the information obtained from a metadata provider.
+// The fields already set are not modified.
+func SetAlbumInfo(artist, album string, info metadata.AlbumInfo) error {
+	db, err := openDB()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	return db.Update(func(tx *bolt.Tx) error {
+		b, err := descriptionBucket(tx, artist, album)
+		if err != nil {
+			return err
+		}
+
+		var albumStore AlbumStore
+		descValue := b.Get([]byte(".description"))
+		if descValue == nil {
+			return fuse.ENOENT
+		}
+		err = json.Unmarshal(descValue, &albumStore)
+		if err != nil {
+			return err
+		}
+
+		fillField(&albumStore.ReleaseDate, info.ReleaseDate)
+		fillField(&albumStore.Country, info.Country)
+		fillField(&albumStore.Label, info.Label)
+		fillField(&albumStore.CatalogNumber, info.CatalogNumber)
+		fillField(&albumStore.Barcode, info.Barcode)
+		if len(albumStore.Credits) < 1 {
+			albumStore.Credits = info.Credits
+		}
+		albumStore.Fetched = true
+
+		encoded, err := json.Marshal(albumStore)
+		if err != nil {
+			return err
+		}
+		return b.Put([]byte(".description"), encoded)
+	})
+}
+
+// MusicBrainzIDs are the identifiers of a Song,
+// its Album and its Artist in MusicBrainz.
+type MusicBrainzIDs struct {
+	Artist string
+	Album  string
+	Track  string
+}
+
+// SetMusicBrainzIDs stores the MusicBrainz identifiers of
+// a Song and the descriptions of its Album and its Artist.
+// The empty identifiers are not stored.
+func SetMusicBrainzIDs(song SongRef, ids MusicBrainzIDs) error {
+	db, err := openDB()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	return db.Update(func(tx *bolt.Tx) error {
+		return putMusicBrainzIDs(tx, song, ids)
+	})
+}
+
+// putMusicBrainzIDs stores the MusicBrainz identifiers
+// that are not empty inside the transaction.
+func putMusicBrainzIDs(tx *bolt.Tx, song SongRef, ids MusicBrainzIDs) error {
+	b, err := descriptionBucket(tx, song.Artist, "")
+	if err != nil {
+		return err
+	}
+
+	if len(ids.Artist) > 0 {
+		var artistStore ArtistStore
+		if err := json.Unmarshal(b.Get([]byte(".description")), &artistStore); err != nil {
+			return err
+		}
+		artistStore.MusicBrainzID = ids.Artist
+		encoded, err := json.Marshal(artistStore)
+		if err != nil {
+			return err
+		}
+		if err := b.Put([]byte(".description"), encoded); err != nil {
+			return err
+		}
+	}
+
+	b, err = descriptionBucket(tx, song.Artist, song.Album)
+	if err != nil {
+		return err
+	}
+
+	if len(ids.Album) > 0 {
+		var albumStore AlbumStore
+		if err := json.Unmarshal(b.Get([]byte(".description")), &albumStore); err != nil {
+			return err
+		}
+		albumStore.MusicBrainzID = ids.Album
+		encoded, err := json.Marshal(albumStore)
+		if err != nil {
+			return err
+		}
+		if err := b.Put([]byte(".description"), encoded); err != nil {
+			return err
+		}
+	}
+
+	songJson := b.Get([]byte(song.Song))
+	if len(ids.Track) < 1 || songJson == nil {
+		return nil
+	}
+
+	var songStore SongStore
+	if err := json.Unmarshal(songJson, &songStore); err != nil {
+		return err
+	}
+	songStore.MusicBrainzID = ids.Track
+	encoded, err := json.Marshal(songStore)
+	if err != nil {
+		return err
+	}
+	return b.Put([]byte(song.Song), encoded)
+}
+
+// GetMusicBrainzID returns the MusicBrainz identifier
+// of the Album, or of the Artist if the Album is empty.
+// It returns an empty string if it is not known.
+func GetMusicBrainzID(artist, album string) (string, error) {
+	db, err := openDB()
+	if err != nil {
+		return "", err
+	}
+	defer db.Close()
+
+	var id string
+	err = db.View(func(tx *bolt.Tx) error {
+		b, err := descriptionBucket(tx, artist, album)
+		if err != nil {
+			return err
+		}
+
+		if len(album) < 1 {
+			var artistStore ArtistStore
+			json.Unmarshal(b.Get([]byte(".description")), &artistStore)
+			id = artistStore.MusicBrainzID
+			return nil
+		}
+
+		var albumStore AlbumStore
+		json.Unmarshal(b.Get([]byte(".description")), &albumStore)
+		id = albumStore.MusicBrainzID
+		return nil
+	})
+	return id, err
+}
+
+// fillField sets the value only if the field is empty.
+func fillField(field *string, value string) {
+	if len(*field) < 1 {
+		*field = value
+	}
+}
+
+// UpdateDescription stores the description of the Artist
+// or the Album edited by the user.
+// The names, paths and Albums are managed by MuLi and
+// cannot be modified, the custom fields must be defined.
+func UpdateDescription(artist, album string, data []byte) error {
+	db, err := openDB()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	return db.Update(func(tx *bolt.Tx) error {
+		b, err := descriptionBucket(tx, artist, album)
+		if err != nil {
+			return err
+		}
+
+		descValue := b.Get([]byte(".description"))
+		if descValue == nil {
+			return fuse.ENOENT
+		}
+
+		var encoded []byte
+		if len(album) < 1 {
+			var current, edited ArtistStore
+			json.Unmarshal(descValue, &current)
+			err = json.Unmarshal(data, &edited)
+			if err != nil {
+				glog.Info("Wrong description JSON: ", err)
+				return errors.New("Wrong description JSON.")
+			}
+
+			edited.ArtistName = current.ArtistName
+			edited.ArtistPath = current.ArtistPath
+			edited.ArtistAlbums = current.ArtistAlbums
+			edited.Fields, err = checkFields(edited.Fields)
+			if err != nil {
+				return err
+			}
+			encoded, err = json.Marshal(edited)
+		} else {
+			var current, edited AlbumStore
+			json.Unmarshal(descValue, &current)
+			err = json.Unmarshal(data, &edited)
+			if err != nil {
+				glog.Info("Wrong description JSON: ", err)
+				return errors.New("Wrong description JSON.")
+			}
+
+			edited.AlbumName = current.AlbumName
+			edited.AlbumPath = current.AlbumPath
+			edited.Fields, err = checkFields(edited.Fields)
+			if err != nil {
+				return err
+			}
+			encoded, err = json.Marshal(edited)
+		}
+
+		if err != nil {
+			return err
+		}
+		return b.Put([]byte(".description"), encoded)
+	})
+}
+
+// GetDescriptionNames returns the raw names of the Artist
+// and the Album stored in their descriptions.
+func GetDescriptionNames(artist, album string) (string, string, error) {
+	db, err := openDB()
+	if err != nil {
+		return "", "", err
+	}
+	defer db.Close()
+
+	var artistName, albumName string
+	err = db.View(func(tx *bolt.Tx) error {
+		b, err := descriptionBucket(tx, artist, "")
+		if err != nil {
+			return err
+		}
+
+		var artistStore ArtistStore
+		err = json.Unmarshal(b.Get([]byte(".description")), &artistStore)
+		if err != nil {
+			return err
+		}
+		artistName = artistStore.ArtistName
+
+		if len(album) < 1 {
+			return nil
+		}
+
+		b, err = descriptionBucket(tx, artist, album)
+		if err != nil {
+			return err
+		}
+
+		var albumStore AlbumStore
+		err = json.Unmarshal(b.Get([]byte(".description")), &albumStore)
+		if err != nil {
+			return err
+		}
+		albumName = albumStore.AlbumName
+		return nil
+	})
+	return artistName, albumName, err
+}
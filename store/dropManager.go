@@ -17,32 +17,109 @@
 package store
 
 import (
-	"errors"
+	"fmt"
+	"github.com/dankomiocevic/mulifs/metadata"
 	"github.com/dankomiocevic/mulifs/musicmgr"
 	"github.com/golang/glog"
+	"io/ioutil"
 	"os"
 	"path/filepath"
+	"strings"
+	"time"
 
 	"bazil.org/fuse"
+	"golang.org/x/net/context"
 )
 
+/** QuarantineDir is the Directory inside the drop
+ *  folder that keeps the files that could not be
+ *  added to the Music Library.
+ */
+const QuarantineDir = ".failed"
+
+/** reasonExtension is added to the name of a
+ *  quarantined file to store why it failed.
+ */
+const reasonExtension = ".reason"
+
 /** Deletes a file in the drop folder.
  */
 func deleteDrop(path string) {
 	os.Remove(path)
 }
 
+/** Moves a dropped file that could not be added to
+ *  the Music Library into the quarantine Directory,
+ *  the reason is stored in a file next to it.
+ *  A number is added to the name if another file with
+ *  the same name or its reason is already there.
+ */
+func quarantineDrop(path, rootPoint, reason string) {
+	glog.Errorf("Moving %s to quarantine: %s\n", path, reason)
+	dir := rootPoint + "drop/" + QuarantineDir + "/"
+	err := os.MkdirAll(dir, 0777)
+	if err != nil {
+		glog.Errorf("Cannot create the quarantine directory: %s\n", err)
+		return
+	}
+
+	_, name := filepath.Split(path)
+	extension := filepath.Ext(name)
+	for i := 1; ; i++ {
+		_, err := os.Lstat(dir + name)
+		_, reasonErr := os.Lstat(dir + name + reasonExtension)
+		if os.IsNotExist(err) && os.IsNotExist(reasonErr) {
+			break
+		}
+		name = fmt.Sprintf("%s_%d%s", strings.TrimSuffix(filepath.Base(path), extension), i, extension)
+	}
+
+	err = os.Rename(path, dir+name)
+	if err != nil {
+		glog.Errorf("Cannot move the file to quarantine: %s\n", err)
+		return
+	}
+
+	message := time.Now().Format(time.RFC3339) + " " + reason + "\n"
+	ioutil.WriteFile(dir+name+reasonExtension, []byte(message), 0666)
+}
+
 /** This function manages the Drop directory.
  *  The user can copy/create files into this directory and
  *  the files will be organized to the correct directory
  *  based on the file tags.
+ *  It returns the path of the Song inside MuLi.
+ *  The context stops the lookups of the Album and the
+ *  genre, the Song is filed with the tags it has then.
  */
-func HandleDrop(path, rootPoint string) error {
+func HandleDrop(ctx context.Context, path, rootPoint string) (string, error) {
 	glog.Infof("Handle drop with path: %s\n", path)
-	err, fileTags := musicmgr.GetMp3Tags(path)
+	if !musicmgr.IsMusicFile(path) {
+		quarantineDrop(path, rootPoint, "Only the music files are filed from the drop folder.")
+		return "", fuse.EIO
+	}
+
+	if err := musicmgr.CheckMusicSize(path); err != nil {
+		quarantineDrop(path, rootPoint, err.Error())
+		return "", fuse.EIO
+	}
+
+	err, fileTags := musicmgr.GetTags(path)
 	if err != nil {
-		deleteDrop(path)
-		return fuse.EIO
+		quarantineDrop(path, rootPoint, "Cannot read the tags: "+err.Error())
+		return "", fuse.EIO
+	}
+
+	if fileTags.Album == "unknown" && fileTags.Artist != "unknown" {
+		fileTags = identifyRelease(ctx, path, fileTags)
+	}
+	fileTags = inferGenre(ctx, path, fileTags)
+
+	err = preHook(config.Hooks.PreDrop, hookDrop, hookSong{Path: path, Artist: fileTags.Artist,
+		Album: fileTags.Album, Title: fileTags.Title, Track: fileTags.Track})
+	if err != nil {
+		quarantineDrop(path, rootPoint, err.Error())
+		return "", fuse.EIO
 	}
 
 	extension := filepath.Ext(path)
@@ -50,13 +127,15 @@ func HandleDrop(path, rootPoint string) error {
 	artist, err := CreateArtist(fileTags.Artist)
 	if err != nil && err != fuse.EEXIST {
 		glog.Infof("Error creating Artist: %s\n", err)
-		return err
+		quarantineDrop(path, rootPoint, "Cannot create the Artist: "+err.Error())
+		return "", err
 	}
 
 	album, err := CreateAlbum(artist, fileTags.Album)
 	if err != nil && err != fuse.EEXIST {
 		glog.Infof("Error creating Album: %s\n", err)
-		return err
+		quarantineDrop(path, rootPoint, "Cannot create the Album: "+err.Error())
+		return "", err
 	}
 
 	//_, file := filepath.Split(path)
@@ -64,18 +143,80 @@ func HandleDrop(path, rootPoint string) error {
 	os.MkdirAll(newPath, 0777)
 
 	file := GetCompatibleString(fileTags.Title) + extension
+	unlock := LockSong(artist, album, file)
+	defer unlock()
+
+	journalId, err := beginJournal(JournalEntry{
+		Op:        journalDrop,
+		Path:      path,
+		NewArtist: artist,
+		NewAlbum:  album,
+		NewName:   fileTags.Title + extension,
+		NewPath:   newPath + file,
+	})
+	if err != nil {
+		glog.Infof("Cannot write the journal: %s\n", err)
+		return "", fuse.EIO
+	}
+	defer endJournal(journalId)
+
 	err = os.Rename(path, newPath+file)
 	if err != nil {
 		glog.Infof("Error renaming song: %s\n", err)
-		return fuse.EIO
+		quarantineDrop(path, rootPoint, "Cannot move the Song to the Album: "+err.Error())
+		return "", fuse.EIO
 	}
 
-	_, err = CreateSong(artist, album, fileTags.Title+extension, newPath)
+	song, err := CreateSong(artist, album, fileTags.Title+extension, newPath)
 	deleteDrop(path)
 	if err != nil {
 		glog.Infof("Error creating song in the DB: %s\n", err)
+		return "", err
+	}
+
+	err = RefreshSongInfo(artist, album, song, newPath+file)
+	if err != nil {
+		glog.Infof("Cannot read the Song information: %s\n", err)
 	}
-	return err
+
+	postHook(config.Hooks.PostDrop, hookDrop, hookSong{Path: newPath + file, Artist: fileTags.Artist,
+		Album: fileTags.Album, Title: fileTags.Title, Track: fileTags.Track})
+	return artist + "/" + album + "/" + song, nil
+}
+
+/** SetReleaseIdentifier sets the identifier used to
+ *  find the Album of the dropped Songs without one.
+ */
+func SetReleaseIdentifier(identifier metadata.ReleaseIdentifier) {
+	config.Identifier = identifier
+}
+
+/** identifyRelease finds the Album of a dropped Song
+ *  and writes it in the tags of the file. The original
+ *  tags are returned if the Album cannot be found.
+ */
+func identifyRelease(ctx context.Context, path string, fileTags musicmgr.FileTags) musicmgr.FileTags {
+	if config.Identifier == nil {
+		return fileTags
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+	album, err := config.Identifier.Release(ctx, fileTags.Artist, fileTags.Title)
+	if err != nil {
+		glog.Infof("Cannot identify the release of %s: %s\n", path, err)
+		return fileTags
+	}
+
+	err = musicmgr.SetTags(fileTags.Artist, album, fileTags.Title, path)
+	if err != nil {
+		glog.Infof("Cannot write the Album to %s: %s\n", path, err)
+		return fileTags
+	}
+
+	glog.Infof("Identified the release of %s as %s\n", path, album)
+	fileTags.Album = album
+	return fileTags
 }
 
 /** Returns the path of a file in the drop directory.
@@ -92,7 +233,60 @@ func GetDropFilePath(name, mPoint string) (string, error) {
 	src, err := os.Stat(path)
 	if err == nil && src.IsDir() {
 		glog.Info("File not found.")
-		return "", errors.New("File not found.")
+		return "", fuse.ENOENT
+	}
+	return path, err
+}
+
+/** Returns the path of a file in the
+ *  quarantine Directory.
+ */
+func GetQuarantineFilePath(name, mPoint string) (string, error) {
+	rootPoint := mPoint
+	if rootPoint[len(rootPoint)-1] != '/' {
+		rootPoint = rootPoint + "/"
+	}
+
+	path := rootPoint + "drop/" + QuarantineDir + "/" + name
+	src, err := os.Stat(path)
+	if err == nil && src.IsDir() {
+		glog.Info("File not found.")
+		return "", fuse.ENOENT
 	}
 	return path, err
 }
+
+/** Deletes a file from the quarantine Directory
+ *  with the file that stores its reason.
+ */
+func DeleteQuarantined(name, mPoint string) error {
+	path, err := GetQuarantineFilePath(name, mPoint)
+	if err != nil {
+		return fuse.ENOENT
+	}
+
+	os.Remove(path + reasonExtension)
+	return os.Remove(path)
+}
+
+/** Moves a file from the quarantine Directory
+ *  back to the drop folder to process it again.
+ */
+func RedropQuarantined(name, newName, mPoint string) error {
+	path, err := GetQuarantineFilePath(name, mPoint)
+	if err != nil {
+		return fuse.ENOENT
+	}
+
+	rootPoint := mPoint
+	if rootPoint[len(rootPoint)-1] != '/' {
+		rootPoint = rootPoint + "/"
+	}
+
+	err = os.Rename(path, rootPoint+"drop/"+newName)
+	if err != nil {
+		return err
+	}
+	os.Remove(path + reasonExtension)
+	return nil
+}
@@ -0,0 +1,57 @@
+// Copyright 2016 Danko Miocevic. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Author: Danko Miocevic
+
+package store
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func TestQuarantineDropKeepsOtherFiles(t *testing.T) {
+	root := t.TempDir() + "/"
+	dir := root + "drop/" + QuarantineDir + "/"
+	if err := os.MkdirAll(dir, 0777); err != nil {
+		t.Fatal(err)
+	}
+	// A file quarantined before and the reason of another one.
+	if err := ioutil.WriteFile(dir+"song.mp3", []byte("first"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(dir+"song_1.mp3"+reasonExtension, []byte("second"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	path := root + "drop/song.mp3"
+	if err := ioutil.WriteFile(path, []byte("third"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	quarantineDrop(path, root, "Wrong file.")
+
+	if data, _ := ioutil.ReadFile(dir + "song.mp3"); string(data) != "first" {
+		t.Errorf("the quarantined file was replaced with %q", data)
+	}
+	if data, _ := ioutil.ReadFile(dir + "song_1.mp3" + reasonExtension); string(data) != "second" {
+		t.Errorf("the reason was replaced with %q", data)
+	}
+	if data, _ := ioutil.ReadFile(dir + "song_2.mp3"); string(data) != "third" {
+		t.Errorf("the file was not quarantined as song_2.mp3: %q", data)
+	}
+	if _, err := os.Stat(dir + "song_2.mp3" + reasonExtension); err != nil {
+		t.Errorf("the reason was not written: %s", err)
+	}
+}
@@ -0,0 +1,450 @@
+// Copyright 2016 Danko Miocevic. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Author: Danko Miocevic
+
+package store
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/boltdb/bolt"
+	"github.com/golang/glog"
+	"golang.org/x/crypto/pbkdf2"
+)
+
+// encryptedMagic is written at the start
+// of the encrypted database files.
+const encryptedMagic = "MULIENC1"
+
+// The sizes of the header of the encrypted files.
+const (
+	saltSize  = 16
+	nonceSize = 12
+)
+
+// keyIterations is the number of PBKDF2 iterations
+// used to derive the key from the passphrase.
+const keyIterations = 100000
+
+// The magic numbers of the filesystems kept in
+// memory, returned by statfs in the type field.
+const (
+	tmpfsMagic = 0x01021994
+	ramfsMagic = 0x858458f6
+)
+
+// privateBases are the Directories where the private
+// Directory of the working copies is created, the
+// first one kept in memory is used.
+var privateBases = []string{os.Getenv("XDG_RUNTIME_DIR"), "/dev/shm"}
+
+// encryption is the state of the encrypted database.
+// The database is decrypted to a working copy, in memory
+// when possible, that is used by all the operations and
+// encrypted again when it is flushed.
+var encryption struct {
+	mu      sync.Mutex
+	secret  []byte
+	path    string
+	work    string
+	salt    []byte
+	key     []byte
+	flushed time.Time
+	size    int64
+}
+
+// SetEncryptionSecret enables the encryption of the
+// database with the passphrase or the key file contents.
+// It must be called before InitDB.
+func SetEncryptionSecret(secret []byte) {
+	encryption.mu.Lock()
+	defer encryption.mu.Unlock()
+	encryption.secret = secret
+}
+
+// deriveKey derives the AES key from the
+// secret using PBKDF2 with HMAC-SHA256.
+func deriveKey(secret, salt []byte) []byte {
+	return pbkdf2.Key(secret, salt, keyIterations, 32, sha256.New)
+}
+
+// inMemory returns true if the Directory is
+// in a filesystem kept in memory.
+func inMemory(dir string) bool {
+	var st syscall.Statfs_t
+	if syscall.Statfs(dir, &st) != nil {
+		return false
+	}
+	return int64(st.Type) == tmpfsMagic || int64(st.Type) == ramfsMagic
+}
+
+// privateDir returns the Directory of the decrypted
+// working copies, it is created in a filesystem kept in
+// memory and only the user running MuLi can use it.
+// The database is not decrypted anywhere else.
+func privateDir() (string, error) {
+	for _, base := range privateBases {
+		if len(base) < 1 || !inMemory(base) {
+			continue
+		}
+
+		uid := os.Getuid()
+		dir := filepath.Join(base, "mulifs-"+strconv.Itoa(uid))
+		err := os.Mkdir(dir, 0700)
+		if err != nil && !os.IsExist(err) {
+			return "", err
+		}
+
+		// The Directory may have been created by another user.
+		fi, err := os.Lstat(dir)
+		if err != nil {
+			return "", err
+		}
+		st, ok := fi.Sys().(*syscall.Stat_t)
+		if !fi.IsDir() || !ok || int(st.Uid) != uid || fi.Mode().Perm() != 0700 {
+			return "", errors.New("The Directory " + dir + " is not private, the database is not decrypted.")
+		}
+		return dir, nil
+	}
+	return "", errors.New("There is no Directory kept in memory (/dev/shm or XDG_RUNTIME_DIR) to decrypt the database.")
+}
+
+// workingPath returns the path of the decrypted working
+// copy of a database in the private Directory, so it is
+// never written to the disk.
+func workingPath(path string) (string, error) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return "", err
+	}
+
+	dir, err := privateDir()
+	if err != nil {
+		return "", err
+	}
+
+	sum := sha256.Sum256([]byte(abs))
+	return filepath.Join(dir, "mulifs-"+hex.EncodeToString(sum[:8])+".db"), nil
+}
+
+// writeNew writes the data to a new file, a file left
+// in the path is removed first and the file is created
+// with O_EXCL so it is never opened through a link.
+func writeNew(path string, data []byte) error {
+	err := os.Remove(path)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(data)
+	if err == nil {
+		err = f.Sync()
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(path)
+	}
+	return err
+}
+
+// decryptFile returns the plain content of an encrypted
+// database and its salt, the files that are not
+// encrypted are returned without changes.
+func decryptFile(data, secret []byte) ([]byte, []byte, error) {
+	if !bytes.HasPrefix(data, []byte(encryptedMagic)) {
+		return data, nil, nil
+	}
+
+	header := len(encryptedMagic) + saltSize + nonceSize
+	if len(data) < header {
+		return nil, nil, errors.New("The encrypted database is truncated.")
+	}
+
+	salt := data[len(encryptedMagic) : len(encryptedMagic)+saltSize]
+	nonce := data[len(encryptedMagic)+saltSize : header]
+	gcm, err := newGCM(deriveKey(secret, salt))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	plain, err := gcm.Open(nil, nonce, data[header:], []byte(encryptedMagic))
+	if err != nil {
+		return nil, nil, errors.New("Cannot decrypt the database, the passphrase is wrong or the file is corrupted.")
+	}
+	return plain, salt, nil
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// openEncrypted decrypts the database to its working copy
+// and returns the path of the working copy, the database
+// opened before is closed.
+// A working copy newer than the encrypted file has changes
+// that were not flushed when MuLi stopped, it is kept.
+func openEncrypted(path string) (string, error) {
+	encryption.mu.Lock()
+	defer encryption.mu.Unlock()
+
+	err := closeEncrypted()
+	if err != nil {
+		return "", err
+	}
+
+	work, err := workingPath(path)
+	if err != nil {
+		return "", err
+	}
+
+	var salt []byte
+	var recovered bool
+	src, srcErr := os.Stat(path)
+	dst, dstErr := os.Stat(work)
+	if srcErr == nil && (dstErr != nil || !dst.ModTime().After(src.ModTime())) {
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			return "", err
+		}
+
+		var plain []byte
+		plain, salt, err = decryptFile(data, encryption.secret)
+		if err != nil {
+			return "", err
+		}
+		if salt == nil {
+			glog.Infof("The database %s is not encrypted, it is encrypted when flushed.\n", path)
+		}
+
+		err = writeNew(work+".tmp", plain)
+		if err != nil {
+			return "", err
+		}
+		err = os.Rename(work+".tmp", work)
+		if err != nil {
+			return "", err
+		}
+	} else if srcErr == nil {
+		glog.Infof("Recovering the changes not flushed to %s from %s.\n", path, work)
+		recovered = true
+		data, err := ioutil.ReadFile(path)
+		if err == nil {
+			_, salt, err = decryptFile(data, encryption.secret)
+		}
+		if err != nil {
+			return "", err
+		}
+	}
+
+	if salt == nil {
+		salt = make([]byte, saltSize)
+		if _, err := io.ReadFull(rand.Reader, salt); err != nil {
+			return "", err
+		}
+	}
+
+	encryption.path = path
+	encryption.work = work
+	encryption.salt = salt
+	encryption.key = deriveKey(encryption.secret, salt)
+	encryption.flushed = time.Time{}
+	encryption.size = 0
+
+	// The recovered changes are encrypted at once, so the
+	// decrypted copy left by the crash is not needed again.
+	if recovered {
+		err = flushEncrypted()
+		if err != nil {
+			return "", err
+		}
+	}
+	return work, nil
+}
+
+// readableCopy returns the path of a plain copy of the
+// database to read it while another one is opened, and
+// the function that removes the copy when it is done.
+// The copy is a new file in the private Directory, the
+// copies older than an hour were left by a crash and
+// they are removed.
+// The databases that are not encrypted are not copied.
+func readableCopy(path string) (string, func(), error) {
+	none := func() {}
+	data, err := ioutil.ReadFile(path)
+	if err != nil || !bytes.HasPrefix(data, []byte(encryptedMagic)) {
+		return path, none, nil
+	}
+
+	plain, _, err := decryptFile(data, encryption.secret)
+	if err != nil {
+		return "", none, err
+	}
+
+	dir, err := privateDir()
+	if err != nil {
+		return "", none, err
+	}
+	old, _ := filepath.Glob(filepath.Join(dir, "*.read"))
+	for _, name := range old {
+		if fi, err := os.Stat(name); err == nil && time.Since(fi.ModTime()) > time.Hour {
+			os.Remove(name)
+		}
+	}
+
+	f, err := ioutil.TempFile(dir, "mulifs-*.read")
+	if err != nil {
+		return "", none, err
+	}
+	work := f.Name()
+	_, err = f.Write(plain)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(work)
+		return "", none, err
+	}
+	return work, func() { os.Remove(work) }, nil
+}
+
+// FlushDB encrypts the working copy of the database
+// to its file if it changed since the last flush.
+// It does nothing if the database is not encrypted.
+func FlushDB() error {
+	encryption.mu.Lock()
+	defer encryption.mu.Unlock()
+	return flushEncrypted()
+}
+
+func flushEncrypted() error {
+	if len(encryption.work) < 1 {
+		return nil
+	}
+
+	fi, err := os.Stat(encryption.work)
+	if err != nil {
+		return err
+	}
+	if fi.ModTime().Equal(encryption.flushed) && fi.Size() == encryption.size {
+		return nil
+	}
+
+	// The read only transaction waits for the
+	// running updates and copies a consistent state.
+	dbSwap.RLock()
+	db, err := bolt.Open(encryption.work, 0600, &bolt.Options{ReadOnly: true})
+	dbSwap.RUnlock()
+	if err != nil {
+		return err
+	}
+	var plain bytes.Buffer
+	err = db.View(func(tx *bolt.Tx) error {
+		_, err := tx.WriteTo(&plain)
+		return err
+	})
+	db.Close()
+	if err != nil {
+		return err
+	}
+
+	gcm, err := newGCM(encryption.key)
+	if err != nil {
+		return err
+	}
+	nonce := make([]byte, nonceSize)
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return err
+	}
+
+	data := append([]byte(encryptedMagic), encryption.salt...)
+	data = append(data, nonce...)
+	data = gcm.Seal(data, nonce, plain.Bytes(), []byte(encryptedMagic))
+	err = writeNew(encryption.path+".tmp", data)
+	if err != nil {
+		return err
+	}
+	err = os.Rename(encryption.path+".tmp", encryption.path)
+	if err != nil {
+		return err
+	}
+
+	encryption.flushed = fi.ModTime()
+	encryption.size = fi.Size()
+	return nil
+}
+
+// CloseDB flushes the encrypted database and removes
+// its working copy, it must be called before exiting.
+// The database kept in memory is removed and the
+// lock of the database modified is released.
+func CloseDB() error {
+	memory.mu.Lock()
+	err := closeMemory()
+	memory.mu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	encryption.mu.Lock()
+	err = closeEncrypted()
+	encryption.mu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	unlockDB()
+	return nil
+}
+
+func closeEncrypted() error {
+	if len(encryption.work) < 1 {
+		return nil
+	}
+
+	// The working copy is kept if it cannot be flushed,
+	// it is recovered the next time the database is opened.
+	err := flushEncrypted()
+	if err != nil {
+		return err
+	}
+
+	err = os.Remove(encryption.work)
+	encryption.work = ""
+	return err
+}
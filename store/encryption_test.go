@@ -0,0 +1,176 @@
+// Copyright 2016 Danko Miocevic. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Author: Danko Miocevic
+
+package store
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/boltdb/bolt"
+)
+
+// usePrivateBase makes the working copies use a Directory
+// inside /dev/shm, the test is skipped without it.
+func usePrivateBase(t *testing.T) {
+	if !inMemory("/dev/shm") {
+		t.Skip("/dev/shm is not kept in memory")
+	}
+	base, err := ioutil.TempDir("/dev/shm", "mulifs-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	old := privateBases
+	privateBases = []string{base}
+	t.Cleanup(func() {
+		privateBases = old
+		os.RemoveAll(base)
+	})
+}
+
+func TestPrivateDirNeedsMemory(t *testing.T) {
+	old := privateBases
+	defer func() { privateBases = old }()
+
+	privateBases = []string{t.TempDir()}
+	if inMemory(privateBases[0]) {
+		t.Skip("the temporary Directory is kept in memory")
+	}
+	if _, err := privateDir(); err == nil {
+		t.Error("privateDir accepted a Directory on the disk")
+	}
+}
+
+func TestPrivateDirRejectsShared(t *testing.T) {
+	usePrivateBase(t)
+	dir, err := privateDir()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chmod(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := privateDir(); err == nil {
+		t.Error("privateDir accepted a Directory readable by other users")
+	}
+}
+
+func TestWriteNewDoesNotFollowLinks(t *testing.T) {
+	dir := t.TempDir()
+	target := filepath.Join(dir, "target")
+	if err := ioutil.WriteFile(target, []byte("keep"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	link := filepath.Join(dir, "work.tmp")
+	if err := os.Symlink(target, link); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := writeNew(link, []byte("secret")); err != nil {
+		t.Fatal(err)
+	}
+	data, _ := ioutil.ReadFile(target)
+	if string(data) != "keep" {
+		t.Errorf("the link was followed, the target has %q", data)
+	}
+	fi, err := os.Lstat(link)
+	if err != nil || fi.Mode()&os.ModeSymlink != 0 || fi.Mode().Perm() != 0600 {
+		t.Errorf("wrong file written: %v, %v", fi, err)
+	}
+}
+
+func TestEncryptionRoundTrip(t *testing.T) {
+	usePrivateBase(t)
+	SetEncryptionSecret([]byte("passphrase"))
+	defer SetEncryptionSecret(nil)
+
+	path := filepath.Join(t.TempDir(), "muli.db")
+	work, err := openEncrypted(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	db, err := bolt.Open(work, 0600, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		b, err := tx.CreateBucketIfNotExists([]byte("Artists"))
+		if err != nil {
+			return err
+		}
+		return b.Put([]byte("Some_Artist"), []byte("{}"))
+	})
+	db.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := FlushDB(); err != nil {
+		t.Fatal(err)
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.HasPrefix(data, []byte(encryptedMagic)) || bytes.Contains(data, []byte("Some_Artist")) {
+		t.Fatal("the database was not encrypted")
+	}
+
+	if _, _, err := decryptFile(data, []byte("wrong")); err == nil {
+		t.Error("the database was decrypted with a wrong passphrase")
+	}
+
+	encryption.mu.Lock()
+	err = closeEncrypted()
+	encryption.mu.Unlock()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(work); !os.IsNotExist(err) {
+		t.Error("the working copy was not removed")
+	}
+
+	work, err = openEncrypted(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		encryption.mu.Lock()
+		closeEncrypted()
+		encryption.mu.Unlock()
+	}()
+
+	db, err = bolt.Open(work, 0600, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	err = db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte("Artists"))
+		if b == nil || b.Get([]byte("Some_Artist")) == nil {
+			t.Error("the decrypted database lost the Artist")
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,276 @@
+// Copyright 2016 Danko Miocevic. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Author: Danko Miocevic
+
+package store
+
+import (
+	"encoding/json"
+	"errors"
+	"strconv"
+	"strings"
+
+	"github.com/boltdb/bolt"
+)
+
+// The types of the custom fields of the descriptions.
+const (
+	FieldText   = "text"
+	FieldBool   = "bool"
+	FieldNumber = "number"
+)
+
+// DescriptionField is a custom field of the descriptions
+// of the Artists and Albums defined by the user.
+type DescriptionField struct {
+	Name string
+	Type string
+}
+
+// descriptionFields are the custom fields shown
+// in the .description files, in order.
+var descriptionFields []DescriptionField
+
+// ParseDescriptionField parses a custom field written
+// as NAME:TYPE, the type is text if it is missing.
+func ParseDescriptionField(s string) (DescriptionField, error) {
+	items := strings.SplitN(s, ":", 2)
+	field := DescriptionField{Name: strings.TrimSpace(items[0]), Type: FieldText}
+	if len(items) == 2 {
+		field.Type = strings.ToLower(strings.TrimSpace(items[1]))
+	}
+
+	if len(field.Name) < 1 {
+		return field, errors.New("The name of the description field is empty.")
+	}
+	if field.Type != FieldText && field.Type != FieldBool && field.Type != FieldNumber {
+		return field, errors.New("The type of the description field must be text, bool or number.")
+	}
+	return field, nil
+}
+
+// SetDescriptionFields sets the custom fields of the descriptions.
+func SetDescriptionFields(fields []DescriptionField) {
+	descriptionFields = fields
+}
+
+// findField returns the custom field with the name.
+func findField(name string) (DescriptionField, bool) {
+	for _, f := range descriptionFields {
+		if f.Name == name {
+			return f, true
+		}
+	}
+	return DescriptionField{}, false
+}
+
+// zero returns the empty value of the field.
+func (f DescriptionField) zero() interface{} {
+	switch f.Type {
+	case FieldBool:
+		return false
+	case FieldNumber:
+		return 0
+	}
+	return ""
+}
+
+// format returns the value of the field as text, the
+// missing values are formatted as the empty value.
+func (f DescriptionField) format(v interface{}) string {
+	switch value := v.(type) {
+	case string:
+		return value
+	case bool:
+		return strconv.FormatBool(value)
+	case float64:
+		return strconv.FormatFloat(value, 'f', -1, 64)
+	case nil:
+		return f.format(f.zero())
+	case int:
+		return strconv.Itoa(value)
+	}
+	return ""
+}
+
+// checkFields returns an error if the edited fields are not
+// defined or have the wrong type. The empty values are
+// removed, they are shown from the definitions.
+func checkFields(fields map[string]interface{}) (map[string]interface{}, error) {
+	checked := make(map[string]interface{})
+	for name, v := range fields {
+		f, ok := findField(name)
+		if !ok {
+			return nil, errors.New("Unknown description field " + name + ".")
+		}
+
+		empty := false
+		switch value := v.(type) {
+		case string:
+			ok = f.Type == FieldText
+			empty = len(value) < 1
+		case bool:
+			ok = f.Type == FieldBool
+			empty = !value
+		case float64:
+			ok = f.Type == FieldNumber
+			empty = value == 0
+		case nil:
+			empty = true
+		default:
+			ok = false
+		}
+
+		if !ok {
+			return nil, errors.New("The description field " + name + " must be " + f.Type + ".")
+		}
+		if !empty {
+			checked[name] = v
+		}
+	}
+
+	if len(checked) < 1 {
+		return nil, nil
+	}
+	return checked, nil
+}
+
+// completeFields adds the custom fields without
+// value to the fields of a description.
+func completeFields(fields map[string]interface{}) map[string]interface{} {
+	if len(descriptionFields) < 1 {
+		return fields
+	}
+
+	complete := make(map[string]interface{})
+	for k, v := range fields {
+		complete[k] = v
+	}
+	for _, f := range descriptionFields {
+		if _, ok := complete[f.Name]; !ok {
+			complete[f.Name] = f.zero()
+		}
+	}
+	return complete
+}
+
+// completeDescription returns the JSON of the description
+// of the Artist or the Album with every custom field.
+func completeDescription(descJson []byte, album string) []byte {
+	if len(descriptionFields) < 1 {
+		return descJson
+	}
+
+	var encoded []byte
+	var err error
+	if len(album) < 1 {
+		var desc ArtistStore
+		json.Unmarshal(descJson, &desc)
+		desc.Fields = completeFields(desc.Fields)
+		encoded, err = json.Marshal(desc)
+	} else {
+		var desc AlbumStore
+		json.Unmarshal(descJson, &desc)
+		desc.Fields = completeFields(desc.Fields)
+		encoded, err = json.Marshal(desc)
+	}
+
+	if err != nil {
+		return descJson
+	}
+	return encoded
+}
+
+// descriptionFieldValues returns the custom fields
+// set in the description of the Bucket as text.
+func descriptionFieldValues(b *bolt.Bucket) map[string]string {
+	var desc struct {
+		Fields map[string]interface{}
+	}
+	descValue := b.Get([]byte(".description"))
+	if descValue == nil || json.Unmarshal(descValue, &desc) != nil {
+		return nil
+	}
+
+	values := make(map[string]string)
+	for name, v := range desc.Fields {
+		f, _ := findField(name)
+		values[name] = f.format(v)
+	}
+	return values
+}
+
+// FieldValues are the custom fields of the descriptions
+// of every Artist and Album as text, the Album is empty
+// for the Artists. Only the fields set are included.
+type FieldValues map[AlbumRef]map[string]string
+
+// ListFieldValues returns the custom fields
+// set in the descriptions of the Library.
+func ListFieldValues() (FieldValues, error) {
+	db, err := openDB()
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	values := make(FieldValues)
+	err = db.View(func(tx *bolt.Tx) error {
+		root := tx.Bucket([]byte("Artists"))
+		return root.ForEach(func(artist, v []byte) error {
+			if v != nil {
+				return nil
+			}
+
+			artistBucket := root.Bucket(artist)
+			values[AlbumRef{Artist: string(artist)}] = descriptionFieldValues(artistBucket)
+			return artistBucket.ForEach(func(album, w []byte) error {
+				if w == nil {
+					ref := AlbumRef{Artist: string(artist), Album: string(album)}
+					values[ref] = descriptionFieldValues(artistBucket.Bucket(album))
+				}
+				return nil
+			})
+		})
+	})
+
+	if err != nil {
+		return nil, err
+	}
+	return values, nil
+}
+
+// Match returns true if the custom fields of the Album of
+// the Song have the values, ignoring the case. The fields
+// not set in the Album are taken from the Artist.
+func (values FieldValues) Match(ref SongRef, fields map[string]string) bool {
+	album := values[AlbumRef{Artist: ref.Artist, Album: ref.Album}]
+	artist := values[AlbumRef{Artist: ref.Artist}]
+	for name, want := range fields {
+		got, ok := album[name]
+		if !ok {
+			got, ok = artist[name]
+		}
+		if !ok {
+			f, _ := findField(name)
+			got = f.format(nil)
+		}
+
+		if !strings.EqualFold(got, strings.TrimSpace(want)) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,120 @@
+// Copyright 2016 Danko Miocevic. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Author: Danko Miocevic
+
+package store
+
+import (
+	"encoding/json"
+	"github.com/dankomiocevic/mulifs/metadata"
+	"github.com/dankomiocevic/mulifs/musicmgr"
+	"strings"
+	"time"
+
+	"github.com/boltdb/bolt"
+	"github.com/golang/glog"
+	"golang.org/x/net/context"
+)
+
+// SetGenreInference fills the genre of the dropped Songs
+// without one with the most common genre of the other
+// Songs of their Artist, or with the classifier when
+// the Artist has none. The classifier is optional.
+func SetGenreInference(classifier metadata.GenreClassifier) {
+	config.InferGenres = true
+	config.Classifier = classifier
+}
+
+// missingGenre returns true if the genre is empty or unknown.
+func missingGenre(genre string) bool {
+	genre = strings.TrimSpace(genre)
+	return len(genre) < 1 || strings.EqualFold(genre, "unknown")
+}
+
+// artistGenre returns the most common genre of the
+// Songs of an Artist in the Library.
+func artistGenre(artist string) string {
+	db, err := openDB()
+	if err != nil {
+		return ""
+	}
+	defer db.Close()
+
+	counts := make(map[string]int)
+	var genre string
+	db.View(func(tx *bolt.Tx) error {
+		artistBucket := tx.Bucket([]byte("Artists")).Bucket([]byte(GetCompatibleString(artist)))
+		if artistBucket == nil {
+			return nil
+		}
+
+		return artistBucket.ForEach(func(album, v []byte) error {
+			albumBucket := artistBucket.Bucket(album)
+			if v != nil || albumBucket == nil {
+				return nil
+			}
+
+			return albumBucket.ForEach(func(song, data []byte) error {
+				var songStore SongStore
+				if song[0] == '.' || json.Unmarshal(data, &songStore) != nil || missingGenre(songStore.Genre) {
+					return nil
+				}
+
+				g := strings.TrimSpace(songStore.Genre)
+				counts[g]++
+				if counts[g] > counts[genre] || (counts[g] == counts[genre] && g < genre) {
+					genre = g
+				}
+				return nil
+			})
+		})
+	})
+	return genre
+}
+
+// inferGenre finds the genre of a dropped Song without one
+// and writes it in the tags of the file. The original
+// tags are returned if the genre cannot be found.
+func inferGenre(ctx context.Context, path string, fileTags musicmgr.FileTags) musicmgr.FileTags {
+	if !config.InferGenres || !missingGenre(fileTags.Genre) || fileTags.Artist == "unknown" {
+		return fileTags
+	}
+
+	genre := artistGenre(fileTags.Artist)
+	if len(genre) < 1 && config.Classifier != nil {
+		ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+		defer cancel()
+
+		var err error
+		genre, err = config.Classifier.Genre(ctx, fileTags.Artist, fileTags.Title)
+		if err != nil {
+			glog.Infof("Cannot classify the genre of %s: %s\n", path, err)
+			return fileTags
+		}
+	}
+	if len(genre) < 1 {
+		return fileTags
+	}
+
+	err := musicmgr.SetGenre(genre, path)
+	if err != nil {
+		glog.Infof("Cannot write the genre to %s: %s\n", path, err)
+		return fileTags
+	}
+
+	glog.Infof("Inferred the genre of %s as %s\n", path, genre)
+	fileTags.Genre = genre
+	return fileTags
+}
@@ -0,0 +1,182 @@
+// Copyright 2016 Danko Miocevic. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Author: Danko Miocevic
+
+package store
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dankomiocevic/mulifs/musicmgr"
+	"github.com/golang/glog"
+	"golang.org/x/net/context"
+)
+
+// Hooks are the commands run before and after the
+// dropped Songs are added and the Songs are retagged.
+// The pre hooks can stop the operation by failing,
+// the post hooks run in the background.
+type Hooks struct {
+	PreDrop   []string
+	PostDrop  []string
+	PreRetag  []string
+	PostRetag []string
+}
+
+// hookTimeout is the time a hook can run
+// before it is killed and considered failed.
+var hookTimeout = time.Minute
+
+// postHookQueue is the number of post hooks waiting to
+// run, they run one at a time. When the queue is full
+// the new post hooks are skipped.
+const postHookQueue = 256
+
+// postHooks runs the queued post hooks in order.
+var postHooks struct {
+	once  sync.Once
+	queue chan func()
+}
+
+// The events passed to the hooks.
+const (
+	hookDrop  = "drop"
+	hookRetag = "retag"
+)
+
+// hookSong is the Song passed to the hooks in the
+// environment, the old fields are only used to retag.
+type hookSong struct {
+	Path      string
+	Artist    string
+	Album     string
+	Title     string
+	Track     string
+	OldPath   string
+	OldArtist string
+	OldAlbum  string
+	OldTitle  string
+}
+
+// SetHooks sets the commands run before and
+// after the drops and the retags.
+func SetHooks(hooks Hooks) {
+	config.Hooks = hooks
+}
+
+// environment returns the environment of the hook
+// command with the event and the Song.
+func (s hookSong) environment(event string) []string {
+	env := append(os.Environ(), "MULIFS_EVENT="+event, "MULIFS_PATH="+s.Path,
+		"MULIFS_ARTIST="+s.Artist, "MULIFS_ALBUM="+s.Album,
+		"MULIFS_TITLE="+s.Title, "MULIFS_TRACK="+s.Track)
+	if len(s.OldPath) > 0 {
+		env = append(env, "MULIFS_OLD_PATH="+s.OldPath, "MULIFS_OLD_ARTIST="+s.OldArtist,
+			"MULIFS_OLD_ALBUM="+s.OldAlbum, "MULIFS_OLD_TITLE="+s.OldTitle)
+	}
+	return env
+}
+
+// runHook runs the command with the Song in the
+// environment and the path as the last argument.
+// The command is killed after hookTimeout.
+func runHook(command []string, event string, s hookSong) error {
+	ctx, cancel := context.WithTimeout(context.Background(), hookTimeout)
+	defer cancel()
+
+	args := append(append([]string{}, command[1:]...), s.Path)
+	cmd := exec.CommandContext(ctx, command[0], args...)
+	cmd.Env = s.environment(event)
+	// The children of the hook may keep the output open.
+	cmd.WaitDelay = time.Second
+	out, err := cmd.CombinedOutput()
+	if ctx.Err() == context.DeadlineExceeded {
+		err = errors.New("timed out after " + hookTimeout.String())
+	}
+	if err != nil {
+		message := "The " + event + " hook failed: " + err.Error()
+		if output := strings.TrimSpace(string(out)); len(output) > 0 {
+			message += ": " + output
+		}
+		return errors.New(message)
+	}
+	return nil
+}
+
+// preHook runs the pre hook, the operation
+// must be stopped if it returns an error.
+func preHook(command []string, event string, s hookSong) error {
+	if len(command) < 1 {
+		return nil
+	}
+	return runHook(command, event, s)
+}
+
+// postHook queues the post hook to run in the background.
+func postHook(command []string, event string, s hookSong) {
+	if len(command) < 1 {
+		return
+	}
+
+	postHooks.once.Do(func() {
+		postHooks.queue = make(chan func(), postHookQueue)
+		go func() {
+			for hook := range postHooks.queue {
+				hook()
+			}
+		}()
+	})
+
+	hook := func() {
+		if err := runHook(command, event, s); err != nil {
+			glog.Error(err)
+		}
+	}
+	select {
+	case postHooks.queue <- hook:
+	default:
+		glog.Errorf("Too many %s hooks waiting, skipping the hook of %s\n", event, s.Path)
+	}
+}
+
+// taggedSong returns the Song in the path
+// with the tags read from the file.
+func taggedSong(path string) hookSong {
+	s := hookSong{Path: path}
+	if err, tags := musicmgr.GetTags(path); err == nil {
+		s.Artist, s.Album, s.Title, s.Track = tags.Artist, tags.Album, tags.Title, tags.Track
+	}
+	return s
+}
+
+// retagHooks returns true if there are retag hooks.
+func retagHooks() bool {
+	return len(config.Hooks.PreRetag) > 0 || len(config.Hooks.PostRetag) > 0
+}
+
+// retaggedSong returns the Song in the path with the new
+// tags and its current tags as the old ones, it must be
+// called before the file is retagged. The path is replaced
+// with the new path of the file for the post hook.
+func retaggedSong(path, artist, album, title string) hookSong {
+	old := taggedSong(path)
+	return hookSong{Path: path, Artist: artist, Album: album, Title: title, Track: old.Track,
+		OldPath: path, OldArtist: old.Artist, OldAlbum: old.Album, OldTitle: old.Title}
+}
@@ -0,0 +1,47 @@
+// Copyright 2016 Danko Miocevic. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Author: Danko Miocevic
+
+package store
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRunHookEnvironment(t *testing.T) {
+	command := []string{"sh", "-c", `test "$MULIFS_EVENT" = drop -a "$MULIFS_ARTIST" = Some -a "$0" = /song.mp3`}
+	if err := runHook(command, hookDrop, hookSong{Path: "/song.mp3", Artist: "Some"}); err != nil {
+		t.Error(err)
+	}
+	if err := runHook(command, hookRetag, hookSong{Path: "/song.mp3", Artist: "Some"}); err == nil {
+		t.Error("the failed hook returned no error")
+	}
+}
+
+func TestRunHookTimeout(t *testing.T) {
+	old := hookTimeout
+	hookTimeout = 100 * time.Millisecond
+	defer func() { hookTimeout = old }()
+
+	start := time.Now()
+	err := runHook([]string{"sleep", "10"}, hookDrop, hookSong{Path: "1"})
+	if err == nil {
+		t.Error("the hook did not time out")
+	}
+	if time.Since(start) > 5*time.Second {
+		t.Errorf("the hook was stopped after %s", time.Since(start))
+	}
+}
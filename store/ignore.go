@@ -0,0 +1,94 @@
+// Copyright 2016 Danko Miocevic. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Author: Danko Miocevic
+
+package store
+
+import (
+	"path/filepath"
+	"strings"
+)
+
+// ignorePatterns are the globs of the files and Directories
+// in the source Directory that never enter the Music Library.
+var ignorePatterns []string
+
+// SetIgnorePatterns sets the globs of the files and Directories
+// ignored in the source Directory. The patterns without a slash
+// match the name of the file or Directory anywhere in the tree
+// and the others match the path relative to the source Directory,
+// where ** matches any number of Directories.
+func SetIgnorePatterns(patterns []string) {
+	ignorePatterns = patterns
+}
+
+// IsIgnored returns true if the file or Directory inside
+// the root path matches any of the ignore patterns, the
+// case of the names is ignored.
+func IsIgnored(root, path string) bool {
+	if len(ignorePatterns) < 1 {
+		return false
+	}
+
+	rel, err := filepath.Rel(root, path)
+	if err != nil || rel == "." || strings.HasPrefix(rel, "..") {
+		return false
+	}
+
+	rel = strings.ToLower(filepath.ToSlash(rel))
+	name := rel[strings.LastIndex(rel, "/")+1:]
+	for _, p := range ignorePatterns {
+		p = strings.ToLower(strings.Trim(filepath.ToSlash(p), "/"))
+		if !strings.Contains(p, "/") {
+			if ok, _ := filepath.Match(p, name); ok {
+				return true
+			}
+			continue
+		}
+
+		if matchSegments(strings.Split(p, "/"), strings.Split(rel, "/")) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchSegments matches the segments of a path against the
+// segments of a pattern, ** matches any number of segments.
+// A pattern ending with ** matches the Directory itself,
+// so it is skipped entirely while scanning.
+func matchSegments(pattern, path []string) bool {
+	if len(pattern) < 1 {
+		return len(path) < 1
+	}
+
+	if pattern[0] == "**" {
+		for i := 0; i <= len(path); i++ {
+			if matchSegments(pattern[1:], path[i:]) {
+				return true
+			}
+		}
+		return false
+	}
+
+	if len(path) < 1 {
+		return false
+	}
+
+	if ok, _ := filepath.Match(pattern[0], path[0]); !ok {
+		return false
+	}
+	return matchSegments(pattern[1:], path[1:])
+}
@@ -0,0 +1,268 @@
+// Copyright 2016 Danko Miocevic. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Author: Danko Miocevic
+
+package store
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/dankomiocevic/mulifs/musicmgr"
+	"sort"
+	"strconv"
+
+	"bazil.org/fuse"
+	"github.com/boltdb/bolt"
+	"github.com/golang/glog"
+)
+
+// The indexes of the Songs by the names in their tags.
+// Every index has a bucket for every name with the
+// Songs indexed by indexKey.
+const (
+	ComposersIndex  = "Composers"
+	ConductorsIndex = "Conductors"
+	BPMIndex        = "BPM"
+	KeysIndex       = "Keys"
+	QualityIndex    = "Quality"
+	RatingsIndex    = "Ratings"
+)
+
+// bpmRangeSize is the size of the BPM ranges
+// used as the names in the BPM index.
+const bpmRangeSize = 10
+
+// bpmRange returns the name of the BPM range
+// of the BPM index, like 120-129.
+func bpmRange(bpm string) string {
+	n, err := strconv.Atoi(bpm)
+	if err != nil {
+		return ""
+	}
+
+	low := n / bpmRangeSize * bpmRangeSize
+	return fmt.Sprintf("%03d-%03d", low, low+bpmRangeSize-1)
+}
+
+// bitrateTiers are the lower bounds in kbps
+// of the bitrate tiers of the Quality index.
+var bitrateTiers = []int{0, 128, 192, 256, 320}
+
+// qualityTier returns the name of the Song in the
+// Quality index, lossless for the lossless codecs,
+// the bitrate tier, like 128-191, for the others or
+// lossy if the bitrate is unknown.
+func qualityTier(song SongStore) string {
+	if len(song.Codec) < 1 {
+		return ""
+	}
+	if musicmgr.IsLosslessCodec(song.Codec) {
+		return "lossless"
+	}
+
+	n, err := strconv.Atoi(song.Bitrate)
+	if err != nil {
+		return "lossy"
+	}
+
+	for i := len(bitrateTiers) - 1; i > 0; i-- {
+		if n >= bitrateTiers[i] {
+			if i == len(bitrateTiers)-1 {
+				return fmt.Sprintf("%d+", bitrateTiers[i])
+			}
+			return fmt.Sprintf("%d-%d", bitrateTiers[i], bitrateTiers[i+1]-1)
+		}
+	}
+	return fmt.Sprintf("%d-%d", bitrateTiers[0], bitrateTiers[1]-1)
+}
+
+// ratingName returns the name of the
+// Ratings index, like 4-stars.
+func ratingName(rating int) string {
+	switch {
+	case rating < 1:
+		return ""
+	case rating == 1:
+		return "1-star"
+	}
+	return fmt.Sprintf("%d-stars", rating)
+}
+
+// SetBPMCommand sets the command used to compute
+// the BPM of the Songs without the BPM tag.
+func SetBPMCommand(command []string) {
+	config.BPMCommand = command
+}
+
+// songBPM returns the BPM stored for the Song or
+// computes it with the BPM command.
+// It must be called before opening the database.
+func songBPM(old SongStore, path string) string {
+	if len(old.BPM) > 0 || len(config.BPMCommand) < 1 {
+		return old.BPM
+	}
+
+	bpm, err := musicmgr.ComputeBPM(config.BPMCommand, path)
+	if err != nil {
+		glog.Errorf("Cannot compute the BPM of %s: %s\n", path, err)
+	}
+	return bpm
+}
+
+// indexKey returns the key of a Song in an index.
+func indexKey(ref SongRef) []byte {
+	return []byte(ref.Artist + "/" + ref.Album + "/" + ref.Song)
+}
+
+// indexSong moves the Song from the old name to
+// the new one in the index, the empty names are
+// not indexed.
+func indexSong(tx *bolt.Tx, index, oldName, newName string, ref SongRef) error {
+	root, err := tx.CreateBucketIfNotExists([]byte(index))
+	if err != nil {
+		return err
+	}
+
+	if len(oldName) > 0 && oldName != newName {
+		if b := root.Bucket([]byte(oldName)); b != nil {
+			b.Delete(indexKey(ref))
+		}
+	}
+
+	if len(newName) < 1 {
+		return nil
+	}
+
+	b, err := root.CreateBucketIfNotExists([]byte(newName))
+	if err != nil {
+		return err
+	}
+
+	encoded, err := json.Marshal(ref)
+	if err != nil {
+		return err
+	}
+	return b.Put(indexKey(ref), encoded)
+}
+
+// indexSongTags updates the Composer, Conductor,
+// BPM, Key, Quality and Ratings indexes for a Song.
+func indexSongTags(tx *bolt.Tx, old, song SongStore, ref SongRef) error {
+	err := indexSong(tx, ComposersIndex, GetCompatibleString(old.Composer), GetCompatibleString(song.Composer), ref)
+	if err != nil {
+		return err
+	}
+
+	err = indexSong(tx, ConductorsIndex, GetCompatibleString(old.Conductor), GetCompatibleString(song.Conductor), ref)
+	if err != nil {
+		return err
+	}
+	err = indexSong(tx, BPMIndex, bpmRange(old.BPM), bpmRange(song.BPM), ref)
+	if err != nil {
+		return err
+	}
+	err = indexSong(tx, KeysIndex, old.Key, song.Key, ref)
+	if err != nil {
+		return err
+	}
+	err = indexSong(tx, QualityIndex, qualityTier(old), qualityTier(song), ref)
+	if err != nil {
+		return err
+	}
+	return indexSong(tx, RatingsIndex, ratingName(old.Rating), ratingName(song.Rating), ref)
+}
+
+// songExists returns true if the Song is
+// still in the Music Library.
+func songExists(tx *bolt.Tx, ref SongRef) bool {
+	artist := tx.Bucket([]byte("Artists")).Bucket([]byte(ref.Artist))
+	if artist == nil {
+		return false
+	}
+
+	album := artist.Bucket([]byte(ref.Album))
+	return album != nil && album.Get([]byte(ref.Song)) != nil
+}
+
+// listIndexSongs returns the Songs in the bucket of
+// a name that are still in the Music Library.
+func listIndexSongs(tx *bolt.Tx, b *bolt.Bucket) []SongRef {
+	var a []SongRef
+	b.ForEach(func(k, v []byte) error {
+		var ref SongRef
+		if json.Unmarshal(v, &ref) == nil && songExists(tx, ref) {
+			a = append(a, ref)
+		}
+		return nil
+	})
+	return a
+}
+
+// ListIndexNames returns the names in the index
+// with Songs in the Music Library, sorted.
+func ListIndexNames(index string) ([]string, error) {
+	db, err := openDB()
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	var a []string
+	err = db.View(func(tx *bolt.Tx) error {
+		root := tx.Bucket([]byte(index))
+		if root == nil {
+			return nil
+		}
+
+		return root.ForEach(func(k, v []byte) error {
+			if v == nil && len(listIndexSongs(tx, root.Bucket(k))) > 0 {
+				a = append(a, string(k))
+			}
+			return nil
+		})
+	})
+	sort.Strings(a)
+	return a, err
+}
+
+// ListIndexSongs returns the Songs of
+// a name in the index.
+func ListIndexSongs(index, name string) ([]SongRef, error) {
+	db, err := openDB()
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	var a []SongRef
+	err = db.View(func(tx *bolt.Tx) error {
+		root := tx.Bucket([]byte(index))
+		if root == nil {
+			return fuse.ENOENT
+		}
+
+		b := root.Bucket([]byte(name))
+		if b == nil {
+			return fuse.ENOENT
+		}
+
+		a = listIndexSongs(tx, b)
+		if len(a) < 1 {
+			return fuse.ENOENT
+		}
+		return nil
+	})
+	return a, err
+}
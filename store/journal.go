@@ -0,0 +1,281 @@
+// Copyright 2016 Danko Miocevic. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Author: Danko Miocevic
+
+package store
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"github.com/dankomiocevic/mulifs/musicmgr"
+	"os"
+	"path/filepath"
+
+	"github.com/boltdb/bolt"
+	"github.com/golang/glog"
+)
+
+// JournalEntry describes an operation that changes
+// the files and the database in many steps.
+// It is stored before the operation starts and deleted
+// once it is finished, the entries found on startup
+// belong to interrupted operations.
+type JournalEntry struct {
+	Op        string
+	Artist    string
+	Album     string
+	Name      string
+	Path      string
+	NewArtist string
+	NewAlbum  string
+	NewName   string
+	NewPath   string
+	Playlists []string
+	Albums    []JournalAlbum
+}
+
+// JournalAlbum is an Album of a rename of Albums or
+// Artists, with the Songs it had before the rename.
+type JournalAlbum struct {
+	Artist     string
+	Album      string
+	NewArtist  string
+	NewAlbum   string
+	ArtistName string
+	AlbumName  string
+	Created    bool
+	Songs      []SongNames
+}
+
+// The operations stored in the journal.
+const (
+	journalMove      = "move"
+	journalRetag     = "retag"
+	journalDrop      = "drop"
+	journalAlbumMove = "album_move"
+)
+
+// beginJournal stores the entry in the journal
+// and returns its id to finish it later.
+func beginJournal(entry JournalEntry) (uint64, error) {
+	db, err := openDB()
+	if err != nil {
+		return 0, err
+	}
+	defer db.Close()
+
+	var id uint64
+	err = db.Update(func(tx *bolt.Tx) error {
+		root, err := tx.CreateBucketIfNotExists([]byte("Journal"))
+		if err != nil {
+			return err
+		}
+
+		id, err = root.NextSequence()
+		if err != nil {
+			return err
+		}
+
+		encoded, err := json.Marshal(entry)
+		if err != nil {
+			return err
+		}
+		return root.Put(journalKey(id), encoded)
+	})
+	return id, err
+}
+
+// endJournal deletes a finished entry from the journal.
+func endJournal(id uint64) {
+	db, err := openDB()
+	if err != nil {
+		glog.Errorf("Cannot finish the journal entry %d: %s\n", id, err)
+		return
+	}
+	defer db.Close()
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		root := tx.Bucket([]byte("Journal"))
+		if root == nil {
+			return nil
+		}
+		return root.Delete(journalKey(id))
+	})
+
+	if err != nil {
+		glog.Errorf("Cannot finish the journal entry %d: %s\n", id, err)
+	}
+}
+
+// journalKey returns the key used to store an entry,
+// the ids are stored big endian to keep them in order.
+func journalKey(id uint64) []byte {
+	key := make([]byte, 8)
+	binary.BigEndian.PutUint64(key, id)
+	return key
+}
+
+// fileExists returns true if there is a file in the path.
+func fileExists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
+
+// SetSongTags writes the tags of a Song, the
+// operation is journaled so it is written again
+// if MuLi stops before it finishes.
+func SetSongTags(artist, album, title, path string) error {
+	id, err := beginJournal(JournalEntry{Op: journalRetag, Artist: artist, Album: album, Name: title, Path: path})
+	if err != nil {
+		glog.Errorf("Cannot write the journal: %s\n", err)
+	}
+
+	err = musicmgr.SetTags(artist, album, title, path)
+	songChanged(path)
+	if id > 0 {
+		endJournal(id)
+	}
+	return err
+}
+
+// ReplayJournal finishes or rolls back the operations
+// that were interrupted the last time MuLi was running.
+// The moves and drops are finished if the file was
+// already moved, otherwise they are rolled back.
+// The tags are always written again.
+func ReplayJournal(mPoint string) error {
+	db, err := openDB()
+	if err != nil {
+		return err
+	}
+
+	var entries []JournalEntry
+	var ids []uint64
+	err = db.View(func(tx *bolt.Tx) error {
+		root := tx.Bucket([]byte("Journal"))
+		if root == nil {
+			return nil
+		}
+
+		return root.ForEach(func(k, v []byte) error {
+			var entry JournalEntry
+			if err := json.Unmarshal(v, &entry); err != nil {
+				glog.Errorf("Cannot read journal entry: %s\n", err)
+			}
+			entries = append(entries, entry)
+			ids = append(ids, binary.BigEndian.Uint64(k))
+			return nil
+		})
+	})
+	db.Close()
+
+	if err != nil {
+		return err
+	}
+
+	// The renames of Albums are replayed once their
+	// Songs interrupted in the middle are moved.
+	var albumMoves []int
+	for i, entry := range entries {
+		if entry.Op == journalAlbumMove {
+			albumMoves = append(albumMoves, i)
+			continue
+		}
+
+		glog.Infof("Replaying interrupted %s of %s\n", entry.Op, entry.Path)
+		switch entry.Op {
+		case journalMove:
+			replayMove(entry, mPoint)
+		case journalRetag:
+			if fileExists(entry.Path) {
+				musicmgr.SetTags(entry.Artist, entry.Album, entry.Name, entry.Path)
+			}
+		case journalDrop:
+			if fileExists(entry.NewPath) {
+				dir, _ := filepath.Split(entry.NewPath)
+				CreateSong(entry.NewArtist, entry.NewAlbum, entry.NewName, dir)
+				deleteDrop(entry.Path)
+			}
+		}
+		endJournal(ids[i])
+	}
+
+	for _, i := range albumMoves {
+		glog.Infof("Replaying interrupted rename of %d Albums\n", len(entries[i].Albums))
+		replayAlbumMove(entries[i], mPoint)
+		endJournal(ids[i])
+	}
+	return nil
+}
+
+// replayAlbumMove finishes a rename of Albums if all
+// their Songs were moved, otherwise the Songs already
+// moved are moved back like when a Song cannot be moved.
+func replayAlbumMove(entry JournalEntry, mPoint string) {
+	var moves []albumMove
+	complete := true
+	for _, a := range entry.Albums {
+		m := albumMove{
+			artist:     a.Artist,
+			album:      a.Album,
+			newArtist:  a.NewArtist,
+			newAlbum:   a.NewAlbum,
+			artistName: a.ArtistName,
+			albumName:  a.AlbumName,
+			songs:      a.Songs,
+			created:    a.Created,
+		}
+
+		// The Songs are moved with the title as their name.
+		for _, s := range a.Songs {
+			ref := SongRef{Artist: a.NewArtist, Album: a.NewAlbum,
+				Song: GetCompatibleString(s.Title) + filepath.Ext(s.Song)}
+			if _, err := GetSong(ref.Artist, ref.Album, ref.Song); err == nil {
+				m.refs = append(m.refs, ref)
+			} else {
+				m.refs = append(m.refs, SongRef{})
+				complete = false
+			}
+		}
+		moves = append(moves, m)
+	}
+
+	if complete {
+		for _, m := range moves {
+			if err := finishAlbumMove(m, mPoint); err != nil {
+				glog.Errorf("Cannot finish the rename of %s/%s: %s\n", m.artist, m.album, err)
+			}
+		}
+		return
+	}
+	rollbackAlbumMoves(moves, mPoint)
+}
+
+// replayMove finishes a Song move if the file was
+// already renamed, otherwise the Song is left in
+// the old location and added again to its Playlists.
+func replayMove(entry JournalEntry, mPoint string) {
+	if fileExists(entry.NewPath) && !fileExists(entry.Path) {
+		newDir, _ := filepath.Split(entry.NewPath)
+		DeleteSong(entry.Artist, entry.Album, entry.Name, mPoint)
+		musicmgr.SetTags(entry.NewArtist, entry.NewAlbum, entry.NewName, entry.NewPath)
+		CreateSong(entry.NewArtist, entry.NewAlbum, entry.NewName, newDir)
+		addToPlaylists(entry.Playlists, entry.NewArtist, entry.NewAlbum, entry.NewName, newDir, mPoint)
+		return
+	}
+
+	oldDir, _ := filepath.Split(entry.Path)
+	addToPlaylists(entry.Playlists, entry.Artist, entry.Album, entry.Name, oldDir, mPoint)
+}
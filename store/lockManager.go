@@ -0,0 +1,146 @@
+// Copyright 2016 Danko Miocevic. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Author: Danko Miocevic
+
+package store
+
+import (
+	"sort"
+	"sync"
+)
+
+// songLock is the lock of a single Song, refs counts
+// the operations using it to know when it can be freed.
+type songLock struct {
+	sync.RWMutex
+	refs int
+}
+
+// songLocks keeps the locks of the Songs being used
+// indexed by Artist, Album and Song keys.
+var songLocks = struct {
+	sync.Mutex
+	m map[string]*songLock
+}{m: make(map[string]*songLock)}
+
+// songLockKey returns the key used to index a Song lock.
+func songLockKey(artist, album, song string) string {
+	return artist + "/" + album + "/" + song
+}
+
+// getSongLock returns the lock for the key and
+// increments the references to it.
+func getSongLock(key string) *songLock {
+	songLocks.Lock()
+	defer songLocks.Unlock()
+
+	l, ok := songLocks.m[key]
+	if !ok {
+		l = &songLock{}
+		songLocks.m[key] = l
+	}
+	l.refs++
+	return l
+}
+
+// putSongLock decrements the references to the lock
+// and frees it when it is not used anymore.
+func putSongLock(key string, l *songLock) {
+	songLocks.Lock()
+	defer songLocks.Unlock()
+
+	l.refs--
+	if l.refs == 0 {
+		delete(songLocks.m, key)
+	}
+}
+
+// LockSongs locks the specified Songs for a mutating
+// operation (retag, rename, replace or delete) and returns
+// the function that unlocks them.
+// The Songs are locked in order to avoid deadlocks.
+func LockSongs(songs ...SongRef) func() {
+	var keys []string
+	for _, s := range songs {
+		keys = append(keys, songLockKey(s.Artist, s.Album, s.Song))
+	}
+	sort.Strings(keys)
+
+	var locked []string
+	var locks []*songLock
+	for i, key := range keys {
+		if i > 0 && keys[i-1] == key {
+			continue
+		}
+		l := getSongLock(key)
+		l.Lock()
+		locked = append(locked, key)
+		locks = append(locks, l)
+	}
+
+	return func() {
+		for i, l := range locks {
+			l.Unlock()
+			putSongLock(locked[i], l)
+		}
+	}
+}
+
+// LockSong locks a single Song for a mutating operation
+// and returns the function that unlocks it.
+func LockSong(artist, album, song string) func() {
+	return LockSongs(SongRef{Artist: artist, Album: album, Song: song})
+}
+
+// RLockSong locks a Song for reading, many readers can
+// hold the lock while no mutating operation is running.
+// It returns the function that unlocks it.
+func RLockSong(artist, album, song string) func() {
+	key := songLockKey(artist, album, song)
+	l := getSongLock(key)
+	l.RLock()
+
+	return func() {
+		l.RUnlock()
+		putSongLock(key, l)
+	}
+}
+
+// LockAlbum locks an Album while many Songs are added to
+// it and returns the function that unlocks it.
+// It does not lock the Songs inside the Album.
+func LockAlbum(artist, album string) func() {
+	key := songLockKey(artist, album, "")
+	l := getSongLock(key)
+	l.Lock()
+
+	return func() {
+		l.Unlock()
+		putSongLock(key, l)
+	}
+}
+
+// RLockAlbum waits until the Album is not locked by
+// LockAlbum and returns the function that unlocks it.
+func RLockAlbum(artist, album string) func() {
+	key := songLockKey(artist, album, "")
+	l := getSongLock(key)
+	l.RLock()
+
+	return func() {
+		l.RUnlock()
+		putSongLock(key, l)
+	}
+}
@@ -0,0 +1,89 @@
+// Copyright 2016 Danko Miocevic. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Author: Danko Miocevic
+
+package store
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/golang/glog"
+)
+
+// memory is the state of the database kept in memory,
+// it is created empty when MuLi starts and removed
+// when it stops, so it is never written to the disk.
+var memory struct {
+	mu      sync.Mutex
+	enabled bool
+	work    string
+}
+
+// SetMemoryDB keeps the database in memory instead of
+// in its file, for the mounts that are thrown away.
+// It must be called before InitDB.
+func SetMemoryDB() {
+	memory.mu.Lock()
+	defer memory.mu.Unlock()
+	memory.enabled = true
+}
+
+// memoryDir returns the Directory where the databases
+// kept in memory are created, /dev/shm if it is available.
+func memoryDir() string {
+	if fi, err := os.Stat("/dev/shm"); err == nil && fi.IsDir() {
+		return "/dev/shm"
+	}
+	return os.TempDir()
+}
+
+// openMemory returns the path of a new empty database
+// in memory for this process, the database opened
+// before is removed.
+func openMemory() (string, error) {
+	memory.mu.Lock()
+	defer memory.mu.Unlock()
+
+	err := closeMemory()
+	if err != nil {
+		return "", err
+	}
+
+	work := filepath.Join(memoryDir(), fmt.Sprintf("mulifs-memory-%d.db", os.Getpid()))
+	err = os.Remove(work)
+	if err != nil && !os.IsNotExist(err) {
+		return "", err
+	}
+
+	glog.Infof("The database is kept in memory in %s.\n", work)
+	memory.work = work
+	return work, nil
+}
+
+func closeMemory() error {
+	if len(memory.work) < 1 {
+		return nil
+	}
+
+	err := os.Remove(memory.work)
+	memory.work = ""
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
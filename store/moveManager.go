@@ -23,25 +23,55 @@ import (
 	"errors"
 	"github.com/dankomiocevic/mulifs/musicmgr"
 	"github.com/dankomiocevic/mulifs/playlistmgr"
+	"io/ioutil"
 	"os"
 	"path/filepath"
+	"strings"
+	"time"
 
 	"bazil.org/fuse"
 	"github.com/boltdb/bolt"
 	"github.com/golang/glog"
+	"golang.org/x/net/context"
 )
 
 // MoveSongs changes the Songs path.
 // It modifies the information in the database
 // and updates the tags to match the new location.
 // It also moves the actual file into the new
-// location.
-func MoveSongs(oldArtist, oldAlbum, oldName, newArtist, newAlbum, newName, path, mPoint string) (string, error) {
+// location. The retag hooks are run before and
+// after the Song is moved.
+// Nothing is moved if the context is already cancelled.
+func MoveSongs(ctx context.Context, oldArtist, oldAlbum, oldName, newArtist, newAlbum, newName, path, mPoint string) (string, error) {
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+	if !retagHooks() {
+		return moveSongs(oldArtist, oldAlbum, oldName, newArtist, newAlbum, newName, path, mPoint)
+	}
+
+	title := strings.TrimSuffix(newName, filepath.Ext(path))
+	s := retaggedSong(path, newArtist, newAlbum, title)
+	err := preHook(config.Hooks.PreRetag, hookRetag, s)
+	if err != nil {
+		return "", err
+	}
+
+	name, err := moveSongs(oldArtist, oldAlbum, oldName, newArtist, newAlbum, newName, path, mPoint)
+	if err == nil {
+		s.Path = filepath.Join(mPoint, newArtist, newAlbum, name)
+		postHook(config.Hooks.PostRetag, hookRetag, s)
+	}
+	return name, err
+}
+
+// moveSongs moves the Song without running the hooks.
+func moveSongs(oldArtist, oldAlbum, oldName, newArtist, newAlbum, newName, path, mPoint string) (string, error) {
 	glog.Infof("Moving song from Artist: %s, Album: %s, name: %s and path: %s to Artist: %s, Album: %s, name: %s\n", oldArtist, oldAlbum, oldName, path, newArtist, newAlbum, newName)
 
 	// Check file extension.
 	extension := filepath.Ext(path)
-	if extension != ".mp3" {
+	if !musicmgr.IsMusicFile(path) {
 		glog.Info("Wrong file format.")
 		return "", errors.New("Wrong file format.")
 	}
@@ -54,12 +84,36 @@ func MoveSongs(oldArtist, oldAlbum, oldName, newArtist, newAlbum, newName, path,
 	newPath := rootPoint + newArtist + "/" + newAlbum + "/"
 	newFullPath := newPath + newFileName
 
+	unlock := LockSongs(SongRef{Artist: oldArtist, Album: oldAlbum, Song: oldName},
+		SongRef{Artist: newArtist, Album: newAlbum, Song: newFileName})
+	defer unlock()
+
 	// Get all the Playlists form the file.
 	songStore, err := GetSong(oldArtist, oldAlbum, oldName)
 	if err != nil {
 		glog.Infof("Cannot get the file from the database: %s\n", err)
 	}
 
+	// Store the move in the journal, if MuLi stops
+	// before it finishes it is completed on startup.
+	journalId, err := beginJournal(JournalEntry{
+		Op:        journalMove,
+		Artist:    oldArtist,
+		Album:     oldAlbum,
+		Name:      oldName,
+		Path:      path,
+		NewArtist: newArtist,
+		NewAlbum:  newAlbum,
+		NewName:   newName,
+		NewPath:   newFullPath,
+		Playlists: songStore.Playlists,
+	})
+	if err != nil {
+		glog.Infof("Cannot write the journal: %s\n", err)
+		return "", err
+	}
+	defer endJournal(journalId)
+
 	// Delete the song from all the playlists
 	for _, pl := range songStore.Playlists {
 		DeletePlaylistSong(pl, oldName, true)
@@ -71,6 +125,10 @@ func MoveSongs(oldArtist, oldAlbum, oldName, newArtist, newAlbum, newName, path,
 		glog.Infof("Cannot rename the file: %s\n", err)
 		return "", err
 	}
+	songChanged(path)
+	if err := musicmgr.MoveTagSidecar(path, newFullPath); err != nil {
+		glog.Errorf("Cannot move the tags sidecar of %s: %s\n", newFullPath, err)
+	}
 
 	// Delete the song from the database
 	err = DeleteSong(oldArtist, oldAlbum, oldName, mPoint)
@@ -80,7 +138,7 @@ func MoveSongs(oldArtist, oldAlbum, oldName, newArtist, newAlbum, newName, path,
 	}
 
 	// Change the tags in the file.
-	musicmgr.SetMp3Tags(newArtist, newAlbum, newName, newFullPath)
+	musicmgr.SetTags(newArtist, newAlbum, newName, newFullPath)
 	// Add the song again to the database.
 	_, err = CreateSong(newArtist, newAlbum, newName, newPath)
 	if err != nil {
@@ -88,362 +146,491 @@ func MoveSongs(oldArtist, oldAlbum, oldName, newArtist, newAlbum, newName, path,
 		return "", err
 	}
 
+	// The other tags are kept in the file, they
+	// are read again to keep them in the database.
+	err = RefreshSongInfo(newArtist, newAlbum, newFileName, newFullPath)
+	if err != nil {
+		glog.Infof("Cannot read the tags of the song: %s\n", err)
+	}
+
+	// The rating and the play count imported
+	// from other players are kept.
+	if songStore.Rating > 0 || songStore.PlayCount > 0 {
+		stats := SongStats{Rating: songStore.Rating, PlayCount: songStore.PlayCount}
+		if songStore.LastPlayed > 0 {
+			stats.LastPlayed = time.Unix(0, songStore.LastPlayed)
+		}
+		err = SetSongStats(SongRef{Artist: newArtist, Album: newAlbum, Song: newFileName}, stats)
+		if err != nil {
+			glog.Infof("Cannot keep the rating of the song: %s\n", err)
+		}
+	}
+
 	// Add the song to all the playlists.
-	for _, pl := range songStore.Playlists {
+	addToPlaylists(songStore.Playlists, newArtist, newAlbum, newName, newPath, mPoint)
+	return newFileName, nil
+}
+
+// addToPlaylists adds a Song to the specified
+// Playlists and regenerates their files.
+func addToPlaylists(playlists []string, artist, album, name, path, mPoint string) {
+	for _, pl := range playlists {
 		file := playlistmgr.PlaylistFile{
-			Title:  newName,
-			Artist: newArtist,
-			Album:  newAlbum,
-			Path:   newPath,
+			Title:  name,
+			Artist: artist,
+			Album:  album,
+			Path:   path,
 		}
 
 		AddFileToPlaylist(file, pl)
 		RegeneratePlaylistFile(pl, mPoint)
 	}
+}
 
-	return newFileName, nil
+// RenameProgress is called by MoveAlbum and MoveArtist
+// after every Song is moved with the number of Songs
+// moved and the total.
+type RenameProgress func(done, total int)
+
+// albumMove is an Album being moved, the Artist and Album
+// are the Directory names and the new names are the
+// ones written in the tags.
+type albumMove struct {
+	artist     string
+	album      string
+	newArtist  string
+	newAlbum   string
+	artistName string
+	albumName  string
+	songs      []SongNames
+	created    bool
+
+	// refs are the Songs once they are moved.
+	refs []SongRef
 }
 
-// processNewArtist returns all the albums inside an Artist and
-// prepares the new folder for the new Artist.
-// It also creates the description files and Buckets in the DB.
-func processNewArtist(newArtist, oldArtist string) ([]string, error) {
-	var albums []string
+// MoveAlbum changes the album path.
+// It modifies the information in the database
+// and updates the tags to match the new location
+// on every song inside the album.
+// It also moves the actual files into the new location.
+// The new Album is the name written by the user, the
+// Songs are retagged with it. If a Song cannot be moved
+// or the context is cancelled the Songs already moved
+// are moved back.
+func MoveAlbum(ctx context.Context, oldArtist, oldAlbum, newArtist, newAlbum, mPoint string, progress RenameProgress) error {
+	glog.Infof("Moving Album from Artist: %s, Album: %s to Artist: %s, Album: %s\n", oldArtist, oldAlbum, newArtist, newAlbum)
 
-	db, err := bolt.Open(config.DbPath, 0600, nil)
-	if err != nil {
-		glog.Error("Error opening the database.")
-		return nil, err
+	// Check that the file is being moved in the same level
+	// Album -> Album
+	if len(oldArtist) < 1 || len(newArtist) < 1 {
+		glog.Info("Cannot change Album to Artist.")
+		return fuse.EPERM
 	}
-	defer db.Close()
-
-	newArtistRaw := newArtist
-	newArtist = GetCompatibleString(newArtist)
 
-	err = db.Update(func(tx *bolt.Tx) error {
-		root := tx.Bucket([]byte("Artists"))
+	if len(oldAlbum) < 1 || len(GetCompatibleString(newAlbum)) < 1 {
+		glog.Info("Cannot change Album to Artist.")
+		return fuse.EPERM
+	}
 
-		// Get oldArtist Bucket
-		oldArtistBucket := root.Bucket([]byte(oldArtist))
-		if oldArtistBucket == nil {
-			glog.Info("Source Artist not found.")
-			return errors.New("Artist not found")
-		}
+	artistName, _, err := GetDescriptionNames(newArtist, "")
+	if err != nil {
+		glog.Info("Destination Artist not found.")
+		return fuse.ENOENT
+	}
 
-		// Get the description file or create it if it does not exist
-		oldDescription := oldArtistBucket.Get([]byte(".description"))
-		if oldDescription != nil {
-			var oldArtistStore ArtistStore
-
-			err := json.Unmarshal(oldDescription, &oldArtistStore)
-			if err == nil {
-				albums = make([]string, len(oldArtistStore.ArtistAlbums))
-				copy(albums, oldArtistStore.ArtistAlbums)
-			} else {
-				albums = make([]string, 0)
-			}
-		}
+	songs, err := ListAlbumSongNames(oldArtist, oldAlbum)
+	if err != nil {
+		return err
+	}
 
-		// Create the bucket
-		artistBucket, err := root.CreateBucketIfNotExists([]byte(newArtist))
-		if err != nil {
-			glog.Info("Cannot create Artist bucket.")
-			return fuse.EIO
-		}
+	m := albumMove{
+		artist:     oldArtist,
+		album:      oldAlbum,
+		newArtist:  newArtist,
+		newAlbum:   GetCompatibleString(newAlbum),
+		artistName: artistName,
+		albumName:  newAlbum,
+		songs:      songs,
+	}
 
-		// Get the description file or create it if it does not exist
-		description := artistBucket.Get([]byte(".description"))
-		var artistStore ArtistStore
-		if description == nil {
-			artistStore = ArtistStore{
-				ArtistName:   newArtistRaw,
-				ArtistPath:   newArtist,
-				ArtistAlbums: albums,
-			}
-		} else {
-			err := json.Unmarshal(description, &artistStore)
-			if err != nil {
-				return fuse.EIO
-			}
-			copy(artistStore.ArtistAlbums, albums)
-		}
+	moves := []albumMove{m}
+	err = moveAlbums(ctx, moves, mPoint, progress)
+	if err == nil {
+		recordMoves(oldArtist+"/"+oldAlbum, "", "", moves)
+	}
+	return err
+}
 
-		encoded, err := json.Marshal(artistStore)
-		if err != nil {
-			glog.Info("Cannot encode description JSON.")
-			return fuse.EIO
-		}
-		artistBucket.Put([]byte(".description"), encoded)
+// MoveArtist changes the Artist path.
+// It modifies the information in the database
+// and updates the tags to match the new location
+// on every song inside every album.
+// It also moves the actual files into the new location.
+// The new Artist is the name written by the user, the
+// Songs are retagged with it. If a Song cannot be moved
+// or the context is cancelled the Songs already moved
+// are moved back.
+func MoveArtist(ctx context.Context, oldArtist, newArtist, mPoint string, progress RenameProgress) error {
+	glog.Infof("Moving Artist from: %s to  %s\n", oldArtist, newArtist)
 
-		return nil
-	})
-	return albums, err
-}
+	// Check that all the information is ready
+	newPath := GetCompatibleString(newArtist)
+	if len(oldArtist) < 1 || len(newPath) < 1 {
+		return fuse.EIO
+	}
 
-// processNewAlbum returns all the songs inside an Album and
-// prepares the new folder for the new Album.
-// It also creates the description files and Buckets in the DB.
-func processNewAlbum(newArtist, newAlbum, oldArtist, oldAlbum string) ([][]byte, error) {
-	var songs [][]byte
+	_, err := GetArtistPath(newPath)
+	created := err != nil
 
-	db, err := bolt.Open(config.DbPath, 0600, nil)
+	albums, err := ListAlbums(oldArtist)
 	if err != nil {
-		glog.Error("Error opening the database.")
-		return nil, err
+		return err
 	}
-	defer db.Close()
 
-	newAlbumRaw := newAlbum
-	newAlbum = GetCompatibleString(newAlbum)
+	var moves []albumMove
+	for _, a := range albums {
+		if a.Type != fuse.DT_Dir {
+			continue
+		}
 
-	err = db.Update(func(tx *bolt.Tx) error {
-		root := tx.Bucket([]byte("Artists"))
-		artistBucket := root.Bucket([]byte(newArtist))
-		if artistBucket == nil {
-			glog.Info("Destination Artist not found.")
-			return errors.New("Artist not found.")
+		_, albumName, err := GetDescriptionNames(oldArtist, a.Name)
+		if err != nil || len(albumName) < 1 {
+			albumName = a.Name
 		}
 
-		// Create the bucket
-		albumBucket, err := artistBucket.CreateBucketIfNotExists([]byte(newAlbum))
+		songs, err := ListAlbumSongNames(oldArtist, a.Name)
 		if err != nil {
-			glog.Info("Cannot create Album bucket.")
-			return fuse.EIO
+			return err
 		}
 
-		// Get the description file or create it if it does not exist
-		description := albumBucket.Get([]byte(".description"))
-		if description == nil {
-			albumStore := &AlbumStore{
-				AlbumName: newAlbumRaw,
-				AlbumPath: newAlbum,
+		moves = append(moves, albumMove{
+			artist:     oldArtist,
+			album:      a.Name,
+			newArtist:  newPath,
+			newAlbum:   a.Name,
+			artistName: newArtist,
+			albumName:  albumName,
+			songs:      songs,
+		})
+	}
+
+	err = moveAlbums(ctx, moves, mPoint, progress)
+	if err != nil {
+		if created {
+			finishArtistMove(newPath, oldArtist, false, mPoint)
+		}
+		return err
+	}
+
+	recordMoves(oldArtist, oldArtist, newPath, moves)
+	return finishArtistMove(oldArtist, newPath, created, mPoint)
+}
+
+// moveAlbums retags and moves all the Songs of the Albums.
+// The destinations are checked before anything is moved
+// and if a Song fails the Songs already moved are moved
+// back, so the Albums are moved completely or not at all.
+// The Albums are stored in the journal before the Songs
+// are moved, if MuLi stops in the middle the rename is
+// finished or rolled back by ReplayJournal.
+// A cancelled context stops the move like a failed Song.
+func moveAlbums(ctx context.Context, moves []albumMove, mPoint string, progress RenameProgress) error {
+	total := 0
+	for i, m := range moves {
+		_, err := GetAlbumPath(m.newArtist, m.newAlbum)
+		moves[i].created = err != nil
+
+		for _, s := range m.songs {
+			if s.Artist == m.newArtist && s.Album == m.newAlbum {
+				continue
 			}
 
-			encoded, err := json.Marshal(albumStore)
-			if err != nil {
-				glog.Info("Cannot encode description JSON.")
-				return fuse.EIO
+			if _, err := GetSong(m.newArtist, m.newAlbum, s.Song); err == nil {
+				glog.Infof("The Song %s already exists in the destination.\n", s.Song)
+				return fuse.EEXIST
 			}
-			albumBucket.Put([]byte(".description"), encoded)
 		}
+		total += len(m.songs)
+	}
 
-		// Update the Artist description
-		var artistStore ArtistStore
-		// Update the description of the Artist
-		descValue := artistBucket.Get([]byte(".description"))
-		if descValue == nil {
-			artistStore.ArtistName = newArtist
-			artistStore.ArtistPath = newArtist
-			artistStore.ArtistAlbums = []string{newAlbum}
-		} else {
-			err := json.Unmarshal(descValue, &artistStore)
+	entry := JournalEntry{Op: journalAlbumMove}
+	for _, m := range moves {
+		entry.Albums = append(entry.Albums, JournalAlbum{
+			Artist:     m.artist,
+			Album:      m.album,
+			NewArtist:  m.newArtist,
+			NewAlbum:   m.newAlbum,
+			ArtistName: m.artistName,
+			AlbumName:  m.albumName,
+			Created:    m.created,
+			Songs:      m.songs,
+		})
+	}
+	journalId, err := beginJournal(entry)
+	if err != nil {
+		glog.Infof("Cannot write the journal: %s\n", err)
+		return err
+	}
+	defer endJournal(journalId)
+
+	done := 0
+	for i, m := range moves {
+		for _, s := range m.songs {
+			ThrottleOp()
+			var ref SongRef
+			ref, err = RetagSong(ctx, s.SongRef, m.artistName, m.albumName, s.Title, mPoint)
 			if err != nil {
-				artistStore.ArtistName = newArtist
-				artistStore.ArtistPath = newArtist
-				artistStore.ArtistAlbums = []string{newAlbum}
-			}
-
-			var found bool = false
-			for _, a := range artistStore.ArtistAlbums {
-				if a == newAlbum {
-					found = true
-					break
-				}
+				break
 			}
 
-			if found == false {
-				artistStore.ArtistAlbums = append(artistStore.ArtistAlbums, newAlbum)
+			moves[i].refs = append(moves[i].refs, ref)
+			done++
+			if progress != nil {
+				progress(done, total)
 			}
 		}
-		encoded, err := json.Marshal(artistStore)
+
 		if err != nil {
-			return err
+			break
 		}
-		artistBucket.Put([]byte(".description"), encoded)
+	}
 
-		// Get oldArtist Bucket
-		oldArtistBucket := root.Bucket([]byte(oldArtist))
-		if oldArtistBucket == nil {
-			glog.Info("Source Artist not found.")
-			return errors.New("Artist not found")
-		}
+	if err != nil {
+		glog.Errorf("Cannot move the Songs, moving them back: %s\n", err)
+		rollbackAlbumMoves(moves, mPoint)
+		return err
+	}
 
-		oldAlbumBucket := oldArtistBucket.Bucket([]byte(oldAlbum))
-		if oldAlbumBucket == nil {
-			glog.Info("Source Album not found.")
-			return errors.New("Album not found")
+	for _, m := range moves {
+		err = finishAlbumMove(m, mPoint)
+		if err != nil {
+			return err
 		}
+	}
+	return nil
+}
 
-		// Remove the Album from the Artist description
-		descValue = oldArtistBucket.Get([]byte(".description"))
-		if descValue != nil {
-			err := json.Unmarshal(descValue, &artistStore)
-			if err == nil {
-				for i, a := range artistStore.ArtistAlbums {
-					if a == oldAlbum {
-						artistStore.ArtistAlbums = append(artistStore.ArtistAlbums[:i], artistStore.ArtistAlbums[i+1:]...)
-						break
-					}
-				}
-
-				encoded, err := json.Marshal(artistStore)
-				if err != nil {
-					return err
-				}
-				oldArtistBucket.Put([]byte(".description"), encoded)
-			}
-		}
-		// Get all the songs and store it in a temporary slice
-		c := oldAlbumBucket.Cursor()
-		for k, v := c.First(); k != nil; k, v = c.Next() {
-			var temp []byte
-			if k[0] == '.' {
+// rollbackAlbumMoves moves back the Songs already moved,
+// the refs of the Songs not moved are empty. The Albums
+// created for the move are removed.
+func rollbackAlbumMoves(moves []albumMove, mPoint string) {
+	for i := len(moves) - 1; i >= 0; i-- {
+		m := moves[i]
+		for j := len(m.refs) - 1; j >= 0; j-- {
+			if len(m.refs[j].Song) < 1 {
 				continue
 			}
-			temp = make([]byte, len(v))
-			copy(temp, v)
-			songs = append(songs, temp)
-		}
-		return nil
-	})
-	return songs, err
-}
 
-// MoveAlbum changes the album path.
-// It modifies the information in the database
-// and updates the tags to match the new location
-// on every song inside the album.
-// It also moves the actual files into the new location.
-func MoveAlbum(oldArtist, oldAlbum, newArtist, newAlbum, mPoint string) error {
-	glog.Infof("Moving Album from Artist: %s, Album: %s to Artist: %s, Album: %s\n", oldArtist, oldAlbum, newArtist, newAlbum)
-
-	// Check that the file is being moved in the same level
-	// Album -> Album
-	if len(oldArtist) < 1 || len(newArtist) < 1 {
-		glog.Info("Cannot change Album to Artist.")
-		return fuse.EPERM
+			s := m.songs[j]
+			_, err := RetagSong(context.Background(), m.refs[j], s.ArtistName, s.AlbumName, s.Title, mPoint)
+			if err != nil {
+				glog.Errorf("Cannot move the Song back: %s\n", err)
+			}
+		}
 	}
 
-	if len(oldAlbum) < 1 || len(newAlbum) < 1 {
-		glog.Info("Cannot change Album to Artist.")
-		return fuse.EPERM
+	for _, m := range moves {
+		if m.created && len(m.songs) > 0 {
+			finishAlbumMove(albumMove{
+				artist:     m.newArtist,
+				album:      m.newAlbum,
+				newArtist:  m.artist,
+				newAlbum:   m.album,
+				artistName: m.songs[0].ArtistName,
+				albumName:  m.songs[0].AlbumName,
+			}, mPoint)
+		}
 	}
+}
 
-	rootPoint := mPoint
-	if rootPoint[len(rootPoint)-1] != '/' {
-		rootPoint = rootPoint + "/"
+// finishAlbumMove removes the old Album once its Songs
+// were moved. The description and the files found next
+// to the Songs are moved to the new Album.
+func finishAlbumMove(m albumMove, mPoint string) error {
+	if m.artist == m.newArtist && m.album == m.newAlbum {
+		return nil
 	}
-	newPath := rootPoint + newArtist + "/" + newAlbum + "/"
 
-	// Create the directory if not exists
-	src, err := os.Stat(newPath)
-	if err != nil || !src.IsDir() {
-		err := os.Mkdir(newPath, 0777)
-		if err != nil {
-			glog.Infof("Cannot create the new directory: %s.", err)
-			return fuse.EIO
-		}
+	artistPath, err := CreateArtist(m.artistName)
+	if err != nil && err != fuse.EEXIST {
+		return err
 	}
 
-	var songs [][]byte
-	songs, err = processNewAlbum(newArtist, newAlbum, oldArtist, oldAlbum)
-	if err != nil {
+	_, err = CreateAlbum(artistPath, m.albumName)
+	if err != nil && err != fuse.EEXIST {
 		return err
 	}
 
-	glog.Infof("Moving %d songs.\n", len(songs))
-	// Move all the songs inside the Album
-	for _, element := range songs {
-		var song SongStore
-		err := json.Unmarshal(element, &song)
-		if err != nil {
-			glog.Info("Cannot unmarshall JSON")
-			continue
-		}
-		MoveSongs(oldArtist, oldAlbum, song.SongPath, newArtist, newAlbum, song.SongPath, song.SongFullPath, mPoint)
+	rootPoint := mPoint
+	if rootPoint[len(rootPoint)-1] != '/' {
+		rootPoint = rootPoint + "/"
 	}
+	oldPath := rootPoint + m.artist + "/" + m.album
+	newPath := rootPoint + m.newArtist + "/" + m.newAlbum
 
-	db, err := bolt.Open(config.DbPath, 0600, nil)
+	db, err := openDB()
 	if err != nil {
-		glog.Error("Error opening the database.")
 		return err
 	}
-	defer db.Close()
 
-	// Finally delete the old Artist bucket
 	err = db.Update(func(tx *bolt.Tx) error {
 		root := tx.Bucket([]byte("Artists"))
-		artistBucket := root.Bucket([]byte(oldArtist))
+		artistBucket := root.Bucket([]byte(m.artist))
 		if artistBucket == nil {
-			return errors.New("Artist not found.")
+			return nil
+		}
+
+		albumBucket := artistBucket.Bucket([]byte(m.album))
+		if albumBucket == nil {
+			return nil
+		}
+
+		// The Songs added while the Album was moved are kept.
+		c := albumBucket.Cursor()
+		for k, _ := c.First(); k != nil; k, _ = c.Next() {
+			if k[0] != '.' {
+				return nil
+			}
+		}
+
+		if m.created {
+			var oldStore, newStore AlbumStore
+			json.Unmarshal(albumBucket.Get([]byte(".description")), &oldStore)
+			newBucket := root.Bucket([]byte(m.newArtist)).Bucket([]byte(m.newAlbum))
+			json.Unmarshal(newBucket.Get([]byte(".description")), &newStore)
+			oldStore.AlbumName = newStore.AlbumName
+			oldStore.AlbumPath = newStore.AlbumPath
+			encoded, err := json.Marshal(oldStore)
+			if err != nil {
+				return err
+			}
+			newBucket.Put([]byte(".description"), encoded)
+		}
+
+		var artistStore ArtistStore
+		descValue := artistBucket.Get([]byte(".description"))
+		if json.Unmarshal(descValue, &artistStore) == nil {
+			for i, a := range artistStore.ArtistAlbums {
+				if a == m.album {
+					artistStore.ArtistAlbums = append(artistStore.ArtistAlbums[:i], artistStore.ArtistAlbums[i+1:]...)
+					break
+				}
+			}
+
+			encoded, err := json.Marshal(artistStore)
+			if err != nil {
+				return err
+			}
+			artistBucket.Put([]byte(".description"), encoded)
 		}
-		err = artistBucket.DeleteBucket([]byte(oldAlbum))
-		return err
-	})
 
+		for _, bucket := range []string{"Extras", "Artwork"} {
+			err := moveSidecars(tx, bucket, m, oldPath, newPath)
+			if err != nil {
+				return err
+			}
+		}
+		return artistBucket.DeleteBucket([]byte(m.album))
+	})
+	db.Close()
 	if err != nil {
-		return fuse.EIO
+		return err
 	}
+
+	moveDirFiles(oldPath, newPath)
 	return nil
 }
 
-// MoveArtist changes the Artist path.
-// It modifies the information in the database
-// and updates the tags to match the new location
-// on every song inside every album.
-// It also moves the actual files into the new location.
-func MoveArtist(oldArtist, newArtist, mPoint string) error {
-	glog.Infof("Moving Artist from: %s to  %s\n", oldArtist, newArtist)
-
-	// Check that all the information is ready
-	if len(oldArtist) < 1 || len(newArtist) < 1 {
-		return fuse.EIO
+// finishArtistMove removes the old Artist once all its
+// Albums were moved. The description and the image are
+// moved to the new Artist.
+func finishArtistMove(oldArtist, newArtist string, created bool, mPoint string) error {
+	if oldArtist == newArtist {
+		return nil
 	}
 
 	rootPoint := mPoint
 	if rootPoint[len(rootPoint)-1] != '/' {
 		rootPoint = rootPoint + "/"
 	}
-	newPath := rootPoint + newArtist + "/"
 
-	// Create the directory if not exists
-	src, err := os.Stat(newPath)
-	if err != nil || !src.IsDir() {
-		err := os.Mkdir(newPath, 0777)
-		if err != nil {
-			glog.Infof("Cannot create the new directory: %s.", err)
-			return fuse.EIO
-		}
-	}
-
-	var albums []string
-	albums, err = processNewArtist(newArtist, oldArtist)
+	db, err := openDB()
 	if err != nil {
 		return err
 	}
 
-	glog.Infof("Moving %d albums.\n", len(albums))
-	// Move all the songs inside the Album
-	for _, element := range albums {
-		MoveAlbum(oldArtist, element, newArtist, element, mPoint)
-	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		root := tx.Bucket([]byte("Artists"))
+		artistBucket := root.Bucket([]byte(oldArtist))
+		newBucket := root.Bucket([]byte(newArtist))
+		if artistBucket == nil || newBucket == nil {
+			return nil
+		}
+
+		c := artistBucket.Cursor()
+		for k, v := c.First(); k != nil; k, v = c.Next() {
+			if v == nil {
+				return nil
+			}
+		}
 
-	db, err := bolt.Open(config.DbPath, 0600, nil)
+		if created {
+			var oldStore, newStore ArtistStore
+			json.Unmarshal(artistBucket.Get([]byte(".description")), &oldStore)
+			json.Unmarshal(newBucket.Get([]byte(".description")), &newStore)
+			oldStore.ArtistName = newStore.ArtistName
+			oldStore.ArtistPath = newStore.ArtistPath
+			oldStore.ArtistAlbums = newStore.ArtistAlbums
+			encoded, err := json.Marshal(oldStore)
+			if err != nil {
+				return err
+			}
+			newBucket.Put([]byte(".description"), encoded)
+		}
+
+		images := tx.Bucket([]byte("ArtistImages"))
+		if images != nil {
+			if v := images.Get([]byte(oldArtist)); v != nil && images.Get([]byte(newArtist)) == nil {
+				images.Put([]byte(newArtist), []byte(strings.Replace(string(v),
+					rootPoint+oldArtist+"/", rootPoint+newArtist+"/", 1)))
+			}
+			images.Delete([]byte(oldArtist))
+		}
+		return root.DeleteBucket([]byte(oldArtist))
+	})
+	db.Close()
 	if err != nil {
-		glog.Error("Error opening the database.")
 		return err
 	}
-	defer db.Close()
 
-	// Finally delete the old Album bucket
-	err = db.Update(func(tx *bolt.Tx) error {
-		root := tx.Bucket([]byte("Artists"))
-		err = root.DeleteBucket([]byte(oldArtist))
-		return err
-	})
+	moveDirFiles(rootPoint+oldArtist, rootPoint+newArtist)
+	return nil
+}
 
-	if err != nil {
-		return fuse.EIO
+// moveDirFiles moves the files left in the old Directory
+// to the new one, the files that already exist in the
+// new Directory are kept. The old Directory is removed
+// when it is empty.
+func moveDirFiles(oldPath, newPath string) {
+	files, _ := ioutil.ReadDir(oldPath)
+	for _, f := range files {
+		if f.IsDir() {
+			continue
+		}
+
+		dst := filepath.Join(newPath, f.Name())
+		if _, err := os.Stat(dst); err == nil {
+			continue
+		}
+
+		err := os.MkdirAll(newPath, 0777)
+		if err == nil {
+			err = os.Rename(filepath.Join(oldPath, f.Name()), dst)
+		}
+		if err != nil {
+			glog.Errorf("Cannot move %s: %s\n", f.Name(), err)
+		}
 	}
-	return nil
+	os.Remove(oldPath)
 }
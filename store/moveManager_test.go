@@ -0,0 +1,225 @@
+// Copyright 2016 Danko Miocevic. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Author: Danko Miocevic
+
+package store
+
+import (
+	"encoding/binary"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"golang.org/x/net/context"
+)
+
+// testWav returns a WAV file with a second of silence.
+func testWav() []byte {
+	fmtChunk := make([]byte, 16)
+	binary.LittleEndian.PutUint16(fmtChunk[0:], 1)
+	binary.LittleEndian.PutUint16(fmtChunk[2:], 1)
+	binary.LittleEndian.PutUint32(fmtChunk[4:], 8000)
+	binary.LittleEndian.PutUint32(fmtChunk[8:], 16000)
+	binary.LittleEndian.PutUint16(fmtChunk[12:], 2)
+	binary.LittleEndian.PutUint16(fmtChunk[14:], 16)
+
+	data := []byte("WAVEfmt ")
+	data = binary.LittleEndian.AppendUint32(data, uint32(len(fmtChunk)))
+	data = append(data, fmtChunk...)
+	data = append(data, []byte("data")...)
+	data = binary.LittleEndian.AppendUint32(data, 16000)
+	data = append(data, make([]byte, 16000)...)
+
+	header := []byte("RIFF")
+	header = binary.LittleEndian.AppendUint32(header, uint32(len(data)))
+	return append(header, data...)
+}
+
+// testAlbum creates an Album with the Songs in the
+// database and in the source Directory root.
+func testAlbum(t *testing.T, root, artist, album string, songs ...string) (string, string) {
+	artistPath, err := CreateArtist(artist)
+	if err != nil {
+		t.Fatal(err)
+	}
+	albumPath, err := CreateAlbum(artistPath, album)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir := filepath.Join(root, artistPath, albumPath) + "/"
+	if err := os.MkdirAll(dir, 0777); err != nil {
+		t.Fatal(err)
+	}
+	for _, song := range songs {
+		if err := ioutil.WriteFile(dir+song, testWav(), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := CreateSong(artistPath, albumPath, song, dir); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return artistPath, albumPath
+}
+
+func TestMoveAlbum(t *testing.T) {
+	testDB(t)
+	root := t.TempDir()
+	artist, album := testAlbum(t, root, "Some Artist", "Some Album", "One.wav", "Two.wav")
+
+	err := MoveAlbum(context.Background(), artist, album, artist, "Other Album", root, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, song := range []string{"One.wav", "Two.wav"} {
+		if _, err := GetSong(artist, "Other_Album", song); err != nil {
+			t.Errorf("%s was not moved: %s", song, err)
+		}
+		if _, err := os.Stat(filepath.Join(root, artist, "Other_Album", song)); err != nil {
+			t.Errorf("the file of %s was not moved: %s", song, err)
+		}
+	}
+	if _, err := GetAlbumPath(artist, album); err == nil {
+		t.Error("the old Album was not removed")
+	}
+}
+
+func TestMoveAlbumCancelled(t *testing.T) {
+	testDB(t)
+	root := t.TempDir()
+	artist, album := testAlbum(t, root, "Some Artist", "Some Album", "One.wav", "Two.wav")
+
+	// The request is interrupted after the first Song.
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	err := MoveAlbum(ctx, artist, album, artist, "Other Album", root, func(done, total int) {
+		cancel()
+	})
+	if err != context.Canceled {
+		t.Fatalf("MoveAlbum() = %v, want %v", err, context.Canceled)
+	}
+
+	for _, song := range []string{"One.wav", "Two.wav"} {
+		if _, err := GetSong(artist, album, song); err != nil {
+			t.Errorf("%s was not moved back: %s", song, err)
+		}
+	}
+	if _, err := GetAlbumPath(artist, "Other_Album"); err == nil {
+		t.Error("the Album created by the rename was not removed")
+	}
+}
+
+func TestRetagSongReportsChange(t *testing.T) {
+	testDB(t)
+	root := t.TempDir()
+	artist, album := testAlbum(t, root, "Some Artist", "Some Album", "One.wav")
+
+	var changed []string
+	SetChangeHandler(func(path string) { changed = append(changed, path) })
+	defer SetChangeHandler(nil)
+
+	ref := SongRef{Artist: artist, Album: album, Song: "One.wav"}
+	if _, err := RetagSong(context.Background(), ref, "Some Artist", "Some Album", "Uno", root); err != nil {
+		t.Fatal(err)
+	}
+
+	old := filepath.Join(root, artist, album, "One.wav")
+	if len(changed) < 1 || changed[0] != old {
+		t.Errorf("the changed Songs are %v, want %s first", changed, old)
+	}
+}
+
+func TestReplayAlbumMoveRollsBack(t *testing.T) {
+	testDB(t)
+	root := t.TempDir()
+	artist, album := testAlbum(t, root, "Some Artist", "Some Album", "One.wav", "Two.wav")
+
+	songs, err := ListAlbumSongNames(artist, album)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// MuLi stopped after moving the first Song.
+	_, err = beginJournal(JournalEntry{Op: journalAlbumMove, Albums: []JournalAlbum{{
+		Artist:     artist,
+		Album:      album,
+		NewArtist:  artist,
+		NewAlbum:   "Other_Album",
+		ArtistName: "Some Artist",
+		AlbumName:  "Other Album",
+		Created:    true,
+		Songs:      songs,
+	}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := RetagSong(context.Background(), songs[0].SongRef, "Some Artist", "Other Album", songs[0].Title, root); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := ReplayJournal(root); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, s := range songs {
+		if _, err := GetSong(artist, album, s.Song); err != nil {
+			t.Errorf("%s was not moved back: %s", s.Song, err)
+		}
+	}
+	if _, err := GetAlbumPath(artist, "Other_Album"); err == nil {
+		t.Error("the Album created by the rename was not removed")
+	}
+}
+
+func TestReplayAlbumMoveFinishes(t *testing.T) {
+	testDB(t)
+	root := t.TempDir()
+	artist, album := testAlbum(t, root, "Some Artist", "Some Album", "One.wav")
+
+	songs, err := ListAlbumSongNames(artist, album)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// MuLi stopped after moving all the Songs.
+	_, err = beginJournal(JournalEntry{Op: journalAlbumMove, Albums: []JournalAlbum{{
+		Artist:     artist,
+		Album:      album,
+		NewArtist:  artist,
+		NewAlbum:   "Other_Album",
+		ArtistName: "Some Artist",
+		AlbumName:  "Other Album",
+		Created:    true,
+		Songs:      songs,
+	}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := RetagSong(context.Background(), songs[0].SongRef, "Some Artist", "Other Album", songs[0].Title, root); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := ReplayJournal(root); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := GetAlbumPath(artist, album); err == nil {
+		t.Error("the old Album was not removed")
+	}
+	if _, err := GetSong(artist, "Other_Album", songs[0].Song); err != nil {
+		t.Error(err)
+	}
+}
@@ -22,54 +22,164 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"github.com/dankomiocevic/mulifs/metadata"
 	"github.com/dankomiocevic/mulifs/musicmgr"
 	"os"
 	"path/filepath"
 	"regexp"
+	"sort"
+	"strconv"
 	"strings"
 	"unicode"
 
 	"bazil.org/fuse"
 	"github.com/boltdb/bolt"
 	"github.com/golang/glog"
+	"golang.org/x/net/context"
 	"golang.org/x/text/transform"
 	"golang.org/x/text/unicode/norm"
 )
 
 // config stores the general configuration for the store.
 // DbPath is the path to the database file.
+// Identifier finds the Album of the dropped Songs
+// without one, it is optional.
+// Queue is true if the queue playlist is enabled.
+// BPMCommand computes the BPM of the Songs without it.
+// Hooks are run before and after the drops and retags.
+// Options are used to open the database, they are
+// read only when it is shared.
+// InferGenres fills the genre of the dropped Songs without
+// one, Classifier finds it online and is optional.
+// PlaylistNames is the style of the playlist names.
+// Changed is called with the path of a Song after its
+// file is changed, it is optional.
 var config struct {
-	DbPath string
+	DbPath        string
+	Options       *bolt.Options
+	Identifier    metadata.ReleaseIdentifier
+	Queue         bool
+	BPMCommand    []string
+	Hooks         Hooks
+	InferGenres   bool
+	Classifier    metadata.GenreClassifier
+	PlaylistNames string
+	Changed       func(path string)
 }
 
 // ArtistStore is the information for a specific artist
 // to be stored in the database.
+// The optional fields can be edited by the user in the
+// .description file or obtained from a metadata provider,
+// Fetched is set once the provider was used. The Fields are
+// the custom fields of the description_fields option.
 type ArtistStore struct {
-	ArtistName   string
-	ArtistPath   string
-	ArtistAlbums []string
+	ArtistName    string
+	ArtistPath    string
+	ArtistAlbums  []string
+	Bio           string                 `json:",omitempty"`
+	Country       string                 `json:",omitempty"`
+	Formed        string                 `json:",omitempty"`
+	Type          string                 `json:",omitempty"`
+	MusicBrainzID string                 `json:",omitempty"`
+	Fields        map[string]interface{} `json:",omitempty"`
+	Fetched       bool                   `json:",omitempty"`
 }
 
 // AlbumStore is the information for a specific album
 // to be stored in the database.
+// The optional fields can be edited by the user in the
+// .description file or obtained from a metadata provider,
+// Fetched is set once the provider was used. The Fields are
+// the custom fields of the description_fields option.
 type AlbumStore struct {
-	AlbumName string
-	AlbumPath string
+	AlbumName     string
+	AlbumPath     string
+	ReleaseDate   string                 `json:",omitempty"`
+	Country       string                 `json:",omitempty"`
+	Label         string                 `json:",omitempty"`
+	CatalogNumber string                 `json:",omitempty"`
+	Barcode       string                 `json:",omitempty"`
+	Credits       []string               `json:",omitempty"`
+	Notes         string                 `json:",omitempty"`
+	MusicBrainzID string                 `json:",omitempty"`
+	Fields        map[string]interface{} `json:",omitempty"`
+	Fetched       bool                   `json:",omitempty"`
 }
 
 // SongStore is the information for a specific song
 // to be stored in the database.
+// The Genre, Year, Composer, Work, Conductor, BPM, Key
+// and Track are read from the tags of the file, the BPM
+// can also be computed with the BPM command.
+// The TrackArtist is the Artist of the Song when it
+// is grouped in the Artist of its album artist tag.
+// The Codec, the Bitrate (in kbps) and the Duration
+// (in seconds) are read from the audio of the file.
+// The TrackNumber, TrackStart and TrackEnd are set when
+// the Song is a track of a FLAC album image.
 type SongStore struct {
-	SongName     string
-	SongPath     string
-	SongFullPath string
-	Playlists    []string
+	SongName      string
+	SongPath      string
+	SongFullPath  string
+	Playlists     []string
+	Genre         string `json:",omitempty"`
+	Year          string `json:",omitempty"`
+	Composer      string `json:",omitempty"`
+	Work          string `json:",omitempty"`
+	Conductor     string `json:",omitempty"`
+	BPM           string `json:",omitempty"`
+	Key           string `json:",omitempty"`
+	Track         string `json:",omitempty"`
+	TrackArtist   string `json:",omitempty"`
+	Codec         string `json:",omitempty"`
+	Bitrate       string `json:",omitempty"`
+	TrackNumber   int    `json:",omitempty"`
+	TrackStart    uint64 `json:",omitempty"`
+	TrackEnd      uint64 `json:",omitempty"`
+	Checksum      string `json:",omitempty"`
+	ChecksumTime  int64  `json:",omitempty"`
+	Duration      int    `json:",omitempty"`
+	Rating        int    `json:",omitempty"`
+	PlayCount     int    `json:",omitempty"`
+	LastPlayed    int64  `json:",omitempty"`
+	MusicBrainzID string `json:",omitempty"`
 }
 
 // InitDB initializes the database with the
 // specified configuration and returns nil if
 // there was no problem.
+// If the encryption is enabled the database is
+// decrypted and CloseDB must be called to save it.
+// With SetMemoryDB the path is not used and an empty
+// database is created in memory.
+// Only one process can modify the database, the others
+// must open it read only with SetReadOnlyDB.
 func InitDB(path string) error {
+	if readOnlyDB() {
+		return openReadOnly(path)
+	}
+
+	if memory.enabled {
+		var err error
+		path, err = openMemory()
+		if err != nil {
+			return err
+		}
+	} else {
+		err := lockDB(path)
+		if err != nil {
+			return err
+		}
+
+		if len(encryption.secret) > 0 {
+			path, err = openEncrypted(path)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
 	db, err := bolt.Open(path, 0600, nil)
 	if err != nil {
 		return err
@@ -82,7 +192,13 @@ func InitDB(path string) error {
 			glog.Errorf("Error creating bucket: %s", err)
 			return fmt.Errorf("Error creating bucket: %s", err)
 		}
-		return nil
+
+		_, err = tx.CreateBucketIfNotExists([]byte("Journal"))
+		if err != nil {
+			glog.Errorf("Error creating bucket: %s", err)
+			return fmt.Errorf("Error creating bucket: %s", err)
+		}
+		return setSchemaVersion(tx)
 	})
 
 	if err != nil {
@@ -93,6 +209,15 @@ func InitDB(path string) error {
 	return nil
 }
 
+// DBSize returns the size in bytes of the database file.
+func DBSize() (int64, error) {
+	fi, err := os.Stat(config.DbPath)
+	if err != nil {
+		return 0, err
+	}
+	return fi.Size(), nil
+}
+
 // isMn checks if the rune is in the Unicode
 // category Mn.
 func isMn(r rune) bool {
@@ -123,7 +248,18 @@ func GetCompatibleString(name string) string {
 // and completes the missing information with the default
 // data.
 func StoreNewSong(song *musicmgr.FileTags, path string) error {
-	db, err := bolt.Open(config.DbPath, 0600, nil)
+	// The checksum is calculated before opening the
+	// database, it takes a while for big files.
+	old, _ := GetSong(GetCompatibleString(song.Artist), GetCompatibleString(song.Album),
+		GetCompatibleString(song.Title)+filepath.Ext(path))
+	checksum, checksumTime := updateChecksum(old, path)
+	if len(song.BPM) < 1 {
+		song.BPM = songBPM(old, path)
+	}
+	codec, bitrate := musicmgr.GetQuality(path)
+	duration := musicmgr.GetDuration(path)
+
+	db, err := openDB()
 	if err != nil {
 		return err
 	}
@@ -179,6 +315,9 @@ func StoreNewSong(song *musicmgr.FileTags, path string) error {
 				artistStore.ArtistAlbums = append(artistStore.ArtistAlbums, albumPath)
 			}
 		}
+		if len(song.MusicBrainzArtist) > 0 {
+			artistStore.MusicBrainzID = song.MusicBrainzArtist
+		}
 		encoded, err := json.Marshal(artistStore)
 		if err != nil {
 			return err
@@ -192,9 +331,17 @@ func StoreNewSong(song *musicmgr.FileTags, path string) error {
 			return fmt.Errorf("Error creating bucket: %s", updateError)
 		}
 
-		// Update the album description
+		// Update the album description keeping
+		// the information edited by the user.
+		descValue = albumBucket.Get([]byte(".description"))
+		if descValue != nil {
+			json.Unmarshal(descValue, &albumStore)
+		}
 		albumStore.AlbumName = song.Album
 		albumStore.AlbumPath = albumPath
+		if len(song.MusicBrainzAlbum) > 0 {
+			albumStore.MusicBrainzID = song.MusicBrainzAlbum
+		}
 		encoded, err = json.Marshal(albumStore)
 		if err != nil {
 			return err
@@ -208,6 +355,27 @@ func StoreNewSong(song *musicmgr.FileTags, path string) error {
 		songStore.SongName = song.Title
 		songStore.SongPath = songPath + extension
 		songStore.SongFullPath = path
+		songStore.Genre = song.Genre
+		songStore.Year = song.Year
+		songStore.Composer = song.Composer
+		songStore.Work = song.Work
+		songStore.Conductor = song.Conductor
+		songStore.BPM = song.BPM
+		songStore.Key = song.Key
+		songStore.Track = song.Track
+		songStore.TrackArtist = song.TrackArtist
+		songStore.Codec = codec
+		songStore.Bitrate = bitrate
+		songStore.Checksum = checksum
+		songStore.ChecksumTime = checksumTime
+		songStore.Duration = duration
+		songStore.Rating = old.Rating
+		songStore.PlayCount = old.PlayCount
+		songStore.LastPlayed = old.LastPlayed
+		songStore.MusicBrainzID = old.MusicBrainzID
+		if len(song.MusicBrainzTrack) > 0 {
+			songStore.MusicBrainzID = song.MusicBrainzTrack
+		}
 
 		encoded, err = json.Marshal(songStore)
 		if err != nil {
@@ -215,7 +383,8 @@ func StoreNewSong(song *musicmgr.FileTags, path string) error {
 		}
 
 		albumBucket.Put([]byte(songPath+extension), encoded)
-		return nil
+		ref := SongRef{Artist: artistPath, Album: albumPath, Song: songPath + extension}
+		return indexSongTags(tx, old, songStore, ref)
 	})
 
 	return nil
@@ -229,7 +398,7 @@ func StoreNewSong(song *musicmgr.FileTags, path string) error {
 // was no error and nil if the Artists were
 // obtained correctly.
 func ListArtists() ([]fuse.Dirent, error) {
-	db, err := bolt.Open(config.DbPath, 0600, nil)
+	db, err := openDB()
 	if err != nil {
 		return nil, err
 	}
@@ -240,17 +409,36 @@ func ListArtists() ([]fuse.Dirent, error) {
 		b := tx.Bucket([]byte("Artists"))
 		c := b.Cursor()
 		for k, v := c.First(); k != nil; k, v = c.Next() {
-			if v == nil {
-				var node fuse.Dirent
-				node.Name = string(k)
-				node.Type = fuse.DT_Dir
-				a = append(a, node)
-			} else {
-				var node fuse.Dirent
-				node.Name = string(k)
-				node.Type = fuse.DT_File
-				a = append(a, node)
-			}
+			a = append(a, artistDirent(k, v))
+		}
+		return nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return a, nil
+}
+
+// ListArtistsPage returns up to limit Dirent of the Artists
+// stored after the specified name, an empty name starts
+// from the first Artist.
+// It is used to stream the Artist listing in small
+// transactions.
+func ListArtistsPage(after string, limit int) ([]fuse.Dirent, error) {
+	db, err := openDB()
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	var a []fuse.Dirent
+	err = db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte("Artists"))
+		c := b.Cursor()
+		for k, v := seekAfter(c, after); k != nil && len(a) < limit; k, v = c.Next() {
+			a = append(a, artistDirent(k, v))
 		}
 		return nil
 	})
@@ -262,6 +450,30 @@ func ListArtists() ([]fuse.Dirent, error) {
 	return a, nil
 }
 
+// artistDirent returns the Dirent of an entry in the
+// Artists bucket, the buckets are the Artist Directories.
+func artistDirent(k, v []byte) fuse.Dirent {
+	if v == nil {
+		return fuse.Dirent{Name: string(k), Type: fuse.DT_Dir}
+	}
+	return fuse.Dirent{Name: string(k), Type: fuse.DT_File}
+}
+
+// seekAfter moves the cursor to the first key stored
+// after the specified one, an empty key moves it to
+// the first key in the bucket.
+func seekAfter(c *bolt.Cursor, after string) ([]byte, []byte) {
+	if len(after) < 1 {
+		return c.First()
+	}
+
+	k, v := c.Seek([]byte(after))
+	if k != nil && string(k) == after {
+		return c.Next()
+	}
+	return k, v
+}
+
 // ListAlbums returns all the Dirent corresponding
 // to Albums for a specified Artist in the database.
 // This is used to generate the Album listing on the
@@ -270,7 +482,7 @@ func ListArtists() ([]fuse.Dirent, error) {
 // was no error and nil if the Albums were
 // obtained correctly.
 func ListAlbums(artist string) ([]fuse.Dirent, error) {
-	db, err := bolt.Open(config.DbPath, 0600, nil)
+	db, err := openDB()
 	if err != nil {
 		return nil, err
 	}
@@ -313,7 +525,7 @@ func ListAlbums(artist string) ([]fuse.Dirent, error) {
 // was no error and nil if the Songs were
 // obtained correctly.
 func ListSongs(artist string, album string) ([]fuse.Dirent, error) {
-	db, err := bolt.Open(config.DbPath, 0600, nil)
+	db, err := openDB()
 	if err != nil {
 		return nil, err
 	}
@@ -326,17 +538,454 @@ func ListSongs(artist string, album string) ([]fuse.Dirent, error) {
 		b := artistBucket.Bucket([]byte(album))
 		c := b.Cursor()
 		for k, v := c.First(); k != nil; k, v = c.Next() {
+			if node, ok := songDirent(k, v); ok {
+				a = append(a, node)
+			}
+		}
+		return nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return a, nil
+}
+
+// ListAlbumSongsPage returns up to limit Dirent of the Songs
+// stored in an Album after the specified name, an empty
+// name starts from the first Song.
+// It is used to stream the Album listing in small
+// transactions.
+func ListAlbumSongsPage(artist, album, after string, limit int) ([]fuse.Dirent, error) {
+	db, err := openDB()
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	var a []fuse.Dirent
+	err = db.View(func(tx *bolt.Tx) error {
+		root := tx.Bucket([]byte("Artists"))
+		artistBucket := root.Bucket([]byte(artist))
+		if artistBucket == nil {
+			return fuse.ENOENT
+		}
+
+		b := artistBucket.Bucket([]byte(album))
+		if b == nil {
+			return fuse.ENOENT
+		}
+
+		c := b.Cursor()
+		for k, v := seekAfter(c, after); k != nil && len(a) < limit; k, v = c.Next() {
+			if node, ok := songDirent(k, v); ok {
+				a = append(a, node)
+			}
+		}
+		return nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return a, nil
+}
+
+// songDirent returns the Dirent of an entry in an Album
+// bucket, the Songs that cannot be decoded are skipped.
+func songDirent(k, v []byte) (fuse.Dirent, bool) {
+	var song SongStore
+	if k[0] != '.' || string(k) == ".description" {
+		err := json.Unmarshal(v, &song)
+		if err != nil {
+			return fuse.Dirent{}, false
+		}
+	}
+	return fuse.Dirent{Name: string(k), Type: fuse.DT_File}, true
+}
+
+// SongFile is a Song listed in a Directory
+// with the path of its file.
+// Track is true for the tracks of the Album images.
+type SongFile struct {
+	Name  string
+	Path  string
+	Track bool
+}
+
+// ListAlbumSongFiles returns the Songs of an Album with the
+// paths of their files, reading the whole Album at once.
+// It is used to prefetch the attributes of the Songs
+// when the Album is listed.
+func ListAlbumSongFiles(artist, album string) ([]SongFile, error) {
+	db, err := openDB()
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	var a []SongFile
+	err = db.View(func(tx *bolt.Tx) error {
+		root := tx.Bucket([]byte("Artists"))
+		artistBucket := root.Bucket([]byte(artist))
+		if artistBucket == nil {
+			return fuse.ENOENT
+		}
+
+		b := artistBucket.Bucket([]byte(album))
+		if b == nil {
+			return fuse.ENOENT
+		}
+
+		c := b.Cursor()
+		for k, v := c.First(); k != nil; k, v = c.Next() {
+			if k[0] == '.' || v == nil {
+				continue
+			}
+
 			var song SongStore
-			if k[0] != '.' || string(k) == ".description" {
-				err := json.Unmarshal(v, &song)
-				if err != nil {
+			if err := json.Unmarshal(v, &song); err != nil {
+				continue
+			}
+			a = append(a, SongFile{Name: string(k), Path: song.SongFullPath, Track: song.TrackNumber > 0})
+		}
+		return nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return a, nil
+}
+
+// AlbumRef identifies an Album in the database
+// by the Artist and Album keys.
+type AlbumRef struct {
+	Artist string
+	Album  string
+}
+
+// CountEntries returns the amount of Directories and files
+// listed inside an Artist from the database, or inside an
+// Album when it is specified.
+// An empty Artist counts the entries of the root Directory.
+func CountEntries(artist, album string) (int, int, error) {
+	db, err := openDB()
+	if err != nil {
+		return 0, 0, err
+	}
+	defer db.Close()
+
+	var dirs, files int
+	err = db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte("Artists"))
+		if len(artist) > 0 {
+			b = b.Bucket([]byte(artist))
+			if b == nil {
+				return fuse.ENOENT
+			}
+		}
+
+		if len(album) > 0 {
+			b = b.Bucket([]byte(album))
+			if b == nil {
+				return fuse.ENOENT
+			}
+		}
+
+		c := b.Cursor()
+		for k, v := c.First(); k != nil; k, v = c.Next() {
+			if len(album) > 0 {
+				if _, ok := songDirent(k, v); ok {
+					files++
+				}
+			} else if v == nil {
+				dirs++
+			} else {
+				files++
+			}
+		}
+		return nil
+	})
+
+	if err != nil {
+		return 0, 0, err
+	}
+
+	return dirs, files, nil
+}
+
+// ListSongPaths returns the paths of the files of the Songs
+// of an Artist, or only of an Album when it is specified.
+func ListSongPaths(artist, album string) ([]string, error) {
+	db, err := openDB()
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	var a []string
+	err = db.View(func(tx *bolt.Tx) error {
+		root := tx.Bucket([]byte("Artists"))
+		artistBucket := root.Bucket([]byte(artist))
+		if artistBucket == nil {
+			return fuse.ENOENT
+		}
+
+		c := artistBucket.Cursor()
+		for k, v := c.First(); k != nil; k, v = c.Next() {
+			if v != nil || (len(album) > 0 && string(k) != album) {
+				continue
+			}
+
+			d := artistBucket.Bucket(k).Cursor()
+			for song, songJson := d.First(); song != nil; song, songJson = d.Next() {
+				if songJson == nil || song[0] == '.' {
+					continue
+				}
+
+				var s SongStore
+				if err := json.Unmarshal(songJson, &s); err != nil {
+					continue
+				}
+				a = append(a, s.SongFullPath)
+			}
+		}
+		return nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return a, nil
+}
+
+// ListAllAlbums returns all the Albums in the database
+// for every Artist.
+// It stops and returns the context error if the
+// context is cancelled while iterating the Artists.
+func ListAllAlbums(ctx context.Context) ([]AlbumRef, error) {
+	db, err := openDB()
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	var a []AlbumRef
+	err = db.View(func(tx *bolt.Tx) error {
+		root := tx.Bucket([]byte("Artists"))
+		c := root.Cursor()
+		for artist, v := c.First(); artist != nil; artist, v = c.Next() {
+			if v != nil {
+				continue
+			}
+
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+
+			artistBucket := root.Bucket(artist)
+			d := artistBucket.Cursor()
+			for album, w := d.First(); album != nil; album, w = d.Next() {
+				if w == nil {
+					a = append(a, AlbumRef{Artist: string(artist), Album: string(album)})
+				}
+			}
+		}
+		return nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return a, nil
+}
+
+// SongRef identifies a Song in the database
+// by the Artist, Album and Song keys.
+type SongRef struct {
+	Artist string
+	Album  string
+	Song   string
+}
+
+// ListSongsPage returns up to limit Songs stored after the
+// specified Song, iterating all the Artists and Albums in order.
+// An empty SongRef starts from the first Song in the database.
+// It is used to walk the whole Library in small transactions.
+func ListSongsPage(after SongRef, limit int) ([]SongRef, error) {
+	db, err := openDB()
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	var a []SongRef
+	err = db.View(func(tx *bolt.Tx) error {
+		root := tx.Bucket([]byte("Artists"))
+		ac := root.Cursor()
+
+		var artist, v []byte
+		if len(after.Artist) < 1 {
+			artist, v = ac.First()
+		} else {
+			artist, v = ac.Seek([]byte(after.Artist))
+		}
+
+		for ; artist != nil && len(a) < limit; artist, v = ac.Next() {
+			if v != nil {
+				continue
+			}
+
+			resumeArtist := string(artist) == after.Artist
+			artistBucket := root.Bucket(artist)
+			bc := artistBucket.Cursor()
+
+			var album, w []byte
+			if resumeArtist && len(after.Album) > 0 {
+				album, w = bc.Seek([]byte(after.Album))
+			} else {
+				album, w = bc.First()
+			}
+
+			for ; album != nil && len(a) < limit; album, w = bc.Next() {
+				if w != nil {
+					continue
+				}
+
+				albumBucket := artistBucket.Bucket(album)
+				sc := albumBucket.Cursor()
+
+				var song, x []byte
+				if resumeArtist && string(album) == after.Album {
+					song, x = sc.Seek([]byte(after.Song))
+					if song != nil && string(song) == after.Song {
+						song, x = sc.Next()
+					}
+				} else {
+					song, x = sc.First()
+				}
+
+				for ; song != nil && len(a) < limit; song, x = sc.Next() {
+					if x == nil || song[0] == '.' {
+						continue
+					}
+					a = append(a, SongRef{Artist: string(artist), Album: string(album), Song: string(song)})
+				}
+			}
+		}
+		return nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return a, nil
+}
+
+// FindSong searches a Song by its name in every Album
+// of the specified Artist and returns the first match.
+// If the Artist is empty every Artist is searched.
+// It stops and returns the context error if the
+// context is cancelled while iterating the Artists.
+func FindSong(ctx context.Context, artist, song string) (SongRef, error) {
+	db, err := openDB()
+	if err != nil {
+		return SongRef{}, err
+	}
+	defer db.Close()
+
+	var returnValue SongRef
+	err = db.View(func(tx *bolt.Tx) error {
+		root := tx.Bucket([]byte("Artists"))
+		ac := root.Cursor()
+		for k, v := ac.First(); k != nil; k, v = ac.Next() {
+			if v != nil || (len(artist) > 0 && string(k) != artist) {
+				continue
+			}
+
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+
+			artistBucket := root.Bucket(k)
+			bc := artistBucket.Cursor()
+			for album, w := bc.First(); album != nil; album, w = bc.Next() {
+				if w != nil {
 					continue
 				}
+
+				if artistBucket.Bucket(album).Get([]byte(song)) != nil {
+					returnValue = SongRef{Artist: string(k), Album: string(album), Song: song}
+					return nil
+				}
+			}
+		}
+		return fuse.ENOENT
+	})
+
+	if err != nil {
+		return SongRef{}, err
+	}
+	return returnValue, nil
+}
+
+// ArtistSong identifies a Song inside an Artist when
+// the Songs are listed regardless of the Album.
+// Name is the file name used in the listing, Album
+// and Song are the keys used in the database.
+type ArtistSong struct {
+	Name  string
+	Album string
+	Song  string
+}
+
+// ListArtistSongs returns all the Songs for a specified
+// Artist in every Album.
+// When two Songs share the same name in different Albums
+// the Album name is prepended to the later ones.
+func ListArtistSongs(artist string) ([]ArtistSong, error) {
+	db, err := openDB()
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	var a []ArtistSong
+	err = db.View(func(tx *bolt.Tx) error {
+		root := tx.Bucket([]byte("Artists"))
+		artistBucket := root.Bucket([]byte(artist))
+		if artistBucket == nil {
+			return fuse.ENOENT
+		}
+
+		used := make(map[string]bool)
+		c := artistBucket.Cursor()
+		for album, v := c.First(); album != nil; album, v = c.Next() {
+			if v != nil {
+				continue
+			}
+
+			albumBucket := artistBucket.Bucket(album)
+			d := albumBucket.Cursor()
+			for k, songJson := d.First(); k != nil; k, songJson = d.Next() {
+				if songJson == nil || k[0] == '.' {
+					continue
+				}
+
+				name := string(k)
+				if used[name] {
+					name = string(album) + "_" + name
+				}
+				used[name] = true
+				a = append(a, ArtistSong{Name: name, Album: string(album), Song: string(k)})
 			}
-			var node fuse.Dirent
-			node.Name = string(k)
-			node.Type = fuse.DT_File
-			a = append(a, node)
 		}
 		return nil
 	})
@@ -353,7 +1002,7 @@ func ListSongs(artist string, album string) ([]fuse.Dirent, error) {
 // error if it does not.
 // It also returns the Artist name as string.
 func GetArtistPath(artist string) (string, error) {
-	db, err := bolt.Open(config.DbPath, 0600, nil)
+	db, err := openDB()
 	if err != nil {
 		return "", err
 	}
@@ -381,7 +1030,7 @@ func GetArtistPath(artist string) (string, error) {
 // a fuse error if it does not.
 // It also returns the Album name as string.
 func GetAlbumPath(artist string, album string) (string, error) {
-	db, err := bolt.Open(config.DbPath, 0600, nil)
+	db, err := openDB()
 	if err != nil {
 		return "", err
 	}
@@ -416,7 +1065,7 @@ func GetAlbumPath(artist string, album string) (string, error) {
 // the error will be returned.
 func GetSong(artist, album, song string) (SongStore, error) {
 	glog.Infof("Getting file for song: %s Artist: %s Album: %s\n", song, artist, album)
-	db, err := bolt.Open(config.DbPath, 0600, nil)
+	db, err := openDB()
 	if err != nil {
 		return SongStore{}, err
 	}
@@ -466,7 +1115,7 @@ func GetSong(artist, album, song string) (SongStore, error) {
 // an error will be returned.
 func GetFilePath(artist, album, song string) (string, error) {
 	glog.Infof("Getting file path for song: %s Artist: %s Album: %s\n", song, artist, album)
-	db, err := bolt.Open(config.DbPath, 0600, nil)
+	db, err := openDB()
 	if err != nil {
 		return "", err
 	}
@@ -517,7 +1166,7 @@ func GetFilePath(artist, album, song string) (string, error) {
 // If the description is obtained correctly a string with
 // the JSON is returned and nil.
 func GetDescription(artist string, album string, name string) (string, error) {
-	db, err := bolt.Open(config.DbPath, 0600, nil)
+	db, err := openDB()
 	if err != nil {
 		return "", err
 	}
@@ -540,6 +1189,11 @@ func GetDescription(artist string, album string, name string) (string, error) {
 			return fuse.ENOENT
 		}
 
+		// The custom fields without value are shown
+		// so they can be filled in the file.
+		if name == ".description" {
+			descJson = completeDescription(descJson, album)
+		}
 		returnValue = string(descJson) + "\n"
 		return nil
 	})
@@ -550,6 +1204,78 @@ func GetDescription(artist string, album string, name string) (string, error) {
 	return returnValue, nil
 }
 
+// GetAlbumPlaylist generates an M3U playlist with all the
+// Songs in the specified Album sorted by their track number,
+// the Songs without it are listed last by their name.
+// The prefix is prepended to every Song name, an empty
+// prefix generates paths relative to the Album Directory.
+func GetAlbumPlaylist(artist, album, prefix string) (string, error) {
+	db, err := openDB()
+	if err != nil {
+		return "", err
+	}
+	defer db.Close()
+
+	returnValue := "#EXTM3U\n"
+	err = db.View(func(tx *bolt.Tx) error {
+		root := tx.Bucket([]byte("Artists"))
+		artistBucket := root.Bucket([]byte(artist))
+		if artistBucket == nil {
+			return fuse.ENOENT
+		}
+
+		albumBucket := artistBucket.Bucket([]byte(album))
+		if albumBucket == nil {
+			return fuse.ENOENT
+		}
+
+		type albumEntry struct {
+			name  string
+			track int
+			song  SongStore
+		}
+
+		var entries []albumEntry
+		c := albumBucket.Cursor()
+		for k, v := c.First(); k != nil; k, v = c.Next() {
+			if v == nil || k[0] == '.' {
+				continue
+			}
+
+			e := albumEntry{name: string(k)}
+			if json.Unmarshal(v, &e.song) == nil {
+				e.track, _ = strconv.Atoi(musicmgr.ParseTrack(e.song.Track))
+			}
+			entries = append(entries, e)
+		}
+
+		// The Songs are sorted like in the .tracks file, the
+		// ones without track number are listed last.
+		sort.SliceStable(entries, func(i, j int) bool {
+			a, b := entries[i].track, entries[j].track
+			if a != b {
+				return b == 0 || (a > 0 && a < b)
+			}
+			return entries[i].name < entries[j].name
+		})
+
+		for _, e := range entries {
+			// The players show the duration and the title
+			// of the Songs before reading them.
+			if e.song.Duration > 0 {
+				returnValue = returnValue + fmt.Sprintf("#EXTINF:%d,%s\n", e.song.Duration, e.song.SongName)
+			}
+			returnValue = returnValue + prefix + e.name + "\n"
+		}
+		return nil
+	})
+
+	if err != nil {
+		return "", err
+	}
+	return returnValue, nil
+}
+
 // CreateArtist creates a new artist from a Raw
 // name. It generates the compatible string to
 // use as Directory name and stores the information
@@ -559,7 +1285,7 @@ func GetDescription(artist string, album string, name string) (string, error) {
 // error return value, nil otherwise.
 func CreateArtist(nameRaw string) (string, error) {
 	name := GetCompatibleString(nameRaw)
-	db, err := bolt.Open(config.DbPath, 0600, nil)
+	db, err := openDB()
 	if err != nil {
 		return name, err
 	}
@@ -603,7 +1329,7 @@ func CreateArtist(nameRaw string) (string, error) {
 // name and the second value will contain nil.
 func CreateAlbum(artist string, nameRaw string) (string, error) {
 	name := GetCompatibleString(nameRaw)
-	db, err := bolt.Open(config.DbPath, 0600, nil)
+	db, err := openDB()
 	if err != nil {
 		return name, err
 	}
@@ -686,14 +1412,15 @@ func CreateAlbum(artist string, nameRaw string) (string, error) {
 func CreateSong(artist string, album string, nameRaw string, path string) (string, error) {
 	glog.Infof("Adding song to the DB: %s with Artist: %s and Album: %s\n", nameRaw, artist, album)
 	extension := filepath.Ext(nameRaw)
-	if extension != ".mp3" {
+	if !musicmgr.IsMusicFile(nameRaw) {
 		return "", errors.New("Wrong file format.")
 	}
 
 	nameRaw = nameRaw[:len(nameRaw)-len(extension)]
 	name := GetCompatibleString(nameRaw)
+	checksum, checksumTime := updateChecksum(SongStore{}, path+name+extension)
 
-	db, err := bolt.Open(config.DbPath, 0600, nil)
+	db, err := openDB()
 	if err != nil {
 		return name, err
 	}
@@ -703,17 +1430,19 @@ func CreateSong(artist string, album string, nameRaw string, path string) (strin
 		root := tx.Bucket([]byte("Artists"))
 		artistBucket := root.Bucket([]byte(artist))
 		if artistBucket == nil {
-			return errors.New("Artist not found.")
+			return fuse.ENOENT
 		}
 		albumBucket := artistBucket.Bucket([]byte(album))
 		if albumBucket == nil {
-			return errors.New("Album not found.")
+			return fuse.ENOENT
 		}
 
 		var songStore SongStore
 		songStore.SongName = nameRaw
 		songStore.SongPath = name + extension
 		songStore.SongFullPath = path + name + extension
+		songStore.Checksum = checksum
+		songStore.ChecksumTime = checksumTime
 
 		encoded, err := json.Marshal(songStore)
 		if err != nil {
@@ -728,20 +1457,25 @@ func CreateSong(artist string, album string, nameRaw string, path string) (strin
 	return name + extension, err
 }
 
-// DeleteArtist deletes the specified Artist only
-// in the database and returns nil if there was no error.
-func DeleteArtist(artist, mPoint string) error {
+// DeleteArtist deletes the specified Artist in the
+// database and returns nil if there was no error.
+// The files of its Songs are removed, kept or moved
+// to the trash depending on the mode.
+func DeleteArtist(artist, mPoint string, mode DeleteMode) error {
 	glog.Infof("Deleting Artist: %s\n", artist)
-	db, err := bolt.Open(config.DbPath, 0600, nil)
+	db, err := openDB()
 	if err != nil {
 		return err
 	}
-	defer db.Close()
 
 	var songList []SongStore
+	var albumList, albums []string
 	err = db.Update(func(tx *bolt.Tx) error {
 		root := tx.Bucket([]byte("Artists"))
 		buck := root.Bucket([]byte(artist))
+		if buck == nil {
+			return fuse.ENOENT
+		}
 
 		c := buck.Cursor()
 		for k, _ := c.First(); k != nil; k, _ = c.Next() {
@@ -752,6 +1486,7 @@ func DeleteArtist(artist, mPoint string) error {
 			if album == nil {
 				continue
 			}
+			albums = append(albums, string(k))
 			d := album.Cursor()
 			for name, _ := d.First(); name != nil; name, _ = d.Next() {
 				if name[0] == '.' {
@@ -769,47 +1504,55 @@ func DeleteArtist(artist, mPoint string) error {
 				}
 				song.SongName = string(name)
 				songList = append(songList, song)
+				albumList = append(albumList, string(k))
 			}
 		}
 		root.DeleteBucket([]byte(artist))
 		return nil
 	})
+	db.Close()
 
 	if err != nil {
 		return err
 	}
 
-	for _, v := range songList {
+	record := UndoRecord{Op: UndoDelete, Name: artist}
+	for i, v := range songList {
 		if v.Playlists != nil {
 			for _, list := range v.Playlists {
 				DeletePlaylistSong(list, v.SongName, true)
 				RegeneratePlaylistFile(list, mPoint)
 			}
 		}
-		os.Remove(v.SongFullPath)
+		path := removeSongFile(v.SongFullPath, mPoint, mode)
+		record.Songs = append(record.Songs, UndoSong{SongRef: SongRef{Artist: artist, Album: albumList[i], Song: v.SongName},
+			Path: path, OldPath: v.SongFullPath, Playlists: v.Playlists})
 	}
+	removeEmptyDirs(mPoint, artist, albums...)
+	recordDelete(record)
 	return nil
 }
 
 // DeleteAlbum deletes the specified Album for
-// the specified Artist only in the database and
+// the specified Artist in the database and
 // returns nil if there was no error.
-func DeleteAlbum(artistName, albumName, mPoint string) error {
-	db, err := bolt.Open(config.DbPath, 0600, nil)
+// The files of its Songs are removed, kept or moved
+// to the trash depending on the mode.
+func DeleteAlbum(artistName, albumName, mPoint string, mode DeleteMode) error {
+	db, err := openDB()
 	if err != nil {
 		return err
 	}
-	defer db.Close()
 
 	var songList []SongStore
 	err = db.Update(func(tx *bolt.Tx) error {
 		root := tx.Bucket([]byte("Artists"))
 		artistBucket := root.Bucket([]byte(artistName))
 		if artistBucket == nil {
-			return errors.New("Artist not found.")
+			return fuse.ENOENT
 		}
 
-		album := artistBucket.Bucket([]byte(artistName))
+		album := artistBucket.Bucket([]byte(albumName))
 		if album == nil {
 			return nil
 		}
@@ -834,11 +1577,13 @@ func DeleteAlbum(artistName, albumName, mPoint string) error {
 		artistBucket.DeleteBucket([]byte(albumName))
 		return nil
 	})
+	db.Close()
 
 	if err != nil {
 		return err
 	}
 
+	record := UndoRecord{Op: UndoDelete, Name: artistName + "/" + albumName}
 	for _, v := range songList {
 		if v.Playlists != nil {
 			for _, list := range v.Playlists {
@@ -846,8 +1591,12 @@ func DeleteAlbum(artistName, albumName, mPoint string) error {
 				RegeneratePlaylistFile(list, mPoint)
 			}
 		}
-		os.Remove(v.SongFullPath)
+		path := removeSongFile(v.SongFullPath, mPoint, mode)
+		record.Songs = append(record.Songs, UndoSong{SongRef: SongRef{Artist: artistName, Album: albumName, Song: v.SongName},
+			Path: path, OldPath: v.SongFullPath, Playlists: v.Playlists})
 	}
+	removeEmptyDirs(mPoint, artistName, albumName)
+	recordDelete(record)
 	return nil
 }
 
@@ -860,7 +1609,7 @@ func DeleteSong(artist, album, song, mPoint string) error {
 		return nil
 	}
 
-	db, err := bolt.Open(config.DbPath, 0600, nil)
+	db, err := openDB()
 	if err != nil {
 		return fuse.EIO
 	}
@@ -871,12 +1620,12 @@ func DeleteSong(artist, album, song, mPoint string) error {
 		root := tx.Bucket([]byte("Artists"))
 		artistBucket := root.Bucket([]byte(artist))
 		if artistBucket == nil {
-			return errors.New("Artist not found.")
+			return fuse.ENOENT
 		}
 
 		albumBucket := artistBucket.Bucket([]byte(album))
 		if albumBucket == nil {
-			return errors.New("Album not found.")
+			return fuse.ENOENT
 		}
 
 		songJson := albumBucket.Get([]byte(song))
@@ -0,0 +1,180 @@
+// Copyright 2016 Danko Miocevic. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Author: Danko Miocevic
+
+package store
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/dankomiocevic/mulifs/playlistmgr"
+	"time"
+
+	"github.com/boltdb/bolt"
+)
+
+// PeerSong is a Song stored in the
+// database of another MuLi library.
+type PeerSong struct {
+	SongRef
+	ArtistName string
+	AlbumName  string
+	Store      SongStore
+}
+
+// PeerLibrary is the index of another MuLi library
+// used to synchronize it with this one.
+type PeerLibrary struct {
+	Songs     []PeerSong
+	Playlists map[string][]playlistmgr.PlaylistFile
+	Plays     map[string][]byte
+}
+
+// ReadPeerLibrary reads the Songs, playlists and plays
+// stored in the database of another MuLi library.
+// The auto playlists and the queue are not read, they
+// belong to every library.
+func ReadPeerLibrary(dbPath string) (*PeerLibrary, error) {
+	dbPath, remove, err := readableCopy(dbPath)
+	if err != nil {
+		return nil, err
+	}
+	defer remove()
+
+	db, err := bolt.Open(dbPath, 0600, &bolt.Options{ReadOnly: true, Timeout: 10 * time.Second})
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	peer := &PeerLibrary{
+		Playlists: make(map[string][]playlistmgr.PlaylistFile),
+		Plays:     make(map[string][]byte),
+	}
+	err = db.View(func(tx *bolt.Tx) error {
+		root := tx.Bucket([]byte("Artists"))
+		if root == nil {
+			return errors.New("Not a MuLi database.")
+		}
+
+		err := root.ForEach(func(artist, v []byte) error {
+			if v != nil {
+				return nil
+			}
+
+			artistBucket := root.Bucket(artist)
+			var artistStore ArtistStore
+			json.Unmarshal(artistBucket.Get([]byte(".description")), &artistStore)
+			return artistBucket.ForEach(func(album, w []byte) error {
+				if w != nil {
+					return nil
+				}
+
+				albumBucket := artistBucket.Bucket(album)
+				var albumStore AlbumStore
+				json.Unmarshal(albumBucket.Get([]byte(".description")), &albumStore)
+				return albumBucket.ForEach(func(song, x []byte) error {
+					if x == nil || song[0] == '.' {
+						return nil
+					}
+
+					var songStore SongStore
+					if err := json.Unmarshal(x, &songStore); err != nil {
+						return nil
+					}
+
+					peer.Songs = append(peer.Songs, PeerSong{
+						SongRef:    SongRef{Artist: string(artist), Album: string(album), Song: string(song)},
+						ArtistName: artistStore.ArtistName,
+						AlbumName:  albumStore.AlbumName,
+						Store:      songStore,
+					})
+					return nil
+				})
+			})
+		})
+		if err != nil {
+			return err
+		}
+
+		if playlists := tx.Bucket([]byte("Playlists")); playlists != nil {
+			err = playlists.ForEach(func(name, v []byte) error {
+				if v != nil || IsAutoPlaylist(string(name)) || string(name) == QueuePlaylist {
+					return nil
+				}
+
+				files := []playlistmgr.PlaylistFile{}
+				playlists.Bucket(name).ForEach(func(k, w []byte) error {
+					var file playlistmgr.PlaylistFile
+					if w != nil && json.Unmarshal(w, &file) == nil {
+						files = append(files, file)
+					}
+					return nil
+				})
+				peer.Playlists[string(name)] = files
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+		}
+
+		if plays := tx.Bucket([]byte("Plays")); plays != nil {
+			plays.ForEach(func(k, v []byte) error {
+				peer.Plays[string(k)] = append([]byte(nil), v...)
+				return nil
+			})
+		}
+		return nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+	return peer, nil
+}
+
+// ImportPlays stores the plays of another library that
+// are not in this one, the plays are identified by their
+// time so importing them again does not count them twice.
+// It returns the number of plays imported.
+func ImportPlays(plays map[string][]byte) (int, error) {
+	db, err := openDB()
+	if err != nil {
+		return 0, err
+	}
+	defer db.Close()
+
+	imported := 0
+	err = db.Update(func(tx *bolt.Tx) error {
+		root, err := tx.CreateBucketIfNotExists([]byte("Plays"))
+		if err != nil {
+			return err
+		}
+
+		for k, v := range plays {
+			if root.Get([]byte(k)) != nil {
+				continue
+			}
+
+			if err := root.Put([]byte(k), v); err != nil {
+				return err
+			}
+			imported++
+		}
+		return nil
+	})
+	return imported, err
+}
@@ -0,0 +1,438 @@
+// Copyright 2016 Danko Miocevic. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Author: Danko Miocevic
+
+package store
+
+import (
+	"os"
+	"path"
+	"strings"
+	"syscall"
+
+	"bazil.org/fuse"
+	"github.com/boltdb/bolt"
+	"github.com/golang/glog"
+)
+
+// playlistFolderBucket returns the bucket of the playlist
+// folder or nil if it does not exist, the empty path
+// returns the root of the folders.
+// Every folder is a bucket inside the PlaylistFolders bucket
+// or inside its parent folder, it contains the names of its
+// playlists and its sub folders. The path of a folder is its
+// name and the names of its parents separated by slashes.
+func playlistFolderBucket(tx *bolt.Tx, folder string) *bolt.Bucket {
+	b := tx.Bucket([]byte("PlaylistFolders"))
+	if b == nil || len(folder) < 1 {
+		return b
+	}
+
+	for _, name := range strings.Split(folder, "/") {
+		b = b.Bucket([]byte(name))
+		if b == nil {
+			return nil
+		}
+	}
+	return b
+}
+
+// createPlaylistFolderBucket returns the bucket of the
+// playlist folder, creating it and its parents if needed.
+func createPlaylistFolderBucket(tx *bolt.Tx, folder string) (*bolt.Bucket, error) {
+	b, err := tx.CreateBucketIfNotExists([]byte("PlaylistFolders"))
+	if err != nil || len(folder) < 1 {
+		return b, err
+	}
+
+	for _, name := range strings.Split(folder, "/") {
+		b, err = b.CreateBucketIfNotExists([]byte(name))
+		if err != nil {
+			return nil, err
+		}
+	}
+	return b, nil
+}
+
+// findPlaylistFolder searches the playlist inside the
+// folder b and its sub folders and returns the path
+// of the folder that contains it.
+func findPlaylistFolder(b *bolt.Bucket, folder, playlist string) (string, bool) {
+	if b.Get([]byte(playlist)) != nil {
+		return folder, true
+	}
+
+	c := b.Cursor()
+	for k, v := c.First(); k != nil; k, v = c.Next() {
+		if v != nil {
+			continue
+		}
+		if found, ok := findPlaylistFolder(b.Bucket(k), path.Join(folder, string(k)), playlist); ok {
+			return found, true
+		}
+	}
+	return "", false
+}
+
+// folderedPlaylists adds the names of the playlists
+// inside the folder b and its sub folders.
+func folderedPlaylists(b *bolt.Bucket, names map[string]bool) {
+	c := b.Cursor()
+	for k, v := c.First(); k != nil; k, v = c.Next() {
+		if v != nil {
+			names[string(k)] = true
+		} else {
+			folderedPlaylists(b.Bucket(k), names)
+		}
+	}
+}
+
+// playlistFolder returns the path of the folder of
+// the playlist, it is empty outside the folders.
+func playlistFolder(tx *bolt.Tx, playlist string) string {
+	b := tx.Bucket([]byte("PlaylistFolders"))
+	if b == nil {
+		return ""
+	}
+
+	folder, _ := findPlaylistFolder(b, "", playlist)
+	return folder
+}
+
+// playlistFileName returns the name of the playlist
+// file relative to the playlists Directory.
+func playlistFileName(tx *bolt.Tx, playlist string) string {
+	return path.Join(playlistFolder(tx, playlist), playlist)
+}
+
+// removePlaylistFolderEntry takes the playlist out of
+// its folder and returns the path of the folder.
+func removePlaylistFolderEntry(tx *bolt.Tx, playlist string) (string, error) {
+	folder := playlistFolder(tx, playlist)
+	if len(folder) < 1 {
+		return "", nil
+	}
+	return folder, playlistFolderBucket(tx, folder).Delete([]byte(playlist))
+}
+
+// putPlaylistFolderEntry adds the playlist to the
+// folder, nothing is stored for the root.
+func putPlaylistFolderEntry(tx *bolt.Tx, folder, playlist string) error {
+	if len(folder) < 1 {
+		return nil
+	}
+
+	b, err := createPlaylistFolderBucket(tx, folder)
+	if err != nil {
+		return err
+	}
+	return b.Put([]byte(playlist), []byte(playlist))
+}
+
+// PlaylistFolderPath returns the path of a playlist
+// folder with every name changed like the names
+// of the playlists.
+func PlaylistFolderPath(folder string) string {
+	var names []string
+	for _, name := range strings.Split(folder, "/") {
+		name = PlaylistName(name)
+		if len(name) > 0 {
+			names = append(names, name)
+		}
+	}
+	return strings.Join(names, "/")
+}
+
+// playlistsDir returns the path of the playlists
+// Directory inside the mount path.
+func playlistsDir(mPoint string) string {
+	if mPoint[len(mPoint)-1] != '/' {
+		mPoint = mPoint + "/"
+	}
+	return mPoint + "playlists/"
+}
+
+// IsPlaylistFolder returns true if the path
+// is an existing playlist folder.
+func IsPlaylistFolder(folder string) bool {
+	if len(folder) < 1 {
+		return false
+	}
+
+	db, err := openDB()
+	if err != nil {
+		return false
+	}
+	defer db.Close()
+
+	found := false
+	db.View(func(tx *bolt.Tx) error {
+		found = playlistFolderBucket(tx, folder) != nil
+		return nil
+	})
+	return found
+}
+
+// GetPlaylistFolder returns the path of the folder
+// of the playlist, it is empty outside the folders.
+func GetPlaylistFolder(playlist string) string {
+	db, err := openDB()
+	if err != nil {
+		return ""
+	}
+	defer db.Close()
+
+	var folder string
+	db.View(func(tx *bolt.Tx) error {
+		folder = playlistFolder(tx, playlist)
+		return nil
+	})
+	return folder
+}
+
+// ListPlaylistFolder returns the sub folders and the
+// playlists inside the folder, the empty path lists
+// the root of the playlists Directory.
+func ListPlaylistFolder(folder string) ([]fuse.Dirent, error) {
+	glog.Infof("Listing playlist folder: %s\n", folder)
+	db, err := openDB()
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	var a []fuse.Dirent
+	err = db.View(func(tx *bolt.Tx) error {
+		playlists := tx.Bucket([]byte("Playlists"))
+		b := playlistFolderBucket(tx, folder)
+		if b == nil && len(folder) > 0 {
+			return fuse.ENOENT
+		}
+
+		foldered := make(map[string]bool)
+		if b != nil {
+			c := b.Cursor()
+			for k, v := c.First(); k != nil; k, v = c.Next() {
+				if v != nil && (playlists == nil || playlists.Bucket(k) == nil) {
+					continue
+				}
+				a = append(a, fuse.Dirent{Name: string(k), Type: fuse.DT_Dir})
+			}
+			if len(folder) < 1 {
+				folderedPlaylists(b, foldered)
+			}
+		}
+
+		if len(folder) > 0 || playlists == nil {
+			return nil
+		}
+
+		c := playlists.Cursor()
+		for k, v := c.First(); k != nil; k, v = c.Next() {
+			if v == nil && !foldered[string(k)] {
+				a = append(a, fuse.Dirent{Name: string(k), Type: fuse.DT_Dir})
+			}
+		}
+		return nil
+	})
+	return a, err
+}
+
+// CreatePlaylistFolder creates a folder inside the folder
+// specified, the name cannot be the name of a playlist.
+// It returns the modified name of the folder.
+func CreatePlaylistFolder(folder, name, mPoint string) (string, error) {
+	glog.Infof("Creating playlist folder %s in %s.\n", name, folder)
+	name = PlaylistName(name)
+	db, err := openDB()
+	if err != nil {
+		return "", err
+	}
+	defer db.Close()
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		if len(folder) > 0 && playlistFolderBucket(tx, folder) == nil {
+			return fuse.ENOENT
+		}
+
+		playlists := tx.Bucket([]byte("Playlists"))
+		if playlists != nil && playlists.Bucket([]byte(name)) != nil {
+			return fuse.EEXIST
+		}
+
+		b, err := createPlaylistFolderBucket(tx, folder)
+		if err != nil {
+			return err
+		}
+
+		_, err = b.CreateBucket([]byte(name))
+		if err == bolt.ErrBucketExists {
+			return fuse.EEXIST
+		}
+		return err
+	})
+	if err != nil {
+		return "", err
+	}
+
+	os.MkdirAll(playlistsDir(mPoint)+path.Join(folder, name), 0777)
+	return name, nil
+}
+
+// DeletePlaylistFolder deletes an empty folder, the
+// folders with playlists or sub folders are kept.
+func DeletePlaylistFolder(folder, name, mPoint string) error {
+	glog.Infof("Deleting playlist folder %s in %s.\n", name, folder)
+	db, err := openDB()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		parent := playlistFolderBucket(tx, folder)
+		if parent == nil || parent.Bucket([]byte(name)) == nil {
+			return fuse.ENOENT
+		}
+
+		if k, _ := parent.Bucket([]byte(name)).Cursor().First(); k != nil {
+			return fuse.Errno(syscall.ENOTEMPTY)
+		}
+		return parent.DeleteBucket([]byte(name))
+	})
+	if err != nil {
+		return err
+	}
+
+	os.Remove(playlistsDir(mPoint) + path.Join(folder, name))
+	return nil
+}
+
+// RenamePlaylistFolder moves the folder with its playlists
+// and sub folders to the new folder with the new name,
+// an empty folder with the new name is replaced.
+// It returns the modified name of the folder.
+func RenamePlaylistFolder(folder, name, newFolder, newName, mPoint string) (string, error) {
+	glog.Infof("Renaming playlist folder %s/%s to %s/%s.\n", folder, name, newFolder, newName)
+	newName = PlaylistName(newName)
+	source := path.Join(folder, name)
+	target := path.Join(newFolder, newName)
+	if source == target {
+		return newName, nil
+	}
+
+	// A folder cannot be moved inside itself.
+	if strings.HasPrefix(target, source+"/") {
+		return "", fuse.Errno(syscall.EINVAL)
+	}
+
+	db, err := openDB()
+	if err != nil {
+		return "", err
+	}
+	defer db.Close()
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		parent := playlistFolderBucket(tx, folder)
+		if parent == nil || parent.Bucket([]byte(name)) == nil {
+			return fuse.ENOENT
+		}
+
+		newParent := playlistFolderBucket(tx, newFolder)
+		if newParent == nil {
+			return fuse.ENOENT
+		}
+
+		playlists := tx.Bucket([]byte("Playlists"))
+		if playlists != nil && playlists.Bucket([]byte(newName)) != nil {
+			return fuse.EEXIST
+		}
+
+		if existing := newParent.Bucket([]byte(newName)); existing != nil {
+			if k, _ := existing.Cursor().First(); k != nil {
+				return fuse.Errno(syscall.ENOTEMPTY)
+			}
+			err := newParent.DeleteBucket([]byte(newName))
+			if err != nil {
+				return err
+			}
+		}
+
+		dst, err := newParent.CreateBucket([]byte(newName))
+		if err != nil {
+			return err
+		}
+
+		err = compactBucket(parent.Bucket([]byte(name)), dst)
+		if err != nil {
+			return err
+		}
+		return parent.DeleteBucket([]byte(name))
+	})
+	if err != nil {
+		return "", err
+	}
+
+	dir := playlistsDir(mPoint)
+	os.Remove(dir + target)
+	os.MkdirAll(path.Dir(dir+target), 0777)
+	err = os.Rename(dir+source, dir+target)
+	if err != nil {
+		glog.Infof("Cannot move the playlist folder %s: %s\n", source, err)
+	}
+	return newName, nil
+}
+
+// MovePlaylist moves the playlist to the folder, the
+// folder is created if it does not exist and the empty
+// path moves it to the root of the playlists Directory.
+// The playlist file must be generated again.
+func MovePlaylist(playlist, folder, mPoint string) error {
+	glog.Infof("Moving playlist %s to folder %s.\n", playlist, folder)
+	folder = PlaylistFolderPath(folder)
+	db, err := openDB()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	var oldName string
+	err = db.Update(func(tx *bolt.Tx) error {
+		playlists := tx.Bucket([]byte("Playlists"))
+		if playlists == nil || playlists.Bucket([]byte(playlist)) == nil {
+			return fuse.ENOENT
+		}
+
+		b := playlistFolderBucket(tx, folder)
+		if b != nil && b.Bucket([]byte(playlist)) != nil {
+			return fuse.EEXIST
+		}
+
+		oldName = playlistFileName(tx, playlist)
+		_, err := removePlaylistFolderEntry(tx, playlist)
+		if err != nil {
+			return err
+		}
+		return putPlaylistFolderEntry(tx, folder, playlist)
+	})
+	if err != nil {
+		return err
+	}
+
+	if oldName != path.Join(folder, playlist) {
+		os.Remove(playlistsDir(mPoint) + oldName + ".m3u")
+	}
+	return nil
+}
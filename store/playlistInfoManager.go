@@ -0,0 +1,211 @@
+// Copyright 2016 Danko Miocevic. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Author: Danko Miocevic
+
+package store
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"strings"
+	"unicode"
+
+	"bazil.org/fuse"
+	"github.com/boltdb/bolt"
+	"github.com/golang/glog"
+)
+
+// The styles of the names of the playlist Directories.
+const (
+	// PlaylistNamesCompatible uses GetCompatibleString
+	// like the Artist and Album names.
+	PlaylistNamesCompatible = "compatible"
+	// PlaylistNamesKeep keeps the names as they are,
+	// only the characters not allowed in the file
+	// names are replaced.
+	PlaylistNamesKeep = "keep"
+)
+
+// PlaylistInfo is the information of a playlist shown
+// in its .playlist.json file. The Name is the display
+// name of the playlist and the Cover the path of
+// its cover image, both are optional.
+type PlaylistInfo struct {
+	Name        string
+	Description string `json:",omitempty"`
+	Cover       string `json:",omitempty"`
+}
+
+// SetPlaylistNames sets the style of the names of the
+// playlists created, it must be called before scanning.
+func SetPlaylistNames(style string) {
+	config.PlaylistNames = style
+}
+
+// PlaylistName returns the name of the playlist
+// Directory for the name given to a playlist.
+func PlaylistName(name string) string {
+	if config.PlaylistNames != PlaylistNamesKeep {
+		return GetCompatibleString(name)
+	}
+
+	name = strings.Map(func(r rune) rune {
+		if r == '/' || unicode.IsControl(r) {
+			return '_'
+		}
+		return r
+	}, name)
+	return strings.TrimLeft(strings.TrimSpace(name), ".")
+}
+
+// putPlaylistName stores the name given to a playlist as
+// its display name when it is not the name of its
+// Directory, unless the playlist already has one.
+func putPlaylistName(tx *bolt.Tx, playlist, name string) error {
+	name = strings.TrimSpace(name)
+	if name == playlist || len(name) < 1 {
+		return nil
+	}
+
+	b, err := tx.CreateBucketIfNotExists([]byte("PlaylistInfo"))
+	if err != nil {
+		return err
+	}
+	if b.Get([]byte(playlist)) != nil {
+		return nil
+	}
+
+	encoded, err := json.Marshal(PlaylistInfo{Name: name})
+	if err != nil {
+		return err
+	}
+	return b.Put([]byte(playlist), encoded)
+}
+
+// renamePlaylistInfo moves the information of a renamed
+// playlist, its display name is the new name given.
+func renamePlaylistInfo(tx *bolt.Tx, oldName, newName, name string) error {
+	b, err := tx.CreateBucketIfNotExists([]byte("PlaylistInfo"))
+	if err != nil {
+		return err
+	}
+
+	var info PlaylistInfo
+	json.Unmarshal(b.Get([]byte(oldName)), &info)
+	info.Name = strings.TrimSpace(name)
+	err = b.Delete([]byte(oldName))
+	if err != nil {
+		return err
+	}
+	if info.Name == newName && len(info.Description) < 1 && len(info.Cover) < 1 {
+		return nil
+	}
+
+	encoded, err := json.Marshal(info)
+	if err != nil {
+		return err
+	}
+	return b.Put([]byte(newName), encoded)
+}
+
+// deletePlaylistInfo removes the information
+// of a deleted playlist.
+func deletePlaylistInfo(tx *bolt.Tx, playlist string) error {
+	b := tx.Bucket([]byte("PlaylistInfo"))
+	if b == nil {
+		return nil
+	}
+	return b.Delete([]byte(playlist))
+}
+
+// GetPlaylistInfo returns the content of the .playlist.json
+// file of a playlist, the playlists without a display
+// name show the name of their Directory.
+func GetPlaylistInfo(playlist string) ([]byte, error) {
+	db, err := openDB()
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	info := PlaylistInfo{Name: playlist}
+	err = db.View(func(tx *bolt.Tx) error {
+		root := tx.Bucket([]byte("Playlists"))
+		if root == nil || root.Bucket([]byte(playlist)) == nil {
+			return fuse.ENOENT
+		}
+
+		if b := tx.Bucket([]byte("PlaylistInfo")); b != nil {
+			json.Unmarshal(b.Get([]byte(playlist)), &info)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	encoded, err := json.Marshal(info)
+	if err != nil {
+		return nil, err
+	}
+	return append(encoded, '\n'), nil
+}
+
+// UpdatePlaylistInfo stores the content written to the
+// .playlist.json file of a playlist. The empty name is
+// the name of the Directory and the cover image must exist.
+func UpdatePlaylistInfo(playlist string, data []byte) error {
+	var info PlaylistInfo
+	err := json.Unmarshal(data, &info)
+	if err != nil {
+		glog.Info("Wrong playlist JSON: ", err)
+		return errors.New("Wrong playlist JSON.")
+	}
+
+	info.Name = strings.TrimSpace(info.Name)
+	if len(info.Name) < 1 {
+		info.Name = playlist
+	}
+	if len(info.Cover) > 0 {
+		if fi, err := os.Stat(info.Cover); err != nil || fi.IsDir() {
+			return errors.New("The cover image does not exist.")
+		}
+	}
+
+	encoded, err := json.Marshal(info)
+	if err != nil {
+		return err
+	}
+
+	db, err := openDB()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	return db.Update(func(tx *bolt.Tx) error {
+		root := tx.Bucket([]byte("Playlists"))
+		if root == nil || root.Bucket([]byte(playlist)) == nil {
+			return fuse.ENOENT
+		}
+
+		b, err := tx.CreateBucketIfNotExists([]byte("PlaylistInfo"))
+		if err != nil {
+			return err
+		}
+		return b.Put([]byte(playlist), encoded)
+	})
+}
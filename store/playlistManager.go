@@ -23,8 +23,10 @@ import (
 	"github.com/boltdb/bolt"
 	"github.com/dankomiocevic/mulifs/playlistmgr"
 	"github.com/golang/glog"
+	"golang.org/x/net/context"
 	"io/ioutil"
 	"os"
+	"path"
 )
 
 // GetPlaylistPath checks that a specified playlist
@@ -33,7 +35,7 @@ import (
 // It also returns the playlist name as string.
 func GetPlaylistPath(playlist string) (string, error) {
 	glog.Infof("Entered Playlist path with playlist: %s\n", playlist)
-	db, err := bolt.Open(config.DbPath, 0600, nil)
+	db, err := openDB()
 	if err != nil {
 		return "", err
 	}
@@ -42,12 +44,12 @@ func GetPlaylistPath(playlist string) (string, error) {
 	err = db.View(func(tx *bolt.Tx) error {
 		root := tx.Bucket([]byte("Playlists"))
 		if root == nil {
-			return errors.New("No playlists.")
+			return fuse.ENOENT
 		}
 
 		playlistBucket := root.Bucket([]byte(playlist))
 		if playlistBucket == nil {
-			return errors.New("Playlist not exists.")
+			return fuse.ENOENT
 		}
 
 		return nil
@@ -76,6 +78,9 @@ func GetPlaylistFilePath(playlist, song, mPoint string) (string, error) {
 
 	returnValue, err := getPlaylistFile(playlist, song)
 	if err == nil {
+		if len(returnValue.Path) < 1 {
+			return "", fuse.ENOENT
+		}
 		return returnValue.Path, nil
 	}
 
@@ -87,7 +92,7 @@ func GetPlaylistFilePath(playlist, song, mPoint string) (string, error) {
 	// Check if the file exists
 	src, err := os.Stat(fullPath)
 	if err != nil || src.IsDir() {
-		return "", errors.New("File not exists.")
+		return "", fuse.ENOENT
 	}
 
 	return fullPath, nil
@@ -99,7 +104,7 @@ func GetPlaylistFilePath(playlist, song, mPoint string) (string, error) {
 // all the available playlists and the error if there is any.
 func ListPlaylists() ([]fuse.Dirent, error) {
 	glog.Info("Entered list playlists.")
-	db, err := bolt.Open(config.DbPath, 0600, nil)
+	db, err := openDB()
 	if err != nil {
 		return nil, err
 	}
@@ -133,7 +138,7 @@ func ListPlaylists() ([]fuse.Dirent, error) {
 // files.
 func ListPlaylistSongs(playlist, mPoint string) ([]fuse.Dirent, error) {
 	glog.Infof("Listing contents of playlist %s.\n", playlist)
-	db, err := bolt.Open(config.DbPath, 0600, nil)
+	db, err := openDB()
 	if err != nil {
 		return nil, err
 	}
@@ -167,12 +172,106 @@ func ListPlaylistSongs(playlist, mPoint string) ([]fuse.Dirent, error) {
 		return nil, err
 	}
 
+	return append(a, ListPlaylistDropFiles(playlist, mPoint)...), nil
+}
+
+// ListPlaylistSongsPage returns up to limit Songs stored in
+// a playlist after the specified name, an empty name starts
+// from the first Song.
+// The files in the temporary drop directory of the playlist
+// are not included, they are listed by ListPlaylistDropFiles.
+func ListPlaylistSongsPage(playlist, after string, limit int) ([]fuse.Dirent, error) {
+	db, err := openDB()
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	var a []fuse.Dirent
+	err = db.View(func(tx *bolt.Tx) error {
+		root := tx.Bucket([]byte("Playlists"))
+		if root == nil {
+			return nil
+		}
+
+		b := root.Bucket([]byte(playlist))
+		if b == nil {
+			return nil
+		}
+
+		c := b.Cursor()
+		for k, v := seekAfter(c, after); k != nil && len(a) < limit; k, v = c.Next() {
+			if v != nil {
+				a = append(a, fuse.Dirent{Name: string(k), Type: fuse.DT_File})
+			}
+		}
+		return nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return a, nil
+}
+
+// ListPlaylistSongFiles returns the Songs of a playlist with
+// the paths of their files, reading the whole playlist at once.
+// It is used to prefetch the attributes of the Songs
+// when the playlist is listed.
+func ListPlaylistSongFiles(playlist string) ([]SongFile, error) {
+	db, err := openDB()
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	var a []SongFile
+	err = db.View(func(tx *bolt.Tx) error {
+		root := tx.Bucket([]byte("Playlists"))
+		if root == nil {
+			return nil
+		}
+
+		b := root.Bucket([]byte(playlist))
+		if b == nil {
+			return nil
+		}
+
+		index := &playlistIndex{}
+		c := b.Cursor()
+		for k, v := c.First(); k != nil; k, v = c.Next() {
+			if v == nil {
+				continue
+			}
+
+			var file playlistmgr.PlaylistFile
+			if err := json.Unmarshal(v, &file); err != nil {
+				continue
+			}
+			file = resolvePlaylistFile(tx, file, index)
+			a = append(a, SongFile{Name: string(k), Path: file.Path})
+		}
+		return nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return a, nil
+}
+
+// ListPlaylistDropFiles returns the files stored in the
+// temporary drop directory named after the playlist.
+func ListPlaylistDropFiles(playlist, mPoint string) []fuse.Dirent {
 	if mPoint[len(mPoint)-1] != '/' {
 		mPoint = mPoint + "/"
 	}
 
 	fullPath := mPoint + "playlists/" + playlist + "/"
 
+	var a []fuse.Dirent
 	files, _ := ioutil.ReadDir(fullPath)
 	for _, f := range files {
 		if !f.IsDir() {
@@ -182,7 +281,7 @@ func ListPlaylistSongs(playlist, mPoint string) ([]fuse.Dirent, error) {
 			a = append(a, node)
 		}
 	}
-	return a, nil
+	return a
 }
 
 // CreatePlaylist function creates a playlist item in the database and
@@ -191,8 +290,9 @@ func ListPlaylistSongs(playlist, mPoint string) ([]fuse.Dirent, error) {
 // error if something went wrong.
 func CreatePlaylist(name, mPoint string) (string, error) {
 	glog.Infof("Creating Playlist with name: %s\n", name)
-	name = GetCompatibleString(name)
-	db, err := bolt.Open(config.DbPath, 0600, nil)
+	displayName := name
+	name = PlaylistName(name)
+	db, err := openDB()
 	if err != nil {
 		return "", err
 	}
@@ -211,7 +311,7 @@ func CreatePlaylist(name, mPoint string) (string, error) {
 			return err
 		}
 
-		return nil
+		return putPlaylistName(tx, name, displayName)
 	})
 	if err != nil {
 		return "", err
@@ -224,10 +324,21 @@ func CreatePlaylist(name, mPoint string) (string, error) {
 // information in the database.
 func RegeneratePlaylistFile(name, mPoint string) error {
 	glog.Infof("Regenerating playlist for name: %s\n", name)
-	db, err := bolt.Open(config.DbPath, 0600, nil)
+	a, err := GetPlaylistFiles(name)
 	if err != nil {
 		return err
 	}
+
+	return playlistmgr.RegeneratePlaylistFile(a, path.Join(GetPlaylistFolder(name), name), mPoint)
+}
+
+// GetPlaylistFiles returns the Songs of a
+// playlist in the order they are stored.
+func GetPlaylistFiles(name string) ([]playlistmgr.PlaylistFile, error) {
+	db, err := openDB()
+	if err != nil {
+		return nil, err
+	}
 	defer db.Close()
 
 	var a []playlistmgr.PlaylistFile
@@ -241,16 +352,17 @@ func RegeneratePlaylistFile(name, mPoint string) error {
 		b := root.Bucket([]byte(name))
 		if b == nil {
 			glog.Infof("Playlist %s not exists", name)
-			return errors.New("Playlist not exists.")
+			return fuse.ENOENT
 		}
 
+		index := &playlistIndex{}
 		c := b.Cursor()
 		for k, v := c.First(); k != nil; k, v = c.Next() {
 			if v != nil {
 				var file playlistmgr.PlaylistFile
 				err := json.Unmarshal(v, &file)
 				if err == nil {
-					a = append(a, file)
+					a = append(a, resolvePlaylistFile(tx, file, index))
 				} else {
 					glog.Errorf("Cannot unmarshal Playlist File %s: %s\n", k, err)
 				}
@@ -260,22 +372,22 @@ func RegeneratePlaylistFile(name, mPoint string) error {
 	})
 
 	if err != nil {
-		return err
+		return nil, err
 	}
-
-	return playlistmgr.RegeneratePlaylistFile(a, name, mPoint)
+	return a, nil
 }
 
 // AddFileToPlaylist function adds a file to a specific playlist.
 // The function also checks that the file exists in the MuLi database.
 func AddFileToPlaylist(file playlistmgr.PlaylistFile, playlistName string) error {
-	path, err := GetFilePath(file.Artist, file.Album, file.Title)
+	songStore, err := GetSong(file.Artist, file.Album, file.Title)
 	if err != nil {
 		return errors.New("Playlist item not found in MuLi.")
 	}
 
-	file.Path = path
-	db, err := bolt.Open(config.DbPath, 0600, nil)
+	file.Path = songStore.SongFullPath
+	file.MusicBrainzID = songStore.MusicBrainzID
+	db, err := openDB()
 	if err != nil {
 		return err
 	}
@@ -299,6 +411,17 @@ func AddFileToPlaylist(file playlistmgr.PlaylistFile, playlistName string) error
 			glog.Errorf("Cannot encode PlaylistFile.")
 			return err
 		}
+
+		// The queue can contain the same Song many times
+		// and it is not linked to the Songs, the entries
+		// are removed once they are played.
+		if IsQueue(playlistName) {
+			key, err := queueKey(playlistBucket, file.Title)
+			if err != nil {
+				return err
+			}
+			return playlistBucket.Put(key, encoded)
+		}
 		playlistBucket.Put([]byte(file.Title), encoded)
 
 		// Update the original file playlists to have a link to the
@@ -358,12 +481,13 @@ func AddFileToPlaylist(file playlistmgr.PlaylistFile, playlistName string) error
 // and also deletes all the entries in the specific files and
 // deletes it from the filesystem.
 func DeletePlaylist(name, mPoint string) error {
-	db, err := bolt.Open(config.DbPath, 0600, nil)
+	db, err := openDB()
 	if err != nil {
 		return err
 	}
 	defer db.Close()
 
+	fileName := name
 	err = db.Update(func(tx *bolt.Tx) error {
 		root := tx.Bucket([]byte("Playlists"))
 		if root == nil {
@@ -375,6 +499,7 @@ func DeletePlaylist(name, mPoint string) error {
 		if playlistBucket == nil {
 			return nil
 		}
+		fileName = playlistFileName(tx, name)
 
 		c := playlistBucket.Cursor()
 		for k, songJson := c.First(); k != nil; k, songJson = c.Next() {
@@ -442,17 +567,25 @@ func DeletePlaylist(name, mPoint string) error {
 
 		}
 
+		err = deletePlaylistInfo(tx, name)
+		if err != nil {
+			return err
+		}
+		_, err = removePlaylistFolderEntry(tx, name)
+		if err != nil {
+			return err
+		}
 		return root.DeleteBucket([]byte(name))
 	})
 
-	return playlistmgr.DeletePlaylist(name, mPoint)
+	return playlistmgr.DeletePlaylist(fileName, mPoint)
 }
 
 // DeletePlaylistSong function deletes a specific song from a playlist.
 // The force parameter is used to just delete the song without modifying
 // the original song file.
 func DeletePlaylistSong(playlist, name string, force bool) error {
-	db, err := bolt.Open(config.DbPath, 0600, nil)
+	db, err := openDB()
 	if err != nil {
 		return err
 	}
@@ -545,7 +678,7 @@ func DeletePlaylistSong(playlist, name string, force bool) error {
 // inside a playlist.
 func getPlaylistFile(playlist, song string) (playlistmgr.PlaylistFile, error) {
 	glog.Infof("Entered getPlaylistFile with song: %s, and playlist: %s\n", song, playlist)
-	db, err := bolt.Open(config.DbPath, 0600, nil)
+	db, err := openDB()
 	if err != nil {
 		return playlistmgr.PlaylistFile{}, err
 	}
@@ -555,22 +688,24 @@ func getPlaylistFile(playlist, song string) (playlistmgr.PlaylistFile, error) {
 	err = db.View(func(tx *bolt.Tx) error {
 		root := tx.Bucket([]byte("Playlists"))
 		if root == nil {
-			return errors.New("No playlists.")
+			return fuse.ENOENT
 		}
 		playlistBucket := root.Bucket([]byte(playlist))
 		if playlistBucket == nil {
-			return errors.New("Playlist not exists.")
+			return fuse.ENOENT
 		}
 
 		songJson := playlistBucket.Get([]byte(song))
 		if songJson == nil {
-			return errors.New("Song not found.")
+			return fuse.ENOENT
 		}
 
 		err := json.Unmarshal(songJson, &returnValue)
 		if err != nil {
 			return errors.New("Cannot open song.")
 		}
+
+		returnValue = resolvePlaylistFile(tx, returnValue, &playlistIndex{})
 		return nil
 	})
 
@@ -584,8 +719,9 @@ func getPlaylistFile(playlist, song string) (playlistmgr.PlaylistFile, error) {
 // the links to the songs in every MuLi song.
 func RenamePlaylist(oldName, newName, mPoint string) (string, error) {
 	glog.Infof("Renaming %s playlist to %s.\n", oldName, newName)
-	newName = GetCompatibleString(newName)
-	db, err := bolt.Open(config.DbPath, 0600, nil)
+	displayName := newName
+	newName = PlaylistName(newName)
+	db, err := openDB()
 	if err != nil {
 		return "", err
 	}
@@ -682,7 +818,22 @@ func RenamePlaylist(oldName, newName, mPoint string) (string, error) {
 			}
 		}
 
-		playlistmgr.DeletePlaylist(oldName, mPoint)
+		err = renamePlaylistInfo(tx, oldName, newName, displayName)
+		if err != nil {
+			return err
+		}
+
+		// The renamed playlist stays in its folder.
+		folder, err := removePlaylistFolderEntry(tx, oldName)
+		if err != nil {
+			return err
+		}
+		err = putPlaylistFolderEntry(tx, folder, newName)
+		if err != nil {
+			return err
+		}
+
+		playlistmgr.DeletePlaylist(path.Join(folder, oldName), mPoint)
 		return root.DeleteBucket([]byte(oldName))
 	})
 
@@ -696,13 +847,348 @@ func RenamePlaylist(oldName, newName, mPoint string) (string, error) {
 // RenamePlaylistSong changes the name on a specific song,
 // it also updates the song in the original place and
 // checks that every playlist containing the song is updated.
-func RenamePlaylistSong(playlist, oldName, newName, mPoint string) (string, error) {
+func RenamePlaylistSong(ctx context.Context, playlist, oldName, newName, mPoint string) (string, error) {
 	file, err := getPlaylistFile(playlist, oldName)
 	if err != nil {
 		glog.Infof("Cannot open playlist file: %s\n", err)
 		return "", err
 	}
 
-	newName, err = MoveSongs(file.Artist, file.Album, file.Title, file.Artist, file.Album, newName, file.Path, mPoint)
+	newName, err = MoveSongs(ctx, file.Artist, file.Album, file.Title, file.Artist, file.Album, newName, file.Path, mPoint)
 	return newName, err
 }
+
+// linkPlaylistSong adds the playlist to the list of
+// playlists of the Song in the MuLi database.
+func linkPlaylistSong(tx *bolt.Tx, file playlistmgr.PlaylistFile, playlistName string) error {
+	artistBucket := tx.Bucket([]byte("Artists")).Bucket([]byte(file.Artist))
+	if artistBucket == nil {
+		return errors.New("Error opening artist bucket.")
+	}
+
+	albumBucket := artistBucket.Bucket([]byte(file.Album))
+	if albumBucket == nil {
+		return errors.New("Error opening album bucket.")
+	}
+
+	songJson := albumBucket.Get([]byte(file.Title))
+	if songJson == nil {
+		return errors.New("Error opening song json.")
+	}
+
+	var song SongStore
+	err := json.Unmarshal(songJson, &song)
+	if err != nil {
+		return err
+	}
+
+	for _, list := range song.Playlists {
+		if list == playlistName {
+			return nil
+		}
+	}
+
+	song.Playlists = append(song.Playlists, playlistName)
+	encoded, err := json.Marshal(song)
+	if err != nil {
+		return err
+	}
+	return albumBucket.Put([]byte(file.Title), encoded)
+}
+
+// MergePlaylists adds all the songs of the source playlist
+// to the destination playlist in a single transaction, the
+// songs already in the destination are not added again.
+func MergePlaylists(src, dst, mPoint string) error {
+	if src == dst {
+		return errors.New("Cannot merge a playlist into itself.")
+	}
+
+	db, err := openDB()
+	if err != nil {
+		return err
+	}
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		return mergePlaylists(tx, src, dst)
+	})
+	db.Close()
+
+	if err != nil {
+		return err
+	}
+	return RegeneratePlaylistFile(dst, mPoint)
+}
+
+// mergePlaylists copies the songs between playlists
+// inside the specified transaction.
+func mergePlaylists(tx *bolt.Tx, src, dst string) error {
+	root := tx.Bucket([]byte("Playlists"))
+	if root == nil {
+		return fuse.ENOENT
+	}
+
+	srcBucket := root.Bucket([]byte(src))
+	if srcBucket == nil {
+		return errors.New("Playlist " + src + " not exists.")
+	}
+
+	dstBucket := root.Bucket([]byte(dst))
+	if dstBucket == nil {
+		return errors.New("Playlist " + dst + " not exists.")
+	}
+
+	return srcBucket.ForEach(func(k, v []byte) error {
+		if v == nil {
+			return nil
+		}
+
+		var file playlistmgr.PlaylistFile
+		err := json.Unmarshal(v, &file)
+		if err != nil {
+			glog.Errorf("Cannot unmarshal Playlist File %s: %s\n", k, err)
+			return nil
+		}
+
+		if IsQueue(dst) {
+			key, err := queueKey(dstBucket, file.Title)
+			if err != nil {
+				return err
+			}
+			return dstBucket.Put(key, v)
+		}
+
+		if dstBucket.Get([]byte(file.Title)) != nil {
+			return nil
+		}
+
+		err = dstBucket.Put([]byte(file.Title), v)
+		if err != nil {
+			return err
+		}
+
+		err = linkPlaylistSong(tx, file, dst)
+		if err != nil {
+			glog.Infof("Cannot link %s to playlist %s: %s\n", file.Title, dst, err)
+		}
+		return nil
+	})
+}
+
+// CopyPlaylist creates a new playlist with all the songs
+// of the source playlist in a single transaction.
+// It returns the name of the new playlist.
+func CopyPlaylist(src, dst, mPoint string) (string, error) {
+	displayName := dst
+	dst = PlaylistName(dst)
+	if len(dst) < 1 {
+		return "", errors.New("Wrong playlist name.")
+	}
+
+	db, err := openDB()
+	if err != nil {
+		return "", err
+	}
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		root := tx.Bucket([]byte("Playlists"))
+		if root == nil {
+			return fuse.ENOENT
+		}
+
+		_, err := root.CreateBucket([]byte(dst))
+		if err != nil {
+			return errors.New("Playlist " + dst + " already exists.")
+		}
+
+		err = putPlaylistName(tx, dst, displayName)
+		if err != nil {
+			return err
+		}
+		return mergePlaylists(tx, src, dst)
+	})
+	db.Close()
+
+	if err != nil {
+		return "", err
+	}
+	return dst, RegeneratePlaylistFile(dst, mPoint)
+}
+
+// songIdentity returns the MusicBrainz identifier or the
+// path of the Song in the Music Library to compare the
+// playlist entries by the Song they point to instead of
+// by their names. The same recording in two Albums is
+// the same Song when its identifier is known.
+func songIdentity(tx *bolt.Tx, file playlistmgr.PlaylistFile) string {
+	artistBucket := tx.Bucket([]byte("Artists")).Bucket([]byte(file.Artist))
+	if artistBucket != nil {
+		albumBucket := artistBucket.Bucket([]byte(file.Album))
+		if albumBucket != nil {
+			var song SongStore
+			songJson := albumBucket.Get([]byte(file.Title))
+			if songJson != nil && json.Unmarshal(songJson, &song) == nil {
+				if len(song.MusicBrainzID) > 0 {
+					return "musicbrainz:" + song.MusicBrainzID
+				}
+				if len(song.SongFullPath) > 0 {
+					return song.SongFullPath
+				}
+			}
+		}
+	}
+
+	if len(file.Path) > 0 {
+		return file.Path
+	}
+	return file.Artist + "/" + file.Album + "/" + file.Title
+}
+
+// playlistIndex finds the Songs of the Music Library by
+// their MusicBrainz identifier and by the path of their
+// file, it is built the first time it is needed.
+type playlistIndex struct {
+	built  bool
+	byID   map[string]playlistmgr.PlaylistFile
+	byPath map[string]playlistmgr.PlaylistFile
+}
+
+// build reads every Song of the Music Library.
+func (index *playlistIndex) build(tx *bolt.Tx) {
+	index.built = true
+	index.byID = make(map[string]playlistmgr.PlaylistFile)
+	index.byPath = make(map[string]playlistmgr.PlaylistFile)
+
+	root := tx.Bucket([]byte("Artists"))
+	root.ForEach(func(artist, v []byte) error {
+		artistBucket := root.Bucket(artist)
+		if v != nil || artistBucket == nil {
+			return nil
+		}
+
+		return artistBucket.ForEach(func(album, w []byte) error {
+			albumBucket := artistBucket.Bucket(album)
+			if w != nil || albumBucket == nil {
+				return nil
+			}
+
+			return albumBucket.ForEach(func(song, x []byte) error {
+				var songStore SongStore
+				if x == nil || song[0] == '.' || json.Unmarshal(x, &songStore) != nil {
+					return nil
+				}
+
+				file := playlistmgr.PlaylistFile{
+					Title:         string(song),
+					Artist:        string(artist),
+					Album:         string(album),
+					Path:          songStore.SongFullPath,
+					MusicBrainzID: songStore.MusicBrainzID,
+				}
+				if _, ok := index.byID[file.MusicBrainzID]; len(file.MusicBrainzID) > 0 && !ok {
+					index.byID[file.MusicBrainzID] = file
+				}
+				index.byPath[file.Path] = file
+				return nil
+			})
+		})
+	})
+}
+
+// resolvePlaylistFile returns the playlist entry with the
+// current Artist, Album, name and path of the Song it points
+// to, so the entries keep working when the Songs are renamed
+// or moved without updating the playlists. The Song is found
+// by its keys, then by its MusicBrainz identifier and then
+// by the path of its file stored in the entry. The entries
+// of the Songs that are not found are returned as they are.
+func resolvePlaylistFile(tx *bolt.Tx, file playlistmgr.PlaylistFile, index *playlistIndex) playlistmgr.PlaylistFile {
+	artistBucket := tx.Bucket([]byte("Artists")).Bucket([]byte(file.Artist))
+	if artistBucket != nil {
+		albumBucket := artistBucket.Bucket([]byte(file.Album))
+		if albumBucket != nil {
+			var song SongStore
+			songJson := albumBucket.Get([]byte(file.Title))
+			if songJson != nil && json.Unmarshal(songJson, &song) == nil {
+				// The same keys may point to another
+				// recording after a rescan.
+				if len(file.MusicBrainzID) < 1 || len(song.MusicBrainzID) < 1 || file.MusicBrainzID == song.MusicBrainzID {
+					file.Path = song.SongFullPath
+					return file
+				}
+			}
+		}
+	}
+
+	if !index.built {
+		index.build(tx)
+	}
+
+	if found, ok := index.byID[file.MusicBrainzID]; ok && len(file.MusicBrainzID) > 0 {
+		glog.Infof("Playlist entry %s/%s/%s found as %s/%s/%s\n", file.Artist, file.Album, file.Title, found.Artist, found.Album, found.Title)
+		return found
+	}
+
+	if found, ok := index.byPath[file.Path]; ok && len(file.Path) > 0 {
+		glog.Infof("Playlist entry %s/%s/%s found as %s/%s/%s\n", file.Artist, file.Album, file.Title, found.Artist, found.Album, found.Title)
+		return found
+	}
+	return file
+}
+
+// DedupPlaylist removes the entries of a playlist that
+// point to a Song already in it, the first entry is kept.
+// It returns the number of entries removed.
+func DedupPlaylist(name, mPoint string) (int, error) {
+	db, err := openDB()
+	if err != nil {
+		return 0, err
+	}
+
+	var duplicated [][]byte
+	err = db.Update(func(tx *bolt.Tx) error {
+		root := tx.Bucket([]byte("Playlists"))
+		if root == nil {
+			return fuse.ENOENT
+		}
+
+		b := root.Bucket([]byte(name))
+		if b == nil {
+			return errors.New("Playlist " + name + " not exists.")
+		}
+
+		seen := make(map[string]bool)
+		c := b.Cursor()
+		for k, v := c.First(); k != nil; k, v = c.Next() {
+			var file playlistmgr.PlaylistFile
+			if v == nil || json.Unmarshal(v, &file) != nil {
+				continue
+			}
+
+			id := songIdentity(tx, file)
+			if seen[id] {
+				duplicated = append(duplicated, append([]byte(nil), k...))
+				continue
+			}
+			seen[id] = true
+		}
+
+		for _, k := range duplicated {
+			if err := b.Delete(k); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	db.Close()
+
+	if err != nil {
+		return 0, err
+	}
+
+	if len(duplicated) > 0 {
+		glog.Infof("Removed %d duplicated entries from playlist %s\n", len(duplicated), name)
+		err = RegeneratePlaylistFile(name, mPoint)
+	}
+	return len(duplicated), err
+}
@@ -0,0 +1,251 @@
+// Copyright 2016 Danko Miocevic. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Author: Danko Miocevic
+
+package store
+
+import (
+	"encoding/json"
+	"errors"
+	"time"
+
+	"bazil.org/fuse"
+	"github.com/boltdb/bolt"
+)
+
+// PodcastStore is the information of a podcast,
+// stored as the description of its bucket.
+type PodcastStore struct {
+	Title string
+	URL   string
+}
+
+// EpisodeStore is the information of a
+// downloaded episode of a podcast.
+type EpisodeStore struct {
+	Title     string
+	GUID      string
+	URL       string
+	Published time.Time
+	Path      string
+	Listened  bool
+}
+
+// StorePodcast creates the bucket of a podcast if it does
+// not exist and returns the name used for it.
+func StorePodcast(title, url string) (string, error) {
+	name := GetCompatibleString(title)
+	if len(name) < 1 {
+		return "", errors.New("Wrong podcast title.")
+	}
+
+	db, err := openDB()
+	if err != nil {
+		return "", err
+	}
+	defer db.Close()
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		root, err := tx.CreateBucketIfNotExists([]byte("Podcasts"))
+		if err != nil {
+			return err
+		}
+
+		b, err := root.CreateBucketIfNotExists([]byte(name))
+		if err != nil {
+			return err
+		}
+
+		encoded, err := json.Marshal(PodcastStore{Title: title, URL: url})
+		if err != nil {
+			return err
+		}
+		return b.Put([]byte(".description"), encoded)
+	})
+	return name, err
+}
+
+// HasEpisode returns true if the episode with the
+// GUID was already downloaded.
+func HasEpisode(podcast, guid string) bool {
+	found := false
+	forEachEpisode(podcast, func(name string, episode EpisodeStore) {
+		if episode.GUID == guid {
+			found = true
+		}
+	})
+	return found
+}
+
+// forEachEpisode calls the function with
+// every episode of a podcast.
+func forEachEpisode(podcast string, f func(name string, episode EpisodeStore)) error {
+	db, err := openDB()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	return db.View(func(tx *bolt.Tx) error {
+		root := tx.Bucket([]byte("Podcasts"))
+		if root == nil {
+			return fuse.ENOENT
+		}
+
+		b := root.Bucket([]byte(podcast))
+		if b == nil {
+			return fuse.ENOENT
+		}
+
+		return b.ForEach(func(k, v []byte) error {
+			if k[0] == '.' {
+				return nil
+			}
+
+			var episode EpisodeStore
+			if json.Unmarshal(v, &episode) == nil {
+				f(string(k), episode)
+			}
+			return nil
+		})
+	})
+}
+
+// StoreEpisode stores a downloaded episode of a podcast.
+func StoreEpisode(podcast, name string, episode EpisodeStore) error {
+	db, err := openDB()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	return db.Update(func(tx *bolt.Tx) error {
+		root := tx.Bucket([]byte("Podcasts"))
+		if root == nil {
+			return fuse.ENOENT
+		}
+
+		b := root.Bucket([]byte(podcast))
+		if b == nil {
+			return fuse.ENOENT
+		}
+
+		encoded, err := json.Marshal(episode)
+		if err != nil {
+			return err
+		}
+		return b.Put([]byte(name), encoded)
+	})
+}
+
+// ListPodcasts returns the Dirent of every podcast.
+func ListPodcasts() ([]fuse.Dirent, error) {
+	db, err := openDB()
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	var a []fuse.Dirent
+	err = db.View(func(tx *bolt.Tx) error {
+		root := tx.Bucket([]byte("Podcasts"))
+		if root == nil {
+			return nil
+		}
+
+		return root.ForEach(func(k, v []byte) error {
+			if v == nil {
+				a = append(a, fuse.Dirent{Name: string(k), Type: fuse.DT_Dir})
+			}
+			return nil
+		})
+	})
+	return a, err
+}
+
+// ListEpisodes returns the Dirent of the episodes of a
+// podcast, only the ones not listened if unlistened is true.
+func ListEpisodes(podcast string, unlistened bool) ([]fuse.Dirent, error) {
+	var a []fuse.Dirent
+	err := forEachEpisode(podcast, func(name string, episode EpisodeStore) {
+		if !unlistened || !episode.Listened {
+			a = append(a, fuse.Dirent{Name: name, Type: fuse.DT_File})
+		}
+	})
+	return a, err
+}
+
+// GetEpisodePath returns the path of a downloaded episode.
+func GetEpisodePath(podcast, name string) (string, error) {
+	db, err := openDB()
+	if err != nil {
+		return "", err
+	}
+	defer db.Close()
+
+	var episode EpisodeStore
+	err = db.View(func(tx *bolt.Tx) error {
+		root := tx.Bucket([]byte("Podcasts"))
+		if root == nil {
+			return fuse.ENOENT
+		}
+
+		b := root.Bucket([]byte(podcast))
+		if b == nil || len(name) < 1 || name[0] == '.' {
+			return fuse.ENOENT
+		}
+
+		v := b.Get([]byte(name))
+		if v == nil || json.Unmarshal(v, &episode) != nil {
+			return fuse.ENOENT
+		}
+		return nil
+	})
+	return episode.Path, err
+}
+
+// SetEpisodeListened marks an episode as listened.
+func SetEpisodeListened(podcast, name string) error {
+	db, err := openDB()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	return db.Update(func(tx *bolt.Tx) error {
+		root := tx.Bucket([]byte("Podcasts"))
+		if root == nil {
+			return fuse.ENOENT
+		}
+
+		b := root.Bucket([]byte(podcast))
+		if b == nil {
+			return fuse.ENOENT
+		}
+
+		var episode EpisodeStore
+		v := b.Get([]byte(name))
+		if v == nil || json.Unmarshal(v, &episode) != nil {
+			return fuse.ENOENT
+		}
+
+		episode.Listened = true
+		encoded, err := json.Marshal(episode)
+		if err != nil {
+			return err
+		}
+		return b.Put([]byte(name), encoded)
+	})
+}
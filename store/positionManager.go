@@ -0,0 +1,88 @@
+// Copyright 2016 Danko Miocevic. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Author: Danko Miocevic
+
+package store
+
+import (
+	"encoding/json"
+	"time"
+
+	"bazil.org/fuse"
+	"github.com/boltdb/bolt"
+)
+
+// BookPosition is how far an audiobook was listened,
+// the Song is the last chapter read and the offset
+// is the amount of bytes read from it.
+type BookPosition struct {
+	Song   string
+	Offset int64
+	Time   time.Time
+}
+
+// positionKey returns the key of an
+// audiobook in the Positions bucket.
+func positionKey(artist, album string) []byte {
+	return []byte(artist + "/" + album)
+}
+
+// SetBookPosition stores how far the
+// audiobook was listened.
+func SetBookPosition(artist, album string, position BookPosition) error {
+	db, err := openDB()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	return db.Update(func(tx *bolt.Tx) error {
+		root, err := tx.CreateBucketIfNotExists([]byte("Positions"))
+		if err != nil {
+			return err
+		}
+
+		encoded, err := json.Marshal(position)
+		if err != nil {
+			return err
+		}
+		return root.Put(positionKey(artist, album), encoded)
+	})
+}
+
+// GetBookPosition returns how far the audiobook
+// was listened or ENOENT if it was never read.
+func GetBookPosition(artist, album string) (BookPosition, error) {
+	var position BookPosition
+	db, err := openDB()
+	if err != nil {
+		return position, err
+	}
+	defer db.Close()
+
+	err = db.View(func(tx *bolt.Tx) error {
+		root := tx.Bucket([]byte("Positions"))
+		if root == nil {
+			return fuse.ENOENT
+		}
+
+		v := root.Get(positionKey(artist, album))
+		if v == nil {
+			return fuse.ENOENT
+		}
+		return json.Unmarshal(v, &position)
+	})
+	return position, err
+}
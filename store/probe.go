@@ -0,0 +1,129 @@
+// Copyright 2016 Danko Miocevic. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Author: Danko Miocevic
+
+package store
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"strconv"
+
+	"github.com/boltdb/bolt"
+	"github.com/golang/glog"
+)
+
+// SchemaVersion is the version of the layout of the
+// database written by this MuLi, the databases written
+// by a newer version are not mounted.
+const SchemaVersion = 1
+
+// setSchemaVersion stores the version of the layout in
+// a new database, the databases created before the version
+// was stored have the first layout.
+func setSchemaVersion(tx *bolt.Tx) error {
+	b, err := tx.CreateBucketIfNotExists([]byte("Schema"))
+	if err != nil {
+		glog.Errorf("Error creating bucket: %s", err)
+		return fmt.Errorf("Error creating bucket: %s", err)
+	}
+
+	if b.Get([]byte("Version")) != nil {
+		return nil
+	}
+	return b.Put([]byte("Version"), []byte(strconv.Itoa(SchemaVersion)))
+}
+
+// Probe is the quick look at the database done before
+// mounting it. Sample has the paths of some Songs
+// chosen at random to check that the files exist.
+type Probe struct {
+	Version int
+	Artists int
+	Albums  int
+	Songs   int
+	Sample  []string
+}
+
+// ProbeDB reads the whole database once, counting the
+// Artists, Albums and Songs and choosing up to sample
+// Songs. Only the chosen Songs are decoded.
+func ProbeDB(sample int) (Probe, error) {
+	db, err := openDB()
+	if err != nil {
+		return Probe{}, err
+	}
+	defer db.Close()
+
+	p := Probe{Version: 1}
+	err = db.View(func(tx *bolt.Tx) error {
+		if b := tx.Bucket([]byte("Schema")); b != nil {
+			if v, err := strconv.Atoi(string(b.Get([]byte("Version")))); err == nil {
+				p.Version = v
+			}
+		}
+
+		root := tx.Bucket([]byte("Artists"))
+		if root == nil {
+			return nil
+		}
+
+		return root.ForEach(func(artist, v []byte) error {
+			if v != nil {
+				return nil
+			}
+
+			p.Artists++
+			artistBucket := root.Bucket(artist)
+			return artistBucket.ForEach(func(album, w []byte) error {
+				if w != nil {
+					return nil
+				}
+
+				p.Albums++
+				albumBucket := artistBucket.Bucket(album)
+				return albumBucket.ForEach(func(k, v []byte) error {
+					if v == nil || k[0] == '.' {
+						return nil
+					}
+
+					// The sample is chosen with reservoir sampling,
+					// every Song has the same chance of being in it.
+					p.Songs++
+					i := p.Songs - 1
+					if i >= sample {
+						i = rand.Intn(p.Songs)
+						if i >= sample {
+							return nil
+						}
+					}
+
+					var song SongStore
+					if json.Unmarshal(v, &song) != nil || len(song.SongFullPath) < 1 {
+						return nil
+					}
+					if i < len(p.Sample) {
+						p.Sample[i] = song.SongFullPath
+					} else {
+						p.Sample = append(p.Sample, song.SongFullPath)
+					}
+					return nil
+				})
+			})
+		})
+	})
+	return p, err
+}
@@ -0,0 +1,66 @@
+// Copyright 2016 Danko Miocevic. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Author: Danko Miocevic
+
+package store
+
+import (
+	"fmt"
+
+	"github.com/boltdb/bolt"
+)
+
+// QueuePlaylist is the name of the playlist used as a
+// listening queue, the Songs are kept in the order they
+// were added and removed once they are played.
+const QueuePlaylist = "queue"
+
+// EnableQueue creates the queue playlist and handles
+// it as a queue from now on.
+func EnableQueue(mPoint string) error {
+	_, err := CreatePlaylist(QueuePlaylist, mPoint)
+	if err != nil {
+		return err
+	}
+
+	config.Queue = true
+	return RegeneratePlaylistFile(QueuePlaylist, mPoint)
+}
+
+// IsQueue returns true if the playlist is the queue.
+func IsQueue(playlist string) bool {
+	return config.Queue && playlist == QueuePlaylist
+}
+
+// queueKey returns a new key for a Song added to the
+// queue, the keys start with a sequence number so the
+// Songs are listed in the order they were added.
+func queueKey(b *bolt.Bucket, title string) ([]byte, error) {
+	id, err := b.NextSequence()
+	if err != nil {
+		return nil, err
+	}
+	return []byte(fmt.Sprintf("%06d - %s", id, title)), nil
+}
+
+// PopQueueSong removes a Song from the queue
+// and regenerates the playlist file.
+func PopQueueSong(name, mPoint string) error {
+	err := DeletePlaylistSong(QueuePlaylist, name, true)
+	if err != nil {
+		return err
+	}
+	return RegeneratePlaylistFile(QueuePlaylist, mPoint)
+}
@@ -0,0 +1,200 @@
+// Copyright 2016 Danko Miocevic. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Author: Danko Miocevic
+
+package store
+
+import (
+	"encoding/json"
+	"github.com/dankomiocevic/mulifs/musicmgr"
+	"github.com/golang/glog"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"bazil.org/fuse"
+	"github.com/boltdb/bolt"
+)
+
+// relocateRetry is the time to wait before looking
+// again for a Song that was not found.
+const relocateRetry = time.Minute
+
+var (
+	relocateMu     sync.Mutex
+	relocateMisses = make(map[SongRef]time.Time)
+)
+
+// RelocateSong looks for the file of a Song that was moved
+// inside the source Directory outside MuLi. The files that
+// do not belong to other Songs are compared with the stored
+// MusicBrainz identifier or checksum, the files with the
+// same name are compared first. When the file is found its
+// new path is stored for every Song that used the file (the
+// tracks of the album images) and returned, otherwise fuse.ENOENT
+// is returned and the search is not repeated for a minute.
+func RelocateSong(artist, album, song, mPoint string) (string, error) {
+	ref := SongRef{Artist: artist, Album: album, Song: song}
+	old, err := GetSong(artist, album, song)
+	if err != nil {
+		return "", err
+	}
+
+	if fileExists(old.SongFullPath) {
+		return old.SongFullPath, nil
+	}
+
+	if len(old.Checksum) < 1 && len(old.MusicBrainzID) < 1 {
+		return "", fuse.ENOENT
+	}
+
+	relocateMu.Lock()
+	defer relocateMu.Unlock()
+	if t, ok := relocateMisses[ref]; ok && time.Since(t) < relocateRetry {
+		return "", fuse.ENOENT
+	}
+
+	songs, err := ListSongInfo()
+	if err != nil {
+		return "", err
+	}
+
+	glog.Infof("Looking for the moved file %s\n", old.SongFullPath)
+	path := findMovedSong(old, songs, mPoint)
+	if len(path) < 1 {
+		glog.Errorf("Cannot find the moved file %s\n", old.SongFullPath)
+		relocateMisses[ref] = time.Now()
+		return "", fuse.ENOENT
+	}
+
+	delete(relocateMisses, ref)
+	var refs []SongRef
+	for _, s := range songs {
+		if s.Path == old.SongFullPath {
+			refs = append(refs, s.SongRef)
+		}
+	}
+
+	if err := setSongPath(refs, path); err != nil {
+		return "", err
+	}
+	glog.Infof("The file %s was moved to %s\n", old.SongFullPath, path)
+	return path, nil
+}
+
+// findMovedSong returns the path of the music file in the
+// source Directory that matches the Song or an empty string.
+func findMovedSong(old SongStore, songs []SongInfo, mPoint string) string {
+	known := make(map[string]bool)
+	for _, s := range songs {
+		known[s.Path] = true
+	}
+
+	// The drop, the playlists, the podcasts and the
+	// trash are not part of the Music Library.
+	skip := map[string]bool{
+		filepath.Join(mPoint, "drop"):      true,
+		filepath.Join(mPoint, "playlists"): true,
+		filepath.Join(mPoint, "podcasts"):  true,
+		filepath.Join(mPoint, TrashDir):    true,
+	}
+
+	var candidates []string
+	filepath.Walk(mPoint, func(path string, f os.FileInfo, err error) error {
+		if err != nil || f == nil {
+			return nil
+		}
+		if f.IsDir() {
+			if skip[path] || IsIgnored(mPoint, path) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !known[path] && !IsIgnored(mPoint, path) && musicmgr.IsMusicFile(path) {
+			candidates = append(candidates, path)
+		}
+		return nil
+	})
+
+	name := filepath.Base(old.SongFullPath)
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return filepath.Base(candidates[i]) == name && filepath.Base(candidates[j]) != name
+	})
+
+	for _, path := range candidates {
+		if len(old.MusicBrainzID) > 0 {
+			err, tags := musicmgr.GetRawTags(path)
+			if err == nil && tags.MusicBrainzTrack == old.MusicBrainzID {
+				return path
+			}
+		}
+
+		if len(old.Checksum) > 0 {
+			sum, _, err := fileChecksum(path, 0)
+			if err == nil && sum == old.Checksum {
+				return path
+			}
+		}
+	}
+	return ""
+}
+
+// setSongPath stores the new path of the file of the Songs.
+func setSongPath(refs []SongRef, path string) error {
+	db, err := openDB()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	return db.Update(func(tx *bolt.Tx) error {
+		for _, ref := range refs {
+			artistBucket := tx.Bucket([]byte("Artists")).Bucket([]byte(ref.Artist))
+			if artistBucket == nil {
+				return fuse.ENOENT
+			}
+
+			albumBucket := artistBucket.Bucket([]byte(ref.Album))
+			if albumBucket == nil {
+				return fuse.ENOENT
+			}
+
+			songJson := albumBucket.Get([]byte(ref.Song))
+			if songJson == nil {
+				return fuse.ENOENT
+			}
+
+			var songStore SongStore
+			err := json.Unmarshal(songJson, &songStore)
+			if err != nil {
+				return err
+			}
+
+			songStore.SongFullPath = path
+			encoded, err := json.Marshal(songStore)
+			if err != nil {
+				return err
+			}
+
+			err = albumBucket.Put([]byte(ref.Song), encoded)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
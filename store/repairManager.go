@@ -0,0 +1,186 @@
+// Copyright 2016 Danko Miocevic. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Author: Danko Miocevic
+
+package store
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/dankomiocevic/mulifs/playlistmgr"
+	"github.com/golang/glog"
+
+	"bazil.org/fuse"
+	"github.com/boltdb/bolt"
+)
+
+// PlaylistRepair is the result of repairing a playlist.
+type PlaylistRepair struct {
+	Playlist string
+	// Fixed are the entries that pointed to a Song that
+	// was renamed or moved, with their old and new values.
+	Fixed []string
+	// Missing are the entries whose Song does not exist.
+	Missing []string
+	// Removed is true if the Missing entries were removed.
+	Removed bool
+}
+
+// playlistEntryName returns the name of a playlist
+// entry used in the repair reports.
+func playlistEntryName(file playlistmgr.PlaylistFile) string {
+	return file.Artist + "/" + file.Album + "/" + file.Title
+}
+
+// playlistSongExists returns true if the Song
+// of the playlist entry is in the Music Library.
+func playlistSongExists(tx *bolt.Tx, file playlistmgr.PlaylistFile) bool {
+	artistBucket := tx.Bucket([]byte("Artists")).Bucket([]byte(file.Artist))
+	if artistBucket == nil {
+		return false
+	}
+
+	albumBucket := artistBucket.Bucket([]byte(file.Album))
+	if albumBucket == nil {
+		return false
+	}
+	return albumBucket.Get([]byte(file.Title)) != nil
+}
+
+// RepairPlaylist resolves every entry of a playlist again and
+// stores the current Artist, Album, name and path of the Songs
+// renamed or moved. The entries whose Song does not exist are
+// reported and removed if prune is true. The playlist file is
+// always written again.
+func RepairPlaylist(name, mPoint string, prune bool) (PlaylistRepair, error) {
+	report := PlaylistRepair{Playlist: name, Removed: prune}
+	db, err := openDB()
+	if err != nil {
+		return report, err
+	}
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		root := tx.Bucket([]byte("Playlists"))
+		if root == nil {
+			return fuse.ENOENT
+		}
+
+		b := root.Bucket([]byte(name))
+		if b == nil {
+			return errors.New("Playlist " + name + " not exists.")
+		}
+
+		var keys [][]byte
+		var files []playlistmgr.PlaylistFile
+		index := &playlistIndex{}
+		c := b.Cursor()
+		for k, v := c.First(); k != nil; k, v = c.Next() {
+			var file playlistmgr.PlaylistFile
+			if v == nil || json.Unmarshal(v, &file) != nil {
+				continue
+			}
+
+			resolved := resolvePlaylistFile(tx, file, index)
+			if !playlistSongExists(tx, resolved) {
+				report.Missing = append(report.Missing, playlistEntryName(file))
+				if prune {
+					keys = append(keys, append([]byte(nil), k...))
+					files = append(files, playlistmgr.PlaylistFile{})
+				}
+				continue
+			}
+
+			if resolved == file {
+				continue
+			}
+
+			if playlistEntryName(resolved) != playlistEntryName(file) {
+				report.Fixed = append(report.Fixed, playlistEntryName(file)+" -> "+playlistEntryName(resolved))
+			} else {
+				report.Fixed = append(report.Fixed, playlistEntryName(file)+": "+file.Path+" -> "+resolved.Path)
+			}
+			keys = append(keys, append([]byte(nil), k...))
+			files = append(files, resolved)
+		}
+
+		for i, k := range keys {
+			if len(files[i].Title) < 1 {
+				if err := b.Delete(k); err != nil {
+					return err
+				}
+				continue
+			}
+
+			// The entries are named after the Songs, the old name
+			// is kept if another entry already has the new one.
+			// The queue entries keep their keys.
+			key := k
+			if !IsQueue(name) && b.Get([]byte(files[i].Title)) == nil {
+				if err := b.Delete(k); err != nil {
+					return err
+				}
+				key = []byte(files[i].Title)
+			}
+
+			encoded, err := json.Marshal(files[i])
+			if err != nil {
+				return err
+			}
+			if err := b.Put(key, encoded); err != nil {
+				return err
+			}
+
+			if !IsQueue(name) {
+				if err := linkPlaylistSong(tx, files[i], name); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+	db.Close()
+
+	if err != nil {
+		return report, err
+	}
+
+	if len(report.Fixed) > 0 || len(report.Missing) > 0 {
+		glog.Infof("Playlist %s repaired: %d entries fixed, %d missing\n", name, len(report.Fixed), len(report.Missing))
+	}
+	return report, RegeneratePlaylistFile(name, mPoint)
+}
+
+// RepairPlaylists repairs every playlist except the auto
+// playlists, that are generated again by MuLi.
+func RepairPlaylists(mPoint string, prune bool) ([]PlaylistRepair, error) {
+	playlists, err := ListPlaylists()
+	if err != nil {
+		return nil, err
+	}
+
+	var reports []PlaylistRepair
+	for _, p := range playlists {
+		if IsAutoPlaylist(p.Name) {
+			continue
+		}
+
+		report, err := RepairPlaylist(p.Name, mPoint, prune)
+		if err != nil {
+			return reports, err
+		}
+		reports = append(reports, report)
+	}
+	return reports, nil
+}
@@ -0,0 +1,91 @@
+// Copyright 2016 Danko Miocevic. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Author: Danko Miocevic
+
+package store
+
+import (
+	"encoding/json"
+	"time"
+
+	"bazil.org/fuse"
+	"github.com/boltdb/bolt"
+)
+
+// ReportEntry is a file that the scanner skipped
+// or failed to read and the reason.
+type ReportEntry struct {
+	Path   string
+	Reason string
+}
+
+// ScanReport lists the files skipped or failed
+// in the last scan of the source Directory.
+type ScanReport struct {
+	Time    time.Time
+	Entries []ReportEntry
+}
+
+// scanReportKey is the key of the last
+// report in the ScanReport bucket.
+var scanReportKey = []byte("last")
+
+// SetScanReport replaces the stored report
+// with the report of the last scan.
+func SetScanReport(report ScanReport) error {
+	db, err := openDB()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	return db.Update(func(tx *bolt.Tx) error {
+		root, err := tx.CreateBucketIfNotExists([]byte("ScanReport"))
+		if err != nil {
+			return err
+		}
+
+		encoded, err := json.Marshal(report)
+		if err != nil {
+			return err
+		}
+		return root.Put(scanReportKey, encoded)
+	})
+}
+
+// GetScanReport returns the report of the last
+// scan or ENOENT if there was no scan.
+func GetScanReport() (ScanReport, error) {
+	var report ScanReport
+	db, err := openDB()
+	if err != nil {
+		return report, err
+	}
+	defer db.Close()
+
+	err = db.View(func(tx *bolt.Tx) error {
+		root := tx.Bucket([]byte("ScanReport"))
+		if root == nil {
+			return fuse.ENOENT
+		}
+
+		v := root.Get(scanReportKey)
+		if v == nil {
+			return fuse.ENOENT
+		}
+		return json.Unmarshal(v, &report)
+	})
+	return report, err
+}
@@ -0,0 +1,279 @@
+// Copyright 2016 Danko Miocevic. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Author: Danko Miocevic
+
+package store
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/dankomiocevic/mulifs/musicmgr"
+	"os"
+	"path/filepath"
+
+	"bazil.org/fuse"
+	"github.com/boltdb/bolt"
+	"golang.org/x/net/context"
+)
+
+// SongNames are the names of a Song and its
+// Artist and Album as they are shown to the user.
+type SongNames struct {
+	SongRef
+	ArtistName string
+	AlbumName  string
+	Title      string
+	Genre      string
+	Year       string
+	Track      string
+	Duration   int
+}
+
+// ListSongNames returns the names of all
+// the Songs in the Music Library.
+func ListSongNames() ([]SongNames, error) {
+	db, err := openDB()
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	var songs []SongNames
+	err = db.View(func(tx *bolt.Tx) error {
+		root := tx.Bucket([]byte("Artists"))
+		if root == nil {
+			return fuse.EIO
+		}
+
+		return root.ForEach(func(artist, v []byte) error {
+			if v != nil {
+				return nil
+			}
+
+			artistBucket := root.Bucket(artist)
+			return artistBucket.ForEach(func(album, w []byte) error {
+				if w != nil {
+					return nil
+				}
+
+				songs = append(songs, albumSongNames(artistBucket, string(artist), string(album))...)
+				return nil
+			})
+		})
+	})
+	return songs, err
+}
+
+// ListAlbumSongNames returns the names of
+// the Songs in an Album.
+func ListAlbumSongNames(artist, album string) ([]SongNames, error) {
+	db, err := openDB()
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	var songs []SongNames
+	err = db.View(func(tx *bolt.Tx) error {
+		root := tx.Bucket([]byte("Artists"))
+		if root == nil {
+			return fuse.EIO
+		}
+
+		artistBucket := root.Bucket([]byte(artist))
+		if artistBucket == nil || artistBucket.Bucket([]byte(album)) == nil {
+			return fuse.ENOENT
+		}
+
+		songs = albumSongNames(artistBucket, artist, album)
+		return nil
+	})
+	return songs, err
+}
+
+// albumSongNames returns the names of the
+// Songs in an Album of the Artist bucket.
+func albumSongNames(artistBucket *bolt.Bucket, artist, album string) []SongNames {
+	var artistStore ArtistStore
+	json.Unmarshal(artistBucket.Get([]byte(".description")), &artistStore)
+	albumBucket := artistBucket.Bucket([]byte(album))
+	var albumStore AlbumStore
+	json.Unmarshal(albumBucket.Get([]byte(".description")), &albumStore)
+
+	var songs []SongNames
+	albumBucket.ForEach(func(song, x []byte) error {
+		if x == nil || song[0] == '.' {
+			return nil
+		}
+
+		var songStore SongStore
+		if err := json.Unmarshal(x, &songStore); err != nil {
+			return nil
+		}
+
+		songs = append(songs, SongNames{
+			SongRef:    SongRef{Artist: artist, Album: album, Song: string(song)},
+			ArtistName: artistStore.ArtistName,
+			AlbumName:  albumStore.AlbumName,
+			Title:      songStore.SongName,
+			Genre:      songStore.Genre,
+			Year:       songStore.Year,
+			Track:      songStore.Track,
+			Duration:   songStore.Duration,
+		})
+		return nil
+	})
+	return songs
+}
+
+// RetagSong moves a Song to the Artist and Album with
+// the specified names, creating them if they do not
+// exist, and writes the new tags in the file.
+// It returns the new location of the Song.
+// The retag hooks are run before and after the change.
+// Nothing is changed if the context is already cancelled.
+func RetagSong(ctx context.Context, ref SongRef, artist, album, title, mPoint string) (SongRef, error) {
+	if err := ctx.Err(); err != nil {
+		return ref, err
+	}
+
+	song, err := GetSong(ref.Artist, ref.Album, ref.Song)
+	if err != nil {
+		return ref, err
+	}
+
+	if song.TrackNumber > 0 {
+		return ref, errors.New("The tracks of the album images are read only.")
+	}
+
+	var s hookSong
+	if retagHooks() {
+		s = retaggedSong(song.SongFullPath, artist, album, title)
+		err = preHook(config.Hooks.PreRetag, hookRetag, s)
+		if err != nil {
+			return ref, err
+		}
+	}
+
+	artistPath, err := CreateArtist(artist)
+	if err != nil && err != fuse.EEXIST {
+		return ref, err
+	}
+
+	albumPath, err := CreateAlbum(artistPath, album)
+	if err != nil && err != fuse.EEXIST {
+		return ref, err
+	}
+
+	rootPoint := mPoint
+	if rootPoint[len(rootPoint)-1] != '/' {
+		rootPoint = rootPoint + "/"
+	}
+
+	err = os.MkdirAll(rootPoint+artistPath+"/"+albumPath, 0777)
+	if err != nil {
+		return ref, err
+	}
+
+	name, err := moveSongs(ref.Artist, ref.Album, ref.Song, artistPath, albumPath,
+		title+filepath.Ext(ref.Song), song.SongFullPath, mPoint)
+	if err != nil {
+		return ref, err
+	}
+
+	// moveSongs writes the names of the Directories
+	// in the tags, they are replaced by the real names.
+	newRef := SongRef{Artist: artistPath, Album: albumPath, Song: name}
+	newPath := rootPoint + artistPath + "/" + albumPath + "/" + name
+	err = SetSongTags(artist, album, title, newPath)
+	if err == nil && retagHooks() {
+		s.Path = newPath
+		postHook(config.Hooks.PostRetag, hookRetag, s)
+	}
+	return newRef, err
+}
+
+// SetChangeHandler sets the function called with the path
+// of a Song after MuLi writes its tags or moves its file,
+// so the data cached from the old file can be dropped.
+func SetChangeHandler(changed func(path string)) {
+	config.Changed = changed
+}
+
+// songChanged calls the change handler with the
+// path of the Song, if there is one.
+func songChanged(path string) {
+	if config.Changed != nil {
+		config.Changed(path)
+	}
+}
+
+// SetSongTrack writes the track number in the tags
+// of a Song and stores it in the database.
+func SetSongTrack(ref SongRef, track string) error {
+	song, err := GetSong(ref.Artist, ref.Album, ref.Song)
+	if err != nil {
+		return err
+	}
+
+	if song.TrackNumber > 0 {
+		return errors.New("The tracks of the album images are read only.")
+	}
+
+	var s hookSong
+	if retagHooks() {
+		s = retaggedSong(song.SongFullPath, "", "", "")
+		s.Artist, s.Album, s.Title, s.Track = s.OldArtist, s.OldAlbum, s.OldTitle, track
+		err = preHook(config.Hooks.PreRetag, hookRetag, s)
+		if err != nil {
+			return err
+		}
+	}
+
+	unlock := LockSong(ref.Artist, ref.Album, ref.Song)
+	err = musicmgr.SetTrack(track, song.SongFullPath)
+	unlock()
+	songChanged(song.SongFullPath)
+	if err != nil {
+		return err
+	}
+
+	if retagHooks() {
+		postHook(config.Hooks.PostRetag, hookRetag, s)
+	}
+	return RefreshSongInfo(ref.Artist, ref.Album, ref.Song, song.SongFullPath)
+}
+
+// SetSongGenre writes the genre in the tags of
+// a Song and stores it in the database.
+func SetSongGenre(ref SongRef, genre string) error {
+	song, err := GetSong(ref.Artist, ref.Album, ref.Song)
+	if err != nil {
+		return err
+	}
+
+	if song.TrackNumber > 0 {
+		return errors.New("The tracks of the album images are read only.")
+	}
+
+	unlock := LockSong(ref.Artist, ref.Album, ref.Song)
+	err = musicmgr.SetGenre(genre, song.SongFullPath)
+	unlock()
+	songChanged(song.SongFullPath)
+	if err != nil {
+		return err
+	}
+	return RefreshSongInfo(ref.Artist, ref.Album, ref.Song, song.SongFullPath)
+}
@@ -0,0 +1,142 @@
+// Copyright 2016 Danko Miocevic. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Author: Danko Miocevic
+
+package store
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+
+	"github.com/boltdb/bolt"
+)
+
+// writer is the lock file held by the process that
+// modifies the database, only one process can modify
+// it while the others open it read only.
+var writer struct {
+	mu   sync.Mutex
+	path string
+	file *os.File
+}
+
+// SetReadOnlyDB opens the database read only, so it can
+// be shared with the MuLi process that modifies it.
+// It must be called before InitDB.
+func SetReadOnlyDB() {
+	config.Options = &bolt.Options{ReadOnly: true}
+}
+
+// IsReadOnlyError returns true if the error was returned
+// by a change made to the database opened read only.
+func IsReadOnlyError(err error) bool {
+	return err == bolt.ErrDatabaseReadOnly || err == bolt.ErrTxNotWritable
+}
+
+// readOnlyDB returns true if the database is opened read only.
+func readOnlyDB() bool {
+	return config.Options != nil && config.Options.ReadOnly
+}
+
+// lockDB locks the database to modify it, it returns an
+// error if another process is modifying it.
+// The lock of the database opened before is released.
+func lockDB(path string) error {
+	writer.mu.Lock()
+	defer writer.mu.Unlock()
+
+	if writer.file != nil && writer.path == path {
+		return nil
+	}
+	unlockWriter()
+
+	file, err := os.OpenFile(path+".lock", os.O_RDWR|os.O_CREATE, 0600)
+	if err != nil {
+		return err
+	}
+
+	err = syscall.Flock(int(file.Fd()), syscall.LOCK_EX|syscall.LOCK_NB)
+	if err == syscall.EWOULDBLOCK {
+		pid, _ := ioutil.ReadAll(file)
+		file.Close()
+		return fmt.Errorf("The database %s is being modified by another MuLi (PID %s), use the read_only option to share it.", path, strings.TrimSpace(string(pid)))
+	}
+	if err != nil {
+		file.Close()
+		return err
+	}
+
+	file.Truncate(0)
+	file.WriteAt([]byte(strconv.Itoa(os.Getpid())+"\n"), 0)
+	writer.path = path
+	writer.file = file
+	return nil
+}
+
+// unlockDB releases the lock of the database
+// so another process can modify it.
+func unlockDB() {
+	writer.mu.Lock()
+	defer writer.mu.Unlock()
+	unlockWriter()
+}
+
+func unlockWriter() {
+	if writer.file == nil {
+		return
+	}
+
+	// Closing the file releases the lock, it is not removed
+	// because another process may be locking it already.
+	writer.file.Close()
+	writer.file = nil
+	writer.path = ""
+}
+
+// openReadOnly checks that the database shared read only
+// exists, it is never created or decrypted by the readers.
+func openReadOnly(path string) error {
+	if len(encryption.secret) > 0 {
+		return errors.New("The encrypted databases cannot be opened read only.")
+	}
+	if _, err := os.Stat(path); err != nil {
+		return err
+	}
+
+	db, err := bolt.Open(path, 0600, config.Options)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	err = db.View(func(tx *bolt.Tx) error {
+		if tx.Bucket([]byte("Artists")) == nil {
+			return errors.New("Not a MuLi database.")
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	config.DbPath = path
+	return nil
+}
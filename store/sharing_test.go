@@ -0,0 +1,68 @@
+// Copyright 2016 Danko Miocevic. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Author: Danko Miocevic
+
+package store
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"testing"
+)
+
+func TestLockDB(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "muli.db")
+	if err := lockDB(path); err != nil {
+		t.Fatal(err)
+	}
+	if err := lockDB(path); err != nil {
+		t.Errorf("the lock held by the process was refused: %s", err)
+	}
+
+	pid, _ := ioutil.ReadFile(path + ".lock")
+	if strings.TrimSpace(string(pid)) != strconv.Itoa(os.Getpid()) {
+		t.Errorf("the lock file has %q", pid)
+	}
+
+	// Another process is the one using another open file.
+	other, err := os.OpenFile(path+".lock", os.O_RDWR, 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer other.Close()
+	if err := syscall.Flock(int(other.Fd()), syscall.LOCK_EX|syscall.LOCK_NB); err != syscall.EWOULDBLOCK {
+		t.Fatalf("the database was not locked: %v", err)
+	}
+
+	unlockDB()
+	if err := syscall.Flock(int(other.Fd()), syscall.LOCK_EX|syscall.LOCK_NB); err != nil {
+		t.Fatalf("the lock was not released: %s", err)
+	}
+	other.Truncate(0)
+	other.WriteAt([]byte("1234\n"), 0)
+
+	err = lockDB(path)
+	if err == nil {
+		unlockDB()
+		t.Fatal("the database locked by another process was locked")
+	}
+	if !strings.Contains(err.Error(), "PID 1234") {
+		t.Errorf("the error does not tell the process: %s", err)
+	}
+}
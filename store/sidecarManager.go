@@ -0,0 +1,320 @@
+// Copyright 2016 Danko Miocevic. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Author: Danko Miocevic
+
+package store
+
+import (
+	"github.com/dankomiocevic/mulifs/musicmgr"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"bazil.org/fuse"
+	"github.com/boltdb/bolt"
+	"github.com/golang/glog"
+)
+
+// storeSidecar stores a file found next to the Songs of an
+// Album in the specified root bucket by Artist and Album,
+// the value is the path of the file.
+func storeSidecar(bucket string, tags *musicmgr.FileTags, path string) error {
+	_, name := filepath.Split(path)
+	return putSidecar(bucket, tags, name, path)
+}
+
+// putSidecar stores the path of a file of an Album with the
+// specified name in the root bucket by Artist and Album.
+func putSidecar(bucket string, tags *musicmgr.FileTags, name, path string) error {
+	db, err := openDB()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	return db.Update(func(tx *bolt.Tx) error {
+		root, err := tx.CreateBucketIfNotExists([]byte(bucket))
+		if err != nil {
+			return err
+		}
+
+		artistBucket, err := root.CreateBucketIfNotExists([]byte(GetCompatibleString(tags.Artist)))
+		if err != nil {
+			return err
+		}
+
+		albumBucket, err := artistBucket.CreateBucketIfNotExists([]byte(GetCompatibleString(tags.Album)))
+		if err != nil {
+			return err
+		}
+
+		glog.Infof("Storing %s file %s for Artist: %s and Album: %s\n", bucket, name, tags.Artist, tags.Album)
+		return albumBucket.Put([]byte(name), []byte(path))
+	})
+}
+
+// sidecarAlbumBucket returns the bucket with the files of
+// an Album or nil if the Album has no files.
+func sidecarAlbumBucket(tx *bolt.Tx, bucket, artist, album string) *bolt.Bucket {
+	root := tx.Bucket([]byte(bucket))
+	if root == nil {
+		return nil
+	}
+
+	artistBucket := root.Bucket([]byte(artist))
+	if artistBucket == nil {
+		return nil
+	}
+	return artistBucket.Bucket([]byte(album))
+}
+
+// moveSidecars moves the files of an Album in the bucket to
+// the new Album. The paths inside the old Directory are
+// changed to the new one, the files are moved with it.
+func moveSidecars(tx *bolt.Tx, bucket string, m albumMove, oldPath, newPath string) error {
+	b := sidecarAlbumBucket(tx, bucket, m.artist, m.album)
+	if b == nil {
+		return nil
+	}
+
+	root := tx.Bucket([]byte(bucket))
+	artistBucket, err := root.CreateBucketIfNotExists([]byte(m.newArtist))
+	if err != nil {
+		return err
+	}
+
+	albumBucket, err := artistBucket.CreateBucketIfNotExists([]byte(m.newAlbum))
+	if err != nil {
+		return err
+	}
+
+	err = b.ForEach(func(k, v []byte) error {
+		if albumBucket.Get(k) != nil {
+			return nil
+		}
+		path := strings.Replace(string(v), oldPath+"/", newPath+"/", 1)
+		return albumBucket.Put(k, []byte(path))
+	})
+	if err != nil {
+		return err
+	}
+	return root.Bucket([]byte(m.artist)).DeleteBucket([]byte(m.album))
+}
+
+// listSidecars returns the Dirent of the files of an
+// Album in the specified bucket, the files removed from
+// the source Directory are not listed.
+func listSidecars(bucket, artist, album string) ([]fuse.Dirent, error) {
+	db, err := openDB()
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	var a []fuse.Dirent
+	err = db.View(func(tx *bolt.Tx) error {
+		b := sidecarAlbumBucket(tx, bucket, artist, album)
+		if b == nil {
+			return nil
+		}
+
+		return b.ForEach(func(k, v []byte) error {
+			if _, err := os.Stat(string(v)); err == nil {
+				a = append(a, fuse.Dirent{Name: string(k), Type: fuse.DT_File})
+			}
+			return nil
+		})
+	})
+	return a, err
+}
+
+// getSidecarPath returns the path of a file of
+// the specified Album in the bucket.
+func getSidecarPath(bucket, artist, album, name string) (string, error) {
+	db, err := openDB()
+	if err != nil {
+		return "", err
+	}
+	defer db.Close()
+
+	var path string
+	err = db.View(func(tx *bolt.Tx) error {
+		b := sidecarAlbumBucket(tx, bucket, artist, album)
+		if b == nil {
+			return fuse.ENOENT
+		}
+
+		v := b.Get([]byte(name))
+		if v == nil {
+			return fuse.ENOENT
+		}
+		path = string(v)
+		return nil
+	})
+	return path, err
+}
+
+// ListExtraAlbums returns all the Albums
+// that have extra files.
+func ListExtraAlbums() ([]AlbumRef, error) {
+	db, err := openDB()
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	var a []AlbumRef
+	err = db.View(func(tx *bolt.Tx) error {
+		root := tx.Bucket([]byte("Extras"))
+		if root == nil {
+			return nil
+		}
+
+		c := root.Cursor()
+		for artist, v := c.First(); artist != nil; artist, v = c.Next() {
+			if v != nil {
+				continue
+			}
+
+			d := root.Bucket(artist).Cursor()
+			for album, w := d.First(); album != nil; album, w = d.Next() {
+				if w == nil {
+					a = append(a, AlbumRef{Artist: string(artist), Album: string(album)})
+				}
+			}
+		}
+		return nil
+	})
+	return a, err
+}
+
+// StoreExtra stores a non music file (cue sheets, logs,
+// scans, etc.) found next to the Songs of an Album.
+func StoreExtra(tags *musicmgr.FileTags, path string) error {
+	return storeSidecar("Extras", tags, path)
+}
+
+// ListExtras returns the Dirent of the extra
+// files of an Album.
+func ListExtras(artist, album string) ([]fuse.Dirent, error) {
+	return listSidecars("Extras", artist, album)
+}
+
+// GetExtraPath returns the path of an extra
+// file of the specified Album.
+func GetExtraPath(artist, album, name string) (string, error) {
+	return getSidecarPath("Extras", artist, album, name)
+}
+
+// StoreArtwork stores a cover image (folder.jpg,
+// cover.png, etc.) found next to the Songs of an Album.
+func StoreArtwork(tags *musicmgr.FileTags, path string) error {
+	return storeSidecar("Artwork", tags, path)
+}
+
+// ListArtwork returns the Dirent of the cover
+// images of an Album.
+func ListArtwork(artist, album string) ([]fuse.Dirent, error) {
+	return listSidecars("Artwork", artist, album)
+}
+
+// GetArtworkPath returns the path of a cover
+// image of the specified Album.
+func GetArtworkPath(artist, album, name string) (string, error) {
+	return getSidecarPath("Artwork", artist, album, name)
+}
+
+// albumCoverName is the name of the main cover
+// image of an Album without the extension.
+const albumCoverName = "cover"
+
+// SetAlbumCover stores the main cover image of an Album,
+// it is shown as cover plus the image extension (cover.jpg)
+// in the Album and it can be obtained with GetAlbumCover.
+func SetAlbumCover(tags *musicmgr.FileTags, path string) error {
+	name := albumCoverName + strings.ToLower(filepath.Ext(path))
+	return putSidecar("Artwork", tags, name, path)
+}
+
+// GetAlbumCover returns the path of the main
+// cover image of the specified Album.
+func GetAlbumCover(artist, album string) (string, error) {
+	for _, ext := range []string{".jpg", ".png"} {
+		path, err := GetArtworkPath(artist, album, albumCoverName+ext)
+		if err == nil {
+			return path, nil
+		}
+	}
+	return "", fuse.ENOENT
+}
+
+// artistImageName is the name of the image of an
+// Artist without the extension.
+const artistImageName = "artist"
+
+// StoreArtistImage stores the image of an Artist found
+// when scanning, it is shown as artist plus the image
+// extension (artist.jpg) in the Artist Directory.
+func StoreArtistImage(artist, path string) error {
+	db, err := openDB()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	return db.Update(func(tx *bolt.Tx) error {
+		root, err := tx.CreateBucketIfNotExists([]byte("ArtistImages"))
+		if err != nil {
+			return err
+		}
+
+		glog.Infof("Storing image %s for Artist: %s\n", path, artist)
+		return root.Put([]byte(GetCompatibleString(artist)), []byte(path))
+	})
+}
+
+// GetArtistImage returns the name shown in the Artist
+// Directory and the path of the image of an Artist.
+func GetArtistImage(artist string) (string, string, error) {
+	db, err := openDB()
+	if err != nil {
+		return "", "", err
+	}
+	defer db.Close()
+
+	var path string
+	err = db.View(func(tx *bolt.Tx) error {
+		root := tx.Bucket([]byte("ArtistImages"))
+		if root == nil {
+			return fuse.ENOENT
+		}
+
+		v := root.Get([]byte(artist))
+		if v == nil {
+			return fuse.ENOENT
+		}
+		path = string(v)
+		return nil
+	})
+
+	if err != nil {
+		return "", "", err
+	}
+
+	if _, err := os.Stat(path); err != nil {
+		return "", "", fuse.ENOENT
+	}
+	return artistImageName + strings.ToLower(filepath.Ext(path)), path, nil
+}
@@ -0,0 +1,187 @@
+// Copyright 2016 Danko Miocevic. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Author: Danko Miocevic
+
+package store
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"io/ioutil"
+	"sort"
+	"time"
+
+	"bazil.org/fuse"
+	"github.com/boltdb/bolt"
+)
+
+// SnapshotSong is a Song as it was stored in the
+// database when a snapshot of the index was taken.
+type SnapshotSong struct {
+	SongNames
+	Path     string
+	Checksum string `json:",omitempty"`
+}
+
+// snapshotLayout is the format of the names of the snapshots,
+// it avoids the colons that some clients do not support.
+const snapshotLayout = "2006-01-02T15-04-05"
+
+// TakeSnapshot stores the names and paths of all the Songs
+// in the Snapshots bucket compressed with gzip, keeping only
+// the last keep snapshots. The snapshot is not stored if the
+// index did not change since the last one.
+func TakeSnapshot(keep int) error {
+	db, err := openDB()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	return db.Update(func(tx *bolt.Tx) error {
+		var songs []SnapshotSong
+		root := tx.Bucket([]byte("Artists"))
+		err := root.ForEach(func(artist, v []byte) error {
+			if v != nil {
+				return nil
+			}
+
+			artistBucket := root.Bucket(artist)
+			return artistBucket.ForEach(func(album, w []byte) error {
+				if w != nil {
+					return nil
+				}
+
+				albumBucket := artistBucket.Bucket(album)
+				for _, s := range albumSongNames(artistBucket, string(artist), string(album)) {
+					var songStore SongStore
+					json.Unmarshal(albumBucket.Get([]byte(s.Song)), &songStore)
+					songs = append(songs, SnapshotSong{SongNames: s, Path: songStore.SongFullPath, Checksum: songStore.Checksum})
+				}
+				return nil
+			})
+		})
+		if err != nil {
+			return err
+		}
+
+		encoded, err := json.Marshal(songs)
+		if err != nil {
+			return err
+		}
+
+		var buf bytes.Buffer
+		w := gzip.NewWriter(&buf)
+		w.Write(encoded)
+		if err := w.Close(); err != nil {
+			return err
+		}
+
+		b, err := tx.CreateBucketIfNotExists([]byte("Snapshots"))
+		if err != nil {
+			return err
+		}
+
+		if _, last := b.Cursor().Last(); last != nil {
+			if previous, err := gunzip(last); err == nil && bytes.Equal(previous, encoded) {
+				return nil
+			}
+		}
+
+		err = b.Put([]byte(time.Now().Format(snapshotLayout)), buf.Bytes())
+		if err != nil {
+			return err
+		}
+
+		// The oldest snapshots are removed.
+		var names [][]byte
+		b.ForEach(func(k, v []byte) error {
+			names = append(names, append([]byte(nil), k...))
+			return nil
+		})
+		for i := 0; i < len(names)-keep; i++ {
+			if err := b.Delete(names[i]); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// gunzip returns the decompressed data of a snapshot.
+func gunzip(data []byte) ([]byte, error) {
+	r, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	return ioutil.ReadAll(r)
+}
+
+// ListSnapshots returns the names of the
+// stored snapshots from the oldest one.
+func ListSnapshots() ([]string, error) {
+	db, err := openDB()
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	var a []string
+	err = db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte("Snapshots"))
+		if b == nil {
+			return nil
+		}
+
+		return b.ForEach(func(k, v []byte) error {
+			a = append(a, string(k))
+			return nil
+		})
+	})
+	sort.Strings(a)
+	return a, err
+}
+
+// GetSnapshot returns the Songs stored in a
+// snapshot or ENOENT if it does not exist.
+func GetSnapshot(name string) ([]SnapshotSong, error) {
+	db, err := openDB()
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	var songs []SnapshotSong
+	err = db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte("Snapshots"))
+		if b == nil {
+			return fuse.ENOENT
+		}
+
+		v := b.Get([]byte(name))
+		if v == nil {
+			return fuse.ENOENT
+		}
+
+		data, err := gunzip(v)
+		if err != nil {
+			return err
+		}
+		return json.Unmarshal(data, &songs)
+	})
+	return songs, err
+}
@@ -0,0 +1,334 @@
+// Copyright 2016 Danko Miocevic. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Author: Danko Miocevic
+
+package store
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"time"
+
+	"bazil.org/fuse"
+	"github.com/boltdb/bolt"
+)
+
+// PlayRecord is a Song that was played
+// and the time when it was played.
+type PlayRecord struct {
+	SongRef
+	Time time.Time
+}
+
+// playKey returns the key of a play in the
+// Plays bucket, they are sorted by time.
+func playKey(t int64) []byte {
+	key := make([]byte, 8)
+	binary.BigEndian.PutUint64(key, uint64(t))
+	return key
+}
+
+// RecordPlay stores that the Song was played now.
+func RecordPlay(song SongRef) error {
+	db, err := openDB()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	return db.Update(func(tx *bolt.Tx) error {
+		root, err := tx.CreateBucketIfNotExists([]byte("Plays"))
+		if err != nil {
+			return err
+		}
+
+		encoded, err := json.Marshal(song)
+		if err != nil {
+			return err
+		}
+
+		t := time.Now().UnixNano()
+		for root.Get(playKey(t)) != nil {
+			t++
+		}
+		return root.Put(playKey(t), encoded)
+	})
+}
+
+// AddPlays stores plays that happened in the past, like the
+// ones imported from a portable player. A play of the same Song
+// at the same time is only stored once, so importing the same
+// plays again does not count them twice.
+// It returns the number of plays stored.
+func AddPlays(plays []PlayRecord) (int, error) {
+	db, err := openDB()
+	if err != nil {
+		return 0, err
+	}
+	defer db.Close()
+
+	added := 0
+	err = db.Update(func(tx *bolt.Tx) error {
+		root, err := tx.CreateBucketIfNotExists([]byte("Plays"))
+		if err != nil {
+			return err
+		}
+
+		for _, p := range plays {
+			ok, err := addPlay(root, p)
+			if err != nil {
+				return err
+			}
+			if ok {
+				added++
+			}
+		}
+		return nil
+	})
+	return added, err
+}
+
+// addPlay stores a play in the Plays bucket unless the
+// same Song was already played at the same time.
+// It returns true if the play was stored.
+func addPlay(root *bolt.Bucket, p PlayRecord) (bool, error) {
+	encoded, err := json.Marshal(p.SongRef)
+	if err != nil {
+		return false, err
+	}
+
+	t := p.Time.UnixNano()
+	for v := root.Get(playKey(t)); v != nil; v = root.Get(playKey(t)) {
+		if string(v) == string(encoded) {
+			return false, nil
+		}
+		t++
+	}
+	return true, root.Put(playKey(t), encoded)
+}
+
+// SongStats are the rating and the plays of a
+// Song imported from another music player.
+type SongStats struct {
+	Rating     int
+	PlayCount  int
+	LastPlayed time.Time
+}
+
+// SetSongStats stores the rating, from 1 to 5 stars, and the
+// play count of a Song imported from another music player.
+// The play count replaces the plays stored before the last
+// played time, which is also stored as a play so the Song
+// shows in the recently played Songs.
+func SetSongStats(song SongRef, stats SongStats) error {
+	db, err := openDB()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	return db.Update(func(tx *bolt.Tx) error {
+		root := tx.Bucket([]byte("Artists"))
+		if root == nil {
+			return fuse.ENOENT
+		}
+
+		artist := root.Bucket([]byte(song.Artist))
+		if artist == nil {
+			return fuse.ENOENT
+		}
+
+		album := artist.Bucket([]byte(song.Album))
+		if album == nil {
+			return fuse.ENOENT
+		}
+
+		songJson := album.Get([]byte(song.Song))
+		if songJson == nil {
+			return fuse.ENOENT
+		}
+
+		var old, songStore SongStore
+		if err := json.Unmarshal(songJson, &old); err != nil {
+			return err
+		}
+
+		songStore = old
+		if stats.Rating > 0 {
+			songStore.Rating = stats.Rating
+		}
+		if stats.PlayCount > 0 {
+			songStore.PlayCount = stats.PlayCount
+			songStore.LastPlayed = 0
+			if !stats.LastPlayed.IsZero() {
+				songStore.LastPlayed = stats.LastPlayed.UnixNano()
+			}
+		}
+
+		encoded, err := json.Marshal(songStore)
+		if err != nil {
+			return err
+		}
+
+		if err := album.Put([]byte(song.Song), encoded); err != nil {
+			return err
+		}
+
+		if err := indexSongTags(tx, old, songStore, song); err != nil {
+			return err
+		}
+
+		if stats.PlayCount < 1 || stats.LastPlayed.IsZero() {
+			return nil
+		}
+
+		plays, err := tx.CreateBucketIfNotExists([]byte("Plays"))
+		if err != nil {
+			return err
+		}
+		_, err = addPlay(plays, PlayRecord{SongRef: song, Time: stats.LastPlayed})
+		return err
+	})
+}
+
+// ListPlays returns the Songs played since the
+// specified time, sorted from the oldest play.
+// A zero time returns all the plays.
+func ListPlays(since time.Time) ([]PlayRecord, error) {
+	db, err := openDB()
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	var a []PlayRecord
+	err = db.View(func(tx *bolt.Tx) error {
+		root := tx.Bucket([]byte("Plays"))
+		if root == nil {
+			return nil
+		}
+
+		c := root.Cursor()
+		k, v := c.First()
+		if !since.IsZero() {
+			k, v = c.Seek(playKey(since.UnixNano()))
+		}
+
+		for ; k != nil; k, v = c.Next() {
+			var song SongRef
+			if err := json.Unmarshal(v, &song); err != nil {
+				continue
+			}
+
+			t := time.Unix(0, int64(binary.BigEndian.Uint64(k)))
+			a = append(a, PlayRecord{SongRef: song, Time: t})
+		}
+		return nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+// CountPlays returns how many times the Song was
+// played and the time of its last play. The play
+// count imported from other players is added to
+// the plays stored after it was imported.
+func CountPlays(song SongRef) (int, time.Time, error) {
+	db, err := openDB()
+	if err != nil {
+		return 0, time.Time{}, err
+	}
+	defer db.Close()
+
+	var count int
+	var last time.Time
+	err = db.View(func(tx *bolt.Tx) error {
+		var imported int64
+		if artists := tx.Bucket([]byte("Artists")); artists != nil {
+			if artist := artists.Bucket([]byte(song.Artist)); artist != nil {
+				if album := artist.Bucket([]byte(song.Album)); album != nil {
+					var songStore SongStore
+					if json.Unmarshal(album.Get([]byte(song.Song)), &songStore) == nil {
+						count = songStore.PlayCount
+						imported = songStore.LastPlayed
+					}
+				}
+			}
+		}
+
+		root := tx.Bucket([]byte("Plays"))
+		if root == nil {
+			return nil
+		}
+
+		return root.ForEach(func(k, v []byte) error {
+			var played SongRef
+			if err := json.Unmarshal(v, &played); err != nil || played != song {
+				return nil
+			}
+
+			t := int64(binary.BigEndian.Uint64(k))
+			last = time.Unix(0, t)
+			if t <= imported {
+				return nil
+			}
+			count++
+			return nil
+		})
+	})
+
+	if err != nil {
+		return 0, time.Time{}, err
+	}
+	return count, last, nil
+}
+
+// ListRecentPlays returns the last limit Songs
+// played, sorted from the most recent play.
+func ListRecentPlays(limit int) ([]PlayRecord, error) {
+	db, err := openDB()
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	var a []PlayRecord
+	err = db.View(func(tx *bolt.Tx) error {
+		root := tx.Bucket([]byte("Plays"))
+		if root == nil {
+			return nil
+		}
+
+		c := root.Cursor()
+		for k, v := c.Last(); k != nil && len(a) < limit; k, v = c.Prev() {
+			var song SongRef
+			if err := json.Unmarshal(v, &song); err != nil {
+				continue
+			}
+
+			t := time.Unix(0, int64(binary.BigEndian.Uint64(k)))
+			a = append(a, PlayRecord{SongRef: song, Time: t})
+		}
+		return nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+	return a, nil
+}
@@ -0,0 +1,92 @@
+// Copyright 2016 Danko Miocevic. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Author: Danko Miocevic
+
+package store
+
+import (
+	"encoding/json"
+	"github.com/dankomiocevic/mulifs/musicmgr"
+
+	"github.com/boltdb/bolt"
+)
+
+// LoadTagCache loads the tags cached by the last
+// scan, so the files that did not change since
+// then are not parsed again.
+func LoadTagCache() error {
+	db, err := openDB()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	entries := make(map[string]musicmgr.CachedTags)
+	err = db.View(func(tx *bolt.Tx) error {
+		root := tx.Bucket([]byte("TagCache"))
+		if root == nil {
+			return nil
+		}
+
+		return root.ForEach(func(k, v []byte) error {
+			var c musicmgr.CachedTags
+			if json.Unmarshal(v, &c) == nil {
+				entries[string(k)] = c
+			}
+			return nil
+		})
+	})
+
+	if err != nil {
+		return err
+	}
+	musicmgr.LoadTagCache(entries)
+	return nil
+}
+
+// SaveTagCache replaces the cached tags with the
+// ones of the files read since it was last saved.
+func SaveTagCache() error {
+	entries := musicmgr.UsedTagCache()
+	db, err := openDB()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	return db.Update(func(tx *bolt.Tx) error {
+		if tx.Bucket([]byte("TagCache")) != nil {
+			if err := tx.DeleteBucket([]byte("TagCache")); err != nil {
+				return err
+			}
+		}
+
+		root, err := tx.CreateBucket([]byte("TagCache"))
+		if err != nil {
+			return err
+		}
+
+		for path, c := range entries {
+			encoded, err := json.Marshal(c)
+			if err != nil {
+				return err
+			}
+			if err := root.Put([]byte(path), encoded); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
@@ -0,0 +1,104 @@
+// Copyright 2016 Danko Miocevic. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Author: Danko Miocevic
+
+package store
+
+import (
+	"io"
+	"sync"
+	"time"
+)
+
+// rateLimiter spreads the background work so it does not
+// use more than rate units per second on average, the
+// callers wait for their turn in the order they arrive.
+type rateLimiter struct {
+	mu   sync.Mutex
+	rate float64
+	next time.Time
+}
+
+// wait blocks until n units can be used,
+// it returns at once without a rate.
+func (l *rateLimiter) wait(n int64) {
+	l.mu.Lock()
+	if l.rate <= 0 || n <= 0 {
+		l.mu.Unlock()
+		return
+	}
+
+	now := time.Now()
+	if l.next.Before(now) {
+		l.next = now
+	}
+	start := l.next
+	l.next = l.next.Add(time.Duration(float64(n) / l.rate * float64(time.Second)))
+	l.mu.Unlock()
+
+	time.Sleep(start.Sub(now))
+}
+
+// The limits shared by all the background work:
+// the scans, the scrubber, the batched retags
+// and the copies and transcodes of the sync.
+var (
+	backgroundBytes rateLimiter
+	backgroundOps   rateLimiter
+)
+
+// SetBackgroundLimits sets the bytes and the operations per
+// second used by the background work, 0 does not limit them.
+func SetBackgroundLimits(bytes, ops int) {
+	backgroundBytes.mu.Lock()
+	backgroundBytes.rate = float64(bytes)
+	backgroundBytes.mu.Unlock()
+
+	backgroundOps.mu.Lock()
+	backgroundOps.rate = float64(ops)
+	backgroundOps.mu.Unlock()
+}
+
+// ThrottleOp waits until the background
+// work can make another operation.
+func ThrottleOp() {
+	backgroundOps.wait(1)
+}
+
+// ThrottleBytes waits until the background
+// work can read or write n bytes.
+func ThrottleBytes(n int64) {
+	backgroundBytes.wait(n)
+}
+
+// backgroundReader limits the reads to
+// the background bytes per second.
+type backgroundReader struct {
+	r io.Reader
+}
+
+// backgroundChunk is the maximum size of every read,
+// so the waits are spread over the file.
+const backgroundChunk = 64 * 1024
+
+func (b backgroundReader) Read(p []byte) (int, error) {
+	if len(p) > backgroundChunk {
+		p = p[:backgroundChunk]
+	}
+
+	n, err := b.r.Read(p)
+	ThrottleBytes(int64(n))
+	return n, err
+}
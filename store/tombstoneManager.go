@@ -0,0 +1,276 @@
+// Copyright 2016 Danko Miocevic. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Author: Danko Miocevic
+
+package store
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/dankomiocevic/mulifs/musicmgr"
+	"github.com/golang/glog"
+	"path/filepath"
+	"time"
+
+	"bazil.org/fuse"
+	"github.com/boltdb/bolt"
+)
+
+// Tombstone is a Song whose file disappeared from the
+// source Directory, it keeps the information and the
+// Playlists of the Song until it is restored or purged.
+type Tombstone struct {
+	SongRef
+	Metadata SongStore
+	Time     time.Time
+}
+
+// TombstoneName returns the name of the tombstone of a Song.
+func TombstoneName(ref SongRef) string {
+	return ref.Artist + " - " + ref.Album + " - " + ref.Song
+}
+
+// BurySong removes a Song whose file is missing from the
+// Music Library and its Playlists and keeps its tombstone.
+// Nothing is done when the source Directory itself is not
+// available, for example when the disk is not mounted.
+func BurySong(ref SongRef, mPoint string) error {
+	if !fileExists(mPoint) {
+		return errors.New("The source Directory is not available.")
+	}
+
+	db, err := openDB()
+	if err != nil {
+		return err
+	}
+
+	var songStore SongStore
+	err = db.Update(func(tx *bolt.Tx) error {
+		artistBucket := tx.Bucket([]byte("Artists")).Bucket([]byte(ref.Artist))
+		if artistBucket == nil {
+			return fuse.ENOENT
+		}
+
+		albumBucket := artistBucket.Bucket([]byte(ref.Album))
+		if albumBucket == nil {
+			return fuse.ENOENT
+		}
+
+		songJson := albumBucket.Get([]byte(ref.Song))
+		if songJson == nil {
+			return fuse.ENOENT
+		}
+
+		err := json.Unmarshal(songJson, &songStore)
+		if err != nil {
+			return err
+		}
+
+		if fileExists(songStore.SongFullPath) {
+			return errors.New("The file of the Song exists.")
+		}
+
+		encoded, err := json.Marshal(Tombstone{SongRef: ref, Metadata: songStore, Time: time.Now()})
+		if err != nil {
+			return err
+		}
+
+		missing, err := tx.CreateBucketIfNotExists([]byte("Missing"))
+		if err != nil {
+			return err
+		}
+
+		err = missing.Put([]byte(TombstoneName(ref)), encoded)
+		if err != nil {
+			return err
+		}
+		return albumBucket.Delete([]byte(ref.Song))
+	})
+	db.Close()
+
+	if err != nil {
+		return err
+	}
+
+	glog.Infof("The file %s is missing, the Song %s is kept as a tombstone\n", songStore.SongFullPath, TombstoneName(ref))
+	for _, list := range songStore.Playlists {
+		DeletePlaylistSong(list, ref.Song, true)
+		RegeneratePlaylistFile(list, mPoint)
+	}
+	return nil
+}
+
+// BuryMissingSongs keeps the tombstones of every Song
+// whose file is missing and returns how many were found.
+func BuryMissingSongs(mPoint string) (int, error) {
+	if !fileExists(mPoint) {
+		return 0, errors.New("The source Directory is not available.")
+	}
+
+	songs, err := ListSongInfo()
+	if err != nil {
+		return 0, err
+	}
+
+	buried := 0
+	for _, s := range songs {
+		if len(s.Path) < 1 || fileExists(s.Path) {
+			continue
+		}
+
+		if err := BurySong(s.SongRef, mPoint); err != nil {
+			glog.Errorf("Cannot keep the tombstone of %s: %s\n", s.Path, err)
+			continue
+		}
+		buried++
+	}
+	return buried, nil
+}
+
+// ListTombstones returns the tombstones sorted by name.
+func ListTombstones() ([]Tombstone, error) {
+	db, err := openDB()
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	var a []Tombstone
+	err = db.View(func(tx *bolt.Tx) error {
+		missing := tx.Bucket([]byte("Missing"))
+		if missing == nil {
+			return nil
+		}
+
+		return missing.ForEach(func(k, v []byte) error {
+			var t Tombstone
+			if err := json.Unmarshal(v, &t); err == nil {
+				a = append(a, t)
+			}
+			return nil
+		})
+	})
+	return a, err
+}
+
+// GetTombstone returns the tombstone with
+// the name or fuse.ENOENT if there is none.
+func GetTombstone(name string) (Tombstone, error) {
+	db, err := openDB()
+	if err != nil {
+		return Tombstone{}, err
+	}
+	defer db.Close()
+
+	var t Tombstone
+	err = db.View(func(tx *bolt.Tx) error {
+		missing := tx.Bucket([]byte("Missing"))
+		if missing == nil {
+			return fuse.ENOENT
+		}
+
+		v := missing.Get([]byte(name))
+		if v == nil {
+			return fuse.ENOENT
+		}
+		return json.Unmarshal(v, &t)
+	})
+	return t, err
+}
+
+// PurgeTombstone removes the tombstone with the name,
+// the Song is forgotten for good.
+func PurgeTombstone(name string) error {
+	db, err := openDB()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	return db.Update(func(tx *bolt.Tx) error {
+		missing := tx.Bucket([]byte("Missing"))
+		if missing == nil || missing.Get([]byte(name)) == nil {
+			return fuse.ENOENT
+		}
+		return missing.Delete([]byte(name))
+	})
+}
+
+// PurgeTombstones removes every tombstone.
+func PurgeTombstones() error {
+	db, err := openDB()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	return db.Update(func(tx *bolt.Tx) error {
+		if tx.Bucket([]byte("Missing")) == nil {
+			return nil
+		}
+		return tx.DeleteBucket([]byte("Missing"))
+	})
+}
+
+// RestoreTombstones restores the Songs whose files are
+// back in their paths, they are stored again and added to
+// their Playlists. The Songs whose files were moved and
+// scanned again are found by their checksum, only their
+// Playlists are restored. It returns how many were restored.
+func RestoreTombstones(mPoint string) (int, error) {
+	tombstones, err := ListTombstones()
+	if err != nil || len(tombstones) < 1 {
+		return 0, err
+	}
+
+	songs, err := ListSongInfo()
+	if err != nil {
+		return 0, err
+	}
+
+	restored := 0
+	for _, t := range tombstones {
+		path := t.Metadata.SongFullPath
+		if fileExists(path) {
+			_, tags := musicmgr.GetTags(path)
+			if err := StoreNewSong(&tags, path); err != nil {
+				glog.Errorf("Cannot restore the Song %s: %s\n", path, err)
+				continue
+			}
+
+			name := GetCompatibleString(tags.Title) + filepath.Ext(path)
+			addToPlaylists(t.Metadata.Playlists, GetCompatibleString(tags.Artist), GetCompatibleString(tags.Album),
+				name, path, mPoint)
+		} else {
+			found := false
+			for _, s := range songs {
+				if len(t.Metadata.Checksum) > 0 && s.Checksum == t.Metadata.Checksum {
+					addToPlaylists(t.Metadata.Playlists, s.Artist, s.Album, s.Song, s.Path, mPoint)
+					path = s.Path
+					found = true
+					break
+				}
+			}
+			if !found {
+				continue
+			}
+		}
+
+		glog.Infof("The Song %s was restored from %s\n", TombstoneName(t.SongRef), path)
+		PurgeTombstone(TombstoneName(t.SongRef))
+		restored++
+	}
+	return restored, nil
+}
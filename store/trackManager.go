@@ -0,0 +1,93 @@
+// Copyright 2016 Danko Miocevic. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Author: Danko Miocevic
+
+package store
+
+import (
+	"encoding/json"
+	"path/filepath"
+
+	"bazil.org/fuse"
+	"github.com/boltdb/bolt"
+	"github.com/dankomiocevic/mulifs/musicmgr"
+)
+
+// SetAlbumTrack marks a Song stored with StoreNewSong
+// as a track of a FLAC album image, the Song is read
+// from the samples of the track in the image.
+func SetAlbumTrack(song *musicmgr.FileTags, path string, track musicmgr.FlacTrack) error {
+	duration := musicmgr.TrackDuration(path, track)
+	db, err := openDB()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	return db.Update(func(tx *bolt.Tx) error {
+		root := tx.Bucket([]byte("Artists"))
+		if root == nil {
+			return fuse.EIO
+		}
+
+		artistBucket := root.Bucket([]byte(GetCompatibleString(song.Artist)))
+		if artistBucket == nil {
+			return fuse.ENOENT
+		}
+
+		albumBucket := artistBucket.Bucket([]byte(GetCompatibleString(song.Album)))
+		if albumBucket == nil {
+			return fuse.ENOENT
+		}
+
+		key := []byte(GetCompatibleString(song.Title) + filepath.Ext(path))
+		songJson := albumBucket.Get(key)
+		if songJson == nil {
+			return fuse.ENOENT
+		}
+
+		var songStore SongStore
+		err := json.Unmarshal(songJson, &songStore)
+		if err != nil {
+			return err
+		}
+
+		songStore.TrackNumber = track.Number
+		songStore.TrackStart = track.Start
+		songStore.TrackEnd = track.End
+		songStore.Duration = duration
+		encoded, err := json.Marshal(songStore)
+		if err != nil {
+			return err
+		}
+		return albumBucket.Put(key, encoded)
+	})
+}
+
+// GetAlbumTrack returns the path of the FLAC album
+// image and the track of a Song, or ENOENT if the
+// Song is not a track of an album image.
+func GetAlbumTrack(artist, album, song string) (string, musicmgr.FlacTrack, error) {
+	s, err := GetSong(artist, album, song)
+	if err != nil {
+		return "", musicmgr.FlacTrack{}, err
+	}
+
+	if s.TrackNumber < 1 {
+		return "", musicmgr.FlacTrack{}, fuse.ENOENT
+	}
+	return s.SongFullPath, musicmgr.FlacTrack{Number: s.TrackNumber, Title: s.SongName,
+		Start: s.TrackStart, End: s.TrackEnd}, nil
+}
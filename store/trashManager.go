@@ -0,0 +1,107 @@
+// Copyright 2016 Danko Miocevic. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Author: Danko Miocevic
+
+package store
+
+import (
+	"github.com/dankomiocevic/mulifs/musicmgr"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/golang/glog"
+)
+
+// DeleteMode defines what happens with the files of the
+// Songs when their Artist or Album is deleted.
+type DeleteMode int
+
+const (
+	// DeleteFiles removes the files of the Songs.
+	DeleteFiles DeleteMode = iota
+	// DeleteVirtual only removes the Songs from the
+	// database, the files are kept.
+	DeleteVirtual
+	// DeleteTrash moves the files of the Songs
+	// to the trash Directory.
+	DeleteTrash
+)
+
+// TrashDir is the Directory inside the source Directory
+// where the files of the deleted Songs are moved with
+// DeleteTrash, it is not scanned.
+const TrashDir = ".trash"
+
+// removeSongFile removes, keeps or moves to the trash
+// the file of a deleted Song depending on the mode.
+// The trashed files keep the path they had inside
+// the source Directory. It returns the path of the
+// file once it is kept or trashed.
+func removeSongFile(path, mPoint string, mode DeleteMode) string {
+	switch mode {
+	case DeleteVirtual:
+		return path
+	case DeleteFiles:
+		os.Remove(path)
+		musicmgr.RemoveTagSidecar(path)
+		return ""
+	}
+
+	rootPoint := mPoint
+	if rootPoint[len(rootPoint)-1] != '/' {
+		rootPoint = rootPoint + "/"
+	}
+
+	rel, err := filepath.Rel(rootPoint, path)
+	if err != nil || rel[0] == '.' {
+		_, rel = filepath.Split(path)
+	}
+
+	dst := rootPoint + TrashDir + "/" + rel
+	if _, err := os.Stat(dst); err == nil {
+		dst = dst + "." + strconv.FormatInt(time.Now().Unix(), 10)
+	}
+
+	err = os.MkdirAll(filepath.Dir(dst), 0777)
+	if err == nil {
+		err = os.Rename(path, dst)
+	}
+	if err != nil {
+		if !os.IsNotExist(err) {
+			glog.Errorf("Cannot move %s to the trash: %s\n", path, err)
+			return path
+		}
+		return ""
+	}
+	musicmgr.MoveTagSidecar(path, dst)
+	return dst
+}
+
+// removeEmptyDirs removes the Directory of a deleted Artist
+// or Album in the source Directory when it is empty, the
+// Artist Directory is also removed if it is left empty.
+func removeEmptyDirs(mPoint, artist string, album ...string) {
+	rootPoint := mPoint
+	if rootPoint[len(rootPoint)-1] != '/' {
+		rootPoint = rootPoint + "/"
+	}
+
+	for _, a := range album {
+		os.Remove(rootPoint + artist + "/" + a)
+	}
+	os.Remove(rootPoint + artist)
+}
@@ -0,0 +1,372 @@
+// Copyright 2016 Danko Miocevic. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Author: Danko Miocevic
+
+package store
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/dankomiocevic/mulifs/musicmgr"
+	"github.com/golang/glog"
+	"os"
+	"path/filepath"
+	"time"
+
+	"bazil.org/fuse"
+	"github.com/boltdb/bolt"
+	"golang.org/x/net/context"
+)
+
+// The bulk operations that can be undone.
+const (
+	// UndoRename is the rename of an Artist or Album Directory.
+	UndoRename = "rename"
+	// UndoRetag is the retag of the Songs matching a filter.
+	UndoRetag = "retag"
+	// UndoDelete is the removal of an Artist or Album Directory.
+	UndoDelete = "delete"
+)
+
+// UndoMove is an Album moved by a rename, the Artist and
+// Album are the Directories before the rename and the names
+// the ones written in its tags. Songs are the Songs moved
+// to the new Album.
+type UndoMove struct {
+	Artist     string
+	Album      string
+	NewArtist  string
+	NewAlbum   string
+	ArtistName string
+	AlbumName  string
+	Songs      []string
+}
+
+// UndoSong is a Song changed by a bulk operation, the
+// SongRef is where it is after the operation. The names
+// are the ones it had before a retag, and the paths the
+// file of a removed Song before and after the removal.
+type UndoSong struct {
+	SongRef
+	ArtistName string   `json:",omitempty"`
+	AlbumName  string   `json:",omitempty"`
+	Title      string   `json:",omitempty"`
+	Path       string   `json:",omitempty"`
+	OldPath    string   `json:",omitempty"`
+	Playlists  []string `json:",omitempty"`
+}
+
+// UndoRecord is the last bulk operation with the states
+// needed to reverse it, Name is what was changed. The
+// Artist and NewArtist are set for the Artist renames.
+type UndoRecord struct {
+	Time      time.Time
+	Op        string
+	Name      string
+	Artist    string     `json:",omitempty"`
+	NewArtist string     `json:",omitempty"`
+	Moves     []UndoMove `json:",omitempty"`
+	Songs     []UndoSong `json:",omitempty"`
+}
+
+// UndoResult is what was restored by the last undo,
+// Problems are the changes that could not be reversed.
+type UndoResult struct {
+	Time     time.Time
+	Op       string
+	Name     string
+	Restored int
+	Problems []ReportEntry
+}
+
+// The keys of the Undo bucket.
+var (
+	undoRecordKey = []byte("last")
+	undoResultKey = []byte("result")
+)
+
+// SetUndo replaces the bulk operation that is reversed by UndoLast.
+func SetUndo(record UndoRecord) error {
+	record.Time = time.Now()
+	db, err := openDB()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	return db.Update(func(tx *bolt.Tx) error {
+		root, err := tx.CreateBucketIfNotExists([]byte("Undo"))
+		if err != nil {
+			return err
+		}
+
+		encoded, err := json.Marshal(record)
+		if err != nil {
+			return err
+		}
+		return root.Put(undoRecordKey, encoded)
+	})
+}
+
+// recordMoves stores the Albums moved by a rename as
+// the last bulk operation, the errors are only logged.
+func recordMoves(name, artist, newArtist string, moves []albumMove) {
+	record := UndoRecord{Op: UndoRename, Name: name, Artist: artist, NewArtist: newArtist}
+	for _, m := range moves {
+		if len(m.songs) < 1 {
+			continue
+		}
+
+		u := UndoMove{
+			Artist:     m.artist,
+			Album:      m.album,
+			NewArtist:  m.newArtist,
+			NewAlbum:   m.newAlbum,
+			ArtistName: m.songs[0].ArtistName,
+			AlbumName:  m.songs[0].AlbumName,
+		}
+		for _, ref := range m.refs {
+			u.Songs = append(u.Songs, ref.Song)
+		}
+		record.Moves = append(record.Moves, u)
+	}
+
+	if err := SetUndo(record); err != nil {
+		glog.Errorf("Cannot store the undo of %s: %s\n", name, err)
+	}
+}
+
+// recordDelete stores the Songs of a removed Directory as
+// the last bulk operation, the errors are only logged.
+func recordDelete(record UndoRecord) {
+	if len(record.Songs) < 1 {
+		return
+	}
+
+	if err := SetUndo(record); err != nil {
+		glog.Errorf("Cannot store the undo of %s: %s\n", record.Name, err)
+	}
+}
+
+// getUndo returns the value of a key in the
+// Undo bucket or ENOENT if it does not exist.
+func getUndo(key []byte, value interface{}) error {
+	db, err := openDB()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	return db.View(func(tx *bolt.Tx) error {
+		root := tx.Bucket([]byte("Undo"))
+		if root == nil {
+			return fuse.ENOENT
+		}
+
+		v := root.Get(key)
+		if v == nil {
+			return fuse.ENOENT
+		}
+		return json.Unmarshal(v, value)
+	})
+}
+
+// GetUndo returns the bulk operation reversed by
+// UndoLast or ENOENT if there is none.
+func GetUndo() (UndoRecord, error) {
+	var record UndoRecord
+	err := getUndo(undoRecordKey, &record)
+	return record, err
+}
+
+// GetUndoResult returns the result of the
+// last undo or ENOENT if there was none.
+func GetUndoResult() (UndoResult, error) {
+	var result UndoResult
+	err := getUndo(undoResultKey, &result)
+	return result, err
+}
+
+// UndoLast reverses the last bulk operation and stores the
+// result, the operation can only be reversed once. The
+// renames are reversed completely or not at all, the retags
+// and the removals reverse every Song they can.
+func UndoLast(mPoint string) (UndoResult, error) {
+	record, err := GetUndo()
+	if err == fuse.ENOENT {
+		return UndoResult{}, errors.New("There is no operation to undo.")
+	}
+	if err != nil {
+		return UndoResult{}, err
+	}
+
+	result := UndoResult{Time: time.Now(), Op: record.Op, Name: record.Name}
+	switch record.Op {
+	case UndoRename:
+		err = undoRename(record, &result, mPoint)
+	case UndoRetag:
+		undoRetag(record, &result, mPoint)
+	case UndoDelete:
+		undoDelete(record, &result, mPoint)
+	default:
+		err = errors.New("Unknown operation.")
+	}
+	if err != nil {
+		return result, err
+	}
+
+	db, err := openDB()
+	if err != nil {
+		return result, err
+	}
+	defer db.Close()
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		root, err := tx.CreateBucketIfNotExists([]byte("Undo"))
+		if err != nil {
+			return err
+		}
+
+		encoded, err := json.Marshal(result)
+		if err != nil {
+			return err
+		}
+		root.Delete(undoRecordKey)
+		return root.Put(undoResultKey, encoded)
+	})
+	return result, err
+}
+
+// undoRename moves the Songs back to the Albums they had
+// before a rename, the Songs added later to the renamed
+// Albums are kept there.
+func undoRename(record UndoRecord, result *UndoResult, mPoint string) error {
+	created := false
+	if len(record.Artist) > 0 {
+		_, err := GetArtistPath(record.Artist)
+		created = err != nil
+	}
+
+	var moves []albumMove
+	for _, u := range record.Moves {
+		songs, err := ListAlbumSongNames(u.NewArtist, u.NewAlbum)
+		if err != nil {
+			return err
+		}
+
+		moved := make(map[string]bool)
+		for _, name := range u.Songs {
+			moved[name] = true
+		}
+
+		m := albumMove{
+			artist:     u.NewArtist,
+			album:      u.NewAlbum,
+			newArtist:  u.Artist,
+			newAlbum:   u.Album,
+			artistName: u.ArtistName,
+			albumName:  u.AlbumName,
+		}
+		for _, s := range songs {
+			if moved[s.Song] {
+				m.songs = append(m.songs, s)
+				delete(moved, s.Song)
+			}
+		}
+		for name := range moved {
+			result.Problems = append(result.Problems, ReportEntry{
+				Path:   u.NewArtist + "/" + u.NewAlbum + "/" + name,
+				Reason: "The Song is no longer in the renamed Album.",
+			})
+		}
+		if len(m.songs) > 0 {
+			moves = append(moves, m)
+		}
+	}
+
+	err := moveAlbums(context.Background(), moves, mPoint, nil)
+	if err != nil {
+		return err
+	}
+
+	for _, m := range moves {
+		result.Restored += len(m.songs)
+	}
+	if len(record.Artist) > 0 {
+		return finishArtistMove(record.NewArtist, record.Artist, created, mPoint)
+	}
+	return nil
+}
+
+// undoRetag writes back the names the Songs had before a retag.
+func undoRetag(record UndoRecord, result *UndoResult, mPoint string) {
+	for _, s := range record.Songs {
+		ThrottleOp()
+		_, err := RetagSong(context.Background(), s.SongRef, s.ArtistName, s.AlbumName, s.Title, mPoint)
+		if err != nil {
+			result.Problems = append(result.Problems, ReportEntry{
+				Path:   s.Artist + "/" + s.Album + "/" + s.Song,
+				Reason: err.Error(),
+			})
+			continue
+		}
+		result.Restored++
+	}
+}
+
+// undoDelete stores again the removed Songs whose files were
+// kept or moved to the trash, the trashed files are moved back
+// first. The Songs are added again to their playlists.
+func undoDelete(record UndoRecord, result *UndoResult, mPoint string) {
+	for _, s := range record.Songs {
+		problem := func(reason string) {
+			result.Problems = append(result.Problems, ReportEntry{Path: s.OldPath, Reason: reason})
+		}
+
+		if len(s.Path) < 1 {
+			problem("The file was deleted.")
+			continue
+		}
+
+		if s.Path != s.OldPath {
+			if _, err := os.Stat(s.OldPath); err == nil {
+				problem("There is another file in the path.")
+				continue
+			}
+
+			err := os.MkdirAll(filepath.Dir(s.OldPath), 0777)
+			if err == nil {
+				err = os.Rename(s.Path, s.OldPath)
+			}
+			if err != nil {
+				problem("Cannot move the file back: " + err.Error())
+				continue
+			}
+			musicmgr.MoveTagSidecar(s.Path, s.OldPath)
+		}
+
+		_, tags := musicmgr.GetTags(s.OldPath)
+		err := StoreNewSong(&tags, s.OldPath)
+		if err != nil {
+			problem("Cannot store the Song: " + err.Error())
+			continue
+		}
+
+		name := GetCompatibleString(tags.Title) + filepath.Ext(s.OldPath)
+		addToPlaylists(s.Playlists, GetCompatibleString(tags.Artist), GetCompatibleString(tags.Album),
+			name, s.OldPath, mPoint)
+		result.Restored++
+	}
+}
@@ -0,0 +1,158 @@
+// Copyright 2016 Danko Miocevic. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Author: Danko Miocevic
+
+package store
+
+import (
+	"encoding/json"
+	"github.com/dankomiocevic/mulifs/musicmgr"
+	"path/filepath"
+	"strings"
+
+	"bazil.org/fuse"
+	"github.com/boltdb/bolt"
+)
+
+// SongVersion is one of the files of a Song that is
+// in its Album in a lossless and a lossy format, like
+// the original FLAC file and an MP3 transcoded from it.
+type SongVersion struct {
+	Name     string
+	Codec    string
+	Bitrate  string
+	Lossless bool
+}
+
+// isLosslessSong returns true if the Song is stored
+// in a lossless format, the extension is used for the
+// Songs stored before their codec was known.
+func isLosslessSong(name string, song SongStore) bool {
+	if len(song.Codec) > 0 {
+		return musicmgr.IsLosslessCodec(song.Codec)
+	}
+
+	switch strings.ToLower(filepath.Ext(name)) {
+	case ".flac", ".wav", ".aif", ".aiff":
+		return true
+	}
+	return false
+}
+
+// versionKey returns the key that links the versions of a
+// Song, its MusicBrainz identifier or its title and track.
+func versionKey(song SongStore) string {
+	if len(song.MusicBrainzID) > 0 {
+		return "musicbrainz:" + song.MusicBrainzID
+	}
+	return strings.ToLower(strings.TrimSpace(song.SongName)) + "/" + song.Track
+}
+
+// albumVersions returns the Songs of the Album bucket that
+// have a lossless and a lossy version, grouped by Song.
+func albumVersions(b *bolt.Bucket) [][]SongVersion {
+	groups := make(map[string][]SongVersion)
+	var keys []string
+	b.ForEach(func(k, v []byte) error {
+		var song SongStore
+		if v == nil || k[0] == '.' || json.Unmarshal(v, &song) != nil {
+			return nil
+		}
+
+		key := versionKey(song)
+		if _, ok := groups[key]; !ok {
+			keys = append(keys, key)
+		}
+		groups[key] = append(groups[key], SongVersion{Name: string(k), Codec: song.Codec,
+			Bitrate: song.Bitrate, Lossless: isLosslessSong(string(k), song)})
+		return nil
+	})
+
+	var a [][]SongVersion
+	for _, key := range keys {
+		var lossless, lossy bool
+		for _, v := range groups[key] {
+			lossless = lossless || v.Lossless
+			lossy = lossy || !v.Lossless
+		}
+		if lossless && lossy {
+			a = append(a, groups[key])
+		}
+	}
+	return a
+}
+
+// ListSongVersions returns the Songs of an Album that are
+// stored in a lossless and a lossy format, with all their
+// versions. The versions are linked by their MusicBrainz
+// identifier or by their title and track number.
+func ListSongVersions(artist, album string) ([][]SongVersion, error) {
+	db, err := openDB()
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	var a [][]SongVersion
+	err = db.View(func(tx *bolt.Tx) error {
+		artistBucket := tx.Bucket([]byte("Artists")).Bucket([]byte(artist))
+		if artistBucket == nil {
+			return fuse.ENOENT
+		}
+
+		albumBucket := artistBucket.Bucket([]byte(album))
+		if albumBucket == nil {
+			return fuse.ENOENT
+		}
+
+		a = albumVersions(albumBucket)
+		return nil
+	})
+	return a, err
+}
+
+// ListVersionAlbums returns the Albums that have Songs
+// stored in a lossless and a lossy format.
+func ListVersionAlbums() ([]AlbumRef, error) {
+	db, err := openDB()
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	var a []AlbumRef
+	err = db.View(func(tx *bolt.Tx) error {
+		root := tx.Bucket([]byte("Artists"))
+		return root.ForEach(func(artist, v []byte) error {
+			artistBucket := root.Bucket(artist)
+			if v != nil || artistBucket == nil {
+				return nil
+			}
+
+			return artistBucket.ForEach(func(album, w []byte) error {
+				albumBucket := artistBucket.Bucket(album)
+				if w != nil || albumBucket == nil {
+					return nil
+				}
+
+				if len(albumVersions(albumBucket)) > 0 {
+					a = append(a, AlbumRef{Artist: string(artist), Album: string(album)})
+				}
+				return nil
+			})
+		})
+	})
+	return a, err
+}
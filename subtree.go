@@ -0,0 +1,83 @@
+// Copyright 2016 Danko Miocevic. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Author: Danko Miocevic
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"github.com/dankomiocevic/mulifs/store"
+	"strings"
+)
+
+// The kinds of Directories that can be mounted alone
+// with the subtree option.
+const (
+	// subtreeArtist mounts an Artist Directory.
+	subtreeArtist = "artist"
+	// subtreeGenre mounts the auto playlist of a genre.
+	subtreeGenre = "genre"
+	// subtreePlaylist mounts a playlist.
+	subtreePlaylist = "playlist"
+)
+
+// parseSubtree splits the subtree option in the kind
+// and the name of the Directory mounted, the name is
+// returned as it is stored in the database.
+func parseSubtree(value string) (string, string, error) {
+	items := strings.SplitN(value, ":", 2)
+	if len(items) < 2 || len(strings.TrimSpace(items[1])) < 1 {
+		return "", "", errors.New("Error in subtree, it must be artist:NAME, genre:NAME or playlist:NAME")
+	}
+
+	switch items[0] {
+	case subtreeArtist, subtreePlaylist:
+		return items[0], store.GetCompatibleString(items[1]), nil
+	case subtreeGenre:
+		return items[0], genrePlaylistPrefix + store.GetCompatibleString(items[1]), nil
+	}
+	return "", "", errors.New("Error in subtree, it must be artist:NAME, genre:NAME or playlist:NAME")
+}
+
+// checkSubtree returns an error if the Directory
+// mounted with the subtree option does not exist.
+func checkSubtree() error {
+	kind, name, err := parseSubtree(config_params.subtree)
+	if err != nil {
+		return err
+	}
+
+	if kind == subtreeArtist {
+		_, err = store.GetArtistPath(name)
+	} else {
+		_, err = store.GetPlaylistPath(name)
+	}
+	if err != nil {
+		return fmt.Errorf("Cannot mount the %s %s: %s", kind, name, err)
+	}
+	return nil
+}
+
+// subtreeRoot returns the Directory mounted as the
+// root of the filesystem with the subtree option.
+// The genres are the playlists generated for them.
+func subtreeRoot(f *FS) *Dir {
+	kind, name, _ := parseSubtree(config_params.subtree)
+	if kind == subtreeArtist {
+		return &Dir{fs: f, artist: name, mPoint: f.mPoint}
+	}
+	return &Dir{fs: f, artist: "playlists", album: name, mPoint: f.mPoint}
+}
@@ -0,0 +1,47 @@
+// Copyright 2016 Danko Miocevic. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Author: Danko Miocevic
+
+package main
+
+import (
+	"testing"
+
+	"github.com/dankomiocevic/mulifs/store"
+)
+
+func TestParseSubtree(t *testing.T) {
+	tests := []struct {
+		value string
+		kind  string
+		name  string
+	}{
+		{"artist:Pink Floyd", subtreeArtist, store.GetCompatibleString("Pink Floyd")},
+		{"playlist:Road Trip", subtreePlaylist, store.GetCompatibleString("Road Trip")},
+		{"genre:Hard Rock", subtreeGenre, genrePlaylistPrefix + store.GetCompatibleString("Hard Rock")},
+	}
+	for _, test := range tests {
+		kind, name, err := parseSubtree(test.value)
+		if err != nil || kind != test.kind || name != test.name {
+			t.Errorf("parseSubtree(%q) = %q, %q, %v, want %q, %q", test.value, kind, name, err, test.kind, test.name)
+		}
+	}
+
+	for _, value := range []string{"", "artist", "artist:", "artist: ", "album:Animals"} {
+		if _, _, err := parseSubtree(value); err == nil {
+			t.Errorf("parseSubtree(%q) accepted", value)
+		}
+	}
+}
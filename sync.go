@@ -0,0 +1,125 @@
+// Copyright 2016 Danko Miocevic. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Author: Danko Miocevic
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"github.com/dankomiocevic/mulifs/store"
+	"github.com/dankomiocevic/mulifs/tools"
+	"log"
+	"os"
+	"path/filepath"
+)
+
+// runSync runs the sync command, it mirrors the
+// selected Songs of the Library to a Directory.
+func runSync(db_path string, args []string) {
+	flags := flag.NewFlagSet("sync", flag.ExitOnError)
+	playlists := flags.String("playlists", "", "Semicolon separated playlists to synchronize.")
+	artists := flags.String("artists", "", "Semicolon separated Artists to synchronize.")
+	crates := flags.String("crates", "", "Semicolon separated crates to synchronize.")
+	template := flags.String("template", tools.DefaultSyncTemplate, "Path of the Songs in the target.")
+	transcode := flags.String("transcode", "", "Format the Songs are converted to with ffmpeg, for example mp3.")
+	flags.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage:\n  %s [global_options] sync [sync_options] TARGET\n", progName)
+		fmt.Fprintf(os.Stderr, "\nSync Options:\n")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+
+	if flags.NArg() != 1 {
+		flags.Usage()
+		os.Exit(2)
+	}
+
+	err := store.InitDB(db_path)
+	if err != nil {
+		log.Fatal(err)
+		os.Exit(5)
+	}
+
+	opts := tools.SyncOptions{
+		Playlists: parsePatterns(*playlists),
+		Artists:   parsePatterns(*artists),
+		Crates:    parsePatterns(*crates),
+		Template:  *template,
+		Transcode: *transcode,
+	}
+
+	copied, err := tools.Sync(flags.Arg(0), opts)
+	if err != nil {
+		log.Fatal(err)
+		os.Exit(14)
+	}
+	log.Printf("%d Songs copied to %s\n", copied, flags.Arg(0))
+}
+
+// runLibrarySync runs the sync-library command, it pulls
+// the changes of each library into the other one.
+func runLibrarySync(db_path string, args []string) {
+	flags := flag.NewFlagSet("sync-library", flag.ExitOnError)
+	prefer := flags.String("prefer", "local", "Library used when both change the same playlist entry: local or peer.")
+	flags.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage:\n  %s [global_options] sync-library [sync_options] MUSIC_SOURCE PEER_DB PEER_SOURCE\n", progName)
+		fmt.Fprintf(os.Stderr, "\nSync Options:\n")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+
+	if flags.NArg() != 3 || (*prefer != "local" && *prefer != "peer") {
+		flags.Usage()
+		os.Exit(2)
+	}
+
+	root, err := filepath.Abs(flags.Arg(0))
+	if err != nil {
+		log.Fatal(err)
+		os.Exit(6)
+	}
+	peerDb := flags.Arg(1)
+	peerRoot, err := filepath.Abs(flags.Arg(2))
+	if err != nil {
+		log.Fatal(err)
+		os.Exit(6)
+	}
+
+	// Pull from the peer into this library and then
+	// the other way, so both end with the union.
+	directions := []struct {
+		db, root, peerDb, peerRoot string
+		preferPeer                 bool
+	}{
+		{db_path, root, peerDb, peerRoot, *prefer == "peer"},
+		{peerDb, peerRoot, db_path, root, *prefer == "local"},
+	}
+	for _, d := range directions {
+		err = store.InitDB(d.db)
+		if err != nil {
+			log.Fatal(err)
+			os.Exit(5)
+		}
+
+		stats, err := tools.PullLibrary(d.root, d.peerDb, d.peerRoot, d.preferPeer)
+		if err != nil {
+			log.Fatal(err)
+			os.Exit(14)
+		}
+		log.Printf("%s: %d Songs added, %d replaced, %d playlists and %d plays updated\n",
+			d.root, stats.Added, stats.Replaced, stats.Playlists, stats.Plays)
+	}
+}
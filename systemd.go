@@ -0,0 +1,60 @@
+// Copyright 2016 Danko Miocevic. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Author: Danko Miocevic
+package main
+
+import (
+	"net"
+	"os"
+
+	"github.com/golang/glog"
+)
+
+// notifySocketEnv is the environment variable used by
+// systemd to pass the notification socket to the service.
+const notifySocketEnv = "NOTIFY_SOCKET"
+
+// underSystemd returns true if MuLi was started by
+// systemd as a Type=notify service.
+func underSystemd() bool {
+	return os.Getenv(notifySocketEnv) != ""
+}
+
+// sdNotify sends a state notification to systemd,
+// for example "READY=1" or "STOPPING=1".
+// It does nothing if MuLi was not started by systemd.
+func sdNotify(state string) {
+	socket := os.Getenv(notifySocketEnv)
+	if socket == "" {
+		return
+	}
+
+	// Abstract sockets start with @ in the environment.
+	if socket[0] == '@' {
+		socket = "\x00" + socket[1:]
+	}
+
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: socket, Net: "unixgram"})
+	if err != nil {
+		glog.Errorf("Cannot connect to systemd: %v\n", err)
+		return
+	}
+	defer conn.Close()
+
+	_, err = conn.Write([]byte(state))
+	if err != nil {
+		glog.Errorf("Cannot notify systemd: %v\n", err)
+	}
+}
@@ -0,0 +1,162 @@
+// Copyright 2016 Danko Miocevic. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Author: Danko Miocevic
+
+package tools
+
+import (
+	"database/sql"
+	"github.com/dankomiocevic/mulifs/musicmgr"
+	"github.com/dankomiocevic/mulifs/store"
+	"github.com/golang/glog"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// BeetsStats counts the Songs imported
+// from a beets library.
+type BeetsStats struct {
+	Songs   int
+	Covers  int
+	Missing []string
+}
+
+// beetsQuery obtains the items of the beets library
+// with the cover image of their Album.
+const beetsQuery = `SELECT i.path, IFNULL(i.title, ''), IFNULL(i.artist, ''),
+	IFNULL(i.album, ''), IFNULL(i.genre, ''), IFNULL(i.year, 0),
+	IFNULL(i.track, 0), IFNULL(i.composer, ''), IFNULL(i.bpm, 0),
+	IFNULL(i.initial_key, ''), IFNULL(i.mb_trackid, ''),
+	IFNULL(i.mb_albumid, ''), IFNULL(i.mb_artistid, ''), a.artpath
+	FROM items i LEFT JOIN albums a ON i.album_id = a.id`
+
+// beetsItem is a Song of the beets library.
+type beetsItem struct {
+	path    []byte
+	tags    musicmgr.FileTags
+	ids     store.MusicBrainzIDs
+	artPath []byte
+}
+
+// ImportBeetsLibrary stores the Songs of a beets library
+// database with the tags, the MusicBrainz identifiers and
+// the cover images of their Albums stored by beets, so the
+// tags of the files are not read.
+func ImportBeetsLibrary(path string) (BeetsStats, error) {
+	var stats BeetsStats
+	if _, err := os.Stat(path); err != nil {
+		return stats, err
+	}
+
+	db, err := sql.Open("sqlite3", "file:"+path+"?mode=ro")
+	if err != nil {
+		return stats, err
+	}
+	defer db.Close()
+
+	rows, err := db.Query(beetsQuery)
+	if err != nil {
+		return stats, err
+	}
+
+	var items []beetsItem
+	for rows.Next() {
+		var item beetsItem
+		var year, track, bpm int
+		err := rows.Scan(&item.path, &item.tags.Title, &item.tags.Artist, &item.tags.Album,
+			&item.tags.Genre, &year, &track, &item.tags.Composer, &bpm, &item.tags.Key,
+			&item.ids.Track, &item.ids.Album, &item.ids.Artist, &item.artPath)
+		if err != nil {
+			rows.Close()
+			return stats, err
+		}
+
+		if year > 0 {
+			item.tags.Year = strconv.Itoa(year)
+		}
+		if track > 0 {
+			item.tags.Track = strconv.Itoa(track)
+		}
+		if bpm > 0 {
+			item.tags.BPM = strconv.Itoa(bpm)
+		}
+		items = append(items, item)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return stats, err
+	}
+
+	covers := make(map[string]bool)
+	for _, item := range items {
+		songPath := string(item.path)
+		if !musicmgr.IsMusicFile(songPath) {
+			continue
+		}
+		if _, err := os.Stat(songPath); err != nil {
+			stats.Missing = append(stats.Missing, songPath)
+			continue
+		}
+
+		tags := item.tags
+		ext := filepath.Ext(songPath)
+		if len(tags.Title) < 1 {
+			tags.Title = strings.TrimSuffix(filepath.Base(songPath), ext)
+		}
+		if len(tags.Artist) < 1 {
+			tags.Artist = "unknown"
+		}
+		if len(tags.Album) < 1 {
+			tags.Album = "unknown"
+		}
+
+		glog.Infof("Importing %s\n", songPath)
+		if err := store.StoreNewSong(&tags, songPath); err != nil {
+			stats.Missing = append(stats.Missing, songPath)
+			continue
+		}
+		stats.Songs++
+
+		ref := store.SongRef{
+			Artist: store.GetCompatibleString(tags.Artist),
+			Album:  store.GetCompatibleString(tags.Album),
+			Song:   store.GetCompatibleString(tags.Title) + ext,
+		}
+		if err := store.SetMusicBrainzIDs(ref, item.ids); err != nil {
+			glog.Infof("Cannot store the MusicBrainz IDs of %s: %s\n", songPath, err)
+		}
+
+		artPath := string(item.artPath)
+		if len(artPath) < 1 || covers[ref.Artist+"/"+ref.Album] {
+			continue
+		}
+		if _, err := os.Stat(artPath); err != nil {
+			continue
+		}
+
+		covers[ref.Artist+"/"+ref.Album] = true
+		store.StoreArtwork(&tags, artPath)
+		artExt := strings.ToLower(filepath.Ext(artPath))
+		if artExt == ".jpg" || artExt == ".png" {
+			store.SetAlbumCover(&tags, artPath)
+		}
+		stats.Covers++
+	}
+	return stats, nil
+}
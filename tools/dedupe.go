@@ -0,0 +1,192 @@
+// Copyright 2016 Danko Miocevic. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Author: Danko Miocevic
+
+package tools
+
+import (
+	"bytes"
+	"github.com/dankomiocevic/mulifs/musicmgr"
+	"github.com/dankomiocevic/mulifs/store"
+	"github.com/golang/glog"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// DedupeStats counts the files replaced
+// with hard links and the space saved.
+type DedupeStats struct {
+	Linked int
+	Saved  int64
+}
+
+// sameContent compares two files byte by byte.
+func sameContent(a, b string) (bool, error) {
+	fa, err := os.Open(a)
+	if err != nil {
+		return false, err
+	}
+	defer fa.Close()
+
+	fb, err := os.Open(b)
+	if err != nil {
+		return false, err
+	}
+	defer fb.Close()
+
+	bufA := make([]byte, 64*1024)
+	bufB := make([]byte, 64*1024)
+	for {
+		na, errA := io.ReadFull(fa, bufA)
+		nb, errB := io.ReadFull(fb, bufB)
+		if na != nb || !bytes.Equal(bufA[:na], bufB[:nb]) {
+			return false, nil
+		}
+
+		if errA == io.EOF || errA == io.ErrUnexpectedEOF {
+			return errB == io.EOF || errB == io.ErrUnexpectedEOF, nil
+		}
+		if errA != nil {
+			return false, errA
+		}
+		if errB != nil {
+			return false, errB
+		}
+	}
+}
+
+// duplicateGroups returns the files with the same content
+// grouped by their checksum, the files in the database come
+// first in every group. The music files in the source
+// Directory that are not in the database are also added
+// if they have the same content as a Song.
+func duplicateGroups(root string) (map[string][]string, error) {
+	songs, err := store.ListSongInfo()
+	if err != nil {
+		return nil, err
+	}
+
+	groups := make(map[string][]string)
+	known := make(map[string]bool)
+	sizes := make(map[int64]bool)
+	for _, s := range songs {
+		if len(s.Checksum) < 1 {
+			store.VerifySong(s.SongRef, 0)
+			song, err := store.GetSong(s.Artist, s.Album, s.Song)
+			if err != nil || len(song.Checksum) < 1 {
+				continue
+			}
+			s.Checksum = song.Checksum
+		}
+
+		known[s.Path] = true
+		groups[s.Checksum] = append(groups[s.Checksum], s.Path)
+		if fi, err := os.Stat(s.Path); err == nil {
+			sizes[fi.Size()] = true
+		}
+	}
+
+	skip := map[string]bool{filepath.Join(root, "drop"): true, filepath.Join(root, "playlists"): true}
+	filepath.Walk(root, func(path string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return nil
+		}
+		if fi.IsDir() {
+			if skip[path] || store.IsIgnored(root, path) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		if known[path] || !musicmgr.IsMusicFile(path) || store.IsIgnored(root, path) || !sizes[fi.Size()] {
+			return nil
+		}
+
+		sum, err := store.FileChecksum(path)
+		if err == nil && len(groups[sum]) > 0 {
+			groups[sum] = append(groups[sum], path)
+		}
+		return nil
+	})
+	return groups, nil
+}
+
+// linkFile replaces the file with a hard link to
+// the original, the file is replaced atomically.
+func linkFile(original, path string) error {
+	tmp := path + ".link"
+	os.Remove(tmp)
+	err := os.Link(original, tmp)
+	if err != nil {
+		return err
+	}
+
+	err = os.Rename(tmp, path)
+	if err != nil {
+		os.Remove(tmp)
+	}
+	return err
+}
+
+// DedupeFiles replaces the music files in the source Directory
+// that have the same content with hard links to one of them.
+// The files are compared byte by byte before replacing them, and
+// the database is not modified since the paths do not change.
+// With dryRun the duplicates are only reported.
+func DedupeFiles(root string, dryRun bool) (DedupeStats, error) {
+	var stats DedupeStats
+	groups, err := duplicateGroups(root)
+	if err != nil {
+		return stats, err
+	}
+
+	for _, paths := range groups {
+		if len(paths) < 2 {
+			continue
+		}
+
+		original := paths[0]
+		originalInfo, err := os.Stat(original)
+		if err != nil {
+			continue
+		}
+
+		for _, path := range paths[1:] {
+			fi, err := os.Stat(path)
+			if err != nil || os.SameFile(originalInfo, fi) {
+				continue
+			}
+
+			same, err := sameContent(original, path)
+			if err != nil || !same {
+				glog.Infof("Skipping %s, it is not equal to %s\n", path, original)
+				continue
+			}
+
+			glog.Infof("Linking %s to %s\n", path, original)
+			if !dryRun {
+				err = linkFile(original, path)
+				if err != nil {
+					glog.Errorf("Cannot link %s: %s\n", path, err)
+					continue
+				}
+			}
+			stats.Linked++
+			stats.Saved += fi.Size()
+		}
+	}
+	return stats, nil
+}
@@ -0,0 +1,182 @@
+// Copyright 2016 Danko Miocevic. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Author: Danko Miocevic
+
+package tools
+
+import (
+	"github.com/dankomiocevic/mulifs/playlistmgr"
+	"github.com/dankomiocevic/mulifs/store"
+	"github.com/golang/glog"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"unicode"
+)
+
+// songIndex is used to find the Songs in the
+// Library from the entries of external playlists.
+type songIndex struct {
+	byPath  map[string]store.SongInfo
+	byName  map[string][]store.SongInfo
+	byTitle map[string][]store.SongInfo
+}
+
+// fuzzyName simplifies a name to compare it with
+// others ignoring the case, the extension and
+// every character that is not a letter or a number.
+func fuzzyName(name string) string {
+	name = strings.TrimSuffix(name, filepath.Ext(name))
+	name = strings.Replace(strings.ToLower(name), "&", "and", -1)
+	return strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			return r
+		}
+		return -1
+	}, name)
+}
+
+// newSongIndex indexes all the Songs in the Library.
+func newSongIndex() (*songIndex, error) {
+	songs, err := store.ListSongInfo()
+	if err != nil {
+		return nil, err
+	}
+
+	index := &songIndex{
+		byPath:  make(map[string]store.SongInfo),
+		byName:  make(map[string][]store.SongInfo),
+		byTitle: make(map[string][]store.SongInfo),
+	}
+	for _, s := range songs {
+		title := fuzzyName(s.Song)
+		index.byPath[filepath.Clean(s.Path)] = s
+		index.byName[fuzzyName(s.Artist)+"/"+title] = append(index.byName[fuzzyName(s.Artist)+"/"+title], s)
+		index.byTitle[title] = append(index.byTitle[title], s)
+	}
+	return index, nil
+}
+
+// resolve finds the Song of an external playlist entry.
+// The path is tried first, then the Artist and Title of
+// the entry and finally the names in its path
+// (Artist/Album/Title or "Artist - Title").
+func (index *songIndex) resolve(entry playlistmgr.ExternalEntry) (store.SongInfo, bool) {
+	if s, ok := index.byPath[filepath.Clean(entry.Path)]; ok {
+		return s, true
+	}
+
+	if len(entry.Title) > 0 {
+		if s, ok := index.find(entry.Artist, entry.Title); ok {
+			return s, true
+		}
+	}
+
+	name := filepath.Base(entry.Path)
+	artist, title := "", name
+	if items := strings.SplitN(name, " - ", 2); len(items) == 2 {
+		artist, title = items[0], items[1]
+	} else {
+		artist = filepath.Base(filepath.Dir(filepath.Dir(entry.Path)))
+	}
+
+	if s, ok := index.find(artist, title); ok {
+		return s, true
+	}
+	return index.find("", title)
+}
+
+// find returns the Song with the Artist and Title,
+// when the Artist is not known the Title must be unique.
+func (index *songIndex) find(artist, title string) (store.SongInfo, bool) {
+	title = fuzzyName(title)
+	if len(title) < 1 {
+		return store.SongInfo{}, false
+	}
+
+	if len(artist) > 0 {
+		songs := index.byName[fuzzyName(artist)+"/"+title]
+		if len(songs) > 0 {
+			return songs[0], true
+		}
+		return store.SongInfo{}, false
+	}
+
+	songs := index.byTitle[title]
+	if len(songs) == 1 {
+		return songs[0], true
+	}
+	return store.SongInfo{}, false
+}
+
+// ImportPlaylistFolder creates a playlist for every M3U and
+// PLS file found in the Directory, the entries are matched
+// with the Songs in the Library and the entries not found
+// are returned as "playlist: entry".
+func ImportPlaylistFolder(root, mPoint string) ([]string, error) {
+	files, err := ioutil.ReadDir(root)
+	if err != nil {
+		return nil, err
+	}
+
+	index, err := newSongIndex()
+	if err != nil {
+		return nil, err
+	}
+
+	var unresolved []string
+	for _, f := range files {
+		if f.IsDir() || !playlistmgr.IsExternalPlaylist(f.Name()) {
+			continue
+		}
+
+		name := strings.TrimSuffix(f.Name(), filepath.Ext(f.Name()))
+		if store.IsAutoPlaylist(store.PlaylistName(name)) {
+			glog.Infof("Skipping %s, the auto playlists are read only\n", f.Name())
+			continue
+		}
+
+		entries, err := playlistmgr.ReadExternalPlaylist(filepath.Join(root, f.Name()))
+		if err != nil {
+			glog.Infof("Problem reading playlist %s: %s\n", f.Name(), err)
+			unresolved = append(unresolved, f.Name()+": "+err.Error())
+			continue
+		}
+
+		playlist, err := store.CreatePlaylist(name, mPoint)
+		if err != nil {
+			return unresolved, err
+		}
+
+		for _, entry := range entries {
+			s, ok := index.resolve(entry)
+			if !ok {
+				unresolved = append(unresolved, f.Name()+": "+entry.Path)
+				continue
+			}
+
+			file := playlistmgr.PlaylistFile{Artist: s.Artist, Album: s.Album, Title: s.Song}
+			if err := store.AddFileToPlaylist(file, playlist); err != nil {
+				unresolved = append(unresolved, f.Name()+": "+entry.Path)
+			}
+		}
+
+		err = store.RegeneratePlaylistFile(playlist, mPoint)
+		if err != nil {
+			return unresolved, err
+		}
+	}
+	return unresolved, nil
+}
@@ -0,0 +1,97 @@
+// Copyright 2016 Danko Miocevic. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Author: Danko Miocevic
+
+package tools
+
+import (
+	"github.com/dankomiocevic/mulifs/store"
+	"github.com/golang/glog"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// mirrorManifest is the file stored in the mirror Directory
+// with the links created, only these links are deleted
+// when the Songs are removed.
+const mirrorManifest = ".mulifs-mirror"
+
+// mirrorLock avoids updating the mirror twice at once.
+var mirrorLock sync.Mutex
+
+// UpdateMirror keeps a Directory with a symbolic link to every
+// Song in the source Directory, named using the template like
+// the sync command. The links of the Songs removed since the
+// last update are deleted and the links that point to another
+// file are replaced.
+// It returns the number of links created or replaced.
+func UpdateMirror(target, template string) (int, error) {
+	mirrorLock.Lock()
+	defer mirrorLock.Unlock()
+
+	if len(template) < 1 {
+		template = DefaultSyncTemplate
+	}
+
+	err := os.MkdirAll(target, 0755)
+	if err != nil {
+		return 0, err
+	}
+
+	songs, err := store.ListSongInfo()
+	if err != nil {
+		return 0, err
+	}
+
+	opts := SyncOptions{Template: template}
+	current := make(map[string]bool)
+	var files []string
+	linked := 0
+	for _, s := range songs {
+		name := syncName(s, opts)
+		if current[name] {
+			glog.Infof("Skipping %s, the name is already used\n", s.Path)
+			continue
+		}
+		current[name] = true
+		files = append(files, name)
+
+		link := filepath.Join(target, name)
+		if dst, err := os.Readlink(link); err == nil && dst == s.Path {
+			continue
+		}
+
+		if err := os.MkdirAll(filepath.Dir(link), 0755); err != nil {
+			return linked, err
+		}
+
+		// The link is replaced atomically, so the
+		// devices never find the Song missing.
+		tmp := link + ".part"
+		os.Remove(tmp)
+		if err := os.Symlink(s.Path, tmp); err != nil {
+			return linked, err
+		}
+		if err := os.Rename(tmp, link); err != nil {
+			os.Remove(tmp)
+			return linked, err
+		}
+		linked++
+	}
+
+	removeStale(target, readManifest(target, mirrorManifest), current)
+	return linked, writeManifest(target, mirrorManifest, files)
+}
@@ -0,0 +1,67 @@
+// Copyright 2016 Danko Miocevic. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Author: Danko Miocevic
+
+package tools
+
+import (
+	"github.com/dankomiocevic/mulifs/musicmgr"
+	"github.com/dankomiocevic/mulifs/store"
+	"os"
+	"path/filepath"
+)
+
+// NormalizeChange is a music file with the
+// tags changed by the normalization rules.
+type NormalizeChange struct {
+	Path   string
+	Before musicmgr.FileTags
+	After  musicmgr.FileTags
+}
+
+// NormalizeReport returns the music files in the source
+// Directory whose tags are changed by the path patterns
+// or the normalization rules, without modifying anything.
+func NormalizeReport(root string) ([]NormalizeChange, error) {
+	var changes []NormalizeChange
+	skip := map[string]bool{
+		filepath.Join(root, "drop"):      true,
+		filepath.Join(root, "playlists"): true,
+		filepath.Join(root, "podcasts"):  true,
+	}
+	err := filepath.Walk(root, func(path string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return nil
+		}
+		if fi.IsDir() {
+			if skip[path] || store.IsIgnored(root, path) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		if !musicmgr.IsMusicFile(path) || store.IsIgnored(root, path) {
+			return nil
+		}
+
+		_, before := musicmgr.GetRawTags(path)
+		_, after := musicmgr.GetTags(path)
+		if before.Title != after.Title || before.Artist != after.Artist || before.Album != after.Album {
+			changes = append(changes, NormalizeChange{Path: path, Before: before, After: after})
+		}
+		return nil
+	})
+	return changes, err
+}
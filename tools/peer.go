@@ -0,0 +1,190 @@
+// Copyright 2016 Danko Miocevic. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Author: Danko Miocevic
+
+package tools
+
+import (
+	"github.com/dankomiocevic/mulifs/musicmgr"
+	"github.com/dankomiocevic/mulifs/playlistmgr"
+	"github.com/dankomiocevic/mulifs/store"
+	"github.com/golang/glog"
+	"os"
+	"path/filepath"
+)
+
+// PullStats counts the changes done
+// when pulling from another library.
+type PullStats struct {
+	Added     int
+	Replaced  int
+	Playlists int
+	Plays     int
+}
+
+// peerSongPath returns the path of a Song of the other
+// library, it is searched in the Directory of its Album
+// first since the library can be mounted in another path.
+func peerSongPath(s store.PeerSong, peerRoot string) string {
+	path := filepath.Join(peerRoot, s.Artist, s.Album, s.Store.SongPath)
+	if _, err := os.Stat(path); err == nil {
+		return path
+	}
+	return s.Store.SongFullPath
+}
+
+// isNewer returns true if the source file was
+// modified after the destination file.
+func isNewer(src, dst string) bool {
+	srcInfo, err := os.Stat(src)
+	if err != nil {
+		return false
+	}
+
+	dstInfo, err := os.Stat(dst)
+	if err != nil {
+		return true
+	}
+
+	if srcInfo.Size() == dstInfo.Size() && srcInfo.ModTime().Equal(dstInfo.ModTime()) {
+		return false
+	}
+	return srcInfo.ModTime().After(dstInfo.ModTime())
+}
+
+// pullSongs copies the Songs that are missing in
+// this library and the ones modified in the other.
+func pullSongs(peer *store.PeerLibrary, root, peerRoot string, stats *PullStats) error {
+	for _, s := range peer.Songs {
+		src := peerSongPath(s, peerRoot)
+		local, err := store.GetSong(s.Artist, s.Album, s.Song)
+		if err == nil {
+			if !isNewer(src, local.SongFullPath) {
+				continue
+			}
+
+			glog.Infof("Replacing %s with %s\n", local.SongFullPath, src)
+			err = copySong(syncFile{src: src, dst: local.SongFullPath}, false)
+			if err != nil {
+				return err
+			}
+			store.RefreshSongInfo(s.Artist, s.Album, s.Song, local.SongFullPath)
+			stats.Replaced++
+			continue
+		}
+
+		if _, err := os.Stat(src); err != nil {
+			glog.Infof("Song %s not found in the other library\n", src)
+			continue
+		}
+
+		dst := filepath.Join(root, s.Artist, s.Album, s.Song)
+		glog.Infof("Copying %s to %s\n", src, dst)
+		err = copySong(syncFile{src: src, dst: dst}, false)
+		if err != nil {
+			return err
+		}
+
+		tags := musicmgr.FileTags{
+			Title:     s.Store.SongName,
+			Artist:    s.ArtistName,
+			Album:     s.AlbumName,
+			Genre:     s.Store.Genre,
+			Year:      s.Store.Year,
+			Composer:  s.Store.Composer,
+			Work:      s.Store.Work,
+			Conductor: s.Store.Conductor,
+			BPM:       s.Store.BPM,
+			Key:       s.Store.Key,
+			Track:     s.Store.Track,
+		}
+		err = store.StoreNewSong(&tags, dst)
+		if err != nil {
+			return err
+		}
+		stats.Added++
+	}
+	return nil
+}
+
+// pullPlaylists adds the Songs of the playlists of the
+// other library. When both libraries have a Song with the
+// same name in a playlist the one from the other library
+// is used only if preferPeer is true.
+func pullPlaylists(peer *store.PeerLibrary, root string, preferPeer bool, stats *PullStats) error {
+	for name, files := range peer.Playlists {
+		local := make(map[string]playlistmgr.PlaylistFile)
+		existing, err := store.GetPlaylistFiles(name)
+		if err != nil {
+			name, err = store.CreatePlaylist(name, root)
+			if err != nil {
+				return err
+			}
+		}
+		for _, f := range existing {
+			local[f.Title] = f
+		}
+
+		changed := false
+		for _, f := range files {
+			l, ok := local[f.Title]
+			if ok && (!preferPeer || (l.Artist == f.Artist && l.Album == f.Album)) {
+				continue
+			}
+
+			err = store.AddFileToPlaylist(playlistmgr.PlaylistFile{Artist: f.Artist, Album: f.Album, Title: f.Title}, name)
+			if err != nil {
+				glog.Infof("Cannot add %s to playlist %s: %s\n", f.Title, name, err)
+				continue
+			}
+			changed = true
+		}
+
+		if changed || len(existing) < 1 {
+			stats.Playlists++
+			err = store.RegeneratePlaylistFile(name, root)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// PullLibrary brings the changes of another MuLi library into
+// this one: the missing Songs are copied, the Songs modified
+// in the other library replace the older ones, and the playlists
+// and plays are merged. Nothing is deleted, so pulling in both
+// directions leaves both libraries with the same Songs.
+func PullLibrary(root, peerDb, peerRoot string, preferPeer bool) (PullStats, error) {
+	var stats PullStats
+	peer, err := store.ReadPeerLibrary(peerDb)
+	if err != nil {
+		return stats, err
+	}
+
+	err = pullSongs(peer, root, peerRoot, &stats)
+	if err != nil {
+		return stats, err
+	}
+
+	err = pullPlaylists(peer, root, preferPeer, &stats)
+	if err != nil {
+		return stats, err
+	}
+
+	stats.Plays, err = store.ImportPlays(peer.Plays)
+	return stats, err
+}
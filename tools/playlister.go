@@ -26,18 +26,25 @@ import (
 	"github.com/golang/glog"
 	"io/ioutil"
 	"os"
+	"path"
 	"strings"
 )
 
 // visitPlaylist checks that the specified file is
 // a music file and is on the correct path.
-// If it is ok, it stores it on the database.
-func visitPlaylist(name, path, mPoint string) error {
+// If it is ok, it stores it on the database
+// inside the playlist folder.
+func visitPlaylist(name, path, folder, mPoint string) error {
 	if path[len(path)-1] != '/' {
 		path = path + "/"
 	}
 
+	// The auto playlists are generated again after the scan.
 	fullPath := path + name
+	if store.IsAutoPlaylist(name) {
+		return nil
+	}
+
 	if strings.HasSuffix(fullPath, ".m3u") {
 		glog.Infof("Reading %s\n", fullPath)
 		err := playlistmgr.CheckPlaylistFile(fullPath)
@@ -59,6 +66,11 @@ func visitPlaylist(name, path, mPoint string) error {
 			store.AddFileToPlaylist(f, playlistName)
 		}
 
+		err = store.MovePlaylist(playlistName, folder, mPoint)
+		if err != nil {
+			glog.Infof("Cannot move playlist %s to %s: %s\n", playlistName, folder, err)
+		}
+
 		os.Remove(fullPath)
 		store.RegeneratePlaylistFile(playlistName, mPoint)
 	}
@@ -74,12 +86,20 @@ func ScanPlaylistFolder(root string) error {
 		root = root + "/"
 	}
 
-	fullPath := root + "playlists/"
+	scanPlaylistFolder(root+"playlists/", "", root)
+	return nil
+}
+
+// scanPlaylistFolder reads the playlist files inside the
+// Directory and its SubDirectories, the SubDirectories
+// are the playlist folders.
+func scanPlaylistFolder(fullPath, folder, root string) {
 	files, _ := ioutil.ReadDir(fullPath)
 	for _, f := range files {
-		if !f.IsDir() {
-			visitPlaylist(f.Name(), fullPath, root)
+		if f.IsDir() {
+			scanPlaylistFolder(fullPath+f.Name()+"/", path.Join(folder, f.Name()), root)
+		} else {
+			visitPlaylist(f.Name(), fullPath, folder, root)
 		}
 	}
-	return nil
 }
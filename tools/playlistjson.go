@@ -0,0 +1,166 @@
+// Copyright 2016 Danko Miocevic. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Author: Danko Miocevic
+
+package tools
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/dankomiocevic/mulifs/playlistmgr"
+	"github.com/dankomiocevic/mulifs/store"
+	"io"
+)
+
+// PortableVersion is the version of the
+// portable playlist format.
+const PortableVersion = 1
+
+// PortableEntry identifies a Song of a portable playlist
+// without its path, by its MusicBrainz identifier and
+// checksum with its tags as a fallback.
+type PortableEntry struct {
+	MusicBrainzID string `json:",omitempty"`
+	Checksum      string `json:",omitempty"`
+	Artist        string
+	Album         string `json:",omitempty"`
+	Title         string
+	Duration      int `json:",omitempty"`
+}
+
+// PortablePlaylist is a playlist that can be moved
+// between MuLi instances whose files are stored
+// in different paths.
+type PortablePlaylist struct {
+	Version int
+	Name    string
+	Entries []PortableEntry
+}
+
+// ExportPlaylist returns the portable
+// version of a playlist.
+func ExportPlaylist(name string) (PortablePlaylist, error) {
+	playlist := PortablePlaylist{Version: PortableVersion, Name: name}
+	if store.IsAutoPlaylist(store.PlaylistName(name)) {
+		return playlist, errors.New("The auto playlists cannot be exported.")
+	}
+
+	files, err := store.GetPlaylistFiles(store.PlaylistName(name))
+	if err != nil {
+		return playlist, err
+	}
+
+	for _, f := range files {
+		entry := PortableEntry{
+			MusicBrainzID: f.MusicBrainzID,
+			Artist:        f.Artist,
+			Album:         f.Album,
+			Title:         f.Title,
+		}
+
+		if s, err := store.GetSong(f.Artist, f.Album, f.Title); err == nil {
+			entry.Title = s.SongName
+			entry.Checksum = s.Checksum
+			entry.Duration = s.Duration
+			if len(s.MusicBrainzID) > 0 {
+				entry.MusicBrainzID = s.MusicBrainzID
+			}
+		}
+		playlist.Entries = append(playlist.Entries, entry)
+	}
+	return playlist, nil
+}
+
+// WritePortablePlaylist writes a portable playlist as JSON.
+func WritePortablePlaylist(w io.Writer, playlist PortablePlaylist) error {
+	data, err := json.MarshalIndent(playlist, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	_, err = w.Write(append(data, '\n'))
+	return err
+}
+
+// ImportPlaylist reads a portable playlist and creates it in
+// MuLi with the name given or the one stored in the file.
+// The entries are matched with the Songs in the Library by
+// their MusicBrainz identifier, their checksum and finally
+// their Artist and Title. The entries not found are returned.
+func ImportPlaylist(r io.Reader, name, mPoint string) (string, []string, error) {
+	var playlist PortablePlaylist
+	if err := json.NewDecoder(r).Decode(&playlist); err != nil {
+		return "", nil, err
+	}
+
+	if playlist.Version > PortableVersion {
+		return "", nil, errors.New("Unknown portable playlist version.")
+	}
+
+	if len(name) < 1 {
+		name = playlist.Name
+	}
+	if len(name) < 1 {
+		return "", nil, errors.New("The playlist has no name.")
+	}
+	if store.IsAutoPlaylist(store.PlaylistName(name)) {
+		return "", nil, errors.New("The auto playlists are read only.")
+	}
+
+	index, err := newSongIndex()
+	if err != nil {
+		return "", nil, err
+	}
+
+	byID := make(map[string]store.SongInfo)
+	byChecksum := make(map[string]store.SongInfo)
+	for _, s := range index.byPath {
+		if len(s.MusicBrainzID) > 0 {
+			byID[s.MusicBrainzID] = s
+		}
+		if len(s.Checksum) > 0 {
+			byChecksum[s.Checksum] = s
+		}
+	}
+
+	name, err = store.CreatePlaylist(name, mPoint)
+	if err != nil {
+		return "", nil, err
+	}
+
+	var unresolved []string
+	for _, entry := range playlist.Entries {
+		s, ok := byID[entry.MusicBrainzID]
+		if !ok {
+			s, ok = byChecksum[entry.Checksum]
+		}
+		if !ok {
+			s, ok = index.find(entry.Artist, entry.Title)
+		}
+
+		description := entry.Artist + " - " + entry.Title
+		if !ok {
+			unresolved = append(unresolved, description)
+			continue
+		}
+
+		file := playlistmgr.PlaylistFile{Artist: s.Artist, Album: s.Album, Title: s.Song}
+		if err := store.AddFileToPlaylist(file, name); err != nil {
+			unresolved = append(unresolved, description)
+		}
+	}
+
+	return name, unresolved, store.RegeneratePlaylistFile(name, mPoint)
+}
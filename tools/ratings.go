@@ -0,0 +1,359 @@
+// Copyright 2016 Danko Miocevic. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Author: Danko Miocevic
+
+package tools
+
+import (
+	"encoding/csv"
+	"encoding/xml"
+	"errors"
+	"github.com/dankomiocevic/mulifs/playlistmgr"
+	"github.com/dankomiocevic/mulifs/store"
+	"github.com/golang/glog"
+	"io"
+	"io/ioutil"
+	"math"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// RatedSong is a Song of the library of another music
+// player with its rating and play count.
+type RatedSong struct {
+	playlistmgr.ExternalEntry
+	store.SongStats
+}
+
+// RatingsStats counts the Songs imported
+// from another music player.
+type RatingsStats struct {
+	Updated    int
+	Unresolved []string
+}
+
+// mediaMonkeyDates are the formats of the
+// dates in the MediaMonkey exports.
+var mediaMonkeyDates = []string{
+	"2006-01-02 15:04:05",
+	"2006-01-02 15:04",
+	"2006-01-02",
+	"1/2/2006 3:04:05 PM",
+	"1/2/2006 3:04 PM",
+	"1/2/2006",
+	"2.1.2006 15:04:05",
+	"2.1.2006",
+	time.RFC3339,
+}
+
+// starRating converts a rating to stars, the ratings from
+// 0 to 100 used by iTunes and MediaMonkey are divided by 20.
+func starRating(rating float64) int {
+	if rating > 5 {
+		rating = rating / 20
+	}
+	stars := int(math.Floor(rating + 0.5))
+	if stars > 5 {
+		return 5
+	}
+	if stars < 0 {
+		return 0
+	}
+	return stars
+}
+
+// fileURLPath returns the path of a file URL
+// like the locations of the iTunes library.
+func fileURLPath(location string) string {
+	u, err := url.Parse(location)
+	if err != nil || u.Scheme != "file" {
+		return location
+	}
+
+	path := u.Path
+	// Windows paths like file://localhost/C:/Music.
+	if len(path) > 2 && path[0] == '/' && path[2] == ':' {
+		path = path[1:]
+	}
+	return path
+}
+
+// plistValue reads the value of a property list element.
+// The dictionaries are returned as maps and the arrays as
+// slices, the other values as strings.
+func plistValue(dec *xml.Decoder, start xml.StartElement) (interface{}, error) {
+	switch start.Name.Local {
+	case "dict":
+		dict := make(map[string]interface{})
+		key := ""
+		for {
+			token, err := dec.Token()
+			if err != nil {
+				return nil, err
+			}
+
+			switch t := token.(type) {
+			case xml.StartElement:
+				if t.Name.Local == "key" {
+					if err := dec.DecodeElement(&key, &t); err != nil {
+						return nil, err
+					}
+					continue
+				}
+
+				value, err := plistValue(dec, t)
+				if err != nil {
+					return nil, err
+				}
+				dict[key] = value
+			case xml.EndElement:
+				return dict, nil
+			}
+		}
+	case "array":
+		var array []interface{}
+		for {
+			token, err := dec.Token()
+			if err != nil {
+				return nil, err
+			}
+
+			switch t := token.(type) {
+			case xml.StartElement:
+				value, err := plistValue(dec, t)
+				if err != nil {
+					return nil, err
+				}
+				array = append(array, value)
+			case xml.EndElement:
+				return array, nil
+			}
+		}
+	case "true", "false":
+		return start.Name.Local, dec.Skip()
+	}
+
+	var value string
+	err := dec.DecodeElement(&value, &start)
+	return value, err
+}
+
+// plistString returns a string of a property list dictionary.
+func plistString(dict map[string]interface{}, key string) string {
+	value, _ := dict[key].(string)
+	return value
+}
+
+// ParseITunesLibrary reads the ratings and play counts of
+// the Songs of an iTunes Library.xml file.
+func ParseITunesLibrary(r io.Reader) ([]RatedSong, error) {
+	dec := xml.NewDecoder(r)
+	var library map[string]interface{}
+	for library == nil {
+		token, err := dec.Token()
+		if err == io.EOF {
+			return nil, errors.New("Wrong iTunes library.")
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		if t, ok := token.(xml.StartElement); ok && t.Name.Local == "dict" {
+			value, err := plistValue(dec, t)
+			if err != nil {
+				return nil, err
+			}
+			library = value.(map[string]interface{})
+		}
+	}
+
+	tracks, ok := library["Tracks"].(map[string]interface{})
+	if !ok {
+		return nil, errors.New("Wrong iTunes library.")
+	}
+
+	var songs []RatedSong
+	for _, v := range tracks {
+		track, ok := v.(map[string]interface{})
+		if !ok {
+			continue
+		}
+
+		var s RatedSong
+		s.Path = fileURLPath(plistString(track, "Location"))
+		s.Artist = plistString(track, "Artist")
+		s.Title = plistString(track, "Name")
+		// The ratings computed from the Album
+		// are not set by the user.
+		if plistString(track, "Rating Computed") != "true" {
+			rating, _ := strconv.ParseFloat(plistString(track, "Rating"), 64)
+			s.Rating = starRating(rating)
+		}
+		s.PlayCount, _ = strconv.Atoi(plistString(track, "Play Count"))
+		s.LastPlayed, _ = time.Parse(time.RFC3339, plistString(track, "Play Date UTC"))
+		songs = append(songs, s)
+	}
+	return songs, nil
+}
+
+// mediaMonkeyColumns are the names of the columns of
+// the MediaMonkey exports, in lower case.
+var mediaMonkeyColumns = map[string][]string{
+	"path":   {"path", "filename", "file name", "location"},
+	"artist": {"artist", "track artist"},
+	"title":  {"title", "name"},
+	"rating": {"rating"},
+	"plays":  {"played #", "play count", "playcount", "plays", "#played"},
+	"last":   {"last played", "lastplayed", "last time played"},
+}
+
+// ParseMediaMonkeyExport reads the ratings and play counts
+// of the Songs of a MediaMonkey CSV export. The columns are
+// found by their names in the first line and they can be
+// separated by commas, semicolons or tabs.
+func ParseMediaMonkeyExport(r io.Reader) ([]RatedSong, error) {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	text := strings.TrimPrefix(string(data), "\ufeff")
+	header := text
+	if i := strings.IndexByte(text, '\n'); i >= 0 {
+		header = text[:i]
+	}
+
+	reader := csv.NewReader(strings.NewReader(text))
+	reader.FieldsPerRecord = -1
+	reader.LazyQuotes = true
+	for _, sep := range []rune{'\t', ';'} {
+		if strings.Count(header, string(sep)) > strings.Count(header, string(reader.Comma)) {
+			reader.Comma = sep
+		}
+	}
+
+	names, err := reader.Read()
+	if err != nil {
+		return nil, err
+	}
+
+	columns := make(map[string]int)
+	for i, name := range names {
+		name = strings.ToLower(strings.TrimSpace(name))
+		for column, aliases := range mediaMonkeyColumns {
+			for _, alias := range aliases {
+				if _, ok := columns[column]; !ok && name == alias {
+					columns[column] = i
+				}
+			}
+		}
+	}
+	if _, ok := columns["title"]; !ok {
+		if _, ok := columns["path"]; !ok {
+			return nil, errors.New("The path or title column is required.")
+		}
+	}
+
+	field := func(record []string, column string) string {
+		i, ok := columns[column]
+		if !ok || i >= len(record) {
+			return ""
+		}
+		return strings.TrimSpace(record[i])
+	}
+
+	var songs []RatedSong
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		var s RatedSong
+		s.Path = field(record, "path")
+		s.Artist = field(record, "artist")
+		s.Title = field(record, "title")
+		rating, _ := strconv.ParseFloat(strings.Replace(field(record, "rating"), ",", ".", 1), 64)
+		s.Rating = starRating(rating)
+		s.PlayCount, _ = strconv.Atoi(field(record, "plays"))
+		for _, layout := range mediaMonkeyDates {
+			t, err := time.ParseInLocation(layout, field(record, "last"), time.Local)
+			if err == nil {
+				s.LastPlayed = t
+				break
+			}
+		}
+		songs = append(songs, s)
+	}
+	return songs, nil
+}
+
+// ImportRatings stores the ratings and play counts of the
+// library of another music player, an iTunes Library.xml
+// file or a MediaMonkey CSV export. The Songs are matched
+// by their path or by their Artist and Title.
+func ImportRatings(path string) (RatingsStats, error) {
+	var stats RatingsStats
+	f, err := os.Open(path)
+	if err != nil {
+		return stats, err
+	}
+	defer f.Close()
+
+	var songs []RatedSong
+	if strings.ToLower(filepath.Ext(path)) == ".xml" {
+		songs, err = ParseITunesLibrary(f)
+	} else {
+		songs, err = ParseMediaMonkeyExport(f)
+	}
+	if err != nil {
+		return stats, err
+	}
+
+	index, err := newSongIndex()
+	if err != nil {
+		return stats, err
+	}
+
+	for _, s := range songs {
+		if s.Rating < 1 && s.PlayCount < 1 {
+			continue
+		}
+
+		song, ok := index.resolve(s.ExternalEntry)
+		if !ok {
+			name := s.Path
+			if len(s.Title) > 0 {
+				name = s.Artist + " - " + s.Title
+			}
+			stats.Unresolved = append(stats.Unresolved, name)
+			continue
+		}
+
+		if err := store.SetSongStats(song.SongRef, s.SongStats); err != nil {
+			return stats, err
+		}
+		stats.Updated++
+	}
+	glog.Infof("%d Songs updated from %s\n", stats.Updated, path)
+	return stats, nil
+}
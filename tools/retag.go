@@ -0,0 +1,135 @@
+// Copyright 2016 Danko Miocevic. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Author: Danko Miocevic
+
+package tools
+
+import (
+	"errors"
+	"github.com/dankomiocevic/mulifs/store"
+	"github.com/golang/glog"
+	"golang.org/x/net/context"
+	"strconv"
+	"strings"
+)
+
+// RetagFilter selects the Songs changed by RetagSongs,
+// the names are compared ignoring the case and the
+// empty fields match every Song.
+type RetagFilter struct {
+	Artist string
+	Album  string
+	Title  string
+	Genre  string
+	Year   string
+}
+
+// RetagChanges are the new names of the Songs,
+// the empty fields are not changed.
+type RetagChanges struct {
+	Artist string
+	Album  string
+	Title  string
+}
+
+// RetagResult is a Song changed by RetagSongs with
+// its new names and the error if it failed.
+type RetagResult struct {
+	Song   store.SongNames
+	Artist string
+	Album  string
+	Title  string
+	Err    error
+}
+
+// empty returns true if the filter matches every Song.
+func (f RetagFilter) empty() bool {
+	return f == RetagFilter{}
+}
+
+// matchName returns true if the filter is
+// empty or it is equal to the name.
+func matchName(filter, name string) bool {
+	return len(filter) < 1 || strings.EqualFold(strings.TrimSpace(filter), strings.TrimSpace(name))
+}
+
+// match returns true if the Song matches the filter.
+func (f RetagFilter) match(s store.SongNames) bool {
+	return matchName(f.Artist, s.ArtistName) && matchName(f.Album, s.AlbumName) &&
+		matchName(f.Title, s.Title) && matchName(f.Genre, s.Genre) && matchName(f.Year, s.Year)
+}
+
+// RetagSongs changes the names of all the Songs that match
+// the filter, updating the database, the tags and moving the
+// files to their new Directories in the source Directory.
+// With dryRun the changes are only returned.
+// The Title can only be changed for a single Song.
+func RetagSongs(root string, filter RetagFilter, changes RetagChanges, dryRun bool) ([]RetagResult, error) {
+	if filter.empty() {
+		return nil, errors.New("At least one filter is needed.")
+	}
+
+	songs, err := store.ListSongNames()
+	if err != nil {
+		return nil, err
+	}
+
+	var results []RetagResult
+	for _, s := range songs {
+		if !filter.match(s) {
+			continue
+		}
+
+		r := RetagResult{Song: s, Artist: s.ArtistName, Album: s.AlbumName, Title: s.Title}
+		if len(changes.Artist) > 0 {
+			r.Artist = changes.Artist
+		}
+		if len(changes.Album) > 0 {
+			r.Album = changes.Album
+		}
+		if len(changes.Title) > 0 {
+			r.Title = changes.Title
+		}
+		results = append(results, r)
+	}
+
+	if len(changes.Title) > 0 && len(results) > 1 {
+		return nil, errors.New("The title can only be changed for a single Song.")
+	}
+
+	if dryRun {
+		return results, nil
+	}
+
+	record := store.UndoRecord{Op: store.UndoRetag, Name: strconv.Itoa(len(results)) + " Songs"}
+	for i, r := range results {
+		glog.Infof("Retagging %s/%s/%s\n", r.Song.Artist, r.Song.Album, r.Song.Song)
+		store.ThrottleOp()
+		var ref store.SongRef
+		ref, results[i].Err = store.RetagSong(context.Background(), r.Song.SongRef, r.Artist, r.Album, r.Title, root)
+		if results[i].Err == nil {
+			record.Songs = append(record.Songs, store.UndoSong{SongRef: ref, ArtistName: r.Song.ArtistName,
+				AlbumName: r.Song.AlbumName, Title: r.Song.Title})
+		}
+	}
+
+	// The retag can be undone with the undo command.
+	if len(record.Songs) > 0 {
+		if err := store.SetUndo(record); err != nil {
+			glog.Errorf("Cannot store the undo of the retag: %s\n", err)
+		}
+	}
+	return results, nil
+}
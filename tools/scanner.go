@@ -21,41 +21,359 @@
 package tools
 
 import (
+	"fmt"
 	"github.com/dankomiocevic/mulifs/musicmgr"
 	"github.com/dankomiocevic/mulifs/store"
 	"github.com/golang/glog"
 	"os"
 	"path/filepath"
 	"strings"
+	"time"
 )
 
+// extraFiles are the patterns of the non music files
+// stored with the Albums found in the same Directory
+// and artworkFiles the patterns of the cover images.
+var extraFiles []string
+var artworkFiles []string
+var artistFiles []string
+
+// albumDirs keeps the tags of the last music file
+// found in every Directory while scanning, extraDirs
+// and artworkDirs the files found in them.
+var albumDirs map[string]musicmgr.FileTags
+var extraDirs map[string][]string
+var artworkDirs map[string][]string
+var artistDirs map[string]string
+
+// checkMp3 and repairMp3 define if the MP3 files are
+// checked for corrupt frames while scanning and if the
+// garbage before their first frame is removed.
+var checkMp3 bool
+var repairMp3 bool
+
+// SetCheckMp3 defines if the MP3 files are checked while
+// scanning and if the safe repairs are done on them.
+func SetCheckMp3(check, repair bool) {
+	checkMp3 = check || repair
+	repairMp3 = repair
+}
+
+// snapshots is the number of snapshots of the
+// index kept after the scans, 0 disables them.
+var snapshots int
+
+// SetSnapshots sets the number of snapshots of
+// the index kept after the scans.
+func SetSnapshots(keep int) {
+	snapshots = keep
+}
+
+// tombstones defines if the tombstones of the Songs
+// whose files are missing are kept after the scans.
+var tombstones bool
+
+// SetTombstones defines if the tombstones of the Songs
+// whose files are missing are kept after the scans.
+func SetTombstones(enabled bool) {
+	tombstones = enabled
+}
+
+// report keeps the files skipped or failed
+// while scanning with the reasons.
+var report []store.ReportEntry
+
+// skipFile adds a file to the scan report.
+func skipFile(path, format string, args ...interface{}) {
+	reason := fmt.Sprintf(format, args...)
+	glog.Errorf("Skipping %s: %s\n", path, reason)
+	report = append(report, store.ReportEntry{Path: path, Reason: reason})
+}
+
+// SetExtraFiles sets the patterns of the extra
+// files to store while scanning.
+func SetExtraFiles(patterns []string) {
+	extraFiles = patterns
+}
+
+// SetArtworkFiles sets the patterns of the
+// cover images to store while scanning.
+func SetArtworkFiles(patterns []string) {
+	artworkFiles = patterns
+}
+
+// SetArtistFiles sets the patterns of the
+// Artist images to store while scanning.
+func SetArtistFiles(patterns []string) {
+	artistFiles = patterns
+}
+
+// matchFile returns true if the file name matches any
+// of the patterns, the case of the name is ignored.
+func matchFile(patterns []string, path string) bool {
+	_, name := filepath.Split(path)
+	name = strings.ToLower(name)
+	for _, p := range patterns {
+		if ok, _ := filepath.Match(strings.ToLower(p), name); ok {
+			return true
+		}
+	}
+	return false
+}
+
 // visit checks that the specified file is
 // a music file and is on the correct path.
 // If it is ok, it stores it on the database.
 func visit(path string, f os.FileInfo, err error) error {
-	if strings.HasSuffix(path, ".mp3") {
+	if err != nil {
+		skipFile(path, "Cannot read the file: %s", err)
+		return nil
+	}
+
+	if f != nil && !f.IsDir() {
+		dir := filepath.Dir(path)
+		if matchFile(artistFiles, path) {
+			artistDirs[dir] = path
+		} else if matchFile(artworkFiles, path) {
+			artworkDirs[dir] = append(artworkDirs[dir], path)
+		} else if matchFile(extraFiles, path) {
+			extraDirs[dir] = append(extraDirs[dir], path)
+		} else if !musicmgr.IsMusicFile(path) && !musicmgr.IsTagSidecar(path) {
+			skipFile(path, "Not a music file.")
+		}
+	}
+
+	if musicmgr.IsMusicFile(path) {
+		if err := musicmgr.CheckMusicSize(path); err != nil {
+			skipFile(path, "%s", err)
+			return nil
+		}
+
+		store.ThrottleOp()
+		if checkMp3 && strings.ToLower(filepath.Ext(path)) == ".mp3" {
+			if f != nil {
+				store.ThrottleBytes(f.Size())
+			}
+			checkMp3File(path)
+		}
+
 		glog.Infof("Reading %s\n", path)
-		err, f := musicmgr.GetMp3Tags(path)
+		err, f := musicmgr.GetTags(path)
 		if err != nil {
-			glog.Errorf("Error in %s\n", path)
+			skipFile(path, "Cannot read the tags, the default tags are used: %s", err)
 		}
-		if f.Artist == "drop" {
-			glog.Errorf("Error in %s\n", path)
+		if f.Artist == "drop" || f.Artist == "playlists" {
+			skipFile(path, "The Artist name %s is reserved.", f.Artist)
 		}
-		if f.Artist == "playlists" {
-			glog.Errorf("Error in %s\n", path)
+
+		// The FLAC album images are stored track by track.
+		if strings.ToLower(filepath.Ext(path)) == ".flac" {
+			tracks, err := musicmgr.GetFlacTracks(path)
+			if err == nil && len(tracks) > 1 {
+				storeAlbumTracks(path, f, tracks)
+				albumDirs[filepath.Dir(path)] = f
+				return nil
+			}
 		}
-		store.StoreNewSong(&f, path)
+
+		err = store.StoreNewSong(&f, path)
+		if err != nil {
+			skipFile(path, "Cannot store the Song: %s", err)
+			return nil
+		}
+		albumDirs[filepath.Dir(path)] = f
 	}
 	return nil
 }
 
+// storeAlbumTracks stores every track of the cue
+// sheet of a FLAC album image as a Song, the
+// performer of the track is used as its Artist.
+func storeAlbumTracks(path string, album musicmgr.FileTags, tracks []musicmgr.FlacTrack) {
+	for _, t := range tracks {
+		tags := album
+		tags.Title = t.Title
+		if len(t.Performer) > 0 {
+			tags.Artist = t.Performer
+		}
+
+		err := store.StoreNewSong(&tags, path)
+		if err == nil {
+			err = store.SetAlbumTrack(&tags, path, t)
+		}
+		if err != nil {
+			skipFile(path, "Cannot store the track %d: %s", t.Number, err)
+		}
+	}
+}
+
+// checkMp3File adds the problems found in an MP3 file
+// to the scan report, the garbage before the first frame
+// is removed first if the repairs are enabled.
+func checkMp3File(path string) {
+	problems, err := musicmgr.CheckMp3(path)
+	if err != nil {
+		skipFile(path, "Cannot check the MP3 file: %s", err)
+		return
+	}
+
+	if len(problems) > 0 && repairMp3 {
+		n, err := musicmgr.RepairMp3(path)
+		if err != nil {
+			skipFile(path, "Cannot repair the MP3 file: %s", err)
+		} else if n > 0 {
+			glog.Infof("Removed %d garbage bytes from %s\n", n, path)
+			problems, _ = musicmgr.CheckMp3(path)
+		}
+	}
+
+	for _, p := range problems {
+		skipFile(path, "Corrupt MP3 file: %s", p)
+	}
+}
+
 // ScanFolder scans the specified root path
 // and SubDirectories searching for music files.
 // It uses filepath to walk through the file tree
 // and calls visit on every endpoint found.
+// The extra files and cover images are stored with the
+// Album of the music files found in the same Directory.
+// The files skipped or failed are stored in the scan report,
+// the files matching the ignore patterns are not reported.
+// The Songs whose files are missing are kept as tombstones
+// and the ones whose files are back are restored.
+// A snapshot of the index is stored once it is scanned.
+// The tags of the files that did not change since the
+// last scan are taken from the cache in the database.
 func ScanFolder(root string) error {
-	err := filepath.Walk(root, visit)
+	albumDirs = make(map[string]musicmgr.FileTags)
+	extraDirs = make(map[string][]string)
+	artworkDirs = make(map[string][]string)
+	artistDirs = make(map[string]string)
+	report = nil
+	if err := store.LoadTagCache(); err != nil {
+		glog.Errorf("Cannot load the cached tags: %s\n", err)
+	}
+	// The podcasts, the trash and the files waiting in the
+	// drop Directory are not part of the Music Library.
+	podcasts := filepath.Join(root, "podcasts")
+	trash := filepath.Join(root, store.TrashDir)
+	drop := filepath.Join(root, "drop")
+	err := filepath.Walk(root, func(path string, f os.FileInfo, err error) error {
+		if f != nil && f.IsDir() && (path == podcasts || path == trash || path == drop) {
+			return filepath.SkipDir
+		}
+		if store.IsIgnored(root, path) {
+			if f != nil && f.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		return visit(path, f, err)
+	})
 	// TODO: Scan playlists
+
+	for dir, extras := range extraDirs {
+		tags, ok := albumDirs[dir]
+		if !ok {
+			for _, path := range extras {
+				skipFile(path, "There are no music files in the Directory.")
+			}
+			continue
+		}
+
+		for _, path := range extras {
+			store.StoreExtra(&tags, path)
+		}
+	}
+
+	for dir, images := range artworkDirs {
+		tags, ok := albumDirs[dir]
+		if !ok {
+			for _, path := range images {
+				skipFile(path, "There are no music files in the Directory.")
+			}
+			continue
+		}
+
+		for _, path := range images {
+			store.StoreArtwork(&tags, path)
+		}
+
+		cover := mainCover(images)
+		if len(cover) > 0 {
+			store.SetAlbumCover(&tags, cover)
+		}
+	}
+
+	for dir, path := range artistDirs {
+		artist, ok := dirArtist(dir)
+		if ok {
+			store.StoreArtistImage(artist, path)
+		} else {
+			skipFile(path, "There are no music files in the Directory.")
+		}
+	}
+
+	storeErr := store.SetScanReport(store.ScanReport{Time: time.Now(), Entries: report})
+	if storeErr != nil {
+		glog.Errorf("Cannot store the scan report: %s\n", storeErr)
+	}
+
+	storeErr = store.SaveTagCache()
+	if storeErr != nil {
+		glog.Errorf("Cannot store the cached tags: %s\n", storeErr)
+	}
+
+	if tombstones {
+		buried, storeErr := store.BuryMissingSongs(root)
+		if storeErr != nil {
+			glog.Errorf("Cannot keep the tombstones of the missing Songs: %s\n", storeErr)
+		}
+
+		restored, storeErr := store.RestoreTombstones(root)
+		if storeErr != nil {
+			glog.Errorf("Cannot restore the missing Songs: %s\n", storeErr)
+		}
+		glog.Infof("%d Songs missing and %d restored\n", buried, restored)
+	}
+
+	if snapshots > 0 {
+		storeErr = store.TakeSnapshot(snapshots)
+		if storeErr != nil {
+			glog.Errorf("Cannot store the snapshot of the index: %s\n", storeErr)
+		}
+	}
 	return err
 }
+
+// dirArtist returns the Artist of the music files found
+// in the Directory or in its SubDirectories (usually the
+// Albums inside an Artist Directory).
+func dirArtist(dir string) (string, bool) {
+	if tags, ok := albumDirs[dir]; ok {
+		return tags.Artist, true
+	}
+
+	for albumDir, tags := range albumDirs {
+		if filepath.Dir(albumDir) == dir {
+			return tags.Artist, true
+		}
+	}
+	return "", false
+}
+
+// mainCover returns the image used as the main cover of
+// an Album, the first pattern that matches has priority.
+// Only the JPEG and PNG images can be the main cover.
+func mainCover(images []string) string {
+	for _, p := range artworkFiles {
+		for _, path := range images {
+			ext := strings.ToLower(filepath.Ext(path))
+			if (ext == ".jpg" || ext == ".png") && matchFile([]string{p}, path) {
+				return path
+			}
+		}
+	}
+	return ""
+}
@@ -0,0 +1,136 @@
+// Copyright 2016 Danko Miocevic. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Author: Danko Miocevic
+
+package tools
+
+import (
+	"bufio"
+	"errors"
+	"github.com/dankomiocevic/mulifs/metadata"
+	"github.com/dankomiocevic/mulifs/store"
+	"github.com/golang/glog"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ScrobbleStats counts the entries of a
+// scrobbler log imported.
+type ScrobbleStats struct {
+	Imported   int
+	Duplicated int
+	Unresolved []string
+}
+
+// ParseScrobblerLog reads a .scrobbler.log file written by
+// Rockbox and other portable players. Every line has the
+// Artist, Album, Title, track number, length in seconds,
+// rating (L when listened or S when skipped), time and
+// MusicBrainz ID separated by tabs. The skipped entries
+// are only returned when skipped is true.
+func ParseScrobblerLog(r io.Reader, skipped bool) ([]metadata.Scrobble, error) {
+	var scrobbles []metadata.Scrobble
+	location := time.UTC
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if strings.HasPrefix(line, "#") {
+			// Without the timezone the player stores
+			// the local time as if it were UTC.
+			if strings.HasPrefix(line, "#TZ/") && line != "#TZ/UTC" {
+				location = time.Local
+			}
+			continue
+		}
+
+		fields := strings.Split(line, "\t")
+		if len(fields) < 7 {
+			continue
+		}
+
+		if fields[5] != "L" && !skipped {
+			continue
+		}
+
+		ts, err := strconv.ParseInt(fields[6], 10, 64)
+		if err != nil || ts <= 0 {
+			continue
+		}
+
+		t := time.Unix(ts, 0).UTC()
+		if location != time.UTC {
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), 0, location)
+		}
+
+		length, _ := strconv.Atoi(fields[4])
+		scrobbles = append(scrobbles, metadata.Scrobble{
+			Artist:   fields[0],
+			Album:    fields[1],
+			Track:    fields[2],
+			Duration: length,
+			Time:     t,
+		})
+	}
+	return scrobbles, scanner.Err()
+}
+
+// ImportScrobblerLog stores the plays of a scrobbler log in
+// the statistics of the Songs, the entries are matched with
+// the Songs by their Artist and Title. The entries already
+// imported are not counted again.
+// It returns the scrobbles of the log so they can be sent
+// to Last.fm.
+func ImportScrobblerLog(path string, skipped bool) (ScrobbleStats, []metadata.Scrobble, error) {
+	var stats ScrobbleStats
+	f, err := os.Open(path)
+	if err != nil {
+		return stats, nil, err
+	}
+	defer f.Close()
+
+	scrobbles, err := ParseScrobblerLog(f, skipped)
+	if err != nil {
+		return stats, nil, err
+	}
+	if len(scrobbles) < 1 {
+		return stats, nil, errors.New("No plays found in the scrobbler log.")
+	}
+
+	index, err := newSongIndex()
+	if err != nil {
+		return stats, nil, err
+	}
+
+	var plays []store.PlayRecord
+	for _, s := range scrobbles {
+		song, ok := index.find(s.Artist, s.Track)
+		if !ok {
+			stats.Unresolved = append(stats.Unresolved, s.Artist+" - "+s.Track)
+			continue
+		}
+		plays = append(plays, store.PlayRecord{SongRef: song.SongRef, Time: s.Time})
+	}
+
+	stats.Imported, err = store.AddPlays(plays)
+	if err != nil {
+		return stats, nil, err
+	}
+	stats.Duplicated = len(plays) - stats.Imported
+	glog.Infof("%d plays imported from %s\n", stats.Imported, path)
+	return stats, scrobbles, nil
+}
@@ -0,0 +1,372 @@
+// Copyright 2016 Danko Miocevic. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Author: Danko Miocevic
+
+package tools
+
+import (
+	"bufio"
+	"errors"
+	"github.com/dankomiocevic/mulifs/store"
+	"github.com/golang/glog"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// syncManifest is the file stored in the target
+// Directory with the files written by the last sync,
+// only these files are deleted by the next sync.
+const syncManifest = ".mulifs-sync"
+
+// DefaultSyncTemplate is the default name of
+// the Songs in the target Directory.
+const DefaultSyncTemplate = "{artist}/{album}/{title}"
+
+// SyncOptions defines what is synchronized
+// to the target Directory and how.
+type SyncOptions struct {
+	// Playlists, Artists and Crates select the Songs to synchronize,
+	// when all are empty the whole Library is synchronized.
+	Playlists []string
+	Artists   []string
+	Crates    []string
+	// Template is the path of the Songs in the target
+	// with the {artist}, {album} and {title} fields.
+	Template string
+	// Transcode is the extension of the format the Songs
+	// are converted to with ffmpeg, empty copies them.
+	Transcode string
+}
+
+// syncFile is a Song copied to the target Directory.
+type syncFile struct {
+	src string
+	dst string
+}
+
+// syncName returns the path of a Song in the
+// target Directory using the template.
+func syncName(s store.SongInfo, opts SyncOptions) string {
+	ext := filepath.Ext(s.Song)
+	if len(opts.Transcode) > 0 {
+		ext = "." + strings.TrimPrefix(opts.Transcode, ".")
+	}
+
+	r := strings.NewReplacer(
+		"{artist}", s.Artist,
+		"{album}", s.Album,
+		"{title}", strings.TrimSuffix(s.Song, filepath.Ext(s.Song)),
+	)
+	return filepath.FromSlash(r.Replace(opts.Template)) + ext
+}
+
+// selectSongs returns the Songs selected by the options
+// and the Songs of every selected playlist and crate.
+func selectSongs(opts SyncOptions) ([]store.SongInfo, map[string][]store.SongInfo, error) {
+	songs, err := store.ListSongInfo()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if len(opts.Playlists) < 1 && len(opts.Artists) < 1 && len(opts.Crates) < 1 {
+		return songs, nil, nil
+	}
+
+	byRef := make(map[store.SongRef]store.SongInfo)
+	for _, s := range songs {
+		byRef[s.SongRef] = s
+	}
+
+	selected := make(map[store.SongRef]bool)
+	var a []store.SongInfo
+	for _, s := range songs {
+		for _, artist := range opts.Artists {
+			if s.Artist == store.GetCompatibleString(artist) && !selected[s.SongRef] {
+				selected[s.SongRef] = true
+				a = append(a, s)
+			}
+		}
+	}
+
+	playlists := make(map[string][]store.SongInfo)
+	for _, name := range opts.Playlists {
+		name = store.GetCompatibleString(name)
+		files, err := store.GetPlaylistFiles(name)
+		if err != nil {
+			return nil, nil, errors.New("Playlist " + name + " not found.")
+		}
+
+		for _, f := range files {
+			s, ok := byRef[store.SongRef{Artist: f.Artist, Album: f.Album, Song: f.Title}]
+			if !ok {
+				glog.Infof("Song %s not found in the Library\n", f.Title)
+				continue
+			}
+
+			playlists[name] = append(playlists[name], s)
+			if !selected[s.SongRef] {
+				selected[s.SongRef] = true
+				a = append(a, s)
+			}
+		}
+	}
+
+	// The crates are written as playlists in their order.
+	for _, name := range opts.Crates {
+		name = store.GetCompatibleString(name)
+		entries, err := store.GetCrate(name)
+		if err != nil {
+			return nil, nil, errors.New("Crate " + name + " not found.")
+		}
+
+		for _, e := range entries {
+			s, ok := byRef[e.SongRef]
+			if !ok {
+				glog.Infof("Song %s not found in the Library\n", e.Song)
+				continue
+			}
+
+			playlists[name] = append(playlists[name], s)
+			if !selected[s.SongRef] {
+				selected[s.SongRef] = true
+				a = append(a, s)
+			}
+		}
+	}
+	return a, playlists, nil
+}
+
+// needsSync returns true if the target file
+// is missing or older than the source.
+func needsSync(f syncFile, transcoded bool) bool {
+	src, err := os.Stat(f.src)
+	if err != nil {
+		return false
+	}
+
+	dst, err := os.Stat(f.dst)
+	if err != nil {
+		return true
+	}
+
+	if !transcoded && src.Size() != dst.Size() {
+		return true
+	}
+	return !src.ModTime().Equal(dst.ModTime())
+}
+
+// copySong copies or transcodes a Song to the target
+// and sets the modification time of the source, so
+// the next sync knows that it is up to date.
+func copySong(f syncFile, transcode bool) error {
+	err := os.MkdirAll(filepath.Dir(f.dst), 0755)
+	if err != nil {
+		return err
+	}
+
+	// The whole file is read, it counts
+	// in the limits of the background work.
+	store.ThrottleOp()
+	if src, err := os.Stat(f.src); err == nil {
+		store.ThrottleBytes(src.Size())
+	}
+
+	tmp := f.dst + ".part" + filepath.Ext(f.dst)
+	if transcode {
+		out, err := exec.Command("ffmpeg", "-loglevel", "error", "-y", "-i", f.src, "-map_metadata", "0", tmp).CombinedOutput()
+		if err != nil {
+			os.Remove(tmp)
+			return errors.New("Cannot transcode " + f.src + ": " + strings.TrimSpace(string(out)))
+		}
+	} else {
+		err = copyFile(f.src, tmp)
+		if err != nil {
+			os.Remove(tmp)
+			return err
+		}
+	}
+
+	src, err := os.Stat(f.src)
+	if err == nil {
+		os.Chtimes(tmp, src.ModTime(), src.ModTime())
+	}
+	return os.Rename(tmp, f.dst)
+}
+
+// copyFile copies the contents of a file.
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+
+	_, err = io.Copy(out, in)
+	if err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+// readManifest returns the files written by the last
+// sync in the target Directory, listed in the manifest.
+func readManifest(target, manifest string) []string {
+	f, err := os.Open(filepath.Join(target, manifest))
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+
+	var a []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if len(scanner.Text()) > 0 {
+			a = append(a, scanner.Text())
+		}
+	}
+	return a
+}
+
+// writeManifest stores the files written by the sync.
+func writeManifest(target, manifest string, files []string) error {
+	sort.Strings(files)
+	data := strings.Join(files, "\n") + "\n"
+	return writeFile(filepath.Join(target, manifest), []byte(data))
+}
+
+// writeFile writes a whole file replacing it atomically.
+func writeFile(path string, data []byte) error {
+	tmp := path + ".part"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+
+	_, err = f.Write(data)
+	if err == nil {
+		err = f.Close()
+	} else {
+		f.Close()
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// removeStale deletes the files written by the last sync that
+// are not part of this one, and their empty Directories.
+func removeStale(target string, old []string, current map[string]bool) {
+	for _, name := range old {
+		if current[name] || strings.HasPrefix(filepath.Clean(name), "..") {
+			continue
+		}
+
+		path := filepath.Join(target, name)
+		if err := os.Remove(path); err != nil {
+			continue
+		}
+		glog.Infof("Deleted %s\n", path)
+
+		for dir := filepath.Dir(path); dir != filepath.Clean(target); dir = filepath.Dir(dir) {
+			if os.Remove(dir) != nil {
+				break
+			}
+		}
+	}
+}
+
+// Sync mirrors the selected Songs to the target Directory.
+// The Songs are copied only when they changed, the Songs removed
+// from the selection since the last sync are deleted and the
+// selected playlists and crates are written as M3U files with
+// relative paths.
+// It returns the number of Songs copied.
+func Sync(target string, opts SyncOptions) (int, error) {
+	if len(opts.Template) < 1 {
+		opts.Template = DefaultSyncTemplate
+	}
+
+	err := os.MkdirAll(target, 0755)
+	if err != nil {
+		return 0, err
+	}
+
+	songs, playlists, err := selectSongs(opts)
+	if err != nil {
+		return 0, err
+	}
+
+	current := make(map[string]bool)
+	names := make(map[store.SongRef]string)
+	copied := 0
+	for _, s := range songs {
+		name := syncName(s, opts)
+		if current[name] {
+			glog.Infof("Skipping %s, the name is already used\n", s.Path)
+			continue
+		}
+		current[name] = true
+		names[s.SongRef] = name
+
+		transcode := len(opts.Transcode) > 0 && !strings.EqualFold(filepath.Ext(s.Path), filepath.Ext(name))
+		f := syncFile{src: s.Path, dst: filepath.Join(target, name)}
+		if !needsSync(f, transcode) {
+			continue
+		}
+
+		glog.Infof("Copying %s to %s\n", f.src, f.dst)
+		err = copySong(f, transcode)
+		if err != nil {
+			return copied, err
+		}
+		copied++
+	}
+
+	for playlist, list := range playlists {
+		data := "#EXTM3U\n"
+		for _, s := range list {
+			if name, ok := names[s.SongRef]; ok {
+				data += filepath.ToSlash(name) + "\n"
+			}
+		}
+
+		name := playlist + ".m3u"
+		err = writeFile(filepath.Join(target, name), []byte(data))
+		if err != nil {
+			return copied, err
+		}
+		current[name] = true
+	}
+
+	removeStale(target, readManifest(target, syncManifest), current)
+
+	var files []string
+	for name := range current {
+		files = append(files, name)
+	}
+	return copied, writeManifest(target, syncManifest, files)
+}
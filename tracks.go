@@ -0,0 +1,245 @@
+// Copyright 2016 Danko Miocevic. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Author: Danko Miocevic
+
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"github.com/dankomiocevic/mulifs/musicmgr"
+	"github.com/dankomiocevic/mulifs/store"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"bazil.org/fuse"
+	"github.com/golang/glog"
+	"golang.org/x/net/context"
+)
+
+// tracksFileName is the name of the editable file inside
+// every Album that lists its Songs, one per line:
+//
+//	<file name>	<track number>	<title>
+//
+// The fields are separated by tabs, the lines starting
+// with # are comments. Saving the file changes the track
+// numbers and the titles that were edited, the Songs
+// with a new title are renamed.
+const tracksFileName = ".tracks"
+
+// isTracksFile returns true if the File is the
+// .tracks file of an Album Directory.
+func (f *File) isTracksFile() bool {
+	return f.name == tracksFileName && len(f.album) > 0 && !f.isDropped() &&
+		f.artist != "playlists" && f.album != allSongsDir
+}
+
+// trackNumber returns the number of a track
+// or zero if it is not set.
+func trackNumber(track string) int {
+	n, _ := strconv.Atoi(track)
+	return n
+}
+
+// albumTracks returns the contents of the .tracks file
+// of an Album, the Songs are sorted by track number and
+// the ones without track number are listed last.
+func albumTracks(artist, album string) ([]byte, error) {
+	songs, err := store.ListAlbumSongNames(artist, album)
+	if err != nil {
+		return nil, err
+	}
+
+	sort.SliceStable(songs, func(i, j int) bool {
+		a := trackNumber(songs[i].Track)
+		b := trackNumber(songs[j].Track)
+		if a != b {
+			return b == 0 || (a > 0 && a < b)
+		}
+		return songs[i].Song < songs[j].Song
+	})
+
+	var buf bytes.Buffer
+	buf.WriteString("# file\ttrack\ttitle\n")
+	for _, s := range songs {
+		fmt.Fprintf(&buf, "%s\t%s\t%s\n", s.Song, s.Track, s.Title)
+	}
+	return buf.Bytes(), nil
+}
+
+// trackEdit is a change written to the .tracks file.
+type trackEdit struct {
+	song  store.SongNames
+	track string
+	title string
+}
+
+// parseTracks returns the changes written to the .tracks
+// file. All the lines are checked before anything is
+// changed, the Songs missing in the file are not modified.
+func parseTracks(data []byte, songs []store.SongNames) ([]trackEdit, error) {
+	names := make(map[string]store.SongNames)
+	for _, s := range songs {
+		names[s.Song] = s
+	}
+
+	seen := make(map[string]bool)
+	used := make(map[string]bool)
+	var edits []trackEdit
+	for i, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimRight(line, "\r")
+		if len(strings.TrimSpace(line)) < 1 || line[0] == '#' {
+			continue
+		}
+
+		fields := strings.SplitN(line, "\t", 3)
+		if len(fields) != 3 {
+			return nil, fmt.Errorf("Line %d: Wrong number of fields.", i+1)
+		}
+
+		name := strings.TrimSpace(fields[0])
+		song, ok := names[name]
+		if !ok {
+			return nil, fmt.Errorf("Line %d: Song %s not found.", i+1, name)
+		}
+		if seen[name] {
+			return nil, fmt.Errorf("Line %d: Song %s is repeated.", i+1, name)
+		}
+		seen[name] = true
+
+		track := strings.TrimSpace(fields[1])
+		if len(track) > 0 {
+			track = musicmgr.ParseTrack(track)
+			if len(track) < 1 {
+				return nil, fmt.Errorf("Line %d: Wrong track number.", i+1)
+			}
+		}
+
+		title := strings.TrimSpace(fields[2])
+		key := store.GetCompatibleString(title)
+		if len(key) < 1 {
+			return nil, fmt.Errorf("Line %d: Wrong title.", i+1)
+		}
+
+		key = key + filepath.Ext(name)
+		if key != name {
+			if _, ok := names[key]; ok || used[key] {
+				return nil, fmt.Errorf("Line %d: The title is used by another Song.", i+1)
+			}
+		}
+		used[key] = true
+
+		if track != song.Track || title != song.Title {
+			edits = append(edits, trackEdit{song: song, track: track, title: title})
+		}
+	}
+	return edits, nil
+}
+
+// applyTracks applies the changes written to the .tracks
+// file. If a change fails or the context is cancelled
+// the previous ones are undone.
+func applyTracks(ctx context.Context, artist, album string, data []byte, mPoint string) error {
+	songs, err := store.ListAlbumSongNames(artist, album)
+	if err != nil {
+		return err
+	}
+
+	edits, err := parseTracks(data, songs)
+	if err != nil {
+		return err
+	}
+
+	var undo []func() error
+	for _, e := range edits {
+		err = applyTrackEdit(ctx, e, mPoint, &undo)
+		if err != nil {
+			break
+		}
+	}
+
+	if err != nil {
+		for i := len(undo) - 1; i >= 0; i-- {
+			if uerr := undo[i](); uerr != nil {
+				glog.Errorf("Cannot undo the change of the .tracks file: %s\n", uerr)
+			}
+		}
+		return err
+	}
+
+	if len(edits) > 0 {
+		scheduleAutoPlaylists(mPoint)
+	}
+	return nil
+}
+
+// saveTracks applies the changes written to the .tracks
+// file, the content being edited is replaced with the new
+// listing so the changes are not applied twice.
+func (fh *FileHandle) saveTracks(ctx context.Context, data []byte) error {
+	err := applyTracks(ctx, fh.f.artist, fh.f.album, data, fh.f.mPoint)
+	if err != nil {
+		glog.Errorf("Cannot save the .tracks file: %s\n", err)
+		return fuse.EIO
+	}
+
+	current, err := albumTracks(fh.f.artist, fh.f.album)
+	if err != nil {
+		return nil
+	}
+
+	descriptionEdits.Lock()
+	fh.edit.data = current
+	descriptionEdits.Unlock()
+	return nil
+}
+
+// applyTrackEdit changes the track number and the title
+// of a Song, the functions to undo the changes are
+// appended to undo.
+func applyTrackEdit(ctx context.Context, e trackEdit, mPoint string, undo *[]func() error) error {
+	s := e.song
+	if e.track != s.Track {
+		err := store.SetSongTrack(s.SongRef, e.track)
+		if err != nil {
+			return err
+		}
+		*undo = append(*undo, func() error {
+			return store.SetSongTrack(s.SongRef, s.Track)
+		})
+	}
+
+	if e.title == s.Title {
+		return nil
+	}
+
+	if len(s.ArtistName) < 1 || len(s.AlbumName) < 1 {
+		return errors.New("The Artist and Album names are missing.")
+	}
+
+	ref, err := store.RetagSong(ctx, s.SongRef, s.ArtistName, s.AlbumName, e.title, mPoint)
+	if err != nil {
+		return err
+	}
+	*undo = append(*undo, func() error {
+		_, err := store.RetagSong(context.Background(), ref, s.ArtistName, s.AlbumName, s.Title, mPoint)
+		return err
+	})
+	return nil
+}
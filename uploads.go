@@ -0,0 +1,128 @@
+// Copyright 2016 Danko Miocevic. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Author: Danko Miocevic
+
+package main
+
+import (
+	"github.com/dankomiocevic/mulifs/musicmgr"
+	"sync"
+	"time"
+
+	"bazil.org/fuse"
+	"github.com/golang/glog"
+)
+
+// dropUpload is a dropped file being written, with the
+// handles open for writing on it and the size and the
+// time of the last write.
+type dropUpload struct {
+	handles int
+	size    int64
+	modTime time.Time
+}
+
+// dropUploads keeps the dropped files being written by
+// their path, the file is only filed once the last
+// handle is released.
+var dropUploads = struct {
+	sync.Mutex
+	m map[string]*dropUpload
+}{m: make(map[string]*dropUpload)}
+
+// beginUpload records a handle open for writing
+// on the dropped file with the size it has.
+func beginUpload(path string, size int64) {
+	dropUploads.Lock()
+	defer dropUploads.Unlock()
+	u, ok := dropUploads.m[path]
+	if !ok {
+		u = &dropUpload{size: size, modTime: time.Now()}
+		dropUploads.m[path] = u
+	}
+	u.handles++
+}
+
+// resizeUpload records the size of the dropped file
+// after a write, that only makes it grow, or a truncate.
+func resizeUpload(path string, size int64, truncate bool) {
+	dropUploads.Lock()
+	defer dropUploads.Unlock()
+	u, ok := dropUploads.m[path]
+	if !ok {
+		return
+	}
+
+	if truncate || size > u.size {
+		u.size = size
+	}
+	u.modTime = time.Now()
+}
+
+// uploadAttr returns the size and the time of the
+// last write of the dropped file being written.
+func uploadAttr(path string) (int64, time.Time, bool) {
+	dropUploads.Lock()
+	defer dropUploads.Unlock()
+	u, ok := dropUploads.m[path]
+	if !ok {
+		return 0, time.Time{}, false
+	}
+	return u.size, u.modTime, true
+}
+
+// endUpload records the release of a handle open for
+// writing on the dropped file, it returns true if it
+// was the last one.
+func endUpload(path string) bool {
+	dropUploads.Lock()
+	defer dropUploads.Unlock()
+	u, ok := dropUploads.m[path]
+	if !ok {
+		return true
+	}
+
+	u.handles--
+	if u.handles > 0 {
+		return false
+	}
+	delete(dropUploads.m, path)
+	return true
+}
+
+// uploading returns true if there is a handle
+// open for writing on the dropped file.
+func uploading(path string) bool {
+	dropUploads.Lock()
+	defer dropUploads.Unlock()
+	_, ok := dropUploads.m[path]
+	return ok
+}
+
+// releaseUpload files the dropped file written by the
+// handle once the last writer is released. The music files
+// cut while copied are kept in the drop Directory, the copy
+// is resumed appending the rest of the file to them.
+func (fh *FileHandle) releaseUpload(header fuse.Header) {
+	if len(fh.upload) < 1 || !endUpload(fh.upload) {
+		return
+	}
+
+	if musicmgr.IsMusicFile(fh.upload) && !musicmgr.IsCompleteMusicFile(fh.upload) {
+		glog.Errorf("The file %s is incomplete, it is kept until the rest is appended.\n", fh.upload)
+		return
+	}
+	PushFileItem(*fh.f, dropHandler(header))
+}
@@ -0,0 +1,112 @@
+// Copyright 2016 Danko Miocevic. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Author: Danko Miocevic
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"github.com/dankomiocevic/mulifs/store"
+	"github.com/dankomiocevic/mulifs/tools"
+	"log"
+	"os"
+	"path/filepath"
+)
+
+// runVerify runs the verify command, it calculates the
+// checksums of all the Songs again and reports the Songs
+// that are missing or corrupted.
+func runVerify(db_path string, args []string) {
+	flags := flag.NewFlagSet("verify", flag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage:\n  %s [global_options] verify\n", progName)
+	}
+	flags.Parse(args)
+
+	err := store.InitDB(db_path)
+	if err != nil {
+		log.Fatal(err)
+		os.Exit(5)
+	}
+
+	songs, err := store.ListSongInfo()
+	if err != nil {
+		log.Fatal(err)
+		os.Exit(15)
+	}
+
+	var counts [store.VerifyCorrupted + 1]int
+	for _, s := range songs {
+		status, err := store.VerifySong(s.SongRef, 0)
+		if err != nil {
+			log.Printf("Cannot verify %s: %s\n", s.Path, err)
+			continue
+		}
+
+		counts[status]++
+		switch status {
+		case store.VerifyMissing:
+			log.Printf("Missing: %s\n", s.Path)
+		case store.VerifyCorrupted:
+			log.Printf("Corrupted: %s\n", s.Path)
+		}
+	}
+
+	log.Printf("%d Songs verified, %d new checksums, %d modified, %d missing and %d corrupted\n",
+		len(songs), counts[store.VerifyAdded], counts[store.VerifyChanged],
+		counts[store.VerifyMissing], counts[store.VerifyCorrupted])
+	if counts[store.VerifyMissing] > 0 || counts[store.VerifyCorrupted] > 0 {
+		sendNotification(notification{Title: "Verify found errors", Message: fmt.Sprintf(
+			"%d Songs missing and %d corrupted.", counts[store.VerifyMissing], counts[store.VerifyCorrupted])})
+		closeDB()
+		os.Exit(15)
+	}
+}
+
+// runDedupe runs the dedupe command, it replaces the
+// duplicated music files with hard links.
+func runDedupe(db_path string, args []string) {
+	flags := flag.NewFlagSet("dedupe", flag.ExitOnError)
+	dryRun := flags.Bool("dry_run", false, "Only report the duplicated files.")
+	flags.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage:\n  %s [global_options] dedupe [-dry_run] MUSIC_SOURCE\n", progName)
+	}
+	flags.Parse(args)
+
+	if flags.NArg() != 1 {
+		flags.Usage()
+		os.Exit(2)
+	}
+
+	root, err := filepath.Abs(flags.Arg(0))
+	if err != nil {
+		log.Fatal(err)
+		os.Exit(6)
+	}
+
+	err = store.InitDB(db_path)
+	if err != nil {
+		log.Fatal(err)
+		os.Exit(5)
+	}
+
+	stats, err := tools.DedupeFiles(root, *dryRun)
+	if err != nil {
+		log.Fatal(err)
+		os.Exit(16)
+	}
+	log.Printf("%d duplicated files linked, %d KB saved\n", stats.Linked, stats.Saved/1024)
+}
@@ -0,0 +1,148 @@
+// Copyright 2016 Danko Miocevic. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Author: Danko Miocevic
+
+package main
+
+import (
+	"github.com/dankomiocevic/mulifs/musicmgr"
+	"github.com/dankomiocevic/mulifs/store"
+	"strings"
+
+	"bazil.org/fuse"
+	"bazil.org/fuse/fs"
+	"golang.org/x/net/context"
+)
+
+// versionsViewDir is the view with all the versions
+// of the Songs stored in more than one format.
+const versionsViewDir = "versions"
+
+// The versions of the Songs shown in the Album Directories
+// when a Song is stored in a lossless and a lossy format.
+const (
+	// versionsAll shows every version.
+	versionsAll = "all"
+	// versionsOriginal shows the lossless versions.
+	versionsOriginal = "original"
+	// versionsTranscoded shows the lossy versions.
+	versionsTranscoded = "transcoded"
+)
+
+// registerVersionsView adds the versions view to the root
+// Directory when only one version is shown in the Albums.
+func registerVersionsView() {
+	if config_params.versions != versionsAll {
+		views[versionsViewDir] = view{list: listVersionsView, lookup: lookupVersionsView}
+	}
+}
+
+// hiddenVersions returns the Songs of the Album that are not
+// listed because another version of them is preferred. They
+// can still be opened by their names and from the versions view.
+func hiddenVersions(artist, album string) map[string]bool {
+	if config_params.versions == versionsAll {
+		return nil
+	}
+
+	groups, err := store.ListSongVersions(artist, album)
+	if err != nil || len(groups) < 1 {
+		return nil
+	}
+
+	original := config_params.versions == versionsOriginal
+	hidden := make(map[string]bool)
+	for _, g := range groups {
+		for _, v := range g {
+			if v.Lossless != original {
+				hidden[v.Name] = true
+			}
+		}
+	}
+	return hidden
+}
+
+// withoutHidden removes the hidden entries.
+func withoutHidden(entries []fuse.Dirent, hidden map[string]bool) []fuse.Dirent {
+	if len(hidden) < 1 {
+		return entries
+	}
+
+	a := entries[:0]
+	for _, e := range entries {
+		if !hidden[e.Name] {
+			a = append(a, e)
+		}
+	}
+	return a
+}
+
+// listVersionsView lists the Albums with Songs stored in
+// more than one format or all the versions of their Songs.
+func listVersionsView(ctx context.Context, d *Dir) ([]fuse.Dirent, error) {
+	if len(d.album) < 1 {
+		albums, err := store.ListVersionAlbums()
+		if err != nil {
+			return nil, fuse.EIO
+		}
+
+		var a []fuse.Dirent
+		for _, album := range albums {
+			a = append(a, fuse.Dirent{Name: albumViewName(album.Artist, album.Album), Type: fuse.DT_Dir})
+		}
+		return a, nil
+	}
+
+	items := strings.SplitN(d.album, " - ", 2)
+	if len(items) != 2 {
+		return nil, fuse.ENOENT
+	}
+
+	groups, err := store.ListSongVersions(items[0], items[1])
+	if err != nil {
+		return nil, fuse.ENOENT
+	}
+
+	var a []fuse.Dirent
+	for _, g := range groups {
+		for _, v := range g {
+			a = append(a, fuse.Dirent{Name: v.Name, Type: fuse.DT_File})
+		}
+	}
+	return a, nil
+}
+
+// lookupVersionsView returns the Album Directories
+// and the versions of the Songs in the versions view.
+func lookupVersionsView(ctx context.Context, d *Dir, name string) (fs.Node, error) {
+	if len(d.album) < 1 {
+		items := strings.SplitN(name, " - ", 2)
+		if len(items) != 2 {
+			return nil, fuse.ENOENT
+		}
+
+		groups, err := store.ListSongVersions(items[0], items[1])
+		if err != nil || len(groups) < 1 {
+			return nil, fuse.ENOENT
+		}
+		return &Dir{fs: d.fs, artist: d.artist, album: name, mPoint: d.mPoint}, nil
+	}
+
+	items := strings.SplitN(d.album, " - ", 2)
+	if len(items) != 2 || !musicmgr.IsMusicFile(name) {
+		return nil, fuse.ENOENT
+	}
+	return songFile(d, items[0], items[1], name)
+}
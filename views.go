@@ -0,0 +1,286 @@
+// Copyright 2016 Danko Miocevic. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Author: Danko Miocevic
+
+package main
+
+import (
+	"github.com/dankomiocevic/mulifs/musicmgr"
+	"github.com/dankomiocevic/mulifs/store"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"bazil.org/fuse"
+	"bazil.org/fuse/fs"
+	"github.com/golang/glog"
+	"golang.org/x/net/context"
+)
+
+// view defines a read only Directory in the root of the
+// filesystem that shows the Music Library organized in
+// a different way.
+// The view name is stored as the artist in the Dir struct
+// and the subdirectory inside the view as the album, the
+// views with more levels separate them with slashes.
+// The context of the request is passed to the functions
+// to stop walking the Library if the request is interrupted.
+type view struct {
+	list   func(ctx context.Context, d *Dir) ([]fuse.Dirent, error)
+	lookup func(ctx context.Context, d *Dir, name string) (fs.Node, error)
+}
+
+// views contains all the available views indexed
+// by the Directory name.
+var views = map[string]view{
+	"albums": {list: listAlbumsView, lookup: lookupAlbumsView},
+	"songs":  {list: listSongsView, lookup: lookupSongsView},
+}
+
+// songsPageSize is the amount of Songs read from the
+// database on every transaction when listing the Library.
+const songsPageSize = 512
+
+// isView returns true if the Directory is
+// inside one of the views.
+func (d *Dir) isView() bool {
+	_, ok := views[d.artist]
+	return ok
+}
+
+// viewDirents returns the Dirent for every view
+// to be listed in the root Directory.
+func viewDirents() []fuse.Dirent {
+	var names []string
+	for name := range views {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var a []fuse.Dirent
+	for _, name := range names {
+		a = append(a, fuse.Dirent{Name: name, Type: fuse.DT_Dir})
+	}
+	return a
+}
+
+// matchGenre returns true if the genre is one
+// of the genres, ignoring the case.
+func matchGenre(genres []string, genre string) bool {
+	for _, g := range genres {
+		if strings.EqualFold(g, strings.TrimSpace(genre)) {
+			return true
+		}
+	}
+	return false
+}
+
+// songFile returns the File node for a Song stored in
+// the database under the specified Artist and Album.
+func songFile(d *Dir, artist, album, song string) (fs.Node, error) {
+	_, err := store.GetFilePath(artist, album, song)
+	if err != nil {
+		glog.Info(err)
+		return nil, fuse.ENOENT
+	}
+
+	extension := filepath.Ext(song)
+	songName := song[:len(song)-len(extension)]
+	return &File{artist: artist, album: album, song: songName, name: song, mPoint: d.mPoint}, nil
+}
+
+// albumViewName returns the name used for an
+// Album in the albums view.
+func albumViewName(artist, album string) string {
+	return artist + " - " + album
+}
+
+// listAlbumsView lists all the Albums in the Library
+// or the Songs inside one of them.
+func listAlbumsView(ctx context.Context, d *Dir) ([]fuse.Dirent, error) {
+	if len(d.album) < 1 {
+		albums, err := store.ListAllAlbums(ctx)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil, fuse.EINTR
+			}
+			return nil, fuse.ENOENT
+		}
+
+		var a []fuse.Dirent
+		for _, album := range albums {
+			a = append(a, fuse.Dirent{Name: albumViewName(album.Artist, album.Album), Type: fuse.DT_Dir})
+		}
+		return a, nil
+	}
+
+	items := strings.SplitN(d.album, " - ", 2)
+	if len(items) != 2 {
+		return nil, fuse.ENOENT
+	}
+
+	a, err := store.ListSongs(items[0], items[1])
+	if err != nil {
+		return nil, fuse.ENOENT
+	}
+
+	var songs []fuse.Dirent
+	for _, s := range a {
+		if s.Name[0] != '.' {
+			songs = append(songs, s)
+		}
+	}
+	songs = append(songs, fuse.Dirent{Name: albumPlaylistName, Type: fuse.DT_File})
+	songs = append(songs, listSidecars(items[0], items[1])...)
+	return songs, nil
+}
+
+// lookupAlbumsView returns the Album Directories and
+// the Songs in the albums view.
+func lookupAlbumsView(ctx context.Context, d *Dir, name string) (fs.Node, error) {
+	if len(d.album) < 1 {
+		items := strings.SplitN(name, " - ", 2)
+		if len(items) != 2 {
+			return nil, fuse.ENOENT
+		}
+
+		_, err := store.GetAlbumPath(items[0], items[1])
+		if err != nil {
+			return nil, fuse.ENOENT
+		}
+		return &Dir{fs: d.fs, artist: d.artist, album: name, mPoint: d.mPoint}, nil
+	}
+
+	items := strings.SplitN(d.album, " - ", 2)
+	if len(items) != 2 {
+		return nil, fuse.ENOENT
+	}
+
+	if name == albumPlaylistName {
+		return &File{artist: items[0], album: items[1], song: name, name: name, mPoint: d.mPoint}, nil
+	}
+
+	if !musicmgr.IsMusicFile(name) {
+		return sidecarFile(d, items[0], items[1], name)
+	}
+	return songFile(d, items[0], items[1], name)
+}
+
+// songViewName returns the name used for a Song in the songs
+// view. If the name was already used the Artist and Album are
+// added to the name to make it unique.
+func songViewName(song store.SongRef, seen map[string]bool) string {
+	name := song.Song
+	if config_params.songs_artist_names {
+		name = song.Artist + " - " + song.Song
+	}
+
+	if seen[name] {
+		name = song.Artist + " - " + song.Album + " - " + song.Song
+	}
+	seen[name] = true
+	return name
+}
+
+// songsViewPager returns the pager of the songs view, it
+// walks the Library from the Song after the last one read,
+// the names used are kept to make the next ones unique.
+func songsViewPager() dirPager {
+	var last store.SongRef
+	var seen map[string]bool
+	return func(after string, limit int) ([]fuse.Dirent, error) {
+		if len(after) < 1 {
+			last = store.SongRef{}
+			seen = make(map[string]bool)
+		}
+
+		songs, err := store.ListSongsPage(last, limit)
+		if err != nil {
+			return nil, err
+		}
+
+		a := make([]fuse.Dirent, 0, len(songs))
+		for _, song := range songs {
+			a = append(a, fuse.Dirent{Name: songViewName(song, seen), Type: fuse.DT_File})
+		}
+		if len(songs) > 0 {
+			last = songs[len(songs)-1]
+		}
+		return a, nil
+	}
+}
+
+// listSongsView lists every Song in the Library.
+// The Songs are read in pages to avoid keeping the
+// database busy for a long time on big Libraries.
+func listSongsView(ctx context.Context, d *Dir) ([]fuse.Dirent, error) {
+	if len(d.album) > 0 {
+		return nil, fuse.ENOENT
+	}
+
+	var a []fuse.Dirent
+	seen := make(map[string]bool)
+	var last store.SongRef
+	for {
+		songs, err := store.ListSongsPage(last, songsPageSize)
+		if err != nil {
+			return nil, fuse.EIO
+		}
+
+		for _, song := range songs {
+			a = append(a, fuse.Dirent{Name: songViewName(song, seen), Type: fuse.DT_File})
+		}
+
+		if len(songs) < songsPageSize {
+			return a, nil
+		}
+		last = songs[len(songs)-1]
+
+		if ctx.Err() != nil {
+			return nil, fuse.EINTR
+		}
+	}
+}
+
+// lookupSongsView returns the Songs in the songs view.
+// The names can be just the Song, "Artist - Song" or
+// "Artist - Album - Song" as generated by songViewName.
+func lookupSongsView(ctx context.Context, d *Dir, name string) (fs.Node, error) {
+	if len(d.album) > 0 {
+		return nil, fuse.ENOENT
+	}
+
+	items := strings.Split(name, " - ")
+	var song store.SongRef
+	var err error
+	switch len(items) {
+	case 1:
+		song, err = store.FindSong(ctx, "", name)
+	case 2:
+		song, err = store.FindSong(ctx, items[0], items[1])
+	case 3:
+		song = store.SongRef{Artist: items[0], Album: items[1], Song: items[2]}
+	default:
+		err = fuse.ENOENT
+	}
+
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, fuse.EINTR
+		}
+		return nil, fuse.ENOENT
+	}
+	return songFile(d, song.Artist, song.Album, song.Song)
+}
@@ -0,0 +1,103 @@
+// Copyright 2016 Danko Miocevic. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Author: Danko Miocevic
+
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/dankomiocevic/mulifs/store"
+)
+
+// testLibrary creates a database with the Songs, the names
+// are Artist/Album/Song. It returns the source Directory.
+func testLibrary(t *testing.T, songs ...string) string {
+	if err := store.InitDB(filepath.Join(t.TempDir(), "muli.db")); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { store.CloseDB() })
+
+	root := t.TempDir() + "/"
+	for _, song := range songs {
+		dir, name := filepath.Split(song)
+		artist, album := filepath.Split(filepath.Clean(dir))
+		artist = filepath.Clean(artist)
+		store.CreateArtist(artist)
+		store.CreateAlbum(artist, album)
+		if err := os.MkdirAll(root+dir, 0777); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(root+song, []byte("RIFF\x04\x00\x00\x00WAVE"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := store.CreateSong(artist, album, name, root+dir); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return root
+}
+
+func TestSongsViewPager(t *testing.T) {
+	var songs []string
+	for i := 0; i < 10; i++ {
+		songs = append(songs, fmt.Sprintf("Artist_%d/Album/Song.wav", i))
+	}
+	testLibrary(t, songs...)
+
+	page := songsViewPager()
+	var names []string
+	after := ""
+	for {
+		entries, err := page(after, 3)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, e := range entries {
+			names = append(names, e.Name)
+		}
+		if len(entries) < 3 {
+			break
+		}
+		after = entries[len(entries)-1].Name
+	}
+
+	if len(names) != 10 {
+		t.Fatalf("got %d Songs, want 10: %v", len(names), names)
+	}
+	seen := make(map[string]bool)
+	for _, name := range names {
+		if seen[name] {
+			t.Errorf("%s is listed twice", name)
+		}
+		seen[name] = true
+	}
+	if names[0] != "Song.wav" || names[1] != "Artist_1 - Album - Song.wav" {
+		t.Errorf("wrong names %v", names[:2])
+	}
+
+	// Reading from the start again gives the same names.
+	entries, err := page("", 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if entries[0].Name != names[0] || entries[1].Name != names[1] {
+		t.Errorf("the names changed after a rewind: %v", entries)
+	}
+}
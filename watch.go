@@ -0,0 +1,269 @@
+// Copyright 2016 Danko Miocevic. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Author: Danko Miocevic
+
+package main
+
+import (
+	"fmt"
+	"github.com/dankomiocevic/mulifs/musicmgr"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"bazil.org/fuse"
+	"github.com/fsnotify/fsnotify"
+	"github.com/golang/glog"
+)
+
+// watchTimers keeps a timer for every music file being
+// written in the watch Directories, the timer is started
+// again on every write and the file is imported once it
+// was not written for drop_settle seconds.
+var watchTimers = struct {
+	sync.Mutex
+	m map[string]*time.Timer
+}{m: make(map[string]*time.Timer)}
+
+// watchSettle returns the time a file of the watch
+// Directories must not be written before it is imported.
+func watchSettle() time.Duration {
+	if settleDelay() < time.Second {
+		return time.Second
+	}
+	return settleDelay()
+}
+
+// isWatchedFile returns true if the file of the watch
+// Directories is a music file that must be imported.
+func isWatchedFile(fi os.FileInfo) bool {
+	return fi.Mode().IsRegular() && !strings.HasPrefix(fi.Name(), ".") && musicmgr.IsMusicFile(fi.Name())
+}
+
+// addWatchDir watches the Directory and its SubDirectories,
+// the hidden ones are skipped. The music files already inside
+// them are imported once they settle.
+func addWatchDir(w *fsnotify.Watcher, dir, mPoint string) {
+	filepath.Walk(dir, func(path string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return nil
+		}
+
+		if fi.IsDir() {
+			if path != dir && strings.HasPrefix(fi.Name(), ".") {
+				return filepath.SkipDir
+			}
+			if err := w.Add(path); err != nil {
+				glog.Errorf("Cannot watch %s: %s\n", path, err)
+			}
+			return nil
+		}
+
+		if isWatchedFile(fi) {
+			settleWatched(path, mPoint)
+		}
+		return nil
+	})
+}
+
+// settleWatched starts the timer of the file again.
+func settleWatched(path, mPoint string) {
+	watchTimers.Lock()
+	defer watchTimers.Unlock()
+	if t, ok := watchTimers.m[path]; ok {
+		t.Reset(watchSettle())
+		return
+	}
+
+	watchTimers.m[path] = time.AfterFunc(watchSettle(), func() {
+		importSettled(path, mPoint)
+	})
+}
+
+// forgetWatched stops the timer of a file
+// removed or moved out of the watch Directory.
+func forgetWatched(path string) {
+	watchTimers.Lock()
+	defer watchTimers.Unlock()
+	if t, ok := watchTimers.m[path]; ok {
+		t.Stop()
+		delete(watchTimers.m, path)
+	}
+}
+
+// importSettled imports the file when its timer expires,
+// if it was modified without an event, like on some
+// network filesystems, the timer waits again.
+func importSettled(path, mPoint string) {
+	fi, err := os.Stat(path)
+	if err != nil {
+		forgetWatched(path)
+		return
+	}
+
+	watchTimers.Lock()
+	if wait := watchSettle() - time.Since(fi.ModTime()); wait > 0 {
+		if t, ok := watchTimers.m[path]; ok {
+			t.Reset(wait)
+		}
+		watchTimers.Unlock()
+		return
+	}
+	delete(watchTimers.m, path)
+	watchTimers.Unlock()
+
+	err = importWatched(path, mPoint)
+	if err != nil {
+		glog.Errorf("Cannot import %s: %s\n", path, err)
+	}
+}
+
+// handleWatchEvent starts the timer of the music files
+// created or written and watches the new Directories.
+func handleWatchEvent(w *fsnotify.Watcher, e fsnotify.Event, mPoint string) {
+	if e.Has(fsnotify.Remove) || e.Has(fsnotify.Rename) {
+		forgetWatched(e.Name)
+		return
+	}
+
+	if !e.Has(fsnotify.Create) && !e.Has(fsnotify.Write) {
+		return
+	}
+
+	fi, err := os.Stat(e.Name)
+	if err != nil {
+		return
+	}
+
+	if fi.IsDir() {
+		if e.Has(fsnotify.Create) && !strings.HasPrefix(fi.Name(), ".") {
+			addWatchDir(w, e.Name, mPoint)
+		}
+		return
+	}
+
+	if isWatchedFile(fi) {
+		settleWatched(e.Name, mPoint)
+	}
+}
+
+// moveWatched moves the file to the drop Directory, the
+// file is copied when the watch Directory is in
+// another filesystem. A file that appeared with the
+// same name in the meantime is never replaced.
+func moveWatched(src, dst string) error {
+	err := os.Link(src, dst)
+	if err == nil {
+		return os.Remove(src)
+	}
+	if os.IsExist(err) {
+		return err
+	}
+
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		return err
+	}
+
+	_, err = io.Copy(out, in)
+	if err == nil {
+		err = out.Sync()
+	}
+	out.Close()
+	if err != nil {
+		os.Remove(dst)
+		return err
+	}
+	return os.Remove(src)
+}
+
+// importWatched moves a file of a watch Directory to
+// the drop Directory of the source and files it
+// like the files dropped in MuLi.
+func importWatched(path, mPoint string) error {
+	rootPoint := mPoint
+	if rootPoint[len(rootPoint)-1] != '/' {
+		rootPoint = rootPoint + "/"
+	}
+
+	err := os.MkdirAll(rootPoint+"drop", 0777)
+	if err != nil {
+		return err
+	}
+
+	// Another file with the same name may
+	// be waiting in the drop Directory.
+	name := filepath.Base(path)
+	extension := filepath.Ext(name)
+	for i := 1; ; i++ {
+		if _, err := os.Stat(rootPoint + "drop/" + name); os.IsNotExist(err) {
+			break
+		}
+		name = fmt.Sprintf("%s_%d%s", strings.TrimSuffix(filepath.Base(path), extension), i, extension)
+	}
+
+	err = moveWatched(path, rootPoint+"drop/"+name)
+	if err != nil {
+		return err
+	}
+
+	glog.Infof("Importing %s from the watch Directory.\n", path)
+	PushFileItem(File{artist: "drop", name: name, mPoint: mPoint}, dropHandler(fuse.Header{}))
+	return nil
+}
+
+// startWatch watches the watch Directories and imports
+// the music files created or moved inside them.
+func startWatch(mPoint string) {
+	if len(config_params.watch_dirs) < 1 {
+		return
+	}
+
+	w, err := fsnotify.NewWatcher()
+	if err != nil {
+		glog.Errorf("Cannot watch the watch Directories: %s\n", err)
+		return
+	}
+
+	for _, dir := range config_params.watch_dirs {
+		addWatchDir(w, dir, mPoint)
+	}
+
+	go func() {
+		for {
+			select {
+			case e, ok := <-w.Events:
+				if !ok {
+					return
+				}
+				handleWatchEvent(w, e, mPoint)
+			case err, ok := <-w.Errors:
+				if !ok {
+					return
+				}
+				glog.Errorf("Error watching the watch Directories: %s\n", err)
+			}
+		}
+	}()
+}
@@ -0,0 +1,151 @@
+// Copyright 2016 Danko Miocevic. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Author: Danko Miocevic
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"github.com/dankomiocevic/mulifs/store"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/golang/glog"
+)
+
+// webhookEvent is the JSON body sent to the webhooks
+// when the Library is changed through the mountpoint.
+type webhookEvent struct {
+	Event     string    `json:"event"`
+	Operation string    `json:"operation"`
+	Time      time.Time `json:"time"`
+	Uid       uint32    `json:"uid"`
+	Paths     []string  `json:"paths"`
+}
+
+// webhookQueueSize is the number of events waiting to be
+// sent, the new events are discarded when it is full.
+const webhookQueueSize = 256
+
+// webhookEvents are the events waiting to be sent.
+var webhookEvents = make(chan webhookEvent, webhookQueueSize)
+
+// webhookClient is the HTTP client used to send the events.
+var webhookClient = &http.Client{Timeout: 10 * time.Second}
+
+// webhookActions are the names used in the events
+// for the operations recorded in the audit log.
+var webhookActions = map[string]string{
+	"mkdir":  "created",
+	"create": "added",
+	"drop":   "added",
+	"rename": "renamed",
+	"delete": "removed",
+	"edit":   "edited",
+	"retag":  "retagged",
+}
+
+// eventName returns the name of the event for the
+// operation, like album.renamed, based on the resulting
+// path. The changes inside the drop Directory do
+// not change the Library and have no event.
+func eventName(op, path string) string {
+	items := strings.Split(strings.Trim(path, "/"), "/")
+	if strings.HasPrefix(op, "playlist") || items[0] == "playlists" {
+		return "playlist.changed"
+	}
+
+	action, ok := webhookActions[op]
+	if !ok || isDropName(items[0]) {
+		return ""
+	}
+
+	// The edited files belong to their Directory.
+	depth := len(items)
+	if op == "edit" || op == "retag" {
+		depth--
+	}
+
+	switch depth {
+	case 1:
+		return "artist." + action
+	case 2:
+		return "album." + action
+	}
+	return "song." + action
+}
+
+// notifyWebhooks queues the event of the operation
+// to be sent to the webhooks.
+func notifyWebhooks(entry store.AuditEntry) {
+	if len(config_params.webhooks) < 1 || len(entry.Paths) < 1 {
+		return
+	}
+
+	name := eventName(entry.Op, entry.Paths[len(entry.Paths)-1])
+	if len(name) < 1 {
+		return
+	}
+
+	event := webhookEvent{Event: name, Operation: entry.Op, Time: entry.Time, Uid: entry.Uid, Paths: entry.Paths}
+	select {
+	case webhookEvents <- event:
+	default:
+		glog.Errorf("Too many webhook events, %s discarded.\n", name)
+	}
+}
+
+// sendWebhook posts the event to the URL.
+func sendWebhook(url string, body []byte) error {
+	resp, err := webhookClient.Post(url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return errors.New("Wrong response from the webhook: " + resp.Status)
+	}
+	return nil
+}
+
+// startWebhooks sends the queued events to every
+// webhook in the order they happened, the events
+// that cannot be sent are discarded.
+func startWebhooks() {
+	if len(config_params.webhooks) < 1 {
+		return
+	}
+
+	go func() {
+		for event := range webhookEvents {
+			body, err := json.Marshal(event)
+			if err != nil {
+				glog.Error(err)
+				continue
+			}
+
+			for _, url := range config_params.webhooks {
+				err := sendWebhook(url, body)
+				if err != nil {
+					glog.Errorf("Cannot send the event %s to %s: %s\n", event.Event, url, err)
+				}
+			}
+		}
+	}()
+}
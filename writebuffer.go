@@ -0,0 +1,206 @@
+// Copyright 2016 Danko Miocevic. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Author: Danko Miocevic
+package main
+
+import (
+	"errors"
+	"github.com/dankomiocevic/mulifs/musicmgr"
+	"github.com/dankomiocevic/mulifs/store"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"bazil.org/fuse"
+	"github.com/golang/glog"
+)
+
+// writeBuffer is the temporary file that holds the new
+// content of a Song, with the size and the time of the
+// last write kept by the handle writing it.
+type writeBuffer struct {
+	path    string
+	size    int64
+	modTime time.Time
+}
+
+// writeBuffers maps the path of the Songs being written
+// to the temporary file that holds the new content.
+var writeBuffers = struct {
+	sync.Mutex
+	m map[string]*writeBuffer
+}{m: make(map[string]*writeBuffer)}
+
+// getWriteBuffer returns the temporary file used to
+// write the Song in the specified path, if any.
+func getWriteBuffer(songPath string) (string, bool) {
+	writeBuffers.Lock()
+	defer writeBuffers.Unlock()
+	b, ok := writeBuffers.m[songPath]
+	if !ok {
+		return "", false
+	}
+	return b.path, true
+}
+
+// resizeWriteBuffer records the size of the temporary file
+// after a write, that only makes it grow, or a truncate.
+func resizeWriteBuffer(songPath, tmpPath string, size int64, truncate bool) {
+	writeBuffers.Lock()
+	defer writeBuffers.Unlock()
+	b, ok := writeBuffers.m[songPath]
+	if !ok || b.path != tmpPath {
+		return
+	}
+
+	if truncate || size > b.size {
+		b.size = size
+	}
+	b.modTime = time.Now()
+}
+
+// writtenAttr returns the size and the time of the last
+// write of the Song or the dropped file being written in
+// the path. They are kept by the handles, so Attr does not
+// read the files while they are written or replaced.
+func writtenAttr(path string) (int64, time.Time, bool) {
+	writeBuffers.Lock()
+	b, ok := writeBuffers.m[path]
+	if ok {
+		size, modTime := b.size, b.modTime
+		writeBuffers.Unlock()
+		return size, modTime, true
+	}
+	writeBuffers.Unlock()
+	return uploadAttr(path)
+}
+
+// recordWrite records the end of the last write of the
+// handle in the state of the Song or the dropped file.
+// The position of the file is used, the writes of the
+// files opened with O_APPEND go to their end.
+func (fh *FileHandle) recordWrite() {
+	if len(fh.songPath) < 1 && len(fh.upload) < 1 {
+		return
+	}
+
+	end, err := fh.r.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return
+	}
+
+	if len(fh.upload) > 0 {
+		resizeUpload(fh.upload, end, false)
+		return
+	}
+	resizeWriteBuffer(fh.songPath, fh.r.Name(), end, false)
+}
+
+// useWriteBuffer returns true if the writes to the File
+// must be buffered, only the Songs in the Albums are.
+func (f *File) useWriteBuffer() bool {
+	if f.isDropped() || f.artist == "playlists" || f.policy != policyNone {
+		return false
+	}
+	return musicmgr.IsMusicFile(f.name)
+}
+
+// openWriteBuffer creates a temporary file next to the Song
+// that receives all the writes, the current content of the
+// Song is copied unless the file is truncated.
+// The Song is replaced on Release only if the temporary file
+// contains a complete music file.
+func openWriteBuffer(songPath string, flags fuse.OpenFlags) (*os.File, error) {
+	dir, name := filepath.Split(songPath)
+	tmp, err := ioutil.TempFile(dir, ".muli-"+name+"-")
+	if err != nil {
+		return nil, err
+	}
+
+	var size int64
+	if flags&fuse.OpenTruncate == 0 {
+		src, err := os.Open(songPath)
+		if err == nil {
+			size, err = io.Copy(tmp, src)
+			src.Close()
+		}
+
+		if err != nil && !os.IsNotExist(err) {
+			tmp.Close()
+			os.Remove(tmp.Name())
+			return nil, err
+		}
+	}
+
+	writeBuffers.Lock()
+	writeBuffers.m[songPath] = &writeBuffer{path: tmp.Name(), size: size, modTime: time.Now()}
+	writeBuffers.Unlock()
+	return tmp, nil
+}
+
+// truncateWriteBuffer truncates the temporary file used to
+// write the Song, it returns false if there is none.
+func truncateWriteBuffer(songPath string, size int64) (bool, error) {
+	tmpPath, ok := getWriteBuffer(songPath)
+	if !ok {
+		return false, nil
+	}
+
+	err := os.Truncate(tmpPath, size)
+	if err == nil {
+		resizeWriteBuffer(songPath, tmpPath, size, true)
+	}
+	return true, err
+}
+
+// commitWriteBuffer replaces the Song with the content of the
+// temporary file once the handle is closed.
+// If nothing was written the temporary file is discarded, if
+// the content is not a complete music file the Song is kept as it
+// was and the new Songs are removed from the Library.
+func (fh *FileHandle) commitWriteBuffer() error {
+	tmpPath := fh.r.Name()
+
+	writeBuffers.Lock()
+	if b, ok := writeBuffers.m[fh.songPath]; ok && b.path == tmpPath {
+		delete(writeBuffers.m, fh.songPath)
+	}
+	writeBuffers.Unlock()
+
+	if !fh.dirty {
+		return os.Remove(tmpPath)
+	}
+
+	// The uploads cut after the header are
+	// not written over the Song.
+	if !musicmgr.IsCompleteMusicContent(tmpPath, fh.songPath) {
+		glog.Errorf("Discarding %s, it is not a complete music file.\n", fh.f.name)
+		os.Remove(tmpPath)
+		if fh.created {
+			store.DeleteSong(fh.f.artist, fh.f.album, fh.f.name, fh.f.mPoint)
+		}
+		return errors.New("Invalid music file.")
+	}
+
+	err := os.Rename(tmpPath, fh.songPath)
+	if err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+	return nil
+}
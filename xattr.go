@@ -0,0 +1,87 @@
+// Copyright 2016 Danko Miocevic. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Author: Danko Miocevic
+
+package main
+
+import (
+	"github.com/dankomiocevic/mulifs/musicmgr"
+	"github.com/dankomiocevic/mulifs/store"
+	"sort"
+	"strconv"
+
+	"bazil.org/fuse"
+	"bazil.org/fuse/fs"
+	"golang.org/x/net/context"
+)
+
+// xattrPrefix is the prefix of the extended
+// attributes of the Songs.
+const xattrPrefix = "user.mulifs."
+
+// songXattrs returns the extended attributes of
+// the File if it is a Song, by their names.
+func (f *File) songXattrs() map[string]string {
+	if f.policy != policyNone || len(f.album) < 1 || f.isDropped() ||
+		f.artist == "playlists" || !musicmgr.IsMusicFile(f.name) {
+		return nil
+	}
+
+	song, err := store.GetSong(f.artist, f.album, f.name)
+	if err != nil {
+		return nil
+	}
+
+	a := make(map[string]string)
+	if len(song.BPM) > 0 {
+		a[xattrPrefix+"bpm"] = song.BPM
+	}
+	if len(song.Key) > 0 {
+		a[xattrPrefix+"key"] = song.Key
+	}
+	if len(song.Codec) > 0 {
+		a[xattrPrefix+"codec"] = song.Codec
+	}
+	if len(song.Bitrate) > 0 {
+		a[xattrPrefix+"bitrate"] = song.Bitrate
+	}
+	if song.Duration > 0 {
+		a[xattrPrefix+"duration"] = strconv.Itoa(song.Duration)
+	}
+	return a
+}
+
+var _ = fs.NodeGetxattrer(&File{})
+
+func (f *File) Getxattr(ctx context.Context, req *fuse.GetxattrRequest, resp *fuse.GetxattrResponse) error {
+	value, ok := f.songXattrs()[req.Name]
+	if !ok {
+		return fuse.ErrNoXattr
+	}
+	resp.Xattr = []byte(value)
+	return nil
+}
+
+var _ = fs.NodeListxattrer(&File{})
+
+func (f *File) Listxattr(ctx context.Context, req *fuse.ListxattrRequest, resp *fuse.ListxattrResponse) error {
+	var names []string
+	for name := range f.songXattrs() {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	resp.Append(names...)
+	return nil
+}